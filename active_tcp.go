@@ -0,0 +1,360 @@
+package ice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/transport/packetio"
+)
+
+const (
+	defaultActiveTCPDialTimeout        = 5 * time.Second
+	defaultActiveTCPRetryBackoff       = 500 * time.Millisecond
+	defaultActiveTCPMaxAttempts        = 3
+	defaultActiveTCPMaxConcurrentDials = 16
+
+	// activeTCPPort is the port of the active TCP candidates, the discard
+	// port as in their signaling (RFC 6544, section 4.5): the port of their
+	// connection is picked as it is dialed
+	activeTCPPort = 9
+)
+
+// ActiveTCPConfig enables active ICE-TCP candidates: the agent connects to
+// each passive TCP candidate of the peer from its local addresses, and pairs
+// every connection with the candidate as an active host candidate.
+type ActiveTCPConfig struct {
+	// DialTimeout bounds each connection attempt. Defaults to 5 seconds.
+	DialTimeout time.Duration
+
+	// RetryBackoff is the delay before retrying a failed attempt, doubled
+	// after every retry. Defaults to 500 milliseconds.
+	RetryBackoff time.Duration
+
+	// MaxAttempts is the number of attempts to connect to a candidate from
+	// a local address before giving up. Defaults to 3.
+	MaxAttempts int
+
+	// MaxConcurrentDials is the number of connection attempts of the agent
+	// in progress at once, the others wait for their turn. It bounds the
+	// file descriptors used when the peer has many passive candidates.
+	// Defaults to 16.
+	MaxConcurrentDials int
+}
+
+func (config ActiveTCPConfig) withDefaults() *ActiveTCPConfig {
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = defaultActiveTCPDialTimeout
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = defaultActiveTCPRetryBackoff
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaultActiveTCPMaxAttempts
+	}
+	if config.MaxConcurrentDials <= 0 {
+		config.MaxConcurrentDials = defaultActiveTCPMaxConcurrentDials
+	}
+	return &config
+}
+
+// addActiveTCPCandidates connects to the passive TCP candidate remote from
+// each local address, and pairs it with an active host candidate per
+// connection. The candidates are not signaled, the peer learns them as peer
+// reflexive candidates.
+//
+// Note: the caller should hold the agent lock.
+func (a *Agent) addActiveTCPCandidates(remote Candidate) {
+	if a.activeTCP == nil || remote.TCPType() != TCPTypePassive || a.net.IsVirtual() || a.customTransport() {
+		return
+	}
+	networkType := remote.NetworkType()
+	if !containsNetworkType(a.networkTypes, networkType) {
+		return
+	}
+	remoteIP := net.ParseIP(remote.Address())
+	if remoteIP == nil {
+		return
+	}
+	raddr := &net.TCPAddr{IP: remoteIP, Port: remote.Port()}
+
+	localIPs, err := localInterfaces(a.net, a.getInterfaceFilter(), []NetworkType{networkType})
+	if err != nil {
+		a.log.Warnf("Failed to get local interfaces for active TCP candidates: %v", err)
+		return
+	}
+
+	for _, ip := range localIPs {
+		if !a.reserveSocket(a.context(), CandidateTypeHost, networkType.String()) {
+			return
+		}
+		local, err := NewCandidateHost(&CandidateHostConfig{
+			Network:   tcp,
+			Address:   ip.String(),
+			Port:      activeTCPPort,
+			Component: remote.Component(),
+			TCPType:   TCPTypeActive,
+		})
+		if err != nil {
+			a.sockets.release()
+			a.log.Warnf("Failed to create active TCP candidate: %v", err)
+			continue
+		}
+
+		conn := newActiveTCPConn(a.context(), &net.TCPAddr{IP: ip}, raddr, a.dialActiveTCP, a.log)
+		local.start(local, a, conn, a.startedCh)
+		a.sockets.add(local)
+		a.localCandidates[networkType] = append(a.localCandidates[networkType], local)
+		a.logEvent(logging.LogLevelDebug, "active TCP candidate added", "candidate", local.String(), "remote", remote.String())
+		a.addPair(local, remote)
+	}
+}
+
+// dialActiveTCP connects laddr to raddr, retrying with backoff according to
+// AgentConfig.ActiveTCP.
+func (a *Agent) dialActiveTCP(ctx context.Context, laddr, raddr *net.TCPAddr) (net.Conn, error) {
+	backoff := a.activeTCP.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		conn, err := a.dialActiveTCPOnce(ctx, laddr, raddr)
+		if err == nil {
+			return conn, nil
+		}
+		if attempt >= a.activeTCP.MaxAttempts {
+			return nil, err
+		}
+		a.log.Debugf("Failed to connect %s to %s (attempt %d), retrying in %s: %v", laddr, raddr, attempt, backoff, err)
+
+		retry := make(chan struct{})
+		timer := a.clock.AfterFunc(backoff, func() {
+			close(retry)
+		})
+		select {
+		case <-retry:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+func (a *Agent) dialActiveTCPOnce(ctx context.Context, laddr, raddr *net.TCPAddr) (net.Conn, error) {
+	select {
+	case a.activeTCPDials <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() {
+		<-a.activeTCPDials
+	}()
+
+	dialer := &net.Dialer{LocalAddr: laddr, Timeout: a.activeTCP.DialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", raddr.String())
+	if err != nil {
+		return nil, err
+	}
+	if a.tcpOptions != nil {
+		if err := a.tcpOptions.apply(conn); err != nil {
+			a.log.Warnf("Failed to set TCP options on connection to %s: %s", raddr, err)
+		}
+	}
+	return conn, nil
+}
+
+// removeActiveTCPCandidates closes and removes the active TCP candidates
+// matching remove, as the remote candidates they are connected to are
+// removed.
+// Note: the caller should hold the agent lock.
+func (a *Agent) removeActiveTCPCandidates(remove func(local Candidate) bool) {
+	for networkType, set := range a.localCandidates {
+		var kept []Candidate
+		for _, c := range set {
+			if c.TCPType() != TCPTypeActive || !remove(c) {
+				kept = append(kept, c)
+				continue
+			}
+			if err := c.close(); err != nil {
+				a.log.Warnf("Failed to close candidate %s: %v", c, err)
+			}
+			a.logEvent(logging.LogLevelDebug, "active TCP candidate removed", "candidate", c.String())
+		}
+		a.localCandidates[networkType] = kept
+	}
+}
+
+func containsNetworkType(networkTypes []NetworkType, networkType NetworkType) bool {
+	for _, t := range networkTypes {
+		if t == networkType {
+			return true
+		}
+	}
+	return false
+}
+
+// activeTCPConn is the net.PacketConn of an active TCP candidate. Its
+// connection is dialed in the background from localAddr, packets written
+// until it is established are queued. Once the dial failed, or the
+// connection did, writes fail.
+type activeTCPConn struct {
+	localAddr, remoteAddr *net.TCPAddr
+	readBuffer            *packetio.Buffer
+	writeBuffer           *packetio.Buffer
+	log                   logging.LeveledLogger
+
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newActiveTCPConn(
+	ctx context.Context,
+	laddr, raddr *net.TCPAddr,
+	dial func(ctx context.Context, laddr, raddr *net.TCPAddr) (net.Conn, error),
+	log logging.LeveledLogger,
+) *activeTCPConn {
+	ctx, cancel := context.WithCancel(ctx)
+	c := &activeTCPConn{
+		localAddr:   laddr,
+		remoteAddr:  raddr,
+		readBuffer:  packetio.NewBuffer(),
+		writeBuffer: packetio.NewBuffer(),
+		log:         log,
+		cancel:      cancel,
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		conn, err := dial(ctx, laddr, raddr)
+		if err != nil {
+			c.log.Infof("Failed to connect %s to %s: %v", laddr, raddr, err)
+			_ = c.readBuffer.Close()
+			_ = c.writeBuffer.Close()
+			return
+		}
+
+		c.mu.Lock()
+		if ctx.Err() != nil {
+			c.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		c.conn = conn
+		c.mu.Unlock()
+
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.writeLoop(conn)
+		}()
+		c.readLoop(conn)
+	}()
+
+	return c
+}
+
+func (c *activeTCPConn) readLoop(conn net.Conn) {
+	defer func() {
+		_ = c.readBuffer.Close()
+	}()
+
+	buf := make([]byte, receiveMTU)
+	for {
+		n, err := readStreamingPacket(conn, buf)
+		if errors.Is(err, io.ErrShortBuffer) {
+			c.log.Warnf("Discarded packet of %d bytes from %s, larger than the read buffer", n, c.remoteAddr)
+			continue
+		}
+		if err != nil {
+			c.log.Infof("%v: %s", errReadingStreamingPacket, err)
+			return
+		}
+		if _, err := c.readBuffer.Write(buf[:n]); err != nil {
+			return
+		}
+	}
+}
+
+func (c *activeTCPConn) writeLoop(conn net.Conn) {
+	defer func() {
+		_ = c.writeBuffer.Close()
+	}()
+
+	writer := newStreamingPacketWriter(conn)
+	buf := make([]byte, maxStreamingPacketSize)
+	for {
+		n, err := c.writeBuffer.Read(buf)
+		if err != nil {
+			return
+		}
+		if _, err := writer.writePacket(buf[:n]); err != nil {
+			c.log.Infof("%v %s: %s", errWriting, c.remoteAddr, err)
+			return
+		}
+	}
+}
+
+func (c *activeTCPConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, err := c.readBuffer.Read(b)
+	return n, c.remoteAddr, err
+}
+
+func (c *activeTCPConn) WriteTo(b []byte, _ net.Addr) (int, error) {
+	if len(b) > maxStreamingPacketSize {
+		return 0, fmt.Errorf("%w: %d bytes", ErrStreamingPacketTooLarge, len(b))
+	}
+	return c.writeBuffer.Write(b)
+}
+
+// Close stops dialing or closes the connection, and waits for the
+// background goroutines.
+func (c *activeTCPConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.cancel()
+		_ = c.readBuffer.Close()
+		_ = c.writeBuffer.Close()
+
+		c.mu.Lock()
+		if c.conn != nil {
+			err = c.conn.Close()
+		}
+		c.mu.Unlock()
+
+		c.wg.Wait()
+	})
+	return err
+}
+
+// LocalAddr returns the address the connection is dialed from, with its
+// port once connected.
+func (c *activeTCPConn) LocalAddr() net.Addr {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != nil {
+		return c.conn.LocalAddr()
+	}
+	return c.localAddr
+}
+
+func (c *activeTCPConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *activeTCPConn) SetReadDeadline(t time.Time) error {
+	return c.readBuffer.SetReadDeadline(t)
+}
+
+func (c *activeTCPConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
@@ -0,0 +1,144 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActiveTCP(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4zero})
+	require.NoError(t, err)
+
+	passive, err := NewAgent(&AgentConfig{
+		NetworkTypes: []NetworkType{NetworkTypeTCP4},
+		TCPMux: NewTCPMuxDefault(TCPMuxParams{
+			Listener:       listener,
+			Logger:         logging.NewDefaultLoggerFactory().NewLogger("ice"),
+			ReadBufferSize: 8,
+		}),
+	})
+	require.NoError(t, err)
+
+	active, err := NewAgent(&AgentConfig{
+		NetworkTypes: []NetworkType{NetworkTypeTCP4},
+		ActiveTCP:    &ActiveTCPConfig{MaxConcurrentDials: 1},
+		TCPOptions:   &TCPOptions{NoDelay: TCPNoDelayEnabled},
+	})
+	require.NoError(t, err)
+
+	activeConn, passiveConn := connect(active, passive)
+
+	pair, err := active.GetSelectedCandidatePair()
+	require.NoError(t, err)
+	require.NotNil(t, pair)
+	assert.Equal(t, TCPTypeActive, pair.Local.TCPType())
+	assert.Equal(t, TCPTypePassive, pair.Remote.TCPType())
+
+	_, err = activeConn.Write([]byte("active"))
+	require.NoError(t, err)
+	buf := make([]byte, receiveMTU)
+	n, err := passiveConn.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "active", string(buf[:n]))
+
+	// The active candidate is removed with the passive candidate it is
+	// connected to
+	require.NoError(t, active.RemoveRemoteCandidate(pair.Remote))
+	locals, err := active.GetLocalCandidates()
+	require.NoError(t, err)
+	for _, c := range locals {
+		assert.NotEqual(t, TCPTypeActive, c.TCPType())
+	}
+
+	assert.NoError(t, activeConn.Close())
+	assert.NoError(t, passiveConn.Close())
+	assert.NoError(t, passive.tcpMux.Close())
+}
+
+func TestActiveTCPRetry(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	a, err := NewAgent(&AgentConfig{
+		ActiveTCP: &ActiveTCPConfig{RetryBackoff: 100 * time.Millisecond, MaxAttempts: 3},
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	// Nothing listens on the remote port
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	raddr := listener.Addr().(*net.TCPAddr) //nolint:forcetypeassert
+	require.NoError(t, listener.Close())
+
+	started := time.Now()
+	conn := newActiveTCPConn(context.Background(), &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}, raddr, a.dialActiveTCP, a.log)
+	defer func() {
+		assert.NoError(t, conn.Close())
+	}()
+
+	// The conn is closed once the attempts are exhausted, after backoffs of
+	// 100 and 200 milliseconds
+	_, _, err = conn.ReadFrom(make([]byte, receiveMTU))
+	assert.Error(t, err)
+	assert.GreaterOrEqual(t, int64(time.Since(started)), int64(300*time.Millisecond))
+
+	// Packets are no longer queued
+	_, err = conn.WriteTo([]byte("lost"), raddr)
+	assert.Error(t, err)
+}
+
+func TestActiveTCPMaxConcurrentDials(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	a, err := NewAgent(&AgentConfig{
+		ActiveTCP: &ActiveTCPConfig{MaxConcurrentDials: 2},
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, listener.Close())
+	}()
+	laddr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+	raddr := listener.Addr().(*net.TCPAddr) //nolint:forcetypeassert
+
+	// Two dials in progress, the next one waits for its turn
+	a.activeTCPDials <- struct{}{}
+	a.activeTCPDials <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = a.dialActiveTCPOnce(ctx, laddr, raddr)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Once one is done, it takes its turn and gives it back
+	<-a.activeTCPDials
+	conn, err := a.dialActiveTCPOnce(context.Background(), laddr, raddr)
+	require.NoError(t, err)
+	assert.NoError(t, conn.Close())
+	assert.Len(t, a.activeTCPDials, 1)
+	<-a.activeTCPDials
+}
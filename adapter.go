@@ -0,0 +1,160 @@
+package ice
+
+import (
+	"net"
+	"strconv"
+)
+
+// extensionNetworkCost is the candidate extension carrying the cost of the
+// network adapter of a host candidate, as signaled by browsers.
+const extensionNetworkCost = "network-cost"
+
+// Network costs of the adapter types, those of libwebrtc
+const (
+	networkCostMin      = 0
+	networkCostLow      = 10
+	networkCostUnknown  = 50
+	networkCostCellular = 900
+	networkCostMax      = 999
+)
+
+// AdapterType is the kind of network adapter a host candidate is gathered
+// on. It is only known on Windows and Apple platforms. On Apple platforms
+// it is guessed from the name of the interface, which only identifies the
+// cellular, tunnel and virtual adapters: Wi-Fi and Ethernet adapters are of
+// unknown type there, and the expensive and constrained flags of the
+// system are not read.
+type AdapterType int
+
+const (
+	// AdapterTypeEthernet is a wired adapter.
+	AdapterTypeEthernet AdapterType = iota + 1
+
+	// AdapterTypeWiFi is a wireless LAN adapter.
+	AdapterTypeWiFi
+
+	// AdapterTypeCellular is a mobile broadband adapter, metered.
+	AdapterTypeCellular
+
+	// AdapterTypeVPN is a tunnel or point-to-point adapter.
+	AdapterTypeVPN
+
+	// AdapterTypeVirtual is the adapter of a virtual switch or a virtual
+	// machine host, e.g. Hyper-V, WSL or VirtualBox, or a peer-to-peer
+	// link such as AWDL, usually unreachable from the peer.
+	AdapterTypeVirtual
+)
+
+func (t AdapterType) String() string {
+	switch t {
+	case AdapterTypeEthernet:
+		return "ethernet"
+	case AdapterTypeWiFi:
+		return "wifi"
+	case AdapterTypeCellular:
+		return "cellular"
+	case AdapterTypeVPN:
+		return "vpn"
+	case AdapterTypeVirtual:
+		return "virtual"
+	default:
+		return ErrUnknownType.Error()
+	}
+}
+
+// isExpensive reports whether sending over an adapter of type t may be
+// charged by volume.
+func (t AdapterType) isExpensive() bool {
+	return t == AdapterTypeCellular
+}
+
+// networkCost is the cost of sending over an adapter of type t, the
+// cheapest adapters being preferred.
+func (t AdapterType) networkCost() uint16 {
+	switch t {
+	case AdapterTypeEthernet:
+		return networkCostMin
+	case AdapterTypeWiFi:
+		return networkCostLow
+	case AdapterTypeCellular:
+		return networkCostCellular
+	case AdapterTypeVirtual:
+		return networkCostMax
+	default:
+		return networkCostUnknown
+	}
+}
+
+// candidateNetworkCost returns the network-cost extension of c, zero if it
+// has no valid one.
+func candidateNetworkCost(c Candidate) uint16 {
+	ext, ok := c.GetExtension(extensionNetworkCost)
+	if !ok {
+		return 0
+	}
+	cost, err := strconv.ParseUint(ext.Value, 10, 16)
+	if err != nil || cost > networkCostMax {
+		return 0
+	}
+	return uint16(cost)
+}
+
+// withoutExpensiveIPs returns the IPs not on an expensive adapter, or all of
+// them if they all are.
+func withoutExpensiveIPs(ips []net.IP, adapterTypes map[string]AdapterType) []net.IP {
+	var cheap []net.IP
+	for _, ip := range ips {
+		if t, ok := adapterTypes[ip.String()]; !ok || !t.isExpensive() {
+			cheap = append(cheap, ip)
+		}
+	}
+	if len(cheap) == 0 {
+		return ips
+	}
+	return cheap
+}
+
+// adapterTypesByIndex returns the type of the network adapters by interface
+// index, nil where the platform does not tell.
+var adapterTypesByIndex = platformAdapterTypes //nolint:gochecknoglobals
+
+// adapterTypesByIP returns the type of the adapter of each local IP, when
+// known. The adapters of a virtual network, or of a PacketTransport, have
+// no type.
+func (a *Agent) adapterTypesByIP() map[string]AdapterType {
+	if a.net.IsVirtual() || a.customTransport() {
+		return nil
+	}
+	types, err := adapterTypesByIndex()
+	if err != nil {
+		a.log.Warnf("Failed to get the network adapter types: %v", err)
+		return nil
+	}
+	if len(types) == 0 {
+		return nil
+	}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		a.log.Warnf("Failed to list the network interfaces: %v", err)
+		return nil
+	}
+
+	byIP := map[string]AdapterType{}
+	for _, iface := range ifaces {
+		t, ok := types[iface.Index]
+		if !ok {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				byIP[ipNet.IP.String()] = t
+			}
+		}
+	}
+	return byIP
+}
@@ -0,0 +1,39 @@
+//go:build darwin
+// +build darwin
+
+package ice
+
+import (
+	"net"
+	"strings"
+)
+
+// platformAdapterTypes tells the adapters apart by name, the BSD name of
+// macOS and iOS interfaces being stable: pdp_ip for cellular, utun and
+// ipsec for tunnels, bridge for the Internet sharing and virtual machine
+// bridges, awdl and llw for the Apple Wireless Direct Link. The en
+// interfaces are Wi-Fi or Ethernet, which the name does not tell, nor
+// whether the network is a personal hotspot: they are left of unknown type.
+//
+// This is a heuristic on the name only. The isExpensive and isConstrained
+// flags of the system, which cover personal hotspots and Low Data Mode, are
+// only exposed by the Network framework through cgo and are not queried.
+func platformAdapterTypes() (map[int]AdapterType, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	types := map[int]AdapterType{}
+	for _, iface := range ifaces {
+		switch {
+		case strings.HasPrefix(iface.Name, "pdp_ip"):
+			types[iface.Index] = AdapterTypeCellular
+		case strings.HasPrefix(iface.Name, "utun"), strings.HasPrefix(iface.Name, "ipsec"):
+			types[iface.Index] = AdapterTypeVPN
+		case strings.HasPrefix(iface.Name, "bridge"), strings.HasPrefix(iface.Name, "awdl"), strings.HasPrefix(iface.Name, "llw"):
+			types[iface.Index] = AdapterTypeVirtual
+		}
+	}
+	return types, nil
+}
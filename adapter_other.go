@@ -0,0 +1,10 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+package ice
+
+// Adapter types are only known on Windows and Apple platforms
+
+func platformAdapterTypes() (map[int]AdapterType, error) {
+	return nil, nil
+}
@@ -0,0 +1,110 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"net"
+	"testing"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdapterTypes(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	ifaces, err := net.Interfaces()
+	require.NoError(t, err)
+
+	withAdapterType := func(adapterType AdapterType) func() {
+		saved := adapterTypesByIndex
+		adapterTypesByIndex = func() (map[int]AdapterType, error) {
+			types := map[int]AdapterType{}
+			for _, iface := range ifaces {
+				types[iface.Index] = adapterType
+			}
+			return types, nil
+		}
+		return func() {
+			adapterTypesByIndex = saved
+		}
+	}
+
+	gather := func(skipVirtualAdapters bool) []Candidate {
+		a, err := NewAgent(&AgentConfig{
+			NetworkTypes:        []NetworkType{NetworkTypeUDP4},
+			CandidateTypes:      []CandidateType{CandidateTypeHost},
+			Synchronous:         true,
+			SkipVirtualAdapters: skipVirtualAdapters,
+		})
+		require.NoError(t, err)
+		defer func() {
+			assert.NoError(t, a.Close())
+		}()
+
+		var candidates []Candidate
+		require.NoError(t, a.OnCandidate(func(c Candidate) {
+			if c != nil {
+				candidates = append(candidates, c)
+			}
+		}))
+		require.NoError(t, a.GatherCandidates())
+		return candidates
+	}
+
+	t.Run("NetworkCost", func(t *testing.T) {
+		defer withAdapterType(AdapterTypeWiFi)()
+
+		candidates := gather(false)
+		require.NotEmpty(t, candidates)
+		for _, c := range candidates {
+			ext, ok := c.GetExtension(extensionNetworkCost)
+			require.True(t, ok)
+			assert.Equal(t, "10", ext.Value)
+			assert.Equal(t, uint16(defaultLocalPreference-networkCostLow), c.(*CandidateHost).LocalPreference())
+		}
+	})
+
+	t.Run("SkipVirtualAdapters", func(t *testing.T) {
+		defer withAdapterType(AdapterTypeVirtual)()
+
+		assert.NotEmpty(t, gather(false))
+		assert.Empty(t, gather(true))
+	})
+}
+
+func TestWithoutExpensiveIPs(t *testing.T) {
+	wifi, cellular := net.ParseIP("192.0.2.1"), net.ParseIP("198.51.100.1")
+	unknown := net.ParseIP("203.0.113.1")
+	types := map[string]AdapterType{
+		wifi.String():     AdapterTypeWiFi,
+		cellular.String(): AdapterTypeCellular,
+	}
+
+	assert.Equal(t, []net.IP{wifi, unknown}, withoutExpensiveIPs([]net.IP{wifi, cellular, unknown}, types))
+
+	// The cellular adapter is used when it is the only one
+	assert.Equal(t, []net.IP{cellular}, withoutExpensiveIPs([]net.IP{cellular}, types))
+}
+
+func TestDefaultLocalPreferenceNetworkCost(t *testing.T) {
+	for _, tc := range []struct {
+		candidate string
+		pref      uint16
+	}{
+		{"1 1 udp 2130706431 192.0.2.1 1000 typ host", 65535},
+		{"1 1 udp 2130706431 192.0.2.1 1000 typ host network-cost 900", 65535 - 900},
+		{"1 1 tcp 2128609279 192.0.2.1 1000 typ host tcptype passive network-cost 10", (1<<13)*4 + 8191 - 10},
+		// Invalid costs are ignored
+		{"1 1 udp 2130706431 192.0.2.1 1000 typ host network-cost 100000", 65535},
+	} {
+		c, err := UnmarshalCandidate(tc.candidate)
+		require.NoError(t, err)
+		assert.Equal(t, tc.pref, DefaultLocalPreference(c), tc.candidate)
+	}
+
+	assert.Equal(t, "wifi", AdapterTypeWiFi.String())
+}
@@ -0,0 +1,67 @@
+//go:build windows
+// +build windows
+
+package ice
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// Interface types of IP_ADAPTER_INFO, from ipifcons.h
+const (
+	ifTypeEthernetCSMACD = 6
+	ifTypePPP            = 23
+	ifTypeIEEE80211      = 71
+	ifTypeTunnel         = 131
+	ifTypeWWANPP         = 243
+	ifTypeWWANPP2        = 244
+)
+
+// platformAdapterTypes reads the type and description of the adapters with
+// GetAdaptersInfo. Virtual switches report themselves as Ethernet adapters,
+// they are told apart by their description.
+func platformAdapterTypes() (map[int]AdapterType, error) {
+	size := uint32(15 * 1024)
+	var buf []byte
+	for {
+		buf = make([]byte, size)
+		err := syscall.GetAdaptersInfo((*syscall.IpAdapterInfo)(unsafe.Pointer(&buf[0])), &size)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, syscall.ERROR_BUFFER_OVERFLOW) {
+			return nil, err
+		}
+	}
+
+	types := map[int]AdapterType{}
+	for ai := (*syscall.IpAdapterInfo)(unsafe.Pointer(&buf[0])); ai != nil; ai = ai.Next {
+		description := string(ai.Description[:clen(ai.Description[:])])
+		switch {
+		case strings.Contains(description, "Virtual") || strings.Contains(description, "Hyper-V"):
+			types[int(ai.Index)] = AdapterTypeVirtual
+		case ai.Type == ifTypeIEEE80211:
+			types[int(ai.Index)] = AdapterTypeWiFi
+		case ai.Type == ifTypeWWANPP || ai.Type == ifTypeWWANPP2:
+			types[int(ai.Index)] = AdapterTypeCellular
+		case ai.Type == ifTypePPP || ai.Type == ifTypeTunnel:
+			types[int(ai.Index)] = AdapterTypeVPN
+		case ai.Type == ifTypeEthernetCSMACD:
+			types[int(ai.Index)] = AdapterTypeEthernet
+		}
+	}
+	return types, nil
+}
+
+// clen returns the length of the NUL-terminated string in b.
+func clen(b []byte) int {
+	for i, c := range b {
+		if c == 0 {
+			return i
+		}
+	}
+	return len(b)
+}
@@ -4,7 +4,11 @@ package ice
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -13,16 +17,22 @@ import (
 	"github.com/pion/logging"
 	"github.com/pion/mdns"
 	"github.com/pion/stun"
-	"github.com/pion/transport/packetio"
 	"github.com/pion/transport/vnet"
 	"golang.org/x/net/proxy"
 )
 
+type connectionStateChange struct {
+	state  ConnectionState
+	reason ConnectionStateChangeReason
+}
+
 type bindingRequest struct {
 	timestamp      time.Time
 	transactionID  [stun.TransactionIDSize]byte
 	destination    net.Addr
 	isUseCandidate bool
+	// local is the candidate the request was sent from
+	local Candidate
 }
 
 // Agent represents the ICE agent
@@ -31,33 +41,84 @@ type Agent struct {
 	afterRunFn []func(ctx context.Context)
 	muAfterRun sync.Mutex
 
+	// Overflow of chanTask, see task_queue.go
+	taskQueueOverflow BufferOverflowPolicy
+	droppedTasks      *uint64
+
 	onConnectionStateChangeHdlr       atomic.Value // func(ConnectionState)
+	onConnectionStateChangeReasonHdlr atomic.Value // func(ConnectionState, ConnectionStateChangeReason)
 	onSelectedCandidatePairChangeHdlr atomic.Value // func(Candidate, Candidate)
+	onSelectedPairInfoChangeHdlr      atomic.Value // func(SelectedPairInfo)
+	onLocalCredentialsChangeHdlr      atomic.Value // func(LocalCredentials)
+	onPathMTUChangeHdlr               atomic.Value // func(int)
 	onCandidateHdlr                   atomic.Value // func(Candidate)
+	onGatheringCompleteHdlr           atomic.Value // func(error)
+	onSTUNMessageHdlr                 atomic.Value // func(STUNMessageTrace)
+	onAuthenticationFailureHdlr       atomic.Value // func(AuthenticationFailure)
+	onSelectedPairRTTHdlr             atomic.Value // func(RTTSample)
 
 	// State owned by the taskLoop
 	onConnected     chan struct{}
 	onConnectedOnce sync.Once
 
-	// force candidate to be contacted immediately (instead of waiting for task ticker)
-	forceCandidateContact chan bool
+	// Path of the selected pair last notified, see selected_pair_info.go
+	lastSelectedPairInfo *SelectedPairInfo
+
+	// Path MTU of the selected pair, see pmtud.go
+	pathMTU                 int
+	pathMTUDiscovery        *pathMTUDiscovery
+	pathMTUDiscoveryEnabled bool
+	maxPathMTU              int
+
+	// Connectivity checks are run by checkTimer, see connectivity_checks.go.
+	// checkRequested forces candidates to be contacted immediately
+	// (instead of waiting for the next interval)
+	checkTimerMu      sync.Mutex
+	checkTimer        Timer
+	checkTimerStopped bool
+	checkRequested    bool
+
+	// Connection state seen by the last round of checks, owned by the taskLoop
+	checksLastState ConnectionState
+	checkingStarted time.Time
 
 	tieBreaker uint64
 	lite       bool
 
 	connectionState ConnectionState
 	gatheringState  GatheringState
+	// Last transitions of the states, see GetStateStats
+	connectionTransitions []ConnectionStateTransition
+	gatheringTransitions  []GatheringStateTransition
 
 	mDNSMode MulticastDNSMode
 	mDNSName string
 	mDNSConn *mdns.Conn
 
+	// mDNSConnShared is set when mDNSConn belongs to an AgentFactory, it is
+	// not closed with the agent
+	mDNSConnShared bool
+
 	muHaveStarted sync.Mutex
 	startedCh     <-chan struct{}
 	startedFn     func()
+
+	// connectCanceled is set when the context of Dial or Accept is done
+	// before a pair is selected, see resumeConnect
+	connectCanceled bool
+
 	isControlling bool
 
-	maxBindingRequests uint16
+	maxBindingRequests   uint16
+	maxChecksPerRemoteIP int
+	checkPacer           *CheckPacer
+
+	// Binding request being handled, see response_route.go
+	inboundRequest          *inboundRequest
+	responseRouteViolations uint64
+	strictResponseRouting   bool
+
+	relayAcrossAddressFamilies bool
 
 	hostAcceptanceMinWait  time.Duration
 	srflxAcceptanceMinWait time.Duration
@@ -67,7 +128,11 @@ type Agent struct {
 	portmin uint16
 	portmax uint16
 
-	candidateTypes []CandidateType
+	candidateTypes  []CandidateType
+	typePreferences map[CandidateType]uint16
+
+	foundationFunc      func(Candidate) string
+	localPreferenceFunc func(Candidate) uint16
 
 	// How long connectivity checks can fail before the ICE Agent
 	// goes to disconnected
@@ -81,9 +146,41 @@ type Agent struct {
 	// 0 means never
 	keepaliveInterval time.Duration
 
+	// How long the selected pair goes without traffic, application data
+	// included, before it is kept alive
+	keepaliveIdleTimeout time.Duration
+
+	// keepaliveIdleTimeoutDefault is set when keepaliveIdleTimeout was left
+	// to its default, it then follows keepaliveInterval on UpdateConfig
+	keepaliveIdleTimeoutDefault bool
+
+	// Payload of the application sent by the keepalives of the selected
+	// pair, along with or in place of a binding request
+	keepalivePayload     func(*CandidatePair) []byte
+	keepalivePayloadOnly bool
+
+	// Streams bundled on the agent, see stream.go
+	streams          streams
+	streamClassifier func([]byte) string
+
+	// Pairs kept alive besides the selected pair, and how often
+	keepaliveScope           KeepaliveScope
+	standbyKeepaliveInterval time.Duration
+
+	// standbyKeepaliveIntervalDefault is set like keepaliveIdleTimeoutDefault
+	standbyKeepaliveIntervalDefault bool
+
 	// How often should we run our internal taskLoop to check for state changes when connecting
 	checkInterval time.Duration
 
+	clock Clock
+
+	// stunFaults injects the STUNFaults, nil if there are none
+	stunFaults *stunFaultInjector
+
+	deterministicOrdering bool
+	candidateIDs          *candidateIDGenerator
+
 	localUfrag      string
 	localPwd        string
 	localCandidates map[NetworkType][]Candidate
@@ -100,14 +197,101 @@ type Agent struct {
 	urls         []*URL
 	networkTypes []NetworkType
 
-	buffer *packetio.Buffer
+	buffer *receiveBuffer
+
+	// Size of the largest packet received, see AgentConfig.MaxPacketSize
+	maxPacketSize        int
+	reportPacketTooLarge bool
+	// tooLargeWarnedAt is when a packet too large was last logged, in
+	// nanoseconds since the epoch, see dropTooLarge
+	tooLargeWarnedAt int64
 
 	// LRU of outbound Binding request Transaction IDs
 	pendingBindingRequests []bindingRequest
+	// answeredBindingRequests are the requests recently answered, to tell
+	// duplicate responses apart
+	answeredBindingRequests []bindingRequest
+	pendingPings            map[[stun.TransactionIDSize]byte]*pendingPing
 
 	// 1:1 D-NAT IP address mapping
 	extIPMapper *externalIPMapper
 
+	packetCapture *packetCapture
+
+	// Gathering failures and the last failure report, see
+	// gathering_error.go and diagnostics.go
+	muGatheringErrors sync.Mutex
+	gatheringErrors   []*CandidateGatheringError
+	failureReport     atomic.Value // *FailureReport
+
+	// Server reflexive addresses of the last gathering, see nat_type.go
+	natObservations natObservations
+
+	// Tracing, see tracing.go
+	tracer         Tracer
+	tracingParent  context.Context //nolint:containedctx
+	checksContext  context.Context //nolint:containedctx
+	checksSpan     Span
+	nominationSpan Span
+
+	icmpErrorDetection     bool
+	udpSegmentationOffload bool
+	disableBatchIO         bool
+	ioBackend              IOBackend
+	maxLocalCandidates     int
+	sockets                *socketBudget
+	// gatherWorkers holds a token per running gathering worker, nil if
+	// their number is unlimited
+	gatherWorkers chan struct{}
+	probeNAT      bool
+
+	resolver *net.Resolver
+
+	credentials credentialsConfig
+
+	closeTimeout time.Duration
+	// Errors closing the agent, set by taskLoop before taskLoopDone is closed
+	closeErrs []error
+
+	// Remote candidates added before the remote credentials
+	pendingRemoteCandidates []Candidate
+	// Triggered checks waiting for their remote candidate to be signaled
+	pendingTriggeredChecks []pendingTriggeredCheck
+
+	// Local candidates withheld by the HostDisclosure policy, see host_disclosure.go
+	hostDisclosure            HostDisclosure
+	hostDisclosureTimeout     time.Duration
+	hostDisclosureState       hostDisclosureState
+	hostDisclosureTimer       Timer
+	withheldCandidates        []withheldCandidate
+	gatheringCompleteDeferred bool
+
+	disablePrflx bool
+	maxPrflx     int
+	// Peer reflexive candidates learned since the last restart
+	prflxLearned      int
+	prflxLimitReached bool
+
+	// ICE options, see ice_options.go
+	localICEOptions            []ICEOption
+	remoteICEOptions           []ICEOption
+	acceptAggressiveNomination bool
+	nominationPolicy           func(NominationRequest) bool
+
+	// ICE generations, see generation.go
+	generation           uint32
+	minRemoteGeneration  uint32
+	maxRemoteGeneration  uint32
+	remoteGenerationSeen bool
+
+	// Connectivity check message construction, see stun.go
+	stunCreds    stunCredentials
+	outboundSTUN *stun.Message
+
+	// Binding request round trip times, see rtt_histogram.go
+	rttHistogramBuckets []time.Duration
+	rttHistogram        *rttHistogram
+
 	// State for closing
 	done         chan struct{}
 	taskLoopDone chan struct{}
@@ -116,23 +300,56 @@ type Agent struct {
 	gatherCandidateCancel func()
 	gatherCandidateDone   chan struct{}
 
-	chanCandidate     chan Candidate
-	chanCandidatePair chan *CandidatePair
-	chanState         chan ConnectionState
+	// Handlers run on goroutines that only exist while there are
+	// events to deliver, see handler_queue.go
+	candidateHandlers   handlerQueue
+	pairHandlers        handlerQueue
+	authFailureHandlers handlerQueue
+
+	// Closed and replaced when the connection or gathering state changes,
+	// see wait.go
+	stateChanged chan struct{}
 
-	loggerFactory logging.LoggerFactory
-	log           logging.LeveledLogger
+	// Synchronous mode, see synchronous.go
+	synchronous   bool
+	muSync        sync.Mutex
+	stateHandlers handlerQueue
+
+	loggerFactory    logging.LoggerFactory
+	log              logging.LeveledLogger
+	structuredLogger StructuredLogger
+	redactor         AddressRedactor
 
 	net         *vnet.Net
+	transport   PacketTransport
 	tcpMux      TCPMux
+	tcpOptions  *TCPOptions
 	udpMux      UDPMux
 	udpMuxSrflx UniversalUDPMux
 
-	interfaceFilter func(string) bool
+	// Active ICE-TCP, see active_tcp.go
+	activeTCP      *ActiveTCPConfig
+	activeTCPDials chan struct{}
+
+	// urls and interfaceFilter can be changed by UpdateConfig while
+	// gathering, see config_update.go
+	muConfig            sync.Mutex
+	interfaceFilter     func(string) bool
+	hostCandidateName   func(net.IP) string
+	portMapper          func(string, net.Addr) net.Addr
+	candidateConnAccess bool
+	skipVirtualAdapters bool
+	avoidExpensive      bool
+
+	allowedRemoteNetworks []*net.IPNet
+	deniedRemoteNetworks  []*net.IPNet
+	remoteCandidateFilter func(Candidate) bool
 
 	insecureSkipVerify bool
+	spkiPins           [][]byte
 
-	proxyDialer proxy.Dialer
+	proxyDialer     proxy.Dialer
+	proxyDialerFunc func(URL) proxy.Dialer
 }
 
 type task struct {
@@ -176,48 +393,46 @@ func (a *Agent) run(ctx context.Context, t func(context.Context, *Agent)) error
 	if err := a.ok(); err != nil {
 		return err
 	}
+	if a.synchronous {
+		return a.runSync(ctx, t)
+	}
 	done := make(chan struct{})
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
 	case a.chanTask <- task{t, done}:
-		<-done
-		return nil
 	}
-}
 
-// taskLoop handles registered tasks and agent close.
-func (a *Agent) taskLoop() {
-	after := func() {
-		for {
-			// Get and run func registered by afterRun().
-			fns := a.getAfterRunFn()
-			if len(fns) == 0 {
-				break
-			}
-			for _, fn := range fns {
-				fn(a.context())
-			}
+	// With a TaskQueueSize the task may be queued when the taskLoop exits
+	select {
+	case <-done:
+		return nil
+	case <-a.taskLoopDone:
+		select {
+		case <-done:
+			return nil
+		default:
+			return a.getErr()
 		}
 	}
-	defer func() {
-		a.deleteAllCandidates()
-		a.startedFn()
+}
 
-		if err := a.buffer.Close(); err != nil {
-			a.log.Warnf("failed to close buffer: %v", err)
+// runAfterRunFns runs the functions registered by afterRun.
+func (a *Agent) runAfterRunFns() {
+	for {
+		fns := a.getAfterRunFn()
+		if len(fns) == 0 {
+			break
 		}
+		for _, fn := range fns {
+			fn(a.context())
+		}
+	}
+}
 
-		a.closeMulticastConn()
-		a.updateConnectionState(ConnectionStateClosed)
-
-		after()
-
-		close(a.chanState)
-		close(a.chanCandidate)
-		close(a.chanCandidatePair)
-		close(a.taskLoopDone)
-	}()
+// taskLoop handles registered tasks and agent close.
+func (a *Agent) taskLoop() {
+	defer a.closeTasks()
 
 	for {
 		select {
@@ -225,15 +440,52 @@ func (a *Agent) taskLoop() {
 			return
 		case t := <-a.chanTask:
 			t.fn(a.context(), a)
-			close(t.done)
-			after()
+			if t.done != nil {
+				close(t.done)
+			}
+			a.runAfterRunFns()
 		}
 	}
 }
 
+// closeTasks releases the candidates and the buffer once the agent is
+// closed, then closes taskLoopDone.
+func (a *Agent) closeTasks() {
+	a.closeErrs = a.deleteAllCandidates()
+	a.resetHostDisclosure()
+	a.startedFn()
+
+	if err := a.buffer.Close(); err != nil {
+		a.log.Warnf("failed to close buffer: %v", err)
+		a.closeErrs = append(a.closeErrs, err)
+	}
+
+	a.closeMulticastConn()
+	if a.checkPacer != nil {
+		a.checkPacer.remove(a)
+	}
+	a.updateConnectionState(ConnectionStateClosed, ConnectionStateChangeReasonClosed)
+
+	a.runAfterRunFns()
+
+	a.stopConnectivityChecks()
+	close(a.taskLoopDone)
+}
+
 // NewAgent creates a new Agent
-func NewAgent(config *AgentConfig) (*Agent, error) { //nolint:gocognit
+func NewAgent(config *AgentConfig) (*Agent, error) {
+	return newAgent(config, nil)
+}
+
+// newAgent creates a new Agent. If sharedMDNSConn is not nil, it is used
+// instead of an mDNS conn of its own in MulticastDNSModeQueryOnly, see
+// AgentFactory.
+func newAgent(config *AgentConfig, sharedMDNSConn *mdns.Conn) (*Agent, error) { //nolint:gocognit
 	var err error
+	cfg := *config
+	cfg.applyProfile()
+	config = &cfg
+
 	if config.PortMax < config.PortMin {
 		return nil, ErrPort
 	}
@@ -258,17 +510,30 @@ func NewAgent(config *AgentConfig) (*Agent, error) { //nolint:gocognit
 	if loggerFactory == nil {
 		loggerFactory = logging.NewDefaultLoggerFactory()
 	}
+
+	redactor, err := newAddressRedactor(config.AddressRedaction, config.AddressRedactionKey)
+	if err != nil {
+		return nil, err
+	}
+	if redactor.Mode != AddressRedactionNone {
+		loggerFactory = &redactingLoggerFactory{loggerFactory, redactor}
+	}
 	log := loggerFactory.NewLogger("ice")
 
 	var mDNSConn *mdns.Conn
-	mDNSConn, mDNSMode, err = createMulticastDNS(mDNSMode, mDNSName, log)
-	// Opportunistic mDNS: If we can't open the connection, that's ok: we
-	// can continue without it.
-	if err != nil {
-		log.Warnf("Failed to initialize mDNS %s: %v", mDNSName, err)
+	mDNSConnShared := sharedMDNSConn != nil && mDNSMode == MulticastDNSModeQueryOnly
+	if mDNSConnShared {
+		mDNSConn = sharedMDNSConn
+	} else {
+		mDNSConn, mDNSMode, err = createMulticastDNS(mDNSMode, mDNSName, log)
+		// Opportunistic mDNS: If we can't open the connection, that's ok: we
+		// can continue without it.
+		if err != nil {
+			log.Warnf("Failed to initialize mDNS %s: %v", mDNSName, err)
+		}
 	}
 	closeMDNSConn := func() {
-		if mDNSConn != nil {
+		if mDNSConn != nil && !mDNSConnShared {
 			if mdnsCloseErr := mDNSConn.Close(); mdnsCloseErr != nil {
 				log.Warnf("Failed to close mDNS: %v", mdnsCloseErr)
 			}
@@ -278,48 +543,89 @@ func NewAgent(config *AgentConfig) (*Agent, error) { //nolint:gocognit
 	startedCtx, startedFn := context.WithCancel(context.Background())
 
 	a := &Agent{
-		chanTask:          make(chan task),
-		chanState:         make(chan ConnectionState),
-		chanCandidate:     make(chan Candidate),
-		chanCandidatePair: make(chan *CandidatePair),
-		tieBreaker:        globalMathRandomGenerator.Uint64(),
-		lite:              config.Lite,
-		gatheringState:    GatheringStateNew,
-		connectionState:   ConnectionStateNew,
-		localCandidates:   make(map[NetworkType][]Candidate),
-		remoteCandidates:  make(map[NetworkType][]Candidate),
-		urls:              config.Urls,
-		networkTypes:      config.NetworkTypes,
-		onConnected:       make(chan struct{}),
-		buffer:            packetio.NewBuffer(),
-		done:              make(chan struct{}),
-		taskLoopDone:      make(chan struct{}),
-		startedCh:         startedCtx.Done(),
-		startedFn:         startedFn,
-		portmin:           config.PortMin,
-		portmax:           config.PortMax,
-		loggerFactory:     loggerFactory,
-		log:               log,
-		net:               config.Net,
-		proxyDialer:       config.ProxyDialer,
-
-		mDNSMode: mDNSMode,
-		mDNSName: mDNSName,
-		mDNSConn: mDNSConn,
+		chanTask:         make(chan task, taskQueueSize(config.TaskQueueSize)),
+		droppedTasks:     new(uint64),
+		lite:             config.Lite,
+		gatheringState:   GatheringStateNew,
+		connectionState:  ConnectionStateNew,
+		localCandidates:  make(map[NetworkType][]Candidate),
+		remoteCandidates: make(map[NetworkType][]Candidate),
+		urls:             config.Urls,
+		networkTypes:     config.NetworkTypes,
+		onConnected:      make(chan struct{}),
+		stateChanged:     make(chan struct{}),
+		done:             make(chan struct{}),
+		taskLoopDone:     make(chan struct{}),
+		startedCh:        startedCtx.Done(),
+		startedFn:        startedFn,
+		portmin:          config.PortMin,
+		portmax:          config.PortMax,
+		loggerFactory:    loggerFactory,
+		log:              log,
+		structuredLogger: config.StructuredLogger,
+		redactor:         redactor,
+		net:              config.Net,
+		proxyDialer:      config.ProxyDialer,
+		proxyDialerFunc:  config.ProxyDialerFunc,
+
+		mDNSMode:       mDNSMode,
+		mDNSName:       mDNSName,
+		mDNSConn:       mDNSConn,
+		mDNSConnShared: mDNSConnShared,
 
 		gatherCandidateCancel: func() {},
 
-		forceCandidateContact: make(chan bool, 1),
+		outboundSTUN: stun.New(),
+
+		interfaceFilter:     config.InterfaceFilter,
+		hostCandidateName:   config.HostCandidateName,
+		portMapper:          config.PortMapper,
+		candidateConnAccess: config.CandidateConnAccess,
+		streamClassifier:    config.StreamClassifier,
+		skipVirtualAdapters: config.SkipVirtualAdapters,
+		avoidExpensive:      config.AvoidExpensiveAdapters,
+
+		disablePrflx: config.DisablePeerReflexiveCandidates,
+		maxPrflx:     config.MaxPeerReflexiveCandidates,
+
+		maxChecksPerRemoteIP: config.MaxChecksPerRemoteIP,
+		checkPacer:           config.CheckPacer,
 
-		interfaceFilter: config.InterfaceFilter,
+		strictResponseRouting:      config.StrictResponseRouting,
+		relayAcrossAddressFamilies: config.RelayAcrossAddressFamilies,
+
+		sockets: &socketBudget{max: config.MaxSockets},
+
+		acceptAggressiveNomination: config.AcceptAggressiveNomination,
+		nominationPolicy:           config.NominationPolicy,
+
+		allowedRemoteNetworks: config.AllowedRemoteNetworks,
+		deniedRemoteNetworks:  config.DeniedRemoteNetworks,
+		remoteCandidateFilter: config.RemoteCandidateFilter,
 
 		insecureSkipVerify: config.InsecureSkipVerify,
 	}
 
+	if config.PacketCapture != nil {
+		a.packetCapture = newPacketCapture(config.PacketCapture, log)
+	}
+
+	a.tracer = config.Tracer
+	if a.tracer == nil {
+		a.tracer = noopTracer{}
+	}
+	a.icmpErrorDetection = config.ICMPErrorDetection
+	a.udpSegmentationOffload = config.UDPSegmentationOffload
+
 	a.tcpMux = config.TCPMux
 	if a.tcpMux == nil {
 		a.tcpMux = newInvalidTCPMux()
 	}
+	a.tcpOptions = config.TCPOptions
+	if config.ActiveTCP != nil {
+		a.activeTCP = config.ActiveTCP.withDefaults()
+		a.activeTCPDials = make(chan struct{}, a.activeTCP.MaxConcurrentDials)
+	}
 	a.udpMux = config.UDPMux
 	a.udpMuxSrflx = config.UDPMuxSrflx
 
@@ -331,13 +637,22 @@ func NewAgent(config *AgentConfig) (*Agent, error) { //nolint:gocognit
 			a.log.Warn("vnet does not support mDNS yet")
 		}
 	}
+	if config.Transport != nil {
+		a.transport = config.Transport
+		if a.mDNSMode != MulticastDNSModeDisabled {
+			a.log.Warn("mDNS runs over the network of the system, not over the packet transport")
+		}
+	} else {
+		// The filter is read on every call, UpdateConfig may replace it
+		a.transport = &netTransport{net: a.net, interfaceFilter: func(name string) bool {
+			filter := a.getInterfaceFilter()
+			return filter == nil || filter(name)
+		}}
+	}
 
 	config.initWithDefaults(a)
-
-	// Make sure the buffer doesn't grow indefinitely.
-	// NOTE: We actually won't get anywhere close to this limit.
-	// SRTP will constantly read from the endpoint and drop packets if it's full.
-	a.buffer.SetLimitSize(maxBufferSize)
+	a.recordGatheringState(a.gatheringState)
+	a.recordConnectionState(a.connectionState, ConnectionStateChangeReasonUnknown)
 
 	if a.lite && (len(a.candidateTypes) != 1 || a.candidateTypes[0] != CandidateTypeHost) {
 		closeMDNSConn()
@@ -354,8 +669,39 @@ func NewAgent(config *AgentConfig) (*Agent, error) { //nolint:gocognit
 		return nil, err
 	}
 
-	go a.taskLoop()
-	a.startOnConnectionStateChangeRoutine()
+	if err = config.initCredentials(a); err != nil {
+		closeMDNSConn()
+		return nil, err
+	}
+
+	if err = config.initSPKIPins(a); err != nil {
+		closeMDNSConn()
+		return nil, err
+	}
+
+	if err = config.initTypePreferences(a); err != nil {
+		closeMDNSConn()
+		return nil, err
+	}
+
+	if err = config.initICEOptions(a); err != nil {
+		closeMDNSConn()
+		return nil, err
+	}
+
+	if err = config.initHandlerQueues(a); err != nil {
+		closeMDNSConn()
+		return nil, err
+	}
+
+	if err = config.initTaskQueue(a); err != nil {
+		closeMDNSConn()
+		return nil, err
+	}
+
+	if !a.synchronous {
+		go a.taskLoop()
+	}
 
 	// Restart is also used to initialize the agent for the first time
 	if err := a.Restart(config.LocalUfrag, config.LocalPwd); err != nil {
@@ -373,6 +719,14 @@ func (a *Agent) OnConnectionStateChange(f func(ConnectionState)) error {
 	return nil
 }
 
+// OnConnectionStateChangeWithReason sets a handler that is fired when the connection state
+// changes, along with the reason for the change. It is fired in addition to the handler set
+// with OnConnectionStateChange.
+func (a *Agent) OnConnectionStateChangeWithReason(f func(ConnectionState, ConnectionStateChangeReason)) error {
+	a.onConnectionStateChangeReasonHdlr.Store(f)
+	return nil
+}
+
 // OnSelectedCandidatePairChange sets a handler that is fired when the final candidate
 // pair is selected
 func (a *Agent) OnSelectedCandidatePairChange(f func(Candidate, Candidate)) error {
@@ -399,50 +753,16 @@ func (a *Agent) onCandidate(c Candidate) {
 	}
 }
 
-func (a *Agent) onConnectionStateChange(s ConnectionState) {
+func (a *Agent) onConnectionStateChange(s connectionStateChange) {
 	if hdlr, ok := a.onConnectionStateChangeHdlr.Load().(func(ConnectionState)); ok {
-		hdlr(s)
+		hdlr(s.state)
+	}
+	if hdlr, ok := a.onConnectionStateChangeReasonHdlr.Load().(func(ConnectionState, ConnectionStateChangeReason)); ok {
+		hdlr(s.state, s.reason)
 	}
 }
 
-func (a *Agent) startOnConnectionStateChangeRoutine() {
-	go func() {
-		for {
-			// CandidatePair and ConnectionState are usually changed at once.
-			// Blocking one by the other one causes deadlock.
-			p, isOpen := <-a.chanCandidatePair
-			if !isOpen {
-				return
-			}
-			a.onSelectedCandidatePairChange(p)
-		}
-	}()
-	go func() {
-		for {
-			select {
-			case s, isOpen := <-a.chanState:
-				if !isOpen {
-					for c := range a.chanCandidate {
-						a.onCandidate(c)
-					}
-					return
-				}
-				go a.onConnectionStateChange(s)
-
-			case c, isOpen := <-a.chanCandidate:
-				if !isOpen {
-					for s := range a.chanState {
-						go a.onConnectionStateChange(s)
-					}
-					return
-				}
-				a.onCandidate(c)
-			}
-		}
-	}()
-}
-
-func (a *Agent) startConnectivityChecks(isControlling bool, remoteUfrag, remotePwd string) error {
+func (a *Agent) startConnectivityChecks(ctx context.Context, isControlling bool, remoteUfrag, remotePwd string) error {
 	a.muHaveStarted.Lock()
 	defer a.muHaveStarted.Unlock()
 	select {
@@ -450,13 +770,15 @@ func (a *Agent) startConnectivityChecks(isControlling bool, remoteUfrag, remoteP
 		return ErrMultipleStart
 	default:
 	}
-	if err := a.SetRemoteCredentials(remoteUfrag, remotePwd); err != nil { //nolint:contextcheck
+	if err := a.checkRemoteCredentials(remoteUfrag, remotePwd); err != nil {
 		return err
 	}
 
 	a.log.Debugf("Started agent: isControlling? %t, remoteUfrag: %q, remotePwd: %q", isControlling, remoteUfrag, remotePwd)
 
+	tracingParent := ctx
 	return a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		agent.tracingParent = tracingParent
 		agent.isControlling = isControlling
 		agent.remoteUfrag = remoteUfrag
 		agent.remotePwd = remotePwd
@@ -471,98 +793,49 @@ func (a *Agent) startConnectivityChecks(isControlling bool, remoteUfrag, remoteP
 			a.selector = &liteSelector{pairCandidateSelector: a.selector}
 		}
 
+		// Candidates queued before the credentials are paired now that the role is known
+		agent.addPendingRemoteCandidates()
+		agent.startHostDisclosureTimer()
+
 		a.selector.Start()
 		a.startedFn()
 
-		agent.updateConnectionState(ConnectionStateChecking)
+		agent.updateConnectionState(ConnectionStateChecking, ConnectionStateChangeReasonChecksStarted)
 
-		a.requestConnectivityCheck()
-		go a.connectivityChecks() //nolint:contextcheck
+		a.startConnectivityChecksTimer()
 	})
 }
 
-func (a *Agent) connectivityChecks() {
-	lastConnectionState := ConnectionState(0)
-	checkingDuration := time.Time{}
-
-	contact := func() {
-		if err := a.run(a.context(), func(ctx context.Context, a *Agent) {
-			defer func() {
-				lastConnectionState = a.connectionState
-			}()
-
-			switch a.connectionState {
-			case ConnectionStateFailed:
-				// The connection is currently failed so don't send any checks
-				// In the future it may be restarted though
-				return
-			case ConnectionStateChecking:
-				// We have just entered checking for the first time so update our checking timer
-				if lastConnectionState != a.connectionState {
-					checkingDuration = time.Now()
-				}
-
-				// We have been in checking longer then Disconnect+Failed timeout, set the connection to Failed
-				if time.Since(checkingDuration) > a.disconnectedTimeout+a.failedTimeout {
-					a.updateConnectionState(ConnectionStateFailed)
-					return
-				}
-			}
-
-			a.selector.ContactCandidates()
-		}); err != nil {
-			a.log.Warnf("taskLoop failed: %v", err)
-		}
-	}
-
-	for {
-		interval := defaultKeepaliveInterval
-
-		updateInterval := func(x time.Duration) {
-			if x != 0 && (interval == 0 || interval > x) {
-				interval = x
-			}
-		}
-
-		switch lastConnectionState {
-		case ConnectionStateNew, ConnectionStateChecking: // While connecting, check candidates more frequently
-			updateInterval(a.checkInterval)
-		case ConnectionStateConnected, ConnectionStateDisconnected:
-			updateInterval(a.keepaliveInterval)
-		default:
-		}
-		// Ensure we run our task loop as quickly as the minimum of our various configured timeouts
-		updateInterval(a.disconnectedTimeout)
-		updateInterval(a.failedTimeout)
-
-		t := time.NewTimer(interval)
-		select {
-		case <-a.forceCandidateContact:
-			t.Stop()
-			contact()
-		case <-t.C:
-			contact()
-		case <-a.done:
-			t.Stop()
-			return
-		}
-	}
-}
-
-func (a *Agent) updateConnectionState(newState ConnectionState) {
+func (a *Agent) updateConnectionState(newState ConnectionState, reason ConnectionStateChangeReason) {
 	if a.connectionState != newState {
 		// Connection has gone to failed, release all gathered candidates
 		if newState == ConnectionStateFailed {
+			report := a.buildFailureReport()
+			a.failureReport.Store(report)
+			a.logEvent(logging.LogLevelWarn, "connection failed", "report", report.String())
 			a.deleteAllCandidates()
 		}
 
-		a.log.Infof("Setting new connection state: %s", newState)
+		a.log.Infof("Setting new connection state: %s (%s)", newState, reason)
+		a.logEvent(logging.LogLevelInfo, "connection state changed", "state", newState.String(), "reason", reason.String())
 		a.connectionState = newState
+		a.recordConnectionState(newState, reason)
+		a.traceConnectionState(newState, reason)
+		a.notifyStateChanged()
 
 		// Call handler after finishing current task since we may be holding the agent lock
 		// and the handler may also require it
 		a.afterRun(func(ctx context.Context) {
-			a.chanState <- newState
+			change := connectionStateChange{newState, reason}
+			handler := func() {
+				a.onConnectionStateChange(change)
+			}
+			// The terminal states are never dropped
+			if newState == ConnectionStateFailed || newState == ConnectionStateClosed {
+				a.stateHandlers.pushKept(handler)
+			} else {
+				a.stateHandlers.push(handler)
+			}
 		})
 	}
 }
@@ -571,24 +844,27 @@ func (a *Agent) setSelectedPair(p *CandidatePair) {
 	if p == nil {
 		var nilPair *CandidatePair
 		a.selectedPair.Store(nilPair)
+		a.updateSelectedPairInfo(nil)
+		a.startPathMTUDiscovery(nil)
 		a.log.Tracef("Unset selected candidate pair")
 		return
 	}
 
 	p.nominated = true
 	a.selectedPair.Store(p)
+	a.endNominationSpan("")
 	a.log.Tracef("Set selected candidate pair: %s", p)
+	a.logEvent(logging.LogLevelInfo, "selected candidate pair changed", "pair", p.String(), "local", p.Local.String(), "remote", p.Remote.String())
 
-	a.updateConnectionState(ConnectionStateConnected)
+	a.updateConnectionState(ConnectionStateConnected, ConnectionStateChangeReasonPairSelected)
 
 	// Notify when the selected pair changes
 	if p != nil {
-		a.afterRun(func(ctx context.Context) {
-			select {
-			case a.chanCandidatePair <- p:
-			case <-ctx.Done():
-			}
+		a.pairHandlers.push(func() {
+			a.onSelectedCandidatePairChange(p)
 		})
+		a.updateSelectedPairInfo(p)
+		a.startPathMTUDiscovery(p)
 	}
 
 	// Signal connected
@@ -602,6 +878,8 @@ func (a *Agent) pingAllCandidates() {
 		a.log.Warn("pingAllCandidates called with no candidate pairs. Connection is not possible yet.")
 	}
 
+	checksInFlight := a.checksInFlight()
+	var pairs []*CandidatePair
 	for _, p := range a.checklist {
 		if p.state == CandidatePairStateWaiting {
 			p.state = CandidatePairStateInProgress
@@ -612,10 +890,29 @@ func (a *Agent) pingAllCandidates() {
 		if p.bindingRequestCount > a.maxBindingRequests {
 			a.log.Tracef("max requests reached for pair %s, marking it as failed", p)
 			p.state = CandidatePairStateFailed
+		} else if a.deferCheck(p, checksInFlight) {
+			a.log.Tracef("too many checks in progress towards %s, deferring pair %s", p.Remote.Address(), p)
 		} else {
-			a.selector.PingCandidate(p.Local, p.Remote)
-			p.bindingRequestCount++
+			pairs = append(pairs, p)
+		}
+	}
+
+	paced := a.paceChecks(len(pairs))
+	if paced < len(pairs) {
+		// The pairs checked the least go first, so the checks of the pairs
+		// are interleaved instead of the first pairs taking every turn
+		sort.SliceStable(pairs, func(i, j int) bool {
+			return pairs[i].bindingRequestCount < pairs[j].bindingRequestCount
+		})
+	}
+	for i, p := range pairs {
+		if i >= paced {
+			a.log.Tracef("check pacer exhausted, deferring pair %s", p)
+			p.deferredChecks++
+			continue
 		}
+		a.selector.PingPair(p)
+		p.bindingRequestCount++
 	}
 }
 
@@ -674,7 +971,7 @@ func (a *Agent) validateSelectedPair() bool {
 		return false
 	}
 
-	disconnectedTime := time.Since(selectedPair.Remote.LastReceived())
+	disconnectedTime := a.clock.Now().Sub(selectedPair.Remote.LastReceived())
 
 	// Only allow transitions to failed if a.failedTimeout is non-zero
 	totalTimeToFailure := a.failedTimeout
@@ -684,18 +981,24 @@ func (a *Agent) validateSelectedPair() bool {
 
 	switch {
 	case totalTimeToFailure != 0 && disconnectedTime > totalTimeToFailure:
-		a.updateConnectionState(ConnectionStateFailed)
+		a.updateConnectionState(ConnectionStateFailed, ConnectionStateChangeReasonKeepaliveTimeout)
+	case totalTimeToFailure != 0 && !selectedPair.consentRequested.IsZero() &&
+		a.clock.Now().Sub(selectedPair.consentRequested) > totalTimeToFailure:
+		a.updateConnectionState(ConnectionStateFailed, ConnectionStateChangeReasonConsentExpired)
 	case a.disconnectedTimeout != 0 && disconnectedTime > a.disconnectedTimeout:
-		a.updateConnectionState(ConnectionStateDisconnected)
+		a.updateConnectionState(ConnectionStateDisconnected, ConnectionStateChangeReasonKeepaliveTimeout)
 	default:
-		a.updateConnectionState(ConnectionStateConnected)
+		a.updateConnectionState(ConnectionStateConnected, ConnectionStateChangeReasonTrafficResumed)
 	}
 
 	return true
 }
 
 // checkKeepalive sends STUN Binding Indications to the selected pair
-// if no packet has been sent on that pair in the last keepaliveInterval
+// if no packet has been sent or received on that pair in the last
+// keepaliveIdleTimeout, at most every keepaliveInterval, along with or in
+// place of the payload of the application, and to the other pairs of the
+// keepalive scope
 // Note: the caller should hold the agent lock.
 func (a *Agent) checkKeepalive() {
 	selectedPair := a.getSelectedPair()
@@ -703,55 +1006,115 @@ func (a *Agent) checkKeepalive() {
 		return
 	}
 
-	if (a.keepaliveInterval != 0) &&
-		((time.Since(selectedPair.Local.LastSent()) > a.keepaliveInterval) ||
-			(time.Since(selectedPair.Remote.LastReceived()) > a.keepaliveInterval)) {
-		// we use binding request instead of indication to support refresh consent schemas
-		// see https://tools.ietf.org/html/rfc7675
-		a.selector.PingCandidate(selectedPair.Local, selectedPair.Remote)
+	now := a.clock.Now()
+	idle := (now.Sub(selectedPair.Local.LastSent()) > a.keepaliveIdleTimeout) ||
+		(now.Sub(selectedPair.Remote.LastReceived()) > a.keepaliveIdleTimeout)
+	if !idle {
+		// Consent is not checked while data flows both ways
+		selectedPair.consentRequested = time.Time{}
+	}
+	if (a.keepaliveInterval != 0) && idle &&
+		now.Sub(selectedPair.lastKeepalive) >= a.keepaliveInterval {
+		selectedPair.lastKeepalive = now
+		a.sendKeepalivePayload(selectedPair)
+		if a.keepalivePayload == nil || !a.keepalivePayloadOnly {
+			// we use binding request instead of indication to support refresh consent schemas
+			// see https://tools.ietf.org/html/rfc7675
+			a.selector.PingPair(selectedPair)
+			if selectedPair.consentRequested.IsZero() {
+				selectedPair.consentRequested = now
+			}
+		}
 	}
+
+	a.checkStandbyKeepalive()
 }
 
-// AddRemoteCandidate adds a new remote candidate
+// AddRemoteCandidate adds a new remote candidate. Candidates added before
+// the remote credentials are set, by SetRemoteCredentials, Dial or Accept,
+// are queued and paired once they are.
 func (a *Agent) AddRemoteCandidate(c Candidate) error {
-	if c == nil {
+	return a.AddRemoteCandidates([]Candidate{c})
+}
+
+// AddRemoteCandidates adds many remote candidates at once, e.g. from a peer
+// that does not trickle. The candidates that do not need to be resolved are
+// added together, in a single task of the agent.
+func (a *Agent) AddRemoteCandidates(candidates []Candidate) error {
+	ready := make([]Candidate, 0, len(candidates))
+	var resolve []func()
+	for _, c := range candidates {
+		add, resolveCandidate, err := a.prepareRemoteCandidate(c)
+		if err != nil {
+			return err
+		}
+		if add {
+			ready = append(ready, c)
+		} else if resolveCandidate != nil {
+			resolve = append(resolve, resolveCandidate)
+		}
+	}
+
+	for _, resolveCandidate := range resolve {
+		go resolveCandidate()
+	}
+	if len(ready) == 0 {
 		return nil
 	}
 
+	add := func() {
+		if err := a.run(a.context(), func(ctx context.Context, agent *Agent) {
+			agent.addSignaledRemoteCandidates(ready)
+		}); err != nil {
+			a.log.Warnf("Failed to add %d remote candidates: %v", len(ready), err)
+			return
+		}
+	}
+	if a.synchronous {
+		add()
+	} else {
+		go add()
+	}
+	return nil
+}
+
+// prepareRemoteCandidate returns whether c can be added as is. Candidates
+// with a hostname are added by resolve once resolved, if it is not nil.
+func (a *Agent) prepareRemoteCandidate(c Candidate) (add bool, resolve func(), err error) {
+	if c == nil {
+		return false, nil, nil
+	}
+
 	// cannot check for network yet because it might not be applied
 	// when mDNS hostame is used.
 	if c.TCPType() == TCPTypeActive {
 		// TCP Candidates with tcptype active will probe server passive ones, so
 		// no need to do anything with them.
 		a.log.Infof("Ignoring remote candidate with tcpType active: %s", c)
-		return nil
+		return false, nil, nil
 	}
 
 	// If we have a mDNS Candidate lets fully resolve it before adding it locally
 	if c.Type() == CandidateTypeHost && strings.HasSuffix(c.Address(), ".local") {
 		if a.mDNSMode == MulticastDNSModeDisabled {
 			a.log.Warnf("remote mDNS candidate added, but mDNS is disabled: (%s)", c.Address())
-			return nil
+			return false, nil, nil
 		}
 
 		hostCandidate, ok := c.(*CandidateHost)
 		if !ok {
-			return ErrAddressParseFailed
+			return false, nil, ErrAddressParseFailed
 		}
 
-		go a.resolveAndAddMulticastCandidate(hostCandidate)
-		return nil
+		return false, func() { a.resolveAndAddMulticastCandidate(hostCandidate) }, nil
 	}
 
-	go func() {
-		if err := a.run(a.context(), func(ctx context.Context, agent *Agent) {
-			agent.addRemoteCandidate(c)
-		}); err != nil {
-			a.log.Warnf("Failed to add remote candidate %s: %v", c.Address(), err)
-			return
-		}
-	}()
-	return nil
+	// A DNS name, the candidate is added once resolved
+	if hostCandidate, ok := c.(*CandidateHost); ok && c.addr() == nil {
+		return false, func() { a.resolveAndAddFQDNCandidate(hostCandidate) }, nil
+	}
+
+	return true, nil, nil
 }
 
 func (a *Agent) resolveAndAddMulticastCandidate(c *CandidateHost) {
@@ -776,82 +1139,363 @@ func (a *Agent) resolveAndAddMulticastCandidate(c *CandidateHost) {
 	}
 
 	if err = a.run(a.context(), func(ctx context.Context, agent *Agent) {
-		agent.addRemoteCandidate(c)
+		agent.addSignaledRemoteCandidates([]Candidate{c})
 	}); err != nil {
 		a.log.Warnf("Failed to add mDNS candidate %s: %v", c.Address(), err)
 		return
 	}
 }
 
-func (a *Agent) requestConnectivityCheck() {
-	select {
-	case a.forceCandidateContact <- true:
-	default:
+// addRemoteCandidate assumes you are holding the lock (must be execute using a.run),
+// it returns false if c was discarded or already known.
+func (a *Agent) addRemoteCandidate(c Candidate) bool {
+	if !a.insertRemoteCandidate(c) {
+		return false
 	}
+	a.requestConnectivityCheck()
+	return true
 }
 
-// addRemoteCandidate assumes you are holding the lock (must be execute using a.run)
-func (a *Agent) addRemoteCandidate(c Candidate) {
+// addSignaledRemoteCandidates adds candidates received over signaling. They
+// are queued until the remote credentials are known, signaling may deliver
+// them before the answer.
+// Note: the caller should hold the agent lock.
+func (a *Agent) addSignaledRemoteCandidates(candidates []Candidate) {
+	if a.remoteUfrag == "" {
+		a.pendingRemoteCandidates = append(a.pendingRemoteCandidates, candidates...)
+		return
+	}
+	a.addRemoteCandidates(candidates)
+}
+
+// addRemoteCandidates adds candidates and pairs them, checks are requested once for all.
+// Note: the caller should hold the agent lock.
+func (a *Agent) addRemoteCandidates(candidates []Candidate) {
+	added := false
+	for _, c := range candidates {
+		if a.insertRemoteCandidate(c) {
+			added = true
+		}
+	}
+	if added {
+		a.requestConnectivityCheck()
+	}
+}
+
+// addPendingRemoteCandidates adds the candidates queued by addSignaledRemoteCandidates.
+// Note: the caller should hold the agent lock.
+func (a *Agent) addPendingRemoteCandidates() {
+	pending := a.pendingRemoteCandidates
+	a.pendingRemoteCandidates = nil
+	if len(pending) != 0 {
+		a.log.Debugf("Adding %d remote candidates received before the remote credentials", len(pending))
+		a.addRemoteCandidates(pending)
+	}
+}
+
+// insertRemoteCandidate adds c and its pairs, it returns false if c was
+// discarded or already known.
+// Note: the caller should hold the agent lock.
+func (a *Agent) insertRemoteCandidate(c Candidate) bool {
+	if a.isStaleRemoteCandidate(c) {
+		a.log.Infof("Ignoring remote candidate from a previous generation: %s", c)
+		return false
+	}
+	if ip, _, _, ok := parseAddr(c.addr()); ok && !a.isAllowedRemoteIP(ip) {
+		a.logEvent(logging.LogLevelInfo, "remote candidate rejected", "candidate", c.String(), "reason", "address not allowed")
+		return false
+	}
+	if a.remoteCandidateFilter != nil && !a.remoteCandidateFilter(c) {
+		a.logEvent(logging.LogLevelInfo, "remote candidate rejected", "candidate", c.String(), "reason", "filtered")
+		return false
+	}
+
 	set := a.remoteCandidates[c.NetworkType()]
 
 	for _, candidate := range set {
 		if candidate.Equal(c) {
-			return
+			return false
 		}
 	}
 
-	set = append(set, c)
-	a.remoteCandidates[c.NetworkType()] = set
+	if i, prflx := a.findPeerReflexive(c); prflx != nil {
+		set[i] = c
+		a.promotePeerReflexive(prflx, c)
+	} else {
+		set = append(set, c)
+		a.remoteCandidates[c.NetworkType()] = set
+		a.logEvent(logging.LogLevelDebug, "remote candidate added", "candidate", c.String())
+	}
 
 	if localCandidates, ok := a.localCandidates[c.NetworkType()]; ok {
 		for _, localCandidate := range localCandidates {
+			// Active TCP candidates are connected to a single remote
+			if localCandidate.TCPType() == TCPTypeActive || a.findPair(localCandidate, c) != nil {
+				continue
+			}
 			a.addPair(localCandidate, c)
 		}
 	}
+	for _, localCandidate := range a.localCandidates[c.NetworkType().otherFamily()] {
+		if a.pairsAcrossFamilies(localCandidate) && a.findPair(localCandidate, c) == nil {
+			a.addPair(localCandidate, c)
+		}
+	}
+	a.addActiveTCPCandidates(c)
+	a.sendPendingTriggeredChecks(c)
 
-	a.requestConnectivityCheck()
+	return true
+}
+
+// canLearnPeerReflexive reports whether a peer reflexive candidate may be
+// created for a binding request from remote, according to
+// DisablePeerReflexiveCandidates and MaxPeerReflexiveCandidates.
+// Note: the caller should hold the agent lock.
+func (a *Agent) canLearnPeerReflexive(remote net.Addr) bool {
+	if a.disablePrflx {
+		a.log.Debugf("discard binding request from (%s), peer-reflexive candidates are disabled", remote)
+		return false
+	}
+	if a.maxPrflx <= 0 || a.prflxLearned < a.maxPrflx {
+		return true
+	}
+
+	a.log.Debugf("discard binding request from (%s), peer-reflexive candidate limit reached", remote)
+	// Logged once, spoofed requests would flood the logs
+	if !a.prflxLimitReached {
+		a.prflxLimitReached = true
+		a.log.Warnf("peer-reflexive candidate limit of %d reached, discarding binding requests from unknown addresses", a.maxPrflx)
+		a.logEvent(logging.LogLevelWarn, "peer-reflexive candidate limit reached", "limit", a.maxPrflx, "remote", remote.String())
+	}
+	return false
+}
+
+// isAllowedRemoteIP reports whether remote candidates may have the address
+// ip, according to AllowedRemoteNetworks and DeniedRemoteNetworks.
+func (a *Agent) isAllowedRemoteIP(ip net.IP) bool {
+	for _, n := range a.deniedRemoteNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	if len(a.allowedRemoteNetworks) == 0 {
+		return true
+	}
+	for _, n := range a.allowedRemoteNetworks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
 }
 
 func (a *Agent) addCandidate(ctx context.Context, c Candidate, candidateConn net.PacketConn) error {
 	return a.run(ctx, func(ctx context.Context, agent *Agent) {
-		set := a.localCandidates[c.NetworkType()]
-		for _, candidate := range set {
-			if candidate.Equal(c) {
-				a.log.Debugf("Ignore duplicate candidate: %s", c.String())
-				if err := c.close(); err != nil {
-					a.log.Warnf("Failed to close duplicate candidate: %v", err)
-				}
-				return
+		if agent.withholdCandidate(c, candidateConn) {
+			return
+		}
+		agent.insertLocalCandidate(c, candidateConn)
+	})
+}
+
+// insertLocalCandidate starts c, pairs it and passes it to OnCandidate.
+// Note: the caller should hold the agent lock.
+func (a *Agent) insertLocalCandidate(c Candidate, candidateConn net.PacketConn) {
+	set := a.localCandidates[c.NetworkType()]
+	for _, candidate := range set {
+		if candidate.Equal(c) {
+			a.log.Debugf("Ignore duplicate candidate: %s", c.String())
+			if err := c.close(); err != nil {
+				a.log.Warnf("Failed to close duplicate candidate: %v", err)
 			}
+			return
 		}
+	}
 
-		c.start(a, candidateConn, a.startedCh)
+	if a.maxLocalCandidates > 0 && a.localCandidateCount() >= a.maxLocalCandidates {
+		a.log.Warnf("Discarding candidate %s, MaxLocalCandidates (%d) reached", c, a.maxLocalCandidates)
+		if err := c.close(); err != nil {
+			a.log.Warnf("Failed to close discarded candidate: %v", err)
+		}
+		// The candidate was not started, its conn is not closed with it
+		// (a relay conn may already be closed along with its TURN client)
+		_ = candidateConn.Close()
+		return
+	}
 
-		set = append(set, c)
-		a.localCandidates[c.NetworkType()] = set
+	if err := c.AddExtension(CandidateExtension{extensionGeneration, strconv.FormatUint(uint64(a.generation), 10)}); err != nil {
+		a.log.Warnf("Failed to set candidate generation: %v", err)
+	}
+	c.computePreferences(c, a)
+	c.start(c, a, candidateConn, a.startedCh)
+	if !isMuxedCandidate(c) {
+		a.sockets.add(c)
+	}
 
-		if remoteCandidates, ok := a.remoteCandidates[c.NetworkType()]; ok {
-			for _, remoteCandidate := range remoteCandidates {
-				a.addPair(c, remoteCandidate)
-			}
+	set = append(set, c)
+	a.localCandidates[c.NetworkType()] = set
+	gathered := c.gatherInfo()
+	a.logEvent(logging.LogLevelDebug, "local candidate gathered", "candidate", c.String(),
+		"url", gathered.url, "duration", gathered.completed.Sub(gathered.started))
+
+	if remoteCandidates, ok := a.remoteCandidates[c.NetworkType()]; ok {
+		for _, remoteCandidate := range remoteCandidates {
+			a.addPair(c, remoteCandidate)
+		}
+	}
+	if a.pairsAcrossFamilies(c) {
+		for _, remoteCandidate := range a.remoteCandidates[c.NetworkType().otherFamily()] {
+			a.addPair(c, remoteCandidate)
 		}
+	}
 
-		a.requestConnectivityCheck()
+	a.requestConnectivityCheck()
 
-		a.chanCandidate <- c
+	a.candidateHandlers.push(func() {
+		a.onCandidate(c)
 	})
 }
 
+// RemoveLocalCandidate closes a local candidate and removes it along with its
+// candidate pairs, e.g. when the application knows the interface it was
+// gathered on is going away. If the selected pair used it, the agent goes
+// back to checking the remaining pairs.
+func (a *Agent) RemoveLocalCandidate(c Candidate) error {
+	var err error
+	if runErr := a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		err = agent.removeLocalCandidate(c)
+	}); runErr != nil {
+		return runErr
+	}
+	return err
+}
+
+// removeLocalCandidate assumes you are holding the lock (must be execute using a.run)
+func (a *Agent) removeLocalCandidate(c Candidate) error {
+	set := a.localCandidates[c.NetworkType()]
+	for i, candidate := range set {
+		if !candidate.Equal(c) {
+			continue
+		}
+
+		a.localCandidates[c.NetworkType()] = append(set[:i:i], set[i+1:]...)
+		if err := candidate.close(); err != nil {
+			a.log.Warnf("Failed to close candidate %s: %v", candidate, err)
+		}
+		a.removePairs(func(p *CandidatePair) bool { return p.Local == candidate })
+		a.logEvent(logging.LogLevelDebug, "local candidate removed", "candidate", candidate.String())
+		return nil
+	}
+	return ErrCandidateNotFound
+}
+
+// RemoveRemoteCandidate removes a remote candidate along with its candidate
+// pairs, e.g. when the remote agent signals it is no longer usable, so it is
+// no longer checked. If the selected pair used it, the agent goes back to
+// checking the remaining pairs.
+func (a *Agent) RemoveRemoteCandidate(c Candidate) error {
+	var err error
+	if runErr := a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		err = agent.removeRemoteCandidate(c)
+	}); runErr != nil {
+		return runErr
+	}
+	return err
+}
+
+// removeRemoteCandidate assumes you are holding the lock (must be execute using a.run)
+func (a *Agent) removeRemoteCandidate(c Candidate) error {
+	for i, candidate := range a.pendingRemoteCandidates {
+		if candidate.Equal(c) {
+			a.pendingRemoteCandidates = append(a.pendingRemoteCandidates[:i:i], a.pendingRemoteCandidates[i+1:]...)
+			return nil
+		}
+	}
+
+	set := a.remoteCandidates[c.NetworkType()]
+	for i, candidate := range set {
+		if !candidate.Equal(c) {
+			continue
+		}
+
+		// The active TCP candidates connected to it go with it
+		active := map[Candidate]bool{}
+		for _, p := range a.checklist {
+			if p.Remote == candidate && p.Local.TCPType() == TCPTypeActive {
+				active[p.Local] = true
+			}
+		}
+
+		a.remoteCandidates[c.NetworkType()] = append(set[:i:i], set[i+1:]...)
+		a.removePairs(func(p *CandidatePair) bool { return p.Remote == candidate })
+		a.removeActiveTCPCandidates(func(local Candidate) bool { return active[local] })
+		a.logEvent(logging.LogLevelDebug, "remote candidate removed", "candidate", candidate.String())
+		return nil
+	}
+	return ErrCandidateNotFound
+}
+
+// removePairs removes the pairs matching remove from the checklist. If the
+// selected or nominated pair is removed, the selection starts over.
+// Note: the caller should hold the agent lock.
+func (a *Agent) removePairs(remove func(p *CandidatePair) bool) {
+	selectedPair := a.getSelectedPair()
+	restartSelection := false
+
+	checklist := a.checklist[:0]
+	for _, p := range a.checklist {
+		if !remove(p) {
+			checklist = append(checklist, p)
+			continue
+		}
+		if p == selectedPair || p.nominated {
+			restartSelection = true
+		}
+	}
+	for i := len(checklist); i < len(a.checklist); i++ {
+		a.checklist[i] = nil
+	}
+	a.checklist = checklist
+
+	if !restartSelection {
+		return
+	}
+	if selectedPair != nil && remove(selectedPair) {
+		a.setSelectedPair(nil)
+		a.updateConnectionState(ConnectionStateChecking, ConnectionStateChangeReasonPairRemoved)
+	}
+	if a.selector != nil {
+		a.selector.Start()
+	}
+	a.requestConnectivityCheck()
+}
+
+// orderedCandidates returns the candidates of all network types, in the
+// order of the network types.
+func orderedCandidates(candidates map[NetworkType][]Candidate) []Candidate {
+	var res []Candidate
+	for _, networkType := range supportedNetworkTypes() {
+		res = append(res, candidates[networkType]...)
+	}
+	return res
+}
+
+// localCandidateCount returns the number of local candidates of all network types.
+// Note: the caller should hold the agent lock.
+func (a *Agent) localCandidateCount() int {
+	n := 0
+	for _, set := range a.localCandidates {
+		n += len(set)
+	}
+	return n
+}
+
 // GetLocalCandidates returns the local candidates
 func (a *Agent) GetLocalCandidates() ([]Candidate, error) {
 	var res []Candidate
 
 	err := a.run(a.context(), func(ctx context.Context, agent *Agent) {
-		var candidates []Candidate
-		for _, set := range agent.localCandidates {
-			candidates = append(candidates, set...)
-		}
-		res = candidates
+		res = orderedCandidates(agent.localCandidates)
 	})
 	if err != nil {
 		return nil, err
@@ -860,7 +1504,8 @@ func (a *Agent) GetLocalCandidates() ([]Candidate, error) {
 	return res, nil
 }
 
-// GetLocalUserCredentials returns the local user credentials
+// GetLocalUserCredentials returns the local user credentials, see
+// GetLocalCredentials for their generation
 func (a *Agent) GetLocalUserCredentials() (frag string, pwd string, err error) {
 	valSet := make(chan struct{})
 	err = a.run(a.context(), func(ctx context.Context, agent *Agent) {
@@ -901,7 +1546,26 @@ func (a *Agent) removeUfragFromMux() {
 }
 
 // Close cleans up the Agent
+//
+// Close returns once the agent is closed or after AgentConfig.CloseTimeout,
+// see CloseWithContext. Errors closing the candidates are returned as a
+// *CloseError, the agent is closed nonetheless.
 func (a *Agent) Close() error {
+	if a.closeTimeout == 0 {
+		return a.CloseWithContext(context.Background())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.closeTimeout)
+	defer cancel()
+	return a.CloseWithContext(ctx)
+}
+
+// CloseWithContext closes the agent like Close: TURN allocations are
+// released, sockets closed and internal goroutines stopped. It waits for
+// them until ctx is done, the agent then keeps closing in the background
+// and the error returned wraps ctx.Err(). Errors closing the candidates are
+// returned as a *CloseError.
+func (a *Agent) CloseWithContext(ctx context.Context) error {
 	if err := a.ok(); err != nil {
 		return err
 	}
@@ -917,31 +1581,84 @@ func (a *Agent) Close() error {
 	a.removeUfragFromMux()
 
 	close(a.done)
-	<-a.taskLoopDone
+	if a.synchronous {
+		a.closeSync()
+	}
+	select {
+	case <-a.taskLoopDone:
+	case <-ctx.Done():
+		return fmt.Errorf("agent close did not complete: %w", ctx.Err())
+	}
+
+	if len(a.closeErrs) != 0 {
+		return &CloseError{Errors: a.closeErrs}
+	}
 	return nil
 }
 
+// CloseError lists the errors that occurred while closing an agent. The
+// agent is closed nonetheless, the error matches ErrClosed.
+type CloseError struct {
+	Errors []error
+}
+
+func (e *CloseError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return "failed to close agent: " + strings.Join(msgs, "; ")
+}
+
+// Is reports whether target is ErrClosed or any of the errors matches it.
+func (e *CloseError) Is(target error) bool {
+	if target == ErrClosed {
+		return true
+	}
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
 // Remove all candidates. This closes any listening sockets
 // and removes both the local and remote candidate lists.
 //
-// This is used for restarts, failures and on close
-func (a *Agent) deleteAllCandidates() {
+// This is used for restarts, failures and on close, the errors closing the
+// candidates are logged and returned.
+func (a *Agent) deleteAllCandidates() []error {
+	var errs []error
 	for net, cs := range a.localCandidates {
 		for _, c := range cs {
 			if err := c.close(); err != nil {
 				a.log.Warnf("Failed to close candidate %s: %v", c, err)
+				errs = append(errs, err)
 			}
 		}
 		delete(a.localCandidates, net)
 	}
+	for _, w := range a.withheldCandidates {
+		closeWithheldCandidate(w, a.log)
+	}
+	a.withheldCandidates = nil
+	return append(errs, a.deleteRemoteCandidates()...)
+}
+
+func (a *Agent) deleteRemoteCandidates() []error {
+	var errs []error
 	for net, cs := range a.remoteCandidates {
 		for _, c := range cs {
 			if err := c.close(); err != nil {
 				a.log.Warnf("Failed to close candidate %s: %v", c, err)
+				errs = append(errs, err)
 			}
 		}
 		delete(a.remoteCandidates, net)
 	}
+	a.removeActiveTCPCandidates(func(Candidate) bool { return true })
+	return errs
 }
 
 func (a *Agent) findRemoteCandidate(networkType NetworkType, addr net.Addr) Candidate {
@@ -953,7 +1670,12 @@ func (a *Agent) findRemoteCandidate(networkType NetworkType, addr net.Addr) Cand
 
 	set := a.remoteCandidates[networkType]
 	for _, c := range set {
-		if c.Address() == ip.String() && c.Port() == port {
+		if c.Port() != port {
+			continue
+		}
+		// Compare the parsed addresses, formatting ip for every candidate
+		// would allocate on each inbound packet
+		if cIP, _, _, ok := parseAddr(c.addr()); ok && cIP.Equal(ip) {
 			return c
 		}
 	}
@@ -961,14 +1683,15 @@ func (a *Agent) findRemoteCandidate(networkType NetworkType, addr net.Addr) Cand
 }
 
 func (a *Agent) sendBindingRequest(m *stun.Message, local, remote Candidate) {
-	a.log.Tracef("ping STUN from %s to %s", local.String(), remote.String())
+	a.log.Tracef("ping STUN from %s to %s", local, remote)
 
-	a.invalidatePendingBindingRequests(time.Now())
+	a.invalidatePendingBindingRequests(a.clock.Now())
 	a.pendingBindingRequests = append(a.pendingBindingRequests, bindingRequest{
-		timestamp:      time.Now(),
+		timestamp:      a.clock.Now(),
 		transactionID:  m.TransactionID,
 		destination:    remote.addr(),
 		isUseCandidate: m.Contains(stun.AttrUseCandidate),
+		local:          local,
 	})
 
 	a.sendSTUN(m, local, remote)
@@ -983,14 +1706,7 @@ func (a *Agent) sendBindingSuccess(m *stun.Message, local, remote Candidate) {
 		return
 	}
 
-	if out, err := stun.Build(m, stun.BindingSuccess,
-		&stun.XORMappedAddress{
-			IP:   ip,
-			Port: port,
-		},
-		stun.NewShortTermIntegrity(a.localPwd),
-		stun.Fingerprint,
-	); err != nil {
+	if out, err := a.buildBindingSuccess(m, ip, port); err != nil {
 		a.log.Warnf("Failed to handle inbound ICE from: %s to: %s error: %s", local, remote, err)
 	} else {
 		a.sendSTUN(out, local, remote)
@@ -1017,20 +1733,14 @@ func (a *Agent) invalidatePendingBindingRequests(filterTime time.Time) {
 	if bindRequestsRemoved := initialSize - len(a.pendingBindingRequests); bindRequestsRemoved > 0 {
 		a.log.Tracef("Discarded %d binding requests because they expired", bindRequestsRemoved)
 	}
-}
 
-// Assert that the passed TransactionID is in our pendingBindingRequests and returns the destination
-// If the bindingRequest was valid remove it from our pending cache
-func (a *Agent) handleInboundBindingSuccess(id [stun.TransactionIDSize]byte) (bool, *bindingRequest) {
-	a.invalidatePendingBindingRequests(time.Now())
-	for i := range a.pendingBindingRequests {
-		if a.pendingBindingRequests[i].transactionID == id {
-			validBindingRequest := a.pendingBindingRequests[i]
-			a.pendingBindingRequests = append(a.pendingBindingRequests[:i], a.pendingBindingRequests[i+1:]...)
-			return true, &validBindingRequest
+	answered := a.answeredBindingRequests[:0]
+	for _, bindingRequest := range a.answeredBindingRequests {
+		if filterTime.Sub(bindingRequest.timestamp) < maxBindingRequestTimeout {
+			answered = append(answered, bindingRequest)
 		}
 	}
-	return false, nil
+	a.answeredBindingRequests = answered
 }
 
 // handleInbound processes STUN traffic from a remote candidate
@@ -1042,6 +1752,7 @@ func (a *Agent) handleInbound(m *stun.Message, local Candidate, remote net.Addr)
 
 	if m.Type.Method != stun.MethodBinding ||
 		!(m.Type.Class == stun.ClassSuccessResponse ||
+			m.Type.Class == stun.ClassErrorResponse ||
 			m.Type.Class == stun.ClassRequest ||
 			m.Type.Class == stun.ClassIndication) {
 		a.log.Tracef("unhandled STUN from %s to %s class(%s) method(%s)", remote, local, m.Type.Class, m.Type.Method)
@@ -1063,10 +1774,30 @@ func (a *Agent) handleInbound(m *stun.Message, local Candidate, remote net.Addr)
 		}
 	}
 
-	remoteCandidate := a.findRemoteCandidate(local.NetworkType(), remote)
-	if m.Type.Class == stun.ClassSuccessResponse {
-		if err = assertInboundMessageIntegrity(m, []byte(a.remotePwd)); err != nil {
-			a.log.Warnf("discard message from (%s), %v", remote, err)
+	remoteCandidate := a.findRemoteCandidate(a.remoteNetworkType(local, remote), remote)
+	if m.Type.Class == stun.ClassErrorResponse {
+		// Error responses may come unsigned, e.g. a 400 or 401 of a peer
+		// that could not check our request, a MESSAGE-INTEGRITY must be valid
+		if m.Contains(stun.AttrMessageIntegrity) {
+			if err = assertInboundMessageIntegrity(m, a.stunCredentials().remoteIntegrity); err != nil {
+				a.reportAuthenticationFailure(AuthenticationFailureMessageIntegrity, m, local, remote, err)
+				return
+			}
+		}
+
+		if remoteCandidate == nil {
+			a.log.Warnf("discard error response from (%s), no such remote", remote)
+			return
+		}
+
+		if a.handlePathMTUProbeResponse(m) {
+			return
+		}
+		a.handlePingResponse(m)
+		a.handleInboundBindingError(m, local, remoteCandidate)
+	} else if m.Type.Class == stun.ClassSuccessResponse {
+		if err = assertInboundMessageIntegrity(m, a.stunCredentials().remoteIntegrity); err != nil {
+			a.reportAuthenticationFailure(AuthenticationFailureMessageIntegrity, m, local, remote, err)
 			return
 		}
 
@@ -1075,13 +1806,19 @@ func (a *Agent) handleInbound(m *stun.Message, local Candidate, remote net.Addr)
 			return
 		}
 
+		if a.handlePathMTUProbeResponse(m) {
+			remoteCandidate.seen(false, a.clock.Now())
+			return
+		}
+
+		a.handlePingResponse(m)
 		a.selector.HandleSuccessResponse(m, local, remoteCandidate, remote)
 	} else if m.Type.Class == stun.ClassRequest {
-		if err = assertInboundUsername(m, a.localUfrag+":"+a.remoteUfrag); err != nil {
-			a.log.Warnf("discard message from (%s), %v", remote, err)
+		if err = assertInboundUsername(m, a.stunCredentials().inboundUsername); err != nil {
+			a.reportAuthenticationFailure(AuthenticationFailureUsername, m, local, remote, err)
 			return
-		} else if err = assertInboundMessageIntegrity(m, []byte(a.localPwd)); err != nil {
-			a.log.Warnf("discard message from (%s), %v", remote, err)
+		} else if err = assertInboundMessageIntegrity(m, a.stunCredentials().localIntegrity); err != nil {
+			a.reportAuthenticationFailure(AuthenticationFailureMessageIntegrity, m, local, remote, err)
 			return
 		}
 
@@ -1091,6 +1828,14 @@ func (a *Agent) handleInbound(m *stun.Message, local Candidate, remote net.Addr)
 				a.log.Errorf("Failed to create parse remote net.Addr when creating remote prflx candidate")
 				return
 			}
+			if !a.isAllowedRemoteIP(ip) {
+				a.logEvent(logging.LogLevelInfo, "peer-reflexive candidate rejected", "remote", remote.String(), "reason", "address not allowed")
+				return
+			}
+			if !a.canLearnPeerReflexive(remote) {
+				a.queueTriggeredCheck(m, local, remote)
+				return
+			}
 
 			prflxCandidateConfig := CandidatePeerReflexiveConfig{
 				Network:   networkType.String(),
@@ -1109,27 +1854,38 @@ func (a *Agent) handleInbound(m *stun.Message, local Candidate, remote net.Addr)
 			remoteCandidate = prflxCandidate
 
 			a.log.Debugf("adding a new peer-reflexive candidate: %s ", remote)
-			a.addRemoteCandidate(remoteCandidate)
+			if !a.addRemoteCandidate(remoteCandidate) {
+				return
+			}
+			a.prflxLearned++
 		}
 
-		a.log.Tracef("inbound STUN (Request) from %s to %s", remote.String(), local.String())
+		a.log.Tracef("inbound STUN (Request) from %s to %s", remote, local)
 
+		a.inboundRequest = &inboundRequest{socket: socketAddr(local), source: remote}
 		a.selector.HandleBindingRequest(m, local, remoteCandidate)
+		a.inboundRequest = nil
 	}
 
 	if remoteCandidate != nil {
-		remoteCandidate.seen(false)
+		remoteCandidate.seen(false, a.clock.Now())
 	}
 }
 
-// validateNonSTUNTraffic processes non STUN traffic from a remote candidate,
-// and returns true if it is an actual remote candidate
+// validateNonSTUNTraffic checks that a data packet received on local comes
+// from a known remote candidate. Packets on the selected pair, which is where
+// almost all data arrives, are accepted without going through the taskLoop.
 func (a *Agent) validateNonSTUNTraffic(local Candidate, remote net.Addr) bool {
+	if p := a.getSelectedPair(); p != nil && p.Local == local && addrEqual(p.Remote.addr(), remote) {
+		p.Remote.seen(false, a.clock.Now())
+		return true
+	}
+
 	var isValidCandidate uint64
 	if err := a.run(local.context(), func(ctx context.Context, agent *Agent) {
-		remoteCandidate := a.findRemoteCandidate(local.NetworkType(), remote)
+		remoteCandidate := a.findRemoteCandidate(a.remoteNetworkType(local, remote), remote)
 		if remoteCandidate != nil {
-			remoteCandidate.seen(false)
+			remoteCandidate.seen(false, a.clock.Now())
 			atomic.AddUint64(&isValidCandidate, 1)
 		}
 	}); err != nil {
@@ -1168,57 +1924,58 @@ func (a *Agent) getSelectedPair() *CandidatePair {
 }
 
 func (a *Agent) closeMulticastConn() {
-	if a.mDNSConn != nil {
+	if a.mDNSConn != nil && !a.mDNSConnShared {
 		if err := a.mDNSConn.Close(); err != nil {
 			a.log.Warnf("failed to close mDNS Conn: %v", err)
 		}
 	}
 }
 
-// SetRemoteCredentials sets the credentials of the remote agent
+// SetRemoteCredentials sets the credentials of the remote agent. Credentials
+// differing from those already set are an ICE restart of the remote agent:
+// the remote candidates and the pairs are dropped, and the connection state
+// goes back to checking with ConnectionStateChangeReasonRemoteRestart. The
+// new remote candidates should be added afterwards.
 func (a *Agent) SetRemoteCredentials(remoteUfrag, remotePwd string) error {
-	switch {
-	case remoteUfrag == "":
-		return ErrRemoteUfragEmpty
-	case remotePwd == "":
-		return ErrRemotePwdEmpty
+	if err := a.checkRemoteCredentials(remoteUfrag, remotePwd); err != nil {
+		return err
 	}
 
 	return a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		if agent.isRemoteRestart(remoteUfrag, remotePwd) {
+			agent.restartRemote(remoteUfrag, remotePwd)
+			return
+		}
 		agent.remoteUfrag = remoteUfrag
 		agent.remotePwd = remotePwd
+		agent.addPendingRemoteCandidates()
 	})
 }
 
+func (a *Agent) checkRemoteCredentials(remoteUfrag, remotePwd string) error {
+	switch {
+	case remoteUfrag == "":
+		return ErrRemoteUfragEmpty
+	case remotePwd == "":
+		return ErrRemotePwdEmpty
+	}
+	return a.credentials.validateRemoteCredentials(remoteUfrag, remotePwd)
+}
+
 // Restart restarts the ICE Agent with the provided ufrag/pwd
 // If no ufrag/pwd is provided the Agent will generate one itself
 //
 // Restart must only be called when GatheringState is GatheringStateComplete
 // a user must then call GatherCandidates explicitly to start generating new ones
+//
+// Restart starts a new ICE generation: remote candidates tagged with the
+// generation of the remote agent before its own restart are discarded
 func (a *Agent) Restart(ufrag, pwd string) error {
-	if ufrag == "" {
-		var err error
-		ufrag, err = generateUFrag()
-		if err != nil {
-			return err
-		}
-	}
-	if pwd == "" {
-		var err error
-		pwd, err = generatePwd()
-		if err != nil {
-			return err
-		}
-	}
-
-	if len([]rune(ufrag))*8 < 24 {
-		return ErrLocalUfragInsufficientBits
-	}
-	if len([]rune(pwd))*8 < 128 {
-		return ErrLocalPwdInsufficientBits
+	ufrag, pwd, err := a.restartCredentials(ufrag, pwd)
+	if err != nil {
+		return err
 	}
 
-	var err error
 	if runErr := a.run(a.context(), func(ctx context.Context, agent *Agent) {
 		if agent.gatheringState == GatheringStateGathering {
 			err = ErrRestartWhenGathering
@@ -1227,38 +1984,134 @@ func (a *Agent) Restart(ufrag, pwd string) error {
 
 		// Clear all agent needed to take back to fresh state
 		a.removeUfragFromMux()
-		agent.localUfrag = ufrag
-		agent.localPwd = pwd
+		agent.setLocalCredentials(ufrag, pwd)
 		agent.remoteUfrag = ""
 		agent.remotePwd = ""
-		a.gatheringState = GatheringStateNew
-		a.checklist = make([]*CandidatePair, 0)
-		a.pendingBindingRequests = make([]bindingRequest, 0)
-		a.setSelectedPair(nil)
+		agent.pendingRemoteCandidates = nil
+		agent.resetHostDisclosure()
+		agent.remoteICEOptions = nil
+		a.updateGatheringState(GatheringStateNew)
 		a.deleteAllCandidates()
-		if a.selector != nil {
-			a.selector.Start()
-		}
+		a.clearGatheringErrors()
+		a.natObservations.clear()
 
 		// Restart is used by NewAgent. Accept/Connect should be used to move to checking
 		// for new Agents
-		if a.connectionState != ConnectionStateNew {
-			a.updateConnectionState(ConnectionStateChecking)
+		a.resetChecks(ConnectionStateChangeReasonRestart)
+	}); runErr != nil {
+		return runErr
+	}
+	return err
+}
+
+// WarmRestart restarts the ICE Agent like Restart, but keeps the local
+// candidates with their sockets and TURN allocations: only the credentials
+// are rotated, the remote candidates dropped and the checks run again once
+// the new remote credentials are set. Ports stay the same, so firewall
+// pinholes opened for them remain valid.
+//
+// The local candidates are tagged with the new generation, they should be
+// signaled again from GetLocalCandidates. Candidates multiplexed by a UDPMux
+// or TCPMux are routed by ufrag and can not be kept, WarmRestart returns
+// ErrWarmRestartMuxedCandidate for agents having some: the ports of a mux
+// are shared and kept across Restart anyway.
+func (a *Agent) WarmRestart(ufrag, pwd string) error {
+	ufrag, pwd, err := a.restartCredentials(ufrag, pwd)
+	if err != nil {
+		return err
+	}
+
+	if runErr := a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		if agent.gatheringState == GatheringStateGathering {
+			err = ErrRestartWhenGathering
+			return
 		}
+		for _, cs := range agent.localCandidates {
+			for _, c := range cs {
+				if isMuxedCandidate(c) {
+					err = fmt.Errorf("%w: %s", ErrWarmRestartMuxedCandidate, c)
+					return
+				}
+			}
+		}
+
+		agent.setLocalCredentials(ufrag, pwd)
+		agent.remoteUfrag = ""
+		agent.remotePwd = ""
+		agent.pendingRemoteCandidates = nil
+		agent.resetHostDisclosure()
+		agent.remoteICEOptions = nil
+		agent.deleteRemoteCandidates()
+
+		generation := CandidateExtension{extensionGeneration, strconv.FormatUint(uint64(agent.generation), 10)}
+		for _, cs := range agent.localCandidates {
+			for _, c := range cs {
+				if extErr := c.AddExtension(generation); extErr != nil {
+					agent.log.Warnf("Failed to tag candidate %s with generation: %v", c, extErr)
+				}
+			}
+		}
+
+		agent.resetChecks(ConnectionStateChangeReasonRestart)
 	}); runErr != nil {
 		return runErr
 	}
 	return err
 }
 
+// resetChecks drops the pairs, the transactions in flight and the selected
+// pair and starts the checks over. The connection moves back to checking
+// unless the checks never started.
+// Note: the caller should hold the agent lock.
+func (a *Agent) resetChecks(reason ConnectionStateChangeReason) {
+	a.pendingTriggeredChecks = nil
+	a.prflxLearned = 0
+	a.prflxLimitReached = false
+	a.checklist = make([]*CandidatePair, 0)
+	a.pendingBindingRequests = make([]bindingRequest, 0)
+	a.answeredBindingRequests = nil
+	a.setSelectedPair(nil)
+	a.failureReport.Store((*FailureReport)(nil))
+
+	if a.selector != nil {
+		a.selector.Start()
+	}
+	if a.connectionState != ConnectionStateNew {
+		a.updateConnectionState(ConnectionStateChecking, reason)
+	}
+}
+
+// restartCredentials returns the credentials to restart with, generating
+// the missing ones.
+func (a *Agent) restartCredentials(ufrag, pwd string) (string, string, error) {
+	if ufrag == "" || pwd == "" {
+		generatedUfrag, generatedPwd, err := a.credentials.generateCredentials()
+		if err != nil {
+			return "", "", err
+		}
+		if ufrag == "" {
+			ufrag = generatedUfrag
+		}
+		if pwd == "" {
+			pwd = generatedPwd
+		}
+	}
+
+	if len([]rune(ufrag))*8 < 24 {
+		return "", "", ErrLocalUfragInsufficientBits
+	}
+	if len([]rune(pwd))*8 < 128 {
+		return "", "", ErrLocalPwdInsufficientBits
+	}
+	return ufrag, pwd, nil
+}
+
 func (a *Agent) setGatheringState(newState GatheringState) error {
 	done := make(chan struct{})
 	if err := a.run(a.context(), func(ctx context.Context, agent *Agent) {
-		if a.gatheringState != newState && newState == GatheringStateComplete {
-			a.chanCandidate <- nil
+		if newState != GatheringStateComplete || !agent.deferGatheringComplete() {
+			agent.updateGatheringState(newState)
 		}
-
-		a.gatheringState = newState
 		close(done)
 	}); err != nil {
 		return err
@@ -1267,3 +2120,23 @@ func (a *Agent) setGatheringState(newState GatheringState) error {
 	<-done
 	return nil
 }
+
+// updateGatheringState sets the gathering state, passing nil to OnCandidate
+// once gathering is complete.
+// Note: the caller should hold the agent lock.
+func (a *Agent) updateGatheringState(newState GatheringState) {
+	if a.gatheringState != newState && newState == GatheringStateComplete {
+		gatheringErr := a.GetGatheringError()
+		a.candidateHandlers.pushKept(func() {
+			a.onCandidate(nil)
+			a.onGatheringComplete(gatheringErr)
+		})
+	}
+
+	if a.gatheringState != newState {
+		a.logEvent(logging.LogLevelInfo, "gathering state changed", "state", newState.String())
+		a.recordGatheringState(newState)
+		a.notifyStateChanged()
+	}
+	a.gatheringState = newState
+}
@@ -1,6 +1,9 @@
 package ice
 
 import (
+	"io"
+	"net"
+	"sort"
 	"time"
 
 	"github.com/pion/logging"
@@ -21,6 +24,12 @@ const (
 	// defaultFailedTimeout is the default time till an Agent transitions to failed after disconnected
 	defaultFailedTimeout = 25 * time.Second
 
+	// defaultCloseTimeout is the default time Close waits for the agent to be closed
+	defaultCloseTimeout = 10 * time.Second
+
+	// defaultHostDisclosureTimeout is the default time host candidates are withheld, see HostDisclosure
+	defaultHostDisclosureTimeout = 5 * time.Second
+
 	// wait time before nominating a host candidate
 	defaultHostAcceptanceMinWait = 0
 
@@ -63,6 +72,23 @@ type AgentConfig struct {
 	LocalUfrag string
 	LocalPwd   string
 
+	// UfragLength, PwdLength and CredentialCharset control the local
+	// credentials generated when none are provided. Lengths must be within
+	// the limits of RFC 8839 (4 to 256 for the ufrag, 22 to 256 for the
+	// password) and the charset a subset of ALPHA, DIGIT, "+" and "/".
+	// Defaults to 16, 32 and ALPHA.
+	UfragLength       int
+	PwdLength         int
+	CredentialCharset string
+
+	// CredentialGenerator, if set, provides the local credentials when the
+	// agent is created or restarted without explicit ones.
+	CredentialGenerator CredentialGenerator
+
+	// StrictCredentialValidation rejects remote credentials that are not
+	// valid ice-ufrag and ice-pwd values (RFC 8839), instead of only empty ones.
+	StrictCredentialValidation bool
+
 	// MulticastDNSMode controls mDNS behavior for the ICE agent
 	MulticastDNSMode MulticastDNSMode
 
@@ -77,16 +103,86 @@ type AgentConfig struct {
 	// If the duration is 0, we will never go to failed.
 	FailedTimeout *time.Duration
 
+	// CloseTimeout bounds how long Close waits for TURN allocations to be
+	// released and internal goroutines to stop, e.g. when a TURN server is
+	// unresponsive. Defaults to 10 seconds when this property is nil.
+	// If the duration is 0, Close waits until the agent is closed.
+	CloseTimeout *time.Duration
+
 	// KeepaliveInterval determines how often should we send ICE
 	// keepalives (should be less then connectiontimeout above)
 	// when this is nil, it defaults to 10 seconds.
 	// A keepalive interval of 0 means we never send keepalive packets
 	KeepaliveInterval *time.Duration
 
+	// KeepaliveIdleTimeout is how long the selected pair can go without
+	// traffic sent or received before the agent keeps it alive, every
+	// KeepaliveInterval until traffic resumes. Application data counts as
+	// traffic, so no STUN keepalive is sent while data flows both ways. It
+	// defaults to KeepaliveInterval. Whether the pair is disconnected or
+	// failed is decided independently, by DisconnectedTimeout and
+	// FailedTimeout since anything, data included, was last received.
+	KeepaliveIdleTimeout *time.Duration
+
+	// KeepaliveScope is the set of pairs kept alive once a pair is selected,
+	// KeepaliveScopeSelectedPair by default.
+	KeepaliveScope KeepaliveScope
+
+	// StandbyKeepaliveInterval determines how often the pairs of the
+	// KeepaliveScope other than the selected pair are kept alive. It defaults
+	// to KeepaliveInterval when nil, 0 never keeps them alive.
+	StandbyKeepaliveInterval *time.Duration
+
+	// KeepalivePayload returns a payload of the application, e.g. a
+	// heartbeat of its own protocol, sent on the selected pair each time the
+	// agent keeps it alive. The peer reads it from its Conn as data, nil
+	// sends nothing. It is called by the agent, it must not block nor call
+	// the agent.
+	KeepalivePayload func(pair *CandidatePair) []byte
+
+	// KeepalivePayloadOnly sends the payload of KeepalivePayload in place
+	// of the STUN binding requests that keep the selected pair alive. The
+	// pair stays connected as long as any traffic, heartbeats included, is
+	// received from the peer, but the keepalives no longer refresh the
+	// consent of the peer (RFC 7675).
+	KeepalivePayloadOnly bool
+
+	// StreamClassifier returns the ID of the stream, see Agent.AddStream,
+	// that a data packet received by the agent belongs to, e.g. from the MID
+	// or SSRC of an RTP packet, or "" if it belongs to none. It only accounts
+	// for the packet in the stats of the stream, the packet is read from the
+	// Conn as usual. It is called for every packet, it must not block nor
+	// call the agent.
+	StreamClassifier func(p []byte) string
+
 	// CheckInterval controls how often our task loop runs when in the
 	// connecting state.
 	CheckInterval *time.Duration
 
+	// Clock is the source of time for the timeouts, intervals and timestamps
+	// of the agent, see Clock. Defaults to the system clock.
+	Clock Clock
+
+	// DeterministicOrdering makes the agent reproducible for tests and
+	// debugging: local addresses are gathered one after the other in a
+	// sorted order, candidates are listed by network type, and the candidate
+	// IDs and the tie-breaker are drawn from a generator seeded with
+	// DeterministicSeed.
+	DeterministicOrdering bool
+
+	// DeterministicSeed seeds the generator used with DeterministicOrdering.
+	DeterministicSeed int64
+
+	// Synchronous runs the tasks of the agent on the goroutine calling it
+	// instead of an internal task loop, see synchronous.go. Combined with a
+	// ManualClock, checks and state transitions can be stepped through in
+	// unit tests.
+	Synchronous bool
+
+	// STUNFaults injects failures in the STUN traffic of the agent, for chaos
+	// experiments, see Agent.SetSTUNFaults. None are injected if nil.
+	STUNFaults *STUNFaults
+
 	// NetworkTypes is an optional configuration for disabling or enabling
 	// support for specific network types.
 	NetworkTypes []NetworkType
@@ -95,8 +191,191 @@ type AgentConfig struct {
 	// support for specific candidate types.
 	CandidateTypes []CandidateType
 
+	// TypePreferences overrides the type preference of local candidates of
+	// the listed types in their priority, e.g. to rank server reflexive
+	// candidates above host candidates whose addresses are known to be
+	// unroutable. The values range from 0 to 126, the defaults are those of
+	// RFC 8445: host 126, prflx 110, srflx 100 and relay 0.
+	TypePreferences map[CandidateType]uint16
+
+	// FoundationFunc computes the foundation of local candidates, e.g. to
+	// match the foundations of another stack. Defaults to DefaultFoundation.
+	// Candidates given a foundation explicitly keep it. It is called once
+	// per candidate, as it is added to the agent.
+	FoundationFunc func(c Candidate) string
+
+	// LocalPreferenceFunc computes the local preference part of the priority
+	// of local candidates, e.g. to prefer some interfaces. Defaults to
+	// DefaultLocalPreference. Candidates of the same type must be given
+	// distinct preferences. It is called once per candidate, as it is added
+	// to the agent.
+	LocalPreferenceFunc func(c Candidate) uint16
+
 	LoggerFactory logging.LoggerFactory
 
+	// StructuredLogger, when set, additionally receives the agent's lifecycle events
+	// (state changes, gathered and added candidates, selected pair, discarded
+	// messages) as key/value pairs. See NewSlogLogger for a log/slog adapter.
+	StructuredLogger StructuredLogger
+
+	// AddressRedaction hides the IP addresses in the logs, StructuredLogger
+	// events and MarshalStatsJSON output of the agent. The stats and
+	// candidates returned by the API are not redacted.
+	AddressRedaction AddressRedaction
+
+	// AddressRedactionKey is the key of AddressRedactionHash, addresses
+	// redacted with the same key can be correlated across agents. Defaults to
+	// a random key per agent.
+	AddressRedactionKey []byte
+
+	// PacketCapture, when set, receives a pcapng stream of all traffic sent and
+	// received on the agent's candidate sockets, including STUN to the configured
+	// servers, TURN control traffic and payloads after TURN decapsulation. Packets
+	// are recorded with synthetic IP/UDP headers built from the socket addresses.
+	PacketCapture io.Writer
+
+	// Tracer, when set, is used to create spans for gathering (one per
+	// STUN/TURN URL), connectivity checks and nomination. The checks span is
+	// a child of the span in the context passed to Dial or Accept. The
+	// iceotel module provides a Tracer creating OpenTelemetry spans.
+	Tracer Tracer
+
+	// ICMPErrorDetection enables reading ICMP unreachable errors on candidate
+	// sockets (IP_RECVERR, Linux only). A pair whose remote is reported
+	// unreachable is failed immediately instead of after its checks time out.
+	ICMPErrorDetection bool
+
+	// UDPSegmentationOffload enables UDP GSO for bursts of equally sized packets
+	// and GRO on receive, on UDP candidate sockets of kernels that support them
+	// (Linux only). Each socket then uses 64KB receive buffers.
+	UDPSegmentationOffload bool
+
+	// RTTHistogramBuckets are the upper bounds of the buckets of the binding
+	// request round trip time histograms kept per candidate pair and per agent.
+	// Defaults to 5ms, 10ms, 25ms, 50ms, 100ms, 250ms, 500ms and 1s.
+	RTTHistogramBuckets []time.Duration
+
+	// ReceiveBufferSize is the number of bytes of data received on the
+	// candidates that are buffered until read from the Conn. Defaults to 1MB.
+	ReceiveBufferSize int
+
+	// ReceiveBufferOverflow decides what happens to data received while the
+	// receive buffer is full. Defaults to BufferOverflowDropNewest.
+	ReceiveBufferOverflow BufferOverflowPolicy
+
+	// MaxPacketSize is the size of the largest packet received on the sockets
+	// of the candidates, e.g. for jumbo frames. A larger packet is dropped
+	// and counted in BufferStats.TooLarge, see Agent.GetReceiveBufferStats.
+	// Defaults to 8192 bytes. A UDPMux or TCPMux reads packets of up to 8192
+	// bytes regardless.
+	MaxPacketSize int
+
+	// ReportPacketTooLarge makes Conn.Read return ErrPacketTooLarge in place
+	// of each packet dropped for being larger than MaxPacketSize, for
+	// applications that handle the error. Readers expecting only I/O errors
+	// from Read would otherwise stop on it.
+	ReportPacketTooLarge bool
+
+	// PathMTUDiscovery probes the path MTU of the selected pair with binding
+	// requests padded to increasing sizes, up to MaxPathMTU. The peer must
+	// accept the PADDING attribute of RFC 5780. See Agent.GetPathMTU. The
+	// probes must not be fragmented: while probing, the socket of the pair
+	// sends every packet with DF set, the data of the application too, for
+	// every pair of the local candidate, and packets larger than the path
+	// MTU are dropped. The socket is set back once the discovery ends or the
+	// selected pair changes. Only supported on Linux, on sockets of the
+	// agent, not of a UDPMux or TURN allocation; the path MTU stays at 1200
+	// bytes elsewhere.
+	PathMTUDiscovery bool
+
+	// MaxPathMTU is the largest packet probed by PathMTUDiscovery. Defaults
+	// to 1472 bytes, the UDP payload of an Ethernet frame over IPv4.
+	MaxPathMTU int
+
+	// TaskQueueSize is the number of operations (inbound STUN messages,
+	// connectivity checks and API calls) that can be queued for the agent's
+	// serialized task loop. Inbound STUN messages are queued without waiting
+	// for them to be handled, so the sockets are read on while the loop is
+	// busy. The other operations return a result, their callers wait for it
+	// whatever the size. Defaults to 0, the readers of the sockets wait for
+	// the task loop to pick their messages up. See Agent.GetTaskQueueStats.
+	TaskQueueSize int
+
+	// TaskQueueOverflow decides what happens to inbound STUN messages while
+	// the task queue is full: BufferOverflowBlock waits for room, stalling
+	// the socket they were read from, BufferOverflowDropNewest discards
+	// them. Defaults to BufferOverflowBlock. BufferOverflowDropOldest is not
+	// supported, the operations queued may have callers waiting for them.
+	TaskQueueOverflow BufferOverflowPolicy
+
+	// HandlerQueueSize bounds the calls of each handler (OnCandidate,
+	// OnConnectionStateChange, OnSelectedCandidatePairChange and the like)
+	// waiting for the previous call to return. The calls of a handler are
+	// made in order, one at a time, on a goroutine of their own: a slow
+	// handler never blocks the agent, its calls queue up instead. The nil
+	// OnCandidate call ending the gathering and the Failed and Closed
+	// connection states are never dropped, they exceed the bound if needed.
+	// Defaults to 0, unbounded. See Agent.GetHandlerQueueStats.
+	HandlerQueueSize int
+
+	// HandlerQueueOverflow decides which calls are dropped when a handler
+	// queue is full, BufferOverflowDropNewest or BufferOverflowDropOldest.
+	// Defaults to BufferOverflowDropOldest, keeping the latest state.
+	// BufferOverflowBlock is not supported: a handler calling the agent
+	// would deadlock it.
+	HandlerQueueOverflow BufferOverflowPolicy
+
+	// MaxLocalCandidates bounds the number of local candidates, each owns a
+	// socket (unless it comes from a UDPMux or TCPMux) and a goroutine reading
+	// it. Candidates gathered past the limit are discarded. Defaults to 0,
+	// unlimited.
+	MaxLocalCandidates int
+
+	// MaxSockets bounds the sockets the local candidates own at once, not
+	// counting those shared through a UDPMux or TCPMux. The candidate types
+	// are then gathered one after the other, host candidates first, so the
+	// budget goes to the most preferred ones, but a socket is kept for each
+	// type gathered next, so host candidates on many interfaces do not leave
+	// none for the relay candidates. The candidates past the limit are
+	// skipped, and a single CandidateGatheringError matching
+	// ErrSocketBudgetExhausted is recorded, see GetGatheringError. Sockets
+	// are only shared between candidates through a UDPMux, a TCPMux or
+	// UDPMuxSrflx, which do not count against the budget.
+	// Regardless of MaxSockets, a gathering stops opening sockets once the
+	// system runs out of ports or file descriptors, recording an error
+	// matching ErrSocketsExhausted. Defaults to 0, unlimited.
+	MaxSockets int
+
+	// MaxGatheringConcurrency bounds the STUN and TURN servers queried at
+	// once while gathering, with their goroutines and sockets, for agents
+	// configured with many servers on constrained devices. The queries past
+	// the limit wait for a running one to complete. It is ignored with
+	// DeterministicOrdering or Synchronous, which query the servers one
+	// after the other. Defaults to 0, unlimited.
+	MaxGatheringConcurrency int
+
+	// ProbeNATMapping sends, while gathering with several STUN or TURN
+	// URLs, one more binding request to two of the servers from a same
+	// socket, so GetNATStats can tell the mapping behavior of the NAT. It
+	// costs a socket and a round trip per network type. Defaults to false,
+	// the mapping is then unknown.
+	ProbeNATMapping bool
+
+	// DisableBatchIO reads and writes candidate sockets one packet at a time,
+	// batched reads preallocate a few dozen KB of buffers per socket.
+	DisableBatchIO bool
+
+	// IOBackend selects how the UDP sockets of the candidates are read and
+	// written, see IOBackendIOUring. It is ignored if DisableBatchIO is set.
+	IOBackend IOBackend
+
+	// Resolver resolves remote host candidates whose address is a DNS name
+	// (other than mDNS). Defaults to net.DefaultResolver.
+	Resolver *net.Resolver
+
+	// Profile selects the defaults of the fields left unset, see AgentProfileLowMemory.
+	Profile AgentProfile
+
 	// MaxBindingRequests is the max amount of binding requests the agent will send
 	// over a candidate pair for validation or nomination, if after MaxBindingRequests
 	// the candidate is yet to answer a binding request or a nomination we set the pair as failed
@@ -119,32 +398,121 @@ type AgentConfig struct {
 	// candidate gathering.
 	NAT1To1IPs []string
 
-	// HostAcceptanceMinWait specify a minimum wait time before selecting host candidates
-	HostAcceptanceMinWait *time.Duration
-	// HostAcceptanceMinWait specify a minimum wait time before selecting srflx candidates
+	// PortMapper returns the externally reachable address of the socket of
+	// a host candidate bound to local, or nil if it has none. network is
+	// "udp" or "tcp". The host candidate advertises it in place of local,
+	// its IP address and port, or of the NAT1To1IPs mapping. Unlike
+	// NAT1To1IPs it can express per-port translations, e.g. the NodePort or
+	// hostPort of a Kubernetes pod, for sockets bound within PortMin and
+	// PortMax. It is ignored when host candidates are gathered with mDNS.
+	PortMapper func(network string, local net.Addr) net.Addr
+
+	// CandidateConnAccess allows Agent.CandidateConn to hand out the sockets
+	// of the local candidates, see its caveats.
+	CandidateConnAccess bool
+
+	// HostAcceptanceMinWait, SrflxAcceptanceMinWait, PrflxAcceptanceMinWait
+	// and RelayAcceptanceMinWait are the minimum times after connectivity
+	// checks start before the controlling agent nominates a pair whose
+	// local or remote candidate is of that type. Until then the checks go
+	// on, giving a pair of a more preferred type the chance to succeed
+	// first. Shorter waits connect sooner, e.g. for control channels where
+	// any path will do, longer ones favor direct paths, e.g. for media
+	// that should avoid relays. They default to 0 for host candidates,
+	// 500 milliseconds for srflx, 1 second for prflx and 2 seconds for
+	// relay candidates. The controlled agent accepts the nominations of its
+	// peer regardless.
+	HostAcceptanceMinWait  *time.Duration
 	SrflxAcceptanceMinWait *time.Duration
-	// HostAcceptanceMinWait specify a minimum wait time before selecting prflx candidates
 	PrflxAcceptanceMinWait *time.Duration
-	// HostAcceptanceMinWait specify a minimum wait time before selecting relay candidates
 	RelayAcceptanceMinWait *time.Duration
 
 	// Net is the our abstracted network interface for internal development purpose only
 	// (see github.com/pion/transport/vnet)
 	Net *vnet.Net
 
+	// Transport, when set, is the datagram network the agent runs over in
+	// place of Net, see PacketTransport.
+	Transport PacketTransport
+
 	// InterfaceFilter is a function that you can use in order to  whitelist or blacklist
 	// the interfaces which are used to gather ICE candidates.
 	InterfaceFilter func(string) bool
 
+	// HostCandidateName returns the DNS name put in place of ip in the host
+	// candidates gathered on it, or "" to keep the address. The name must
+	// resolve to ip, or to its 1:1 NAT mapping, for the peer: e.g. the stable
+	// name of a Kubernetes pod exposed by a headless service. It is ignored
+	// when host candidates are gathered with mDNS, names ending in .local
+	// are reserved to it.
+	HostCandidateName func(ip net.IP) string
+
+	// SkipVirtualAdapters skips the adapters of virtual switches and
+	// virtual machine hosts when gathering host candidates, see
+	// AdapterTypeVirtual. Whether or not they are skipped, the host
+	// candidates of an adapter whose type is known carry its network cost
+	// in their network-cost extension, lowering their local preference:
+	// Ethernet first, then Wi-Fi, cellular and virtual adapters. The type
+	// of adapters is only known on Windows and Apple platforms.
+	SkipVirtualAdapters bool
+
+	// AvoidExpensiveAdapters skips the cellular adapters when gathering
+	// host candidates, unless no other adapter has an address, so the
+	// connection does not use a metered network while another is
+	// available. Only the cellular adapters are told apart, see
+	// AdapterType: the networks the system considers expensive or
+	// constrained otherwise, such as a Wi-Fi personal hotspot or with Low
+	// Data Mode on Apple platforms, are not avoided. The server reflexive
+	// and relay candidates are gathered from the default route of the
+	// system regardless.
+	AvoidExpensiveAdapters bool
+
+	// AllowedRemoteNetworks restricts the addresses of remote candidates,
+	// signaled or learned as peer reflexive, to the given networks. Candidates
+	// outside of them are discarded and never probed. All addresses are
+	// allowed if empty.
+	AllowedRemoteNetworks []*net.IPNet
+
+	// DeniedRemoteNetworks discards remote candidates in the given networks,
+	// e.g. private ranges on a public server. It takes precedence over
+	// AllowedRemoteNetworks.
+	DeniedRemoteNetworks []*net.IPNet
+
+	// RemoteCandidateFilter is consulted before a remote candidate, signaled
+	// or learned as peer reflexive, is paired. Candidates for which it
+	// returns false are discarded and never probed, e.g. relay candidates
+	// that are not from our TURN servers or TCP candidates. Candidates with
+	// a hostname are filtered once resolved. It is called by the agent, it
+	// must not block nor call the agent.
+	RemoteCandidateFilter func(Candidate) bool
+
 	// InsecureSkipVerify controls if self-signed certificates are accepted when connecting
 	// to TURN servers via TLS or DTLS
 	InsecureSkipVerify bool
 
-	// TCPMux will be used for multiplexing incoming TCP connections for ICE TCP.
-	// Currently only passive candidates are supported. This functionality is
-	// experimental and the API might change in the future.
+	// TURNServerSPKIPins pins the public keys of TURN servers reached via TLS
+	// or DTLS: the leaf certificate, or a certificate of its verified chain,
+	// must have a SubjectPublicKeyInfo with a listed hash, see SPKIPin. List
+	// several pins to rotate keys. The pins are checked in addition to the
+	// usual verification, with InsecureSkipVerify they replace trust in the
+	// root certificates and only the leaf can be pinned.
+	TURNServerSPKIPins []string
+
+	// TCPMux will be used for multiplexing incoming TCP connections for ICE TCP,
+	// for passive candidates. Active candidates are enabled by ActiveTCP. This
+	// functionality is experimental and the API might change in the future.
 	TCPMux TCPMux
 
+	// TCPOptions are the socket options of the ICE-TCP connections of the
+	// agent, e.g. TCP_NODELAY for interactive media. Connections are left
+	// with the system defaults if nil. The TCPMux must be a TCPMuxDefault.
+	TCPOptions *TCPOptions
+
+	// ActiveTCP enables active ICE-TCP candidates, connecting to the passive
+	// TCP candidates of the peer, and configures the connection attempts.
+	// Active candidates are not used if nil.
+	ActiveTCP *ActiveTCPConfig
+
 	// UDPMux is used for multiplexing multiple incoming UDP connections on a single port
 	// when this is set, the agent ignores PortMin and PortMax configurations and will
 	// defer to UDPMux for incoming connections
@@ -160,8 +528,91 @@ type AgentConfig struct {
 	// dial interface in order to support corporate proxies
 	ProxyDialer proxy.Dialer
 
-	// Accept aggressive nomination in RFC 5245 for compatible with chrome and other browsers
+	// ProxyDialerFunc returns the dialer of the TURN servers of url over TCP,
+	// or nil to connect to them directly, e.g. to reach an external TURN
+	// server through a corporate proxy and an internal one directly. It
+	// takes precedence over ProxyDialer.
+	ProxyDialerFunc func(url URL) proxy.Dialer
+
+	// Accept aggressive nomination in RFC 5245 for compatible with chrome and other browsers.
+	// Once the remote ICE options are set, the controlled agent only switches
+	// to a pair nominated after the selected one with this option, unless
+	// renomination is negotiated.
 	AcceptAggressiveNomination bool
+
+	// NominationPolicy lets a controlled agent refuse a nomination, e.g. of a
+	// relay pair while a host pair is still being checked. It is called once
+	// a nomination is accepted by the rules of RFC 8445, a refused one is
+	// answered with a 400 (Bad Request) error response. The controlling
+	// agent takes it as a failure of the check: libwebrtc fails the pair
+	// and does not nominate it again, this package records the error and
+	// keeps checking the pair. Refusing a nomination may therefore lose the
+	// pair for good, and refusing every nomination prevents the agent from
+	// connecting. It is called by the agent, it must not block nor call
+	// the agent.
+	NominationPolicy func(NominationRequest) bool
+
+	// ICEOptions are the ICE options the agent advertises, to be signaled in
+	// the ice-options attribute. Nil advertises ICEOptionTrickle. Renomination
+	// is accepted when both agents advertise ICEOptionRenomination, see
+	// Agent.SetRemoteICEOptions.
+	ICEOptions []ICEOption
+
+	// DisablePeerReflexiveCandidates stops the agent from learning peer
+	// reflexive remote candidates from inbound binding requests, only the
+	// signaled remote candidates are checked. A binding request from an
+	// address not signaled yet triggers a check once it is.
+	DisablePeerReflexiveCandidates bool
+
+	// HostDisclosure withholds the host candidates, or the host and server
+	// reflexive ones, until the others fail to connect, see HostDisclosure.
+	// Defaults to HostDisclosureImmediate. Gathering completes once the
+	// disclosure is decided: OnCandidate is passed nil and GatherCandidates
+	// in synchronous mode returns before that.
+	HostDisclosure HostDisclosure
+
+	// HostDisclosureTimeout is the time the candidates withheld by
+	// HostDisclosure are given to the others to connect. It starts when the
+	// connectivity checks start, or when gathering completes if they did not
+	// start yet. Defaults to 5 seconds.
+	HostDisclosureTimeout *time.Duration
+
+	// MaxPeerReflexiveCandidates caps the number of peer reflexive remote
+	// candidates learned between restarts, so spoofed binding requests can not
+	// make the agent create unbounded pairs. Further requests from unknown
+	// addresses are discarded and a "peer-reflexive candidate limit reached"
+	// event is logged. No limit if zero.
+	MaxPeerReflexiveCandidates int
+
+	// MaxChecksPerRemoteIP caps the connectivity checks awaiting a response
+	// towards a remote IP, across all the candidate pairs of the IP, so a
+	// peer with many candidates behind a carrier-grade NAT or a firewall
+	// does not trip its flood protection. The checks of further pairs are
+	// deferred until earlier ones are answered or time out, and counted in
+	// CandidatePairStats.DeferredChecks. Nominations and keepalives are not
+	// deferred. No limit if zero.
+	MaxChecksPerRemoteIP int
+
+	// CheckPacer, shared with other agents, paces the connectivity checks
+	// of the agents so they are interleaved fairly, see CheckPacer. The
+	// checks are not paced if nil.
+	CheckPacer *CheckPacer
+
+	// StrictResponseRouting drops the responses to binding requests that
+	// would not be written from the socket the request arrived on, be it
+	// the socket of the candidate, of a UDPMux or of a TURN allocation, to
+	// the source of the request. Such responses are always logged and
+	// counted by Agent.GetResponseRouteViolations, as some NATs drop the
+	// session when a response comes from another port.
+	StrictResponseRouting bool
+
+	// RelayAcrossAddressFamilies pairs the relay candidates with the remote
+	// candidates of both IP address families, for TURN servers translating
+	// between them, e.g. relaying from an IPv4 relayed address to IPv6
+	// peers. Otherwise they are only paired with the remote candidates of
+	// their family, as RFC 8445 requires: the checks of the other pairs
+	// fail with TURN servers that do not translate.
+	RelayAcrossAddressFamilies bool
 }
 
 // initWithDefaults populates an agent and falls back to defaults if fields are unset
@@ -208,12 +659,83 @@ func (config *AgentConfig) initWithDefaults(a *Agent) {
 		a.failedTimeout = *config.FailedTimeout
 	}
 
+	if config.CloseTimeout == nil {
+		a.closeTimeout = defaultCloseTimeout
+	} else {
+		a.closeTimeout = *config.CloseTimeout
+	}
+
+	if config.HostDisclosure == 0 {
+		a.hostDisclosure = HostDisclosureImmediate
+	} else {
+		a.hostDisclosure = config.HostDisclosure
+	}
+
+	if config.HostDisclosureTimeout == nil {
+		a.hostDisclosureTimeout = defaultHostDisclosureTimeout
+	} else {
+		a.hostDisclosureTimeout = *config.HostDisclosureTimeout
+	}
+
 	if config.KeepaliveInterval == nil {
 		a.keepaliveInterval = defaultKeepaliveInterval
 	} else {
 		a.keepaliveInterval = *config.KeepaliveInterval
 	}
 
+	if config.KeepaliveScope == 0 {
+		a.keepaliveScope = KeepaliveScopeSelectedPair
+	} else {
+		a.keepaliveScope = config.KeepaliveScope
+	}
+
+	if config.KeepaliveIdleTimeout == nil {
+		a.keepaliveIdleTimeout = a.keepaliveInterval
+		a.keepaliveIdleTimeoutDefault = true
+	} else {
+		a.keepaliveIdleTimeout = *config.KeepaliveIdleTimeout
+	}
+
+	a.keepalivePayload = config.KeepalivePayload
+	a.keepalivePayloadOnly = config.KeepalivePayloadOnly
+
+	if config.StandbyKeepaliveInterval == nil {
+		a.standbyKeepaliveInterval = a.keepaliveInterval
+		a.standbyKeepaliveIntervalDefault = true
+	} else {
+		a.standbyKeepaliveInterval = *config.StandbyKeepaliveInterval
+	}
+
+	if config.Clock == nil {
+		a.clock = systemClock{}
+	} else {
+		a.clock = config.Clock
+	}
+
+	a.foundationFunc = config.FoundationFunc
+	a.localPreferenceFunc = config.LocalPreferenceFunc
+
+	a.deterministicOrdering = config.DeterministicOrdering
+
+	a.synchronous = config.Synchronous
+	if config.MaxGatheringConcurrency > 0 {
+		a.gatherWorkers = make(chan struct{}, config.MaxGatheringConcurrency)
+	}
+	a.probeNAT = config.ProbeNATMapping
+	a.stunFaults = newSTUNFaultInjector(config.STUNFaults)
+	a.candidateHandlers.deferred = a.synchronous
+	a.pairHandlers.deferred = a.synchronous
+	a.stateHandlers.deferred = a.synchronous
+	a.authFailureHandlers.deferred = a.synchronous
+	if a.deterministicOrdering {
+		rng := newSeededMathRandomGenerator(config.DeterministicSeed)
+		a.candidateIDs = &candidateIDGenerator{rng}
+		a.tieBreaker = rng.Uint64()
+	} else {
+		a.candidateIDs = &globalCandidateIDGenerator
+		a.tieBreaker = globalMathRandomGenerator.Uint64()
+	}
+
 	if config.CheckInterval == nil {
 		a.checkInterval = defaultCheckInterval
 	} else {
@@ -225,6 +747,61 @@ func (config *AgentConfig) initWithDefaults(a *Agent) {
 	} else {
 		a.candidateTypes = config.CandidateTypes
 	}
+
+	if len(config.RTTHistogramBuckets) == 0 {
+		a.rttHistogramBuckets = defaultRTTHistogramBuckets()
+	} else {
+		a.rttHistogramBuckets = append([]time.Duration{}, config.RTTHistogramBuckets...)
+		sort.Slice(a.rttHistogramBuckets, func(i, j int) bool { return a.rttHistogramBuckets[i] < a.rttHistogramBuckets[j] })
+	}
+	a.rttHistogram = newRTTHistogram(a.rttHistogramBuckets)
+
+	// Make sure the buffer doesn't grow indefinitely.
+	// NOTE: We actually won't get anywhere close to this limit.
+	// SRTP will constantly read from the endpoint and drop packets if it's full.
+	receiveBufferSize := maxBufferSize
+	if config.ReceiveBufferSize > 0 {
+		receiveBufferSize = config.ReceiveBufferSize
+	}
+	receiveBufferOverflow := BufferOverflowDropNewest
+	if config.ReceiveBufferOverflow != 0 {
+		receiveBufferOverflow = config.ReceiveBufferOverflow
+	}
+	a.buffer = newReceiveBuffer(receiveBufferSize, receiveBufferOverflow, nil)
+
+	a.maxPacketSize = receiveMTU
+	a.reportPacketTooLarge = config.ReportPacketTooLarge
+	if config.MaxPacketSize > 0 {
+		a.maxPacketSize = config.MaxPacketSize
+	}
+
+	a.pathMTUDiscoveryEnabled = config.PathMTUDiscovery
+	a.maxPathMTU = defaultMaxPathMTU
+	if config.MaxPathMTU > 0 {
+		a.maxPathMTU = config.MaxPathMTU
+	}
+
+	if config.MaxLocalCandidates > 0 {
+		a.maxLocalCandidates = config.MaxLocalCandidates
+	}
+	a.disableBatchIO = config.DisableBatchIO
+	a.ioBackend = config.IOBackend
+	if a.ioBackend == IOBackendIOUring && !ioUringBuiltIn {
+		a.log.Warn("io_uring IO backend not built in, build with the iouring tag on Linux")
+	}
+
+	if config.Resolver == nil {
+		a.resolver = net.DefaultResolver
+	} else {
+		a.resolver = config.Resolver
+	}
+}
+
+func taskQueueSize(size int) int {
+	if size < 0 {
+		return 0
+	}
+	return size
 }
 
 func (config *AgentConfig) initExtIPMapping(a *Agent) error {
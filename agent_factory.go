@@ -0,0 +1,90 @@
+package ice
+
+import (
+	"sync"
+
+	"github.com/pion/logging"
+	"github.com/pion/mdns"
+	"github.com/pion/transport/vnet"
+)
+
+// AgentFactory creates agents from a base configuration, sharing the
+// resources a service creating many agents would otherwise set up for each
+// of them: the logger factory, the network, the UDPMux and TCPMux, the
+// resolver and the clock of the configuration, and the mDNS conn used to
+// resolve remote mDNS candidates in MulticastDNSModeQueryOnly.
+type AgentFactory struct {
+	config AgentConfig
+
+	mu       sync.RWMutex
+	mDNSConn *mdns.Conn
+	closed   bool
+}
+
+// NewAgentFactory creates an AgentFactory for config. It must be closed
+// with Close once the agents it created are closed.
+func NewAgentFactory(config AgentConfig) (*AgentFactory, error) {
+	if config.LoggerFactory == nil {
+		config.LoggerFactory = logging.NewDefaultLoggerFactory()
+	}
+	if config.Net == nil {
+		config.Net = vnet.NewNet(nil)
+	}
+
+	f := &AgentFactory{config: config}
+
+	mDNSMode := config.MulticastDNSMode
+	if mDNSMode == 0 {
+		mDNSMode = MulticastDNSModeQueryOnly
+	}
+	if mDNSMode == MulticastDNSModeQueryOnly && !config.Net.IsVirtual() {
+		log := config.LoggerFactory.NewLogger("ice")
+		conn, _, err := createMulticastDNS(mDNSMode, "", log)
+		// Opportunistic mDNS: the agents try to open their own connection
+		// instead, and continue without it too
+		if err != nil {
+			log.Warnf("Failed to initialize shared mDNS: %v", err)
+		} else {
+			f.mDNSConn = conn
+		}
+	}
+
+	return f, nil
+}
+
+// NewAgent creates an agent with the base configuration of the factory.
+// configure, if not nil, is called with a copy of the base configuration to
+// override some of it for this agent. The slices and pointers of the copy
+// are shared with the base configuration: replace them rather than modify
+// them.
+func (f *AgentFactory) NewAgent(configure func(*AgentConfig)) (*Agent, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return nil, ErrAgentFactoryClosed
+	}
+
+	config := f.config
+	if configure != nil {
+		configure(&config)
+	}
+	return newAgent(&config, f.mDNSConn)
+}
+
+// Close closes the resources the factory created. The muxes and other
+// resources of the base configuration are left to the caller.
+func (f *AgentFactory) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+
+	if f.mDNSConn != nil {
+		return f.mDNSConn.Close()
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgentFactory(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	clock := NewManualClock(time.Now())
+	f, err := NewAgentFactory(AgentConfig{
+		NetworkTypes: []NetworkType{NetworkTypeUDP4},
+		Clock:        clock,
+	})
+	require.NoError(t, err)
+
+	a, err := f.NewAgent(nil)
+	require.NoError(t, err)
+	b, err := f.NewAgent(func(config *AgentConfig) {
+		config.CandidateTypes = []CandidateType{CandidateTypeHost}
+	})
+	require.NoError(t, err)
+	gather, err := f.NewAgent(func(config *AgentConfig) {
+		config.MulticastDNSMode = MulticastDNSModeQueryAndGather
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, clock, a.clock)
+	assert.Equal(t, a.net, b.net)
+	assert.Equal(t, a.loggerFactory, b.loggerFactory)
+	assert.Equal(t, []CandidateType{CandidateTypeHost}, b.candidateTypes)
+	assert.NotEqual(t, a.candidateTypes, b.candidateTypes)
+
+	// Agents querying mDNS share the conn of the factory, those gathering
+	// mDNS candidates need their own
+	if f.mDNSConn != nil {
+		assert.Same(t, f.mDNSConn, a.mDNSConn)
+		assert.Same(t, f.mDNSConn, b.mDNSConn)
+		assert.NotSame(t, f.mDNSConn, gather.mDNSConn)
+	}
+
+	assert.NoError(t, a.Close())
+	assert.NoError(t, b.Close())
+	assert.NoError(t, gather.Close())
+	require.NoError(t, f.Close())
+
+	_, err = f.NewAgent(nil)
+	assert.ErrorIs(t, err, ErrAgentFactoryClosed)
+	assert.NoError(t, f.Close())
+}
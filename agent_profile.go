@@ -0,0 +1,63 @@
+package ice
+
+// AgentProfile selects the defaults of the AgentConfig fields left unset.
+type AgentProfile int
+
+const (
+	// AgentProfileDefault uses the documented default of each field.
+	AgentProfileDefault AgentProfile = iota
+
+	// AgentProfileLowMemory targets constrained devices. Unless configured
+	// otherwise, the agent:
+	//   - disables mDNS, no multicast socket is opened
+	//   - only gathers NetworkTypeUDP4 candidates
+	//   - buffers up to 64KB of received data instead of 1MB
+	//   - reads candidate sockets one packet at a time, without the
+	//     preallocated buffers of batched reads
+	//   - keeps at most 4 local candidates, each owning a socket and a
+	//     goroutine reading it
+	//
+	// The profile does not change the timers: whatever the profile, the
+	// connectivity checks, keepalives and timeouts of an agent are driven
+	// by a single timer, and the other timers only run while a feature
+	// using them, such as HostDisclosure or PathMTUDiscovery, is enabled.
+	AgentProfileLowMemory
+)
+
+const (
+	lowMemoryReceiveBufferSize  = 64 * 1000
+	lowMemoryMaxLocalCandidates = 4
+)
+
+func (p AgentProfile) String() string {
+	switch p {
+	case AgentProfileDefault:
+		return "default"
+	case AgentProfileLowMemory:
+		return "low-memory"
+	default:
+		return ErrUnknownType.Error()
+	}
+}
+
+// applyProfile fills the fields of config left unset with the defaults of
+// config.Profile. It runs before any field of config is read.
+func (config *AgentConfig) applyProfile() {
+	if config.Profile != AgentProfileLowMemory {
+		return
+	}
+
+	if config.MulticastDNSMode == 0 {
+		config.MulticastDNSMode = MulticastDNSModeDisabled
+	}
+	if len(config.NetworkTypes) == 0 {
+		config.NetworkTypes = []NetworkType{NetworkTypeUDP4}
+	}
+	if config.ReceiveBufferSize == 0 {
+		config.ReceiveBufferSize = lowMemoryReceiveBufferSize
+	}
+	if config.MaxLocalCandidates == 0 {
+		config.MaxLocalCandidates = lowMemoryMaxLocalCandidates
+	}
+	config.DisableBatchIO = true
+}
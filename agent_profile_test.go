@@ -0,0 +1,82 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgentProfileLowMemory(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	t.Run("Defaults", func(t *testing.T) {
+		config := &AgentConfig{Profile: AgentProfileLowMemory}
+		a, err := NewAgent(config)
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, a.Close()) }()
+
+		assert.Equal(t, MulticastDNSModeDisabled, a.mDNSMode)
+		assert.Nil(t, a.mDNSConn)
+		assert.Equal(t, []NetworkType{NetworkTypeUDP4}, a.networkTypes)
+		assert.Equal(t, lowMemoryReceiveBufferSize, a.GetReceiveBufferStats().Limit)
+		assert.Equal(t, lowMemoryMaxLocalCandidates, a.maxLocalCandidates)
+		assert.True(t, a.disableBatchIO)
+
+		// The caller's config is left untouched
+		assert.Equal(t, &AgentConfig{Profile: AgentProfileLowMemory}, config)
+	})
+
+	t.Run("Overrides", func(t *testing.T) {
+		a, err := NewAgent(&AgentConfig{
+			Profile:           AgentProfileLowMemory,
+			NetworkTypes:      []NetworkType{NetworkTypeUDP6},
+			ReceiveBufferSize: 1000,
+		})
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, a.Close()) }()
+
+		assert.Equal(t, []NetworkType{NetworkTypeUDP6}, a.networkTypes)
+		assert.Equal(t, 1000, a.GetReceiveBufferStats().Limit)
+	})
+}
+
+func TestMaxLocalCandidates(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	a, err := NewAgent(&AgentConfig{MaxLocalCandidates: 2})
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, a.Close()) }()
+
+	for i := 0; i < 3; i++ {
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		c, err := NewCandidateHost(&CandidateHostConfig{
+			Network:   "udp",
+			Address:   "127.0.0.1",
+			Port:      conn.LocalAddr().(*net.UDPAddr).Port, //nolint:forcetypeassert
+			Component: 1,
+		})
+		require.NoError(t, err)
+		require.NoError(t, a.addCandidate(context.Background(), c, conn))
+
+		if i == 2 {
+			// The discarded candidate's conn is closed
+			_, err = conn.WriteTo([]byte{0}, conn.LocalAddr())
+			assert.Error(t, err)
+		}
+	}
+
+	candidates, err := a.GetLocalCandidates()
+	require.NoError(t, err)
+	assert.Len(t, candidates, 2)
+}
@@ -0,0 +1,230 @@
+package ice
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// AgentState is the part of an agent that can be carried over to a new
+// process, e.g. across the upgrade of a long-running gateway: the local
+// credentials and the UDP host and server reflexive candidates. The sockets
+// are not part of it, ImportState binds them again to the same ports.
+type AgentState struct {
+	LocalUfrag string           `json:"localUfrag"`
+	LocalPwd   string           `json:"localPwd"`
+	Candidates []CandidateState `json:"candidates"`
+}
+
+// CandidateState is a local candidate of an AgentState.
+type CandidateState struct {
+	ID string `json:"id"`
+
+	// Candidate is the candidate as returned by Candidate.Marshal
+	Candidate string `json:"candidate"`
+
+	// BaseAddress is the address the socket of the candidate is bound to
+	BaseAddress string `json:"baseAddress"`
+
+	// URL is the STUN server the candidate was gathered from, see
+	// Candidate.Origin
+	URL string `json:"url,omitempty"`
+}
+
+// ExportState returns the state of the agent. Relay and TCP candidates, and
+// the candidates sharing the socket of a UDPMux, are left out: they can not
+// be taken over by another process.
+func (a *Agent) ExportState() (*AgentState, error) {
+	var state *AgentState
+	if err := a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		state = &AgentState{LocalUfrag: agent.localUfrag, LocalPwd: agent.localPwd}
+		for _, c := range orderedCandidates(agent.localCandidates) {
+			if s, ok := exportCandidate(c); ok {
+				state.Candidates = append(state.Candidates, s)
+			}
+		}
+	}); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func exportCandidate(c Candidate) (CandidateState, bool) {
+	if !c.NetworkType().IsUDP() || (c.Type() != CandidateTypeHost && c.Type() != CandidateTypeServerReflexive) {
+		return CandidateState{}, false
+	}
+
+	conn := candidateSocket(c)
+	if conn == nil || isMuxedCandidate(c) {
+		return CandidateState{}, false
+	}
+
+	return CandidateState{
+		ID:          c.ID(),
+		Candidate:   c.Marshal(),
+		BaseAddress: conn.LocalAddr().String(),
+		URL:         c.gatherInfo().url,
+	}, true
+}
+
+// ImportState restores the state exported by ExportState, possibly in
+// another process, instead of gathering candidates. The sockets of the
+// candidates are bound to the ports they had. Candidates that can not be
+// restored are skipped and the first failure is returned, gathering is
+// complete regardless. All the failures are reported by GetGatheringError.
+//
+// ImportState must be called on a new agent, before GatherCandidates.
+func (a *Agent) ImportState(state *AgentState) error {
+	var err error
+	if runErr := a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		if agent.gatheringState != GatheringStateNew {
+			err = ErrMultipleGatherAttempted
+		}
+	}); runErr != nil {
+		return runErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = a.Restart(state.LocalUfrag, state.LocalPwd); err != nil {
+		return err
+	}
+	if err = a.setGatheringState(GatheringStateGathering); err != nil {
+		return err
+	}
+	a.sockets.reset()
+	defer a.sockets.clearReservations()
+
+	var firstErr error
+	for _, s := range state.Candidates {
+		if importErr := a.importCandidate(s); importErr != nil {
+			a.log.Warnf("Failed to import candidate %s: %v", s.Candidate, importErr)
+			a.recordImportError(s, importErr)
+			if firstErr == nil {
+				firstErr = importErr
+			}
+		}
+	}
+
+	if err = a.setGatheringState(GatheringStateComplete); err != nil {
+		return err
+	}
+	return firstErr
+}
+
+func (a *Agent) importCandidate(s CandidateState) error {
+	parsed, err := UnmarshalCandidate(s.Candidate)
+	if err != nil {
+		return err
+	}
+	base, err := net.ResolveUDPAddr(udp, s.BaseAddress)
+	if err != nil {
+		return err
+	}
+
+	network := parsed.NetworkType().NetworkShort()
+	var c Candidate
+	switch parsed.Type() {
+	case CandidateTypeHost:
+		c, err = NewCandidateHost(&CandidateHostConfig{
+			CandidateID: s.ID,
+			Network:     network,
+			Address:     parsed.Address(),
+			Port:        parsed.Port(),
+			Component:   parsed.Component(),
+			Priority:    parsed.Priority(),
+			Foundation:  parsed.Foundation(),
+		})
+	case CandidateTypeServerReflexive:
+		c, err = NewCandidateServerReflexive(&CandidateServerReflexiveConfig{
+			CandidateID: s.ID,
+			Network:     network,
+			Address:     parsed.Address(),
+			Port:        parsed.Port(),
+			Component:   parsed.Component(),
+			Priority:    parsed.Priority(),
+			Foundation:  parsed.Foundation(),
+			RelAddr:     parsed.RelatedAddress().Address,
+			RelPort:     parsed.RelatedAddress().Port,
+		})
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownCandidateTyp, parsed.Type())
+	}
+	if err != nil {
+		return err
+	}
+
+	// An mDNS host candidate is bound to its IP
+	if host, ok := c.(*CandidateHost); ok && c.addr() == nil {
+		if err = host.setIP(base.IP); err != nil {
+			return err
+		}
+	}
+
+	for _, ext := range parsed.Extensions() {
+		if err = c.AddExtension(ext); err != nil {
+			return err
+		}
+	}
+
+	if err = a.sockets.reserve(); err != nil {
+		return err
+	}
+	conn, err := a.transport.ListenPacket(parsed.NetworkType().String(), base)
+	if err != nil {
+		a.sockets.release()
+		return err
+	}
+	now := a.clock.Now()
+	c.setGatherInfo(candidateGatherInfo{url: s.URL, started: now, completed: now})
+
+	if err := a.addCandidate(a.context(), c, a.captureConn(conn)); err != nil {
+		closeConnAndLog(conn, a.log, fmt.Sprintf("Failed to add imported candidate %s: %v", c, err))
+		return err
+	}
+	return nil
+}
+
+// recordImportError remembers that s could not be imported, with the type
+// and network of the candidate when it can be parsed.
+func (a *Agent) recordImportError(s CandidateState, err error) {
+	gatheringErr := &CandidateGatheringError{Address: s.BaseAddress, Err: err}
+	if parsed, parseErr := UnmarshalCandidate(s.Candidate); parseErr == nil {
+		gatheringErr.CandidateType = parsed.Type()
+		gatheringErr.Network = parsed.NetworkType().String()
+	}
+	a.recordGatheringError(a.context(), gatheringErr)
+}
+
+// candidateSocket returns the socket of a local candidate, unwrapped from
+// the packet capture.
+func candidateSocket(c Candidate) net.PacketConn {
+	var conn net.PacketConn
+	switch cand := c.(type) {
+	case *CandidateHost:
+		conn = cand.conn
+	case *CandidateServerReflexive:
+		conn = cand.conn
+	case *CandidatePeerReflexive:
+		conn = cand.conn
+	case *CandidateRelay:
+		conn = cand.conn
+	case *CandidateCustom:
+		conn = cand.conn
+	}
+	if captured, ok := conn.(*captureConn); ok {
+		conn = captured.PacketConn
+	}
+	return conn
+}
+
+// isMuxedCandidate reports whether the socket of a local candidate is shared
+// through a UDPMux or TCPMux. TCP candidates always are.
+func isMuxedCandidate(c Candidate) bool {
+	if c.NetworkType().IsTCP() {
+		return true
+	}
+	_, muxed := candidateSocket(c).(*udpMuxedConn)
+	return muxed
+}
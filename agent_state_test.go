@@ -0,0 +1,84 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImportState(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	config := func() *AgentConfig {
+		return &AgentConfig{
+			NetworkTypes:     []NetworkType{NetworkTypeUDP4},
+			CandidateTypes:   []CandidateType{CandidateTypeHost},
+			InterfaceFilter:  func(name string) bool { return true },
+			MulticastDNSMode: MulticastDNSModeDisabled,
+		}
+	}
+
+	a, err := NewAgent(config())
+	require.NoError(t, err)
+
+	gathered := make(chan struct{})
+	require.NoError(t, a.OnCandidate(func(c Candidate) {
+		if c == nil {
+			close(gathered)
+		}
+	}))
+	require.NoError(t, a.GatherCandidates())
+	select {
+	case <-gathered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("gathering did not complete")
+	}
+
+	state, err := a.ExportState()
+	require.NoError(t, err)
+	require.NotEmpty(t, state.Candidates)
+
+	exported, err := a.GetLocalCandidates()
+	require.NoError(t, err)
+	require.NoError(t, a.Close())
+
+	raw, err := json.Marshal(state)
+	require.NoError(t, err)
+	imported := &AgentState{}
+	require.NoError(t, json.Unmarshal(raw, imported))
+
+	b, err := NewAgent(config())
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, b.Close())
+	}()
+
+	require.NoError(t, b.ImportState(imported))
+	assert.ErrorIs(t, b.ImportState(imported), ErrMultipleGatherAttempted)
+
+	ufrag, pwd, err := b.GetLocalUserCredentials()
+	require.NoError(t, err)
+	assert.Equal(t, state.LocalUfrag, ufrag)
+	assert.Equal(t, state.LocalPwd, pwd)
+
+	candidates, err := b.GetLocalCandidates()
+	require.NoError(t, err)
+	require.Len(t, candidates, len(exported))
+	for i, c := range candidates {
+		assert.Equal(t, exported[i].ID(), c.ID())
+		assert.True(t, exported[i].Equal(c), "%s != %s", exported[i], c)
+	}
+
+	require.NoError(t, b.run(b.context(), func(ctx context.Context, agent *Agent) {
+		assert.Equal(t, GatheringStateComplete, agent.gatheringState)
+	}))
+}
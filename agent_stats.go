@@ -1,9 +1,6 @@
 package ice
 
-import (
-	"context"
-	"time"
-)
+import "context"
 
 // GetCandidatePairsStats returns a list of candidate pair stats
 func (a *Agent) GetCandidatePairsStats() []CandidatePairStats {
@@ -12,7 +9,7 @@ func (a *Agent) GetCandidatePairsStats() []CandidatePairStats {
 		result := make([]CandidatePairStats, 0, len(agent.checklist))
 		for _, cp := range agent.checklist {
 			stat := CandidatePairStats{
-				Timestamp:         time.Now(),
+				Timestamp:         a.clock.Now(),
 				LocalCandidateID:  cp.Local.ID(),
 				RemoteCandidateID: cp.Remote.ID(),
 				State:             cp.state,
@@ -26,19 +23,30 @@ func (a *Agent) GetCandidatePairsStats() []CandidatePairStats {
 				// FirstRequestTimestamp time.Time
 				// LastRequestTimestamp time.Time
 				// LastResponseTimestamp time.Time
-				// TotalRoundTripTime float64
-				// CurrentRoundTripTime float64
 				// AvailableOutgoingBitrate float64
 				// AvailableIncomingBitrate float64
 				// CircuitBreakerTriggerCount uint32
 				// RequestsReceived uint64
 				// RequestsSent uint64
-				// ResponsesReceived uint64
 				// ResponsesSent uint64
 				// RetransmissionsReceived uint64
 				// RetransmissionsSent uint64
 				// ConsentRequestsSent uint64
 				// ConsentExpiredTimestamp time.Time
+				DeferredChecks:              cp.deferredChecks,
+				ErrorResponsesReceived:      cp.errorResponses,
+				LastErrorCode:               cp.lastErrorCode,
+				LastErrorReason:             cp.lastErrorReason,
+				LastErrorTimestamp:          cp.lastErrorTime,
+				UnmatchedResponsesReceived:  cp.unmatchedResponses,
+				DuplicateResponsesReceived:  cp.duplicateResponses,
+				MismatchedResponsesReceived: cp.mismatchedResponses,
+				RoundTripTimeHistogram:      cp.rttHistogram.snapshot(),
+			}
+			if h := cp.rttHistogram; h != nil {
+				stat.TotalRoundTripTime = h.sum.Seconds()
+				stat.CurrentRoundTripTime = h.last.Seconds()
+				stat.ResponsesReceived = h.count
 			}
 			result = append(result, stat)
 		}
@@ -51,6 +59,26 @@ func (a *Agent) GetCandidatePairsStats() []CandidatePairStats {
 	return res
 }
 
+// GetRoundTripTimeHistogram returns the distribution of the round trip times
+// of all binding requests answered on any candidate pair of the agent
+func (a *Agent) GetRoundTripTimeHistogram() RTTHistogram {
+	var res RTTHistogram
+	err := a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		res = agent.rttHistogram.snapshot()
+	})
+	if err != nil {
+		a.log.Errorf("error getting round trip time histogram %v", err)
+		return RTTHistogram{}
+	}
+	return res
+}
+
+// GetReceiveBufferStats returns the occupancy of the buffer holding the data
+// received until it is read from the Conn, see AgentConfig.ReceiveBufferSize
+func (a *Agent) GetReceiveBufferStats() BufferStats {
+	return a.buffer.stats()
+}
+
 // GetLocalCandidatesStats returns a list of local candidates stats
 func (a *Agent) GetLocalCandidatesStats() []CandidateStats {
 	var res []CandidateStats
@@ -64,16 +92,19 @@ func (a *Agent) GetLocalCandidatesStats() []CandidateStats {
 						relayProtocol = cRelay.RelayProtocol()
 					}
 				}
+				gathered := c.gatherInfo()
 				stat := CandidateStats{
-					Timestamp:     time.Now(),
-					ID:            c.ID(),
-					NetworkType:   networkType,
-					IP:            c.Address(),
-					Port:          c.Port(),
-					CandidateType: c.Type(),
-					Priority:      c.Priority(),
-					// URL string
-					RelayProtocol: relayProtocol,
+					Timestamp:                  a.clock.Now(),
+					ID:                         c.ID(),
+					NetworkType:                networkType,
+					IP:                         c.Address(),
+					Port:                       c.Port(),
+					CandidateType:              c.Type(),
+					Priority:                   c.Priority(),
+					URL:                        gathered.url,
+					RelayProtocol:              relayProtocol,
+					GatheringStartTimestamp:    gathered.started,
+					GatheringCompleteTimestamp: gathered.completed,
 					// Deleted bool
 				}
 				result = append(result, stat)
@@ -96,7 +127,7 @@ func (a *Agent) GetRemoteCandidatesStats() []CandidateStats {
 		for networkType, localCandidates := range agent.remoteCandidates {
 			for _, c := range localCandidates {
 				stat := CandidateStats{
-					Timestamp:     time.Now(),
+					Timestamp:     a.clock.Now(),
 					ID:            c.ID(),
 					NetworkType:   networkType,
 					IP:            c.Address(),
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"net"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -204,6 +205,50 @@ func TestOnSelectedCandidatePairChange(t *testing.T) {
 	assert.NoError(t, a.Close())
 }
 
+func TestValidateNonSTUNTrafficSelectedPair(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	a, err := NewAgent(&AgentConfig{})
+	assert.NoError(t, err)
+
+	local, err := NewCandidateHost(&CandidateHostConfig{
+		Network:   "udp",
+		Address:   "192.168.1.1",
+		Port:      19216,
+		Component: 1,
+	})
+	assert.NoError(t, err)
+
+	remote, err := NewCandidateHost(&CandidateHostConfig{
+		Network:   "udp",
+		Address:   "192.168.1.2",
+		Port:      19217,
+		Component: 1,
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+		agent.selectedPair.Store(newCandidatePair(local, remote, false))
+	}))
+
+	// Block the taskLoop, data on the selected pair must still be accepted
+	blocked, unblock := make(chan struct{}), make(chan struct{})
+	go func() {
+		_ = a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+			close(blocked)
+			<-unblock
+		})
+	}()
+	<-blocked
+
+	assert.True(t, a.validateNonSTUNTraffic(local, remote.addr()))
+	assert.False(t, remote.LastReceived().IsZero())
+
+	close(unblock)
+	assert.NoError(t, a.Close())
+}
+
 type BadAddr struct{}
 
 func (ba *BadAddr) Network() string {
@@ -328,7 +373,7 @@ func TestHandlePeerReflexive(t *testing.T) {
 			tID := [stun.TransactionIDSize]byte{}
 			copy(tID[:], "ABC")
 			a.pendingBindingRequests = []bindingRequest{
-				{time.Now(), tID, &net.UDPAddr{}, false},
+				{time.Now(), tID, &net.UDPAddr{}, false, nil},
 			}
 
 			hostConfig := CandidateHostConfig{
@@ -706,7 +751,10 @@ func TestInvalidAgentStarts(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if _, err = a.Dial(context.TODO(), "foo", "bar"); err != nil && !errors.Is(err, ErrMultipleStart) {
+	// Dialing again after a cancel waits for the checks again
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err = a.Dial(ctx, "foo", "bar"); err != nil && !errors.Is(err, ErrCanceledByCaller) {
 		t.Fatal(err)
 	}
 
@@ -779,6 +827,65 @@ func TestConnectionStateCallback(t *testing.T) {
 	<-isClosed
 }
 
+func TestConnectionStateChangeReason(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	disconnectedDuration := time.Second
+	failedDuration := time.Second
+	KeepaliveInterval := time.Duration(0)
+
+	cfg := &AgentConfig{
+		Urls:                []*URL{},
+		NetworkTypes:        supportedNetworkTypes(),
+		DisconnectedTimeout: &disconnectedDuration,
+		FailedTimeout:       &failedDuration,
+		KeepaliveInterval:   &KeepaliveInterval,
+	}
+
+	aAgent, err := NewAgent(cfg)
+	assert.NoError(t, err)
+
+	bAgent, err := NewAgent(cfg)
+	assert.NoError(t, err)
+
+	var reasonsMu sync.Mutex
+	reasons := map[ConnectionState]ConnectionStateChangeReason{}
+	isFailed := make(chan interface{})
+	isClosed := make(chan interface{})
+	assert.NoError(t, aAgent.OnConnectionStateChangeWithReason(func(c ConnectionState, r ConnectionStateChangeReason) {
+		reasonsMu.Lock()
+		reasons[c] = r
+		reasonsMu.Unlock()
+
+		switch c {
+		case ConnectionStateFailed:
+			close(isFailed)
+		case ConnectionStateClosed:
+			close(isClosed)
+		default:
+		}
+	}))
+
+	connect(aAgent, bAgent)
+	<-isFailed
+
+	assert.NoError(t, aAgent.Close())
+	assert.NoError(t, bAgent.Close())
+	<-isClosed
+
+	reasonsMu.Lock()
+	defer reasonsMu.Unlock()
+	assert.Equal(t, ConnectionStateChangeReasonChecksStarted, reasons[ConnectionStateChecking])
+	assert.Equal(t, ConnectionStateChangeReasonPairSelected, reasons[ConnectionStateConnected])
+	assert.Equal(t, ConnectionStateChangeReasonKeepaliveTimeout, reasons[ConnectionStateDisconnected])
+	assert.Equal(t, ConnectionStateChangeReasonKeepaliveTimeout, reasons[ConnectionStateFailed])
+	assert.Equal(t, ConnectionStateChangeReasonClosed, reasons[ConnectionStateClosed])
+}
+
 func TestInvalidGather(t *testing.T) {
 	t.Run("Gather with no OnCandidate should error", func(t *testing.T) {
 		a, err := NewAgent(&AgentConfig{})
@@ -878,6 +985,13 @@ func TestCandidatePairStats(t *testing.T) {
 	p := a.findPair(hostLocal, prflxRemote)
 	p.state = CandidatePairStateFailed
 
+	rejected := time.Now()
+	p = a.findPair(hostLocal, relayRemote)
+	p.lastErrorCode = stun.CodeRoleConflict
+	p.lastErrorReason = "Role Conflict"
+	p.lastErrorTime = rejected
+	p.errorResponses = 2
+
 	stats := a.GetCandidatePairsStats()
 	if len(stats) != 4 {
 		t.Fatal("expected 4 candidate pairs stats")
@@ -924,6 +1038,12 @@ func TestCandidatePairStats(t *testing.T) {
 			prflxPairStat.State.String())
 	}
 
+	assert.Equal(t, stun.CodeRoleConflict, relayPairStat.LastErrorCode)
+	assert.Equal(t, "Role Conflict", relayPairStat.LastErrorReason)
+	assert.Equal(t, rejected, relayPairStat.LastErrorTimestamp)
+	assert.Equal(t, uint64(2), relayPairStat.ErrorResponsesReceived)
+	assert.Equal(t, stun.ErrorCode(0), hostPairStat.LastErrorCode)
+
 	assert.NoError(t, a.Close())
 }
 
@@ -1463,6 +1583,262 @@ func TestAgentRestart(t *testing.T) {
 		assert.NoError(t, connA.agent.Close())
 		assert.NoError(t, connB.agent.Close())
 	})
+
+	t.Run("Warm Restart Both Sides", func(t *testing.T) {
+		connA, connB := pipe(&AgentConfig{
+			DisconnectedTimeout: &oneSecond,
+			FailedTimeout:       &oneSecond,
+		})
+		// Get the IDs and ports of the candidates, in any order
+		candidateAddresses := func(candidates []Candidate, err error) map[string]int {
+			assert.NoError(t, err)
+
+			out := map[string]int{}
+			for _, c := range candidates {
+				out[c.ID()] = c.Port()
+			}
+			return out
+		}
+		connAFirstCandidates := candidateAddresses(connA.agent.GetLocalCandidates())
+
+		aNotifier, aConnected := onConnected()
+		assert.NoError(t, connA.agent.OnConnectionStateChange(aNotifier))
+
+		bNotifier, bConnected := onConnected()
+		assert.NoError(t, connB.agent.OnConnectionStateChange(bNotifier))
+
+		assert.NoError(t, connA.agent.WarmRestart("", ""))
+		assert.NoError(t, connB.agent.WarmRestart("", ""))
+
+		ufrag, pwd, err := connB.agent.GetLocalUserCredentials()
+		assert.NoError(t, err)
+		assert.NoError(t, connA.agent.SetRemoteCredentials(ufrag, pwd))
+		ufrag, pwd, err = connA.agent.GetLocalUserCredentials()
+		assert.NoError(t, err)
+		assert.NoError(t, connB.agent.SetRemoteCredentials(ufrag, pwd))
+
+		// Signal the kept candidates again, without gathering
+		signal := func(from, to *Agent) {
+			candidates, err := from.GetLocalCandidates()
+			assert.NoError(t, err)
+			for _, c := range candidates {
+				remote, err := UnmarshalCandidate(c.Marshal())
+				assert.NoError(t, err)
+				assert.NoError(t, to.AddRemoteCandidate(remote))
+			}
+		}
+		signal(connA.agent, connB.agent)
+		signal(connB.agent, connA.agent)
+
+		<-aConnected
+		<-bConnected
+
+		// The same candidates, with their ports, in a new generation
+		candidates, err := connA.agent.GetLocalCandidates()
+		assert.NoError(t, err)
+		assert.Equal(t, connAFirstCandidates, candidateAddresses(candidates, err))
+		for _, c := range candidates {
+			generation, ok := candidateGeneration(c)
+			assert.True(t, ok)
+			assert.Equal(t, uint32(1), generation)
+		}
+
+		assert.NoError(t, connA.agent.Close())
+		assert.NoError(t, connB.agent.Close())
+	})
+
+	t.Run("Warm Restart With Mux", func(t *testing.T) {
+		agent, err := NewAgent(&AgentConfig{})
+		assert.NoError(t, err)
+
+		c, err := NewCandidateHost(&CandidateHostConfig{
+			Network:   "tcp",
+			Address:   "192.168.0.1",
+			Port:      1000,
+			Component: 1,
+			TCPType:   TCPTypePassive,
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, agent.run(context.Background(), func(ctx context.Context, agent *Agent) {
+			agent.localCandidates[NetworkTypeTCP4] = []Candidate{c}
+		}))
+
+		assert.ErrorIs(t, agent.WarmRestart("", ""), ErrWarmRestartMuxedCandidate)
+		assert.NoError(t, agent.Close())
+	})
+}
+
+func TestAddRemoteCandidates(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	a, err := NewAgent(&AgentConfig{})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	var candidates []Candidate
+	for port := 1000; port < 1010; port++ {
+		c, err := NewCandidateHost(&CandidateHostConfig{
+			Network:   "udp",
+			Address:   "192.168.0.2",
+			Port:      port,
+			Component: 1,
+		})
+		require.NoError(t, err)
+		candidates = append(candidates, c)
+	}
+	active, err := NewCandidateHost(&CandidateHostConfig{
+		Network:   "tcp",
+		Address:   "192.168.0.2",
+		Port:      9,
+		Component: 1,
+		TCPType:   TCPTypeActive,
+	})
+	require.NoError(t, err)
+
+	// nil and active TCP candidates are skipped, duplicates added once
+	require.NoError(t, a.AddRemoteCandidates(append(candidates, nil, active, candidates[0])))
+
+	// Candidates are queued until the remote credentials are known
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, a.GetRemoteCandidatesStats())
+	require.NoError(t, a.SetRemoteCredentials("ufrag", "passwordpasswordpassword"))
+	assert.Len(t, a.GetRemoteCandidatesStats(), len(candidates))
+
+	// Queued candidates are dropped by a restart
+	require.NoError(t, a.Restart("", ""))
+	require.NoError(t, a.AddRemoteCandidates(candidates[:1]))
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, a.Restart("", ""))
+	require.NoError(t, a.SetRemoteCredentials("ufrag", "passwordpasswordpassword"))
+	assert.Empty(t, a.GetRemoteCandidatesStats())
+}
+
+func TestCloseWithContext(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	t.Run("Timeout", func(t *testing.T) {
+		a, err := NewAgent(&AgentConfig{})
+		require.NoError(t, err)
+
+		// A task that does not return keeps the agent from closing
+		blocked, unblock := make(chan struct{}), make(chan struct{})
+		go func() {
+			_ = a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+				close(blocked)
+				<-unblock
+			})
+		}()
+		<-blocked
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, a.CloseWithContext(ctx), context.DeadlineExceeded)
+		assert.ErrorIs(t, a.Close(), ErrClosed)
+
+		close(unblock)
+		<-a.taskLoopDone
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		a, err := NewAgent(&AgentConfig{})
+		require.NoError(t, err)
+
+		errDeallocate := errors.New("deallocate failed") //nolint:goerr113
+		relay, err := NewCandidateRelay(&CandidateRelayConfig{
+			Network:   "udp",
+			Address:   "192.168.0.3",
+			Port:      1,
+			Component: 1,
+			OnClose:   func() error { return errDeallocate },
+		})
+		require.NoError(t, err)
+		require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+			agent.localCandidates[NetworkTypeUDP4] = append(agent.localCandidates[NetworkTypeUDP4], relay)
+		}))
+
+		err = a.Close()
+		var closeErr *CloseError
+		assert.True(t, errors.As(err, &closeErr))
+		assert.ErrorIs(t, err, errDeallocate)
+		assert.ErrorIs(t, err, ErrClosed)
+	})
+}
+
+func TestRemoveLocalCandidate(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	a, err := NewAgent(&AgentConfig{})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	local1, local2, remote := newTestHost(t, "192.168.0.1"), newTestHost(t, "192.168.0.2"), newTestHost(t, "192.168.0.3")
+
+	require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+		agent.localCandidates[NetworkTypeUDP4] = []Candidate{local1, local2}
+		agent.remoteCandidates[NetworkTypeUDP4] = []Candidate{remote}
+		agent.setSelectedPair(agent.addPair(local1, remote))
+		agent.addPair(local2, remote)
+	}))
+
+	require.NoError(t, a.RemoveLocalCandidate(newTestHost(t, "192.168.0.1")))
+	assert.ErrorIs(t, a.RemoveLocalCandidate(local1), ErrCandidateNotFound)
+
+	selected, err := a.GetSelectedCandidatePair()
+	assert.NoError(t, err)
+	assert.Nil(t, selected)
+
+	require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+		assert.Equal(t, []Candidate{local2}, agent.localCandidates[NetworkTypeUDP4])
+		assert.Len(t, agent.checklist, 1)
+		assert.Equal(t, local2, agent.checklist[0].Local)
+		assert.Equal(t, ConnectionState(ConnectionStateChecking), agent.connectionState)
+	}))
+}
+
+func TestRemoveRemoteCandidate(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	a, err := NewAgent(&AgentConfig{})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	local, remote1, remote2 := newTestHost(t, "192.168.0.1"), newTestHost(t, "192.168.0.2"), newTestHost(t, "192.168.0.3")
+
+	// Queued candidates can be removed too
+	require.NoError(t, a.AddRemoteCandidate(remote1))
+	assert.Eventually(t, func() bool {
+		return a.RemoveRemoteCandidate(remote1) == nil
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+		agent.localCandidates[NetworkTypeUDP4] = []Candidate{local}
+		agent.remoteUfrag, agent.remotePwd = "ufrag", "pwd"
+		agent.addRemoteCandidates([]Candidate{remote1, remote2})
+		agent.setSelectedPair(agent.findPair(local, remote1))
+	}))
+
+	require.NoError(t, a.RemoveRemoteCandidate(newTestHost(t, "192.168.0.2")))
+	assert.ErrorIs(t, a.RemoveRemoteCandidate(remote1), ErrCandidateNotFound)
+
+	selected, err := a.GetSelectedCandidatePair()
+	assert.NoError(t, err)
+	assert.Nil(t, selected)
+
+	require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+		assert.Equal(t, []Candidate{remote2}, agent.remoteCandidates[NetworkTypeUDP4])
+		assert.Len(t, agent.checklist, 1)
+		assert.Equal(t, remote2, agent.checklist[0].Remote)
+	}))
 }
 
 func TestGetRemoteCredentials(t *testing.T) {
@@ -1887,3 +2263,196 @@ func TestAcceptAggressiveNomination(t *testing.T) {
 		return
 	}
 }
+
+func TestRemoteNetworks(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	_, allowed, err := net.ParseCIDR("192.168.0.0/16")
+	require.NoError(t, err)
+	_, denied, err := net.ParseCIDR("192.168.1.0/24")
+	require.NoError(t, err)
+
+	config := &AgentConfig{
+		AllowedRemoteNetworks: []*net.IPNet{allowed},
+		DeniedRemoteNetworks:  []*net.IPNet{denied},
+	}
+
+	t.Run("Signaled", func(t *testing.T) {
+		a, err := NewAgent(config)
+		require.NoError(t, err)
+		defer func() {
+			assert.NoError(t, a.Close())
+		}()
+		require.NoError(t, a.SetRemoteCredentials("ufrag", "pwdpwdpwdpwdpwdpwdpwdpwd"))
+
+		var candidates []Candidate
+		for _, address := range []string{"192.168.1.1", "10.0.0.1", "192.168.0.1"} {
+			c, err := NewCandidateHost(&CandidateHostConfig{
+				Network:   "udp",
+				Address:   address,
+				Port:      1000,
+				Component: 1,
+			})
+			require.NoError(t, err)
+			candidates = append(candidates, c)
+		}
+		require.NoError(t, a.AddRemoteCandidates(candidates))
+
+		var remote []Candidate
+		assert.Eventually(t, func() bool {
+			require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+				remote = append([]Candidate(nil), agent.remoteCandidates[NetworkTypeUDP4]...)
+			}))
+			return len(remote) != 0
+		}, time.Second, 10*time.Millisecond)
+		require.Len(t, remote, 1)
+		assert.Equal(t, "192.168.0.1", remote[0].Address())
+	})
+
+	t.Run("Peer Reflexive", func(t *testing.T) {
+		runAgentTest(t, config, func(ctx context.Context, a *Agent) {
+			a.selector = &controllingSelector{agent: a, log: a.log}
+
+			local := newInboundLocal(t, nil)
+
+			for _, ip := range []string{"192.168.1.3", "172.17.0.3"} {
+				msg, err := stun.Build(stun.BindingRequest, stun.TransactionID,
+					stun.NewUsername(a.localUfrag+":"+a.remoteUfrag),
+					UseCandidate(),
+					AttrControlling(a.tieBreaker),
+					PriorityAttr(local.Priority()),
+					stun.NewShortTermIntegrity(a.localPwd),
+					stun.Fingerprint,
+				)
+				require.NoError(t, err)
+
+				a.handleInbound(msg, local, &net.UDPAddr{IP: net.ParseIP(ip), Port: 999})
+			}
+
+			assert.Empty(t, a.remoteCandidates)
+		})
+	})
+}
+
+func TestRemoteCandidateFilter(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	// Only relay candidates of our TURN servers, over UDP
+	config := &AgentConfig{
+		RemoteCandidateFilter: func(c Candidate) bool {
+			return c.Type() == CandidateTypeRelay && c.NetworkType().IsUDP() && strings.HasPrefix(c.Address(), "203.0.113.")
+		},
+	}
+
+	t.Run("Signaled", func(t *testing.T) {
+		a, err := NewAgent(config)
+		require.NoError(t, err)
+		defer func() {
+			assert.NoError(t, a.Close())
+		}()
+		require.NoError(t, a.SetRemoteCredentials("ufrag", "pwdpwdpwdpwdpwdpwdpwdpwd"))
+
+		host, err := NewCandidateHost(&CandidateHostConfig{
+			Network:   "udp",
+			Address:   "203.0.113.1",
+			Port:      1000,
+			Component: 1,
+		})
+		require.NoError(t, err)
+		foreignRelay, err := NewCandidateRelay(&CandidateRelayConfig{
+			Network:   "udp",
+			Address:   "198.51.100.1",
+			Port:      1000,
+			Component: 1,
+		})
+		require.NoError(t, err)
+		relay, err := NewCandidateRelay(&CandidateRelayConfig{
+			Network:   "udp",
+			Address:   "203.0.113.1",
+			Port:      1000,
+			Component: 1,
+		})
+		require.NoError(t, err)
+		require.NoError(t, a.AddRemoteCandidates([]Candidate{host, foreignRelay, relay}))
+
+		var remote []Candidate
+		assert.Eventually(t, func() bool {
+			require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+				remote = append([]Candidate(nil), agent.remoteCandidates[NetworkTypeUDP4]...)
+			}))
+			return len(remote) != 0
+		}, time.Second, 10*time.Millisecond)
+		require.Len(t, remote, 1)
+		assert.True(t, remote[0].Equal(relay))
+	})
+
+	t.Run("Peer Reflexive", func(t *testing.T) {
+		runAgentTest(t, config, func(ctx context.Context, a *Agent) {
+			a.selector = &controllingSelector{agent: a, log: a.log}
+
+			local := newInboundLocal(t, nil)
+
+			msg, err := stun.Build(stun.BindingRequest, stun.TransactionID,
+				stun.NewUsername(a.localUfrag+":"+a.remoteUfrag),
+				UseCandidate(),
+				AttrControlling(a.tieBreaker),
+				PriorityAttr(local.Priority()),
+				stun.NewShortTermIntegrity(a.localPwd),
+				stun.Fingerprint,
+			)
+			require.NoError(t, err)
+			a.handleInbound(msg, local, &net.UDPAddr{IP: net.ParseIP("203.0.113.3"), Port: 999})
+
+			assert.Empty(t, a.remoteCandidates[NetworkTypeUDP4])
+			assert.Zero(t, a.prflxLearned)
+		})
+	})
+}
+
+func TestPeerReflexiveLimits(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	// Sends binding requests from three addresses, returns the number of prflx candidates learned
+	learn := func(t *testing.T, a *Agent) int {
+		a.selector = &controllingSelector{agent: a, log: a.log}
+
+		local := newInboundLocal(t, nil)
+
+		for port := 1000; port < 1003; port++ {
+			msg, err := stun.Build(stun.BindingRequest, stun.TransactionID,
+				stun.NewUsername(a.localUfrag+":"+a.remoteUfrag),
+				AttrControlling(a.tieBreaker),
+				PriorityAttr(local.Priority()),
+				stun.NewShortTermIntegrity(a.localPwd),
+				stun.Fingerprint,
+			)
+			require.NoError(t, err)
+
+			a.handleInbound(msg, local, &net.UDPAddr{IP: net.ParseIP("172.17.0.3"), Port: port})
+		}
+		return len(a.remoteCandidates[NetworkTypeUDP4])
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		runAgentTest(t, &AgentConfig{DisablePeerReflexiveCandidates: true}, func(ctx context.Context, a *Agent) {
+			assert.Equal(t, 0, learn(t, a))
+		})
+	})
+
+	t.Run("Limit", func(t *testing.T) {
+		logger := &recordingLogger{}
+		runAgentTest(t, &AgentConfig{MaxPeerReflexiveCandidates: 2, StructuredLogger: logger}, func(ctx context.Context, a *Agent) {
+			assert.Equal(t, 2, learn(t, a))
+		})
+		assert.Len(t, logger.find("peer-reflexive candidate limit reached"), 1)
+	})
+
+	t.Run("Unlimited", func(t *testing.T) {
+		runAgentTest(t, &AgentConfig{}, func(ctx context.Context, a *Agent) {
+			assert.Equal(t, 3, learn(t, a))
+		})
+	})
+}
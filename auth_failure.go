@@ -0,0 +1,81 @@
+package ice
+
+import (
+	"net"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun"
+)
+
+// AuthenticationFailureKind tells which check an inbound STUN message failed.
+type AuthenticationFailureKind int
+
+const (
+	// AuthenticationFailureUsername is a binding request with a missing
+	// USERNAME or one not made of the local and remote ufrags.
+	AuthenticationFailureUsername AuthenticationFailureKind = iota + 1
+
+	// AuthenticationFailureMessageIntegrity is a message with a missing or
+	// invalid MESSAGE-INTEGRITY, signed with another password.
+	AuthenticationFailureMessageIntegrity
+)
+
+func (k AuthenticationFailureKind) String() string {
+	switch k {
+	case AuthenticationFailureUsername:
+		return "username"
+	case AuthenticationFailureMessageIntegrity:
+		return "message-integrity"
+	default:
+		return ErrUnknownType.Error()
+	}
+}
+
+// AuthenticationFailure describes an inbound STUN message discarded because
+// it failed authentication.
+type AuthenticationFailure struct {
+	Kind  AuthenticationFailureKind
+	Class stun.MessageClass
+
+	// Username is the USERNAME of the message, empty if it has none
+	Username string
+
+	LocalAddr  net.Addr
+	RemoteAddr net.Addr
+	Err        error
+}
+
+// OnAuthenticationFailure sets a handler that is fired for every inbound STUN
+// message failing USERNAME or MESSAGE-INTEGRITY validation, e.g. to detect
+// brute forcing or misconfigured peers. Like the other handlers, it is
+// called in order on a goroutine of its own, see AgentConfig.HandlerQueueSize.
+func (a *Agent) OnAuthenticationFailure(f func(AuthenticationFailure)) error {
+	a.onAuthenticationFailureHdlr.Store(f)
+	return nil
+}
+
+// reportAuthenticationFailure logs a message failing authentication and
+// queues it for the OnAuthenticationFailure handler.
+func (a *Agent) reportAuthenticationFailure(kind AuthenticationFailureKind, m *stun.Message, local Candidate, remote net.Addr, err error) {
+	a.log.Warnf("discard message from (%s), %v", remote, err)
+	a.logEvent(logging.LogLevelWarn, "discarded inbound STUN message", "remote", remote.String(), "local", local.String(), "error", err, "failure", kind.String())
+
+	hdlr, ok := a.onAuthenticationFailureHdlr.Load().(func(AuthenticationFailure))
+	if !ok || hdlr == nil {
+		return
+	}
+
+	var username stun.Username
+	_ = username.GetFrom(m)
+	failure := AuthenticationFailure{
+		Kind:       kind,
+		Class:      m.Type.Class,
+		Username:   string(username),
+		LocalAddr:  local.addr(),
+		RemoteAddr: remote,
+		Err:        err,
+	}
+	a.authFailureHandlers.push(func() {
+		hdlr(failure)
+	})
+}
@@ -0,0 +1,74 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pion/stun"
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnAuthenticationFailure(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	a, err := NewAgent(&AgentConfig{})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	failed := make(chan AuthenticationFailure, 3)
+	require.NoError(t, a.OnAuthenticationFailure(func(f AuthenticationFailure) {
+		// The handler is not called from the task loop, it may use the agent
+		_, err := a.GetLocalCandidates()
+		assert.NoError(t, err)
+		failed <- f
+	}))
+
+	local := newInboundLocal(t, nil)
+	remote := inboundRemoteAddr()
+
+	require.NoError(t, a.run(context.Background(), func(ctx context.Context, a *Agent) {
+		request := func(username, pwd string) *stun.Message {
+			msg, err := stun.Build(stun.BindingRequest, stun.TransactionID,
+				stun.NewUsername(username),
+				AttrControlling(a.tieBreaker),
+				PriorityAttr(local.Priority()),
+				stun.NewShortTermIntegrity(pwd),
+				stun.Fingerprint,
+			)
+			require.NoError(t, err)
+			return msg
+		}
+
+		a.handleInbound(request("wrong:ufrag", a.localPwd), local, remote)
+		a.handleInbound(request(a.localUfrag+":"+a.remoteUfrag, "wrongpassword"), local, remote)
+
+		response, err := stun.Build(stun.BindingSuccess, stun.TransactionID,
+			stun.NewShortTermIntegrity("wrongpassword"),
+			stun.Fingerprint,
+		)
+		require.NoError(t, err)
+		a.handleInbound(response, local, remote)
+		assert.Empty(t, a.remoteCandidates)
+	}))
+
+	failures := []AuthenticationFailure{<-failed, <-failed, <-failed}
+	assert.Equal(t, AuthenticationFailureUsername, failures[0].Kind)
+	assert.Equal(t, "wrong:ufrag", failures[0].Username)
+	assert.Equal(t, stun.ClassRequest, failures[0].Class)
+	assert.Equal(t, AuthenticationFailureMessageIntegrity, failures[1].Kind)
+	assert.Equal(t, AuthenticationFailureMessageIntegrity, failures[2].Kind)
+	assert.Equal(t, stun.ClassSuccessResponse, failures[2].Class)
+	for _, f := range failures {
+		assert.Equal(t, remote, f.RemoteAddr)
+		assert.Equal(t, local.addr(), f.LocalAddr)
+		assert.Error(t, f.Err)
+	}
+}
@@ -0,0 +1,167 @@
+package ice
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// udpBatchSize is the max number of packets read or written per system call
+const udpBatchSize = 16
+
+// batchWriterMaxPending is the max number of packets queued behind the
+// flushing writer, more are dropped as if the socket buffer was full.
+const batchWriterMaxPending = 16 * udpBatchSize
+
+// batchPacket is one packet of a batched read or write, n is the number of
+// bytes read into buf. When GRO coalesced several packets into buf,
+// segmentSize is the size of each of them (the last one may be shorter).
+type batchPacket struct {
+	buf         []byte
+	n           int
+	addr        net.Addr
+	segmentSize int
+
+	// holder is the pooled buffer behind buf, for queued writes
+	holder *bufferHolder
+}
+
+// segments splits a received packet coalesced by GRO
+func (p *batchPacket) segments(f func([]byte)) {
+	b := p.buf[:p.n]
+	if p.segmentSize <= 0 {
+		f(b)
+		return
+	}
+	for len(b) > p.segmentSize {
+		f(b[:p.segmentSize])
+		b = b[p.segmentSize:]
+	}
+	f(b)
+}
+
+// packetBatchConn reads and writes several packets per system call
+// (recvmmsg/sendmmsg), see newPacketBatchConn.
+type packetBatchConn interface {
+	// ReadBufferSize is the size of the buffers passed to ReadBatch
+	ReadBufferSize() int
+	ReadBatch(packets []batchPacket) (int, error)
+	WriteBatch(packets []batchPacket) (int, error)
+}
+
+// batchWriter coalesces concurrent writes. The first writer sends its packet
+// along with every packet queued while it is in the system call, other
+// writers only queue theirs, so a lone writer is never delayed. Once the
+// socket is closed, queued and later packets are dropped.
+type batchWriter struct {
+	conn    packetBatchConn
+	onError func(error)
+
+	mu       sync.Mutex
+	pending  []batchPacket
+	spare    []batchPacket
+	flushing bool
+	closed   bool
+}
+
+func newBatchWriter(conn packetBatchConn, onError func(error)) *batchWriter {
+	return &batchWriter{conn: conn, onError: onError}
+}
+
+func (w *batchWriter) writeTo(p []byte, addr net.Addr) {
+	// The packet may be sent after writeTo returns
+	holder := getPacketBuffer(p)
+
+	w.mu.Lock()
+	if w.closed || len(w.pending) >= batchWriterMaxPending {
+		w.mu.Unlock()
+		putPacketBuffer(holder)
+		return
+	}
+	w.pending = append(w.pending, batchPacket{buf: holder.buffer, n: len(p), addr: addr, holder: holder})
+	if w.flushing {
+		w.mu.Unlock()
+		return
+	}
+	w.flushing = true
+
+	for len(w.pending) > 0 {
+		packets := w.pending
+		w.pending = w.spare[:0]
+		w.mu.Unlock()
+
+		closed := w.flush(packets)
+		for i := range packets {
+			putPacketBuffer(packets[i].holder)
+			packets[i] = batchPacket{}
+		}
+
+		w.mu.Lock()
+		w.spare = packets
+		if closed {
+			w.closed = true
+			for i := range w.pending {
+				putPacketBuffer(w.pending[i].holder)
+				w.pending[i] = batchPacket{}
+			}
+			w.pending = w.pending[:0]
+		}
+	}
+	w.flushing = false
+	w.mu.Unlock()
+}
+
+// flush writes packets and reports whether the socket is closed, in which
+// case the packets left are dropped.
+func (w *batchWriter) flush(packets []batchPacket) bool {
+	for len(packets) > 0 {
+		batch := packets
+		if len(batch) > udpBatchSize {
+			batch = batch[:udpBatchSize]
+		}
+
+		n, err := w.conn.WriteBatch(batch)
+		if err != nil {
+			w.onError(err)
+			if errors.Is(err, net.ErrClosed) {
+				return true
+			}
+			// The packet at n failed, drop it and carry on with the rest
+			n++
+		} else if n == 0 {
+			n = len(batch)
+		}
+		packets = packets[n:]
+	}
+	return false
+}
+
+// recvBatchLoop is recvLoop for sockets that support batched reads.
+func (c *candidateBase) recvBatchLoop() {
+	log := c.agent().log
+	packets := make([]batchPacket, udpBatchSize)
+	size := c.batch.ReadBufferSize()
+	if size <= c.agent().maxPacketSize {
+		size = c.agent().maxPacketSize + 1
+	}
+	for i := range packets {
+		packets[i].buf = make([]byte, size)
+	}
+
+	for {
+		n, err := c.batch.ReadBatch(packets)
+		if err != nil {
+			if c.drainICMPErrors(err) {
+				continue
+			}
+			return
+		}
+
+		for i := range packets[:n] {
+			p := &packets[i]
+			p.segments(func(buf []byte) {
+				handleInboundCandidateMsg(c, c.self, buf, p.addr, log)
+			})
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package ice
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// UDP segmentation offload socket options (at level SOL_UDP, which is
+// IPPROTO_UDP) and limits, see udp(7)
+const (
+	udpSegment = 103 // UDP_SEGMENT
+	udpGRO     = 104 // UDP_GRO
+
+	udpMaxSegments    = 64
+	udpMaxOffloadSize = 65000
+)
+
+// linuxBatchConn uses recvmmsg and sendmmsg through golang.org/x/net, an
+// ipv6.Message is the same type as an ipv4.Message.
+type linuxBatchConn struct {
+	readBatch  func([]ipv4.Message, int) (int, error)
+	writeBatch func([]ipv4.Message, int) (int, error)
+
+	// Reads happen on the recvLoop, writes are serialized by batchWriter
+	readMsgs  []ipv4.Message
+	writeMsgs []ipv4.Message
+
+	// gso and gro are set when the socket accepted UDP_SEGMENT and UDP_GRO.
+	// gso is turned off again if the device can't offload checksums.
+	gso bool
+	gro bool
+
+	// writeSegments holds the number of packets coalesced into each of
+	// writeMsgs, writeScratch their buffers.
+	writeSegments []int
+	writeScratch  [][]byte
+}
+
+// newPacketBatchConn returns a packetBatchConn for UDP sockets, nil for
+// any other connection (muxed, relayed or captured) which is then read
+// and written one packet at a time. If offload is set, UDP GSO and GRO are
+// enabled on kernels that support them.
+func newPacketBatchConn(conn net.PacketConn, offload bool) packetBatchConn {
+	udpConn, ok := conn.(*net.UDPConn)
+	if !ok {
+		return nil
+	}
+
+	c := &linuxBatchConn{
+		readMsgs:  make([]ipv4.Message, udpBatchSize),
+		writeMsgs: make([]ipv4.Message, udpBatchSize),
+	}
+	for i := range c.readMsgs {
+		c.readMsgs[i].Buffers = make([][]byte, 1)
+		c.writeMsgs[i].Buffers = make([][]byte, 1)
+	}
+
+	if addr, ok := udpConn.LocalAddr().(*net.UDPAddr); ok && addr.IP.To4() == nil {
+		p := ipv6.NewPacketConn(udpConn)
+		c.readBatch, c.writeBatch = p.ReadBatch, p.WriteBatch
+	} else {
+		p := ipv4.NewPacketConn(udpConn)
+		c.readBatch, c.writeBatch = p.ReadBatch, p.WriteBatch
+	}
+
+	if offload {
+		c.gso, c.gro = enableUDPOffload(udpConn)
+	}
+	if c.gro {
+		for i := range c.readMsgs {
+			c.readMsgs[i].OOB = make([]byte, syscall.CmsgSpace(4))
+		}
+	}
+	if c.gso {
+		c.writeSegments = make([]int, udpBatchSize)
+		c.writeScratch = make([][]byte, udpBatchSize)
+		for i := range c.writeMsgs {
+			c.writeMsgs[i].OOB = make([]byte, syscall.CmsgSpace(2))
+		}
+	}
+	return c
+}
+
+// enableUDPOffload probes UDP_SEGMENT and turns on UDP_GRO for conn.
+func enableUDPOffload(conn *net.UDPConn) (gso, gro bool) {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return false, false
+	}
+
+	_ = rc.Control(func(fd uintptr) {
+		_, err := syscall.GetsockoptInt(int(fd), syscall.IPPROTO_UDP, udpSegment)
+		gso = err == nil
+		gro = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_UDP, udpGRO, 1) == nil
+	})
+	return gso, gro
+}
+
+func (c *linuxBatchConn) ReadBufferSize() int {
+	if c.gro {
+		return udpMaxOffloadSize + receiveMTU
+	}
+	return receiveMTU
+}
+
+func (c *linuxBatchConn) ReadBatch(packets []batchPacket) (int, error) {
+	msgs := c.readMsgs[:len(packets)]
+	for i := range packets {
+		msgs[i].Buffers[0] = packets[i].buf
+	}
+
+	n, err := c.readBatch(msgs, 0)
+	for i := 0; i < n; i++ {
+		packets[i].n = msgs[i].N
+		packets[i].addr = msgs[i].Addr
+		packets[i].segmentSize = 0
+		if c.gro {
+			packets[i].segmentSize = groSegmentSize(msgs[i].OOB[:msgs[i].NN])
+		}
+	}
+	return n, err
+}
+
+func (c *linuxBatchConn) WriteBatch(packets []batchPacket) (int, error) {
+	if !c.gso {
+		return c.writePackets(packets)
+	}
+
+	n, gsoFailed, err := c.writeSegmented(packets)
+	if !gsoFailed {
+		return n, err
+	}
+
+	// The device can't checksum segmented packets, stop using GSO on
+	// this socket and send the rest one by one
+	c.gso = false
+	rest, err := c.writePackets(packets[n:])
+	return n + rest, err
+}
+
+func (c *linuxBatchConn) writePackets(packets []batchPacket) (int, error) {
+	msgs := c.writeMsgs[:len(packets)]
+	for i := range packets {
+		msgs[i].Buffers[0] = packets[i].buf[:packets[i].n]
+		msgs[i].Addr = packets[i].addr
+		msgs[i].OOB = msgs[i].OOB[:0]
+	}
+
+	n, err := c.writeBatch(msgs, 0)
+	c.resetWriteMsgs()
+	return n, err
+}
+
+// writeSegmented coalesces runs of packets with the same destination and
+// size into a single message sent with UDP_SEGMENT. The last packet of a run
+// may be shorter, as allowed by the kernel. gsoFailed is set if a coalesced
+// message was rejected with EIO, n is then the number of packets sent before it.
+func (c *linuxBatchConn) writeSegmented(packets []batchPacket) (n int, gsoFailed bool, err error) {
+	msgCount := 0
+	for i := 0; i < len(packets); msgCount++ {
+		first := packets[i]
+		buf := append(c.writeScratch[msgCount][:0], first.buf[:first.n]...)
+		segments := 1
+		for i++; i < len(packets) && segments < udpMaxSegments; i++ {
+			p := packets[i]
+			if p.n > first.n || len(buf)+p.n > udpMaxOffloadSize || !addrEqual(p.addr, first.addr) {
+				break
+			}
+			buf = append(buf, p.buf[:p.n]...)
+			segments++
+			if p.n < first.n {
+				i++
+				break
+			}
+		}
+
+		msg := &c.writeMsgs[msgCount]
+		c.writeScratch[msgCount] = buf
+		c.writeSegments[msgCount] = segments
+		msg.Buffers[0] = buf
+		msg.Addr = first.addr
+		msg.OOB = msg.OOB[:0]
+		if segments > 1 {
+			msg.OOB = putUDPSegmentCmsg(msg.OOB[:cap(msg.OOB)], uint16(first.n))
+		}
+	}
+
+	sent, err := c.writeBatch(c.writeMsgs[:msgCount], 0)
+	c.resetWriteMsgs()
+
+	for _, segments := range c.writeSegments[:sent] {
+		n += segments
+	}
+	if err == nil || sent >= msgCount {
+		return n, false, err
+	}
+	if c.writeSegments[sent] > 1 && errors.Is(err, syscall.EIO) {
+		return n, true, err
+	}
+
+	// Report the failure on the last packet of the message, so the caller
+	// drops all of its packets
+	return n + c.writeSegments[sent] - 1, false, err
+}
+
+func (c *linuxBatchConn) resetWriteMsgs() {
+	for i := range c.writeMsgs {
+		c.writeMsgs[i].Buffers[0] = nil
+		c.writeMsgs[i].Addr = nil
+	}
+}
+
+// putUDPSegmentCmsg writes an UDP_SEGMENT control message to b
+func putUDPSegmentCmsg(b []byte, segmentSize uint16) []byte {
+	b = b[:syscall.CmsgSpace(2)]
+	h := (*syscall.Cmsghdr)(unsafe.Pointer(&b[0])) //nolint:gosec
+	h.Level = syscall.IPPROTO_UDP
+	h.Type = udpSegment
+	h.SetLen(syscall.CmsgLen(2))
+	*(*uint16)(unsafe.Pointer(&b[syscall.CmsgLen(0)])) = segmentSize //nolint:gosec
+	return b
+}
+
+// groSegmentSize returns the size of the segments coalesced by GRO, zero if
+// the packet was not coalesced.
+func groSegmentSize(oob []byte) int {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0
+	}
+	for _, m := range msgs {
+		if m.Header.Level == syscall.IPPROTO_UDP && m.Header.Type == udpGRO && len(m.Data) >= 4 {
+			return int(*(*int32)(unsafe.Pointer(&m.Data[0]))) //nolint:gosec
+		}
+	}
+	return 0
+}
@@ -0,0 +1,101 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacketBatchConn(t *testing.T) {
+	for _, network := range []string{"udp4", "udp6"} {
+		for _, offload := range []bool{false, true} {
+			network, offload := network, offload
+			t.Run(fmt.Sprintf("%s offload %t", network, offload), func(t *testing.T) {
+				testPacketBatchConn(t, network, offload)
+			})
+		}
+	}
+}
+
+func testPacketBatchConn(t *testing.T, network string, offload bool) {
+	ip := net.IP{127, 0, 0, 1}
+	if network == "udp6" {
+		ip = net.IPv6loopback
+	}
+
+	a, err := net.ListenUDP(network, &net.UDPAddr{IP: ip})
+	if network == "udp6" && err != nil {
+		t.Skip("IPv6 is not supported")
+	}
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, a.Close()) }()
+
+	b, err := net.ListenUDP(network, &net.UDPAddr{IP: ip})
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, b.Close()) }()
+
+	assert.Nil(t, newPacketBatchConn(&captureConn{PacketConn: a}, offload))
+
+	aBatch, bBatch := newPacketBatchConn(a, offload), newPacketBatchConn(b, offload)
+	require.NotNil(t, aBatch)
+	require.NotNil(t, bBatch)
+
+	// Equally sized packets, so they can be coalesced when offload is enabled
+	const packetCount = 100
+	const packetSize = 100
+	var writeErrors []error
+	w := newBatchWriter(aBatch, func(err error) { writeErrors = append(writeErrors, err) })
+
+	var wg sync.WaitGroup
+	for i := 0; i < packetCount; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			packet := make([]byte, packetSize)
+			packet[0] = byte(i)
+			w.writeTo(packet, b.LocalAddr())
+		}(i)
+	}
+	wg.Wait()
+	assert.Empty(t, writeErrors)
+
+	require.NoError(t, b.SetReadDeadline(time.Now().Add(5*time.Second)))
+	packets := make([]batchPacket, udpBatchSize)
+	for i := range packets {
+		packets[i].buf = make([]byte, bBatch.ReadBufferSize())
+	}
+
+	seen := map[byte]bool{}
+	for len(seen) < packetCount {
+		n, err := bBatch.ReadBatch(packets)
+		require.NoError(t, err)
+		for i := range packets[:n] {
+			assert.Equal(t, a.LocalAddr().String(), packets[i].addr.String())
+			packets[i].segments(func(buf []byte) {
+				assert.Len(t, buf, packetSize)
+				seen[buf[0]] = true
+			})
+		}
+	}
+}
+
+func TestBatchPacketSegments(t *testing.T) {
+	p := batchPacket{buf: []byte{1, 1, 2, 2, 3, 0}, n: 5, segmentSize: 2}
+
+	var segments [][]byte
+	p.segments(func(b []byte) { segments = append(segments, b) })
+	assert.Equal(t, [][]byte{{1, 1}, {2, 2}, {3}}, segments)
+
+	segments = nil
+	p.segmentSize = 0
+	p.segments(func(b []byte) { segments = append(segments, b) })
+	assert.Equal(t, [][]byte{{1, 1, 2, 2, 3}}, segments)
+}
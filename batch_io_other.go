@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package ice
+
+import "net"
+
+// Batched reads and writes (and UDP segmentation offload) are only used on
+// Linux, elsewhere golang.org/x/net would fall back to one packet per system
+// call anyway
+
+func newPacketBatchConn(net.PacketConn, bool) packetBatchConn {
+	return nil
+}
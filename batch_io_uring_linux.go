@@ -0,0 +1,458 @@
+//go:build linux && iouring
+// +build linux,iouring
+
+package ice
+
+import (
+	"errors"
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+const ioUringBuiltIn = true
+
+// io_uring system calls and ABI, see io_uring_setup(2) and io_uring_enter(2).
+// The system call numbers are the same on every architecture.
+const (
+	sysIOUringSetup = 425
+	sysIOUringEnter = 426
+
+	ioringOpSendmsg = 9
+	ioringOpRecvmsg = 10
+
+	ioringEnterGetevents = 1
+
+	iosqeIOLink = 1 << 2
+
+	ioringOffSQRing = 0
+	ioringOffCQRing = 0x8000000
+	ioringOffSQEs   = 0x10000000
+)
+
+type ioSQRingOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	userAddr                                                       uint64
+}
+
+type ioCQRingOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type ioUringParams struct {
+	sqEntries, cqEntries, flags, sqThreadCPU, sqThreadIdle, features, wqFd uint32
+	resv                                                                   [3]uint32
+	sqOff                                                                  ioSQRingOffsets
+	cqOff                                                                  ioCQRingOffsets
+}
+
+type ioUringSQE struct {
+	opcode      uint8
+	flags       uint8
+	ioprio      uint16
+	fd          int32
+	off         uint64
+	addr        uint64
+	len         uint32
+	msgFlags    uint32
+	userData    uint64
+	bufIndex    uint16
+	personality uint16
+	spliceFdIn  int32
+	pad         [2]uint64
+}
+
+type ioUringCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// ioUring is an io_uring of udpBatchSize entries, used by one goroutine at
+// a time. Every batch submitted is waited for before the next one.
+type ioUring struct {
+	fd     int
+	sqRing []byte
+	cqRing []byte
+	sqeMem []byte
+
+	sqTail  *uint32
+	sqMask  uint32
+	sqArray []uint32
+	sqes    []ioUringSQE
+
+	cqHead *uint32
+	cqTail *uint32
+	cqMask uint32
+	cqes   []ioUringCQE
+
+	// res holds the result of each entry of the last batch
+	res [udpBatchSize]int32
+}
+
+func newIOUring() (*ioUring, error) {
+	var params ioUringParams
+	fd, _, errno := syscall.Syscall(sysIOUringSetup, udpBatchSize, uintptr(unsafe.Pointer(&params)), 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	r := &ioUring{fd: int(fd)}
+
+	var err error
+	sqSize := int(params.sqOff.array) + int(params.sqEntries)*4
+	cqSize := int(params.cqOff.cqes) + int(params.cqEntries)*int(unsafe.Sizeof(ioUringCQE{}))
+	sqeSize := int(params.sqEntries) * int(unsafe.Sizeof(ioUringSQE{}))
+	if r.sqRing, err = mmapRing(r.fd, ioringOffSQRing, sqSize); err != nil {
+		r.close()
+		return nil, err
+	}
+	if r.cqRing, err = mmapRing(r.fd, ioringOffCQRing, cqSize); err != nil {
+		r.close()
+		return nil, err
+	}
+	if r.sqeMem, err = mmapRing(r.fd, ioringOffSQEs, sqeSize); err != nil {
+		r.close()
+		return nil, err
+	}
+
+	r.sqTail = (*uint32)(unsafe.Pointer(&r.sqRing[params.sqOff.tail]))
+	r.sqMask = *(*uint32)(unsafe.Pointer(&r.sqRing[params.sqOff.ringMask]))
+	r.sqArray = (*[1 << 16]uint32)(unsafe.Pointer(&r.sqRing[params.sqOff.array]))[:params.sqEntries:params.sqEntries]
+	r.sqes = (*[1 << 16]ioUringSQE)(unsafe.Pointer(&r.sqeMem[0]))[:params.sqEntries:params.sqEntries]
+
+	r.cqHead = (*uint32)(unsafe.Pointer(&r.cqRing[params.cqOff.head]))
+	r.cqTail = (*uint32)(unsafe.Pointer(&r.cqRing[params.cqOff.tail]))
+	r.cqMask = *(*uint32)(unsafe.Pointer(&r.cqRing[params.cqOff.ringMask]))
+	r.cqes = (*[1 << 16]ioUringCQE)(unsafe.Pointer(&r.cqRing[params.cqOff.cqes]))[:params.cqEntries:params.cqEntries]
+	return r, nil
+}
+
+func mmapRing(fd int, offset int64, size int) ([]byte, error) {
+	return syscall.Mmap(fd, offset, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_POPULATE)
+}
+
+func (r *ioUring) close() {
+	for _, mem := range [][]byte{r.sqeMem, r.cqRing, r.sqRing} {
+		if mem != nil {
+			_ = syscall.Munmap(mem)
+		}
+	}
+	_ = syscall.Close(r.fd)
+}
+
+// run submits n entries prepared by prepare, and waits for their results
+// in r.res. It only returns once every entry submitted completed, as they
+// refer to the buffers of the caller. If io_uring_enter fails, the entries
+// not submitted yet are withdrawn with the error as result, and the error is
+// returned along with the results of the others.
+func (r *ioUring) run(n int, prepare func(i int, sqe *ioUringSQE)) error {
+	tail := atomic.LoadUint32(r.sqTail)
+	for i := 0; i < n; i++ {
+		index := (tail + uint32(i)) & r.sqMask
+		sqe := &r.sqes[index]
+		*sqe = ioUringSQE{}
+		prepare(i, sqe)
+		sqe.userData = uint64(i)
+		r.sqArray[index] = index
+	}
+	atomic.StoreUint32(r.sqTail, tail+uint32(n))
+
+	var enterErr syscall.Errno
+	submitted, completed := 0, 0
+	for completed < submitted || (submitted < n && enterErr == 0) {
+		toSubmit := 0
+		if enterErr == 0 {
+			toSubmit = n - submitted
+		}
+		ret, _, errno := syscall.Syscall6(sysIOUringEnter, uintptr(r.fd), uintptr(toSubmit), uintptr(submitted+toSubmit-completed), ioringEnterGetevents, 0, 0)
+		switch {
+		case errno == 0:
+			submitted += int(ret)
+		case errno == syscall.EINTR || errno == syscall.EAGAIN || errno == syscall.EBUSY:
+		case toSubmit == 0:
+			// Waiting fails too, the ring is unusable
+			return errno
+		default:
+			enterErr = errno
+		}
+
+		head := atomic.LoadUint32(r.cqHead)
+		for ; head != atomic.LoadUint32(r.cqTail); head++ {
+			cqe := &r.cqes[head&r.cqMask]
+			r.res[cqe.userData] = cqe.res
+			completed++
+		}
+		atomic.StoreUint32(r.cqHead, head)
+	}
+
+	if enterErr == 0 {
+		return nil
+	}
+	// The kernel consumed the entries up to submitted only
+	atomic.StoreUint32(r.sqTail, tail+uint32(submitted))
+	for i := submitted; i < n; i++ {
+		r.res[i] = -int32(enterErr)
+	}
+	return enterErr
+}
+
+// ioUringBatchConn reads and writes a UDP socket through two io_urings,
+// reads happen on the recvLoop and writes are serialized by batchWriter.
+// The socket stays non-blocking: a batch is only submitted once the Go
+// poller finds it readable or writable, with MSG_DONTWAIT, so that closing
+// the socket or its deadlines interrupt the waits as usual. The rings are
+// closed by Close, once the socket is closed.
+type ioUringBatchConn struct {
+	rc   syscall.RawConn
+	ipv6 bool
+
+	// mu is held for reading by the batches in progress, Close waits for
+	// them to return
+	mu     sync.RWMutex
+	closed bool
+
+	read      *ioUring
+	readHdrs  [udpBatchSize]syscall.Msghdr
+	readIovs  [udpBatchSize]syscall.Iovec
+	readNames [udpBatchSize]syscall.RawSockaddrAny
+
+	write      *ioUring
+	writeHdrs  [udpBatchSize]syscall.Msghdr
+	writeIovs  [udpBatchSize]syscall.Iovec
+	writeNames [udpBatchSize]syscall.RawSockaddrAny
+}
+
+func newIOUringBatchConn(conn net.PacketConn) (packetBatchConn, error) {
+	udpConn, ok := conn.(*net.UDPConn)
+	if !ok {
+		return nil, errIOUringUnavailable
+	}
+	rc, err := udpConn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &ioUringBatchConn{rc: rc}
+	if addr, ok := udpConn.LocalAddr().(*net.UDPAddr); ok && addr.IP.To4() == nil {
+		c.ipv6 = true
+	}
+	if c.read, err = newIOUring(); err != nil {
+		return nil, err
+	}
+	if c.write, err = newIOUring(); err != nil {
+		c.read.close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close closes the rings, the socket must be closed first so that the
+// batches waiting for it return.
+func (c *ioUringBatchConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		c.read.close()
+		c.write.close()
+	}
+	return nil
+}
+
+func (c *ioUringBatchConn) ReadBufferSize() int {
+	return receiveMTU
+}
+
+func (c *ioUringBatchConn) ReadBatch(packets []batchPacket) (int, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+
+	var n int
+	var batchErr error
+	if err := c.rc.Read(func(fd uintptr) bool {
+		n, batchErr = c.readBatch(int32(fd), packets)
+		return !errors.Is(batchErr, syscall.EAGAIN)
+	}); err != nil {
+		return 0, err
+	}
+	return n, batchErr
+}
+
+func (c *ioUringBatchConn) readBatch(fd int32, packets []batchPacket) (int, error) {
+	for i := range packets {
+		c.readIovs[i].Base = &packets[i].buf[0]
+		c.readIovs[i].SetLen(len(packets[i].buf))
+		c.readHdrs[i] = syscall.Msghdr{
+			Name:    (*byte)(unsafe.Pointer(&c.readNames[i])),
+			Namelen: syscall.SizeofSockaddrAny,
+			Iov:     &c.readIovs[i],
+			Iovlen:  1,
+		}
+	}
+	err := c.read.run(len(packets), func(i int, sqe *ioUringSQE) {
+		sqe.opcode = ioringOpRecvmsg
+		sqe.fd = fd
+		sqe.addr = uint64(uintptr(unsafe.Pointer(&c.readHdrs[i])))
+		sqe.len = 1
+		sqe.msgFlags = syscall.MSG_DONTWAIT
+	})
+	runtime.KeepAlive(packets)
+
+	// The entries are not linked, any of them may have failed with EAGAIN
+	// while a later one got a datagram: the packets received are moved to
+	// the front, in order.
+	n := 0
+	for i := range packets {
+		if c.read.res[i] < 0 {
+			continue
+		}
+		if i != n {
+			packets[n].buf, packets[i].buf = packets[i].buf, packets[n].buf
+		}
+		packets[n].n = int(c.read.res[i])
+		packets[n].addr = sockaddrToUDPAddr(&c.readNames[i])
+		packets[n].segmentSize = 0
+		n++
+	}
+	switch {
+	case n > 0:
+		return n, nil
+	case err != nil:
+		return 0, err
+	default:
+		return 0, syscall.Errno(-c.read.res[0])
+	}
+}
+
+func (c *ioUringBatchConn) WriteBatch(packets []batchPacket) (int, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+
+	var n int
+	var batchErr error
+	if err := c.rc.Write(func(fd uintptr) bool {
+		n, batchErr = c.writeBatch(int32(fd), packets)
+		return !errors.Is(batchErr, syscall.EAGAIN)
+	}); err != nil {
+		return 0, err
+	}
+	return n, batchErr
+}
+
+func (c *ioUringBatchConn) writeBatch(fd int32, packets []batchPacket) (int, error) {
+	for i := range packets {
+		namelen, err := putSockaddr(&c.writeNames[i], packets[i].addr, c.ipv6)
+		if err != nil {
+			// Report the failure on this packet, after the ones before it
+			if i == 0 {
+				return 0, err
+			}
+			packets = packets[:i]
+			break
+		}
+		c.writeIovs[i].Base = &packets[i].buf[0]
+		c.writeIovs[i].SetLen(packets[i].n)
+		c.writeHdrs[i] = syscall.Msghdr{
+			Name:    (*byte)(unsafe.Pointer(&c.writeNames[i])),
+			Namelen: namelen,
+			Iov:     &c.writeIovs[i],
+			Iovlen:  1,
+		}
+	}
+	// The entries are linked so that they are sent in order and the ones
+	// after a failure are canceled, not sent: the packets from the first
+	// failure on are left to the caller.
+	err := c.write.run(len(packets), func(i int, sqe *ioUringSQE) {
+		sqe.opcode = ioringOpSendmsg
+		sqe.fd = fd
+		sqe.addr = uint64(uintptr(unsafe.Pointer(&c.writeHdrs[i])))
+		sqe.len = 1
+		sqe.msgFlags = syscall.MSG_DONTWAIT
+		if i < len(packets)-1 {
+			sqe.flags = iosqeIOLink
+		}
+	})
+	runtime.KeepAlive(packets)
+	for i := range c.writeIovs {
+		c.writeIovs[i].Base = nil
+	}
+
+	n := 0
+	for n < len(packets) && c.write.res[n] >= 0 {
+		n++
+	}
+	switch {
+	case n == len(packets):
+		return n, nil
+	case err != nil:
+		return n, err
+	case syscall.Errno(-c.write.res[n]) != syscall.EAGAIN:
+		return n, syscall.Errno(-c.write.res[n])
+	case n > 0:
+		// The socket buffer is full, the rest waits for the next batch
+		return n, nil
+	default:
+		return 0, syscall.EAGAIN
+	}
+}
+
+func sockaddrToUDPAddr(rsa *syscall.RawSockaddrAny) *net.UDPAddr {
+	switch rsa.Addr.Family {
+	case syscall.AF_INET:
+		sa := (*syscall.RawSockaddrInet4)(unsafe.Pointer(rsa))
+		port := (*[2]byte)(unsafe.Pointer(&sa.Port))
+		ip := make(net.IP, net.IPv4len)
+		copy(ip, sa.Addr[:])
+		return &net.UDPAddr{IP: ip, Port: int(port[0])<<8 | int(port[1])}
+	case syscall.AF_INET6:
+		sa := (*syscall.RawSockaddrInet6)(unsafe.Pointer(rsa))
+		port := (*[2]byte)(unsafe.Pointer(&sa.Port))
+		ip := make(net.IP, net.IPv6len)
+		copy(ip, sa.Addr[:])
+		return &net.UDPAddr{IP: ip, Port: int(port[0])<<8 | int(port[1])}
+	}
+	return nil
+}
+
+// putSockaddr writes the address addr to rsa, for a socket of the family
+// ipv6, and returns its length.
+func putSockaddr(rsa *syscall.RawSockaddrAny, addr net.Addr, ipv6 bool) (uint32, error) {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, syscall.EAFNOSUPPORT
+	}
+
+	if !ipv6 {
+		ip := udpAddr.IP.To4()
+		if ip == nil {
+			return 0, syscall.EAFNOSUPPORT
+		}
+		sa := (*syscall.RawSockaddrInet4)(unsafe.Pointer(rsa))
+		*sa = syscall.RawSockaddrInet4{Family: syscall.AF_INET}
+		port := (*[2]byte)(unsafe.Pointer(&sa.Port))
+		port[0], port[1] = byte(udpAddr.Port>>8), byte(udpAddr.Port)
+		copy(sa.Addr[:], ip)
+		return syscall.SizeofSockaddrInet4, nil
+	}
+
+	ip := udpAddr.IP.To16()
+	if ip == nil {
+		return 0, syscall.EAFNOSUPPORT
+	}
+	sa := (*syscall.RawSockaddrInet6)(unsafe.Pointer(rsa))
+	*sa = syscall.RawSockaddrInet6{Family: syscall.AF_INET6}
+	port := (*[2]byte)(unsafe.Pointer(&sa.Port))
+	port[0], port[1] = byte(udpAddr.Port>>8), byte(udpAddr.Port)
+	copy(sa.Addr[:], ip)
+	return syscall.SizeofSockaddrInet6, nil
+}
@@ -0,0 +1,81 @@
+//go:build iouring && !js
+// +build iouring,!js
+
+package ice
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIOUringBatchConn(t *testing.T) {
+	for _, network := range []string{"udp4", "udp6"} {
+		network := network
+		t.Run(network, func(t *testing.T) {
+			ip := net.IP{127, 0, 0, 1}
+			if network == "udp6" {
+				ip = net.IPv6loopback
+			}
+
+			a, err := net.ListenUDP(network, &net.UDPAddr{IP: ip})
+			if network == "udp6" && err != nil {
+				t.Skip("IPv6 is not supported")
+			}
+			require.NoError(t, err)
+			defer func() { assert.NoError(t, a.Close()) }()
+
+			b, err := net.ListenUDP(network, &net.UDPAddr{IP: ip})
+			require.NoError(t, err)
+			defer func() { assert.NoError(t, b.Close()) }()
+
+			_, err = newIOUringBatchConn(&captureConn{PacketConn: a})
+			assert.ErrorIs(t, err, errIOUringUnavailable)
+
+			aBatch, err := newIOUringBatchConn(a)
+			if err != nil {
+				t.Skipf("io_uring is not available: %v", err)
+			}
+			bBatch, err := newIOUringBatchConn(b)
+			require.NoError(t, err)
+
+			const packetCount = udpBatchSize
+			packets := make([]batchPacket, packetCount)
+			for i := range packets {
+				packets[i].buf = []byte(fmt.Sprintf("packet %d", i))
+				packets[i].n = len(packets[i].buf)
+				packets[i].addr = b.LocalAddr()
+			}
+			for sent := 0; sent < packetCount; {
+				n, err := aBatch.WriteBatch(packets[sent:])
+				require.NoError(t, err)
+				sent += n
+			}
+
+			received := make([]batchPacket, udpBatchSize)
+			for i := range received {
+				received[i].buf = make([]byte, bBatch.ReadBufferSize())
+			}
+			for count := 0; count < packetCount; {
+				n, err := bBatch.ReadBatch(received)
+				require.NoError(t, err)
+				for _, p := range received[:n] {
+					assert.Equal(t, fmt.Sprintf("packet %d", count), string(p.buf[:p.n]))
+					assert.True(t, addrEqual(a.LocalAddr(), p.addr))
+					count++
+				}
+			}
+
+			assert.NoError(t, aBatch.(io.Closer).Close()) //nolint:forcetypeassert
+			_, err = aBatch.WriteBatch(packets)
+			assert.ErrorIs(t, err, net.ErrClosed)
+			assert.NoError(t, bBatch.(io.Closer).Close()) //nolint:forcetypeassert
+			_, err = bBatch.ReadBatch(received)
+			assert.ErrorIs(t, err, net.ErrClosed)
+		})
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux || !iouring
+// +build !linux !iouring
+
+package ice
+
+import "net"
+
+// The io_uring backend is only built on Linux with the iouring build tag
+const ioUringBuiltIn = false
+
+func newIOUringBatchConn(net.PacketConn) (packetBatchConn, error) {
+	return nil, errIOUringUnavailable
+}
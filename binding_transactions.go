@@ -0,0 +1,78 @@
+package ice
+
+import (
+	"net"
+
+	"github.com/pion/stun"
+)
+
+// maxAnsweredBindingRequests bounds the answered binding requests
+// remembered to tell duplicate responses apart.
+const maxAnsweredBindingRequests = 64
+
+// matchBindingResponse returns the pending binding request answered by m,
+// a response received on local from remoteAddr, the address of remote. The
+// request must have been sent from the socket of local to remoteAddr: a
+// response only validates the pair its request was sent on, the pair of the
+// local candidate of the request. The candidates sharing a socket, like the
+// host and server reflexive candidates of a UniversalUDPMux, can't tell
+// which of them a response was received on. It is removed once answered,
+// so a response is accepted once. The responses matching no pending request
+// are discarded and counted on the pair of local and remote, as duplicates
+// of a response already received, as answers to a request sent on another
+// pair, or as unmatched.
+// Note: the caller should hold the agent lock.
+func (a *Agent) matchBindingResponse(m *stun.Message, local, remote Candidate, remoteAddr net.Addr) (*bindingRequest, bool) {
+	a.invalidatePendingBindingRequests(a.clock.Now())
+	p := a.findPair(local, remote)
+
+	for i := range a.pendingBindingRequests {
+		req := a.pendingBindingRequests[i]
+		if req.transactionID != m.TransactionID {
+			continue
+		}
+
+		// Assert that NAT is not symmetric
+		// https://tools.ietf.org/html/rfc8445#section-7.2.5.2.1
+		if req.local == nil || !sameSocket(req.local, local) || !addrEqual(req.destination, remoteAddr) {
+			if p != nil {
+				p.mismatchedResponses++
+			}
+			a.log.Debugf("discard response from %s to %s: transaction sent from %s to %s", remoteAddr, local, req.local, req.destination)
+			return nil, false
+		}
+
+		a.pendingBindingRequests = append(a.pendingBindingRequests[:i], a.pendingBindingRequests[i+1:]...)
+		a.answeredBindingRequests = append(a.answeredBindingRequests, req)
+		if n := len(a.answeredBindingRequests); n > maxAnsweredBindingRequests {
+			a.answeredBindingRequests = append(a.answeredBindingRequests[:0], a.answeredBindingRequests[n-maxAnsweredBindingRequests:]...)
+		}
+		return &req, true
+	}
+
+	for _, req := range a.answeredBindingRequests {
+		if req.transactionID == m.TransactionID {
+			if p != nil {
+				p.duplicateResponses++
+			}
+			a.log.Debugf("discard duplicate response from %s to %s, TransactionID 0x%x", remoteAddr, local, m.TransactionID)
+			return nil, false
+		}
+	}
+
+	if p != nil {
+		p.unmatchedResponses++
+	}
+	a.log.Warnf("discard message from (%s), unknown TransactionID 0x%x", remote, m.TransactionID)
+	return nil, false
+}
+
+// sameSocket reports whether the local candidates a and b send and receive
+// on the same socket.
+func sameSocket(a, b Candidate) bool {
+	if a.Equal(b) {
+		return true
+	}
+	socket := candidateSocketID(a)
+	return socket != nil && socket == candidateSocketID(b)
+}
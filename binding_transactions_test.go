@@ -0,0 +1,169 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/stun"
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchBindingResponse(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	a, err := NewAgent(&AgentConfig{})
+	assert.NoError(t, err)
+
+	var localID string
+	assert.NoError(t, a.run(context.Background(), func(ctx context.Context, a *Agent) {
+		a.selector = &controllingSelector{agent: a, log: a.log}
+
+		newLocal := func(address string, conn net.PacketConn) *CandidateHost {
+			local, err := NewCandidateHost(&CandidateHostConfig{
+				Network:   "udp",
+				Address:   address,
+				Port:      777,
+				Component: 1,
+			})
+			assert.NoError(t, err)
+			local.conn = conn
+			return local
+		}
+		otherConn, err := net.ListenUDP(udp, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		assert.NoError(t, err)
+		defer func() {
+			assert.NoError(t, otherConn.Close())
+		}()
+		local, otherLocal := newInboundLocal(t, nil), newLocal("192.168.0.3", otherConn)
+		localID = local.ID()
+
+		remote := newInboundRemote(t)
+		remoteAddr := inboundRemoteAddr()
+
+		a.addRemoteCandidate(remote)
+		p := a.addPair(local, remote)
+		otherPair := a.addPair(otherLocal, remote)
+
+		msg, err := stun.Build(stun.BindingSuccess, stun.TransactionID,
+			&stun.XORMappedAddress{IP: net.ParseIP("192.168.0.2"), Port: 777},
+			stun.NewShortTermIntegrity(a.remotePwd),
+			stun.Fingerprint,
+		)
+		assert.NoError(t, err)
+		a.pendingBindingRequests = append(a.pendingBindingRequests, bindingRequest{
+			timestamp:     time.Now(),
+			transactionID: msg.TransactionID,
+			local:         local,
+			destination:   remote.addr(),
+		})
+
+		// A response received on another local candidate is not accepted,
+		// and leaves the transaction pending
+		a.handleInbound(msg, otherLocal, remoteAddr)
+		assert.NotEqual(t, CandidatePairState(CandidatePairStateSucceeded), otherPair.state)
+		assert.Equal(t, uint64(1), otherPair.mismatchedResponses)
+		assert.Equal(t, 1, len(a.pendingBindingRequests))
+
+		a.handleInbound(msg, local, remoteAddr)
+		assert.Equal(t, CandidatePairState(CandidatePairStateSucceeded), p.state)
+		assert.Equal(t, 0, len(a.pendingBindingRequests))
+
+		// The same response is only accepted once
+		a.handleInbound(msg, local, remoteAddr)
+		assert.Equal(t, uint64(1), p.duplicateResponses)
+
+		unknown, err := stun.Build(stun.BindingSuccess, stun.TransactionID,
+			stun.NewShortTermIntegrity(a.remotePwd),
+			stun.Fingerprint,
+		)
+		assert.NoError(t, err)
+		a.handleInbound(unknown, local, remoteAddr)
+		assert.Equal(t, uint64(1), p.unmatchedResponses)
+	}))
+
+	for _, stat := range a.GetCandidatePairsStats() {
+		if stat.LocalCandidateID == localID {
+			assert.Equal(t, uint64(1), stat.DuplicateResponsesReceived)
+			assert.Equal(t, uint64(1), stat.UnmatchedResponsesReceived)
+		} else {
+			assert.Equal(t, uint64(1), stat.MismatchedResponsesReceived)
+		}
+	}
+	assert.NoError(t, a.Close())
+}
+
+func TestMatchBindingResponseUniversalUDPMux(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	conn, err := net.ListenUDP(udp, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.NoError(t, err)
+	udpMux := NewUniversalUDPMuxDefault(UniversalUDPMuxParams{UDPConn: conn})
+	defer func() {
+		_ = udpMux.Close()
+		_ = conn.Close()
+	}()
+
+	a, err := NewAgent(&AgentConfig{})
+	assert.NoError(t, err)
+
+	assert.NoError(t, a.run(context.Background(), func(ctx context.Context, a *Agent) {
+		a.selector = &controllingSelector{agent: a, log: a.log}
+
+		hostConn, err := udpMux.GetConn(a.localUfrag, false)
+		assert.NoError(t, err)
+		srflxConn, err := udpMux.GetConnForURL(a.localUfrag, "stun:127.0.0.1:3478", false)
+		assert.NoError(t, err)
+
+		host, err := NewCandidateHost(&CandidateHostConfig{Network: "udp", Address: "127.0.0.1", Port: 777, Component: 1})
+		assert.NoError(t, err)
+		host.conn = hostConn
+		srflx, err := NewCandidateServerReflexive(&CandidateServerReflexiveConfig{
+			Network:   "udp",
+			Address:   "192.0.2.1",
+			Port:      777,
+			Component: 1,
+			RelAddr:   "127.0.0.1",
+			RelPort:   777,
+		})
+		assert.NoError(t, err)
+		srflx.conn = srflxConn
+
+		remote := newInboundRemote(t)
+		a.addRemoteCandidate(remote)
+		hostPair, srflxPair := a.addPair(host, remote), a.addPair(srflx, remote)
+
+		respond := func(local Candidate, receivedOn Candidate) {
+			msg, err := stun.Build(stun.BindingSuccess, stun.TransactionID,
+				stun.NewShortTermIntegrity(a.remotePwd),
+				stun.Fingerprint,
+			)
+			assert.NoError(t, err)
+			a.pendingBindingRequests = append(a.pendingBindingRequests, bindingRequest{
+				timestamp:     time.Now(),
+				transactionID: msg.TransactionID,
+				local:         local,
+				destination:   remote.addr(),
+			})
+			a.handleInbound(msg, receivedOn, remote.addr())
+		}
+
+		// The mux hands the responses to the conn that last wrote to the
+		// remote, they validate the pair their request was sent on
+		respond(srflx, host)
+		assert.Equal(t, CandidatePairState(CandidatePairStateSucceeded), srflxPair.state)
+		assert.NotEqual(t, CandidatePairState(CandidatePairStateSucceeded), hostPair.state)
+
+		respond(host, srflx)
+		assert.Equal(t, CandidatePairState(CandidatePairStateSucceeded), hostPair.state)
+		assert.Zero(t, hostPair.mismatchedResponses+srflxPair.mismatchedResponses)
+	}))
+	assert.NoError(t, a.Close())
+}
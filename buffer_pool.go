@@ -0,0 +1,52 @@
+package ice
+
+import (
+	"sync"
+)
+
+// packetBufferSize fits a packet along with the address UDPMux stores next to it
+const packetBufferSize = receiveMTU + maxAddrSize
+
+// packetBufferPool recycles the buffers used to hand packets from one
+// goroutine to another (UDPMux demultiplexing, TCP candidates and batched
+// writes), so steady state traffic does not allocate per packet. Buffers that
+// stay with a single reader, like the recvLoop's, are allocated once instead.
+var packetBufferPool = &sync.Pool{ //nolint:gochecknoglobals
+	New: func() interface{} {
+		return newBufferHolder(packetBufferSize)
+	},
+}
+
+type bufferHolder struct {
+	buffer []byte
+
+	// tooLarge stands for a packet too large to be received, see
+	// receiveBuffer.writeTooLarge
+	tooLarge bool
+}
+
+func newBufferHolder(size int) *bufferHolder {
+	return &bufferHolder{
+		buffer: make([]byte, size),
+	}
+}
+
+// getPacketBuffer returns a buffer holding a copy of p. If p does not fit in
+// a pooled buffer a new one is allocated, which putPacketBuffer then drops.
+func getPacketBuffer(p []byte) *bufferHolder {
+	if len(p) > packetBufferSize {
+		return &bufferHolder{buffer: append([]byte{}, p...)}
+	}
+
+	b := packetBufferPool.Get().(*bufferHolder) //nolint:forcetypeassert
+	b.buffer = b.buffer[:copy(b.buffer[:cap(b.buffer)], p)]
+	return b
+}
+
+func putPacketBuffer(b *bufferHolder) {
+	if b == nil || cap(b.buffer) != packetBufferSize {
+		return
+	}
+	b.buffer = b.buffer[:cap(b.buffer)]
+	packetBufferPool.Put(b)
+}
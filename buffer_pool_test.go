@@ -0,0 +1,95 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPacketBuffer(t *testing.T) {
+	b := getPacketBuffer([]byte{1, 2, 3})
+	assert.Equal(t, []byte{1, 2, 3}, b.buffer)
+	assert.Equal(t, packetBufferSize, cap(b.buffer))
+	putPacketBuffer(b)
+	assert.Len(t, b.buffer, packetBufferSize)
+
+	// Oversized packets are copied to a buffer of their own
+	large := make([]byte, packetBufferSize+1)
+	b = getPacketBuffer(large)
+	assert.Equal(t, large, b.buffer)
+	putPacketBuffer(b)
+	assert.Len(t, b.buffer, len(large))
+
+	putPacketBuffer(nil)
+}
+
+type discardBatchConn struct {
+	written int
+}
+
+func (c *discardBatchConn) ReadBufferSize() int {
+	return receiveMTU
+}
+
+func (c *discardBatchConn) ReadBatch([]batchPacket) (int, error) {
+	return 0, nil
+}
+
+func (c *discardBatchConn) WriteBatch(packets []batchPacket) (int, error) {
+	c.written += len(packets)
+	return len(packets), nil
+}
+
+func TestBatchWriterAllocs(t *testing.T) {
+	conn := &discardBatchConn{}
+	w := newBatchWriter(conn, func(err error) { assert.NoError(t, err) })
+
+	addr := &net.UDPAddr{IP: net.IP{127, 0, 0, 1}, Port: 1234}
+	packet := make([]byte, 1200)
+	allocs := testing.AllocsPerRun(1000, func() {
+		w.writeTo(packet, addr)
+	})
+	assert.Zero(t, allocs)
+	assert.Equal(t, 1001, conn.written)
+}
+
+type closedBatchConn struct {
+	discardBatchConn
+	writes int
+}
+
+func (c *closedBatchConn) WriteBatch([]batchPacket) (int, error) {
+	c.writes++
+	return 0, net.ErrClosed
+}
+
+func TestBatchWriterClosed(t *testing.T) {
+	conn := &closedBatchConn{}
+	var errs []error
+	w := newBatchWriter(conn, func(err error) { errs = append(errs, err) })
+
+	// The error is reported once, later packets are dropped
+	addr := &net.UDPAddr{IP: net.IP{127, 0, 0, 1}, Port: 1234}
+	for i := 0; i < 3; i++ {
+		w.writeTo([]byte{1}, addr)
+	}
+	assert.Equal(t, 1, conn.writes)
+	assert.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], net.ErrClosed)
+}
+
+func TestBatchWriterMaxPending(t *testing.T) {
+	w := newBatchWriter(&discardBatchConn{}, func(err error) { assert.NoError(t, err) })
+
+	// Packets queued behind a flushing writer are capped
+	addr := &net.UDPAddr{IP: net.IP{127, 0, 0, 1}, Port: 1234}
+	w.flushing = true
+	for i := 0; i < batchWriterMaxPending+1; i++ {
+		w.writeTo([]byte{1}, addr)
+	}
+	assert.Len(t, w.pending, batchWriterMaxPending)
+}
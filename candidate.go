@@ -56,14 +56,33 @@ type Candidate interface {
 	Equal(other Candidate) bool
 
 	Marshal() string
+	// MarshalJSON returns the candidate in the shape of RTCIceCandidateInit,
+	// see CandidateInit.
+	MarshalJSON() ([]byte, error)
+
+	// Extensions returns the extension attributes of the candidate (RFC 8839
+	// cand-extension) other than tcptype, in the order they were added.
+	Extensions() []CandidateExtension
+	// GetExtension returns the extension attribute named key.
+	GetExtension(key string) (CandidateExtension, bool)
+	// AddExtension adds an extension attribute, replacing any with the same key.
+	AddExtension(ext CandidateExtension) error
+
+	// Origin returns the URL of the STUN or TURN server a local candidate
+	// was gathered from, or CandidateOriginLocal if it was gathered without
+	// one. It is empty for remote candidates.
+	Origin() string
 
 	addr() net.Addr
 	agent() *Agent
 	context() context.Context
 
 	close() error
+	computePreferences(self Candidate, a *Agent)
 	copy() (Candidate, error)
-	seen(outbound bool)
-	start(a *Agent, conn net.PacketConn, initializedCh <-chan struct{})
+	gatherInfo() candidateGatherInfo
+	setGatherInfo(info candidateGatherInfo)
+	seen(outbound bool, now time.Time)
+	start(self Candidate, a *Agent, conn net.PacketConn, initializedCh <-chan struct{})
 	writeTo(raw []byte, dst Candidate) (int, error)
 }
@@ -2,12 +2,14 @@ package ice
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"hash/crc32"
+	"io"
 	"net"
 	"strconv"
 	"strings"
-	"sync/atomic"
+	"sync"
 	"time"
 
 	"github.com/pion/logging"
@@ -27,16 +29,75 @@ type candidateBase struct {
 
 	resolvedAddr net.Addr
 
-	lastSent     atomic.Value
-	lastReceived atomic.Value
+	// lastSent and lastReceived are updated for every packet, a mutex
+	// avoids boxing them in an atomic.Value each time
+	timestampMu  sync.Mutex
+	lastSent     time.Time
+	lastReceived time.Time
 	conn         net.PacketConn
 
 	currAgent *Agent
 	closeCh   chan struct{}
 	closedCh  chan struct{}
 
+	// self is the candidate embedding c, the one the agent pairs, set as it
+	// starts
+	self Candidate
+
 	foundationOverride string
 	priorityOverride   uint32
+
+	// localPreference is computed by AgentConfig.LocalPreferenceFunc,
+	// DefaultLocalPreference is used if it is nil
+	localPreference *uint16
+
+	// extensions are the cand-extension pairs other than tcptype, see AddExtension
+	extensions []CandidateExtension
+
+	gathered candidateGatherInfo
+
+	icmpErrorDetection bool
+
+	// Batched reads and writes, nil if unsupported by conn
+	batch       packetBatchConn
+	batchWriter *batchWriter
+}
+
+// candidateGatherInfo records how a local candidate was gathered, it is
+// set once before the candidate is handed to the agent.
+type candidateGatherInfo struct {
+	// url of the STUN or TURN server, empty for candidates that
+	// did not involve a server
+	url string
+
+	// started is when gathering for the candidate began, completed is
+	// when the STUN or TURN transaction (if any) finished
+	started   time.Time
+	completed time.Time
+}
+
+func (c *candidateBase) gatherInfo() candidateGatherInfo {
+	return c.gathered
+}
+
+func (c *candidateBase) setGatherInfo(info candidateGatherInfo) {
+	c.gathered = info
+}
+
+// CandidateOriginLocal is the Origin of the local candidates gathered
+// without a STUN or TURN server.
+const CandidateOriginLocal = "local"
+
+// Origin returns the URL of the server the candidate was gathered from
+func (c *candidateBase) Origin() string {
+	switch {
+	case c.gathered.url != "":
+		return c.gathered.url
+	case !c.gathered.started.IsZero():
+		return CandidateOriginLocal
+	default:
+		return ""
+	}
 }
 
 // Done implements context.Context
@@ -74,7 +135,26 @@ func (c *candidateBase) Foundation() string {
 		return c.foundationOverride
 	}
 
-	return fmt.Sprintf("%d", crc32.ChecksumIEEE([]byte(c.Type().String()+c.address+c.networkType.String())))
+	return DefaultFoundation(c)
+}
+
+// computePreferences computes the foundation and local preference of self,
+// the candidate embedding c, with AgentConfig.FoundationFunc and
+// LocalPreferenceFunc of a. It is called once as the candidate is added.
+func (c *candidateBase) computePreferences(self Candidate, a *Agent) {
+	if a.foundationFunc != nil && c.foundationOverride == "" {
+		c.foundationOverride = a.foundationFunc(self)
+	}
+	if a.localPreferenceFunc != nil {
+		localPreference := a.localPreferenceFunc(self)
+		c.localPreference = &localPreference
+	}
+}
+
+// DefaultFoundation returns the foundation of a candidate computed from its
+// type, address and network type, see AgentConfig.FoundationFunc.
+func DefaultFoundation(c Candidate) string {
+	return fmt.Sprintf("%d", crc32.ChecksumIEEE([]byte(c.Type().String()+c.Address()+c.NetworkType().String())))
 }
 
 // Address returns Candidate Address
@@ -108,6 +188,19 @@ func (c *candidateBase) SetComponent(component uint16) {
 
 // LocalPreference returns the local preference for this candidate
 func (c *candidateBase) LocalPreference() uint16 {
+	if c.localPreference != nil {
+		return *c.localPreference
+	}
+	return DefaultLocalPreference(c)
+}
+
+// DefaultLocalPreference returns the local preference of a candidate: the
+// highest for UDP candidates, and ranked by direction for TCP candidates,
+// lowered by the network cost of the adapter of host candidates, see
+// AgentConfig.LocalPreferenceFunc.
+func DefaultLocalPreference(c Candidate) uint16 {
+	cost := candidateNetworkCost(c)
+
 	if c.NetworkType().IsTCP() {
 		// RFC 6544, section 4.2
 		//
@@ -144,12 +237,12 @@ func (c *candidateBase) LocalPreference() uint16 {
 		// other-pref is the preference for the particular IP address from which
 		// the candidate was obtained.  When there is only a single IP address,
 		// this value SHOULD be set to the maximum allowed value (8191).
-		var otherPref uint16 = 8191
+		otherPref := 8191 - cost
 
 		directionPref := func() uint16 {
 			switch c.Type() {
 			case CandidateTypeHost, CandidateTypeRelay:
-				switch c.tcpType {
+				switch c.TCPType() {
 				case TCPTypeActive:
 					return 6
 				case TCPTypePassive:
@@ -160,7 +253,7 @@ func (c *candidateBase) LocalPreference() uint16 {
 					return 0
 				}
 			case CandidateTypePeerReflexive, CandidateTypeServerReflexive:
-				switch c.tcpType {
+				switch c.TCPType() {
 				case TCPTypeSimultaneousOpen:
 					return 6
 				case TCPTypeActive:
@@ -179,7 +272,7 @@ func (c *candidateBase) LocalPreference() uint16 {
 		return (1<<13)*directionPref + otherPref
 	}
 
-	return defaultLocalPreference
+	return defaultLocalPreference - cost
 }
 
 // RelatedAddress returns *CandidateRelatedAddress
@@ -192,15 +285,22 @@ func (c *candidateBase) TCPType() TCPType {
 }
 
 // start runs the candidate using the provided connection
-func (c *candidateBase) start(a *Agent, conn net.PacketConn, initializedCh <-chan struct{}) {
+func (c *candidateBase) start(self Candidate, a *Agent, conn net.PacketConn, initializedCh <-chan struct{}) {
 	if c.conn != nil {
 		c.agent().log.Warn("Can't start already started candidateBase")
 		return
 	}
+	c.self = self
 	c.currAgent = a
 	c.conn = conn
 	c.closeCh = make(chan struct{})
 	c.closedCh = make(chan struct{})
+	c.icmpErrorDetection = a.icmpErrorDetection && enableICMPErrors(rawPacketConn(conn))
+	if !a.disableBatchIO {
+		if c.batch = newBackendBatchConn(a.ioBackend, conn, a.udpSegmentationOffload, a.log); c.batch != nil {
+			c.batchWriter = newBatchWriter(c.batch, c.handleWriteError)
+		}
+	}
 
 	go c.recvLoop(initializedCh)
 }
@@ -216,34 +316,54 @@ func (c *candidateBase) recvLoop(initializedCh <-chan struct{}) {
 		return
 	}
 
+	if c.batch != nil {
+		c.recvBatchLoop()
+		return
+	}
+
 	log := c.agent().log
-	buffer := make([]byte, receiveMTU)
+	// One more byte than the largest packet, to tell a larger one apart
+	buffer := make([]byte, c.agent().maxPacketSize+1)
 	for {
 		n, srcAddr, err := c.conn.ReadFrom(buffer)
 		if err != nil {
+			if c.drainICMPErrors(err) {
+				continue
+			}
 			return
 		}
 
-		handleInboundCandidateMsg(c, c, buffer[:n], srcAddr, log)
+		handleInboundCandidateMsg(c, c.self, buffer[:n], srcAddr, log)
 	}
 }
 
 func handleInboundCandidateMsg(ctx context.Context, c Candidate, buffer []byte, srcAddr net.Addr, log logging.LeveledLogger) {
 	if stun.IsMessage(buffer) {
-		m := &stun.Message{
-			Raw: make([]byte, len(buffer)),
-		}
+		m := inboundSTUNPool.Get().(*stun.Message) //nolint:forcetypeassert
+
 		// Explicitly copy raw buffer so Message can own the memory.
-		copy(m.Raw, buffer)
+		m.Raw = append(m.Raw[:0], buffer...)
 		if err := m.Decode(); err != nil {
+			inboundSTUNPool.Put(m)
 			log.Warnf("Failed to handle decode ICE from %s to %s: %v", c.addr(), srcAddr, err)
 			return
 		}
-		err := c.agent().run(ctx, func(ctx context.Context, agent *Agent) {
+		c.agent().traceSTUNMessage(STUNMessageDirectionInbound, m, c.addr(), srcAddr)
+
+		// Queued without waiting, the message is released by the task
+		err := c.agent().runAsync(ctx, func(ctx context.Context, agent *Agent) {
+			defer inboundSTUNPool.Put(m)
+			if agent.stunFaults.appliesTo(STUNMessageDirectionInbound) {
+				agent.injectInboundSTUNFault(m, c, srcAddr)
+				return
+			}
 			agent.handleInbound(m, c, srcAddr)
 		})
 		if err != nil {
-			log.Warnf("Failed to handle message: %v", err)
+			inboundSTUNPool.Put(m)
+			if !errors.Is(err, errTaskDropped) {
+				log.Warnf("Failed to handle message: %v", err)
+			}
 		}
 
 		return
@@ -254,12 +374,24 @@ func handleInboundCandidateMsg(ctx context.Context, c Candidate, buffer []byte,
 		return
 	}
 
+	if len(buffer) > c.agent().maxPacketSize {
+		c.agent().dropTooLarge(srcAddr, c.agent().clock.Now())
+		return
+	}
+
+	c.agent().streamReceived(buffer)
+
 	// NOTE This will return packetio.ErrFull if the buffer ever manages to fill up.
 	if _, err := c.agent().buffer.Write(buffer); err != nil {
 		log.Warnf("failed to write packet")
 	}
 }
 
+// packetConn returns the conn of the candidate, nil until it is started.
+func (c *candidateBase) packetConn() net.PacketConn {
+	return c.conn
+}
+
 // close stops the recvLoop
 func (c *candidateBase) close() error {
 	// If conn has never been started will be nil
@@ -294,19 +426,47 @@ func (c *candidateBase) close() error {
 	// Wait until the recvLoop is closed
 	<-c.closedCh
 
+	// Release what the batches used, e.g. io_urings
+	if closer, ok := c.batch.(io.Closer); ok {
+		return closer.Close()
+	}
 	return nil
 }
 
 func (c *candidateBase) writeTo(raw []byte, dst Candidate) (int, error) {
+	if c.batchWriter != nil {
+		c.batchWriter.writeTo(raw, dst.addr())
+		c.seen(true, c.now())
+		return len(raw), nil
+	}
+
 	n, err := c.conn.WriteTo(raw, dst.addr())
 	if err != nil {
-		c.agent().log.Warnf("%s: %v", errSendPacket, err)
+		c.handleWriteError(err)
 		return n, nil
 	}
-	c.seen(true)
+	c.seen(true, c.now())
 	return n, nil
 }
 
+// handleWriteError logs err, or fails the pairs of the ICMP errors behind
+// it. Checks are written from the task loop, so the pairs are failed once
+// the task running, or the next one, is done rather than by a task of
+// their own.
+func (c *candidateBase) handleWriteError(err error) {
+	errs, ok := c.readICMPErrors(err)
+	if !ok {
+		c.agent().log.Warnf("%s: %v", errSendPacket, err)
+		return
+	}
+	if len(errs) > 0 {
+		a := c.agent()
+		a.afterRun(func(context.Context) {
+			a.failICMPPairs(c, errs)
+		})
+	}
+}
+
 // Priority computes the priority for this ICE Candidate
 func (c *candidateBase) Priority() uint32 {
 	if c.priorityOverride != 0 {
@@ -319,7 +479,11 @@ func (c *candidateBase) Priority() uint32 {
 	// candidates for a particular component for a particular data stream
 	// that have the same type, the local preference MUST be unique for each
 	// one.
-	return (1<<24)*uint32(c.Type().Preference()) +
+	typePreference := c.Type().Preference()
+	if c.currAgent != nil {
+		typePreference = c.currAgent.typePreference(c.Type())
+	}
+	return (1<<24)*uint32(typePreference) +
 		(1<<8)*uint32(c.LocalPreference()) +
 		uint32(256-c.Component())
 }
@@ -342,35 +506,45 @@ func (c *candidateBase) String() string {
 // LastReceived returns a time.Time indicating the last time
 // this candidate was received
 func (c *candidateBase) LastReceived() time.Time {
-	if lastReceived, ok := c.lastReceived.Load().(time.Time); ok {
-		return lastReceived
-	}
-	return time.Time{}
+	c.timestampMu.Lock()
+	defer c.timestampMu.Unlock()
+	return c.lastReceived
 }
 
 func (c *candidateBase) setLastReceived(t time.Time) {
-	c.lastReceived.Store(t)
+	c.timestampMu.Lock()
+	c.lastReceived = t
+	c.timestampMu.Unlock()
 }
 
 // LastSent returns a time.Time indicating the last time
 // this candidate was sent
 func (c *candidateBase) LastSent() time.Time {
-	if lastSent, ok := c.lastSent.Load().(time.Time); ok {
-		return lastSent
-	}
-	return time.Time{}
+	c.timestampMu.Lock()
+	defer c.timestampMu.Unlock()
+	return c.lastSent
 }
 
 func (c *candidateBase) setLastSent(t time.Time) {
-	c.lastSent.Store(t)
+	c.timestampMu.Lock()
+	c.lastSent = t
+	c.timestampMu.Unlock()
 }
 
-func (c *candidateBase) seen(outbound bool) {
+func (c *candidateBase) seen(outbound bool, now time.Time) {
 	if outbound {
-		c.setLastSent(time.Now())
+		c.setLastSent(now)
 	} else {
-		c.setLastReceived(time.Now())
+		c.setLastReceived(now)
+	}
+}
+
+// now returns the time of the clock of the agent of a local candidate.
+func (c *candidateBase) now() time.Time {
+	if c.currAgent == nil {
+		return time.Now()
 	}
+	return c.currAgent.clock.Now()
 }
 
 func (c *candidateBase) addr() net.Addr {
@@ -389,14 +563,16 @@ func (c *candidateBase) copy() (Candidate, error) {
 	return UnmarshalCandidate(c.Marshal())
 }
 
-// Marshal returns the string representation of the ICECandidate
+// Marshal returns the string representation of the ICECandidate, the value
+// of an RFC 8839 candidate attribute without its "candidate:" prefix
 func (c *candidateBase) Marshal() string {
 	val := c.Foundation()
 	if val == " " {
 		val = ""
 	}
 
-	val = fmt.Sprintf("%s %d %s %d %s %d typ %s",
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %d %s %d %s %d typ %s",
 		val,
 		c.Component(),
 		c.NetworkType().NetworkShort(),
@@ -405,22 +581,59 @@ func (c *candidateBase) Marshal() string {
 		c.Port(),
 		c.Type())
 
+	if r := c.RelatedAddress(); r != nil && r.Address != "" && r.Port != 0 {
+		fmt.Fprintf(&b, " raddr %s rport %d", r.Address, r.Port)
+	}
+
 	if c.tcpType != TCPTypeUnspecified {
-		val += fmt.Sprintf(" tcptype %s", c.tcpType.String())
+		fmt.Fprintf(&b, " tcptype %s", c.tcpType.String())
 	}
 
-	if r := c.RelatedAddress(); r != nil && r.Address != "" && r.Port != 0 {
-		val = fmt.Sprintf("%s raddr %s rport %d",
-			val,
-			r.Address,
-			r.Port)
+	for _, ext := range c.extensions {
+		fmt.Fprintf(&b, " %s %s", ext.Key, ext.Value)
 	}
 
-	return val
+	return b.String()
 }
 
-// UnmarshalCandidate creates a Candidate from its string representation
+// UnmarshalCandidate creates a Candidate from its string representation. The
+// "a=candidate:" or "candidate:" prefix of an SDP attribute is accepted, and
+// extension attributes are kept (see Candidate.Extensions) so they are
+// marshaled back.
 func UnmarshalCandidate(raw string) (Candidate, error) {
+	return unmarshalCandidate(raw, false)
+}
+
+// UnmarshalCandidateLenient is UnmarshalCandidate tolerating the violations
+// of legacy endpoints: a related address without rport (the related port is
+// then zero), a typ in any case, an unknown typ (parsed as host) and a
+// trailing extension name without value (dropped). A priority of zero is
+// accepted by both, the priority is then computed locally.
+func UnmarshalCandidateLenient(raw string) (Candidate, error) {
+	return unmarshalCandidate(raw, true)
+}
+
+// parseRelatedAddress parses the "raddr <address> rport <port>" starting
+// split, lenient accepts a missing rport. It returns what follows.
+func parseRelatedAddress(split []string, lenient bool) (string, int, []string, error) {
+	if len(split) > 1 && lenient && (len(split) < 4 || split[2] != "rport") {
+		return split[1], 0, split[2:], nil
+	}
+	if len(split) < 4 || split[2] != "rport" {
+		return "", 0, nil, fmt.Errorf("%w: incorrect length", errParseRelatedAddr)
+	}
+
+	rawRelatedPort, err := strconv.ParseUint(split[3], 10, 16)
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("%w: %v", errParsePort, err)
+	}
+	return split[1], int(rawRelatedPort), split[4:], nil
+}
+
+func unmarshalCandidate(raw string, lenient bool) (Candidate, error) { //nolint:gocognit
+	raw = strings.TrimPrefix(raw, "a=")
+	raw = strings.TrimPrefix(raw, "candidate:")
+
 	split := strings.Fields(raw)
 	// Foundation not specified: not RFC 8445 compliant but seen in the wild
 	if len(raw) != 0 && raw[0] == ' ' {
@@ -460,48 +673,84 @@ func UnmarshalCandidate(raw string) (Candidate, error) {
 	}
 	port := int(rawPort)
 	typ := split[7]
+	if lenient {
+		typ = strings.ToLower(typ)
+	}
 
 	relatedAddress := ""
 	relatedPort := 0
 	tcpType := TCPTypeUnspecified
+	var extensions []CandidateExtension
 
-	if len(split) > 8 {
-		split = split[8:]
+	split = split[8:]
+	if len(split) > 0 && split[0] == "raddr" {
+		if relatedAddress, relatedPort, split, err = parseRelatedAddress(split, lenient); err != nil {
+			return nil, err
+		}
+	}
 
-		if split[0] == "raddr" {
-			if len(split) < 4 {
-				return nil, fmt.Errorf("%w: incorrect length", errParseRelatedAddr)
+	// The remaining attributes are cand-extension name/value pairs
+	for len(split) > 0 {
+		// Older versions marshaled tcptype before raddr and rport
+		if split[0] == "raddr" && relatedAddress == "" {
+			if relatedAddress, relatedPort, split, err = parseRelatedAddress(split, lenient); err != nil {
+				return nil, err
 			}
+			continue
+		}
 
-			// RelatedAddress
-			relatedAddress = split[1]
-
-			// RelatedPort
-			rawRelatedPort, parseErr := strconv.ParseUint(split[3], 10, 16)
-			if parseErr != nil {
-				return nil, fmt.Errorf("%w: %v", errParsePort, parseErr)
-			}
-			relatedPort = int(rawRelatedPort)
-		} else if split[0] == "tcptype" {
+		if split[0] == "tcptype" {
 			if len(split) < 2 {
 				return nil, fmt.Errorf("%w: incorrect length", errParseTypType)
 			}
-
 			tcpType = NewTCPType(split[1])
+			split = split[2:]
+			continue
 		}
+
+		if len(split) < 2 {
+			if lenient {
+				break
+			}
+			return nil, fmt.Errorf("%w: %s has no value", errParseExtension, split[0])
+		}
+		extensions = append(extensions, CandidateExtension{Key: split[0], Value: split[1]})
+		split = split[2:]
 	}
 
+	customType, isCustom := lookupCandidateTypeName(typ)
+	if lenient && typ != "srflx" && typ != "prflx" && typ != "relay" && !isCustom {
+		typ = "host"
+	}
+
+	var c Candidate
 	switch typ {
 	case "host":
-		return NewCandidateHost(&CandidateHostConfig{"", protocol, address, port, component, priority, foundation, tcpType})
+		c, err = NewCandidateHost(&CandidateHostConfig{"", protocol, address, port, component, priority, foundation, tcpType})
 	case "srflx":
-		return NewCandidateServerReflexive(&CandidateServerReflexiveConfig{"", protocol, address, port, component, priority, foundation, relatedAddress, relatedPort})
+		c, err = NewCandidateServerReflexive(&CandidateServerReflexiveConfig{"", protocol, address, port, component, priority, foundation, relatedAddress, relatedPort})
 	case "prflx":
-		return NewCandidatePeerReflexive(&CandidatePeerReflexiveConfig{"", protocol, address, port, component, priority, foundation, relatedAddress, relatedPort})
+		c, err = NewCandidatePeerReflexive(&CandidatePeerReflexiveConfig{"", protocol, address, port, component, priority, foundation, relatedAddress, relatedPort})
 	case "relay":
-		return NewCandidateRelay(&CandidateRelayConfig{"", protocol, address, port, component, priority, foundation, relatedAddress, relatedPort, "", nil})
+		c, err = NewCandidateRelay(&CandidateRelayConfig{"", protocol, address, port, component, priority, foundation, relatedAddress, relatedPort, "", nil})
 	default:
+		if !isCustom {
+			return nil, fmt.Errorf("%w (%s)", ErrUnknownCandidateTyp, typ)
+		}
+		c, err = NewCandidateCustom(&CandidateCustomConfig{"", customType, protocol, address, port, component, priority, foundation, relatedAddress, relatedPort})
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, fmt.Errorf("%w (%s)", ErrUnknownCandidateTyp, typ)
+	// Only host candidates take a TCPType in their config
+	if tcpType != TCPTypeUnspecified && c.TCPType() != tcpType {
+		extensions = append([]CandidateExtension{{Key: "tcptype", Value: tcpType.String()}}, extensions...)
+	}
+	for _, ext := range extensions {
+		if err := c.AddExtension(ext); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
 }
@@ -0,0 +1,100 @@
+package ice
+
+import (
+	"context"
+)
+
+// GetCandidateBase returns the base of the local candidate c, the local
+// candidate whose socket c sends from (RFC 8445, Section 5.1.1). Host and
+// relay candidates are their own base, as are server reflexive candidates
+// gathered on a socket of their own. Server reflexive candidates gathered
+// through a UniversalUDPMux share the socket of the host candidates of the
+// mux, the first of them is returned if the mux listens on several
+// addresses. It fails with ErrCandidateNotFound if c is not a local
+// candidate.
+func (a *Agent) GetCandidateBase(c Candidate) (Candidate, error) {
+	var base Candidate
+	if err := a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		if local := agent.findLocalCandidate(c); local != nil {
+			base = agent.candidateBase(local)
+		}
+	}); err != nil {
+		return nil, err
+	}
+	if base == nil {
+		return nil, ErrCandidateNotFound
+	}
+	return base, nil
+}
+
+// GetDerivedCandidates returns the local candidates whose base is the local
+// candidate c, other than c, e.g. the server reflexive candidates sharing
+// the socket of a host candidate, see GetCandidateBase. Pairs of these
+// candidates are redundant with the pairs of their base for the same remote
+// candidate. It fails with ErrCandidateNotFound if c is not a local
+// candidate.
+func (a *Agent) GetDerivedCandidates(c Candidate) ([]Candidate, error) {
+	var derived []Candidate
+	found := false
+	if err := a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		base := agent.findLocalCandidate(c)
+		if base == nil {
+			return
+		}
+		found = true
+		for _, candidate := range agent.localCandidates[base.NetworkType()] {
+			if candidate != base && agent.candidateBase(candidate) == base {
+				derived = append(derived, candidate)
+			}
+		}
+	}); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrCandidateNotFound
+	}
+	return derived, nil
+}
+
+// findLocalCandidate returns the local candidate equal to c, nil if there
+// is none.
+// Note: the caller should hold the agent lock.
+func (a *Agent) findLocalCandidate(c Candidate) Candidate {
+	for _, candidate := range a.localCandidates[c.NetworkType()] {
+		if candidate.Equal(c) {
+			return candidate
+		}
+	}
+	return nil
+}
+
+// candidateBase returns the base of the local candidate c.
+// Note: the caller should hold the agent lock.
+func (a *Agent) candidateBase(c Candidate) Candidate {
+	if c.Type() != CandidateTypeServerReflexive && c.Type() != CandidateTypePeerReflexive {
+		return c
+	}
+	socket := candidateSocketID(c)
+	if socket == nil {
+		return c
+	}
+	for _, candidate := range a.localCandidates[c.NetworkType()] {
+		if candidate.Type() == CandidateTypeHost && candidateSocketID(candidate) == socket {
+			return candidate
+		}
+	}
+	return c
+}
+
+// candidateSocketID identifies the socket of a local candidate, the conns
+// of a UDPMux share its socket.
+func candidateSocketID(c Candidate) interface{} {
+	conn := candidateSocket(c)
+	if muxed, ok := conn.(*udpMuxedConn); ok {
+		return muxed.params.Mux
+	}
+	if conn == nil {
+		return nil
+	}
+	return conn
+}
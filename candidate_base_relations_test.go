@@ -0,0 +1,106 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCandidateBase(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	a, err := NewAgent(&AgentConfig{})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	// The host and the first server reflexive candidate share the socket of
+	// a mux, the second server reflexive candidate has its own
+	mux := &UDPMuxDefault{}
+	host, err := NewCandidateHost(&CandidateHostConfig{
+		Network:   "udp",
+		Address:   "192.168.0.2",
+		Port:      3478,
+		Component: 1,
+	})
+	require.NoError(t, err)
+	host.conn = &udpMuxedConn{params: &udpMuxedConnParams{Mux: mux, Key: "ufrag"}}
+
+	muxedSrflx, err := NewCandidateServerReflexive(&CandidateServerReflexiveConfig{
+		Network:   "udp",
+		Address:   "203.0.113.2",
+		Port:      3478,
+		Component: 1,
+		RelAddr:   "0.0.0.0",
+		RelPort:   3478,
+	})
+	require.NoError(t, err)
+	muxedSrflx.conn = &udpMuxedConn{params: &udpMuxedConnParams{Mux: mux, Key: "ufrag:stun:stun.example.com"}}
+
+	srflx, err := NewCandidateServerReflexive(&CandidateServerReflexiveConfig{
+		Network:   "udp",
+		Address:   "203.0.113.2",
+		Port:      40000,
+		Component: 1,
+		RelAddr:   "0.0.0.0",
+		RelPort:   50000,
+	})
+	require.NoError(t, err)
+	srflx.conn = &mockPacketConn{}
+
+	relay, err := NewCandidateRelay(&CandidateRelayConfig{
+		Network:   "udp",
+		Address:   "203.0.113.3",
+		Port:      50000,
+		Component: 1,
+		RelAddr:   "0.0.0.0",
+		RelPort:   50001,
+	})
+	require.NoError(t, err)
+	relay.conn = &mockPacketConn{}
+
+	require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+		agent.localCandidates[NetworkTypeUDP4] = []Candidate{muxedSrflx, host, srflx, relay}
+	}))
+
+	for _, c := range []struct {
+		candidate, base Candidate
+	}{
+		{host, host},
+		{muxedSrflx, host},
+		{srflx, srflx},
+		{relay, relay},
+	} {
+		base, err := a.GetCandidateBase(c.candidate)
+		require.NoError(t, err)
+		assert.Equal(t, c.base, base, c.candidate.String())
+	}
+
+	derived, err := a.GetDerivedCandidates(host)
+	require.NoError(t, err)
+	assert.Equal(t, []Candidate{muxedSrflx}, derived)
+
+	derived, err = a.GetDerivedCandidates(srflx)
+	require.NoError(t, err)
+	assert.Empty(t, derived)
+
+	unknown, err := NewCandidateHost(&CandidateHostConfig{
+		Network:   "udp",
+		Address:   "192.168.0.3",
+		Port:      3478,
+		Component: 1,
+	})
+	require.NoError(t, err)
+	_, err = a.GetCandidateBase(unknown)
+	assert.ErrorIs(t, err, ErrCandidateNotFound)
+	_, err = a.GetDerivedCandidates(unknown)
+	assert.ErrorIs(t, err, ErrCandidateNotFound)
+}
@@ -0,0 +1,79 @@
+package ice
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// candidateConn is the conn of a local candidate handed out by
+// CandidateConn. The agent keeps reading and closing it.
+type candidateConn struct {
+	net.PacketConn
+}
+
+// CandidateConn returns the socket of the local candidate c, for
+// applications probing paths or sending their own traffic from the address
+// of a candidate, e.g. on idle candidates. It requires
+// AgentConfig.CandidateConnAccess.
+//
+// Only writes are allowed: the agent reads the socket and closes it along
+// with the candidate, ReadFrom and Close return ErrCandidateConnOwned. The
+// deadlines of the socket would apply to the agent too, SetDeadline,
+// SetReadDeadline and SetWriteDeadline return ErrCandidateConnOwned as
+// well. The packets sent are seen by the peer as any packet from the
+// candidate: non STUN packets reaching the agent of the peer are delivered
+// by its Conn. Replies from addresses that are not remote candidates are
+// discarded by the agent. For candidates multiplexed by a UDPMux or TCPMux
+// the conn is the one the mux gives the ufrag of the agent, writing through
+// the shared socket.
+func (a *Agent) CandidateConn(c Candidate) (net.PacketConn, error) {
+	if !a.candidateConnAccess {
+		return nil, ErrCandidateConnAccessDisabled
+	}
+
+	var conn net.PacketConn
+	if err := a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		for _, candidate := range agent.localCandidates[c.NetworkType()] {
+			if !candidate.Equal(c) {
+				continue
+			}
+			if started, ok := candidate.(interface{ packetConn() net.PacketConn }); ok && started.packetConn() != nil {
+				conn = &candidateConn{started.packetConn()}
+			}
+			return
+		}
+	}); err != nil {
+		return nil, err
+	}
+	if conn == nil {
+		return nil, ErrCandidateNotFound
+	}
+	return conn, nil
+}
+
+// ReadFrom returns ErrCandidateConnOwned, the agent reads the conn.
+func (c *candidateConn) ReadFrom([]byte) (int, net.Addr, error) {
+	return 0, nil, ErrCandidateConnOwned
+}
+
+// Close returns ErrCandidateConnOwned, the conn is closed with its candidate.
+func (c *candidateConn) Close() error {
+	return ErrCandidateConnOwned
+}
+
+// SetDeadline returns ErrCandidateConnOwned, see SetWriteDeadline.
+func (c *candidateConn) SetDeadline(time.Time) error {
+	return ErrCandidateConnOwned
+}
+
+// SetReadDeadline returns ErrCandidateConnOwned, the agent reads the conn.
+func (c *candidateConn) SetReadDeadline(time.Time) error {
+	return ErrCandidateConnOwned
+}
+
+// SetWriteDeadline returns ErrCandidateConnOwned, the deadline would apply
+// to the writes of the agent too.
+func (c *candidateConn) SetWriteDeadline(time.Time) error {
+	return ErrCandidateConnOwned
+}
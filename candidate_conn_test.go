@@ -0,0 +1,102 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCandidateConn(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	newGatheredAgent := func(access bool) (*Agent, Candidate) {
+		a, err := NewAgent(&AgentConfig{
+			NetworkTypes:        []NetworkType{NetworkTypeUDP4},
+			CandidateTypes:      []CandidateType{CandidateTypeHost},
+			Synchronous:         true,
+			CandidateConnAccess: access,
+		})
+		require.NoError(t, err)
+
+		var candidates []Candidate
+		require.NoError(t, a.OnCandidate(func(c Candidate) {
+			if c != nil {
+				candidates = append(candidates, c)
+			}
+		}))
+		require.NoError(t, a.GatherCandidates())
+		require.NotEmpty(t, candidates)
+		return a, candidates[0]
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		a, c := newGatheredAgent(false)
+		defer func() {
+			assert.NoError(t, a.Close())
+		}()
+
+		_, err := a.CandidateConn(c)
+		assert.ErrorIs(t, err, ErrCandidateConnAccessDisabled)
+	})
+
+	t.Run("Unknown candidate", func(t *testing.T) {
+		a, _ := newGatheredAgent(true)
+		defer func() {
+			assert.NoError(t, a.Close())
+		}()
+
+		unknown, err := NewCandidateHost(&CandidateHostConfig{
+			Network:   "udp",
+			Address:   "192.0.2.1",
+			Port:      9,
+			Component: ComponentRTP,
+		})
+		require.NoError(t, err)
+		_, err = a.CandidateConn(unknown)
+		assert.ErrorIs(t, err, ErrCandidateNotFound)
+	})
+
+	t.Run("Writes only", func(t *testing.T) {
+		a, c := newGatheredAgent(true)
+		defer func() {
+			assert.NoError(t, a.Close())
+		}()
+
+		conn, err := a.CandidateConn(c)
+		require.NoError(t, err)
+		assert.Equal(t, c.Port(), conn.LocalAddr().(*net.UDPAddr).Port)
+
+		_, _, err = conn.ReadFrom(make([]byte, 1))
+		assert.ErrorIs(t, err, ErrCandidateConnOwned)
+		assert.ErrorIs(t, conn.Close(), ErrCandidateConnOwned)
+		assert.ErrorIs(t, conn.SetReadDeadline(time.Now()), ErrCandidateConnOwned)
+		assert.ErrorIs(t, conn.SetWriteDeadline(time.Now()), ErrCandidateConnOwned)
+		assert.ErrorIs(t, conn.SetDeadline(time.Now()), ErrCandidateConnOwned)
+
+		// The probe leaves from the socket of the candidate
+		probed, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		require.NoError(t, err)
+		defer func() {
+			assert.NoError(t, probed.Close())
+		}()
+
+		msg := []byte("probe")
+		_, err = conn.WriteTo(msg, probed.LocalAddr())
+		require.NoError(t, err)
+
+		buf := make([]byte, len(msg))
+		require.NoError(t, probed.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, addr, err := probed.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, msg, buf[:n])
+		assert.Equal(t, c.Port(), addr.(*net.UDPAddr).Port)
+	})
+}
@@ -0,0 +1,111 @@
+package ice
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// CandidateCustom is a candidate of a type registered with
+// RegisterCandidateType. Its behavior is that of the other candidates, only
+// its type and its PacketConn, given to AddLocalCandidate, differ.
+type CandidateCustom struct {
+	candidateBase
+}
+
+// CandidateCustomConfig is the config required to create a new CandidateCustom
+type CandidateCustomConfig struct {
+	CandidateID string
+	Type        CandidateType
+	Network     string
+	Address     string
+	Port        int
+	Component   uint16
+	Priority    uint32
+	Foundation  string
+	RelAddr     string
+	RelPort     int
+}
+
+// NewCandidateCustom creates a new candidate of a type registered with
+// RegisterCandidateType.
+func NewCandidateCustom(config *CandidateCustomConfig) (*CandidateCustom, error) {
+	if _, ok := lookupCandidateType(config.Type); !ok {
+		return nil, fmt.Errorf("%w (%d)", ErrUnknownCandidateTyp, config.Type)
+	}
+
+	ip := net.ParseIP(config.Address)
+	if ip == nil {
+		return nil, ErrAddressParseFailed
+	}
+
+	networkType, err := determineNetworkType(config.Network, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	candidateID := config.CandidateID
+	candidateIDGenerator := newCandidateIDGenerator()
+	if candidateID == "" {
+		candidateID = candidateIDGenerator.Generate()
+	}
+
+	c := &CandidateCustom{
+		candidateBase: candidateBase{
+			id:                 candidateID,
+			networkType:        networkType,
+			candidateType:      config.Type,
+			address:            config.Address,
+			port:               config.Port,
+			resolvedAddr:       createAddr(networkType, ip, config.Port),
+			component:          config.Component,
+			foundationOverride: config.Foundation,
+			priorityOverride:   config.Priority,
+		},
+	}
+	if config.RelAddr != "" {
+		c.relatedAddress = &CandidateRelatedAddress{
+			Address: config.RelAddr,
+			Port:    config.RelPort,
+		}
+	}
+	return c, nil
+}
+
+// AddLocalCandidate adds the local candidate c, sending and receiving on
+// conn, e.g. a CandidateCustom whose conn tunnels through an overlay
+// network. The packets read from conn must come from the addresses of the
+// remote candidates. c is paired, checked and passed to OnCandidate like the
+// gathered candidates, conn is closed with it. conn is closed right away if
+// c duplicates a local candidate or c cannot be added.
+//
+// c is one of the candidates of this package, such as a CandidateCustom,
+// as Candidate can not be implemented outside of it.
+func (a *Agent) AddLocalCandidate(c Candidate, conn net.PacketConn) error {
+	if started, ok := c.(interface{ Done() <-chan struct{} }); ok && started.Done() != nil {
+		return ErrLocalCandidateStarted
+	}
+
+	duplicate := false
+	if err := a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		for _, candidate := range agent.localCandidates[c.NetworkType()] {
+			if candidate.Equal(c) {
+				duplicate = true
+				return
+			}
+		}
+		if agent.withholdCandidate(c, conn) {
+			return
+		}
+		agent.insertLocalCandidate(c, conn)
+	}); err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	if duplicate {
+		a.log.Debugf("Ignore duplicate candidate: %s", c)
+		return conn.Close()
+	}
+	return nil
+}
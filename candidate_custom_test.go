@@ -0,0 +1,170 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	overlayOnce sync.Once //nolint:gochecknoglobals
+	overlayType CandidateType
+)
+
+// overlayCandidateType registers the overlay candidate type once per test
+// binary, tests may run several times.
+func overlayCandidateType(t *testing.T) CandidateType {
+	overlayOnce.Do(func() {
+		var err error
+		overlayType, err = RegisterCandidateType("overlay", 90)
+		require.NoError(t, err)
+	})
+	return overlayType
+}
+
+func TestRegisterCandidateType(t *testing.T) {
+	overlay := overlayCandidateType(t)
+	assert.Equal(t, "overlay", overlay.String())
+	assert.Equal(t, uint16(90), overlay.Preference())
+
+	_, err := RegisterCandidateType("overlay", 90)
+	assert.ErrorIs(t, err, ErrCandidateTypeRegistered)
+	for _, name := range []string{"", "relay", "over lay", "overlay\n"} {
+		_, err = RegisterCandidateType(name, 90)
+		assert.ErrorIs(t, err, ErrInvalidCandidateTypeName, name)
+	}
+	_, err = RegisterCandidateType("overlay-fast", maxTypePreference+1)
+	assert.ErrorIs(t, err, ErrInvalidTypePreference)
+
+	_, err = NewCandidateCustom(&CandidateCustomConfig{Type: CandidateType(255), Network: "udp", Address: "10.0.0.1", Port: 1})
+	assert.ErrorIs(t, err, ErrUnknownCandidateTyp)
+}
+
+func TestCandidateCustomMarshal(t *testing.T) {
+	overlay := overlayCandidateType(t)
+
+	c, err := NewCandidateCustom(&CandidateCustomConfig{
+		Type:      overlay,
+		Network:   "udp",
+		Address:   "10.64.0.1",
+		Port:      4000,
+		Component: ComponentRTP,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(90)<<24, c.Priority()&0xff000000)
+	assert.Contains(t, c.Marshal(), " typ overlay")
+
+	parsed, err := UnmarshalCandidate(c.Marshal())
+	require.NoError(t, err)
+	assert.IsType(t, &CandidateCustom{}, parsed)
+	assert.Equal(t, overlay, parsed.Type())
+	assert.True(t, parsed.Equal(c))
+
+	parsed, err = UnmarshalCandidateLenient(c.Marshal())
+	require.NoError(t, err)
+	assert.Equal(t, overlay, parsed.Type())
+}
+
+func TestAddLocalCandidate(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 10)
+	defer lim.Stop()
+
+	overlay := overlayCandidateType(t)
+	relayAcceptanceMinWait := time.Duration(0)
+
+	// Each agent only has an overlay candidate, its conn stands for the
+	// tunnel of the overlay network
+	newOverlayAgent := func() (*Agent, Candidate, net.PacketConn) {
+		a, err := NewAgent(&AgentConfig{
+			NetworkTypes:           []NetworkType{NetworkTypeUDP4},
+			RelayAcceptanceMinWait: &relayAcceptanceMinWait,
+		})
+		require.NoError(t, err)
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		require.NoError(t, err)
+		laddr := conn.LocalAddr().(*net.UDPAddr) //nolint:forcetypeassert
+		c, err := NewCandidateCustom(&CandidateCustomConfig{
+			Type:      overlay,
+			Network:   "udp",
+			Address:   laddr.IP.String(),
+			Port:      laddr.Port,
+			Component: ComponentRTP,
+		})
+		require.NoError(t, err)
+		return a, c, conn
+	}
+
+	aAgent, aCandidate, aConn := newOverlayAgent()
+	bAgent, bCandidate, bConn := newOverlayAgent()
+
+	signaled := make(chan Candidate, 2)
+	require.NoError(t, aAgent.OnCandidate(func(c Candidate) {
+		if c != nil {
+			signaled <- c
+		}
+	}))
+	require.NoError(t, aAgent.AddLocalCandidate(aCandidate, aConn))
+	require.NoError(t, bAgent.AddLocalCandidate(bCandidate, bConn))
+	assert.ErrorIs(t, aAgent.AddLocalCandidate(aCandidate, aConn), ErrLocalCandidateStarted)
+	assert.Equal(t, aCandidate, <-signaled)
+
+	// A duplicate is ignored, its conn closed
+	duplicate, err := NewCandidateCustom(&CandidateCustomConfig{
+		Type:      overlay,
+		Network:   "udp",
+		Address:   aCandidate.Address(),
+		Port:      aCandidate.Port(),
+		Component: ComponentRTP,
+	})
+	require.NoError(t, err)
+	duplicateConn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	require.NoError(t, aAgent.AddLocalCandidate(duplicate, duplicateConn))
+	assert.ErrorIs(t, duplicateConn.Close(), net.ErrClosed)
+
+	for _, exchange := range []struct {
+		from, to *Agent
+	}{{aAgent, bAgent}, {bAgent, aAgent}} {
+		candidates, err := exchange.from.GetLocalCandidates()
+		require.NoError(t, err)
+		require.Len(t, candidates, 1)
+		remote, err := candidates[0].copy()
+		require.NoError(t, err)
+		require.NoError(t, exchange.to.AddRemoteCandidate(remote))
+	}
+
+	accepted := make(chan *Conn)
+	go func() {
+		bUfrag, bPwd, err := bAgent.GetLocalUserCredentials()
+		assert.NoError(t, err)
+		conn, err := aAgent.Accept(context.Background(), bUfrag, bPwd)
+		assert.NoError(t, err)
+		accepted <- conn
+	}()
+	aUfrag, aPwd, err := aAgent.GetLocalUserCredentials()
+	require.NoError(t, err)
+	bICE, err := bAgent.Dial(context.Background(), aUfrag, aPwd)
+	require.NoError(t, err)
+	aICE := <-accepted
+	require.NotNil(t, aICE)
+
+	pair, err := aAgent.GetSelectedCandidatePair()
+	require.NoError(t, err)
+	assert.Equal(t, overlay, pair.Local.Type())
+	assert.Equal(t, overlay, pair.Remote.Type())
+
+	assert.NoError(t, aICE.Close())
+	assert.NoError(t, bICE.Close())
+}
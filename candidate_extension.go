@@ -0,0 +1,56 @@
+package ice
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CandidateExtension is an extension attribute of a candidate, a name/value
+// pair following the candidate type and related address (cand-extension in
+// RFC 8839), e.g. generation, network-id or ufrag.
+type CandidateExtension struct {
+	Key   string
+	Value string
+}
+
+// Extensions returns a copy of the extension attributes of the candidate
+func (c *candidateBase) Extensions() []CandidateExtension {
+	return append([]CandidateExtension(nil), c.extensions...)
+}
+
+// GetExtension returns the extension attribute named key
+func (c *candidateBase) GetExtension(key string) (CandidateExtension, bool) {
+	for _, ext := range c.extensions {
+		if ext.Key == key {
+			return ext, true
+		}
+	}
+	return CandidateExtension{}, false
+}
+
+// AddExtension adds an extension attribute, replacing any with the same key.
+// Setting tcptype changes TCPType, raddr and rport are not extensions and
+// are rejected.
+func (c *candidateBase) AddExtension(ext CandidateExtension) error {
+	if ext.Key == "" || ext.Value == "" ||
+		strings.ContainsAny(ext.Key, " \t\r\n") || strings.ContainsAny(ext.Value, " \t\r\n") {
+		return fmt.Errorf("%w: %q %q", errParseExtension, ext.Key, ext.Value)
+	}
+
+	switch ext.Key {
+	case "raddr", "rport":
+		return fmt.Errorf("%w: %s is not an extension", errParseExtension, ext.Key)
+	case "tcptype":
+		c.tcpType = NewTCPType(ext.Value)
+		return nil
+	}
+
+	for i := range c.extensions {
+		if c.extensions[i].Key == ext.Key {
+			c.extensions[i].Value = ext.Value
+			return nil
+		}
+	}
+	c.extensions = append(c.extensions, ext)
+	return nil
+}
@@ -46,18 +46,23 @@ func NewCandidateHost(config *CandidateHostConfig) (*CandidateHost, error) {
 		network: config.Network,
 	}
 
-	if !strings.HasSuffix(config.Address, ".local") {
-		ip := net.ParseIP(config.Address)
-		if ip == nil {
-			return nil, ErrAddressParseFailed
-		}
-
+	switch ip := net.ParseIP(config.Address); {
+	case strings.HasSuffix(config.Address, ".local"):
+		// Until mDNS candidate is resolved assume it is UDPv4
+		c.candidateBase.networkType = NetworkTypeUDP4
+	case ip != nil:
 		if err := c.setIP(ip); err != nil {
 			return nil, err
 		}
-	} else {
-		// Until mDNS candidate is resolved assume it is UDPv4
-		c.candidateBase.networkType = NetworkTypeUDP4
+	case isFQDN(config.Address):
+		// Until the DNS name is resolved assume it is IPv4
+		networkType, err := determineNetworkType(config.Network, net.IPv4zero)
+		if err != nil {
+			return nil, err
+		}
+		c.candidateBase.networkType = networkType
+	default:
+		return nil, ErrAddressParseFailed
 	}
 
 	return c, nil
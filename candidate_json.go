@@ -0,0 +1,65 @@
+package ice
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// CandidateInit is the JSON form of a candidate exchanged with browsers,
+// it has the shape of RTCIceCandidateInit
+// https://www.w3.org/TR/webrtc/#dom-rtcicecandidateinit
+type CandidateInit struct {
+	// Candidate is the candidate-attribute, "candidate:" included. It is
+	// empty for the end-of-candidates indication.
+	Candidate        string  `json:"candidate"`
+	SDPMid           *string `json:"sdpMid,omitempty"`
+	SDPMLineIndex    *uint16 `json:"sdpMLineIndex,omitempty"`
+	UsernameFragment *string `json:"usernameFragment,omitempty"`
+}
+
+// NewCandidateInit returns the CandidateInit of c, UsernameFragment is set
+// from the ufrag extension of c if it has one. SDPMid and SDPMLineIndex are
+// up to the caller, browsers require one of them.
+func NewCandidateInit(c Candidate) CandidateInit {
+	init := CandidateInit{Candidate: "candidate:" + c.Marshal()}
+	if ext, ok := c.GetExtension("ufrag"); ok {
+		init.UsernameFragment = &ext.Value
+	}
+	return init
+}
+
+// Parse returns the candidate described by i, nil for the end-of-candidates
+// indication. UsernameFragment is kept as the ufrag extension of the
+// candidate, unless it already has one.
+func (i CandidateInit) Parse() (Candidate, error) {
+	if strings.TrimPrefix(i.Candidate, "candidate:") == "" {
+		return nil, nil //nolint:nilnil
+	}
+
+	c, err := UnmarshalCandidate(i.Candidate)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := c.GetExtension("ufrag"); !ok && i.UsernameFragment != nil && *i.UsernameFragment != "" {
+		if err := c.AddExtension(CandidateExtension{Key: "ufrag", Value: *i.UsernameFragment}); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// MarshalJSON returns the candidate as a CandidateInit JSON object
+func (c *candidateBase) MarshalJSON() ([]byte, error) {
+	return json.Marshal(NewCandidateInit(c))
+}
+
+// UnmarshalCandidateJSON creates a Candidate from a CandidateInit JSON
+// object, as produced by RTCIceCandidate.toJSON() in browsers. It returns nil
+// for the end-of-candidates indication.
+func UnmarshalCandidateJSON(data []byte) (Candidate, error) {
+	var init CandidateInit
+	if err := json.Unmarshal(data, &init); err != nil {
+		return nil, err
+	}
+	return init.Parse()
+}
@@ -0,0 +1,55 @@
+package ice
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCandidateJSON(t *testing.T) {
+	c, err := UnmarshalCandidate("1986380506 1 udp 2122063615 10.0.75.1 53634 typ host generation 0 ufrag abcd")
+	require.NoError(t, err)
+
+	raw, err := json.Marshal(c)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"candidate":"candidate:1986380506 1 udp 2122063615 10.0.75.1 53634 typ host generation 0 ufrag abcd","usernameFragment":"abcd"}`, string(raw))
+
+	parsed, err := UnmarshalCandidateJSON(raw)
+	require.NoError(t, err)
+	assert.True(t, c.Equal(parsed))
+	assert.Equal(t, c.Marshal(), parsed.Marshal())
+
+	// Candidates are marshaled as such in a slice too
+	raw, err = json.Marshal([]Candidate{c})
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"candidate":"candidate:1986380506 1 udp 2122063615 10.0.75.1 53634 typ host generation 0 ufrag abcd","usernameFragment":"abcd"}]`, string(raw))
+
+	// As sent by a browser, the ufrag comes from usernameFragment
+	parsed, err = UnmarshalCandidateJSON([]byte(`{"candidate":"candidate:842163049 1 udp 1677729535 203.0.113.7 61665 typ srflx raddr 0.0.0.0 rport 0 generation 0","sdpMid":"0","sdpMLineIndex":0,"usernameFragment":"efgh"}`))
+	require.NoError(t, err)
+	assert.Equal(t, CandidateTypeServerReflexive, parsed.Type())
+	ext, ok := parsed.GetExtension("ufrag")
+	assert.True(t, ok)
+	assert.Equal(t, "efgh", ext.Value)
+
+	mid, index := "0", uint16(0)
+	init := NewCandidateInit(parsed)
+	init.SDPMid, init.SDPMLineIndex = &mid, &index
+	raw, err = json.Marshal(init)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"candidate":"candidate:842163049 1 udp 1677729535 203.0.113.7 61665 typ srflx generation 0 ufrag efgh","sdpMid":"0","sdpMLineIndex":0,"usernameFragment":"efgh"}`, string(raw))
+
+	// End-of-candidates
+	for _, endOfCandidates := range []string{`{"candidate":""}`, `{"candidate":"","sdpMid":"0"}`} {
+		parsed, err = UnmarshalCandidateJSON([]byte(endOfCandidates))
+		assert.NoError(t, err)
+		assert.Nil(t, parsed)
+	}
+
+	for _, invalid := range []string{`{"candidate":"candidate:1938809241"}`, `{"candidate":1}`, `[`} {
+		_, err = UnmarshalCandidateJSON([]byte(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
@@ -1,10 +1,14 @@
 package ice
 
 import (
+	"context"
+	"net"
 	"testing"
 	"time"
 
+	"github.com/pion/transport/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCandidatePriority(t *testing.T) {
@@ -121,6 +125,94 @@ func TestCandidatePriority(t *testing.T) {
 	}
 }
 
+func TestCandidateTypePreferences(t *testing.T) {
+	a, err := NewAgent(&AgentConfig{
+		TypePreferences: map[CandidateType]uint16{
+			CandidateTypeServerReflexive: 126,
+			CandidateTypeHost:            100,
+		},
+	})
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	host := &CandidateHost{candidateBase: candidateBase{candidateType: CandidateTypeHost, component: ComponentRTP, currAgent: a}}
+	srflx := &CandidateServerReflexive{candidateBase: candidateBase{candidateType: CandidateTypeServerReflexive, component: ComponentRTP, currAgent: a}}
+	relay := &CandidateRelay{candidateBase: candidateBase{candidateType: CandidateTypeRelay, component: ComponentRTP, currAgent: a}}
+	assert.Equal(t, uint32(1694498815), host.Priority())
+	assert.Equal(t, uint32(2130706431), srflx.Priority())
+	assert.Equal(t, uint32(16777215), relay.Priority())
+
+	_, err = NewAgent(&AgentConfig{
+		TypePreferences: map[CandidateType]uint16{CandidateTypeRelay: 127},
+	})
+	assert.ErrorIs(t, err, ErrInvalidTypePreference)
+}
+
+func TestCandidateFoundationAndLocalPreferenceFunc(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	var passed []Candidate
+	a, err := NewAgent(&AgentConfig{
+		FoundationFunc: func(c Candidate) string {
+			passed = append(passed, c)
+			return c.Type().String() + DefaultFoundation(c)
+		},
+		LocalPreferenceFunc: func(c Candidate) uint16 {
+			if c.Address() == "127.0.0.1" {
+				return 100
+			}
+			return DefaultLocalPreference(c)
+		},
+	})
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	addHost := func(address, foundation string) *CandidateHost {
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		assert.NoError(t, err)
+		c, err := NewCandidateHost(&CandidateHostConfig{
+			Network:    "udp",
+			Address:    address,
+			Port:       conn.LocalAddr().(*net.UDPAddr).Port, //nolint:forcetypeassert
+			Component:  ComponentRTP,
+			Foundation: foundation,
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, a.addCandidate(context.Background(), c, conn))
+		return c
+	}
+	preferred, other := addHost("127.0.0.1", ""), addHost("10.0.0.3", "")
+
+	// The functions are passed the candidates, not their base
+	assert.Equal(t, []Candidate{preferred, other}, passed)
+	assert.Equal(t, "host"+DefaultFoundation(preferred), preferred.Foundation())
+	assert.Equal(t, uint16(100), preferred.LocalPreference())
+	assert.Equal(t, uint16(defaultLocalPreference), other.LocalPreference())
+	assert.Less(t, preferred.Priority(), other.Priority())
+
+	// An explicit foundation is kept
+	explicit := addHost("10.0.0.4", "1")
+	assert.Equal(t, "1", explicit.Foundation())
+	assert.Len(t, passed, 2)
+}
+
+func TestCandidateOrigin(t *testing.T) {
+	remote, err := UnmarshalCandidate("1 1 udp 2130706431 10.0.0.2 5000 typ host")
+	assert.NoError(t, err)
+	assert.Equal(t, "", remote.Origin())
+
+	c := &CandidateHost{}
+	c.setGatherInfo(candidateGatherInfo{started: time.Now()})
+	assert.Equal(t, CandidateOriginLocal, c.Origin())
+	c.setGatherInfo(candidateGatherInfo{url: "stun:stun.example.com:3478", started: time.Now()})
+	assert.Equal(t, "stun:stun.example.com:3478", c.Origin())
+}
+
 func TestCandidateLastSent(t *testing.T) {
 	candidate := candidateBase{}
 	assert.Equal(t, candidate.LastSent(), time.Time{})
@@ -311,6 +403,23 @@ func TestCandidateMarshal(t *testing.T) {
 			false,
 		},
 
+		// Extensions are kept, after the related address and tcptype
+		{
+			&CandidateServerReflexive{
+				candidateBase{
+					networkType:    NetworkTypeTCP4,
+					candidateType:  CandidateTypeServerReflexive,
+					address:        "191.228.238.68",
+					port:           53991,
+					relatedAddress: &CandidateRelatedAddress{"192.168.0.274", 53991},
+					tcpType:        TCPTypePassive,
+					extensions:     []CandidateExtension{{"generation", "0"}, {"network-id", "3"}},
+				},
+			},
+			"2166226235 1 tcp 1694498815 191.228.238.68 53991 typ srflx raddr 192.168.0.274 rport 53991 tcptype passive generation 0 network-id 3",
+			false,
+		},
+
 		// Invalid candidates
 		{nil, "", true},
 		{nil, "1938809241", true},
@@ -324,6 +433,8 @@ func TestCandidateMarshal(t *testing.T) {
 		{nil, "4207374051 INVALID udp 2130706431 10.0.75.1 INVALID typ host", true},
 		{nil, "4207374051 1 udp 2130706431 10.0.75.1 53634 typ INVALID", true},
 		{nil, "4207374051 1 INVALID 2130706431 10.0.75.1 53634 typ host", true},
+		{nil, "4207374051 1 udp 2130706431 10.0.75.1 53634 typ host generation", true},
+		{nil, "4207374051 1 udp 1685790463 191.228.238.68 53991 typ srflx raddr 192.168.0.278 port 53991", true},
 	} {
 		actualCandidate, err := UnmarshalCandidate(test.marshaled)
 		if test.expectError {
@@ -336,4 +447,92 @@ func TestCandidateMarshal(t *testing.T) {
 		assert.True(t, test.candidate.Equal(actualCandidate))
 		assert.Equal(t, test.marshaled, actualCandidate.Marshal())
 	}
+
+	// Older versions marshaled tcptype before the related address
+	c, err := UnmarshalCandidate("2166226235 1 tcp 1694498815 191.228.238.68 53991 typ srflx tcptype passive raddr 192.168.0.274 rport 53991 generation 0")
+	require.NoError(t, err)
+	assert.Equal(t, &CandidateRelatedAddress{"192.168.0.274", 53991}, c.RelatedAddress())
+	assert.Equal(t, TCPTypePassive, c.TCPType())
+	assert.Equal(t, []CandidateExtension{{"generation", "0"}}, c.Extensions())
+	assert.Equal(t, "2166226235 1 tcp 1694498815 191.228.238.68 53991 typ srflx raddr 192.168.0.274 rport 53991 tcptype passive generation 0", c.Marshal())
+}
+
+func TestCandidateExtensions(t *testing.T) {
+	c, err := UnmarshalCandidate("a=candidate:1986380506 1 udp 2122063615 10.0.75.1 53634 typ host generation 0 ufrag abcd network-id 2")
+	assert.NoError(t, err)
+	assert.Equal(t, []CandidateExtension{{"generation", "0"}, {"ufrag", "abcd"}, {"network-id", "2"}}, c.Extensions())
+	assert.Equal(t, "1986380506 1 udp 2122063615 10.0.75.1 53634 typ host generation 0 ufrag abcd network-id 2", c.Marshal())
+
+	ext, ok := c.GetExtension("ufrag")
+	assert.True(t, ok)
+	assert.Equal(t, "abcd", ext.Value)
+	_, ok = c.GetExtension("network-cost")
+	assert.False(t, ok)
+
+	// Adding an existing key replaces its value in place
+	assert.NoError(t, c.AddExtension(CandidateExtension{"generation", "1"}))
+	assert.NoError(t, c.AddExtension(CandidateExtension{"network-cost", "10"}))
+	assert.Equal(t, "1986380506 1 udp 2122063615 10.0.75.1 53634 typ host generation 1 ufrag abcd network-id 2 network-cost 10", c.Marshal())
+
+	for _, ext := range []CandidateExtension{{"", "1"}, {"key", ""}, {"key", "a b"}, {"raddr", "10.0.0.1"}} {
+		assert.Error(t, c.AddExtension(ext))
+	}
+
+	// Extensions survive a copy
+	copied, err := c.copy()
+	assert.NoError(t, err)
+	assert.Equal(t, c.Extensions(), copied.Extensions())
+}
+
+func TestUnmarshalCandidateLenient(t *testing.T) {
+	for _, test := range []struct {
+		raw            string
+		strictError    bool
+		candidateType  CandidateType
+		relatedAddress *CandidateRelatedAddress
+		marshaled      string
+	}{
+		{
+			"4207374051 1 udp 1685790463 191.228.238.68 53991 typ srflx raddr 192.168.0.1 generation 0",
+			true,
+			CandidateTypeServerReflexive,
+			&CandidateRelatedAddress{"192.168.0.1", 0},
+			// Marshal omits a related address without port
+			"4207374051 1 udp 1685790463 191.228.238.68 53991 typ srflx generation 0",
+		},
+		{
+			"4207374051 1 udp 1685790463 191.228.238.68 53991 typ SRFLX raddr 192.168.0.1 rport 53991",
+			true,
+			CandidateTypeServerReflexive,
+			&CandidateRelatedAddress{"192.168.0.1", 53991},
+			"4207374051 1 udp 1685790463 191.228.238.68 53991 typ srflx raddr 192.168.0.1 rport 53991",
+		},
+		{
+			"4207374051 1 udp 0 10.0.75.1 53634 typ host",
+			false,
+			CandidateTypeHost,
+			nil,
+			"4207374051 1 udp 2130706431 10.0.75.1 53634 typ host",
+		},
+		{
+			"4207374051 1 udp 2130706431 10.0.75.1 53634 typ unknown generation",
+			true,
+			CandidateTypeHost,
+			nil,
+			"4207374051 1 udp 2130706431 10.0.75.1 53634 typ host",
+		},
+	} {
+		if _, err := UnmarshalCandidate(test.raw); test.strictError {
+			assert.Error(t, err, test.raw)
+		}
+
+		c, err := UnmarshalCandidateLenient(test.raw)
+		assert.NoError(t, err, test.raw)
+		assert.Equal(t, test.candidateType, c.Type())
+		assert.Equal(t, test.relatedAddress, c.RelatedAddress())
+		assert.Equal(t, test.marshaled, c.Marshal())
+	}
+
+	_, err := UnmarshalCandidateLenient("4207374051 1 udp 2130706431 10.0.75.1 INVALID typ host")
+	assert.Error(t, err)
 }
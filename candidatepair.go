@@ -2,6 +2,7 @@ package ice
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/pion/stun"
 )
@@ -25,6 +26,32 @@ type CandidatePair struct {
 	state                    CandidatePairState
 	nominated                bool
 	nominateOnBindingSuccess bool
+
+	lastErrorCode   stun.ErrorCode
+	lastErrorReason string
+	lastErrorTime   time.Time
+	errorResponses  uint64
+	icmpErr         error
+
+	// Responses discarded by matchBindingResponse
+	unmatchedResponses  uint64
+	duplicateResponses  uint64
+	mismatchedResponses uint64
+
+	rttHistogram *rttHistogram
+
+	// deferredChecks counts the checks deferred by MaxChecksPerRemoteIP
+	deferredChecks uint64
+
+	// lastKeepalive is when the pair was last kept alive, as the selected
+	// pair or as a standby pair
+	lastKeepalive time.Time
+
+	// consentRequested is when the oldest unanswered consent check of the
+	// selected pair was sent, zero once one is answered
+	consentRequested time.Time
+
+	bindingRequestTemplate *bindingRequestTemplate
 }
 
 func (p *CandidatePair) String() string {
@@ -92,6 +119,14 @@ func (p *CandidatePair) Write(b []byte) (int, error) {
 }
 
 func (a *Agent) sendSTUN(msg *stun.Message, local, remote Candidate) {
+	if !a.checkResponseRoute(msg, local, remote) {
+		return
+	}
+	a.traceSTUNMessage(STUNMessageDirectionOutbound, msg, local.addr(), remote.addr())
+	if a.stunFaults.appliesTo(STUNMessageDirectionOutbound) {
+		a.injectOutboundSTUNFault(msg, local, remote)
+		return
+	}
 	_, err := local.writeTo(msg.Raw, remote)
 	if err != nil {
 		a.log.Tracef("failed to send STUN message: %s", err)
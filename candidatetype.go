@@ -1,5 +1,11 @@
 package ice
 
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
 // CandidateType represents the type of candidate
 type CandidateType byte
 
@@ -26,6 +32,9 @@ func (c CandidateType) String() string {
 	case CandidateTypeUnspecified:
 		return "Unknown candidate type"
 	}
+	if custom, ok := lookupCandidateType(c); ok {
+		return custom.name
+	}
 	return "Unknown candidate type"
 }
 
@@ -46,9 +55,140 @@ func (c CandidateType) Preference() uint16 {
 	case CandidateTypeRelay, CandidateTypeUnspecified:
 		return 0
 	}
+	if custom, ok := lookupCandidateType(c); ok {
+		return custom.preference
+	}
 	return 0
 }
 
+// firstCustomCandidateType is the first CandidateType returned by
+// RegisterCandidateType.
+const firstCustomCandidateType CandidateType = 128
+
+type customCandidateType struct {
+	name       string
+	preference uint16
+}
+
+// customCandidateTypes are the types registered with RegisterCandidateType,
+// from firstCustomCandidateType.
+var customCandidateTypes struct { //nolint:gochecknoglobals
+	sync.RWMutex
+	types []customCandidateType
+}
+
+// RegisterCandidateType registers a candidate type defined by the
+// application, e.g. for the candidates of an overlay network tunneling
+// through relays of its own, and returns it. name is the candidate-type of
+// the candidates in the candidate attribute, preference their type
+// preference, at most 126.
+//
+// A registered type is a label, not an implementation: Candidate can not be
+// implemented outside this package. Candidates of the type are created with
+// NewCandidateCustom and added to an agent with AddLocalCandidate along with
+// the PacketConn they send and receive on, which is where the application
+// plugs in its transport. They are paired and checked like the built-in
+// types. A controlling agent waits before nominating their pairs as it does
+// for the candidates of the gathered type whose preference is the highest
+// at or below theirs: HostAcceptanceMinWait, SrflxAcceptanceMinWait, or
+// RelayAcceptanceMinWait below the preference of srflx. The peer must
+// register the type as well to unmarshal the candidates. Types are
+// registered for the lifetime of the process, e.g. in an init function.
+func RegisterCandidateType(name string, preference uint16) (CandidateType, error) {
+	if !isCandidateTypeToken(name) {
+		return CandidateTypeUnspecified, fmt.Errorf("%w: %q", ErrInvalidCandidateTypeName, name)
+	}
+	if preference > maxTypePreference {
+		return CandidateTypeUnspecified, fmt.Errorf("%w: %s %d", ErrInvalidTypePreference, name, preference)
+	}
+	switch name {
+	case "host", "srflx", "prflx", "relay":
+		return CandidateTypeUnspecified, fmt.Errorf("%w: %s is built-in", ErrInvalidCandidateTypeName, name)
+	}
+
+	customCandidateTypes.Lock()
+	defer customCandidateTypes.Unlock()
+
+	for _, custom := range customCandidateTypes.types {
+		if custom.name == name {
+			return CandidateTypeUnspecified, fmt.Errorf("%w: %s", ErrCandidateTypeRegistered, name)
+		}
+	}
+	if len(customCandidateTypes.types) > int(^CandidateType(0)-firstCustomCandidateType) {
+		return CandidateTypeUnspecified, ErrCandidateTypeLimit
+	}
+	customCandidateTypes.types = append(customCandidateTypes.types, customCandidateType{name, preference})
+	return firstCustomCandidateType + CandidateType(len(customCandidateTypes.types)-1), nil
+}
+
+// lookupCandidateType returns the registered type t.
+func lookupCandidateType(t CandidateType) (customCandidateType, bool) {
+	if t < firstCustomCandidateType {
+		return customCandidateType{}, false
+	}
+
+	customCandidateTypes.RLock()
+	defer customCandidateTypes.RUnlock()
+
+	if i := int(t - firstCustomCandidateType); i < len(customCandidateTypes.types) {
+		return customCandidateTypes.types[i], true
+	}
+	return customCandidateType{}, false
+}
+
+// lookupCandidateTypeName returns the registered type named name.
+func lookupCandidateTypeName(name string) (CandidateType, bool) {
+	customCandidateTypes.RLock()
+	defer customCandidateTypes.RUnlock()
+
+	for i, custom := range customCandidateTypes.types {
+		if custom.name == name {
+			return firstCustomCandidateType + CandidateType(i), true
+		}
+	}
+	return CandidateTypeUnspecified, false
+}
+
+// isCandidateTypeToken reports whether name is a token (RFC 4566, Section
+// 9), as the candidate-type of RFC 8839.
+func isCandidateTypeToken(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		isAlnum := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+		if !isAlnum && !strings.ContainsRune("!#$%&'*+-.^_`{|}~", r) {
+			return false
+		}
+	}
+	return true
+}
+
+const maxTypePreference = 126
+
+func (config *AgentConfig) initTypePreferences(a *Agent) error {
+	if len(config.TypePreferences) == 0 {
+		return nil
+	}
+	a.typePreferences = make(map[CandidateType]uint16, len(config.TypePreferences))
+	for t, pref := range config.TypePreferences {
+		if pref > maxTypePreference {
+			return fmt.Errorf("%w: %s %d", ErrInvalidTypePreference, t, pref)
+		}
+		a.typePreferences[t] = pref
+	}
+	return nil
+}
+
+// typePreference returns the type preference of local candidates of type t,
+// see AgentConfig.TypePreferences.
+func (a *Agent) typePreference(t CandidateType) uint16 {
+	if pref, ok := a.typePreferences[t]; ok {
+		return pref
+	}
+	return t.Preference()
+}
+
 func containsCandidateType(candidateType CandidateType, candidateTypeList []CandidateType) bool {
 	if candidateTypeList == nil {
 		return false
@@ -0,0 +1,43 @@
+package ice
+
+// checksInFlight counts the binding requests awaiting a response per remote
+// IP, or returns nil if AgentConfig.MaxChecksPerRemoteIP is not set.
+//
+// Note: the caller should hold the agent lock.
+func (a *Agent) checksInFlight() map[string]int {
+	if a.maxChecksPerRemoteIP <= 0 {
+		return nil
+	}
+
+	a.invalidatePendingBindingRequests(a.clock.Now())
+	inFlight := map[string]int{}
+	for _, req := range a.pendingBindingRequests {
+		if ip, _, _, ok := parseAddr(req.destination); ok {
+			inFlight[ip.String()]++
+		}
+	}
+	return inFlight
+}
+
+// deferCheck reports whether the check of p must wait for the checks in
+// flight towards its remote IP. Otherwise the check is counted in inFlight,
+// as it is about to be sent.
+//
+// Note: the caller should hold the agent lock.
+func (a *Agent) deferCheck(p *CandidatePair, inFlight map[string]int) bool {
+	if inFlight == nil {
+		return false
+	}
+	ip, _, _, ok := parseAddr(p.Remote.addr())
+	if !ok {
+		return false
+	}
+
+	key := ip.String()
+	if inFlight[key] >= a.maxChecksPerRemoteIP {
+		p.deferredChecks++
+		return true
+	}
+	inFlight[key]++
+	return false
+}
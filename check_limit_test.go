@@ -0,0 +1,73 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxChecksPerRemoteIP(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	clock := NewManualClock(time.Now())
+	a, err := NewAgent(&AgentConfig{
+		NetworkTypes:         []NetworkType{NetworkTypeUDP4},
+		Clock:                clock,
+		MaxChecksPerRemoteIP: 1,
+	})
+	require.NoError(t, err)
+
+	local, err := NewCandidateHost(&CandidateHostConfig{Network: "udp", Address: "192.0.2.1", Port: 1000, Component: 1})
+	require.NoError(t, err)
+	local.conn = &mockPacketConn{}
+
+	var pairs []*CandidatePair
+	for _, remote := range []struct {
+		address string
+		port    int
+	}{{"198.51.100.1", 2000}, {"198.51.100.1", 2001}, {"198.51.100.2", 2000}} {
+		c, err := NewCandidateHost(&CandidateHostConfig{Network: "udp", Address: remote.address, Port: remote.port, Component: 1})
+		require.NoError(t, err)
+		pairs = append(pairs, newCandidatePair(local, c, true))
+	}
+
+	pingAll := func() []uint16 {
+		var counts []uint16
+		require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+			agent.pingAllCandidates()
+			for _, p := range pairs {
+				counts = append(counts, p.bindingRequestCount)
+			}
+		}))
+		return counts
+	}
+
+	require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+		agent.selector = &controllingSelector{agent: agent, log: agent.log}
+		agent.checklist = pairs
+	}))
+
+	// The second pair waits for the check of the first, towards the same IP
+	assert.Equal(t, []uint16{1, 0, 1}, pingAll())
+	assert.Equal(t, []uint16{1, 0, 1}, pingAll())
+
+	// Unanswered checks stop counting once they time out
+	clock.Advance(maxBindingRequestTimeout)
+	assert.Equal(t, []uint16{2, 0, 2}, pingAll())
+
+	var deferred []uint64
+	for _, stat := range a.GetCandidatePairsStats() {
+		deferred = append(deferred, stat.DeferredChecks)
+	}
+	assert.Equal(t, []uint64{1, 3, 1}, deferred)
+
+	assert.NoError(t, a.Close())
+}
@@ -0,0 +1,98 @@
+package ice
+
+import (
+	"sync"
+	"time"
+)
+
+// checkPacerIdleTimeout is how long an agent that asked for no check keeps
+// its share of a CheckPacer.
+const checkPacerIdleTimeout = time.Second
+
+// CheckPacer paces the connectivity checks of the agents sharing it, e.g.
+// all the agents of a process, see AgentConfig.CheckPacer. When hundreds of
+// agents start their checks at once, such as on a mass reconnect after a
+// server restart, each round of checks of an agent sends at most its fair
+// share of the checks the pacer allows, so the checks of the agents are
+// interleaved instead of sent in bursts that overwhelm the uplink. The
+// checks of the other pairs are deferred to the next rounds, and counted in
+// CandidatePairStats.DeferredChecks. Nominations and keepalives are not
+// paced.
+type CheckPacer struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	// active holds when each agent sharing the pacer last asked for checks
+	active map[*Agent]time.Time
+}
+
+// NewCheckPacer creates a CheckPacer allowing checksPerSecond checks per
+// second on average, and up to burst checks at once.
+func NewCheckPacer(checksPerSecond, burst int) *CheckPacer {
+	if burst < 1 {
+		burst = 1
+	}
+	return &CheckPacer{
+		rate:   float64(checksPerSecond),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		active: map[*Agent]time.Time{},
+	}
+}
+
+// acquire returns how many of the want checks a may send now, at most its
+// share of the checks allowed between the agents asking for checks.
+func (p *CheckPacer) acquire(a *Agent, want int, now time.Time) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.last.IsZero() && now.After(p.last) {
+		p.tokens += now.Sub(p.last).Seconds() * p.rate
+		if p.tokens > p.burst {
+			p.tokens = p.burst
+		}
+	}
+	if now.After(p.last) {
+		p.last = now
+	}
+
+	p.active[a] = now
+	for agent, last := range p.active {
+		if now.Sub(last) > checkPacerIdleTimeout {
+			delete(p.active, agent)
+		}
+	}
+
+	// With fewer checks allowed than agents, the first agents to ask get
+	// one each
+	share := int(p.tokens) / len(p.active)
+	if share == 0 && p.tokens >= 1 {
+		share = 1
+	}
+	if want > share {
+		want = share
+	}
+	p.tokens -= float64(want)
+	return want
+}
+
+// remove releases the share of a closed agent.
+func (p *CheckPacer) remove(a *Agent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.active, a)
+}
+
+// paceChecks returns how many of the want checks of the round the agent may
+// send now, want if it has no CheckPacer.
+//
+// Note: the caller should hold the agent lock.
+func (a *Agent) paceChecks(want int) int {
+	if a.checkPacer == nil || want == 0 {
+		return want
+	}
+	return a.checkPacer.acquire(a, want, a.clock.Now())
+}
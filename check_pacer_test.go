@@ -0,0 +1,103 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckPacerShares(t *testing.T) {
+	now := time.Now()
+	p := NewCheckPacer(10, 4)
+	a, b, c := &Agent{}, &Agent{}, &Agent{}
+
+	// Alone, a gets the whole burst
+	assert.Equal(t, 4, p.acquire(a, 10, now))
+	assert.Equal(t, 0, p.acquire(a, 10, now))
+
+	// Once b asks too, they split the checks allowed
+	now = now.Add(400 * time.Millisecond)
+	assert.Equal(t, 2, p.acquire(b, 10, now))
+	assert.Equal(t, 1, p.acquire(a, 10, now))
+	assert.Equal(t, 1, p.acquire(b, 10, now))
+
+	// With fewer checks allowed than agents, the first ones get one
+	now = now.Add(200 * time.Millisecond)
+	assert.Equal(t, 1, p.acquire(c, 10, now))
+	assert.Equal(t, 1, p.acquire(a, 10, now))
+	assert.Equal(t, 0, p.acquire(b, 10, now))
+
+	// Agents that stop asking, or are closed, no longer get a share
+	now = now.Add(checkPacerIdleTimeout / 2)
+	assert.Equal(t, 1, p.acquire(a, 10, now))
+	p.remove(b)
+	now = now.Add(checkPacerIdleTimeout + time.Millisecond)
+	assert.Equal(t, 4, p.acquire(c, 10, now))
+	assert.Len(t, p.active, 1)
+}
+
+func TestCheckPacer(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	clock := NewManualClock(time.Now())
+	a, err := NewAgent(&AgentConfig{
+		NetworkTypes: []NetworkType{NetworkTypeUDP4},
+		Clock:        clock,
+		CheckPacer:   NewCheckPacer(10, 2),
+	})
+	require.NoError(t, err)
+
+	local, err := NewCandidateHost(&CandidateHostConfig{Network: "udp", Address: "192.0.2.1", Port: 1000, Component: 1})
+	require.NoError(t, err)
+	local.conn = &mockPacketConn{}
+
+	var pairs []*CandidatePair
+	for _, port := range []int{2000, 2001, 2002} {
+		c, err := NewCandidateHost(&CandidateHostConfig{Network: "udp", Address: "198.51.100.1", Port: port, Component: 1})
+		require.NoError(t, err)
+		pairs = append(pairs, newCandidatePair(local, c, true))
+	}
+
+	pingAll := func() []uint16 {
+		var counts []uint16
+		require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+			agent.pingAllCandidates()
+			for _, p := range pairs {
+				counts = append(counts, p.bindingRequestCount)
+			}
+		}))
+		return counts
+	}
+
+	require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+		agent.selector = &controllingSelector{agent: agent, log: agent.log}
+		agent.checklist = pairs
+	}))
+
+	// The check of the third pair waits for the pacer to allow it, then
+	// the pairs checked the least take turns
+	assert.Equal(t, []uint16{1, 1, 0}, pingAll())
+	assert.Equal(t, []uint16{1, 1, 0}, pingAll())
+	clock.Advance(100 * time.Millisecond)
+	assert.Equal(t, []uint16{1, 1, 1}, pingAll())
+	clock.Advance(100 * time.Millisecond)
+	assert.Equal(t, []uint16{2, 1, 1}, pingAll())
+	clock.Advance(100 * time.Millisecond)
+	assert.Equal(t, []uint16{2, 2, 1}, pingAll())
+
+	var deferred []uint64
+	for _, stat := range a.GetCandidatePairsStats() {
+		deferred = append(deferred, stat.DeferredChecks)
+	}
+	assert.Equal(t, []uint64{3, 3, 4}, deferred)
+
+	assert.NoError(t, a.Close())
+}
@@ -0,0 +1,141 @@
+package ice
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of time of an agent: connectivity check and keepalive
+// scheduling, disconnected and failed timeouts, acceptance waits and the
+// timestamps of candidates and stats. Socket deadlines keep using the system
+// clock. Tests and simulations may set AgentConfig.Clock to a ManualClock to
+// advance time synthetically.
+type Clock interface {
+	Now() time.Time
+
+	// AfterFunc calls f in its own goroutine once d elapsed, like time.AfterFunc
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a timer created by Clock.AfterFunc.
+type Timer interface {
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// systemClock is the default Clock, backed by the time package.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// ManualClock is a Clock only moving forward when Advance is called. Timers
+// due immediately, e.g. the connectivity checks requested when a remote
+// candidate is added, also wait for a call to Advance, with 0 to run them
+// without moving the clock.
+type ManualClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*manualTimer
+}
+
+// NewManualClock returns a ManualClock set to now.
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+// Now returns the current time of the clock.
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// AfterFunc returns a timer calling f once the clock is advanced by d.
+func (c *ManualClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &manualTimer{clock: c, f: f, when: c.now.Add(d), active: true}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward by d, calling the functions of the timers
+// expiring meanwhile in order, each with the clock set to its expiry. Unlike
+// time.AfterFunc, the functions are called on the goroutine of Advance: it
+// returns once they did, timers they reset within d included.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	for {
+		next := c.nextTimer(end)
+		if next == nil {
+			break
+		}
+		if next.when.After(c.now) {
+			c.now = next.when
+		}
+		next.active = false
+		c.mu.Unlock()
+		next.f()
+		c.mu.Lock()
+	}
+	c.now = end
+	c.mu.Unlock()
+}
+
+// nextTimer returns the active timer expiring first, if it expires by end.
+// Note: the caller should hold c.mu.
+func (c *ManualClock) nextTimer(end time.Time) *manualTimer {
+	var next *manualTimer
+	active := c.timers[:0]
+	for _, t := range c.timers {
+		if !t.active {
+			continue
+		}
+		active = append(active, t)
+		if !t.when.After(end) && (next == nil || t.when.Before(next.when)) {
+			next = t
+		}
+	}
+	c.timers = active
+	return next
+}
+
+type manualTimer struct {
+	clock  *ManualClock
+	f      func()
+	when   time.Time
+	active bool
+}
+
+func (t *manualTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	wasActive := t.active
+	t.active = false
+	return wasActive
+}
+
+func (t *manualTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	wasActive := t.active
+	t.when = t.clock.now.Add(d)
+	t.active = true
+	for _, queued := range t.clock.timers {
+		if queued == t {
+			return wasActive
+		}
+	}
+	t.clock.timers = append(t.clock.timers, t)
+	return wasActive
+}
@@ -0,0 +1,101 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManualClock(t *testing.T) {
+	start := time.Unix(1000, 0)
+	c := NewManualClock(start)
+
+	var fired []time.Duration
+	record := func() {
+		fired = append(fired, c.Now().Sub(start))
+	}
+
+	c.AfterFunc(3*time.Second, record)
+	c.AfterFunc(time.Second, record)
+	stopped := c.AfterFunc(2*time.Second, record)
+	assert.True(t, stopped.Stop())
+	assert.False(t, stopped.Stop())
+
+	c.Advance(500 * time.Millisecond)
+	assert.Empty(t, fired)
+	assert.Equal(t, start.Add(500*time.Millisecond), c.Now())
+
+	c.Advance(5 * time.Second)
+	assert.Equal(t, []time.Duration{time.Second, 3 * time.Second}, fired)
+	assert.Equal(t, start.Add(5500*time.Millisecond), c.Now())
+
+	// A timer reset by its function fires again within the same Advance
+	fired = nil
+	var ticker Timer
+	ticker = c.AfterFunc(0, func() {
+		fired = append(fired, c.Now().Sub(start))
+		ticker.Reset(time.Second)
+	})
+	c.Advance(2 * time.Second)
+	assert.Equal(t, []time.Duration{5500 * time.Millisecond, 6500 * time.Millisecond, 7500 * time.Millisecond}, fired)
+	assert.True(t, ticker.Stop())
+}
+
+func TestAgentManualClockFailedTimeout(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	checkInterval := 100 * time.Millisecond
+	disconnectedTimeout := 5 * time.Second
+	failedTimeout := 25 * time.Second
+	clock := NewManualClock(time.Now())
+
+	a, err := NewAgent(&AgentConfig{
+		Clock:               clock,
+		CheckInterval:       &checkInterval,
+		DisconnectedTimeout: &disconnectedTimeout,
+		FailedTimeout:       &failedTimeout,
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	failed := make(chan struct{})
+	require.NoError(t, a.OnConnectionStateChange(func(s ConnectionState) {
+		if s == ConnectionStateFailed {
+			close(failed)
+		}
+	}))
+
+	require.NoError(t, a.startConnectivityChecks(context.Background(), true, "ufrag", "pwdpwdpwdpwdpwdpwdpwdpwd"))
+
+	connectionState := func() (s ConnectionState) {
+		require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+			s = agent.connectionState
+		}))
+		return
+	}
+
+	// The timeouts run from the first round of checks, requested as when a
+	// remote candidate is added
+	a.requestConnectivityCheck()
+	clock.Advance(0)
+	clock.Advance(disconnectedTimeout + failedTimeout - checkInterval)
+	assert.Equal(t, ConnectionState(ConnectionStateChecking), connectionState())
+
+	clock.Advance(2 * checkInterval)
+	assert.Equal(t, ConnectionState(ConnectionStateFailed), connectionState())
+	select {
+	case <-failed:
+	case <-time.After(time.Second):
+		t.Fatal("failed state not notified")
+	}
+}
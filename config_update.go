@@ -0,0 +1,80 @@
+package ice
+
+import (
+	"context"
+	"time"
+)
+
+// AgentConfigUpdate holds the settings of a running agent that UpdateConfig
+// can change, the nil fields are left unchanged.
+type AgentConfigUpdate struct {
+	// Urls replaces AgentConfig.Urls for the next gatherings, an empty
+	// non-nil slice removes all the STUN and TURN servers.
+	Urls []*URL
+
+	// KeepaliveInterval replaces AgentConfig.KeepaliveInterval from the
+	// next keepalive on. KeepaliveIdleTimeout and StandbyKeepaliveInterval
+	// follow it if they were left to their default.
+	KeepaliveInterval *time.Duration
+
+	// CheckInterval replaces AgentConfig.CheckInterval, the pace of the
+	// connectivity checks, from the next round of checks on.
+	CheckInterval *time.Duration
+
+	// InterfaceFilter replaces AgentConfig.InterfaceFilter for the next
+	// gatherings and active ICE-TCP connections. A filter returning true
+	// for every interface lifts the restriction.
+	InterfaceFilter func(string) bool
+}
+
+// UpdateConfig applies update to the agent without interrupting it. The
+// candidates already gathered and the pairs already checked are kept, the
+// changes apply to the future gatherings and checks.
+func (a *Agent) UpdateConfig(update *AgentConfigUpdate) error {
+	if err := a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		if update.KeepaliveInterval != nil {
+			if agent.keepaliveIdleTimeoutDefault {
+				agent.keepaliveIdleTimeout = *update.KeepaliveInterval
+			}
+			if agent.standbyKeepaliveIntervalDefault {
+				agent.standbyKeepaliveInterval = *update.KeepaliveInterval
+			}
+			agent.keepaliveInterval = *update.KeepaliveInterval
+		}
+		if update.CheckInterval != nil {
+			agent.checkInterval = *update.CheckInterval
+		}
+	}); err != nil {
+		return err
+	}
+
+	a.muConfig.Lock()
+	if update.Urls != nil {
+		a.urls = append([]*URL(nil), update.Urls...)
+	}
+	if update.InterfaceFilter != nil {
+		a.interfaceFilter = update.InterfaceFilter
+	}
+	a.muConfig.Unlock()
+
+	// Rearm the timer, a shorter interval must not wait for the longer one
+	if update.KeepaliveInterval != nil || update.CheckInterval != nil {
+		a.requestConnectivityCheck()
+	}
+	return nil
+}
+
+// getURLs returns the STUN and TURN servers of the agent.
+func (a *Agent) getURLs() []*URL {
+	a.muConfig.Lock()
+	defer a.muConfig.Unlock()
+	return a.urls
+}
+
+// getInterfaceFilter returns the interface filter of the agent, nil if
+// there is none.
+func (a *Agent) getInterfaceFilter() func(string) bool {
+	a.muConfig.Lock()
+	defer a.muConfig.Unlock()
+	return a.interfaceFilter
+}
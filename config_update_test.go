@@ -0,0 +1,62 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateConfig(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	// The standby interval is set, even if to the keepalive interval
+	keepaliveInterval, standbyInterval := 2*time.Second, 2*time.Second
+	a, err := NewAgent(&AgentConfig{
+		KeepaliveInterval:        &keepaliveInterval,
+		StandbyKeepaliveInterval: &standbyInterval,
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	stunURL, err := ParseURL("stun:stun.example.com:3478")
+	require.NoError(t, err)
+
+	checkInterval, newKeepaliveInterval := 50*time.Millisecond, time.Second
+	require.NoError(t, a.UpdateConfig(&AgentConfigUpdate{
+		Urls:              []*URL{stunURL},
+		KeepaliveInterval: &newKeepaliveInterval,
+		CheckInterval:     &checkInterval,
+		InterfaceFilter: func(string) bool {
+			return false
+		},
+	}))
+
+	assert.Equal(t, []*URL{stunURL}, a.getURLs())
+	assert.False(t, a.getInterfaceFilter()("eth0"))
+	addrs, err := a.transport.LocalAddrs()
+	require.NoError(t, err)
+	assert.Empty(t, addrs)
+	assert.Equal(t, checkInterval, a.connectivityCheckInterval(ConnectionStateChecking))
+	assert.Equal(t, newKeepaliveInterval, a.connectivityCheckInterval(ConnectionStateConnected))
+
+	// The settings left to their default follow the keepalive interval
+	assert.Equal(t, newKeepaliveInterval, a.keepaliveIdleTimeout)
+	assert.Equal(t, standbyInterval, a.standbyKeepaliveInterval)
+
+	// Nil fields are left unchanged
+	require.NoError(t, a.UpdateConfig(&AgentConfigUpdate{}))
+	assert.Equal(t, []*URL{stunURL}, a.getURLs())
+	assert.Equal(t, checkInterval, a.connectivityCheckInterval(ConnectionStateChecking))
+
+	require.NoError(t, a.UpdateConfig(&AgentConfigUpdate{Urls: []*URL{}}))
+	assert.Empty(t, a.getURLs())
+}
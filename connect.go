@@ -0,0 +1,142 @@
+package ice
+
+import (
+	"context"
+)
+
+// Signaler exchanges the credentials and candidates of an agent with the
+// remote agent, e.g. over a WebSocket to a signaling server. Its methods may
+// be called concurrently and must return when ctx is done.
+type Signaler interface {
+	// SendCredentials sends the local credentials to the remote agent
+	SendCredentials(ctx context.Context, ufrag, pwd string) error
+
+	// ReceiveCredentials waits for the credentials of the remote agent
+	ReceiveCredentials(ctx context.Context) (ufrag, pwd string, err error)
+
+	// SendCandidate trickles a local candidate to the remote agent, it is
+	// called with nil once gathering is complete.
+	SendCandidate(ctx context.Context, c Candidate) error
+
+	// ReceiveCandidate waits for the next candidate of the remote agent. It
+	// returns nil once the remote agent is done gathering.
+	ReceiveCandidate(ctx context.Context) (Candidate, error)
+}
+
+// signalingError is returned by Connect when the Signaler fails.
+type signalingError struct {
+	err error
+}
+
+func (e *signalingError) Error() string {
+	return ErrSignaling.Error() + ": " + e.err.Error()
+}
+
+func (e *signalingError) Is(target error) bool {
+	return target == ErrSignaling
+}
+
+func (e *signalingError) Unwrap() error {
+	return e.err
+}
+
+// Connect creates an agent for config, exchanges its credentials and
+// candidates with the remote agent through signaler while gathering, and
+// connects with role. It returns the established Conn, closing it closes the
+// agent. The candidates of the remote agent keep being received until then.
+//
+// If signaler fails the agent is closed and the returned error matches both
+// ErrSignaling and the error of signaler with errors.Is. If ctx is done first
+// it matches ErrCanceledByCaller, as for Dial and Accept.
+func Connect(ctx context.Context, config *AgentConfig, role Role, signaler Signaler) (*Conn, error) {
+	a, err := NewAgent(config)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The first failure of signaler, it cancels ctx
+	signalingErrs := make(chan error, 1)
+	fail := func(err error) {
+		select {
+		case signalingErrs <- &signalingError{err: err}:
+			cancel()
+		default:
+		}
+	}
+	closeWithError := func(err error) (*Conn, error) {
+		select {
+		case signalingErr := <-signalingErrs:
+			err = signalingErr
+		default:
+		}
+		if closeErr := a.Close(); closeErr != nil {
+			a.log.Warnf("Failed to close agent: %v", closeErr)
+		}
+		return nil, err
+	}
+
+	if err = a.OnCandidate(func(c Candidate) {
+		if sendErr := signaler.SendCandidate(a.context(), c); sendErr != nil {
+			a.log.Warnf("Failed to signal candidate %s: %v", c, sendErr)
+			fail(sendErr)
+		}
+	}); err != nil {
+		return closeWithError(err)
+	}
+
+	localUfrag, localPwd, err := a.GetLocalUserCredentials()
+	if err != nil {
+		return closeWithError(err)
+	}
+	if err = signaler.SendCredentials(ctx, localUfrag, localPwd); err != nil {
+		fail(err)
+		return closeWithError(err)
+	}
+	if err = a.GatherCandidates(); err != nil {
+		return closeWithError(err)
+	}
+
+	remoteUfrag, remotePwd, err := signaler.ReceiveCredentials(ctx)
+	if err != nil {
+		fail(err)
+		return closeWithError(err)
+	}
+
+	go a.receiveSignaledCandidates(signaler, fail)
+
+	var conn *Conn
+	if role == Controlling {
+		conn, err = a.Dial(ctx, remoteUfrag, remotePwd)
+	} else {
+		conn, err = a.Accept(ctx, remoteUfrag, remotePwd)
+	}
+	if err != nil {
+		return closeWithError(err)
+	}
+	return conn, nil
+}
+
+// receiveSignaledCandidates adds the candidates received by signaler until
+// the remote agent is done gathering or the agent is closed.
+func (a *Agent) receiveSignaledCandidates(signaler Signaler, fail func(error)) {
+	ctx := a.context()
+	for {
+		c, err := signaler.ReceiveCandidate(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				a.log.Warnf("Failed to receive remote candidate: %v", err)
+				fail(err)
+			}
+			return
+		}
+		if c == nil {
+			return
+		}
+		if err := a.AddRemoteCandidate(c); err != nil {
+			a.log.Warnf("Failed to add remote candidate %s: %v", c, err)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chanSignaler signals through channels shared with its peer, candidates are
+// marshaled as they would be on the wire.
+type chanSignaler struct {
+	sendCredentials, receiveCredentials chan [2]string
+	sendCandidates, receiveCandidates   chan string
+}
+
+func newChanSignalers() (*chanSignaler, *chanSignaler) {
+	aCredentials, bCredentials := make(chan [2]string, 1), make(chan [2]string, 1)
+	aCandidates, bCandidates := make(chan string, 64), make(chan string, 64)
+	return &chanSignaler{aCredentials, bCredentials, aCandidates, bCandidates},
+		&chanSignaler{bCredentials, aCredentials, bCandidates, aCandidates}
+}
+
+func (s *chanSignaler) SendCredentials(ctx context.Context, ufrag, pwd string) error {
+	select {
+	case s.sendCredentials <- [2]string{ufrag, pwd}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *chanSignaler) ReceiveCredentials(ctx context.Context) (string, string, error) {
+	select {
+	case credentials := <-s.receiveCredentials:
+		return credentials[0], credentials[1], nil
+	case <-ctx.Done():
+		return "", "", ctx.Err()
+	}
+}
+
+func (s *chanSignaler) SendCandidate(ctx context.Context, c Candidate) error {
+	var marshaled string
+	if c != nil {
+		marshaled = c.Marshal()
+	}
+	select {
+	case s.sendCandidates <- marshaled:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *chanSignaler) ReceiveCandidate(ctx context.Context) (Candidate, error) {
+	select {
+	case marshaled := <-s.receiveCandidates:
+		if marshaled == "" {
+			return nil, nil
+		}
+		return UnmarshalCandidate(marshaled)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type failingSignaler struct {
+	chanSignaler
+	err error
+}
+
+func (s *failingSignaler) ReceiveCredentials(context.Context) (string, string, error) {
+	return "", "", s.err
+}
+
+func TestConnect(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	config := &AgentConfig{NetworkTypes: supportedNetworkTypes()}
+	aSignaler, bSignaler := newChanSignalers()
+
+	type result struct {
+		conn *Conn
+		err  error
+	}
+	accepted := make(chan result)
+	go func() {
+		conn, err := Connect(ctx, config, Controlled, bSignaler)
+		accepted <- result{conn, err}
+	}()
+
+	aConn, err := Connect(ctx, config, Controlling, aSignaler)
+	require.NoError(t, err)
+	b := <-accepted
+	require.NoError(t, b.err)
+
+	msg := []byte("hello")
+	_, err = aConn.Write(msg)
+	require.NoError(t, err)
+	buf := make([]byte, len(msg))
+	_, err = b.conn.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, msg, buf)
+
+	assert.NoError(t, aConn.Close())
+	assert.NoError(t, b.conn.Close())
+}
+
+func TestConnectSignalingError(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	errSignaler := errors.New("signaling server unreachable")
+	a, _ := newChanSignalers()
+	signaler := &failingSignaler{chanSignaler: *a, err: errSignaler}
+
+	_, err := Connect(context.Background(), &AgentConfig{NetworkTypes: supportedNetworkTypes()}, Controlling, signaler)
+	assert.ErrorIs(t, err, ErrSignaling)
+	assert.ErrorIs(t, err, errSignaler)
+}
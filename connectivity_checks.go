@@ -0,0 +1,139 @@
+package ice
+
+import (
+	"context"
+	"time"
+)
+
+// Connectivity checks and keepalives are driven by a timer instead of a
+// goroutine per agent, the timer callback only runs (on a goroutine of its
+// own) when a check is due. An idle connected agent is thus left with its
+// taskLoop and the recvLoops of its candidates.
+
+// startConnectivityChecksTimer arms the timer for the first checks, a
+// pending requestConnectivityCheck makes them run immediately.
+func (a *Agent) startConnectivityChecksTimer() {
+	a.checkTimerMu.Lock()
+	defer a.checkTimerMu.Unlock()
+
+	if a.checkTimerStopped {
+		return
+	}
+
+	interval := a.connectivityCheckInterval(a.checksLastState)
+	if a.checkRequested {
+		interval = 0
+	}
+	a.checkTimer = a.clock.AfterFunc(interval, a.connectivityChecks)
+}
+
+// stopConnectivityChecks stops the timer, checks already running return
+// once the agent is closed.
+func (a *Agent) stopConnectivityChecks() {
+	a.checkTimerMu.Lock()
+	defer a.checkTimerMu.Unlock()
+
+	a.checkTimerStopped = true
+	if a.checkTimer != nil {
+		a.checkTimer.Stop()
+	}
+}
+
+func (a *Agent) requestConnectivityCheck() {
+	a.checkTimerMu.Lock()
+	defer a.checkTimerMu.Unlock()
+
+	a.checkRequested = true
+	if a.checkTimer != nil && !a.checkTimerStopped {
+		a.checkTimer.Reset(0)
+	}
+}
+
+func (a *Agent) connectivityChecks() {
+	a.checkTimerMu.Lock()
+	a.checkRequested = false
+	a.checkTimerMu.Unlock()
+
+	var interval time.Duration
+	if err := a.run(a.context(), func(ctx context.Context, a *Agent) {
+		a.contactCandidates()
+		interval = a.connectivityCheckInterval(a.checksLastState)
+	}); err != nil {
+		if a.ok() == nil {
+			a.log.Warnf("taskLoop failed: %v", err)
+		}
+		return
+	}
+
+	a.checkTimerMu.Lock()
+	defer a.checkTimerMu.Unlock()
+
+	if a.checkTimerStopped {
+		return
+	}
+	// A check requested while this one ran must not be postponed
+	if a.checkRequested {
+		interval = 0
+	}
+	a.checkTimer.Reset(interval)
+}
+
+// contactCandidates runs one round of connectivity checks or keepalives.
+// Note: the caller should hold the agent lock.
+func (a *Agent) contactCandidates() {
+	defer func() {
+		a.checksLastState = a.connectionState
+	}()
+
+	switch a.connectionState {
+	case ConnectionStateFailed:
+		// The connection is currently failed so don't send any checks
+		// In the future it may be restarted though
+		return
+	case ConnectionStateChecking:
+		// We have just entered checking for the first time so update our checking timer
+		if a.checksLastState != a.connectionState {
+			a.checkingStarted = a.clock.Now()
+		}
+
+		// We have been in checking longer then Disconnect+Failed timeout, set the connection to Failed
+		if a.clock.Now().Sub(a.checkingStarted) > a.disconnectedTimeout+a.failedTimeout {
+			a.updateConnectionState(ConnectionStateFailed, ConnectionStateChangeReasonChecksTimeout)
+			return
+		}
+	default:
+	}
+
+	a.selector.ContactCandidates()
+}
+
+// connectivityCheckInterval is the time until the next round of checks,
+// given the connection state during the last round.
+func (a *Agent) connectivityCheckInterval(lastConnectionState ConnectionState) time.Duration {
+	interval := defaultKeepaliveInterval
+
+	updateInterval := func(x time.Duration) {
+		if x != 0 && (interval == 0 || interval > x) {
+			interval = x
+		}
+	}
+
+	switch lastConnectionState {
+	case ConnectionStateNew, ConnectionStateChecking: // While connecting, check candidates more frequently
+		updateInterval(a.checkInterval)
+	case ConnectionStateConnected, ConnectionStateDisconnected:
+		updateInterval(a.keepaliveInterval)
+		if a.keepaliveInterval != 0 {
+			updateInterval(a.keepaliveIdleTimeout)
+		}
+		if a.keepaliveScope != KeepaliveScopeSelectedPair {
+			updateInterval(a.standbyKeepaliveInterval)
+		}
+	default:
+	}
+	// Ensure we run our task loop as quickly as the minimum of our various configured timeouts
+	updateInterval(a.disconnectedTimeout)
+	updateInterval(a.failedTimeout)
+
+	return interval
+}
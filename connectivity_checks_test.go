@@ -0,0 +1,27 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectivityCheckInterval(t *testing.T) {
+	a := &Agent{
+		checkInterval:       200 * time.Millisecond,
+		keepaliveInterval:   time.Second,
+		disconnectedTimeout: 5 * time.Second,
+		failedTimeout:       25 * time.Second,
+	}
+
+	assert.Equal(t, 200*time.Millisecond, a.connectivityCheckInterval(ConnectionStateChecking))
+	assert.Equal(t, time.Second, a.connectivityCheckInterval(ConnectionStateConnected))
+	assert.Equal(t, defaultKeepaliveInterval, a.connectivityCheckInterval(ConnectionStateFailed))
+
+	a.keepaliveInterval = 0
+	assert.Equal(t, defaultKeepaliveInterval, a.connectivityCheckInterval(ConnectionStateConnected))
+}
@@ -32,6 +32,7 @@ const (
 
 type virtualNet struct {
 	wan    *vnet.Router
+	wanNet *vnet.Net
 	net0   *vnet.Net
 	net1   *vnet.Net
 	server *turn.Server
@@ -142,6 +143,7 @@ func buildVNet(natType0, natType1 *vnet.NATType) (*virtualNet, error) {
 
 	return &virtualNet{
 		wan:    wan,
+		wanNet: wanNet,
 		net0:   net0,
 		net1:   net1,
 		server: server,
@@ -149,10 +151,14 @@ func buildVNet(natType0, natType1 *vnet.NATType) (*virtualNet, error) {
 }
 
 func addVNetSTUN(wanNet *vnet.Net, loggerFactory logging.LoggerFactory) (*turn.Server, error) {
+	return addVNetSTUNOnPort(wanNet, vnetSTUNServerPort, loggerFactory)
+}
+
+func addVNetSTUNOnPort(wanNet *vnet.Net, port int, loggerFactory logging.LoggerFactory) (*turn.Server, error) {
 	// Run TURN(STUN) server
 	credMap := map[string]string{}
 	credMap["user"] = "pass"
-	wanNetPacketConn, err := wanNet.ListenPacket("udp", fmt.Sprintf("%s:%d", vnetSTUNServerIP, vnetSTUNServerPort))
+	wanNetPacketConn, err := wanNet.ListenPacket("udp", fmt.Sprintf("%s:%d", vnetSTUNServerIP, port))
 	if err != nil {
 		return nil, err
 	}
@@ -616,8 +622,8 @@ func TestWriteUseValidPair(t *testing.T) {
 	controlledUfrag, controlledPwd, err := controlledAgent.GetLocalUserCredentials()
 	assert.NoError(t, err)
 
-	assert.NoError(t, controllingAgent.startConnectivityChecks(true, controlledUfrag, controlledPwd))
-	assert.NoError(t, controlledAgent.startConnectivityChecks(false, controllingUfrag, controllingPwd))
+	assert.NoError(t, controllingAgent.startConnectivityChecks(context.Background(), true, controlledUfrag, controlledPwd))
+	assert.NoError(t, controlledAgent.startConnectivityChecks(context.Background(), false, controllingUfrag, controllingPwd))
 
 	testMessage := []byte("Test Message")
 	go func() {
@@ -0,0 +1,185 @@
+package ice
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/pion/randutil"
+)
+
+// Limits of ice-ufrag and ice-pwd, RFC 8839 section 5.4
+const (
+	runesICEChar = runesCandidateIDFoundation
+
+	minUfragLength = 4
+	maxUfragLength = 256
+	minPwdLength   = 22
+	maxPwdLength   = 256
+
+	minUfragBits = 24
+	minPwdBits   = 128
+)
+
+// CredentialGenerator returns the local username fragment and password used
+// when the agent is created or restarted without explicit credentials, e.g.
+// derived from an authentication token.
+type CredentialGenerator func() (ufrag, pwd string, err error)
+
+// LocalCredentials are the local username fragment and password of an
+// agent, along with the ICE generation they belong to. Signaling should stamp
+// messages with the generation to tell the credentials of a restart apart.
+type LocalCredentials struct {
+	Ufrag      string
+	Pwd        string
+	Generation uint32
+}
+
+// credentialsConfig is how local credentials are generated and remote ones validated
+type credentialsConfig struct {
+	ufragLength int
+	pwdLength   int
+	charset     string
+	generator   CredentialGenerator
+	strict      bool
+}
+
+// initCredentials validates the credential settings of config.
+func (config *AgentConfig) initCredentials(a *Agent) error {
+	c := credentialsConfig{
+		ufragLength: lenUFrag,
+		pwdLength:   lenPwd,
+		charset:     runesAlpha,
+		generator:   config.CredentialGenerator,
+		strict:      config.StrictCredentialValidation,
+	}
+	if config.UfragLength != 0 {
+		c.ufragLength = config.UfragLength
+	}
+	if config.PwdLength != 0 {
+		c.pwdLength = config.PwdLength
+	}
+	if config.CredentialCharset != "" {
+		c.charset = config.CredentialCharset
+	}
+
+	if strings.Trim(c.charset, runesICEChar) != "" {
+		return fmt.Errorf("%w: %q has characters other than ALPHA, DIGIT, + and /", ErrInvalidCredentialCharset, c.charset)
+	}
+
+	// Entropy of a random string of length n over the charset
+	bitsPerChar := math.Log2(float64(len(distinctRunes(c.charset))))
+	switch {
+	case c.ufragLength < minUfragLength || c.ufragLength > maxUfragLength:
+		return fmt.Errorf("%w: ufrag length %d is not within %d and %d", ErrInvalidCredentialLength, c.ufragLength, minUfragLength, maxUfragLength)
+	case c.pwdLength < minPwdLength || c.pwdLength > maxPwdLength:
+		return fmt.Errorf("%w: pwd length %d is not within %d and %d", ErrInvalidCredentialLength, c.pwdLength, minPwdLength, maxPwdLength)
+	case float64(c.ufragLength)*bitsPerChar < minUfragBits:
+		return ErrLocalUfragInsufficientBits
+	case float64(c.pwdLength)*bitsPerChar < minPwdBits:
+		return ErrLocalPwdInsufficientBits
+	}
+
+	a.credentials = c
+	return nil
+}
+
+func distinctRunes(s string) map[rune]struct{} {
+	set := map[rune]struct{}{}
+	for _, r := range s {
+		set[r] = struct{}{}
+	}
+	return set
+}
+
+// generateCredentials returns the local credentials used when none are
+// provided, from the CredentialGenerator if one is configured.
+func (c credentialsConfig) generateCredentials() (ufrag, pwd string, err error) {
+	if c.generator != nil {
+		return c.generator()
+	}
+
+	if ufrag, err = randutil.GenerateCryptoRandomString(c.ufragLength, c.charset); err != nil {
+		return "", "", err
+	}
+	if pwd, err = randutil.GenerateCryptoRandomString(c.pwdLength, c.charset); err != nil {
+		return "", "", err
+	}
+	return ufrag, pwd, nil
+}
+
+// validateRemoteCredentials checks the remote credentials follow RFC 8839,
+// only if StrictCredentialValidation is set.
+func (c credentialsConfig) validateRemoteCredentials(ufrag, pwd string) error {
+	if !c.strict {
+		return nil
+	}
+
+	if err := validateICEChars(ufrag, minUfragLength, maxUfragLength, ErrRemoteUfragInvalid); err != nil {
+		return err
+	}
+	return validateICEChars(pwd, minPwdLength, maxPwdLength, ErrRemotePwdInvalid)
+}
+
+// validateICEChars checks s is made of minLength to maxLength ice-chars,
+// errors wrap errInvalid.
+func validateICEChars(s string, minLength, maxLength int, errInvalid error) error {
+	if len(s) < minLength || len(s) > maxLength {
+		return fmt.Errorf("%w: length %d is not within %d and %d", errInvalid, len(s), minLength, maxLength)
+	}
+	if i := strings.IndexFunc(s, func(r rune) bool { return !strings.ContainsRune(runesICEChar, r) }); i >= 0 {
+		return fmt.Errorf("%w: invalid character %q at %d", errInvalid, s[i], i)
+	}
+	return nil
+}
+
+// GetLocalCredentials returns the current local credentials and their
+// generation, read at once.
+func (a *Agent) GetLocalCredentials() (LocalCredentials, error) {
+	var credentials LocalCredentials
+	err := a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		credentials = agent.localCredentials()
+	})
+	return credentials, err
+}
+
+// OnLocalCredentialsChange sets a handler that is fired when the local
+// credentials change, by Restart or WarmRestart. It is called before the
+// handler of OnConnectionStateChange for the restart.
+func (a *Agent) OnLocalCredentialsChange(f func(LocalCredentials)) error {
+	a.onLocalCredentialsChangeHdlr.Store(f)
+	return nil
+}
+
+func (a *Agent) onLocalCredentialsChange(credentials LocalCredentials) {
+	if h, ok := a.onLocalCredentialsChangeHdlr.Load().(func(LocalCredentials)); ok {
+		h(credentials)
+	}
+}
+
+// Note: the caller should hold the agent lock.
+func (a *Agent) localCredentials() LocalCredentials {
+	return LocalCredentials{Ufrag: a.localUfrag, Pwd: a.localPwd, Generation: a.generation}
+}
+
+// setLocalCredentials moves to the next generation with new credentials.
+// The first credentials, set when the agent is created, start the first
+// generation.
+//
+// Note: the caller should hold the agent lock.
+func (a *Agent) setLocalCredentials(ufrag, pwd string) {
+	rotated := a.localUfrag != ""
+	if rotated {
+		a.nextGeneration()
+	}
+	a.localUfrag = ufrag
+	a.localPwd = pwd
+
+	if rotated {
+		credentials := a.localCredentials()
+		a.stateHandlers.push(func() {
+			a.onLocalCredentialsChange(credentials)
+		})
+	}
+}
@@ -0,0 +1,135 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialGeneration(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	t.Run("Length and charset", func(t *testing.T) {
+		a, err := NewAgent(&AgentConfig{
+			UfragLength:       8,
+			PwdLength:         24,
+			CredentialCharset: runesCandidateIDFoundation,
+		})
+		require.NoError(t, err)
+		defer func() {
+			assert.NoError(t, a.Close())
+		}()
+
+		ufrag, pwd, err := a.GetLocalUserCredentials()
+		require.NoError(t, err)
+		assert.Len(t, ufrag, 8)
+		assert.Len(t, pwd, 24)
+		assert.Empty(t, strings.Trim(ufrag+pwd, runesCandidateIDFoundation))
+	})
+
+	t.Run("Invalid config", func(t *testing.T) {
+		for _, config := range []*AgentConfig{
+			{CredentialCharset: "abc-"},
+			{UfragLength: 2},
+			{PwdLength: 300},
+		} {
+			_, err := NewAgent(config)
+			assert.Error(t, err)
+		}
+
+		_, err := NewAgent(&AgentConfig{CredentialCharset: "ab", UfragLength: 32, PwdLength: 64})
+		assert.ErrorIs(t, err, ErrLocalPwdInsufficientBits)
+	})
+
+	t.Run("Generator", func(t *testing.T) {
+		generated := 0
+		a, err := NewAgent(&AgentConfig{
+			CredentialGenerator: func() (string, string, error) {
+				generated++
+				return "ufrag" + string(rune('0'+generated)), strings.Repeat("p", 22), nil
+			},
+		})
+		require.NoError(t, err)
+		defer func() {
+			assert.NoError(t, a.Close())
+		}()
+
+		ufrag, _, err := a.GetLocalUserCredentials()
+		require.NoError(t, err)
+		assert.Equal(t, "ufrag1", ufrag)
+
+		// Only the missing password is taken from the generator
+		require.NoError(t, a.Restart("explicitufrag", ""))
+		ufrag, pwd, err := a.GetLocalUserCredentials()
+		require.NoError(t, err)
+		assert.Equal(t, "explicitufrag", ufrag)
+		assert.Equal(t, strings.Repeat("p", 22), pwd)
+		assert.Equal(t, 2, generated)
+	})
+}
+
+func TestRemoteCredentialValidation(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lenient, err := NewAgent(&AgentConfig{})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, lenient.Close())
+	}()
+	assert.NoError(t, lenient.SetRemoteCredentials("a-b", "short"))
+
+	strict, err := NewAgent(&AgentConfig{StrictCredentialValidation: true})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, strict.Close())
+	}()
+
+	validPwd := strings.Repeat("x", 22)
+	assert.ErrorIs(t, strict.SetRemoteCredentials("abc", validPwd), ErrRemoteUfragInvalid)
+	assert.ErrorIs(t, strict.SetRemoteCredentials("ab-c", validPwd), ErrRemoteUfragInvalid)
+	assert.ErrorIs(t, strict.SetRemoteCredentials("abcd", "short"), ErrRemotePwdInvalid)
+	assert.ErrorIs(t, strict.SetRemoteCredentials("abcd", validPwd[1:]+"="), ErrRemotePwdInvalid)
+	assert.NoError(t, strict.SetRemoteCredentials("ab+/", validPwd))
+}
+
+func TestLocalCredentialsChange(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	a, err := NewAgent(&AgentConfig{
+		NetworkTypes: []NetworkType{NetworkTypeUDP4},
+		LocalUfrag:   "ufrag",
+		LocalPwd:     "passwordpasswordpassword",
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	credentials, err := a.GetLocalCredentials()
+	require.NoError(t, err)
+	assert.Equal(t, LocalCredentials{Ufrag: "ufrag", Pwd: "passwordpasswordpassword"}, credentials)
+
+	changed := make(chan LocalCredentials, 2)
+	require.NoError(t, a.OnLocalCredentialsChange(func(c LocalCredentials) {
+		changed <- c
+	}))
+
+	require.NoError(t, a.Restart("", ""))
+	credentials, err = a.GetLocalCredentials()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), credentials.Generation)
+	assert.NotEqual(t, "ufrag", credentials.Ufrag)
+	assert.Equal(t, credentials, <-changed)
+
+	require.NoError(t, a.WarmRestart("ufrag2", "passwordpasswordpassword2"))
+	assert.Equal(t, LocalCredentials{Ufrag: "ufrag2", Pwd: "passwordpasswordpassword2", Generation: 2}, <-changed)
+}
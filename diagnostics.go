@@ -0,0 +1,243 @@
+package ice
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pion/stun"
+)
+
+// FailureReport is a snapshot of the agent taken at the moment it reaches
+// ConnectionStateFailed. It collects what is needed to explain the failure
+// without having to correlate the logs of both peers.
+type FailureReport struct {
+	Timestamp time.Time
+
+	// LocalCandidateTypes and RemoteCandidateTypes count the candidates of
+	// each type that were known to the agent.
+	LocalCandidateTypes  map[CandidateType]int
+	RemoteCandidateTypes map[CandidateType]int
+
+	// ServerErrors lists the STUN and TURN servers that could not be used
+	// while gathering.
+	ServerErrors []ServerError
+
+	// CandidatePairs holds the final state of every pair in the checklist.
+	CandidatePairs []CandidatePairReport
+
+	// NATHints are human readable guesses about the network conditions
+	// that prevented connectivity.
+	NATHints []string
+}
+
+// ServerError describes a STUN or TURN server that failed during gathering.
+type ServerError struct {
+	URL string
+	Err error
+}
+
+// CandidatePairReport is the final state of a candidate pair.
+type CandidatePairReport struct {
+	Local               string
+	Remote              string
+	State               CandidatePairState
+	Nominated           bool
+	BindingRequestCount uint16
+
+	// LastErrorCode is the code of the last STUN error response received
+	// for this pair, zero if none was received.
+	LastErrorCode   stun.ErrorCode
+	LastErrorReason string
+
+	// ICMPError is set when the pair was failed by an ICMP error, see
+	// AgentConfig.ICMPErrorDetection.
+	ICMPError error
+}
+
+// String returns a multi-line, human readable description of the report.
+func (r FailureReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "ICE failure at %s\n", r.Timestamp.Format(time.RFC3339))
+	fmt.Fprintf(&b, "local candidates: %s\n", candidateTypeCountsString(r.LocalCandidateTypes))
+	fmt.Fprintf(&b, "remote candidates: %s\n", candidateTypeCountsString(r.RemoteCandidateTypes))
+	for _, e := range r.ServerErrors {
+		fmt.Fprintf(&b, "server %s: %v\n", e.URL, e.Err)
+	}
+	for _, p := range r.CandidatePairs {
+		fmt.Fprintf(&b, "pair %s <-> %s: %s, %d requests", p.Local, p.Remote, p.State, p.BindingRequestCount)
+		if p.LastErrorCode != 0 {
+			fmt.Fprintf(&b, ", last error %d %s", p.LastErrorCode, p.LastErrorReason)
+		}
+		if p.ICMPError != nil {
+			fmt.Fprintf(&b, ", %v", p.ICMPError)
+		}
+		b.WriteString("\n")
+	}
+	for _, h := range r.NATHints {
+		fmt.Fprintf(&b, "hint: %s\n", h)
+	}
+	return b.String()
+}
+
+func candidateTypeCountsString(counts map[CandidateType]int) string {
+	if len(counts) == 0 {
+		return "none"
+	}
+
+	var parts []string
+	for _, t := range []CandidateType{CandidateTypeHost, CandidateTypeServerReflexive, CandidateTypePeerReflexive, CandidateTypeRelay} {
+		if n := counts[t]; n != 0 {
+			parts = append(parts, fmt.Sprintf("%s=%d", t, n))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// GetFailureReport returns the report built when the agent last reached
+// ConnectionStateFailed. It remains available after the agent is closed,
+// and is cleared by Restart.
+func (a *Agent) GetFailureReport() (FailureReport, bool) {
+	if r, ok := a.failureReport.Load().(*FailureReport); ok && r != nil {
+		return *r, true
+	}
+	return FailureReport{}, false
+}
+
+// buildFailureReport must run before candidates are released.
+// Note: the caller should hold the agent lock.
+func (a *Agent) buildFailureReport() *FailureReport {
+	r := &FailureReport{
+		Timestamp:            a.clock.Now(),
+		LocalCandidateTypes:  map[CandidateType]int{},
+		RemoteCandidateTypes: map[CandidateType]int{},
+	}
+
+	for _, cs := range a.localCandidates {
+		for _, c := range cs {
+			r.LocalCandidateTypes[c.Type()]++
+		}
+	}
+	for _, cs := range a.remoteCandidates {
+		for _, c := range cs {
+			r.RemoteCandidateTypes[c.Type()]++
+		}
+	}
+
+	a.muGatheringErrors.Lock()
+	for _, e := range a.gatheringErrors {
+		if e.URL != nil {
+			r.ServerErrors = append(r.ServerErrors, ServerError{URL: e.URL.String(), Err: e.Err})
+		}
+	}
+	a.muGatheringErrors.Unlock()
+
+	for _, p := range a.checklist {
+		r.CandidatePairs = append(r.CandidatePairs, CandidatePairReport{
+			Local:               p.Local.String(),
+			Remote:              p.Remote.String(),
+			State:               p.state,
+			Nominated:           p.nominated,
+			BindingRequestCount: p.bindingRequestCount,
+			LastErrorCode:       p.lastErrorCode,
+			LastErrorReason:     p.lastErrorReason,
+			ICMPError:           p.icmpErr,
+		})
+	}
+
+	r.NATHints = a.natHints(r)
+	return r
+}
+
+// natHints derives best-effort explanations from the candidates and pairs.
+// Note: the caller should hold the agent lock.
+func (a *Agent) natHints(r *FailureReport) []string {
+	var hints []string
+
+	hasSTUN, hasTURN := false, false
+	for _, u := range a.getURLs() {
+		switch u.Scheme {
+		case SchemeTypeSTUN, SchemeTypeSTUNS:
+			hasSTUN = true
+		case SchemeTypeTURN, SchemeTypeTURNS:
+			hasTURN = true
+		}
+	}
+
+	if hasSTUN && r.LocalCandidateTypes[CandidateTypeServerReflexive] == 0 {
+		hints = append(hints, "no server reflexive candidates were gathered, outbound UDP to the STUN servers may be blocked")
+	}
+	if hasTURN && r.LocalCandidateTypes[CandidateTypeRelay] == 0 {
+		hints = append(hints, "no relay candidates were gathered, the TURN servers were unreachable or rejected the allocation")
+	}
+
+	// Server reflexive candidates sharing a base but mapped to different
+	// addresses mean the NAT picks a mapping per destination.
+	mappings := map[string]string{}
+	for _, cs := range a.localCandidates {
+		for _, c := range cs {
+			// The related address may be redacted, see HostDisclosure
+			conn := candidateSocket(c)
+			if c.Type() != CandidateTypeServerReflexive || conn == nil {
+				continue
+			}
+			base := conn.LocalAddr().String()
+			mapped := net.JoinHostPort(c.Address(), fmt.Sprint(c.Port()))
+			if prev, ok := mappings[base]; ok && prev != mapped {
+				hints = append(hints, "mapped address differs between STUN servers, the NAT mapping is address and/or port dependent and a relay is likely needed")
+				break
+			}
+			mappings[base] = mapped
+		}
+	}
+
+	if len(r.RemoteCandidateTypes) == 0 {
+		hints = append(hints, "no remote candidates were received, check the signaling channel")
+		return hints
+	}
+
+	sent, succeeded := false, false
+	for _, p := range r.CandidatePairs {
+		if p.BindingRequestCount > 0 {
+			sent = true
+		}
+		if p.State == CandidatePairStateSucceeded {
+			succeeded = true
+		}
+		// 438 Stale Nonce is about the nonce of a TURN server, not the
+		// credentials of the peer
+		if p.LastErrorCode == stun.CodeUnauthorized {
+			hints = append(hints, fmt.Sprintf("pair %s <-> %s was rejected with %d, the remote credentials are likely wrong", p.Local, p.Remote, p.LastErrorCode))
+		}
+	}
+	if sent && !succeeded {
+		hints = append(hints, "no connectivity check succeeded, both peers may be behind NATs or firewalls that filter unsolicited traffic")
+	}
+
+	return hints
+}
+
+// handleInboundBindingError records the error code of a response to one of
+// our binding requests on the pair it was sent on.
+// Note: the caller should hold the agent lock.
+func (a *Agent) handleInboundBindingError(m *stun.Message, local, remote Candidate) {
+	req, ok := a.matchBindingResponse(m, local, remote, remote.addr())
+	if !ok {
+		return
+	}
+
+	var errorCode stun.ErrorCodeAttribute
+	if err := errorCode.GetFrom(m); err != nil {
+		a.log.Warnf("discard error response from (%s), %v", remote, err)
+		return
+	}
+
+	if p := a.findPair(req.local, remote); p != nil {
+		p.lastErrorCode = errorCode.Code
+		p.lastErrorReason = string(errorCode.Reason)
+		p.lastErrorTime = a.clock.Now()
+		p.errorResponses++
+	}
+	a.log.Debugf("binding error response from %s to %s: %s", remote, local, errorCode)
+}
@@ -0,0 +1,143 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/stun"
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailureReport(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	oneSecond := time.Second
+	KeepaliveInterval := time.Duration(0)
+
+	cfg := &AgentConfig{
+		NetworkTypes:        supportedNetworkTypes(),
+		DisconnectedTimeout: &oneSecond,
+		FailedTimeout:       &oneSecond,
+		KeepaliveInterval:   &KeepaliveInterval,
+	}
+
+	aAgent, err := NewAgent(cfg)
+	assert.NoError(t, err)
+
+	bAgent, err := NewAgent(cfg)
+	assert.NoError(t, err)
+
+	_, ok := aAgent.GetFailureReport()
+	assert.False(t, ok)
+
+	isFailed := make(chan interface{})
+	assert.NoError(t, aAgent.OnConnectionStateChange(func(c ConnectionState) {
+		if c == ConnectionStateFailed {
+			close(isFailed)
+		}
+	}))
+
+	connect(aAgent, bAgent)
+	<-isFailed
+
+	r, ok := aAgent.GetFailureReport()
+	assert.True(t, ok)
+	assert.NotZero(t, r.LocalCandidateTypes[CandidateTypeHost])
+	assert.NotZero(t, r.RemoteCandidateTypes[CandidateTypeHost])
+	assert.NotEmpty(t, r.CandidatePairs)
+	assert.Contains(t, r.String(), "ICE failure at")
+
+	succeeded := false
+	for _, p := range r.CandidatePairs {
+		if p.State == CandidatePairStateSucceeded {
+			succeeded = true
+		}
+	}
+	assert.True(t, succeeded)
+
+	assert.NoError(t, aAgent.Close())
+	assert.NoError(t, bAgent.Close())
+
+	// Still available once closed
+	_, ok = aAgent.GetFailureReport()
+	assert.True(t, ok)
+}
+
+func TestFailureReportErrorResponse(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	var config AgentConfig
+	runAgentTest(t, &config, func(ctx context.Context, a *Agent) {
+		a.selector = &controllingSelector{agent: a, log: a.log}
+		a.urls = []*URL{{Scheme: SchemeTypeSTUN, Host: "stun.example.com", Port: 3478}}
+
+		local := newInboundLocal(t, nil)
+
+		remote := newInboundRemote(t)
+
+		a.addRemoteCandidate(remote)
+		p := a.addPair(local, remote)
+		p.bindingRequestCount = 1
+
+		msg, err := stun.Build(stun.NewType(stun.MethodBinding, stun.ClassErrorResponse), stun.TransactionID,
+			stun.CodeUnauthorized,
+			stun.Fingerprint,
+		)
+		assert.NoError(t, err)
+
+		// Unknown transactions are ignored
+		a.handleInbound(msg, local, inboundRemoteAddr())
+		assert.Equal(t, stun.ErrorCode(0), p.lastErrorCode)
+
+		a.pendingBindingRequests = append(a.pendingBindingRequests, bindingRequest{
+			timestamp:     time.Now(),
+			transactionID: msg.TransactionID,
+			local:         local,
+			destination:   remote.addr(),
+		})
+
+		// A response signed with another password is not authentic
+		forged, err := stun.Build(stun.NewType(stun.MethodBinding, stun.ClassErrorResponse), stun.NewTransactionIDSetter(msg.TransactionID),
+			stun.CodeRoleConflict,
+			stun.NewShortTermIntegrity("forged"),
+			stun.Fingerprint,
+		)
+		assert.NoError(t, err)
+		a.handleInbound(forged, local, inboundRemoteAddr())
+		assert.Equal(t, stun.ErrorCode(0), p.lastErrorCode)
+		assert.Len(t, a.pendingBindingRequests, 1)
+
+		a.handleInbound(msg, local, inboundRemoteAddr())
+		assert.Equal(t, stun.CodeUnauthorized, p.lastErrorCode)
+		assert.Equal(t, uint64(1), p.errorResponses)
+
+		a.recordServerError(ctx, CandidateTypeServerReflexive, *a.urls[0], udp, errGetXorMappedAddrResponse)
+
+		r := a.buildFailureReport()
+		assert.Equal(t, 1, r.RemoteCandidateTypes[CandidateTypeHost])
+		assert.Len(t, r.ServerErrors, 1)
+		assert.Equal(t, "stun:stun.example.com:3478", r.ServerErrors[0].URL)
+		assert.Len(t, r.CandidatePairs, 1)
+		assert.Equal(t, stun.CodeUnauthorized, r.CandidatePairs[0].LastErrorCode)
+		assert.Contains(t, r.NATHints, "no server reflexive candidates were gathered, outbound UDP to the STUN servers may be blocked")
+		assert.Len(t, r.NATHints, 3)
+
+		// A stale nonce does not hint at wrong credentials
+		p.lastErrorCode = stun.CodeStaleNonce
+		r = a.buildFailureReport()
+		for _, hint := range r.NATHints {
+			assert.NotContains(t, hint, "credentials")
+		}
+		assert.Len(t, r.NATHints, 2)
+	})
+}
@@ -21,6 +21,14 @@ var (
 	// ErrPort indicates malformed port is provided.
 	ErrPort = errors.New("invalid port")
 
+	// ErrUnbracketedIPv6 indicates an IPv6 address is provided without the
+	// brackets that tell it apart from the port.
+	ErrUnbracketedIPv6 = errors.New("IPv6 address must be enclosed in brackets")
+
+	// ErrInvalidIPv6 indicates brackets enclose a malformed IPv6 address or
+	// zone ID, or something else than an IPv6 address.
+	ErrInvalidIPv6 = errors.New("invalid IPv6 address in brackets")
+
 	// ErrLocalUfragInsufficientBits indicates local username fragment insufficient bits are provided.
 	// Have to be at least 24 bits long
 	ErrLocalUfragInsufficientBits = errors.New("local username fragment is less than 24 bits long")
@@ -29,6 +37,22 @@ var (
 	// Have to be at least 128 bits long
 	ErrLocalPwdInsufficientBits = errors.New("local password is less than 128 bits long")
 
+	// ErrInvalidCredentialCharset indicates AgentConfig.CredentialCharset has
+	// characters that are not allowed in ICE credentials.
+	ErrInvalidCredentialCharset = errors.New("invalid credential charset")
+
+	// ErrInvalidCredentialLength indicates AgentConfig.UfragLength or PwdLength
+	// is out of the range allowed by RFC 8839.
+	ErrInvalidCredentialLength = errors.New("invalid credential length")
+
+	// ErrRemoteUfragInvalid indicates the remote ufrag is not a valid ice-ufrag,
+	// see AgentConfig.StrictCredentialValidation.
+	ErrRemoteUfragInvalid = errors.New("remote ufrag is invalid")
+
+	// ErrRemotePwdInvalid indicates the remote pwd is not a valid ice-pwd,
+	// see AgentConfig.StrictCredentialValidation.
+	ErrRemotePwdInvalid = errors.New("remote pwd is invalid")
+
 	// ErrProtoType indicates an unsupported transport type was provided.
 	ErrProtoType = errors.New("invalid transport protocol type")
 
@@ -38,6 +62,22 @@ var (
 	// ErrNoCandidatePairs indicates agent does not have a valid candidate pair
 	ErrNoCandidatePairs = errors.New("no candidate pairs available")
 
+	// ErrNoSelectedCandidatePair indicates no candidate pair has been selected yet
+	ErrNoSelectedCandidatePair = errors.New("no candidate pair selected")
+
+	// ErrRemoteCandidatesMismatch indicates the remote-candidates claimed by the
+	// controlling agent do not match the selected candidate pair
+	ErrRemoteCandidatesMismatch = errors.New("remote-candidates do not match the selected pair")
+
+	// ErrCandidateNotFound indicates the candidate is not known to the agent
+	ErrCandidateNotFound = errors.New("candidate not found")
+
+	// ErrInvalidSPKIPin indicates a TURNServerSPKIPins entry is not a base64 SHA-256 hash
+	ErrInvalidSPKIPin = errors.New("invalid SPKI pin")
+
+	// ErrTURNServerCertificateNotPinned indicates no certificate presented by a TURN server has a pinned public key
+	ErrTURNServerCertificateNotPinned = errors.New("TURN server certificate does not match any SPKI pin")
+
 	// ErrCanceledByCaller indicates agent connection was canceled by the caller
 	ErrCanceledByCaller = errors.New("connecting canceled by caller")
 
@@ -100,6 +140,18 @@ var (
 	// ErrRestartWhenGathering indicates Restart was called when Agent is in GatheringStateGathering
 	ErrRestartWhenGathering = errors.New("ICE Agent can not be restarted when gathering")
 
+	// ErrWarmRestartMuxedCandidate indicates WarmRestart was called on an Agent with candidates of a UDPMux or TCPMux
+	ErrWarmRestartMuxedCandidate = errors.New("ICE Agent can not keep candidates of a mux across a restart")
+
+	// ErrInvalidTypePreference indicates a TypePreferences value is above 126
+	ErrInvalidTypePreference = errors.New("type preference must be between 0 and 126")
+
+	// ErrFuzzPanic indicates a fuzzing entry point recovered from a panic
+	ErrFuzzPanic = errors.New("panic while parsing input")
+
+	// ErrFuzzRoundTrip indicates a marshaled candidate could not be parsed back
+	ErrFuzzRoundTrip = errors.New("candidate does not survive a marshal round trip")
+
 	// ErrRunCanceled indicates a run operation was canceled by its individual done
 	ErrRunCanceled = errors.New("run was canceled by done")
 
@@ -115,6 +167,80 @@ var (
 	// ErrDetermineNetworkType indicates that the NetworkType was not able to be parsed
 	ErrDetermineNetworkType = errors.New("unable to determine networkType")
 
+	// ErrICMPPortUnreachable indicates an ICMP port unreachable was received for a candidate pair
+	ErrICMPPortUnreachable = errors.New("ICMP port unreachable")
+
+	// ErrICMPHostUnreachable indicates an ICMP host unreachable was received for a candidate pair
+	ErrICMPHostUnreachable = errors.New("ICMP host unreachable")
+
+	// ErrICMPNetworkUnreachable indicates an ICMP network unreachable was received for a candidate pair
+	ErrICMPNetworkUnreachable = errors.New("ICMP network unreachable")
+
+	// ErrCandidatePairNotFound indicates the candidate pair is not in the checklist of the agent
+	ErrCandidatePairNotFound = errors.New("candidate pair not found")
+
+	// ErrPingTimeout indicates a binding request sent by PingCandidatePair was not answered in time
+	ErrPingTimeout = errors.New("binding request timed out")
+
+	// ErrBindingErrorResponse indicates a binding request was answered with an error response
+	ErrBindingErrorResponse = errors.New("binding error response")
+
+	// ErrInvalidICEOption indicates an ICE option of AgentConfig.ICEOptions is not a valid token
+	ErrInvalidICEOption = errors.New("invalid ICE option")
+
+	// ErrPacketTooLarge indicates a packet larger than AgentConfig.MaxPacketSize was received and dropped, see AgentConfig.ReportPacketTooLarge
+	ErrPacketTooLarge = errors.New("packet larger than the maximum packet size")
+
+	// ErrStreamingPacketTooLarge indicates a packet larger than the 65535 bytes an RFC 4571 frame can carry over ICE-TCP
+	ErrStreamingPacketTooLarge = errors.New("packet too large for an RFC 4571 frame")
+
+	// ErrAgentFactoryClosed indicates AgentFactory.NewAgent was called after Close
+	ErrAgentFactoryClosed = errors.New("the agent factory is closed")
+
+	// ErrInvalidHandlerQueueOverflow indicates AgentConfig.HandlerQueueOverflow is not a policy handler queues support
+	ErrInvalidHandlerQueueOverflow = errors.New("invalid handler queue overflow policy")
+
+	// ErrInvalidTaskQueueOverflow indicates AgentConfig.TaskQueueOverflow is not a policy the task queue supports
+	ErrInvalidTaskQueueOverflow = errors.New("invalid task queue overflow policy")
+
+	// ErrSignaling indicates the Signaler of Connect failed
+	ErrSignaling = errors.New("signaling failed")
+
+	// ErrP2PListenerClosed indicates P2PListener.Accept was called after Close
+	ErrP2PListenerClosed = errors.New("the P2P listener is closed")
+
+	// ErrSocketBudgetExhausted indicates a candidate was skipped because of AgentConfig.MaxSockets
+	ErrSocketBudgetExhausted = errors.New("socket budget of the agent exhausted")
+
+	// ErrSocketsExhausted indicates a candidate was skipped because the system ran out of ports or file descriptors
+	ErrSocketsExhausted = errors.New("ports or file descriptors exhausted")
+
+	// ErrCandidateConnAccessDisabled indicates CandidateConn was called without AgentConfig.CandidateConnAccess
+	ErrCandidateConnAccessDisabled = errors.New("access to the conns of the candidates is disabled")
+
+	// ErrCandidateConnOwned indicates a CandidateConn was read from, closed or given a deadline,
+	// which only the agent may do
+	ErrCandidateConnOwned = errors.New("the conn is read and closed by the agent")
+
+	// ErrInvalidCandidateTypeName indicates RegisterCandidateType was given a name that is not a token or
+	// is the name of a built-in type
+	ErrInvalidCandidateTypeName = errors.New("invalid candidate type name")
+
+	// ErrCandidateTypeRegistered indicates RegisterCandidateType was given the name of a registered type
+	ErrCandidateTypeRegistered = errors.New("candidate type already registered")
+
+	// ErrCandidateTypeLimit indicates RegisterCandidateType can not register more types
+	ErrCandidateTypeLimit = errors.New("too many candidate types registered")
+
+	// ErrLocalCandidateStarted indicates AddLocalCandidate was given a candidate already added to an agent
+	ErrLocalCandidateStarted = errors.New("local candidate already added to an agent")
+
+	// ErrStreamExists indicates AddStream was given the ID of a stream of the agent
+	ErrStreamExists = errors.New("stream already added to the agent")
+
+	// ErrServerUnauthorized indicates a TURN server rejected the credentials of its URL
+	ErrServerUnauthorized = errors.New("TURN server rejected the credentials")
+
 	errSendPacket                    = errors.New("failed to send packet")
 	errAttributeTooShortICECandidate = errors.New("attribute not long enough to be ICE candidate")
 	errParseComponent                = errors.New("could not parse component")
@@ -122,6 +248,8 @@ var (
 	errParsePort                     = errors.New("could not parse port")
 	errParseRelatedAddr              = errors.New("could not parse related addresses")
 	errParseTypType                  = errors.New("could not parse typtype")
+	errParseExtension                = errors.New("could not parse extension")
+	errParseRemoteCandidates         = errors.New("could not parse remote-candidates")
 	errGetXorMappedAddrResponse      = errors.New("failed to get XOR-MAPPED-ADDRESS response")
 	errConnectionAddrAlreadyExist    = errors.New("connection with same remote address already exists")
 	errReadingStreamingPacket        = errors.New("error reading streaming packet")
@@ -139,4 +267,8 @@ var (
 	errSendSTUNPacket                = errors.New("failed to send STUN packet")
 	errXORMappedAddrTimeout          = errors.New("timeout while waiting for XORMappedAddr")
 	errNotImplemented                = errors.New("not implemented yet")
+	errTCPUserTimeoutUnsupported     = errors.New("TCP user timeout is not supported on this platform")
+	errIOUringUnavailable            = errors.New("the io_uring IO backend is not available")
+	errDontFragmentUnsupported       = errors.New("the DF bit can't be set on this socket")
+	errInvalidTURNFrame              = errors.New("data is not a valid TURN frame, no STUN or ChannelData found")
 )
@@ -0,0 +1,59 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newInboundLocal returns the local candidate of the tests handing binding
+// messages to handleInbound, a host candidate on 192.168.0.2:777 writing to
+// conn, or to a mockPacketConn if conn is nil.
+func newInboundLocal(t *testing.T, conn net.PacketConn) *CandidateHost {
+	local, err := NewCandidateHost(&CandidateHostConfig{
+		Network:   "udp",
+		Address:   "192.168.0.2",
+		Port:      777,
+		Component: 1,
+	})
+	require.NoError(t, err)
+	if conn == nil {
+		conn = &mockPacketConn{}
+	}
+	local.conn = conn
+	return local
+}
+
+// newInboundRemote returns the remote candidate the messages of these tests
+// come from, a host candidate on inboundRemoteAddr.
+func newInboundRemote(t *testing.T) *CandidateHost {
+	remote, err := NewCandidateHost(&CandidateHostConfig{
+		Network:   "udp",
+		Address:   "172.17.0.3",
+		Port:      999,
+		Component: 1,
+	})
+	require.NoError(t, err)
+	return remote
+}
+
+// inboundRemoteAddr returns the address of newInboundRemote.
+func inboundRemoteAddr() *net.UDPAddr {
+	return &net.UDPAddr{IP: net.ParseIP("172.17.0.3"), Port: 999}
+}
+
+// newTestHost returns a UDP host candidate on address, port 1000.
+func newTestHost(t *testing.T, address string) *CandidateHost {
+	c, err := NewCandidateHost(&CandidateHostConfig{
+		Network:   "udp",
+		Address:   address,
+		Port:      1000,
+		Component: 1,
+	})
+	require.NoError(t, err)
+	return c
+}
@@ -0,0 +1,107 @@
+package ice
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+)
+
+// fqdnResolveTimeout bounds the resolution of a remote candidate address
+const fqdnResolveTimeout = 10 * time.Second
+
+// isFQDN reports whether address is a syntactically valid DNS name. The last
+// label must not be numeric, so malformed IP addresses are not mistaken for names.
+func isFQDN(address string) bool {
+	address = strings.TrimSuffix(address, ".")
+	if address == "" || len(address) > 253 {
+		return false
+	}
+
+	labels := strings.Split(address, ".")
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '-' {
+				return false
+			}
+		}
+	}
+
+	tld := labels[len(labels)-1]
+	return strings.Trim(tld, "0123456789") != ""
+}
+
+// localHostName returns the name of the local host candidates gathered on
+// ip, "" if they have the address.
+func (a *Agent) localHostName(ip net.IP) string {
+	if a.hostCandidateName == nil || a.mDNSMode == MulticastDNSModeQueryAndGather {
+		return ""
+	}
+
+	name := a.hostCandidateName(ip)
+	switch {
+	case name == "":
+	case strings.HasSuffix(strings.TrimSuffix(name, "."), ".local"):
+		a.log.Warnf("Not naming host candidates of %s %q, .local names are resolved with mDNS", ip, name)
+		return ""
+	case !isFQDN(name):
+		a.log.Warnf("Not naming host candidates of %s %q, not a DNS name", ip, name)
+		return ""
+	}
+	return name
+}
+
+// resolveAndAddFQDNCandidate resolves the DNS name of a remote host
+// candidate and adds it once resolved, using the first address of a network
+// type the agent uses.
+func (a *Agent) resolveAndAddFQDNCandidate(c *CandidateHost) {
+	ctx, cancel := context.WithTimeout(a.context(), fqdnResolveTimeout)
+	defer cancel()
+
+	addrs, err := a.resolver.LookupIPAddr(ctx, c.Address())
+	if err != nil {
+		a.log.Warnf("Failed to resolve remote candidate %s: %v", c.Address(), err)
+		return
+	}
+
+	var ip net.IP
+	for _, addr := range addrs {
+		networkType, err := determineNetworkType(c.network, addr.IP)
+		if err == nil && a.usesNetworkType(networkType) {
+			ip = addr.IP
+			break
+		}
+	}
+	if ip == nil {
+		a.log.Warnf("Failed to resolve remote candidate %s: no address of a supported network type in %v", c.Address(), addrs)
+		return
+	}
+
+	if err = c.setIP(ip); err != nil {
+		a.log.Warnf("Failed to resolve remote candidate %s: %v", c.Address(), err)
+		return
+	}
+
+	if err = a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		agent.addSignaledRemoteCandidates([]Candidate{c})
+	}); err != nil {
+		a.log.Warnf("Failed to add remote candidate %s: %v", c.Address(), err)
+	}
+}
+
+// usesNetworkType reports whether candidates of networkType are gathered,
+// all are if NetworkTypes was not configured.
+func (a *Agent) usesNetworkType(networkType NetworkType) bool {
+	if len(a.networkTypes) == 0 {
+		return true
+	}
+	for _, t := range a.networkTypes {
+		if t == networkType {
+			return true
+		}
+	}
+	return false
+}
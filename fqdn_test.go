@@ -0,0 +1,98 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsFQDN(t *testing.T) {
+	for _, address := range []string{"localhost", "gateway.example.com", "gateway.example.com.", "sip-1.example.org"} {
+		assert.True(t, isFQDN(address), address)
+	}
+	for _, address := range []string{"", "192.168.0.278", "-gateway.example.com", "gateway..example.com", "gateway example.com", "gateway_1.example.com"} {
+		assert.False(t, isFQDN(address), address)
+	}
+}
+
+func TestRemoteFQDNCandidate(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	a, err := NewAgent(&AgentConfig{NetworkTypes: []NetworkType{NetworkTypeUDP4}})
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, a.Close()) }()
+	require.NoError(t, a.SetRemoteCredentials("ufrag", "passwordpasswordpassword"))
+
+	c, err := UnmarshalCandidate("1 1 udp 2130706431 localhost 5000 typ host")
+	require.NoError(t, err)
+	assert.Nil(t, c.addr())
+	require.NoError(t, a.AddRemoteCandidate(c))
+
+	// The candidate is added once localhost is resolved to its IPv4 address
+	var remote []Candidate
+	assert.Eventually(t, func() bool {
+		require.NoError(t, a.run(context.Background(), func(ctx context.Context, a *Agent) {
+			remote = a.remoteCandidates[NetworkTypeUDP4]
+		}))
+		return len(remote) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, "localhost", remote[0].Address())
+	assert.Equal(t, NetworkTypeUDP4, remote[0].NetworkType())
+	assert.True(t, addrEqual(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000}, remote[0].addr()))
+}
+
+func TestHostCandidateName(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	gather := func(name string) []Candidate {
+		a, err := NewAgent(&AgentConfig{
+			NetworkTypes:   []NetworkType{NetworkTypeUDP4},
+			CandidateTypes: []CandidateType{CandidateTypeHost},
+			Synchronous:    true,
+			HostCandidateName: func(ip net.IP) string {
+				return name
+			},
+		})
+		require.NoError(t, err)
+		defer func() {
+			assert.NoError(t, a.Close())
+		}()
+
+		var candidates []Candidate
+		require.NoError(t, a.OnCandidate(func(c Candidate) {
+			if c != nil {
+				candidates = append(candidates, c)
+			}
+		}))
+		require.NoError(t, a.GatherCandidates())
+		return candidates
+	}
+
+	candidates := gather("pod-0.ice.default.svc.cluster.local.example")
+	require.NotEmpty(t, candidates)
+	for _, c := range candidates {
+		assert.Equal(t, "pod-0.ice.default.svc.cluster.local.example", c.Address())
+		assert.Equal(t, NetworkTypeUDP4, c.NetworkType())
+		require.NotNil(t, c.addr())
+		// The candidate is bound to the address of the interface
+		assert.False(t, c.addr().(*net.UDPAddr).IP.IsUnspecified())
+	}
+
+	// Names resolved with mDNS, or not names, are not used
+	for _, name := range []string{"pod-0.local", "not a name"} {
+		for _, c := range gather(name) {
+			assert.NotNil(t, net.ParseIP(c.Address()), name)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package ice
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/pion/stun"
+)
+
+// The Fuzz functions expose the parsing of untrusted input to fuzzing
+// harnesses. They return the error the agent would reject the input with,
+// and panics as an error wrapping ErrFuzzPanic, so a harness only has to
+// report those. With go-fuzz they are wrapped as
+//
+//	func Fuzz(data []byte) int {
+//		if err := ice.FuzzSTUNDemux(data); errors.Is(err, ice.ErrFuzzPanic) {
+//			panic(err)
+//		} else if err != nil {
+//			return 0
+//		}
+//		return 1
+//	}
+
+// FuzzSTUNDemux parses data as a packet received by a UDPMux or TCPMux: the
+// STUN message is decoded and the ufrag it is demultiplexed by is read from
+// its USERNAME.
+func FuzzSTUNDemux(data []byte) (err error) {
+	defer recoverFuzzPanic(&err)
+
+	if !stun.IsMessage(data) {
+		return nil
+	}
+	msg := &stun.Message{Raw: append([]byte{}, data...)}
+	if err = msg.Decode(); err != nil {
+		return err
+	}
+	_, err = ufragFromSTUNMessage(msg)
+	return err
+}
+
+// FuzzStreamingPacket reads data as a stream of RFC 4571 framed packets, as
+// received on an ICE-TCP connection, until it is exhausted.
+func FuzzStreamingPacket(data []byte) (err error) {
+	defer recoverFuzzPanic(&err)
+
+	r := bytes.NewReader(data)
+	buf := make([]byte, receiveMTU)
+	for r.Len() > 0 {
+		if _, err = readStreamingPacket(r, buf); err != nil {
+			if err == io.EOF { //nolint:errorlint
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// FuzzCandidate parses data as a signaled candidate. A candidate that is
+// accepted must be parsed back to an equal candidate once marshaled,
+// otherwise an error wrapping ErrFuzzRoundTrip is returned.
+func FuzzCandidate(data []byte) (err error) {
+	defer recoverFuzzPanic(&err)
+
+	c, err := UnmarshalCandidate(string(data))
+	if err != nil {
+		return err
+	}
+	parsed, err := UnmarshalCandidate(c.Marshal())
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrFuzzRoundTrip, c.Marshal(), err) //nolint:errorlint
+	}
+	if !c.Equal(parsed) {
+		return fmt.Errorf("%w: %s != %s", ErrFuzzRoundTrip, c, parsed)
+	}
+	return nil
+}
+
+func recoverFuzzPanic(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("%w: %v", ErrFuzzPanic, r)
+	}
+}
@@ -0,0 +1,60 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/pion/stun"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFuzzSTUNDemux(t *testing.T) {
+	msg, err := stun.Build(stun.BindingRequest, stun.TransactionID, stun.NewUsername("local:remote"))
+	require.NoError(t, err)
+	assert.NoError(t, FuzzSTUNDemux(msg.Raw))
+
+	noUsername, err := stun.Build(stun.BindingRequest, stun.TransactionID)
+	require.NoError(t, err)
+	assert.ErrorIs(t, FuzzSTUNDemux(noUsername.Raw), stun.ErrAttributeNotFound)
+
+	truncated := append([]byte{}, msg.Raw...)
+	binary.BigEndian.PutUint16(truncated[2:4], 200)
+	err = FuzzSTUNDemux(truncated)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrFuzzPanic)
+
+	assert.NoError(t, FuzzSTUNDemux([]byte("not stun")))
+}
+
+func TestFuzzStreamingPacket(t *testing.T) {
+	assert.NoError(t, FuzzStreamingPacket(nil))
+	assert.NoError(t, FuzzStreamingPacket([]byte{0, 3, 1, 2, 3, 0, 0, 0, 1, 4}))
+	assert.Error(t, FuzzStreamingPacket([]byte{0, 3, 1}))
+	assert.Error(t, FuzzStreamingPacket([]byte{0xff, 0xff}))
+}
+
+func TestFuzzCandidate(t *testing.T) {
+	for _, raw := range []string{
+		"647372371 1 udp 1694498815 191.228.238.68 53991 typ srflx raddr 192.168.0.274 rport 53991",
+		"4207374052 1 tcp 1685790463 192.0.2.15 50000 typ host tcptype active generation 0",
+		"1052353102 1 udp 2113937151 d4f9e1d6-0df5-4f47-bd4f-6b1e3a2f7d4e.local 60542 typ host",
+	} {
+		assert.NoError(t, FuzzCandidate([]byte(raw)), raw)
+	}
+
+	err := FuzzCandidate([]byte("1 1 udp 1 1.2.3.4"))
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrFuzzPanic)
+}
+
+func TestRecoverFuzzPanic(t *testing.T) {
+	err := func() (err error) {
+		defer recoverFuzzPanic(&err)
+		panic("boom")
+	}()
+	assert.ErrorIs(t, err, ErrFuzzPanic)
+}
@@ -7,12 +7,15 @@ import (
 	"fmt"
 	"net"
 	"reflect"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/pion/dtls/v2"
 	"github.com/pion/logging"
 	"github.com/pion/turn/v2"
+	"golang.org/x/net/proxy"
 )
 
 const (
@@ -55,9 +58,13 @@ func (f *fakePacketConn) WriteTo(p []byte, addr net.Addr) (n int, err error) {
 	return f.nextConn.Write(p)
 }
 
-// GatherCandidates initiates the trickle based gathering process.
+// GatherCandidates initiates the trickle based gathering process. Failures
+// to gather candidates are reported by GetGatheringError and passed to the
+// OnGatheringComplete handler. In synchronous mode gathering is complete when
+// GatherCandidates returns, and they are returned.
 func (a *Agent) GatherCandidates() error {
 	var gatherErr error
+	var gatherCtx context.Context
 
 	if runErr := a.run(a.context(), func(ctx context.Context, agent *Agent) {
 		if a.gatheringState != GatheringStateNew {
@@ -73,54 +80,75 @@ func (a *Agent) GatherCandidates() error {
 		a.gatherCandidateCancel = cancel
 		a.gatherCandidateDone = make(chan struct{})
 
+		if a.synchronous {
+			gatherCtx = ctx
+			return
+		}
 		go a.gatherCandidates(ctx)
 	}); runErr != nil {
 		return runErr
 	}
+
+	// In synchronous mode gathering completes before GatherCandidates returns
+	if gatherCtx != nil {
+		a.gatherCandidates(gatherCtx)
+		return a.GetGatheringError()
+	}
 	return gatherErr
 }
 
 func (a *Agent) gatherCandidates(ctx context.Context) {
 	defer close(a.gatherCandidateDone)
+	a.clearGatheringErrors()
+	a.sockets.reset()
+	defer a.sockets.clearReservations()
+	a.natObservations.clear()
+
+	ctx, span := a.startSpan(ctx, spanGather)
+	defer span.End()
+
 	if err := a.setGatheringState(GatheringStateGathering); err != nil { //nolint:contextcheck
 		a.log.Warnf("failed to set gatheringState to GatheringStateGathering: %v", err)
 		return
 	}
 
 	var wg sync.WaitGroup
-	for _, t := range a.candidateTypes {
+	urls := a.getURLs()
+	types := a.gatheringOrder()
+	for i, t := range types {
+		if a.sockets.max > 0 {
+			a.sockets.hold(a.heldSockets(types[i:], urls))
+		}
+
 		switch t {
 		case CandidateTypeHost:
-			wg.Add(1)
-			go func() {
+			a.gatherGo(&wg, func() {
 				a.gatherCandidatesLocal(ctx, a.networkTypes)
-				wg.Done()
-			}()
+			})
 		case CandidateTypeServerReflexive:
-			wg.Add(1)
-			go func() {
+			a.gatherGo(&wg, func() {
 				if a.udpMuxSrflx != nil {
-					a.gatherCandidatesSrflxUDPMux(ctx, a.urls, a.networkTypes)
+					a.gatherCandidatesSrflxUDPMux(ctx, urls, a.networkTypes)
 				} else {
-					a.gatherCandidatesSrflx(ctx, a.urls, a.networkTypes)
+					a.gatherCandidatesSrflx(ctx, urls, a.networkTypes)
 				}
-				wg.Done()
-			}()
+			})
 			if a.extIPMapper != nil && a.extIPMapper.candidateType == CandidateTypeServerReflexive {
-				wg.Add(1)
-				go func() {
+				a.gatherGo(&wg, func() {
 					a.gatherCandidatesSrflxMapped(ctx, a.networkTypes)
-					wg.Done()
-				}()
+				})
 			}
 		case CandidateTypeRelay:
-			wg.Add(1)
-			go func() {
-				a.gatherCandidatesRelay(ctx, a.urls)
-				wg.Done()
-			}()
+			a.gatherGo(&wg, func() {
+				a.gatherCandidatesRelay(ctx, urls)
+			})
 		case CandidateTypePeerReflexive, CandidateTypeUnspecified:
 		}
+
+		if a.sockets.max > 0 {
+			// The less preferred types wait, leaving the budget to this one
+			wg.Wait()
+		}
 	}
 
 	// Block until all STUN and TURN URLs have been gathered (or timed out)
@@ -131,7 +159,62 @@ func (a *Agent) gatherCandidates(ctx context.Context) {
 	}
 }
 
+// gatheringOrder returns the candidate types to gather. With a socket
+// budget they are sorted by preference, as they are gathered in turn.
+func (a *Agent) gatheringOrder() []CandidateType {
+	if a.sockets.max <= 0 {
+		return a.candidateTypes
+	}
+	types := append([]CandidateType{}, a.candidateTypes...)
+	sort.SliceStable(types, func(i, j int) bool {
+		return types[i].Preference() > types[j].Preference()
+	})
+	return types
+}
+
+// gatherGo runs f on a goroutine tracked by wg. With DeterministicOrdering
+// or Synchronous f runs before gatherGo returns instead, so candidates are
+// gathered one after the other, in a stable order.
+func (a *Agent) gatherGo(wg *sync.WaitGroup, f func()) {
+	wg.Add(1)
+	if a.deterministicOrdering || a.synchronous {
+		defer wg.Done()
+		f()
+		return
+	}
+	go func() {
+		defer wg.Done()
+		f()
+	}()
+}
+
+// gatherWorker runs f, querying a server, like gatherGo. With
+// MaxGatheringConcurrency it first waits for a running worker to complete
+// if there are as many as allowed, the goroutine of f is only started then.
+// f is not run if ctx is done meanwhile.
+func (a *Agent) gatherWorker(ctx context.Context, wg *sync.WaitGroup, f func()) {
+	if a.gatherWorkers == nil || a.deterministicOrdering || a.synchronous {
+		a.gatherGo(wg, f)
+		return
+	}
+
+	select {
+	case a.gatherWorkers <- struct{}{}:
+	case <-ctx.Done():
+		return
+	}
+	a.gatherGo(wg, func() {
+		defer func() {
+			<-a.gatherWorkers
+		}()
+		f()
+	})
+}
+
 func (a *Agent) gatherCandidatesLocal(ctx context.Context, networkTypes []NetworkType) { //nolint:gocognit
+	ctx, span := a.startSpan(ctx, spanGatherHost)
+	defer span.End()
+
 	networks := map[string]struct{}{}
 	for _, networkType := range networkTypes {
 		if networkType.IsTCP() {
@@ -149,13 +232,26 @@ func (a *Agent) gatherCandidatesLocal(ctx context.Context, networkTypes []Networ
 		delete(networks, udp)
 	}
 
-	localIPs, err := localInterfaces(a.net, a.interfaceFilter, networkTypes)
+	localIPs, err := a.localIPs(networkTypes)
 	if err != nil {
 		a.log.Warnf("failed to iterate local interfaces, host candidates will not be gathered %s", err)
 		return
 	}
+	if a.deterministicOrdering {
+		sortIPs(localIPs)
+	}
+	adapterTypes := a.adapterTypesByIP()
+	if a.avoidExpensive {
+		localIPs = withoutExpensiveIPs(localIPs, adapterTypes)
+	}
 
 	for _, ip := range localIPs {
+		adapterType, adapterKnown := adapterTypes[ip.String()]
+		if adapterKnown && adapterType == AdapterTypeVirtual && a.skipVirtualAdapters {
+			a.log.Debugf("Skipping %s, on a virtual adapter", ip)
+			continue
+		}
+
 		mappedIP := ip
 		if a.mDNSMode != MulticastDNSModeQueryAndGather && a.extIPMapper != nil && a.extIPMapper.candidateType == CandidateTypeHost {
 			if _mappedIP, err := a.extIPMapper.findExternalIP(ip.String()); err == nil {
@@ -166,8 +262,12 @@ func (a *Agent) gatherCandidatesLocal(ctx context.Context, networkTypes []Networ
 		}
 
 		address := mappedIP.String()
-		if a.mDNSMode == MulticastDNSModeQueryAndGather {
+		name := a.localHostName(ip)
+		switch {
+		case a.mDNSMode == MulticastDNSModeQueryAndGather:
 			address = a.mDNSName
+		case name != "":
+			address = name
 		}
 
 		for network := range networks {
@@ -177,6 +277,7 @@ func (a *Agent) gatherCandidatesLocal(ctx context.Context, networkTypes []Networ
 				err     error
 				tcpType TCPType
 			)
+			started := a.clock.Now()
 
 			switch network {
 			case tcp:
@@ -186,9 +287,13 @@ func (a *Agent) gatherCandidatesLocal(ctx context.Context, networkTypes []Networ
 				if err != nil {
 					if !errors.Is(err, ErrTCPMuxNotInitialized) {
 						a.log.Warnf("error getting tcp conn by ufrag: %s %s %s", network, ip, a.localUfrag)
+						a.recordLocalError(ctx, CandidateTypeHost, network, ip.String(), err)
 					}
 					continue
 				}
+				if setter, ok := conn.(tcpOptionsSetter); ok && a.tcpOptions != nil {
+					setter.setTCPOptions(*a.tcpOptions)
+				}
 
 				if tcpConn, ok := conn.LocalAddr().(*net.TCPAddr); ok {
 					port = tcpConn.Port
@@ -200,9 +305,15 @@ func (a *Agent) gatherCandidatesLocal(ctx context.Context, networkTypes []Networ
 				// is there a way to verify that the listen address is even
 				// accessible from the current interface.
 			case udp:
-				conn, err = listenUDPInPortRange(a.net, a.log, int(a.portmax), int(a.portmin), network, &net.UDPAddr{IP: ip, Port: 0})
+				if !a.reserveSocket(ctx, CandidateTypeHost, network) {
+					continue
+				}
+				conn, err = listenUDPInPortRange(a.transport, a.log, int(a.portmax), int(a.portmin), network, &net.UDPAddr{IP: ip, Port: 0})
 				if err != nil {
-					a.log.Warnf("could not listen %s %s", network, ip)
+					if !a.handleSocketError(ctx, CandidateTypeHost, network, err) {
+						a.log.Warnf("could not listen %s %s", network, ip)
+						a.recordLocalError(ctx, CandidateTypeHost, network, ip.String(), err)
+					}
 					continue
 				}
 
@@ -213,12 +324,23 @@ func (a *Agent) gatherCandidatesLocal(ctx context.Context, networkTypes []Networ
 					continue
 				}
 			}
+			conn = a.captureConn(conn)
+
+			candidateAddress, candidateIP := address, ip
+			if portMappedIP, portMappedPort, ok := a.mapHostAddress(network, ip, port); ok {
+				if name == "" {
+					candidateAddress = portMappedIP.String()
+				}
+				candidateIP, port = portMappedIP, portMappedPort
+			}
+
 			hostConfig := CandidateHostConfig{
-				Network:   network,
-				Address:   address,
-				Port:      port,
-				Component: ComponentRTP,
-				TCPType:   tcpType,
+				CandidateID: a.candidateIDs.Generate(),
+				Network:     network,
+				Address:     candidateAddress,
+				Port:        port,
+				Component:   ComponentRTP,
+				TCPType:     tcpType,
 			}
 
 			c, err := NewCandidateHost(&hostConfig)
@@ -227,12 +349,19 @@ func (a *Agent) gatherCandidatesLocal(ctx context.Context, networkTypes []Networ
 				continue
 			}
 
-			if a.mDNSMode == MulticastDNSModeQueryAndGather {
-				if err = c.setIP(ip); err != nil {
+			if a.mDNSMode == MulticastDNSModeQueryAndGather || name != "" {
+				if err = c.setIP(candidateIP); err != nil {
 					closeConnAndLog(conn, a.log, fmt.Sprintf("Failed to create host candidate: %s %s %d: %v", network, mappedIP, port, err))
 					continue
 				}
 			}
+			c.setGatherInfo(candidateGatherInfo{started: started, completed: a.clock.Now()})
+			if adapterKnown {
+				cost := strconv.FormatUint(uint64(adapterType.networkCost()), 10)
+				if err = c.AddExtension(CandidateExtension{extensionNetworkCost, cost}); err != nil {
+					a.log.Warnf("Failed to set the network cost of %s: %v", c, err)
+				}
+			}
 
 			if err := a.addCandidate(ctx, c, conn); err != nil {
 				if closeErr := c.close(); closeErr != nil {
@@ -249,15 +378,19 @@ func (a *Agent) gatherCandidatesLocalUDPMux(ctx context.Context) error {
 		return errUDPMuxDisabled
 	}
 
-	localIPs, err := localInterfaces(a.net, a.interfaceFilter, a.networkTypes)
+	localIPs, err := a.localIPs(a.networkTypes)
 	switch {
 	case err != nil:
 		return err
 	case len(localIPs) == 0:
 		return errCandidateIPNotFound
 	}
+	if a.deterministicOrdering {
+		sortIPs(localIPs)
+	}
 
-	for _, candidateIP := range localIPs {
+	for _, localIP := range localIPs {
+		candidateIP := localIP
 		if a.extIPMapper != nil && a.extIPMapper.candidateType == CandidateTypeHost {
 			if mappedIP, err := a.extIPMapper.findExternalIP(candidateIP.String()); err != nil {
 				a.log.Warnf("1:1 NAT mapping is enabled but no external IP is found for %s", candidateIP.String())
@@ -267,6 +400,7 @@ func (a *Agent) gatherCandidatesLocalUDPMux(ctx context.Context) error {
 			}
 		}
 
+		started := a.clock.Now()
 		conn, err := a.udpMux.GetConn(a.localUfrag, candidateIP.To4() == nil)
 		if err != nil {
 			return err
@@ -278,11 +412,21 @@ func (a *Agent) gatherCandidatesLocalUDPMux(ctx context.Context) error {
 			continue
 		}
 
+		port := udpAddr.Port
+		if portMappedIP, portMappedPort, ok := a.mapHostAddress(udp, localIP, port); ok {
+			candidateIP, port = portMappedIP, portMappedPort
+		}
+		address := candidateIP.String()
+		name := a.localHostName(localIP)
+		if name != "" {
+			address = name
+		}
 		hostConfig := CandidateHostConfig{
-			Network:   udp,
-			Address:   candidateIP.String(),
-			Port:      udpAddr.Port,
-			Component: ComponentRTP,
+			CandidateID: a.candidateIDs.Generate(),
+			Network:     udp,
+			Address:     address,
+			Port:        port,
+			Component:   ComponentRTP,
 		}
 
 		c, err := NewCandidateHost(&hostConfig)
@@ -290,8 +434,15 @@ func (a *Agent) gatherCandidatesLocalUDPMux(ctx context.Context) error {
 			closeConnAndLog(conn, a.log, fmt.Sprintf("Failed to create host mux candidate: %s %d: %v", candidateIP, udpAddr.Port, err))
 			continue
 		}
+		if name != "" {
+			if err = c.setIP(candidateIP); err != nil {
+				closeConnAndLog(conn, a.log, fmt.Sprintf("Failed to create host mux candidate: %s %d: %v", candidateIP, udpAddr.Port, err))
+				continue
+			}
+		}
+		c.setGatherInfo(candidateGatherInfo{started: started, completed: a.clock.Now()})
 
-		if err := a.addCandidate(ctx, c, conn); err != nil {
+		if err := a.addCandidate(ctx, c, a.captureConn(conn)); err != nil {
 			if closeErr := c.close(); closeErr != nil {
 				a.log.Warnf("Failed to close candidate: %v", closeErr)
 			}
@@ -314,13 +465,17 @@ func (a *Agent) gatherCandidatesSrflxMapped(ctx context.Context, networkTypes []
 		}
 
 		network := networkType.String()
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-
-			conn, err := listenUDPInPortRange(a.net, a.log, int(a.portmax), int(a.portmin), network, &net.UDPAddr{IP: nil, Port: 0})
+		a.gatherWorker(ctx, &wg, func() {
+			started := a.clock.Now()
+			if !a.reserveSocket(ctx, CandidateTypeServerReflexive, network) {
+				return
+			}
+			conn, err := listenUDPInPortRange(a.transport, a.log, int(a.portmax), int(a.portmin), network, &net.UDPAddr{IP: nil, Port: 0})
 			if err != nil {
-				a.log.Warnf("Failed to listen %s: %v", network, err)
+				if !a.handleSocketError(ctx, CandidateTypeServerReflexive, network, err) {
+					a.log.Warnf("Failed to listen %s: %v", network, err)
+					a.recordLocalError(ctx, CandidateTypeServerReflexive, network, "", err)
+				}
 				return
 			}
 
@@ -336,13 +491,15 @@ func (a *Agent) gatherCandidatesSrflxMapped(ctx context.Context, networkTypes []
 				return
 			}
 
+			relAddr, relPort := a.hostDisclosure.relatedAddress(laddr.IP.String(), laddr.Port)
 			srflxConfig := CandidateServerReflexiveConfig{
-				Network:   network,
-				Address:   mappedIP.String(),
-				Port:      laddr.Port,
-				Component: ComponentRTP,
-				RelAddr:   laddr.IP.String(),
-				RelPort:   laddr.Port,
+				CandidateID: a.candidateIDs.Generate(),
+				Network:     network,
+				Address:     mappedIP.String(),
+				Port:        laddr.Port,
+				Component:   ComponentRTP,
+				RelAddr:     relAddr,
+				RelPort:     relPort,
 			}
 			c, err := NewCandidateServerReflexive(&srflxConfig)
 			if err != nil {
@@ -353,14 +510,15 @@ func (a *Agent) gatherCandidatesSrflxMapped(ctx context.Context, networkTypes []
 					err))
 				return
 			}
+			c.setGatherInfo(candidateGatherInfo{started: started, completed: a.clock.Now()})
 
-			if err := a.addCandidate(ctx, c, conn); err != nil {
+			if err := a.addCandidate(ctx, c, a.captureConn(conn)); err != nil {
 				if closeErr := c.close(); closeErr != nil {
 					a.log.Warnf("Failed to close candidate: %v", closeErr)
 				}
 				a.log.Warnf("Failed to append to localCandidates and run onCandidateHdlr: %v", err)
 			}
-		}()
+		})
 	}
 }
 
@@ -374,22 +532,27 @@ func (a *Agent) gatherCandidatesSrflxUDPMux(ctx context.Context, urls []*URL, ne
 		}
 
 		for i := range urls {
-			wg.Add(1)
-			go func(url URL, network string, isIPv6 bool) {
-				defer wg.Done()
-
-				hostPort := fmt.Sprintf("%s:%d", url.Host, url.Port)
-				serverAddr, err := a.net.ResolveUDPAddr(network, hostPort)
+			url, network, isIPv6 := *urls[i], networkType.String(), networkType.IsIPv6()
+			a.gatherWorker(ctx, &wg, func() {
+				ctx, span := a.startGatherSpan(ctx, spanGatherSrflx, url, network)
+				defer span.End()
+
+				started := a.clock.Now()
+				hostPort := net.JoinHostPort(url.Host, strconv.Itoa(url.Port))
+				serverAddr, err := a.transport.ResolveUDPAddr(network, hostPort)
 				if err != nil {
 					a.log.Warnf("failed to resolve stun host: %s: %v", hostPort, err)
+					a.recordServerError(ctx, CandidateTypeServerReflexive, url, network, err)
 					return
 				}
 
 				xoraddr, err := a.udpMuxSrflx.GetXORMappedAddr(serverAddr, stunGatherTimeout)
 				if err != nil {
 					a.log.Warnf("could not get server reflexive address %s %s: %v", network, url, err)
+					a.recordServerError(ctx, CandidateTypeServerReflexive, url, network, err)
 					return
 				}
+				completed := a.clock.Now()
 
 				conn, err := a.udpMuxSrflx.GetConnForURL(a.localUfrag, url.String(), isIPv6)
 				if err != nil {
@@ -405,28 +568,32 @@ func (a *Agent) gatherCandidatesSrflxUDPMux(ctx context.Context, urls []*URL, ne
 					closeConnAndLog(conn, a.log, fmt.Sprintf("Failed to create server reflexive candidate: %s %s %d: cast failed", network, ip, port))
 					return
 				}
+				a.natObservations.add(laddr, serverAddr, &net.UDPAddr{IP: ip, Port: port})
 
+				relAddr, relPort := a.hostDisclosure.relatedAddress(laddr.IP.String(), laddr.Port)
 				srflxConfig := CandidateServerReflexiveConfig{
-					Network:   network,
-					Address:   ip.String(),
-					Port:      port,
-					Component: ComponentRTP,
-					RelAddr:   laddr.IP.String(),
-					RelPort:   laddr.Port,
+					CandidateID: a.candidateIDs.Generate(),
+					Network:     network,
+					Address:     ip.String(),
+					Port:        port,
+					Component:   ComponentRTP,
+					RelAddr:     relAddr,
+					RelPort:     relPort,
 				}
 				c, err := NewCandidateServerReflexive(&srflxConfig)
 				if err != nil {
 					closeConnAndLog(conn, a.log, fmt.Sprintf("Failed to create server reflexive candidate: %s %s %d: %v", network, ip, port, err))
 					return
 				}
+				c.setGatherInfo(candidateGatherInfo{url: url.String(), started: started, completed: completed})
 
-				if err := a.addCandidate(ctx, c, conn); err != nil {
+				if err := a.addCandidate(ctx, c, a.captureConn(conn)); err != nil {
 					if closeErr := c.close(); closeErr != nil {
 						a.log.Warnf("Failed to close candidate: %v", closeErr)
 					}
 					a.log.Warnf("Failed to append to localCandidates and run onCandidateHdlr: %v", err)
 				}
-			}(*urls[i], networkType.String(), networkType.IsIPv6())
+			})
 		}
 	}
 }
@@ -440,23 +607,41 @@ func (a *Agent) gatherCandidatesSrflx(ctx context.Context, urls []*URL, networkT
 			continue
 		}
 
-		for i := range urls {
-			wg.Add(1)
-			go func(url URL, network string) {
-				defer wg.Done()
+		if a.probeNAT && len(urls) > 1 {
+			network := networkType.String()
+			a.gatherWorker(ctx, &wg, func() {
+				a.probeNATMapping(ctx, urls, network)
+			})
+		}
 
-				hostPort := fmt.Sprintf("%s:%d", url.Host, url.Port)
-				serverAddr, err := a.net.ResolveUDPAddr(network, hostPort)
+		for i := range urls {
+			url, network := *urls[i], networkType.String()
+			a.gatherWorker(ctx, &wg, func() {
+				ctx, span := a.startGatherSpan(ctx, spanGatherSrflx, url, network)
+				defer span.End()
+
+				started := a.clock.Now()
+				hostPort := net.JoinHostPort(url.Host, strconv.Itoa(url.Port))
+				serverAddr, err := a.transport.ResolveUDPAddr(network, hostPort)
 				if err != nil {
 					a.log.Warnf("failed to resolve stun host: %s: %v", hostPort, err)
+					a.recordServerError(ctx, CandidateTypeServerReflexive, url, network, err)
 					return
 				}
 
-				conn, err := listenUDPInPortRange(a.net, a.log, int(a.portmax), int(a.portmin), network, &net.UDPAddr{IP: nil, Port: 0})
+				if !a.reserveSocket(ctx, CandidateTypeServerReflexive, network) {
+					return
+				}
+				udpConn, err := listenUDPInPortRange(a.transport, a.log, int(a.portmax), int(a.portmin), network, &net.UDPAddr{IP: nil, Port: 0})
 				if err != nil {
-					closeConnAndLog(conn, a.log, fmt.Sprintf("Failed to listen for %s: %v", serverAddr.String(), err))
+					if !a.handleSocketError(ctx, CandidateTypeServerReflexive, network, err) {
+						closeConnAndLog(udpConn, a.log, fmt.Sprintf("Failed to listen for %s: %v", serverAddr.String(), err))
+						a.recordServerError(ctx, CandidateTypeServerReflexive, url, network, err)
+					}
 					return
 				}
+				conn := a.captureConn(udpConn)
+
 				// If the agent closes midway through the connection
 				// we end it early to prevent close delay.
 				cancelCtx, cancelFunc := context.WithCancel(ctx)
@@ -473,26 +658,32 @@ func (a *Agent) gatherCandidatesSrflx(ctx context.Context, urls []*URL, networkT
 				xoraddr, err := getXORMappedAddr(conn, serverAddr, stunGatherTimeout)
 				if err != nil {
 					closeConnAndLog(conn, a.log, fmt.Sprintf("could not get server reflexive address %s %s: %v", network, url, err))
+					a.recordServerError(ctx, CandidateTypeServerReflexive, url, network, err)
 					return
 				}
+				completed := a.clock.Now()
 
 				ip := xoraddr.IP
 				port := xoraddr.Port
 
 				laddr := conn.LocalAddr().(*net.UDPAddr) //nolint:forcetypeassert
+				a.natObservations.add(laddr, serverAddr, &net.UDPAddr{IP: ip, Port: port})
+				relAddr, relPort := a.hostDisclosure.relatedAddress(laddr.IP.String(), laddr.Port)
 				srflxConfig := CandidateServerReflexiveConfig{
-					Network:   network,
-					Address:   ip.String(),
-					Port:      port,
-					Component: ComponentRTP,
-					RelAddr:   laddr.IP.String(),
-					RelPort:   laddr.Port,
+					CandidateID: a.candidateIDs.Generate(),
+					Network:     network,
+					Address:     ip.String(),
+					Port:        port,
+					Component:   ComponentRTP,
+					RelAddr:     relAddr,
+					RelPort:     relPort,
 				}
 				c, err := NewCandidateServerReflexive(&srflxConfig)
 				if err != nil {
 					closeConnAndLog(conn, a.log, fmt.Sprintf("Failed to create server reflexive candidate: %s %s %d: %v", network, ip, port, err))
 					return
 				}
+				c.setGatherInfo(candidateGatherInfo{url: url.String(), started: started, completed: completed})
 
 				if err := a.addCandidate(ctx, c, conn); err != nil {
 					if closeErr := c.close(); closeErr != nil {
@@ -500,7 +691,7 @@ func (a *Agent) gatherCandidatesSrflx(ctx context.Context, urls []*URL, networkT
 					}
 					a.log.Warnf("Failed to append to localCandidates and run onCandidateHdlr: %v", err)
 				}
-			}(*urls[i], networkType.String())
+			})
 		}
 	}
 }
@@ -516,105 +707,33 @@ func (a *Agent) gatherCandidatesRelay(ctx context.Context, urls []*URL) { //noli
 			continue
 		case urls[i].Username == "":
 			a.log.Errorf("Failed to gather relay candidates: %v", ErrUsernameEmpty)
+			a.recordServerError(ctx, CandidateTypeRelay, *urls[i], network, ErrUsernameEmpty)
 			return
 		case urls[i].Password == "":
 			a.log.Errorf("Failed to gather relay candidates: %v", ErrPasswordEmpty)
+			a.recordServerError(ctx, CandidateTypeRelay, *urls[i], network, ErrPasswordEmpty)
 			return
 		}
 
-		wg.Add(1)
-		go func(url URL) {
-			defer wg.Done()
-			TURNServerAddr := fmt.Sprintf("%s:%d", url.Host, url.Port)
-			var (
-				locConn       net.PacketConn
-				err           error
-				RelAddr       string
-				RelPort       int
-				relayProtocol string
-			)
-
-			switch {
-			case url.Proto == ProtoTypeUDP && url.Scheme == SchemeTypeTURN:
-				if locConn, err = a.net.ListenPacket(network, "0.0.0.0:0"); err != nil {
-					a.log.Warnf("Failed to listen %s: %v", network, err)
-					return
-				}
-
-				RelAddr = locConn.LocalAddr().(*net.UDPAddr).IP.String() //nolint:forcetypeassert
-				RelPort = locConn.LocalAddr().(*net.UDPAddr).Port        //nolint:forcetypeassert
-				relayProtocol = udp
-			case a.proxyDialer != nil && url.Proto == ProtoTypeTCP &&
-				(url.Scheme == SchemeTypeTURN || url.Scheme == SchemeTypeTURNS):
-				conn, connectErr := a.proxyDialer.Dial(NetworkTypeTCP4.String(), TURNServerAddr)
-				if connectErr != nil {
-					a.log.Warnf("Failed to Dial TCP Addr %s via proxy dialer: %v", TURNServerAddr, connectErr)
-					return
-				}
-
-				RelAddr = conn.LocalAddr().(*net.TCPAddr).IP.String() //nolint:forcetypeassert
-				RelPort = conn.LocalAddr().(*net.TCPAddr).Port        //nolint:forcetypeassert
-				if url.Scheme == SchemeTypeTURN {
-					relayProtocol = tcp
-				} else if url.Scheme == SchemeTypeTURNS {
-					relayProtocol = "tls"
-				}
-				locConn = turn.NewSTUNConn(conn)
-
-			case url.Proto == ProtoTypeTCP && url.Scheme == SchemeTypeTURN:
-				tcpAddr, connectErr := net.ResolveTCPAddr(NetworkTypeTCP4.String(), TURNServerAddr)
-				if connectErr != nil {
-					a.log.Warnf("Failed to resolve TCP Addr %s: %v", TURNServerAddr, connectErr)
-					return
-				}
-
-				conn, connectErr := net.DialTCP(NetworkTypeTCP4.String(), nil, tcpAddr)
-				if connectErr != nil {
-					a.log.Warnf("Failed to Dial TCP Addr %s: %v", TURNServerAddr, connectErr)
-					return
-				}
-
-				RelAddr = conn.LocalAddr().(*net.TCPAddr).IP.String() //nolint:forcetypeassert
-				RelPort = conn.LocalAddr().(*net.TCPAddr).Port        //nolint:forcetypeassert
-				relayProtocol = tcp
-				locConn = turn.NewSTUNConn(conn)
-			case url.Proto == ProtoTypeUDP && url.Scheme == SchemeTypeTURNS:
-				udpAddr, connectErr := net.ResolveUDPAddr(network, TURNServerAddr)
-				if connectErr != nil {
-					a.log.Warnf("Failed to resolve UDP Addr %s: %v", TURNServerAddr, connectErr)
-					return
-				}
-
-				conn, connectErr := dtls.Dial(network, udpAddr, &dtls.Config{
-					ServerName:         url.Host,
-					InsecureSkipVerify: a.insecureSkipVerify, //nolint:gosec
-				})
-				if connectErr != nil {
-					a.log.Warnf("Failed to Dial DTLS Addr %s: %v", TURNServerAddr, connectErr)
-					return
-				}
-
-				RelAddr = conn.LocalAddr().(*net.UDPAddr).IP.String() //nolint:forcetypeassert
-				RelPort = conn.LocalAddr().(*net.UDPAddr).Port        //nolint:forcetypeassert
-				relayProtocol = "dtls"
-				locConn = &fakePacketConn{conn}
-			case url.Proto == ProtoTypeTCP && url.Scheme == SchemeTypeTURNS:
-				conn, connectErr := tls.Dial(NetworkTypeTCP4.String(), TURNServerAddr, &tls.Config{
-					InsecureSkipVerify: a.insecureSkipVerify, //nolint:gosec
-				})
-				if connectErr != nil {
-					a.log.Warnf("Failed to Dial TLS Addr %s: %v", TURNServerAddr, connectErr)
-					return
+		url := *urls[i]
+		a.gatherWorker(ctx, &wg, func() {
+			ctx, span := a.startGatherSpan(ctx, spanGatherRelay, url, network)
+			defer span.End()
+			started := a.clock.Now()
+			TURNServerAddr := net.JoinHostPort(url.Host, strconv.Itoa(url.Port))
+			if !a.reserveSocket(ctx, CandidateTypeRelay, network) {
+				return
+			}
+			locConn, RelAddr, RelPort, relayProtocol, err := a.dialTURNServer(url, network)
+			if err != nil {
+				if !a.handleSocketError(ctx, CandidateTypeRelay, network, err) {
+					a.recordServerError(ctx, CandidateTypeRelay, url, network, err)
 				}
-				RelAddr = conn.LocalAddr().(*net.TCPAddr).IP.String() //nolint:forcetypeassert
-				RelPort = conn.LocalAddr().(*net.TCPAddr).Port        //nolint:forcetypeassert
-				relayProtocol = "tls"
-				locConn = turn.NewSTUNConn(conn)
-			default:
-				a.log.Warnf("Unable to handle URL in gatherCandidatesRelay %v", url)
 				return
 			}
 
+			locConn = a.captureConn(locConn)
+
 			client, err := turn.NewClient(&turn.ClientConfig{
 				TURNServerAddr: TURNServerAddr,
 				Conn:           locConn,
@@ -625,12 +744,14 @@ func (a *Agent) gatherCandidatesRelay(ctx context.Context, urls []*URL) { //noli
 			})
 			if err != nil {
 				closeConnAndLog(locConn, a.log, fmt.Sprintf("Failed to build new turn.Client %s %s", TURNServerAddr, err))
+				a.recordServerError(ctx, CandidateTypeRelay, url, network, err)
 				return
 			}
 
 			if err = client.Listen(); err != nil {
 				client.Close()
 				closeConnAndLog(locConn, a.log, fmt.Sprintf("Failed to listen on turn.Client %s %s", TURNServerAddr, err))
+				a.recordServerError(ctx, CandidateTypeRelay, url, network, err)
 				return
 			}
 
@@ -638,11 +759,15 @@ func (a *Agent) gatherCandidatesRelay(ctx context.Context, urls []*URL) { //noli
 			if err != nil {
 				client.Close()
 				closeConnAndLog(locConn, a.log, fmt.Sprintf("Failed to allocate on turn.Client %s %s", TURNServerAddr, err))
+				a.recordServerError(ctx, CandidateTypeRelay, url, network, err)
 				return
 			}
+			completed := a.clock.Now()
 
+			RelAddr, RelPort = a.hostDisclosure.relatedAddress(RelAddr, RelPort)
 			raddr := relayConn.LocalAddr().(*net.UDPAddr) //nolint:forcetypeassert
 			relayConfig := CandidateRelayConfig{
+				CandidateID:   a.candidateIDs.Generate(),
 				Network:       network,
 				Component:     ComponentRTP,
 				Address:       raddr.IP.String(),
@@ -668,8 +793,9 @@ func (a *Agent) gatherCandidatesRelay(ctx context.Context, urls []*URL) { //noli
 				closeConnAndLog(locConn, a.log, fmt.Sprintf("Failed to create relay candidate: %s %s: %v", network, raddr.String(), err))
 				return
 			}
+			candidate.setGatherInfo(candidateGatherInfo{url: url.String(), started: started, completed: completed})
 
-			if err := a.addCandidate(ctx, candidate, relayConn); err != nil {
+			if err := a.addCandidate(ctx, candidate, a.captureConn(relayConn)); err != nil {
 				relayConnClose()
 
 				if closeErr := candidate.close(); closeErr != nil {
@@ -677,6 +803,106 @@ func (a *Agent) gatherCandidatesRelay(ctx context.Context, urls []*URL) { //noli
 				}
 				a.log.Warnf("Failed to append to localCandidates and run onCandidateHdlr: %v", err)
 			}
-		}(*urls[i])
+		})
+	}
+}
+
+// proxyDialerFor returns the dialer of the TURN servers of url over TCP, nil
+// if they are dialed directly.
+func (a *Agent) proxyDialerFor(url URL) proxy.Dialer {
+	if a.proxyDialerFunc != nil {
+		return a.proxyDialerFunc(url)
+	}
+	return a.proxyDialer
+}
+
+// dialTURNServer opens the connection to the TURN server of url, it returns
+// the connection along with its local address and the relay protocol.
+func (a *Agent) dialTURNServer(url URL, network string) (locConn net.PacketConn, relAddr string, relPort int, relayProtocol string, err error) { //nolint:gocognit
+	turnServerAddr := net.JoinHostPort(url.Host, strconv.Itoa(url.Port))
+	proxyDialer := a.proxyDialerFor(url)
+
+	switch {
+	case url.Proto == ProtoTypeUDP && url.Scheme == SchemeTypeTURN:
+		if locConn, err = a.transport.ListenPacket(network, &net.UDPAddr{IP: nil, Port: 0}); err != nil {
+			a.log.Warnf("Failed to listen %s: %v", network, err)
+			return nil, "", 0, "", err
+		}
+
+		relAddr = locConn.LocalAddr().(*net.UDPAddr).IP.String() //nolint:forcetypeassert
+		relPort = locConn.LocalAddr().(*net.UDPAddr).Port        //nolint:forcetypeassert
+		relayProtocol = udp
+	case proxyDialer != nil && url.Proto == ProtoTypeTCP &&
+		(url.Scheme == SchemeTypeTURN || url.Scheme == SchemeTypeTURNS):
+		conn, connectErr := proxyDialer.Dial(NetworkTypeTCP4.String(), turnServerAddr)
+		if connectErr != nil {
+			a.log.Warnf("Failed to Dial TCP Addr %s via proxy dialer: %v", turnServerAddr, connectErr)
+			return nil, "", 0, "", connectErr
+		}
+
+		relAddr = conn.LocalAddr().(*net.TCPAddr).IP.String() //nolint:forcetypeassert
+		relPort = conn.LocalAddr().(*net.TCPAddr).Port        //nolint:forcetypeassert
+		if url.Scheme == SchemeTypeTURN {
+			relayProtocol = tcp
+		} else if url.Scheme == SchemeTypeTURNS {
+			relayProtocol = "tls"
+		}
+		locConn = &turnStreamConn{conn}
+
+	case url.Proto == ProtoTypeTCP && url.Scheme == SchemeTypeTURN:
+		tcpAddr, connectErr := net.ResolveTCPAddr(NetworkTypeTCP4.String(), turnServerAddr)
+		if connectErr != nil {
+			a.log.Warnf("Failed to resolve TCP Addr %s: %v", turnServerAddr, connectErr)
+			return nil, "", 0, "", connectErr
+		}
+
+		conn, connectErr := net.DialTCP(NetworkTypeTCP4.String(), nil, tcpAddr)
+		if connectErr != nil {
+			a.log.Warnf("Failed to Dial TCP Addr %s: %v", turnServerAddr, connectErr)
+			return nil, "", 0, "", connectErr
+		}
+
+		relAddr = conn.LocalAddr().(*net.TCPAddr).IP.String() //nolint:forcetypeassert
+		relPort = conn.LocalAddr().(*net.TCPAddr).Port        //nolint:forcetypeassert
+		relayProtocol = tcp
+		locConn = &turnStreamConn{conn}
+	case url.Proto == ProtoTypeUDP && url.Scheme == SchemeTypeTURNS:
+		udpAddr, connectErr := net.ResolveUDPAddr(network, turnServerAddr)
+		if connectErr != nil {
+			a.log.Warnf("Failed to resolve UDP Addr %s: %v", turnServerAddr, connectErr)
+			return nil, "", 0, "", connectErr
+		}
+
+		conn, connectErr := dtls.Dial(network, udpAddr, &dtls.Config{
+			ServerName:            url.Host,
+			InsecureSkipVerify:    a.insecureSkipVerify, //nolint:gosec
+			VerifyPeerCertificate: a.turnVerifyPeerCertificate(),
+		})
+		if connectErr != nil {
+			a.log.Warnf("Failed to Dial DTLS Addr %s: %v", turnServerAddr, connectErr)
+			return nil, "", 0, "", connectErr
+		}
+
+		relAddr = conn.LocalAddr().(*net.UDPAddr).IP.String() //nolint:forcetypeassert
+		relPort = conn.LocalAddr().(*net.UDPAddr).Port        //nolint:forcetypeassert
+		relayProtocol = "dtls"
+		locConn = &fakePacketConn{conn}
+	case url.Proto == ProtoTypeTCP && url.Scheme == SchemeTypeTURNS:
+		conn, connectErr := tls.Dial(NetworkTypeTCP4.String(), turnServerAddr, &tls.Config{
+			InsecureSkipVerify:    a.insecureSkipVerify, //nolint:gosec
+			VerifyPeerCertificate: a.turnVerifyPeerCertificate(),
+		})
+		if connectErr != nil {
+			a.log.Warnf("Failed to Dial TLS Addr %s: %v", turnServerAddr, connectErr)
+			return nil, "", 0, "", connectErr
+		}
+		relAddr = conn.LocalAddr().(*net.TCPAddr).IP.String() //nolint:forcetypeassert
+		relPort = conn.LocalAddr().(*net.TCPAddr).Port        //nolint:forcetypeassert
+		relayProtocol = "tls"
+		locConn = &turnStreamConn{conn}
+	default:
+		a.log.Warnf("Unable to handle URL in gatherCandidatesRelay %v", url)
+		return nil, "", 0, "", ErrProtoType
 	}
+	return locConn, relAddr, relPort, relayProtocol, nil
 }
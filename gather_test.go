@@ -37,14 +37,14 @@ func TestListenUDP(t *testing.T) {
 
 	ip := localIPs[0]
 
-	conn, err := listenUDPInPortRange(a.net, a.log, 0, 0, udp, &net.UDPAddr{IP: ip, Port: 0})
+	conn, err := listenUDPInPortRange(a.transport, a.log, 0, 0, udp, &net.UDPAddr{IP: ip, Port: 0})
 	assert.NoError(t, err, "listenUDP error with no port restriction")
 	assert.NotNil(t, conn, "listenUDP error with no port restriction return a nil conn")
 
-	_, err = listenUDPInPortRange(a.net, a.log, 4999, 5000, udp, &net.UDPAddr{IP: ip, Port: 0})
+	_, err = listenUDPInPortRange(a.transport, a.log, 4999, 5000, udp, &net.UDPAddr{IP: ip, Port: 0})
 	assert.Equal(t, err, ErrPort, "listenUDP with invalid port range did not return ErrPort")
 
-	conn, err = listenUDPInPortRange(a.net, a.log, 5000, 5000, udp, &net.UDPAddr{IP: ip, Port: 0})
+	conn, err = listenUDPInPortRange(a.transport, a.log, 5000, 5000, udp, &net.UDPAddr{IP: ip, Port: 0})
 	assert.NoError(t, err, "listenUDP error with no port restriction")
 	assert.NotNil(t, conn, "listenUDP error with no port restriction return a nil conn")
 
@@ -58,7 +58,7 @@ func TestListenUDP(t *testing.T) {
 	result := make([]int, 0, total)
 	portRange := make([]int, 0, total)
 	for i := 0; i < total; i++ {
-		conn, err = listenUDPInPortRange(a.net, a.log, portMax, portMin, udp, &net.UDPAddr{IP: ip, Port: 0})
+		conn, err = listenUDPInPortRange(a.transport, a.log, portMax, portMin, udp, &net.UDPAddr{IP: ip, Port: 0})
 		assert.NoError(t, err, "listenUDP error with no port restriction")
 		assert.NotNil(t, conn, "listenUDP error with no port restriction return a nil conn")
 
@@ -80,7 +80,7 @@ func TestListenUDP(t *testing.T) {
 	if !reflect.DeepEqual(result, portRange) {
 		t.Fatalf("listenUDP with port restriction [%d, %d], got:%v, want:%v", portMin, portMax, result, portRange)
 	}
-	_, err = listenUDPInPortRange(a.net, a.log, portMax, portMin, udp, &net.UDPAddr{IP: ip, Port: 0})
+	_, err = listenUDPInPortRange(a.transport, a.log, portMax, portMin, udp, &net.UDPAddr{IP: ip, Port: 0})
 	assert.Equal(t, err, ErrPort, "listenUDP with port restriction [%d, %d], did not return ErrPort", portMin, portMax)
 
 	assert.NoError(t, a.Close())
@@ -162,6 +162,60 @@ func TestSTUNConcurrency(t *testing.T) {
 	assert.NoError(t, server.Close())
 }
 
+func TestSTUNIPv6Literal(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	serverListener, err := net.ListenPacket("udp6", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 is not available")
+	}
+
+	server, err := turn.NewServer(turn.ServerConfig{
+		Realm:       "pion.ly",
+		AuthHandler: optimisticAuthHandler,
+		PacketConnConfigs: []turn.PacketConnConfig{
+			{
+				PacketConn:            serverListener,
+				RelayAddressGenerator: &turn.RelayAddressGeneratorNone{Address: "::1"},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	url, err := ParseURL("stun:" + serverListener.LocalAddr().String())
+	require.NoError(t, err)
+	assert.Equal(t, "::1", url.Host)
+
+	a, err := NewAgent(&AgentConfig{
+		NetworkTypes:   []NetworkType{NetworkTypeUDP6},
+		Urls:           []*URL{url},
+		CandidateTypes: []CandidateType{CandidateTypeServerReflexive},
+	})
+	require.NoError(t, err)
+
+	candidateGathered, candidateGatheredFunc := context.WithCancel(context.Background())
+	var srflx []Candidate
+	require.NoError(t, a.OnCandidate(func(c Candidate) {
+		if c == nil {
+			candidateGatheredFunc()
+			return
+		}
+		srflx = append(srflx, c)
+	}))
+	require.NoError(t, a.GatherCandidates())
+	<-candidateGathered.Done()
+
+	require.Len(t, srflx, 1)
+	assert.Equal(t, "::1", srflx[0].Address())
+
+	assert.NoError(t, a.Close())
+	assert.NoError(t, server.Close())
+}
+
 // Assert that TURN gathering is done concurrently
 func TestTURNConcurrency(t *testing.T) {
 	report := test.CheckRoutines(t)
@@ -407,6 +461,91 @@ func TestTURNSrflx(t *testing.T) {
 	assert.NoError(t, server.Close())
 }
 
+func TestGatheringTimingStats(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	serverPort := randomPort(t)
+	serverListener, err := net.ListenPacket("udp4", "127.0.0.1:"+strconv.Itoa(serverPort))
+	assert.NoError(t, err)
+
+	server, err := turn.NewServer(turn.ServerConfig{
+		Realm:       "pion.ly",
+		AuthHandler: optimisticAuthHandler,
+		PacketConnConfigs: []turn.PacketConnConfig{
+			{
+				PacketConn:            serverListener,
+				RelayAddressGenerator: &turn.RelayAddressGeneratorNone{Address: "127.0.0.1"},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	turnURL := &URL{
+		Scheme:   SchemeTypeTURN,
+		Proto:    ProtoTypeUDP,
+		Host:     "127.0.0.1",
+		Port:     serverPort,
+		Username: "username",
+		Password: "password",
+	}
+
+	a, err := NewAgent(&AgentConfig{
+		NetworkTypes:   []NetworkType{NetworkTypeUDP4},
+		Urls:           []*URL{turnURL},
+		CandidateTypes: []CandidateType{CandidateTypeHost, CandidateTypeServerReflexive, CandidateTypeRelay},
+	})
+	assert.NoError(t, err)
+
+	candidateGathered, candidateGatheredFunc := context.WithCancel(context.Background())
+	var origins sync.Map
+	assert.NoError(t, a.OnCandidate(func(c Candidate) {
+		if c == nil {
+			candidateGatheredFunc()
+			return
+		}
+		origins.Store(c.Type(), c.Origin())
+	}))
+
+	assert.NoError(t, a.GatherCandidates())
+
+	<-candidateGathered.Done()
+
+	// Candidates are attributed to the server they were gathered from
+	for candidateType, want := range map[CandidateType]string{
+		CandidateTypeHost:            CandidateOriginLocal,
+		CandidateTypeServerReflexive: turnURL.String(),
+		CandidateTypeRelay:           turnURL.String(),
+	} {
+		origin, ok := origins.Load(candidateType)
+		assert.True(t, ok, candidateType.String())
+		assert.Equal(t, want, origin)
+	}
+
+	seen := map[CandidateType]bool{}
+	for _, stat := range a.GetLocalCandidatesStats() {
+		seen[stat.CandidateType] = true
+
+		assert.False(t, stat.GatheringStartTimestamp.IsZero())
+		assert.False(t, stat.GatheringCompleteTimestamp.Before(stat.GatheringStartTimestamp))
+
+		switch stat.CandidateType {
+		case CandidateTypeHost:
+			assert.Equal(t, "", stat.URL)
+		case CandidateTypeServerReflexive, CandidateTypeRelay:
+			assert.Equal(t, turnURL.String(), stat.URL)
+		default:
+		}
+	}
+	assert.True(t, seen[CandidateTypeRelay])
+
+	assert.NoError(t, a.Close())
+	assert.NoError(t, server.Close())
+}
+
 func TestCloseConnLog(t *testing.T) {
 	a, err := NewAgent(&AgentConfig{})
 	assert.NoError(t, err)
@@ -488,6 +627,126 @@ func TestTURNProxyDialer(t *testing.T) {
 	assert.NoError(t, a.Close())
 }
 
+type recordingProxy struct {
+	mu     sync.Mutex
+	dialed []string
+}
+
+func (p *recordingProxy) Dial(network, addr string) (net.Conn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dialed = append(p.dialed, addr)
+	return &mockConn{}, nil
+}
+
+func TestTURNProxyDialerFunc(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	corporateProxy := &recordingProxy{}
+	a, err := NewAgent(&AgentConfig{
+		CandidateTypes: []CandidateType{CandidateTypeRelay},
+		NetworkTypes:   supportedNetworkTypes(),
+		Urls: []*URL{
+			{Scheme: SchemeTypeTURN, Host: "127.0.0.1", Username: "username", Password: "password", Proto: ProtoTypeTCP, Port: 5000},
+			{Scheme: SchemeTypeTURN, Host: "127.0.0.1", Username: "username", Password: "password", Proto: ProtoTypeTCP, Port: 5001},
+		},
+		ProxyDialer: &mockProxy{func() { t.Error("ProxyDialer used along with ProxyDialerFunc") }},
+		ProxyDialerFunc: func(url URL) proxy.Dialer {
+			if url.Port == 5001 {
+				return corporateProxy
+			}
+			return nil
+		},
+	})
+	assert.NoError(t, err)
+
+	candidateGatherFinish, candidateGatherFinishFunc := context.WithCancel(context.Background())
+	assert.NoError(t, a.OnCandidate(func(c Candidate) {
+		if c == nil {
+			candidateGatherFinishFunc()
+		}
+	}))
+
+	assert.NoError(t, a.GatherCandidates())
+	<-candidateGatherFinish.Done()
+
+	corporateProxy.mu.Lock()
+	assert.Equal(t, []string{"127.0.0.1:5001"}, corporateProxy.dialed)
+	corporateProxy.mu.Unlock()
+
+	assert.NoError(t, a.Close())
+}
+
+func TestMaxGatheringConcurrency(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	a, err := NewAgent(&AgentConfig{MaxGatheringConcurrency: 2})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	dispatched := make(chan struct{})
+	go func() {
+		defer close(dispatched)
+		for i := 0; i < 6; i++ {
+			a.gatherWorker(context.Background(), &wg, func() {
+				mu.Lock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				mu.Unlock()
+
+				<-release
+
+				mu.Lock()
+				running--
+				mu.Unlock()
+			})
+		}
+	}()
+
+	// The third worker waits for one of the first two
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return running == 2
+	}, time.Second, time.Millisecond)
+	select {
+	case <-dispatched:
+		t.Fatal("workers past the limit were started")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	<-dispatched
+	wg.Wait()
+	assert.Equal(t, 2, maxRunning)
+
+	// A worker waiting for its turn gives up once gathering is canceled
+	a.gatherWorkers <- struct{}{}
+	a.gatherWorkers <- struct{}{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	a.gatherWorker(ctx, &wg, func() {
+		t.Error("worker started after gathering was canceled")
+	})
+	wg.Wait()
+	<-a.gatherWorkers
+	<-a.gatherWorkers
+}
+
 // Assert that UniversalUDPMux is used while gathering when configured in the Agent
 func TestUniversalUDPMuxUsage(t *testing.T) {
 	report := test.CheckRoutines(t)
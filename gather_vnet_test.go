@@ -14,6 +14,7 @@ import (
 	"github.com/pion/transport/test"
 	"github.com/pion/transport/vnet"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestVNetGather(t *testing.T) {
@@ -121,7 +122,7 @@ func TestVNetGather(t *testing.T) {
 
 		ip := localIPs[0]
 
-		conn, err := listenUDPInPortRange(a.net, a.log, 0, 0, udp, &net.UDPAddr{IP: ip, Port: 0})
+		conn, err := listenUDPInPortRange(a.transport, a.log, 0, 0, udp, &net.UDPAddr{IP: ip, Port: 0})
 		if err != nil {
 			t.Fatalf("listenUDP error with no port restriction %v", err)
 		} else if conn == nil {
@@ -132,12 +133,12 @@ func TestVNetGather(t *testing.T) {
 			t.Fatalf("failed to close conn")
 		}
 
-		_, err = listenUDPInPortRange(a.net, a.log, 4999, 5000, udp, &net.UDPAddr{IP: ip, Port: 0})
+		_, err = listenUDPInPortRange(a.transport, a.log, 4999, 5000, udp, &net.UDPAddr{IP: ip, Port: 0})
 		if !errors.Is(err, ErrPort) {
 			t.Fatal("listenUDP with invalid port range did not return ErrPort")
 		}
 
-		conn, err = listenUDPInPortRange(a.net, a.log, 5000, 5000, udp, &net.UDPAddr{IP: ip, Port: 0})
+		conn, err = listenUDPInPortRange(a.transport, a.log, 5000, 5000, udp, &net.UDPAddr{IP: ip, Port: 0})
 		if err != nil {
 			t.Fatalf("listenUDP error with no port restriction %v", err)
 		} else if conn == nil {
@@ -459,3 +460,124 @@ func TestVNetGather_TURNConnectionLeak(t *testing.T) {
 	// Assert relay conn leak on close.
 	assert.NoError(t, aAgent.Close())
 }
+
+func TestDeterministicOrdering(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	gather := func(seed int64) ([]string, uint64) {
+		router, err := vnet.NewRouter(&vnet.RouterConfig{
+			CIDR:          "10.0.0.0/24",
+			LoggerFactory: logging.NewDefaultLoggerFactory(),
+		})
+		require.NoError(t, err)
+
+		nw := vnet.NewNet(&vnet.NetConfig{
+			StaticIPs: []string{"10.0.0.3", "10.0.0.2", "10.0.0.4"},
+		})
+		require.NoError(t, router.AddNet(nw))
+
+		a, err := NewAgent(&AgentConfig{
+			NetworkTypes:          []NetworkType{NetworkTypeUDP4},
+			CandidateTypes:        []CandidateType{CandidateTypeHost},
+			Net:                   nw,
+			DeterministicOrdering: true,
+			DeterministicSeed:     seed,
+		})
+		require.NoError(t, err)
+		defer func() {
+			assert.NoError(t, a.Close())
+		}()
+
+		gathered := make(chan struct{})
+		require.NoError(t, a.OnCandidate(func(c Candidate) {
+			if c == nil {
+				close(gathered)
+			}
+		}))
+		require.NoError(t, a.GatherCandidates())
+		<-gathered
+
+		candidates, err := a.GetLocalCandidates()
+		require.NoError(t, err)
+
+		var res []string
+		for _, c := range candidates {
+			res = append(res, c.ID()+" "+c.Address())
+		}
+		return res, a.tieBreaker
+	}
+
+	candidates, tieBreaker := gather(1)
+	require.Len(t, candidates, 3)
+	assert.Contains(t, candidates[0], "10.0.0.2")
+	assert.Contains(t, candidates[1], "10.0.0.3")
+	assert.Contains(t, candidates[2], "10.0.0.4")
+
+	again, againTieBreaker := gather(1)
+	assert.Equal(t, candidates, again)
+	assert.Equal(t, tieBreaker, againTieBreaker)
+
+	other, otherTieBreaker := gather(2)
+	assert.NotEqual(t, candidates, other)
+	assert.NotEqual(t, tieBreaker, otherTieBreaker)
+}
+
+func TestVNetNATMapping(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	urls := []*URL{
+		{Scheme: SchemeTypeSTUN, Host: vnetSTUNServerIP, Port: vnetSTUNServerPort, Proto: ProtoTypeUDP},
+		{Scheme: SchemeTypeSTUN, Host: vnetSTUNServerIP, Port: vnetSTUNServerPort + 1, Proto: ProtoTypeUDP},
+	}
+
+	gather := func(mapping vnet.EndpointDependencyType, probe bool) NATStats {
+		natType := &vnet.NATType{
+			MappingBehavior:   mapping,
+			FilteringBehavior: vnet.EndpointIndependent,
+		}
+		v, err := buildVNet(natType, natType)
+		require.NoError(t, err)
+		defer v.close()
+
+		server, err := addVNetSTUNOnPort(v.wanNet, vnetSTUNServerPort+1, logging.NewDefaultLoggerFactory())
+		require.NoError(t, err)
+		defer func() {
+			assert.NoError(t, server.Close())
+		}()
+
+		a, err := NewAgent(&AgentConfig{
+			Urls:            urls,
+			NetworkTypes:    []NetworkType{NetworkTypeUDP4},
+			CandidateTypes:  []CandidateType{CandidateTypeHost, CandidateTypeServerReflexive},
+			Net:             v.net0,
+			ProbeNATMapping: probe,
+		})
+		require.NoError(t, err)
+		defer func() {
+			assert.NoError(t, a.Close())
+		}()
+
+		require.NoError(t, a.OnCandidate(func(Candidate) {}))
+		require.NoError(t, a.GatherCandidates())
+		require.NoError(t, a.WaitForGatheringComplete(context.Background()))
+		return a.GetNATStats()
+	}
+
+	// Each server reflexive candidate is gathered from a socket of its own
+	stats := gather(vnet.EndpointIndependent, false)
+	assert.Equal(t, NATMappingUnknown, stats.Mapping)
+	assert.Equal(t, 2, stats.Observations)
+
+	stats = gather(vnet.EndpointIndependent, true)
+	assert.Equal(t, NATMappingEndpointIndependent, stats.Mapping)
+	assert.Equal(t, 4, stats.Observations)
+	for _, addr := range stats.MappedAddresses {
+		assert.Contains(t, addr, vnetGlobalIPA+":")
+	}
+
+	stats = gather(vnet.EndpointAddrPortDependent, true)
+	assert.Equal(t, NATMappingAddressPortDependent, stats.Mapping)
+	assert.Equal(t, 4, stats.Observations)
+}
@@ -0,0 +1,149 @@
+package ice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CandidateGatheringError is a failure to gather candidates of a type, on a
+// local address or from a STUN or TURN server.
+type CandidateGatheringError struct {
+	// CandidateType is the type of the candidates being gathered
+	CandidateType CandidateType
+
+	// Network is the network of the candidates, e.g. "udp4"
+	Network string
+
+	// Address is the local address the candidates were gathered on, empty
+	// for candidates of a server
+	Address string
+
+	// URL is the STUN or TURN server the candidates were gathered from, nil
+	// for host candidates
+	URL *URL
+
+	Err error
+}
+
+func (e *CandidateGatheringError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "gathering %s candidates", e.CandidateType)
+	if e.Network != "" {
+		fmt.Fprintf(&b, " (%s)", e.Network)
+	}
+	if e.Address != "" {
+		fmt.Fprintf(&b, " on %s", e.Address)
+	}
+	if e.URL != nil {
+		fmt.Fprintf(&b, " from %s", e.URL)
+	}
+	fmt.Fprintf(&b, ": %v", e.Err)
+	return b.String()
+}
+
+// Unwrap returns the underlying error.
+func (e *CandidateGatheringError) Unwrap() error {
+	return e.Err
+}
+
+// GatheringError aggregates the failures of a gathering. errors.Is and
+// errors.As match any of them. The typed errors only cover gathering, the
+// other errors of the package are sentinel errors, see errors.go.
+type GatheringError struct {
+	Errors []*CandidateGatheringError
+}
+
+func (e *GatheringError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Is reports whether any of the failures matches target.
+func (e *GatheringError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first failure that matches target.
+func (e *GatheringError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// OnGatheringComplete sets a handler that is fired once gathering is
+// complete, after the nil call of the OnCandidate handler, with the
+// failures of the gathering as a *GatheringError, or nil if there were none.
+func (a *Agent) OnGatheringComplete(f func(error)) error {
+	a.onGatheringCompleteHdlr.Store(f)
+	return nil
+}
+
+func (a *Agent) onGatheringComplete(err error) {
+	if h, ok := a.onGatheringCompleteHdlr.Load().(func(error)); ok {
+		h(err)
+	}
+}
+
+// GetGatheringError returns the failures of the current or last gathering
+// as a *GatheringError, or nil if there were none. They are cleared when
+// gathering starts again and by Restart.
+func (a *Agent) GetGatheringError() error {
+	a.muGatheringErrors.Lock()
+	defer a.muGatheringErrors.Unlock()
+
+	if len(a.gatheringErrors) == 0 {
+		return nil
+	}
+	return &GatheringError{Errors: append([]*CandidateGatheringError{}, a.gatheringErrors...)}
+}
+
+// recordGatheringError remembers a failure of the gathering, and records it
+// on the gathering span in ctx.
+func (a *Agent) recordGatheringError(ctx context.Context, err *CandidateGatheringError) {
+	spanFromContext(ctx).SetError(err.Err)
+
+	a.muGatheringErrors.Lock()
+	defer a.muGatheringErrors.Unlock()
+	a.gatheringErrors = append(a.gatheringErrors, err)
+}
+
+// recordServerError remembers that a STUN or TURN server could not be used
+// while gathering, it is also included in a FailureReport.
+func (a *Agent) recordServerError(ctx context.Context, candidateType CandidateType, url URL, network string, err error) {
+	a.recordGatheringError(ctx, &CandidateGatheringError{
+		CandidateType: candidateType,
+		Network:       network,
+		URL:           &url,
+		Err:           err,
+	})
+}
+
+// recordLocalError remembers that candidates could not be gathered on a
+// local address.
+func (a *Agent) recordLocalError(ctx context.Context, candidateType CandidateType, network, address string, err error) {
+	a.recordGatheringError(ctx, &CandidateGatheringError{
+		CandidateType: candidateType,
+		Network:       network,
+		Address:       address,
+		Err:           err,
+	})
+}
+
+func (a *Agent) clearGatheringErrors() {
+	a.muGatheringErrors.Lock()
+	defer a.muGatheringErrors.Unlock()
+	a.gatheringErrors = nil
+}
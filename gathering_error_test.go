@@ -0,0 +1,123 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pion/logging"
+	"github.com/pion/transport/test"
+	"github.com/pion/transport/vnet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatheringError(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	router, err := vnet.NewRouter(&vnet.RouterConfig{
+		CIDR:          "10.0.0.0/24",
+		LoggerFactory: logging.NewDefaultLoggerFactory(),
+	})
+	require.NoError(t, err)
+	nw := vnet.NewNet(&vnet.NetConfig{StaticIP: "10.0.0.2"})
+	require.NoError(t, router.AddNet(nw))
+
+	stunURL := &URL{Scheme: SchemeTypeSTUN, Host: "stun.invalid", Port: 3478, Proto: ProtoTypeUDP}
+	turnURL := &URL{Scheme: SchemeTypeTURN, Host: "turn.invalid", Port: 3478, Proto: ProtoTypeUDP, Username: "user"}
+
+	a, err := NewAgent(&AgentConfig{
+		NetworkTypes:   []NetworkType{NetworkTypeUDP4},
+		CandidateTypes: []CandidateType{CandidateTypeHost, CandidateTypeServerReflexive, CandidateTypeRelay},
+		Urls:           []*URL{stunURL, turnURL},
+		Net:            nw,
+		Synchronous:    true,
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	assert.NoError(t, a.GetGatheringError())
+
+	var candidates []Candidate
+	require.NoError(t, a.OnCandidate(func(c Candidate) {
+		if c != nil {
+			candidates = append(candidates, c)
+		}
+	}))
+
+	err = a.GatherCandidates()
+	require.Error(t, err)
+	assert.Len(t, candidates, 1)
+
+	var gatheringErr *GatheringError
+	require.True(t, errors.As(err, &gatheringErr))
+	require.Len(t, gatheringErr.Errors, 3)
+	assert.Equal(t, err, a.GetGatheringError())
+
+	// The failures are matched by errors.Is and errors.As with their context
+	assert.ErrorIs(t, err, ErrPasswordEmpty)
+	types := map[CandidateType]int{}
+	for _, e := range gatheringErr.Errors {
+		types[e.CandidateType]++
+		require.NotNil(t, e.URL)
+		switch e.CandidateType {
+		case CandidateTypeServerReflexive:
+			assert.Equal(t, "udp4", e.Network)
+			assert.Contains(t, e.Error(), "gathering srflx candidates (udp4) from "+e.URL.String())
+		case CandidateTypeRelay:
+			assert.Equal(t, turnURL.String(), e.URL.String())
+			assert.ErrorIs(t, e, ErrPasswordEmpty)
+		default:
+			t.Fatalf("unexpected failure: %v", e)
+		}
+	}
+	assert.Equal(t, map[CandidateType]int{CandidateTypeServerReflexive: 2, CandidateTypeRelay: 1}, types)
+
+	var candidateErr *CandidateGatheringError
+	assert.True(t, errors.As(err, &candidateErr))
+}
+
+func TestOnGatheringComplete(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	router, err := vnet.NewRouter(&vnet.RouterConfig{
+		CIDR:          "10.0.0.0/24",
+		LoggerFactory: logging.NewDefaultLoggerFactory(),
+	})
+	require.NoError(t, err)
+	nw := vnet.NewNet(&vnet.NetConfig{StaticIP: "10.0.0.2"})
+	require.NoError(t, router.AddNet(nw))
+
+	turnURL := &URL{Scheme: SchemeTypeTURN, Host: "turn.invalid", Port: 3478, Proto: ProtoTypeUDP, Username: "user"}
+	a, err := NewAgent(&AgentConfig{
+		NetworkTypes:   []NetworkType{NetworkTypeUDP4},
+		CandidateTypes: []CandidateType{CandidateTypeHost, CandidateTypeRelay},
+		Urls:           []*URL{turnURL},
+		Net:            nw,
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	// The failures are passed to the handler when gathering asynchronously
+	complete := make(chan error, 1)
+	require.NoError(t, a.OnGatheringComplete(func(err error) {
+		complete <- err
+	}))
+	require.NoError(t, a.OnCandidate(func(Candidate) {}))
+	require.NoError(t, a.GatherCandidates())
+
+	err = <-complete
+	var gatheringErr *GatheringError
+	require.True(t, errors.As(err, &gatheringErr))
+	require.Len(t, gatheringErr.Errors, 1)
+	assert.ErrorIs(t, err, ErrPasswordEmpty)
+	assert.Equal(t, err, a.GetGatheringError())
+}
@@ -0,0 +1,92 @@
+package ice
+
+import (
+	"context"
+	"strconv"
+)
+
+// extensionGeneration is the candidate extension carrying the ICE generation,
+// the number of restarts of the agent that gathered the candidate.
+const extensionGeneration = "generation"
+
+// candidateGeneration returns the generation extension of c, if it has a valid one.
+func candidateGeneration(c Candidate) (uint32, bool) {
+	ext, ok := c.GetExtension(extensionGeneration)
+	if !ok {
+		return 0, false
+	}
+	generation, err := strconv.ParseUint(ext.Value, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(generation), true
+}
+
+// GetGeneration returns the ICE generation of the agent, incremented by each
+// Restart. Local candidates carry it in their generation extension.
+func (a *Agent) GetGeneration() (generation uint32, err error) {
+	valSet := make(chan struct{})
+	err = a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		generation = agent.generation
+		close(valSet)
+	})
+
+	if err == nil {
+		<-valSet
+	}
+	return
+}
+
+// nextGeneration moves to a new local generation. Remote candidates of the
+// generations seen so far are stale from now on: the remote agent restarts too.
+// Note: the caller should hold the agent lock.
+func (a *Agent) nextGeneration() {
+	a.generation++
+	if a.remoteGenerationSeen {
+		a.minRemoteGeneration = a.maxRemoteGeneration + 1
+	}
+}
+
+// isStaleRemoteCandidate reports whether c was gathered by the remote agent
+// before its last restart, e.g. trickled late over signaling. Candidates
+// without a generation are never stale. A candidate of a newer generation
+// replaces the remote candidates of the older ones.
+// Note: the caller should hold the agent lock.
+func (a *Agent) isStaleRemoteCandidate(c Candidate) bool {
+	generation, ok := candidateGeneration(c)
+	if !ok {
+		return false
+	}
+
+	if generation < a.minRemoteGeneration || (a.remoteGenerationSeen && generation < a.maxRemoteGeneration) {
+		return true
+	}
+
+	if a.remoteGenerationSeen && generation > a.maxRemoteGeneration {
+		a.removeStaleRemoteCandidates(generation)
+	}
+	a.remoteGenerationSeen = true
+	a.maxRemoteGeneration = generation
+	return false
+}
+
+// removeStaleRemoteCandidates removes the remote candidates of generations
+// older than generation, the remote agent restarted and replaced them.
+// Note: the caller should hold the agent lock.
+func (a *Agent) removeStaleRemoteCandidates(generation uint32) {
+	var stale []Candidate
+	for _, cs := range a.remoteCandidates {
+		for _, c := range cs {
+			if g, ok := candidateGeneration(c); ok && g < generation {
+				stale = append(stale, c)
+			}
+		}
+	}
+
+	for _, c := range stale {
+		a.log.Debugf("Removing remote candidate replaced by generation %d: %s", generation, c)
+		if err := a.removeRemoteCandidate(c); err != nil {
+			a.log.Warnf("Failed to remove remote candidate %s: %v", c, err)
+		}
+	}
+}
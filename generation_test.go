@@ -0,0 +1,101 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCandidateGeneration(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 10)
+	defer lim.Stop()
+
+	a, err := NewAgent(&AgentConfig{NetworkTypes: []NetworkType{NetworkTypeUDP4}})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	remoteCandidate := func(port int, generation string) Candidate {
+		c, err := NewCandidateHost(&CandidateHostConfig{
+			Network:   "udp",
+			Address:   "192.168.0.2",
+			Port:      port,
+			Component: 1,
+		})
+		require.NoError(t, err)
+		if generation != "" {
+			require.NoError(t, c.AddExtension(CandidateExtension{extensionGeneration, generation}))
+		}
+		return c
+	}
+	addRemote := func(c Candidate) bool {
+		added := false
+		require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+			agent.addRemoteCandidate(c)
+			for _, remote := range agent.remoteCandidates[NetworkTypeUDP4] {
+				if remote == c {
+					added = true
+				}
+			}
+		}))
+		return added
+	}
+
+	generation, err := a.GetGeneration()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(0), generation)
+
+	// Local candidates are tagged with the current generation
+	gathered := make(chan Candidate, 64)
+	gatheringComplete := make(chan struct{})
+	require.NoError(t, a.OnCandidate(func(c Candidate) {
+		if c == nil {
+			close(gatheringComplete)
+			return
+		}
+		gathered <- c
+	}))
+	require.NoError(t, a.GatherCandidates())
+	ext, ok := (<-gathered).GetExtension(extensionGeneration)
+	assert.True(t, ok)
+	assert.Equal(t, "0", ext.Value)
+
+	assert.True(t, addRemote(remoteCandidate(1000, "3")))
+	assert.True(t, addRemote(remoteCandidate(1001, "")))
+	assert.True(t, addRemote(remoteCandidate(1002, "invalid")))
+	assert.False(t, addRemote(remoteCandidate(1003, "2")))
+
+	<-gatheringComplete
+	require.NoError(t, a.Restart("", ""))
+
+	generation, err = a.GetGeneration()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), generation)
+
+	// A late candidate from before the remote restart is discarded
+	assert.False(t, addRemote(remoteCandidate(1004, "3")))
+	assert.True(t, addRemote(remoteCandidate(1005, "4")))
+	assert.True(t, addRemote(remoteCandidate(1006, "")))
+
+	// A newer generation replaces the candidates of the older ones
+	replaced := remoteCandidate(1005, "4")
+	assert.True(t, addRemote(remoteCandidate(1007, "5")))
+	assert.False(t, addRemote(remoteCandidate(1008, "4")))
+	require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+		assert.Len(t, agent.remoteCandidates[NetworkTypeUDP4], 2)
+		for _, c := range agent.remoteCandidates[NetworkTypeUDP4] {
+			assert.False(t, c.Equal(replaced))
+		}
+	}))
+}
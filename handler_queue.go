@@ -0,0 +1,177 @@
+package ice
+
+import (
+	"fmt"
+	"sync"
+)
+
+// HandlerQueueStats describes the calls of the OnCandidate,
+// OnConnectionStateChange and OnSelectedCandidatePairChange handlers (and
+// the like) waiting for the previous calls to return, see
+// AgentConfig.HandlerQueueSize.
+type HandlerQueueStats struct {
+	// Pending is the number of calls waiting
+	Pending int
+
+	// Dropped is the number of calls discarded because their queue was full
+	Dropped uint64
+}
+
+// handlerQueue runs functions in the order they were pushed, on a goroutine
+// that only exists while the queue is not empty. A deferred queue only runs
+// them on flush.
+type handlerQueue struct {
+	mu       sync.Mutex
+	queue    []queuedHandler
+	running  bool
+	deferred bool
+
+	// limit is the number of functions waiting at most, zero if unlimited.
+	// Beyond it, policy decides which are dropped and onDrop is called with
+	// the number dropped so far.
+	limit   int
+	policy  BufferOverflowPolicy
+	dropped uint64
+	onDrop  func(dropped uint64)
+}
+
+type queuedHandler struct {
+	f    func()
+	kept bool
+}
+
+func (q *handlerQueue) push(f func()) {
+	q.enqueue(queuedHandler{f: f})
+}
+
+// pushKept pushes f, which is never dropped, e.g. the last call of a
+// handler. It is queued beyond the limit if no other call can be dropped.
+func (q *handlerQueue) pushKept(f func()) {
+	q.enqueue(queuedHandler{f: f, kept: true})
+}
+
+func (q *handlerQueue) enqueue(h queuedHandler) {
+	q.mu.Lock()
+
+	if q.limit > 0 && len(q.queue) >= q.limit {
+		i := -1
+		if q.policy == BufferOverflowDropOldest {
+			i = q.oldestDroppable()
+		}
+		if i >= 0 || !h.kept {
+			q.dropped++
+			dropped := q.dropped
+			if i >= 0 {
+				copy(q.queue[i:], q.queue[i+1:])
+				q.queue[len(q.queue)-1] = h
+			}
+			q.mu.Unlock()
+
+			if q.onDrop != nil {
+				q.onDrop(dropped)
+			}
+			return
+		}
+	}
+
+	q.queue = append(q.queue, h)
+	if !q.running && !q.deferred {
+		q.running = true
+		go q.drain()
+	}
+	q.mu.Unlock()
+}
+
+// oldestDroppable returns the index of the oldest function waiting that may
+// be dropped, -1 if all are kept.
+// Note: the caller should hold q.mu.
+func (q *handlerQueue) oldestDroppable() int {
+	for i, h := range q.queue {
+		if !h.kept {
+			return i
+		}
+	}
+	return -1
+}
+
+// stats returns the number of functions waiting and dropped.
+func (q *handlerQueue) stats() (pending int, dropped uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.queue), q.dropped
+}
+
+// flush runs the queued functions on the calling goroutine, unless they are
+// already being run.
+func (q *handlerQueue) flush() {
+	q.mu.Lock()
+	if q.running || len(q.queue) == 0 {
+		q.mu.Unlock()
+		return
+	}
+	q.running = true
+	q.mu.Unlock()
+
+	q.drain()
+}
+
+func (q *handlerQueue) drain() {
+	for {
+		q.mu.Lock()
+		if len(q.queue) == 0 {
+			q.queue = nil
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		h := q.queue[0]
+		q.queue[0] = queuedHandler{}
+		q.queue = q.queue[1:]
+		q.mu.Unlock()
+
+		h.f()
+	}
+}
+
+// initHandlerQueues bounds the handler queues according to
+// AgentConfig.HandlerQueueSize and HandlerQueueOverflow.
+func (config *AgentConfig) initHandlerQueues(a *Agent) error {
+	policy := BufferOverflowDropOldest
+	switch config.HandlerQueueOverflow {
+	case 0:
+	case BufferOverflowDropNewest, BufferOverflowDropOldest:
+		policy = config.HandlerQueueOverflow
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidHandlerQueueOverflow, config.HandlerQueueOverflow)
+	}
+
+	for name, q := range map[string]*handlerQueue{
+		"candidate":              &a.candidateHandlers,
+		"selected pair":          &a.pairHandlers,
+		"connection state":       &a.stateHandlers,
+		"authentication failure": &a.authFailureHandlers,
+	} {
+		name := name
+		q.limit = config.HandlerQueueSize
+		q.policy = policy
+		q.onDrop = func(dropped uint64) {
+			// Logged once, a stalled handler would flood the logs
+			if dropped == 1 {
+				a.log.Warnf("%s handler queue full, dropping calls (%s)", name, policy)
+			}
+		}
+	}
+	return nil
+}
+
+// GetHandlerQueueStats returns the calls of the handlers waiting for the
+// previous ones to return, and those dropped, see AgentConfig.HandlerQueueSize.
+func (a *Agent) GetHandlerQueueStats() HandlerQueueStats {
+	var stats HandlerQueueStats
+	for _, q := range []*handlerQueue{&a.candidateHandlers, &a.pairHandlers, &a.stateHandlers, &a.authFailureHandlers} {
+		pending, dropped := q.stats()
+		stats.Pending += pending
+		stats.Dropped += dropped
+	}
+	return stats
+}
@@ -0,0 +1,196 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlerQueue(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	var q handlerQueue
+	results := make(chan int, 10)
+	for i := 0; i < 10; i++ {
+		i := i
+		q.push(func() {
+			time.Sleep(time.Millisecond)
+			results <- i
+		})
+	}
+
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, i, <-results)
+	}
+}
+
+func TestHandlerQueueOverflow(t *testing.T) {
+	for _, policy := range []BufferOverflowPolicy{BufferOverflowDropNewest, BufferOverflowDropOldest} {
+		policy := policy
+		t.Run(policy.String(), func(t *testing.T) {
+			var drops []uint64
+			q := handlerQueue{
+				deferred: true,
+				limit:    3,
+				policy:   policy,
+				onDrop: func(dropped uint64) {
+					drops = append(drops, dropped)
+				},
+			}
+
+			var results []int
+			for i := 0; i < 5; i++ {
+				i := i
+				q.push(func() {
+					results = append(results, i)
+				})
+			}
+
+			pending, dropped := q.stats()
+			assert.Equal(t, 3, pending)
+			assert.Equal(t, uint64(2), dropped)
+			assert.Equal(t, []uint64{1, 2}, drops)
+
+			q.flush()
+			if policy == BufferOverflowDropNewest {
+				assert.Equal(t, []int{0, 1, 2}, results)
+			} else {
+				assert.Equal(t, []int{2, 3, 4}, results)
+			}
+		})
+	}
+}
+
+func TestHandlerQueueKept(t *testing.T) {
+	for _, policy := range []BufferOverflowPolicy{BufferOverflowDropNewest, BufferOverflowDropOldest} {
+		policy := policy
+		t.Run(policy.String(), func(t *testing.T) {
+			q := handlerQueue{
+				deferred: true,
+				limit:    2,
+				policy:   policy,
+			}
+
+			var results []int
+			push := func(i int, kept bool) {
+				f := func() {
+					results = append(results, i)
+				}
+				if kept {
+					q.pushKept(f)
+				} else {
+					q.push(f)
+				}
+			}
+			push(0, true)
+			push(1, false)
+			push(2, true)
+			push(3, true)
+			push(4, false)
+
+			q.flush()
+			if policy == BufferOverflowDropNewest {
+				assert.Equal(t, []int{0, 1, 2, 3}, results)
+			} else {
+				assert.Equal(t, []int{0, 2, 3}, results)
+			}
+		})
+	}
+}
+
+func TestHandlerQueueSize(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	_, err := NewAgent(&AgentConfig{HandlerQueueOverflow: BufferOverflowBlock})
+	assert.ErrorIs(t, err, ErrInvalidHandlerQueueOverflow)
+
+	a, err := NewAgent(&AgentConfig{
+		NetworkTypes:     []NetworkType{NetworkTypeUDP4},
+		HandlerQueueSize: 1,
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	// The first call blocks the handler, one waits and the others are dropped
+	release := make(chan struct{})
+	require.NoError(t, a.OnCandidate(func(Candidate) {
+		<-release
+	}))
+	for i := 0; i < 4; i++ {
+		c, err := NewCandidateHost(&CandidateHostConfig{
+			Network:   "udp",
+			Address:   "192.0.2.1",
+			Port:      1000 + i,
+			Component: 1,
+		})
+		require.NoError(t, err)
+		require.NoError(t, a.addCandidate(a.context(), c, &mockPacketConn{}))
+		if i == 0 {
+			require.Eventually(t, func() bool {
+				return a.GetHandlerQueueStats().Pending == 0
+			}, time.Second, time.Millisecond)
+		}
+	}
+
+	stats := a.GetHandlerQueueStats()
+	assert.Equal(t, 1, stats.Pending)
+	assert.Equal(t, uint64(2), stats.Dropped)
+
+	close(release)
+	require.Eventually(t, func() bool {
+		return a.GetHandlerQueueStats().Pending == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestHandlerQueueConnectionState(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	a, err := NewAgent(&AgentConfig{HandlerQueueSize: 1})
+	require.NoError(t, err)
+
+	// The first call blocks the handler, the calls after it queue up in
+	// order and only the terminal states are kept
+	release := make(chan struct{})
+	states := make(chan ConnectionState, 10)
+	require.NoError(t, a.OnConnectionStateChange(func(s ConnectionState) {
+		if s == ConnectionStateChecking {
+			<-release
+		}
+		states <- s
+	}))
+
+	setState := func(s ConnectionState) {
+		require.NoError(t, a.run(a.context(), func(ctx context.Context, agent *Agent) {
+			agent.updateConnectionState(s, ConnectionStateChangeReasonUnknown)
+		}))
+	}
+	setState(ConnectionStateChecking)
+	require.Eventually(t, func() bool {
+		return a.GetHandlerQueueStats().Pending == 0
+	}, time.Second, time.Millisecond)
+	setState(ConnectionStateConnected)
+	setState(ConnectionStateDisconnected)
+	setState(ConnectionStateFailed)
+
+	stats := a.GetHandlerQueueStats()
+	assert.Equal(t, 1, stats.Pending)
+	assert.Equal(t, uint64(2), stats.Dropped)
+
+	close(release)
+	assert.NoError(t, a.Close())
+	assert.Equal(t, []ConnectionState{
+		ConnectionStateChecking, ConnectionStateFailed, ConnectionStateClosed,
+	}, []ConnectionState{<-states, <-states, <-states})
+}
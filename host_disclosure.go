@@ -0,0 +1,216 @@
+package ice
+
+import (
+	"context"
+	"net"
+
+	"github.com/pion/logging"
+)
+
+// HostDisclosure is the policy of disclosure of the host candidates, for
+// applications that do not want to reveal the local addresses of the host to
+// peers unless it is needed to connect. While host candidates are withheld,
+// the related addresses of the server reflexive and relay candidates are
+// redacted too.
+type HostDisclosure byte
+
+// HostDisclosure enum
+const (
+	// HostDisclosureImmediate passes every candidate to OnCandidate as soon
+	// as it is gathered
+	HostDisclosureImmediate HostDisclosure = iota + 1
+
+	// HostDisclosureAfterReflexive withholds the host candidates, trickling
+	// the server reflexive and relay candidates first. The host candidates
+	// are disclosed if no pair of those succeeds within
+	// HostDisclosureTimeout.
+	HostDisclosureAfterReflexive
+
+	// HostDisclosureAfterRelay withholds the host and server reflexive
+	// candidates, trickling the relay candidates first. They are disclosed
+	// if no pair of a relay candidate succeeds within HostDisclosureTimeout.
+	HostDisclosureAfterRelay
+)
+
+// withholds reports whether candidates of type t are withheld at first.
+func (h HostDisclosure) withholds(t CandidateType) bool {
+	switch h {
+	case HostDisclosureAfterReflexive:
+		return t == CandidateTypeHost
+	case HostDisclosureAfterRelay:
+		return t == CandidateTypeHost || t == CandidateTypeServerReflexive
+	default:
+		return false
+	}
+}
+
+// relatedAddress returns the related address of a server reflexive candidate
+// whose base is relAddr:relPort, or of a relay candidate allocated over a
+// connection from relAddr:relPort. Both are addresses of the host, which are
+// redacted to the unspecified address when host candidates are withheld.
+func (h HostDisclosure) relatedAddress(relAddr string, relPort int) (string, int) {
+	if !h.withholds(CandidateTypeHost) {
+		return relAddr, relPort
+	}
+	if ip := net.ParseIP(relAddr); ip != nil && ip.To4() == nil {
+		return net.IPv6unspecified.String(), 0
+	}
+	return net.IPv4zero.String(), 0
+}
+
+type hostDisclosureState int
+
+const (
+	hostDisclosurePending hostDisclosureState = iota
+	hostDisclosureDisclosed
+	hostDisclosureSuppressed
+)
+
+// withheldCandidate is a gathered candidate not started yet, as it is
+// withheld by the HostDisclosure policy.
+type withheldCandidate struct {
+	candidate Candidate
+	conn      net.PacketConn
+}
+
+// withholdCandidate withholds c until the disclosure of its type is
+// decided, it returns false if c can be added now. Once decided against,
+// candidates of the withheld types are closed as they are gathered.
+// Note: the caller should hold the agent lock.
+func (a *Agent) withholdCandidate(c Candidate, conn net.PacketConn) bool {
+	if !a.hostDisclosure.withholds(c.Type()) {
+		return false
+	}
+
+	switch a.hostDisclosureState {
+	case hostDisclosureDisclosed:
+		return false
+	case hostDisclosureSuppressed:
+		a.log.Debugf("Discarding %s, its disclosure was not needed", c)
+		closeWithheldCandidate(withheldCandidate{c, conn}, a.log)
+	case hostDisclosurePending:
+		a.log.Debugf("Withholding %s until the disclosure of %s candidates is decided", c, c.Type())
+		a.withheldCandidates = append(a.withheldCandidates, withheldCandidate{c, conn})
+		if a.selector != nil {
+			a.startHostDisclosureTimer()
+		}
+	}
+	return true
+}
+
+// startHostDisclosureTimer starts the window after which the withheld
+// candidates are disclosed if no pair of the others succeeded. It starts
+// when the connectivity checks start, or when gathering completes if they
+// did not start yet.
+// Note: the caller should hold the agent lock.
+func (a *Agent) startHostDisclosureTimer() {
+	if a.hostDisclosureTimer != nil || a.hostDisclosureState != hostDisclosurePending || len(a.withheldCandidates) == 0 {
+		return
+	}
+
+	var timer Timer
+	timer = a.clock.AfterFunc(a.hostDisclosureTimeout, func() {
+		_ = a.run(a.context(), func(ctx context.Context, agent *Agent) {
+			if agent.hostDisclosureTimer == timer {
+				agent.decideHostDisclosure()
+			}
+		})
+	})
+	a.hostDisclosureTimer = timer
+}
+
+// decideHostDisclosure discloses the withheld candidates, unless a pair of
+// the candidates trickled first succeeded, in which case they are closed.
+// Gathering completes if it was waiting for the decision.
+// Note: the caller should hold the agent lock.
+func (a *Agent) decideHostDisclosure() {
+	if a.hostDisclosureTimer != nil {
+		a.hostDisclosureTimer.Stop()
+		a.hostDisclosureTimer = nil
+	}
+	if a.hostDisclosureState != hostDisclosurePending {
+		return
+	}
+
+	withheld := a.withheldCandidates
+	a.withheldCandidates = nil
+	if a.disclosedPairSucceeded() {
+		a.hostDisclosureState = hostDisclosureSuppressed
+		a.log.Infof("Not disclosing %d withheld candidates, a pair of the others succeeded", len(withheld))
+		a.logEvent(logging.LogLevelInfo, "withheld candidates discarded", "count", len(withheld))
+		for _, w := range withheld {
+			closeWithheldCandidate(w, a.log)
+		}
+	} else {
+		a.hostDisclosureState = hostDisclosureDisclosed
+		a.log.Infof("Disclosing %d withheld candidates", len(withheld))
+		a.logEvent(logging.LogLevelInfo, "withheld candidates disclosed", "count", len(withheld))
+		for _, w := range withheld {
+			a.insertLocalCandidate(w.candidate, w.conn)
+		}
+	}
+
+	if a.gatheringCompleteDeferred {
+		a.gatheringCompleteDeferred = false
+		a.updateGatheringState(GatheringStateComplete)
+	}
+}
+
+// deferGatheringComplete reports whether the completion of gathering waits
+// for the disclosure of the withheld candidates to be decided. It is decided
+// at once if none of the other candidates was gathered.
+// Note: the caller should hold the agent lock.
+func (a *Agent) deferGatheringComplete() bool {
+	if a.hostDisclosureState != hostDisclosurePending || len(a.withheldCandidates) == 0 {
+		return false
+	}
+
+	for _, candidates := range a.localCandidates {
+		for _, c := range candidates {
+			if !a.hostDisclosure.withholds(c.Type()) {
+				a.gatheringCompleteDeferred = true
+				a.startHostDisclosureTimer()
+				return true
+			}
+		}
+	}
+
+	a.decideHostDisclosure()
+	return false
+}
+
+// disclosedPairSucceeded reports whether a pair of a local candidate not
+// withheld succeeded.
+// Note: the caller should hold the agent lock.
+func (a *Agent) disclosedPairSucceeded() bool {
+	for _, p := range a.checklist {
+		if p.state == CandidatePairStateSucceeded && !a.hostDisclosure.withholds(p.Local.Type()) {
+			return true
+		}
+	}
+	return false
+}
+
+// resetHostDisclosure closes the withheld candidates, the disclosure is
+// decided again for the next gathering.
+// Note: the caller should hold the agent lock.
+func (a *Agent) resetHostDisclosure() {
+	if a.hostDisclosureTimer != nil {
+		a.hostDisclosureTimer.Stop()
+		a.hostDisclosureTimer = nil
+	}
+	for _, w := range a.withheldCandidates {
+		closeWithheldCandidate(w, a.log)
+	}
+	a.withheldCandidates = nil
+	a.hostDisclosureState = hostDisclosurePending
+	a.gatheringCompleteDeferred = false
+}
+
+func closeWithheldCandidate(w withheldCandidate, log logging.LeveledLogger) {
+	if err := w.candidate.close(); err != nil {
+		log.Warnf("Failed to close withheld candidate: %v", err)
+	}
+	// The candidate was not started, its conn is not closed with it
+	_ = w.conn.Close()
+}
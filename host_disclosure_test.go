@@ -0,0 +1,216 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/pion/turn/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostDisclosure(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 10)
+	defer lim.Stop()
+
+	// Gathers a host and a srflx candidate, the host one is withheld
+	gather := func(t *testing.T) (*Agent, *ManualClock, chan Candidate, Candidate) {
+		clock := NewManualClock(time.Now())
+		timeout := time.Second
+		a, err := NewAgent(&AgentConfig{
+			NetworkTypes:          []NetworkType{NetworkTypeUDP4},
+			HostDisclosure:        HostDisclosureAfterReflexive,
+			HostDisclosureTimeout: &timeout,
+			Clock:                 clock,
+		})
+		require.NoError(t, err)
+
+		gathered := make(chan Candidate, 8)
+		require.NoError(t, a.OnCandidate(func(c Candidate) {
+			gathered <- c
+		}))
+
+		hostConn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IP{127, 0, 0, 1}})
+		require.NoError(t, err)
+		host, err := NewCandidateHost(&CandidateHostConfig{
+			Network:   "udp",
+			Address:   "127.0.0.1",
+			Port:      hostConn.LocalAddr().(*net.UDPAddr).Port,
+			Component: 1,
+		})
+		require.NoError(t, err)
+
+		srflxConn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IP{127, 0, 0, 1}})
+		require.NoError(t, err)
+		srflx, err := NewCandidateServerReflexive(&CandidateServerReflexiveConfig{
+			Network:   "udp",
+			Address:   "1.2.3.4",
+			Port:      srflxConn.LocalAddr().(*net.UDPAddr).Port,
+			Component: 1,
+			RelAddr:   "127.0.0.1",
+			RelPort:   srflxConn.LocalAddr().(*net.UDPAddr).Port,
+		})
+		require.NoError(t, err)
+
+		ctx := context.Background()
+		require.NoError(t, a.setGatheringState(GatheringStateGathering))
+		require.NoError(t, a.addCandidate(ctx, host, hostConn))
+		require.NoError(t, a.addCandidate(ctx, srflx, srflxConn))
+		require.NoError(t, a.setGatheringState(GatheringStateComplete))
+
+		assert.Equal(t, Candidate(srflx), <-gathered)
+		local, err := a.GetLocalCandidates()
+		require.NoError(t, err)
+		assert.Equal(t, []Candidate{srflx}, local)
+		require.NoError(t, a.run(ctx, func(ctx context.Context, agent *Agent) {
+			assert.Equal(t, GatheringStateGathering, agent.gatheringState)
+		}))
+
+		return a, clock, gathered, host
+	}
+
+	t.Run("Disclosed", func(t *testing.T) {
+		a, clock, gathered, host := gather(t)
+
+		clock.Advance(time.Second)
+		assert.Equal(t, host, <-gathered)
+		assert.Nil(t, <-gathered)
+		local, err := a.GetLocalCandidates()
+		require.NoError(t, err)
+		assert.Len(t, local, 2)
+
+		assert.NoError(t, a.Close())
+	})
+
+	t.Run("Not needed", func(t *testing.T) {
+		a, clock, gathered, _ := gather(t)
+
+		remote, err := NewCandidateHost(&CandidateHostConfig{
+			Network:   "udp",
+			Address:   "1.2.3.5",
+			Port:      5000,
+			Component: 1,
+		})
+		require.NoError(t, err)
+		require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+			agent.addRemoteCandidate(remote)
+			require.Len(t, agent.checklist, 1)
+			agent.checklist[0].state = CandidatePairStateSucceeded
+		}))
+
+		clock.Advance(time.Second)
+		assert.Nil(t, <-gathered)
+		local, err := a.GetLocalCandidates()
+		require.NoError(t, err)
+		assert.Len(t, local, 1)
+
+		assert.NoError(t, a.Close())
+	})
+}
+
+func TestHostDisclosureRelayRelatedAddress(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	server, err := turn.NewServer(turn.ServerConfig{
+		Realm:       "pion.ly",
+		AuthHandler: optimisticAuthHandler,
+		ListenerConfigs: []turn.ListenerConfig{
+			{
+				Listener:              listener,
+				RelayAddressGenerator: &turn.RelayAddressGeneratorNone{Address: "127.0.0.1"},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	// The connection to the TURN server over TCP is bound to a host address
+	relatedAddress := func(disclosure HostDisclosure) *CandidateRelatedAddress {
+		a, err := NewAgent(&AgentConfig{
+			NetworkTypes:   []NetworkType{NetworkTypeUDP4},
+			CandidateTypes: []CandidateType{CandidateTypeRelay},
+			HostDisclosure: disclosure,
+			Urls: []*URL{
+				{
+					Scheme:   SchemeTypeTURN,
+					Host:     "127.0.0.1",
+					Port:     listener.Addr().(*net.TCPAddr).Port, //nolint:forcetypeassert
+					Username: "username",
+					Password: "password",
+					Proto:    ProtoTypeTCP,
+				},
+			},
+		})
+		require.NoError(t, err)
+		defer func() {
+			assert.NoError(t, a.Close())
+		}()
+
+		gathered := make(chan Candidate, 8)
+		require.NoError(t, a.OnCandidate(func(c Candidate) {
+			gathered <- c
+		}))
+		require.NoError(t, a.GatherCandidates())
+		c := <-gathered
+		require.NotNil(t, c)
+		return c.RelatedAddress()
+	}
+
+	assert.Equal(t, "127.0.0.1", relatedAddress(HostDisclosureImmediate).Address)
+	for _, disclosure := range []HostDisclosure{HostDisclosureAfterReflexive, HostDisclosureAfterRelay} {
+		assert.Equal(t, &CandidateRelatedAddress{Address: "0.0.0.0", Port: 0}, relatedAddress(disclosure))
+	}
+
+	assert.NoError(t, server.Close())
+}
+
+func TestHostDisclosureServerReflexiveRelatedAddress(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 10)
+	defer lim.Stop()
+
+	// The base of a server reflexive candidate is a host address
+	relatedAddress := func(disclosure HostDisclosure) *CandidateRelatedAddress {
+		a, err := NewAgent(&AgentConfig{
+			NetworkTypes:           []NetworkType{NetworkTypeUDP4},
+			CandidateTypes:         []CandidateType{CandidateTypeServerReflexive},
+			NAT1To1IPs:             []string{"1.2.3.4"},
+			NAT1To1IPCandidateType: CandidateTypeServerReflexive,
+			HostDisclosure:         disclosure,
+		})
+		require.NoError(t, err)
+		defer func() {
+			assert.NoError(t, a.Close())
+		}()
+
+		gathered := make(chan Candidate, 8)
+		require.NoError(t, a.OnCandidate(func(c Candidate) {
+			gathered <- c
+		}))
+		require.NoError(t, a.GatherCandidates())
+		c := <-gathered
+		require.NotNil(t, c)
+		assert.Equal(t, CandidateTypeServerReflexive, c.Type())
+		return c.RelatedAddress()
+	}
+
+	// The 1:1 NAT socket is bound to the unspecified address, its port is kept
+	assert.NotZero(t, relatedAddress(HostDisclosureImmediate).Port)
+	assert.Equal(t, &CandidateRelatedAddress{Address: "0.0.0.0", Port: 0}, relatedAddress(HostDisclosureAfterReflexive))
+}
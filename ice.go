@@ -48,6 +48,80 @@ func (c ConnectionState) String() string {
 	}
 }
 
+// ConnectionStateChangeReason describes why the ConnectionState changed
+type ConnectionStateChangeReason int
+
+const (
+	// ConnectionStateChangeReasonUnknown the reason was not recorded
+	ConnectionStateChangeReasonUnknown ConnectionStateChangeReason = iota
+
+	// ConnectionStateChangeReasonChecksStarted connectivity checks were started by Dial or Accept
+	ConnectionStateChangeReasonChecksStarted
+
+	// ConnectionStateChangeReasonPairSelected a candidate pair was selected
+	ConnectionStateChangeReasonPairSelected
+
+	// ConnectionStateChangeReasonTrafficResumed traffic was received again on the selected pair
+	ConnectionStateChangeReasonTrafficResumed
+
+	// ConnectionStateChangeReasonKeepaliveTimeout nothing was received on the selected pair for
+	// DisconnectedTimeout (or DisconnectedTimeout+FailedTimeout), the remote is gone or the path broke
+	ConnectionStateChangeReasonKeepaliveTimeout
+
+	// ConnectionStateChangeReasonChecksTimeout no candidate pair succeeded before the checks timed out
+	ConnectionStateChangeReasonChecksTimeout
+
+	// ConnectionStateChangeReasonRestart the agent was restarted with new credentials
+	ConnectionStateChangeReasonRestart
+
+	// ConnectionStateChangeReasonClosed the agent was closed locally
+	ConnectionStateChangeReasonClosed
+
+	// ConnectionStateChangeReasonPairRemoved a candidate of the selected pair was removed
+	ConnectionStateChangeReasonPairRemoved
+
+	// ConnectionStateChangeReasonRemoteRestart the remote agent restarted, new remote credentials were set
+	ConnectionStateChangeReasonRemoteRestart
+
+	// ConnectionStateChangeReasonConsentExpired the remote kept sending but stopped answering the
+	// consent checks of the selected pair for DisconnectedTimeout+FailedTimeout, it revoked its consent
+	// (RFC 7675)
+	ConnectionStateChangeReasonConsentExpired
+
+	// ConnectionStateChangeReasonRemoteClosed an ICMP port unreachable was received for the selected
+	// pair, the remote closed its socket, see AgentConfig.ICMPErrorDetection
+	ConnectionStateChangeReasonRemoteClosed
+)
+
+func (r ConnectionStateChangeReason) String() string {
+	switch r {
+	case ConnectionStateChangeReasonChecksStarted:
+		return "checks started"
+	case ConnectionStateChangeReasonPairSelected:
+		return "pair selected"
+	case ConnectionStateChangeReasonTrafficResumed:
+		return "traffic resumed"
+	case ConnectionStateChangeReasonKeepaliveTimeout:
+		return "keepalive timeout"
+	case ConnectionStateChangeReasonChecksTimeout:
+		return "checks timeout"
+	case ConnectionStateChangeReasonRestart:
+		return "restart"
+	case ConnectionStateChangeReasonClosed:
+		return "closed"
+	case ConnectionStateChangeReasonPairRemoved:
+		return "pair removed"
+	case ConnectionStateChangeReasonRemoteRestart:
+		return "remote restart"
+	case ConnectionStateChangeReasonConsentExpired:
+		return "consent expired"
+	case ConnectionStateChangeReasonRemoteClosed:
+		return "remote closed"
+	default:
+		return "unknown"
+	}
+}
+
 // GatheringState describes the state of the candidate gathering process
 type GatheringState int
 
@@ -0,0 +1,130 @@
+package ice
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ICEOption is a token of the ice-options SDP attribute, advertising an
+// extension of ICE an agent supports.
+// https://tools.ietf.org/html/rfc8839#section-5.6
+type ICEOption string
+
+const (
+	// ICEOptionTrickle advertises support of trickle ICE (RFC 8838)
+	ICEOptionTrickle ICEOption = "trickle"
+
+	// ICEOptionRenomination advertises support of the nomination of another
+	// pair once a pair is selected (draft-thatcher-ice-renomination)
+	ICEOptionRenomination ICEOption = "renomination"
+
+	// ICEOptionICE2 advertises compliance with RFC 8445, which removed
+	// aggressive nomination
+	ICEOptionICE2 ICEOption = "ice2"
+)
+
+// UnmarshalICEOptions parses the tokens of an ice-options attribute, given
+// as "a=ice-options:trickle renomination", "ice-options:trickle" or just
+// its value.
+func UnmarshalICEOptions(raw string) []ICEOption {
+	raw = strings.TrimPrefix(strings.TrimSpace(raw), "a=")
+	raw = strings.TrimPrefix(raw, "ice-options:")
+
+	fields := strings.Fields(raw)
+	options := make([]ICEOption, 0, len(fields))
+	for _, f := range fields {
+		options = append(options, ICEOption(f))
+	}
+	return options
+}
+
+// MarshalICEOptions returns the value of the ice-options attribute
+// advertising options.
+func MarshalICEOptions(options []ICEOption) string {
+	tokens := make([]string, 0, len(options))
+	for _, o := range options {
+		tokens = append(tokens, string(o))
+	}
+	return strings.Join(tokens, " ")
+}
+
+func containsICEOption(options []ICEOption, option ICEOption) bool {
+	for _, o := range options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+func (config *AgentConfig) initICEOptions(a *Agent) error {
+	if config.ICEOptions == nil {
+		a.localICEOptions = []ICEOption{ICEOptionTrickle}
+		return nil
+	}
+	for _, o := range config.ICEOptions {
+		if o == "" || strings.ContainsAny(string(o), " \t\r\n") {
+			return fmt.Errorf("%w: %q", ErrInvalidICEOption, o)
+		}
+	}
+	a.localICEOptions = append([]ICEOption{}, config.ICEOptions...)
+	return nil
+}
+
+// GetLocalICEOptions returns the ICE options the agent advertises, see
+// AgentConfig.ICEOptions.
+func (a *Agent) GetLocalICEOptions() []ICEOption {
+	return append([]ICEOption{}, a.localICEOptions...)
+}
+
+// SetRemoteICEOptions sets the ICE options advertised by the remote agent.
+// The extensions depending on the peer are only used once it advertises
+// them: see AgentConfig.ICEOptions. They are forgotten by Restart.
+func (a *Agent) SetRemoteICEOptions(options []ICEOption) error {
+	options = append([]ICEOption{}, options...)
+	return a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		agent.remoteICEOptions = options
+	})
+}
+
+// GetRemoteICEOptions returns the ICE options advertised by the remote
+// agent, nil if they were not set.
+func (a *Agent) GetRemoteICEOptions() ([]ICEOption, error) {
+	var options []ICEOption
+	err := a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		if agent.remoteICEOptions != nil {
+			options = append([]ICEOption{}, agent.remoteICEOptions...)
+		}
+	})
+	return options, err
+}
+
+// iceOptionNegotiated reports whether both agents advertise option.
+//
+// Note: the caller should hold the agent lock.
+func (a *Agent) iceOptionNegotiated(option ICEOption) bool {
+	return containsICEOption(a.localICEOptions, option) && containsICEOption(a.remoteICEOptions, option)
+}
+
+// acceptsNomination reports whether the controlled agent switches from the
+// selected pair to p, nominated by the controlling agent. When the remote
+// ICE options are known, another pair is only accepted if renomination is
+// negotiated, or with AcceptAggressiveNomination if the remote agent does
+// not advertise ice2. Before that, a pair of higher priority is accepted.
+//
+// Note: the caller should hold the agent lock.
+func (a *Agent) acceptsNomination(p, selectedPair *CandidatePair) bool {
+	switch {
+	case selectedPair == nil:
+		return true
+	case selectedPair == p:
+		return false
+	case a.iceOptionNegotiated(ICEOptionRenomination):
+		return true
+	case a.remoteICEOptions != nil &&
+		(!a.acceptAggressiveNomination || containsICEOption(a.remoteICEOptions, ICEOptionICE2)):
+		return false
+	}
+	return selectedPair.priority() < p.priority()
+}
@@ -0,0 +1,93 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestICEOptions(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	for _, raw := range []string{"a=ice-options:trickle renomination", "ice-options:trickle renomination", " trickle  renomination "} {
+		assert.Equal(t, []ICEOption{ICEOptionTrickle, ICEOptionRenomination}, UnmarshalICEOptions(raw), raw)
+	}
+	assert.Equal(t, "trickle ice2", MarshalICEOptions([]ICEOption{ICEOptionTrickle, ICEOptionICE2}))
+
+	_, err := NewAgent(&AgentConfig{ICEOptions: []ICEOption{"trickle renomination"}})
+	assert.ErrorIs(t, err, ErrInvalidICEOption)
+
+	a, err := NewAgent(&AgentConfig{})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+	assert.Equal(t, []ICEOption{ICEOptionTrickle}, a.GetLocalICEOptions())
+
+	remote, err := a.GetRemoteICEOptions()
+	require.NoError(t, err)
+	assert.Nil(t, remote)
+
+	require.NoError(t, a.SetRemoteICEOptions([]ICEOption{ICEOptionICE2}))
+	remote, err = a.GetRemoteICEOptions()
+	require.NoError(t, err)
+	assert.Equal(t, []ICEOption{ICEOptionICE2}, remote)
+
+	require.NoError(t, a.Restart("", ""))
+	remote, err = a.GetRemoteICEOptions()
+	require.NoError(t, err)
+	assert.Nil(t, remote)
+}
+
+func TestAcceptsNomination(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	newPair := func(address string, typ CandidateType) *CandidatePair {
+		local, err := NewCandidateHost(&CandidateHostConfig{Network: "udp", Address: address, Port: 1000, Component: 1})
+		require.NoError(t, err)
+		remote, err := NewCandidateHost(&CandidateHostConfig{Network: "udp", Address: "10.0.0.1", Port: 1000, Component: 1})
+		require.NoError(t, err)
+		if typ == CandidateTypeRelay {
+			relay, relayErr := NewCandidateRelay(&CandidateRelayConfig{Network: "udp", Address: address, Port: 1000, Component: 1})
+			require.NoError(t, relayErr)
+			return newCandidatePair(relay, remote, false)
+		}
+		return newCandidatePair(local, remote, false)
+	}
+	host, relay := newPair("192.168.0.1", CandidateTypeHost), newPair("1.2.3.4", CandidateTypeRelay)
+	require.Greater(t, host.priority(), relay.priority())
+
+	for _, test := range []struct {
+		name              string
+		local, remote     []ICEOption
+		aggressive        bool
+		toHigher, toLower bool
+	}{
+		{"remote options unknown", []ICEOption{ICEOptionTrickle}, nil, false, true, false},
+		{"renomination negotiated", []ICEOption{ICEOptionRenomination}, []ICEOption{ICEOptionRenomination}, false, true, true},
+		{"renomination not advertised locally", []ICEOption{ICEOptionTrickle}, []ICEOption{ICEOptionRenomination}, false, false, false},
+		{"aggressive nomination", []ICEOption{ICEOptionTrickle}, []ICEOption{ICEOptionTrickle}, true, true, false},
+		{"aggressive nomination with ice2", []ICEOption{ICEOptionTrickle}, []ICEOption{ICEOptionICE2}, true, false, false},
+	} {
+		a, err := NewAgent(&AgentConfig{ICEOptions: test.local, AcceptAggressiveNomination: test.aggressive})
+		require.NoError(t, err)
+		if test.remote != nil {
+			require.NoError(t, a.SetRemoteICEOptions(test.remote))
+		}
+		require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+			assert.True(t, agent.acceptsNomination(host, nil), test.name)
+			assert.False(t, agent.acceptsNomination(host, host), test.name)
+			assert.Equal(t, test.toHigher, agent.acceptsNomination(host, relay), test.name)
+			assert.Equal(t, test.toLower, agent.acceptsNomination(relay, host), test.name)
+		}))
+		require.NoError(t, a.Close())
+	}
+}
@@ -14,9 +14,9 @@ const tiebreakerSize = 8 // 64 bit
 
 // AddToAs adds tiebreaker value to m as t attribute.
 func (a tiebreaker) AddToAs(m *stun.Message, t stun.AttrType) error {
-	v := make([]byte, tiebreakerSize)
-	binary.BigEndian.PutUint64(v, uint64(a))
-	m.Add(t, v)
+	var v [tiebreakerSize]byte
+	binary.BigEndian.PutUint64(v[:], uint64(a))
+	m.Add(t, v[:])
 	return nil
 }
 
@@ -0,0 +1,57 @@
+// Package iceotel creates OpenTelemetry spans for the gathering,
+// connectivity checks and nomination of an ice.Agent.
+package iceotel
+
+import (
+	"context"
+
+	"github.com/pion/ice/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/pion/ice/v2"
+
+// NewTracer returns an ice.Tracer creating the spans with the tracer of
+// provider, to be set as AgentConfig.Tracer.
+func NewTracer(provider trace.TracerProvider) ice.Tracer {
+	if provider == nil {
+		provider = trace.NewNoopTracerProvider()
+	}
+	return &tracer{tracer: provider.Tracer(tracerName)}
+}
+
+type tracer struct {
+	tracer trace.Tracer
+}
+
+func (t *tracer) Start(ctx context.Context, name string, attributes ...ice.SpanAttribute) (context.Context, ice.Span) {
+	ctx, s := t.tracer.Start(ctx, name, trace.WithAttributes(keyValues(attributes)...))
+	return ctx, &span{span: s}
+}
+
+type span struct {
+	span trace.Span
+}
+
+func (s *span) SetAttributes(attributes ...ice.SpanAttribute) {
+	s.span.SetAttributes(keyValues(attributes)...)
+}
+
+func (s *span) SetError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s *span) End() {
+	s.span.End()
+}
+
+func keyValues(attributes []ice.SpanAttribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attributes))
+	for _, a := range attributes {
+		kvs = append(kvs, attribute.String(a.Key, a.Value))
+	}
+	return kvs
+}
@@ -0,0 +1,89 @@
+package iceotel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pion/ice/v2"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordingSpan keeps what is set on it
+type recordingSpan struct {
+	trace.Span
+
+	name       string
+	attributes []attribute.KeyValue
+	status     codes.Code
+	errs       []error
+	ended      bool
+}
+
+type recordingTracerProvider struct {
+	trace.TracerProvider
+	spans []*recordingSpan
+}
+
+type recordingTracer struct {
+	trace.Tracer
+	provider *recordingTracerProvider
+}
+
+func (p *recordingTracerProvider) Tracer(name string, opts ...trace.TracerOption) trace.Tracer {
+	return &recordingTracer{Tracer: p.TracerProvider.Tracer(name, opts...), provider: p}
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	_, noop := t.Tracer.Start(ctx, name, opts...)
+	config := trace.NewSpanStartConfig(opts...)
+	s := &recordingSpan{Span: noop, name: name, attributes: config.Attributes()}
+	t.provider.spans = append(t.provider.spans, s)
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+func (s *recordingSpan) SetAttributes(kv ...attribute.KeyValue) {
+	s.attributes = append(s.attributes, kv...)
+}
+
+func (s *recordingSpan) SetStatus(code codes.Code, _ string) {
+	s.status = code
+}
+
+func (s *recordingSpan) RecordError(err error, _ ...trace.EventOption) {
+	s.errs = append(s.errs, err)
+}
+
+func (s *recordingSpan) End(...trace.SpanEndOption) {
+	s.ended = true
+}
+
+func TestTracer(t *testing.T) {
+	provider := &recordingTracerProvider{TracerProvider: trace.NewNoopTracerProvider()}
+	tracer := NewTracer(provider)
+
+	ctx, span := tracer.Start(context.Background(), "ice.checks", ice.SpanAttribute{Key: "ice.role", Value: "controlling"})
+	assert.NotNil(t, trace.SpanFromContext(ctx))
+	span.SetAttributes(ice.SpanAttribute{Key: "ice.local_candidate", Value: "host"})
+	err := errors.New("failed") //nolint:goerr113
+	span.SetError(err)
+	span.End()
+
+	assert.Len(t, provider.spans, 1)
+	s := provider.spans[0]
+	assert.Equal(t, "ice.checks", s.name)
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.String("ice.role", "controlling"),
+		attribute.String("ice.local_candidate", "host"),
+	}, s.attributes)
+	assert.Equal(t, codes.Error, s.status)
+	assert.Equal(t, []error{err}, s.errs)
+	assert.True(t, s.ended)
+
+	// Without a provider, the spans do nothing
+	_, span = NewTracer(nil).Start(context.Background(), "ice.gather")
+	span.End()
+}
@@ -0,0 +1,59 @@
+package icetest
+
+import (
+	"context"
+
+	"github.com/pion/ice/v2"
+)
+
+// Connect connects a controlling and a controlled agent: it exchanges their
+// credentials and trickles the candidates they gather to each other, then
+// dials and accepts until both are connected or ctx is done.
+func Connect(ctx context.Context, controlling, controlled *ice.Agent) (*ice.Conn, *ice.Conn, error) {
+	controllingUfrag, controllingPwd, err := controlling.GetLocalUserCredentials()
+	if err != nil {
+		return nil, nil, err
+	}
+	controlledUfrag, controlledPwd, err := controlled.GetLocalUserCredentials()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, agents := range [][2]*ice.Agent{{controlling, controlled}, {controlled, controlling}} {
+		from, to := agents[0], agents[1]
+		if err = from.OnCandidate(func(c ice.Candidate) {
+			if c == nil {
+				return
+			}
+			// Signaled as a string, as over a real signaling channel
+			if remote, parseErr := ice.UnmarshalCandidate(c.Marshal()); parseErr == nil {
+				_ = to.AddRemoteCandidate(remote)
+			}
+		}); err != nil {
+			return nil, nil, err
+		}
+		if err = from.GatherCandidates(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	type result struct {
+		conn *ice.Conn
+		err  error
+	}
+	accepted := make(chan result, 1)
+	go func() {
+		conn, acceptErr := controlled.Accept(ctx, controllingUfrag, controllingPwd)
+		accepted <- result{conn, acceptErr}
+	}()
+
+	dialed, dialErr := controlling.Dial(ctx, controlledUfrag, controlledPwd)
+	accept := <-accepted
+	if dialErr != nil {
+		return nil, nil, dialErr
+	}
+	if accept.err != nil {
+		return nil, nil, accept.err
+	}
+	return dialed, accept.conn, nil
+}
@@ -0,0 +1,245 @@
+// Package icetest provides virtual network topologies to test ICE
+// connectivity scenarios without real networks, e.g. in CI. A Network wires
+// two LANs, each behind its own NAT, to a WAN hosting a STUN and TURN server;
+// Connect then connects an Agent on each side. STUNServer and TURNServer
+// run on such a network or on loopback, with injected Faults.
+package icetest
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+
+	"github.com/pion/ice/v2"
+	"github.com/pion/logging"
+	"github.com/pion/transport/vnet"
+)
+
+// Addresses of the Network, LAN 0 is behind PublicIP0 and LAN 1 behind PublicIP1.
+const (
+	PublicIP0       = "27.1.1.1"
+	LocalIP0        = "192.168.0.1"
+	PublicIP1       = "28.1.1.1"
+	LocalIP1        = "10.2.0.1"
+	ServerIP        = "1.2.3.4"
+	ServerPort      = 3478
+	TURNUsername    = "user"
+	TURNPassword    = "pass"
+	turnRealm       = "pion.ly"
+	defaultLossRate = 0.3
+)
+
+// Topology selects the connectivity between the two LANs of a Network.
+type Topology int
+
+const (
+	// TopologyFullConeNAT puts both LANs behind full-cone NATs, agents
+	// connect through their server reflexive candidates.
+	TopologyFullConeNAT Topology = iota + 1
+
+	// TopologySymmetricNAT puts both LANs behind symmetric NATs, agents only
+	// connect through the TURN server.
+	TopologySymmetricNAT
+
+	// TopologyUDPBlocked drops all UDP traffic leaving the LANs, agents
+	// can not connect.
+	TopologyUDPBlocked
+
+	// TopologyHighLoss puts both LANs behind full-cone NATs and drops a
+	// share of the packets crossing the WAN, see Config.LossRate.
+	TopologyHighLoss
+)
+
+func (t Topology) String() string {
+	switch t {
+	case TopologyFullConeNAT:
+		return "full-cone-nat"
+	case TopologySymmetricNAT:
+		return "symmetric-nat"
+	case TopologyUDPBlocked:
+		return "udp-blocked"
+	case TopologyHighLoss:
+		return "high-loss"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrUnknownTopology indicates Config.Topology is not a Topology.
+var ErrUnknownTopology = errors.New("unknown topology")
+
+// Config configures a Network.
+type Config struct {
+	Topology Topology
+
+	// LossRate is the share of packets dropped by TopologyHighLoss, 0.3 if zero
+	LossRate float64
+
+	// Seed of the packet loss, for reproducible runs
+	Seed int64
+
+	// ServerFaults are the failures injected by the STUN and TURN server
+	ServerFaults Faults
+
+	LoggerFactory logging.LoggerFactory
+}
+
+// Network is a virtual network of two LANs connected through a WAN.
+type Network struct {
+	WAN *vnet.Router
+
+	// Nets are the networks of LAN 0 and LAN 1, for AgentConfig.Net
+	Nets [2]*vnet.Net
+
+	// URLs are the STUN and TURN URLs of the server on the WAN
+	URLs []*ice.URL
+
+	server *TURNServer
+}
+
+// NewNetwork builds and starts a Network, it must be closed with Close.
+func NewNetwork(config *Config) (*Network, error) {
+	loggerFactory := config.LoggerFactory
+	if loggerFactory == nil {
+		loggerFactory = logging.NewDefaultLoggerFactory()
+	}
+
+	var natType vnet.NATType
+	switch config.Topology {
+	case TopologyFullConeNAT, TopologyUDPBlocked, TopologyHighLoss:
+		natType = vnet.NATType{
+			MappingBehavior:   vnet.EndpointIndependent,
+			FilteringBehavior: vnet.EndpointIndependent,
+		}
+	case TopologySymmetricNAT:
+		natType = vnet.NATType{
+			MappingBehavior:   vnet.EndpointAddrPortDependent,
+			FilteringBehavior: vnet.EndpointAddrPortDependent,
+		}
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnknownTopology, config.Topology)
+	}
+
+	wan, err := vnet.NewRouter(&vnet.RouterConfig{
+		CIDR:          "0.0.0.0/0",
+		LoggerFactory: loggerFactory,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch config.Topology {
+	case TopologyUDPBlocked:
+		wan.AddChunkFilter(func(c vnet.Chunk) bool {
+			return c.Network() != "udp"
+		})
+	case TopologyHighLoss:
+		wan.AddChunkFilter(newLossFilter(config.LossRate, config.Seed))
+	default:
+	}
+
+	serverNet := vnet.NewNet(&vnet.NetConfig{StaticIP: ServerIP})
+	if err = wan.AddNet(serverNet); err != nil {
+		return nil, err
+	}
+
+	n := &Network{WAN: wan}
+	for i, ips := range [][2]string{{PublicIP0, LocalIP0}, {PublicIP1, LocalIP1}} {
+		if n.Nets[i], err = addLAN(wan, ips[0], ips[1], natType, loggerFactory); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = wan.Start(); err != nil {
+		// Start returns on the first router failing to start, past the
+		// ones it started
+		_ = wan.Stop()
+		return nil, err
+	}
+
+	conn, err := serverNet.ListenPacket("udp", fmt.Sprintf("%s:%d", ServerIP, ServerPort))
+	if err != nil {
+		_ = wan.Stop()
+		return nil, err
+	}
+	if n.server, err = NewTURNServer(ServerConfig{
+		Conn:          conn,
+		Net:           serverNet,
+		Faults:        config.ServerFaults,
+		LoggerFactory: loggerFactory,
+	}); err != nil {
+		_ = conn.Close()
+		_ = wan.Stop()
+		return nil, err
+	}
+
+	n.URLs = []*ice.URL{
+		{Scheme: ice.SchemeTypeSTUN, Host: ServerIP, Port: ServerPort, Proto: ice.ProtoTypeUDP},
+		{
+			Scheme:   ice.SchemeTypeTURN,
+			Host:     ServerIP,
+			Port:     ServerPort,
+			Proto:    ice.ProtoTypeUDP,
+			Username: TURNUsername,
+			Password: TURNPassword,
+		},
+	}
+	return n, nil
+}
+
+// AgentConfig returns the configuration of an agent on LAN side (0 or 1),
+// gathering host, server reflexive and relay candidates over UDP4.
+func (n *Network) AgentConfig(side int) *ice.AgentConfig {
+	return &ice.AgentConfig{
+		Urls:             n.URLs,
+		NetworkTypes:     []ice.NetworkType{ice.NetworkTypeUDP4},
+		CandidateTypes:   []ice.CandidateType{ice.CandidateTypeHost, ice.CandidateTypeServerReflexive, ice.CandidateTypeRelay},
+		MulticastDNSMode: ice.MulticastDNSModeDisabled,
+		Net:              n.Nets[side],
+	}
+}
+
+// Close stops the server and the routers of the network.
+func (n *Network) Close() error {
+	serverErr := n.server.Close()
+	if err := n.WAN.Stop(); err != nil {
+		return err
+	}
+	return serverErr
+}
+
+func addLAN(wan *vnet.Router, publicIP, localIP string, natType vnet.NATType, loggerFactory logging.LoggerFactory) (*vnet.Net, error) {
+	lan, err := vnet.NewRouter(&vnet.RouterConfig{
+		StaticIPs:     []string{publicIP},
+		CIDR:          localIP + "/24",
+		NATType:       &natType,
+		LoggerFactory: loggerFactory,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lanNet := vnet.NewNet(&vnet.NetConfig{StaticIPs: []string{localIP}})
+	if err = lan.AddNet(lanNet); err != nil {
+		return nil, err
+	}
+	if err = wan.AddRouter(lan); err != nil {
+		return nil, err
+	}
+	return lanNet, nil
+}
+
+// newLossFilter returns a chunk filter dropping packets at rate.
+func newLossFilter(rate float64, seed int64) vnet.ChunkFilter {
+	if rate == 0 {
+		rate = defaultLossRate
+	}
+	var mu sync.Mutex
+	r := rand.New(rand.NewSource(seed)) //nolint:gosec
+	return func(vnet.Chunk) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return r.Float64() >= rate
+	}
+}
@@ -0,0 +1,113 @@
+//go:build !js
+// +build !js
+
+package icetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pion/ice/v2"
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopologies(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 60)
+	defer lim.Stop()
+
+	for _, tc := range []struct {
+		topology  Topology
+		connected bool
+		relayed   bool
+	}{
+		{TopologyFullConeNAT, true, false},
+		{TopologySymmetricNAT, true, true},
+		{TopologyHighLoss, true, false},
+		{TopologyUDPBlocked, false, false},
+	} {
+		tc := tc
+		t.Run(tc.topology.String(), func(t *testing.T) {
+			n, err := NewNetwork(&Config{Topology: tc.topology, Seed: 1})
+			require.NoError(t, err)
+			defer func() {
+				assert.NoError(t, n.Close())
+			}()
+
+			controlling, err := ice.NewAgent(n.AgentConfig(0))
+			require.NoError(t, err)
+			controlled, err := ice.NewAgent(n.AgentConfig(1))
+			require.NoError(t, err)
+
+			timeout := 10 * time.Second
+			if !tc.connected {
+				timeout = 2 * time.Second
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			dialed, accepted, err := Connect(ctx, controlling, controlled)
+			if !tc.connected {
+				assert.True(t, errors.Is(err, ice.ErrCanceledByCaller))
+				assert.NoError(t, controlling.Close())
+				assert.NoError(t, controlled.Close())
+				return
+			}
+			require.NoError(t, err)
+
+			// The NATs are traversed directly unless both are symmetric
+			pair, err := controlling.GetSelectedCandidatePair()
+			require.NoError(t, err)
+			require.NotNil(t, pair)
+			relayed := pair.Local.Type() == ice.CandidateTypeRelay || pair.Remote.Type() == ice.CandidateTypeRelay
+			assert.Equal(t, tc.relayed, relayed, pair.String())
+
+			assert.NoError(t, dialed.Close())
+			assert.NoError(t, accepted.Close())
+		})
+	}
+
+	_, err := NewNetwork(&Config{})
+	assert.ErrorIs(t, err, ErrUnknownTopology)
+}
+
+func TestServerFaults(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	n, err := NewNetwork(&Config{
+		Topology:     TopologySymmetricNAT,
+		ServerFaults: Faults{Delay: 50 * time.Millisecond, StaleNonces: 2},
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, n.Close())
+	}()
+
+	controlling, err := ice.NewAgent(n.AgentConfig(0))
+	require.NoError(t, err)
+	controlled, err := ice.NewAgent(n.AgentConfig(1))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dialed, accepted, err := Connect(ctx, controlling, controlled)
+	require.NoError(t, err)
+
+	n.server.conn.mu.Lock()
+	assert.Equal(t, 0, n.server.conn.staleNonces)
+	n.server.conn.mu.Unlock()
+
+	assert.NoError(t, dialed.Close())
+	assert.NoError(t, accepted.Close())
+}
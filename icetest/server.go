@@ -0,0 +1,314 @@
+package icetest
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun"
+	"github.com/pion/transport/vnet"
+	"github.com/pion/turn/v2"
+)
+
+const receiveMTU = 1500
+
+// ErrNoServerConn indicates ServerConfig.Conn is nil.
+var ErrNoServerConn = errors.New("server requires a PacketConn")
+
+// Faults are the failures injected by a STUNServer or TURNServer.
+type Faults struct {
+	// DropRate is the share of the received packets dropped unanswered
+	DropRate float64
+
+	// Delay delays every response of the server
+	Delay time.Duration
+
+	// StaleNonces is the number of authenticated TURN requests, other than
+	// Allocate, answered with a 438 Stale Nonce error before the server
+	// handles them again. Clients are expected to retry these.
+	StaleNonces int
+
+	// Seed of the dropped packets, for reproducible runs
+	Seed int64
+}
+
+// ServerConfig configures a STUNServer or TURNServer.
+type ServerConfig struct {
+	// Conn is the socket the server answers on, from net.ListenPacket on
+	// loopback or from vnet.Net.ListenPacket.
+	Conn net.PacketConn
+
+	// Net is the network the TURN server allocates relay sockets on, nil
+	// allocates them on the loopback interface.
+	Net *vnet.Net
+
+	// RelayIP is the address of the relay sockets advertised by the TURN
+	// server, the IP of Conn if nil.
+	RelayIP net.IP
+
+	Faults Faults
+
+	LoggerFactory logging.LoggerFactory
+}
+
+// STUNServer is a STUN server answering binding requests with the address
+// they are received from.
+type STUNServer struct {
+	conn *faultConn
+	log  logging.LeveledLogger
+	done chan struct{}
+}
+
+// NewSTUNServer starts a STUNServer on config.Conn, it must be closed with
+// Close.
+func NewSTUNServer(config ServerConfig) (*STUNServer, error) {
+	if config.Conn == nil {
+		return nil, ErrNoServerConn
+	}
+	loggerFactory := config.LoggerFactory
+	if loggerFactory == nil {
+		loggerFactory = logging.NewDefaultLoggerFactory()
+	}
+
+	s := &STUNServer{
+		conn: newFaultConn(config.Conn, config.Faults),
+		log:  loggerFactory.NewLogger("stun-server"),
+		done: make(chan struct{}),
+	}
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the address the server answers on.
+func (s *STUNServer) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// Close stops the server and closes its socket.
+func (s *STUNServer) Close() error {
+	err := s.conn.Close()
+	<-s.done
+	return err
+}
+
+func (s *STUNServer) serve() {
+	defer close(s.done)
+
+	buf := make([]byte, receiveMTU)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		req := &stun.Message{Raw: append([]byte{}, buf[:n]...)}
+		if err = req.Decode(); err != nil || req.Type != stun.BindingRequest {
+			continue
+		}
+
+		udpAddr, ok := addr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		res, err := stun.Build(
+			stun.NewTransactionIDSetter(req.TransactionID),
+			stun.BindingSuccess,
+			&stun.XORMappedAddress{IP: udpAddr.IP, Port: udpAddr.Port},
+			stun.Fingerprint,
+		)
+		if err != nil {
+			s.log.Warnf("Failed to build binding response: %v", err)
+			continue
+		}
+		if _, err = s.conn.WriteTo(res.Raw, addr); err != nil {
+			s.log.Debugf("Failed to send binding response to %s: %v", addr, err)
+		}
+	}
+}
+
+// TURNServer is a TURN server allocating relay sockets for TURNUsername and
+// TURNPassword. It also answers STUN binding requests.
+type TURNServer struct {
+	conn   *faultConn
+	server *turn.Server
+}
+
+// NewTURNServer starts a TURNServer on config.Conn, it must be closed with
+// Close.
+func NewTURNServer(config ServerConfig) (*TURNServer, error) {
+	if config.Conn == nil {
+		return nil, ErrNoServerConn
+	}
+
+	relayIP := config.RelayIP
+	if relayIP == nil {
+		if addr, ok := config.Conn.LocalAddr().(*net.UDPAddr); ok {
+			relayIP = addr.IP
+		}
+	}
+
+	var relayAddressGenerator turn.RelayAddressGenerator = &turn.RelayAddressGeneratorNone{
+		Address: relayIP.String(),
+	}
+	if config.Net != nil {
+		relayAddressGenerator = &turn.RelayAddressGeneratorStatic{
+			RelayAddress: relayIP,
+			Address:      "0.0.0.0",
+			Net:          config.Net,
+		}
+	}
+
+	conn := newFaultConn(config.Conn, config.Faults)
+	server, err := turn.NewServer(turn.ServerConfig{
+		AuthHandler: func(username, realm string, srcAddr net.Addr) ([]byte, bool) {
+			if username != TURNUsername {
+				return nil, false
+			}
+			return turn.GenerateAuthKey(username, realm, TURNPassword), true
+		},
+		PacketConnConfigs: []turn.PacketConnConfig{
+			{
+				PacketConn:            conn,
+				RelayAddressGenerator: relayAddressGenerator,
+			},
+		},
+		Realm:         turnRealm,
+		LoggerFactory: config.LoggerFactory,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &TURNServer{conn: conn, server: server}, nil
+}
+
+// Addr returns the address the server answers on.
+func (s *TURNServer) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// Close stops the server and closes its socket.
+func (s *TURNServer) Close() error {
+	return s.server.Close()
+}
+
+// faultConn injects Faults into the traffic of a server socket.
+type faultConn struct {
+	net.PacketConn
+	faults Faults
+
+	mu          sync.Mutex
+	rand        *rand.Rand
+	staleNonces int
+	closed      bool
+
+	pending sync.WaitGroup
+}
+
+func newFaultConn(conn net.PacketConn, faults Faults) *faultConn {
+	return &faultConn{
+		PacketConn:  conn,
+		faults:      faults,
+		rand:        rand.New(rand.NewSource(faults.Seed)), //nolint:gosec
+		staleNonces: faults.StaleNonces,
+	}
+}
+
+func (c *faultConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(p)
+		if err != nil {
+			return n, addr, err
+		}
+		if c.drop() || c.answerStaleNonce(p[:n], addr) {
+			continue
+		}
+		return n, addr, nil
+	}
+}
+
+func (c *faultConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if c.faults.Delay <= 0 {
+		return c.PacketConn.WriteTo(p, addr)
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return c.PacketConn.WriteTo(p, addr)
+	}
+	c.pending.Add(1)
+	c.mu.Unlock()
+
+	buf := append([]byte{}, p...)
+	time.AfterFunc(c.faults.Delay, func() {
+		defer c.pending.Done()
+		_, _ = c.PacketConn.WriteTo(buf, addr)
+	})
+	return len(p), nil
+}
+
+// Close closes the socket once the delayed responses are sent.
+func (c *faultConn) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+
+	c.pending.Wait()
+	return c.PacketConn.Close()
+}
+
+func (c *faultConn) drop() bool {
+	if c.faults.DropRate <= 0 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rand.Float64() < c.faults.DropRate
+}
+
+// answerStaleNonce answers an authenticated TURN request with a 438 Stale
+// Nonce error while c.staleNonces is not exhausted. The error carries the
+// nonce of the request, so the retry of the client is accepted.
+func (c *faultConn) answerStaleNonce(p []byte, addr net.Addr) bool {
+	if !stun.IsMessage(p) {
+		return false
+	}
+	req := &stun.Message{Raw: append([]byte{}, p...)}
+	if err := req.Decode(); err != nil ||
+		req.Type.Class != stun.ClassRequest ||
+		req.Type.Method == stun.MethodAllocate ||
+		!req.Contains(stun.AttrMessageIntegrity) {
+		return false
+	}
+
+	var nonce stun.Nonce
+	var realm stun.Realm
+	if nonce.GetFrom(req) != nil || realm.GetFrom(req) != nil {
+		return false
+	}
+
+	c.mu.Lock()
+	if c.staleNonces <= 0 {
+		c.mu.Unlock()
+		return false
+	}
+	c.staleNonces--
+	c.mu.Unlock()
+
+	res, err := stun.Build(
+		stun.NewTransactionIDSetter(req.TransactionID),
+		stun.NewType(req.Type.Method, stun.ClassErrorResponse),
+		stun.CodeStaleNonce,
+		nonce,
+		realm,
+		stun.Fingerprint,
+	)
+	if err != nil {
+		return false
+	}
+	_, _ = c.WriteTo(res.Raw, addr)
+	return true
+}
@@ -0,0 +1,78 @@
+//go:build !js
+// +build !js
+
+package icetest
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/stun"
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSTUNServer(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	bind := func(t *testing.T, faults Faults) (*stun.XORMappedAddress, net.Addr, time.Duration) {
+		serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		require.NoError(t, err)
+		server, err := NewSTUNServer(ServerConfig{Conn: serverConn, Faults: faults})
+		require.NoError(t, err)
+		defer func() {
+			assert.NoError(t, server.Close())
+		}()
+
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer func() {
+			assert.NoError(t, conn.Close())
+		}()
+
+		req, err := stun.Build(stun.BindingRequest, stun.TransactionID)
+		require.NoError(t, err)
+		start := time.Now()
+		_, err = conn.WriteTo(req.Raw, server.Addr())
+		require.NoError(t, err)
+
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(500*time.Millisecond)))
+		buf := make([]byte, receiveMTU)
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return nil, conn.LocalAddr(), 0
+		}
+		elapsed := time.Since(start)
+
+		res := &stun.Message{Raw: buf[:n]}
+		require.NoError(t, res.Decode())
+		assert.Equal(t, req.TransactionID, res.TransactionID)
+
+		var addr stun.XORMappedAddress
+		require.NoError(t, addr.GetFrom(res))
+		return &addr, conn.LocalAddr(), elapsed
+	}
+
+	t.Run("Binding", func(t *testing.T) {
+		addr, local, _ := bind(t, Faults{})
+		require.NotNil(t, addr)
+		assert.Equal(t, local.String(), addr.String())
+	})
+
+	t.Run("Delay", func(t *testing.T) {
+		addr, _, elapsed := bind(t, Faults{Delay: 100 * time.Millisecond})
+		require.NotNil(t, addr)
+		assert.GreaterOrEqual(t, int64(elapsed), int64(100*time.Millisecond))
+	})
+
+	t.Run("Drop", func(t *testing.T) {
+		addr, _, _ := bind(t, Faults{DropRate: 1})
+		assert.Nil(t, addr)
+	})
+
+	_, err := NewSTUNServer(ServerConfig{})
+	assert.ErrorIs(t, err, ErrNoServerConn)
+}
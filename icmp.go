@@ -0,0 +1,76 @@
+package ice
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/pion/logging"
+)
+
+// icmpError is an ICMP error received on a candidate socket, dst is
+// the destination of the packet that triggered it.
+type icmpError struct {
+	dst net.Addr
+	err error
+}
+
+// rawPacketConn returns the socket underneath conn, if there is one
+func rawPacketConn(conn net.PacketConn) net.PacketConn {
+	if c, ok := conn.(*captureConn); ok {
+		return c.PacketConn
+	}
+	return conn
+}
+
+// drainICMPErrors reads the ICMP errors queued on the candidate socket and
+// fails the pairs they refer to. It returns false if err was not caused by
+// an ICMP error, in which case nothing was read. It must not be called from
+// the task loop, see handleWriteError.
+func (c *candidateBase) drainICMPErrors(err error) bool {
+	errs, ok := c.readICMPErrors(err)
+	if len(errs) == 0 {
+		return ok
+	}
+
+	if err := c.agent().run(c, func(ctx context.Context, agent *Agent) {
+		agent.failICMPPairs(c, errs)
+	}); err != nil {
+		c.agent().log.Warnf("Failed to handle ICMP error: %v", err)
+	}
+	return true
+}
+
+// readICMPErrors reads the ICMP errors queued on the candidate socket, if
+// err was caused by one.
+func (c *candidateBase) readICMPErrors(err error) ([]icmpError, bool) {
+	if !c.icmpErrorDetection || !isICMPError(err) {
+		return nil, false
+	}
+	return readICMPErrors(rawPacketConn(c.conn)), true
+}
+
+// failICMPPairs fails every pair from local to the destination of one of
+// the ICMP errors.
+func (a *Agent) failICMPPairs(local *candidateBase, errs []icmpError) {
+	for _, e := range errs {
+		ip, port, _, ok := parseAddr(e.dst)
+		if !ok {
+			continue
+		}
+
+		for _, p := range a.checklist {
+			if p.Local.ID() != local.ID() || p.Remote.Address() != ip.String() || p.Remote.Port() != port {
+				continue
+			}
+
+			a.log.Warnf("%v from %s, failing pair %s", e.err, p.Remote, p)
+			a.logEvent(logging.LogLevelWarn, "candidate pair failed by ICMP error", "pair", p.String(), "error", e.err)
+			p.state = CandidatePairStateFailed
+			p.icmpErr = e.err
+			if p == a.getSelectedPair() && errors.Is(e.err, ErrICMPPortUnreachable) {
+				a.updateConnectionState(ConnectionStateFailed, ConnectionStateChangeReasonRemoteClosed)
+			}
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package ice
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// ICMP types and codes reported in sock_extended_err, see ip(7)
+const (
+	soEEOriginICMP  = 2
+	soEEOriginICMP6 = 3
+
+	icmpDestUnreachable    = 3
+	icmpCodeNetUnreachable = 0
+	icmpCodeHostUnreach    = 1
+	icmpCodePortUnreach    = 3
+
+	icmp6DestUnreachable     = 1
+	icmp6CodeNoRoute         = 0
+	icmp6CodeAddrUnreachable = 3
+	icmp6CodePortUnreachable = 4
+
+	sockExtendedErrLen = 16
+)
+
+// enableICMPErrors sets IP_RECVERR (or IPV6_RECVERR) on the socket so that
+// ICMP errors are queued for unconnected sockets too.
+func enableICMPErrors(conn net.PacketConn) bool {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return false
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return false
+	}
+
+	isIPv6 := false
+	if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+		isIPv6 = addr.IP.To4() == nil
+	}
+
+	var sockErr error
+	if err := rc.Control(func(fd uintptr) {
+		if isIPv6 {
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_RECVERR, 1)
+		} else {
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_RECVERR, 1)
+		}
+	}); err != nil {
+		return false
+	}
+	return sockErr == nil
+}
+
+// isICMPError reports whether a read or write error was caused by a queued ICMP error
+func isICMPError(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EHOSTUNREACH) ||
+		errors.Is(err, syscall.ENETUNREACH)
+}
+
+// readICMPErrors drains the socket error queue without blocking
+func readICMPErrors(conn net.PacketConn) []icmpError {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return nil
+	}
+
+	var errs []icmpError
+	buf := make([]byte, 1)
+	oob := make([]byte, 512)
+	for {
+		var (
+			oobn    int
+			from    syscall.Sockaddr
+			recvErr error
+		)
+		if err := rc.Control(func(fd uintptr) {
+			_, oobn, _, from, recvErr = syscall.Recvmsg(int(fd), buf, oob, syscall.MSG_ERRQUEUE|syscall.MSG_DONTWAIT)
+		}); err != nil || recvErr != nil {
+			return errs
+		}
+
+		if e, ok := parseICMPError(oob[:oobn], from); ok {
+			errs = append(errs, e)
+		}
+	}
+}
+
+func parseICMPError(oob []byte, from syscall.Sockaddr) (icmpError, bool) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return icmpError{}, false
+	}
+
+	var dst net.Addr
+	switch sa := from.(type) {
+	case *syscall.SockaddrInet4:
+		dst = &net.UDPAddr{IP: net.IP(sa.Addr[:]).To16(), Port: sa.Port}
+	case *syscall.SockaddrInet6:
+		dst = &net.UDPAddr{IP: net.IP(sa.Addr[:]), Port: sa.Port}
+	default:
+		return icmpError{}, false
+	}
+
+	for _, m := range msgs {
+		isRecvErr := (m.Header.Level == syscall.IPPROTO_IP && m.Header.Type == syscall.IP_RECVERR) ||
+			(m.Header.Level == syscall.IPPROTO_IPV6 && m.Header.Type == syscall.IPV6_RECVERR)
+		if !isRecvErr || len(m.Data) < sockExtendedErrLen {
+			continue
+		}
+
+		// struct sock_extended_err { u32 ee_errno; u8 ee_origin; u8 ee_type; u8 ee_code; ... }
+		origin, icmpType, icmpCode := m.Data[4], m.Data[5], m.Data[6]
+		if err := icmpUnreachableError(origin, icmpType, icmpCode); err != nil {
+			return icmpError{dst: dst, err: err}, true
+		}
+	}
+
+	return icmpError{}, false
+}
+
+func icmpUnreachableError(origin, icmpType, icmpCode byte) error {
+	switch {
+	case origin == soEEOriginICMP && icmpType == icmpDestUnreachable:
+		switch icmpCode {
+		case icmpCodePortUnreach:
+			return ErrICMPPortUnreachable
+		case icmpCodeHostUnreach:
+			return ErrICMPHostUnreachable
+		case icmpCodeNetUnreachable:
+			return ErrICMPNetworkUnreachable
+		}
+	case origin == soEEOriginICMP6 && icmpType == icmp6DestUnreachable:
+		switch icmpCode {
+		case icmp6CodePortUnreachable:
+			return ErrICMPPortUnreachable
+		case icmp6CodeAddrUnreachable:
+			return ErrICMPHostUnreachable
+		case icmp6CodeNoRoute:
+			return ErrICMPNetworkUnreachable
+		}
+	}
+	return nil
+}
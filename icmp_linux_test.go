@@ -0,0 +1,181 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/stun"
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestICMPUnreachableError(t *testing.T) {
+	assert.Equal(t, ErrICMPPortUnreachable, icmpUnreachableError(soEEOriginICMP, icmpDestUnreachable, icmpCodePortUnreach))
+	assert.Equal(t, ErrICMPHostUnreachable, icmpUnreachableError(soEEOriginICMP, icmpDestUnreachable, icmpCodeHostUnreach))
+	assert.Equal(t, ErrICMPNetworkUnreachable, icmpUnreachableError(soEEOriginICMP6, icmp6DestUnreachable, icmp6CodeNoRoute))
+	assert.Equal(t, ErrICMPPortUnreachable, icmpUnreachableError(soEEOriginICMP6, icmp6DestUnreachable, icmp6CodePortUnreachable))
+	assert.NoError(t, icmpUnreachableError(soEEOriginICMP, 11, 0))
+}
+
+func TestICMPErrorDetection(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	a, err := NewAgent(&AgentConfig{
+		NetworkTypes:       []NetworkType{NetworkTypeUDP4},
+		ICMPErrorDetection: true,
+	})
+	require.NoError(t, err)
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IP{127, 0, 0, 1}})
+	require.NoError(t, err)
+
+	// Nothing listens on the remote port
+	closed, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IP{127, 0, 0, 1}})
+	require.NoError(t, err)
+	remotePort := closed.LocalAddr().(*net.UDPAddr).Port //nolint:forcetypeassert
+	require.NoError(t, closed.Close())
+
+	local, err := NewCandidateHost(&CandidateHostConfig{
+		Network:   "udp",
+		Address:   "127.0.0.1",
+		Port:      conn.LocalAddr().(*net.UDPAddr).Port, //nolint:forcetypeassert
+		Component: 1,
+	})
+	require.NoError(t, err)
+
+	remote, err := NewCandidateHost(&CandidateHostConfig{
+		Network:   "udp",
+		Address:   "127.0.0.1",
+		Port:      remotePort,
+		Component: 1,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, a.addCandidate(context.Background(), local, conn))
+	require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+		agent.addRemoteCandidate(remote)
+	}))
+	assert.True(t, local.icmpErrorDetection)
+
+	pairFailed := func() (failed bool) {
+		assert.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+			p := agent.findPair(local, remote)
+			failed = p != nil && p.state == CandidatePairStateFailed && p.icmpErr == ErrICMPPortUnreachable
+		}))
+		return
+	}
+
+	for !pairFailed() {
+		_, err = local.writeTo([]byte{0x00}, remote)
+		assert.NoError(t, err)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.NoError(t, a.Close())
+}
+
+func TestICMPErrorDetectionCheck(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	a, err := NewAgent(&AgentConfig{
+		NetworkTypes:       []NetworkType{NetworkTypeUDP4},
+		ICMPErrorDetection: true,
+	})
+	require.NoError(t, err)
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IP{127, 0, 0, 1}})
+	require.NoError(t, err)
+
+	// Nothing listens on the remote port
+	closed, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IP{127, 0, 0, 1}})
+	require.NoError(t, err)
+	remotePort := closed.LocalAddr().(*net.UDPAddr).Port //nolint:forcetypeassert
+	require.NoError(t, closed.Close())
+
+	local, err := NewCandidateHost(&CandidateHostConfig{
+		Network:   "udp",
+		Address:   "127.0.0.1",
+		Port:      conn.LocalAddr().(*net.UDPAddr).Port, //nolint:forcetypeassert
+		Component: 1,
+	})
+	require.NoError(t, err)
+
+	remote, err := NewCandidateHost(&CandidateHostConfig{
+		Network:   "udp",
+		Address:   "127.0.0.1",
+		Port:      remotePort,
+		Component: 1,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, a.addCandidate(context.Background(), local, conn))
+	require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+		agent.addRemoteCandidate(remote)
+	}))
+
+	// The checks are sent from the task loop, which fails the pair without
+	// waiting on itself
+	pairFailed := func() (failed bool) {
+		assert.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+			p := agent.findPair(local, remote)
+			if p == nil {
+				return
+			}
+			if failed = p.state == CandidatePairStateFailed && p.icmpErr == ErrICMPPortUnreachable; !failed {
+				msg, err := stun.Build(stun.BindingRequest, stun.TransactionID)
+				assert.NoError(t, err)
+				agent.sendSTUN(msg, local, remote)
+			}
+		}))
+		return
+	}
+
+	for !pairFailed() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.NoError(t, a.Close())
+}
+
+func TestICMPErrorRemoteClosed(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	a, err := NewAgent(&AgentConfig{})
+	require.NoError(t, err)
+
+	local, err := NewCandidateHost(&CandidateHostConfig{Network: "udp", Address: "192.168.0.1", Port: 1000, Component: 1})
+	require.NoError(t, err)
+	remote, err := NewCandidateHost(&CandidateHostConfig{Network: "udp", Address: "10.0.0.1", Port: 1000, Component: 1})
+	require.NoError(t, err)
+
+	require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+		p := agent.addPair(local, remote)
+		p.state = CandidatePairStateSucceeded
+		agent.selectedPair.Store(p)
+		agent.connectionState = ConnectionStateConnected
+	}))
+
+	// A port unreachable for the selected pair means the remote went away
+	require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+		agent.failICMPPairs(&local.candidateBase, []icmpError{{dst: remote.addr(), err: ErrICMPPortUnreachable}})
+		assert.Equal(t, ConnectionState(ConnectionStateFailed), agent.connectionState)
+		last := agent.connectionTransitions[len(agent.connectionTransitions)-1]
+		assert.Equal(t, ConnectionStateChangeReasonRemoteClosed, last.Reason)
+	}))
+	assert.NoError(t, a.Close())
+}
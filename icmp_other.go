@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+package ice
+
+import "net"
+
+// ICMP errors are only read on Linux, where IP_RECVERR is available
+
+func enableICMPErrors(net.PacketConn) bool {
+	return false
+}
+
+func isICMPError(error) bool {
+	return false
+}
+
+func readICMPErrors(net.PacketConn) []icmpError {
+	return nil
+}
@@ -0,0 +1,49 @@
+package ice
+
+import (
+	"net"
+
+	"github.com/pion/logging"
+)
+
+// IOBackend selects how the UDP sockets of the candidates, and of a
+// UDPMuxDefault, are read and written.
+type IOBackend int
+
+const (
+	// IOBackendDefault reads and writes several packets per system call
+	// with recvmmsg and sendmmsg on Linux, unless DisableBatchIO is set,
+	// one packet per call elsewhere.
+	IOBackendDefault IOBackend = iota
+
+	// IOBackendIOUring submits the reads and writes of a batch at once to
+	// an io_uring. It is experimental and only built on Linux with the
+	// iouring build tag. Sockets fall back to IOBackendDefault where it
+	// is not built in, or when the kernel refuses to set up an io_uring.
+	// UDP segmentation offload is not used with it.
+	IOBackendIOUring
+)
+
+func (b IOBackend) String() string {
+	switch b {
+	case IOBackendDefault:
+		return "default"
+	case IOBackendIOUring:
+		return "io_uring"
+	default:
+		return "unknown"
+	}
+}
+
+// newBackendBatchConn returns the packetBatchConn of conn for backend, nil
+// if conn is read and written one packet at a time.
+func newBackendBatchConn(backend IOBackend, conn net.PacketConn, offload bool, log logging.LeveledLogger) packetBatchConn {
+	if backend == IOBackendIOUring {
+		c, err := newIOUringBatchConn(conn)
+		if err == nil {
+			return c
+		}
+		log.Debugf("Failed to set up io_uring for %s, falling back to the default IO: %v", conn.LocalAddr(), err)
+	}
+	return newPacketBatchConn(conn, offload)
+}
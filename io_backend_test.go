@@ -0,0 +1,59 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Agents connect with the io_uring backend whether it is built in or not
+func TestIOBackendIOUring(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	aConn, bConn := pipe(&AgentConfig{IOBackend: IOBackendIOUring})
+
+	msg := []byte("io_uring")
+	_, err := aConn.Write(msg)
+	assert.NoError(t, err)
+	buf := make([]byte, len(msg))
+	_, err = bConn.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, msg, buf)
+
+	assert.NoError(t, aConn.Close())
+	assert.NoError(t, bConn.Close())
+}
+
+func TestUDPMuxIOBackendIOUring(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	conn, err := net.ListenUDP(udp, &net.UDPAddr{})
+	require.NoError(t, err)
+
+	udpMux := NewUDPMuxDefault(UDPMuxParams{
+		UDPConn:   conn,
+		IOBackend: IOBackendIOUring,
+	})
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	testMuxConnection(t, udpMux, "ufrag1", "udp4")
+
+	require.NoError(t, udpMux.Close())
+}
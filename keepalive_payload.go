@@ -0,0 +1,25 @@
+package ice
+
+import "github.com/pion/stun"
+
+// sendKeepalivePayload sends the payload of AgentConfig.KeepalivePayload on
+// the selected pair p, if any.
+//
+// Note: the caller should hold the agent lock.
+func (a *Agent) sendKeepalivePayload(p *CandidatePair) {
+	if a.keepalivePayload == nil {
+		return
+	}
+	payload := a.keepalivePayload(p)
+	if len(payload) == 0 {
+		return
+	}
+	// The peer would handle it as a STUN message rather than as data
+	if stun.IsMessage(payload) {
+		a.log.Warnf("Discarding keepalive payload on %s: it is a STUN message", p)
+		return
+	}
+	if _, err := p.Write(payload); err != nil {
+		a.log.Tracef("failed to send keepalive payload: %s", err)
+	}
+}
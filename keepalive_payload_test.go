@@ -0,0 +1,51 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/stun"
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeepalivePayload(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	heartbeat := []byte("heartbeat")
+	keepaliveInterval := 50 * time.Millisecond
+	aConn, bConn := pipe(&AgentConfig{
+		KeepaliveInterval: &keepaliveInterval,
+		KeepalivePayload: func(*CandidatePair) []byte {
+			return heartbeat
+		},
+		KeepalivePayloadOnly: true,
+	})
+
+	var requests uint64
+	assert.NoError(t, aConn.agent.OnSTUNMessage(func(m STUNMessageTrace) {
+		if m.Direction == STUNMessageDirectionOutbound && m.Method == stun.MethodBinding && m.Class == stun.ClassRequest {
+			atomic.AddUint64(&requests, 1)
+		}
+	}))
+
+	// The heartbeats keep the pair alive, the peer reads them as data
+	buf := make([]byte, 64)
+	for i := 0; i < 3; i++ {
+		n, err := bConn.Read(buf)
+		assert.NoError(t, err)
+		assert.Equal(t, heartbeat, buf[:n])
+	}
+	assert.Zero(t, atomic.LoadUint64(&requests))
+
+	assert.NoError(t, aConn.Close())
+	assert.NoError(t, bConn.Close())
+}
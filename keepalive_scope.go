@@ -0,0 +1,69 @@
+package ice
+
+// KeepaliveScope is the set of candidate pairs the agent keeps alive once a
+// pair is selected.
+type KeepaliveScope int
+
+const (
+	// KeepaliveScopeSelectedPair keeps only the selected pair alive
+	KeepaliveScopeSelectedPair KeepaliveScope = iota + 1
+
+	// KeepaliveScopeValidPairs also keeps every other succeeded pair alive,
+	// so the agent can fail over to them without checking them again
+	KeepaliveScopeValidPairs
+
+	// KeepaliveScopeRelayPairs also keeps the other succeeded pairs with a
+	// relay candidate alive, so their TURN permissions do not expire
+	KeepaliveScopeRelayPairs
+)
+
+func (s KeepaliveScope) String() string {
+	switch s {
+	case KeepaliveScopeSelectedPair:
+		return "selected-pair"
+	case KeepaliveScopeValidPairs:
+		return "valid-pairs"
+	case KeepaliveScopeRelayPairs:
+		return "relay-pairs"
+	default:
+		return ErrUnknownType.Error()
+	}
+}
+
+// inScope reports whether p is kept alive besides the selected pair.
+func (s KeepaliveScope) inScope(p *CandidatePair) bool {
+	if p.state != CandidatePairStateSucceeded {
+		return false
+	}
+	switch s {
+	case KeepaliveScopeValidPairs:
+		return true
+	case KeepaliveScopeRelayPairs:
+		return p.Local.Type() == CandidateTypeRelay || p.Remote.Type() == CandidateTypeRelay
+	default:
+		return false
+	}
+}
+
+// checkStandbyKeepalive sends a binding request on the pairs of the
+// keepalive scope other than the selected pair, if none was sent on them in
+// the last standbyKeepaliveInterval.
+//
+// Note: the caller should hold the agent lock.
+func (a *Agent) checkStandbyKeepalive() {
+	if a.keepaliveScope == KeepaliveScopeSelectedPair || a.standbyKeepaliveInterval == 0 {
+		return
+	}
+
+	selectedPair := a.getSelectedPair()
+	now := a.clock.Now()
+	for _, p := range a.checklist {
+		if p == selectedPair || !a.keepaliveScope.inScope(p) {
+			continue
+		}
+		if now.Sub(p.lastKeepalive) > a.standbyKeepaliveInterval {
+			p.lastKeepalive = now
+			a.selector.PingPair(p)
+		}
+	}
+}
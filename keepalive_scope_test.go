@@ -0,0 +1,204 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pingRecorder is a pairCandidateSelector recording the pairs it pings.
+type pingRecorder struct {
+	controllingSelector
+	pinged []*CandidatePair
+}
+
+func (s *pingRecorder) PingPair(p *CandidatePair) {
+	s.pinged = append(s.pinged, p)
+}
+
+func TestKeepaliveScope(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	newCandidate := func(typ CandidateType, address string) Candidate {
+		var c Candidate
+		var err error
+		if typ == CandidateTypeRelay {
+			c, err = NewCandidateRelay(&CandidateRelayConfig{Network: "udp", Address: address, Port: 1000, Component: 1})
+		} else {
+			c, err = NewCandidateHost(&CandidateHostConfig{Network: "udp", Address: address, Port: 1000, Component: 1})
+		}
+		require.NoError(t, err)
+		return c
+	}
+
+	keepalive := func(scope KeepaliveScope, standbyInterval *time.Duration) [][]*CandidatePair {
+		clock := NewManualClock(time.Now())
+		keepaliveInterval := time.Second
+		a, err := NewAgent(&AgentConfig{
+			Clock:                    clock,
+			KeepaliveInterval:        &keepaliveInterval,
+			KeepaliveScope:           scope,
+			StandbyKeepaliveInterval: standbyInterval,
+		})
+		require.NoError(t, err)
+		defer func() {
+			assert.NoError(t, a.Close())
+		}()
+
+		var rounds [][]*CandidatePair
+		require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+			recorder := &pingRecorder{}
+			agent.selector = recorder
+
+			remote := newCandidate(CandidateTypeHost, "10.0.0.1")
+			selected := agent.addPair(newCandidate(CandidateTypeHost, "192.168.0.1"), remote)
+			valid := agent.addPair(newCandidate(CandidateTypeHost, "192.168.0.2"), remote)
+			relay := agent.addPair(newCandidate(CandidateTypeRelay, "1.2.3.4"), remote)
+			agent.addPair(newCandidate(CandidateTypeRelay, "1.2.3.5"), remote)
+			for _, p := range []*CandidatePair{selected, valid, relay} {
+				p.state = CandidatePairStateSucceeded
+			}
+			agent.selectedPair.Store(selected)
+
+			for i := 0; i < 3; i++ {
+				recorder.pinged = nil
+				agent.checkKeepalive()
+				rounds = append(rounds, recorder.pinged)
+				clock.Advance(time.Second + time.Millisecond)
+			}
+		}))
+		return rounds
+	}
+
+	for _, round := range keepalive(0, nil) {
+		require.Len(t, round, 1)
+		assert.Equal(t, "192.168.0.1", round[0].Local.Address())
+	}
+
+	for _, round := range keepalive(KeepaliveScopeValidPairs, nil) {
+		require.Len(t, round, 3)
+	}
+
+	for _, round := range keepalive(KeepaliveScopeRelayPairs, nil) {
+		require.Len(t, round, 2)
+		assert.Equal(t, "1.2.3.4", round[1].Local.Address())
+	}
+
+	// The standby pairs are kept alive every other round
+	standbyInterval := 2 * time.Second
+	rounds := keepalive(KeepaliveScopeValidPairs, &standbyInterval)
+	assert.Len(t, rounds[0], 3)
+	assert.Len(t, rounds[1], 1)
+	assert.Len(t, rounds[2], 3)
+
+	disabled := time.Duration(0)
+	for _, round := range keepalive(KeepaliveScopeValidPairs, &disabled) {
+		require.Len(t, round, 1)
+	}
+}
+
+func TestKeepaliveIdleTimeout(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	clock := NewManualClock(time.Now())
+	keepaliveInterval, idleTimeout := time.Second, 5*time.Second
+	a, err := NewAgent(&AgentConfig{
+		Clock:                clock,
+		KeepaliveInterval:    &keepaliveInterval,
+		KeepaliveIdleTimeout: &idleTimeout,
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	assert.Equal(t, time.Second, a.connectivityCheckInterval(ConnectionStateConnected))
+
+	require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+		recorder := &pingRecorder{}
+		agent.selector = recorder
+
+		local, err := NewCandidateHost(&CandidateHostConfig{Network: "udp", Address: "192.168.0.1", Port: 1000, Component: 1})
+		require.NoError(t, err)
+		remote, err := NewCandidateHost(&CandidateHostConfig{Network: "udp", Address: "10.0.0.1", Port: 1000, Component: 1})
+		require.NoError(t, err)
+		selected := agent.addPair(local, remote)
+		selected.state = CandidatePairStateSucceeded
+		agent.selectedPair.Store(selected)
+
+		// Data flowing both ways keeps the pair alive
+		for i := 0; i < 10; i++ {
+			local.seen(true, clock.Now())
+			remote.seen(false, clock.Now())
+			clock.Advance(time.Second)
+			agent.checkKeepalive()
+		}
+		assert.Empty(t, recorder.pinged)
+
+		// Once the peer is idle for longer than the idle timeout, the pair
+		// is kept alive every keepalive interval
+		local.seen(true, clock.Now())
+		clock.Advance(idleTimeout)
+		agent.checkKeepalive()
+		agent.checkKeepalive()
+		assert.Equal(t, []*CandidatePair{selected}, recorder.pinged)
+
+		clock.Advance(keepaliveInterval)
+		agent.checkKeepalive()
+		assert.Equal(t, []*CandidatePair{selected, selected}, recorder.pinged)
+	}))
+}
+
+func TestConsentExpiry(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	clock := NewManualClock(time.Now())
+	keepaliveInterval, disconnectedTimeout, failedTimeout := time.Second, 2*time.Second, 3*time.Second
+	a, err := NewAgent(&AgentConfig{
+		Clock:               clock,
+		KeepaliveInterval:   &keepaliveInterval,
+		DisconnectedTimeout: &disconnectedTimeout,
+		FailedTimeout:       &failedTimeout,
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+		agent.selector = &pingRecorder{}
+
+		local, err := NewCandidateHost(&CandidateHostConfig{Network: "udp", Address: "192.168.0.1", Port: 1000, Component: 1})
+		require.NoError(t, err)
+		remote, err := NewCandidateHost(&CandidateHostConfig{Network: "udp", Address: "10.0.0.1", Port: 1000, Component: 1})
+		require.NoError(t, err)
+		selected := agent.addPair(local, remote)
+		selected.state = CandidatePairStateSucceeded
+		agent.selectedPair.Store(selected)
+		agent.connectionState = ConnectionStateConnected
+
+		// The remote keeps sending but never answers the consent checks
+		for i := 0; i < 6 && agent.connectionState == ConnectionStateConnected; i++ {
+			remote.seen(false, clock.Now())
+			agent.checkKeepalive()
+			agent.validateSelectedPair()
+			clock.Advance(time.Second + time.Millisecond)
+		}
+		remote.seen(false, clock.Now())
+		agent.validateSelectedPair()
+
+		assert.Equal(t, ConnectionState(ConnectionStateFailed), agent.connectionState)
+		last := agent.connectionTransitions[len(agent.connectionTransitions)-1]
+		assert.Equal(t, ConnectionStateChangeReasonConsentExpired, last.Reason)
+	}))
+}
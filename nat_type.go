@@ -0,0 +1,223 @@
+package ice
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// NATMapping is the mapping behavior of the NAT in front of the agent, as
+// defined in RFC 4787, inferred from the server reflexive addresses observed
+// while gathering.
+type NATMapping int
+
+const (
+	// NATMappingUnknown indicates too few addresses were observed to tell,
+	// e.g. with less than two STUN servers or without
+	// AgentConfig.ProbeNATMapping
+	NATMappingUnknown NATMapping = iota + 1
+
+	// NATMappingNone indicates the observed addresses are the local ones,
+	// there is no NAT
+	NATMappingNone
+
+	// NATMappingEndpointIndependent indicates a socket is mapped to the same
+	// address whatever the destination, connectivity checks between server
+	// reflexive candidates are likely to succeed
+	NATMappingEndpointIndependent
+
+	// NATMappingAddressPortDependent indicates a socket is mapped to another
+	// address for each destination (address or port dependent mapping, a
+	// "symmetric" NAT), a relay is likely needed unless the peer has no NAT
+	NATMappingAddressPortDependent
+)
+
+func (m NATMapping) String() string {
+	switch m {
+	case NATMappingUnknown:
+		return "unknown"
+	case NATMappingNone:
+		return "none"
+	case NATMappingEndpointIndependent:
+		return "endpoint-independent"
+	case NATMappingAddressPortDependent:
+		return "address-port-dependent"
+	default:
+		return ErrUnknownType.Error()
+	}
+}
+
+// NATStats is what the last gathering revealed about the NAT in front of
+// the agent.
+type NATStats struct {
+	// Timestamp is the timestamp associated with this object.
+	Timestamp time.Time
+
+	// Mapping is the inferred mapping behavior of the NAT
+	Mapping NATMapping
+
+	// MappedAddresses are the distinct server reflexive addresses observed
+	MappedAddresses []string
+
+	// Observations is the number of binding responses Mapping is based on
+	Observations int
+}
+
+// natObservation is the address a STUN server saw a binding request from.
+type natObservation struct {
+	local  *net.UDPAddr
+	server string
+	mapped *net.UDPAddr
+}
+
+// natObservations collects the observations of a gathering.
+type natObservations struct {
+	mu   sync.Mutex
+	list []natObservation
+}
+
+func (o *natObservations) add(local net.Addr, server net.Addr, mapped *net.UDPAddr) {
+	laddr, ok := local.(*net.UDPAddr)
+	if !ok {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.list = append(o.list, natObservation{local: laddr, server: server.String(), mapped: mapped})
+}
+
+func (o *natObservations) snapshot() []natObservation {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]natObservation{}, o.list...)
+}
+
+func (o *natObservations) clear() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.list = nil
+}
+
+// GetNATStats returns the mapping behavior of the NAT inferred from the
+// last gathering. The mapping of a socket is only known when it was
+// observed by two servers, see AgentConfig.ProbeNATMapping.
+func (a *Agent) GetNATStats() NATStats {
+	observations := a.natObservations.snapshot()
+
+	hostIPs := map[string]bool{}
+	err := a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		for _, candidates := range agent.localCandidates {
+			for _, c := range candidates {
+				if c.Type() == CandidateTypeHost {
+					hostIPs[c.Address()] = true
+				}
+			}
+		}
+	})
+	if err != nil {
+		a.log.Errorf("error getting NAT stats %v", err)
+	}
+
+	mapped := map[string]bool{}
+	res := NATStats{
+		Timestamp:    a.clock.Now(),
+		Mapping:      classifyNATMapping(observations, hostIPs),
+		Observations: len(observations),
+	}
+	for _, o := range observations {
+		if addr := o.mapped.String(); !mapped[addr] {
+			mapped[addr] = true
+			res.MappedAddresses = append(res.MappedAddresses, addr)
+		}
+	}
+	sort.Strings(res.MappedAddresses)
+	return res
+}
+
+// classifyNATMapping infers the mapping behavior of a NAT from the
+// observations: a socket mapped to several addresses by different servers
+// has a dependent mapping, one mapped to a single address an independent
+// one. Observations of the local addresses, in hostIPs, reveal there is no
+// NAT.
+func classifyNATMapping(observations []natObservation, hostIPs map[string]bool) NATMapping {
+	if len(observations) == 0 {
+		return NATMappingUnknown
+	}
+
+	noNAT := true
+	for _, o := range observations {
+		if !hostIPs[o.mapped.IP.String()] || o.mapped.Port != o.local.Port {
+			noNAT = false
+			break
+		}
+	}
+	if noNAT {
+		return NATMappingNone
+	}
+
+	type socketMapping struct {
+		servers map[string]bool
+		mapped  map[string]bool
+	}
+	sockets := map[string]*socketMapping{}
+	for _, o := range observations {
+		s, ok := sockets[o.local.String()]
+		if !ok {
+			s = &socketMapping{servers: map[string]bool{}, mapped: map[string]bool{}}
+			sockets[o.local.String()] = s
+		}
+		s.servers[o.server] = true
+		s.mapped[o.mapped.String()] = true
+	}
+
+	mapping := NATMappingUnknown
+	for _, s := range sockets {
+		switch {
+		case len(s.mapped) > 1:
+			return NATMappingAddressPortDependent
+		case len(s.servers) > 1:
+			mapping = NATMappingEndpointIndependent
+		}
+	}
+	return mapping
+}
+
+// probeNATMapping sends a binding request to the first two servers of urls
+// with distinct addresses from a same socket, so the mapping behavior of
+// the NAT can be told from the addresses they see.
+func (a *Agent) probeNATMapping(ctx context.Context, urls []*URL, network string) {
+	var servers []net.Addr
+	seen := map[string]bool{}
+	for _, url := range urls {
+		serverAddr, err := a.transport.ResolveUDPAddr(network, net.JoinHostPort(url.Host, strconv.Itoa(url.Port)))
+		if err != nil || seen[serverAddr.String()] {
+			continue
+		}
+		seen[serverAddr.String()] = true
+		if servers = append(servers, serverAddr); len(servers) == 2 {
+			break
+		}
+	}
+	if len(servers) < 2 {
+		return
+	}
+
+	conn, err := listenUDPInPortRange(a.transport, a.log, int(a.portmax), int(a.portmin), network, &net.UDPAddr{IP: nil, Port: 0})
+	if err != nil {
+		a.log.Debugf("Failed to listen for NAT mapping probe %s: %v", network, err)
+		return
+	}
+	defer closeOnDone(ctx, conn)()
+
+	for _, serverAddr := range servers {
+		xoraddr, err := getXORMappedAddr(conn, serverAddr, stunGatherTimeout)
+		if err != nil {
+			a.log.Debugf("NAT mapping probe to %s failed: %v", serverAddr, err)
+			return
+		}
+		a.natObservations.add(conn.LocalAddr(), serverAddr, &net.UDPAddr{IP: xoraddr.IP, Port: xoraddr.Port})
+	}
+}
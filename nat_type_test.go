@@ -0,0 +1,51 @@
+package ice
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyNATMapping(t *testing.T) {
+	local := &net.UDPAddr{IP: net.IPv4zero, Port: 5000}
+	other := &net.UDPAddr{IP: net.IPv4zero, Port: 5001}
+	mapped := &net.UDPAddr{IP: net.IP{27, 1, 1, 1}, Port: 6000}
+	remapped := &net.UDPAddr{IP: net.IP{27, 1, 1, 1}, Port: 6001}
+	hostIPs := map[string]bool{"192.168.0.1": true}
+
+	for _, test := range []struct {
+		name         string
+		observations []natObservation
+		mapping      NATMapping
+	}{
+		{"none observed", nil, NATMappingUnknown},
+		{
+			"single server",
+			[]natObservation{{local, "1.2.3.4:3478", mapped}},
+			NATMappingUnknown,
+		},
+		{
+			"local address",
+			[]natObservation{{local, "1.2.3.4:3478", &net.UDPAddr{IP: net.IP{192, 168, 0, 1}, Port: 5000}}},
+			NATMappingNone,
+		},
+		{
+			"same mapping",
+			[]natObservation{{local, "1.2.3.4:3478", mapped}, {local, "1.2.3.5:3478", mapped}},
+			NATMappingEndpointIndependent,
+		},
+		{
+			"mapping per server",
+			[]natObservation{{local, "1.2.3.4:3478", mapped}, {local, "1.2.3.5:3478", remapped}},
+			NATMappingAddressPortDependent,
+		},
+		{
+			"servers on distinct sockets",
+			[]natObservation{{local, "1.2.3.4:3478", mapped}, {other, "1.2.3.5:3478", remapped}},
+			NATMappingUnknown,
+		},
+	} {
+		assert.Equal(t, test.mapping, classifyNATMapping(test.observations, hostIPs), test.name)
+	}
+}
@@ -0,0 +1,55 @@
+package ice
+
+import (
+	"github.com/pion/logging"
+	"github.com/pion/stun"
+)
+
+// NominationRequest is a nomination received by a controlled agent, passed
+// to AgentConfig.NominationPolicy.
+type NominationRequest struct {
+	// Pair is the candidate pair nominated by the controlling agent
+	Pair *CandidatePair
+
+	// Selected is the selected candidate pair, nil if there is none yet
+	Selected *CandidatePair
+
+	// Pending are the candidate pairs still being checked, waiting or in
+	// progress
+	Pending []*CandidatePair
+}
+
+// acceptsNominationPolicy reports whether the nomination of p is accepted by
+// the NominationPolicy. The nomination was already accepted by the rules of
+// RFC 8445.
+// Note: the caller should hold the agent lock.
+func (a *Agent) acceptsNominationPolicy(p, selectedPair *CandidatePair) bool {
+	if a.nominationPolicy == nil {
+		return true
+	}
+
+	req := NominationRequest{Pair: p, Selected: selectedPair}
+	for _, pending := range a.checklist {
+		if pending.state == CandidatePairStateWaiting || pending.state == CandidatePairStateInProgress {
+			req.Pending = append(req.Pending, pending)
+		}
+	}
+	if a.nominationPolicy(req) {
+		return true
+	}
+
+	a.logEvent(logging.LogLevelDebug, "nomination refused", "pair", p.String())
+	return false
+}
+
+// refuseNomination answers a binding request nominating a pair refused by
+// the NominationPolicy with a 400 (Bad Request) error response, see
+// https://tools.ietf.org/html/rfc8445#section-7.3.1.5
+// Note: the caller should hold the agent lock.
+func (a *Agent) refuseNomination(m *stun.Message, local, remote Candidate) {
+	if out, err := a.buildBindingError(m, stun.CodeBadRequest, "nomination refused"); err != nil {
+		a.log.Warnf("Failed to refuse nomination from: %s to: %s error: %s", remote, local, err)
+	} else {
+		a.sendSTUN(out, local, remote)
+	}
+}
@@ -0,0 +1,121 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/stun"
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writtenPacketConn records the packets written to it.
+type writtenPacketConn struct {
+	mockPacketConn
+
+	mu      sync.Mutex
+	written [][]byte
+}
+
+func (c *writtenPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.written = append(c.written, append([]byte(nil), p...))
+	return len(p), nil
+}
+
+// responseTo returns the response to the request with id written to c.
+func (c *writtenPacketConn) responseTo(t *testing.T, id [stun.TransactionIDSize]byte) *stun.Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, raw := range c.written {
+		m := &stun.Message{Raw: raw}
+		if m.Decode() == nil && m.TransactionID == id && m.Type.Class != stun.ClassRequest {
+			return m
+		}
+	}
+	t.Fatal("no response written")
+	return nil
+}
+
+func TestNominationPolicy(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 2)
+	defer lim.Stop()
+
+	// Relay pairs are refused while a host pair is still checked
+	config := &AgentConfig{
+		NominationPolicy: func(req NominationRequest) bool {
+			if req.Pair.Remote.Type() != CandidateTypeRelay {
+				return true
+			}
+			for _, p := range req.Pending {
+				if p.Remote.Type() == CandidateTypeHost {
+					return false
+				}
+			}
+			return true
+		},
+	}
+
+	runAgentTest(t, config, func(ctx context.Context, a *Agent) {
+		a.selector = &controlledSelector{agent: a, log: a.log}
+		a.remoteUfrag = "remoteUfrag"
+		a.remotePwd = "remotePwdremotePwdremotePwd"
+
+		conn := &writtenPacketConn{}
+		local := newInboundLocal(t, conn)
+		a.localCandidates[local.NetworkType()] = []Candidate{local}
+
+		host := newInboundRemote(t)
+		relay, err := NewCandidateRelay(&CandidateRelayConfig{
+			Network:   "udp",
+			Address:   "203.0.113.3",
+			Port:      999,
+			Component: 1,
+		})
+		require.NoError(t, err)
+		a.addRemoteCandidate(host)
+		a.addRemoteCandidate(relay)
+		relayPair := a.findPair(local, relay)
+		require.NotNil(t, relayPair)
+		relayPair.state = CandidatePairStateSucceeded
+
+		nominate := func() *stun.Message {
+			msg, err := stun.Build(stun.BindingRequest, stun.TransactionID,
+				stun.NewUsername(a.localUfrag+":"+a.remoteUfrag),
+				UseCandidate(),
+				AttrControlling(a.tieBreaker+1),
+				PriorityAttr(relay.Priority()),
+				stun.NewShortTermIntegrity(a.localPwd),
+				stun.Fingerprint,
+			)
+			require.NoError(t, err)
+			a.handleInbound(msg, local, relay.addr())
+			return conn.responseTo(t, msg.TransactionID)
+		}
+
+		response := nominate()
+		assert.Equal(t, stun.BindingError, response.Type)
+		var errorCode stun.ErrorCodeAttribute
+		require.NoError(t, errorCode.GetFrom(response))
+		assert.Equal(t, stun.CodeBadRequest, errorCode.Code)
+		assert.NoError(t, assertInboundMessageIntegrity(response, []byte(a.localPwd)))
+		assert.Nil(t, a.getSelectedPair())
+
+		// Accepted once the host pair failed
+		a.findPair(local, host).state = CandidatePairStateFailed
+		response = nominate()
+		assert.Equal(t, stun.BindingSuccess, response.Type)
+		assert.Equal(t, relayPair, a.getSelectedPair())
+	})
+}
@@ -0,0 +1,141 @@
+package ice
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pion/logging"
+)
+
+// P2PDialer connects to peers through NAT, for programs that only need a
+// connection to a peer and a way to reach it: a rendezvous returning a
+// Signaler, e.g. over a WebSocket to a server both peers are connected to.
+// The Conn it returns preserves the boundaries of the messages written, like
+// a connected UDP socket.
+type P2PDialer struct {
+	// Config configures the agent of each connection, nil uses the defaults
+	Config *AgentConfig
+
+	// Rendezvous returns the Signaler reaching peer, with which the
+	// credentials and candidates of the connection are exchanged. peer is
+	// opaque to the dialer.
+	Rendezvous func(ctx context.Context, peer string) (Signaler, error)
+}
+
+// Dial connects to peer, acting as the controlling agent. The peer accepts
+// the connection with a P2PListener, or with Connect as the controlled agent.
+func (d *P2PDialer) Dial(ctx context.Context, peer string) (*Conn, error) {
+	signaler, err := d.Rendezvous(ctx, peer)
+	if err != nil {
+		return nil, err
+	}
+	return Connect(ctx, p2pConfig(d.Config), Controlling, signaler)
+}
+
+// P2PListener accepts connections from the peers dialing it with a
+// P2PDialer.
+type P2PListener struct {
+	accepted chan *Conn
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	log      logging.LeveledLogger
+
+	mu  sync.Mutex
+	err error
+}
+
+// ListenP2P returns a P2PListener accepting a connection for every Signaler
+// returned by rendezvous, which blocks until a peer dials. The connections
+// are established concurrently, each with an agent configured by config. If
+// rendezvous fails the listener stops and Accept returns its error.
+func ListenP2P(config *AgentConfig, rendezvous func(ctx context.Context) (Signaler, error)) *P2PListener {
+	config = p2pConfig(config)
+	loggerFactory := config.LoggerFactory
+	if loggerFactory == nil {
+		loggerFactory = logging.NewDefaultLoggerFactory()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &P2PListener{
+		accepted: make(chan *Conn),
+		ctx:      ctx,
+		cancel:   cancel,
+		log:      loggerFactory.NewLogger("ice"),
+	}
+
+	l.wg.Add(1)
+	go l.serve(config, rendezvous)
+	return l
+}
+
+func (l *P2PListener) serve(config *AgentConfig, rendezvous func(ctx context.Context) (Signaler, error)) {
+	defer l.wg.Done()
+
+	for {
+		signaler, err := rendezvous(l.ctx)
+		if err != nil {
+			l.stop(err)
+			return
+		}
+
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+
+			conn, err := Connect(l.ctx, config, Controlled, signaler)
+			if err != nil {
+				if l.ctx.Err() == nil {
+					l.log.Warnf("Failed to accept connection: %v", err)
+				}
+				return
+			}
+			select {
+			case l.accepted <- conn:
+			case <-l.ctx.Done():
+				if err := conn.Close(); err != nil {
+					l.log.Warnf("Failed to close connection: %v", err)
+				}
+			}
+		}()
+	}
+}
+
+// Accept waits for the next connection. It returns ErrP2PListenerClosed once
+// the listener is closed.
+func (l *P2PListener) Accept() (*Conn, error) {
+	select {
+	case conn := <-l.accepted:
+		return conn, nil
+	case <-l.ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return nil, l.err
+	}
+}
+
+// Close stops accepting connections, the connections being established are
+// abandoned. The accepted connections are left to the caller.
+func (l *P2PListener) Close() error {
+	l.stop(ErrP2PListenerClosed)
+	l.wg.Wait()
+	return nil
+}
+
+// stop cancels the listener, Accept returns err from then on unless it was
+// already stopped.
+func (l *P2PListener) stop(err error) {
+	l.mu.Lock()
+	if l.err == nil {
+		l.err = err
+	}
+	l.mu.Unlock()
+	l.cancel()
+}
+
+func p2pConfig(config *AgentConfig) *AgentConfig {
+	if config == nil {
+		return &AgentConfig{}
+	}
+	return config
+}
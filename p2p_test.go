@@ -0,0 +1,92 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestP2P(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	config := &AgentConfig{NetworkTypes: supportedNetworkTypes()}
+
+	// The rendezvous server hands the peer its end of the signaling
+	peers := make(chan Signaler, 1)
+	listener := ListenP2P(config, func(ctx context.Context) (Signaler, error) {
+		select {
+		case s := <-peers:
+			return s, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+
+	dialer := &P2PDialer{
+		Config: config,
+		Rendezvous: func(ctx context.Context, peer string) (Signaler, error) {
+			assert.Equal(t, "listener", peer)
+			a, b := newChanSignalers()
+			peers <- b
+			return a, nil
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dialed := make(chan *Conn)
+	go func() {
+		conn, err := dialer.Dial(ctx, "listener")
+		assert.NoError(t, err)
+		dialed <- conn
+	}()
+
+	accepted, err := listener.Accept()
+	require.NoError(t, err)
+	conn := <-dialed
+	require.NotNil(t, conn)
+
+	msg := []byte("ping")
+	_, err = conn.Write(msg)
+	require.NoError(t, err)
+	buf := make([]byte, len(msg))
+	_, err = accepted.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, msg, buf)
+
+	assert.NoError(t, listener.Close())
+	_, err = listener.Accept()
+	assert.ErrorIs(t, err, ErrP2PListenerClosed)
+
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, accepted.Close())
+}
+
+func TestP2PListenerRendezvousError(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	errRendezvous := errors.New("rendezvous server unreachable")
+	listener := ListenP2P(nil, func(context.Context) (Signaler, error) {
+		return nil, errRendezvous
+	})
+
+	_, err := listener.Accept()
+	assert.ErrorIs(t, err, errRendezvous)
+	assert.NoError(t, listener.Close())
+	_, err = listener.Accept()
+	assert.ErrorIs(t, err, errRendezvous)
+}
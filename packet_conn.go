@@ -0,0 +1,102 @@
+package ice
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// PacketConnAddr is the address of an agent, or of its peer, in a
+// PacketConn: its username fragment when the PacketConn was created. Unlike
+// the addresses of the selected candidate pair it does not change when the
+// agent switches to another pair.
+type PacketConnAddr struct {
+	Ufrag string
+}
+
+// Network returns "ice".
+func (a *PacketConnAddr) Network() string {
+	return "ice"
+}
+
+func (a *PacketConnAddr) String() string {
+	return a.Ufrag
+}
+
+// PacketConn is the connection of an agent as a net.PacketConn, for
+// protocols running over a packet socket such as QUIC. Each read returns one
+// packet of the peer, each write sends one packet over the selected
+// candidate pair.
+//
+// Its addresses are PacketConnAddrs that stay the same for its lifetime, so
+// that a QUIC stack does not see a migration when ICE selects another pair.
+// ECN and other ancillary data are not supported yet. The packets of the
+// peer are demultiplexed from the STUN traffic of the agent, away from the
+// socket, and no control messages travel with them in either direction.
+// PacketConn does not implement SyscallConn nor ReadMsgUDP, so quic-go falls
+// back to ReadFrom and WriteTo without ECN rather than setting options on a
+// socket it does not own.
+type PacketConn struct {
+	conn       *Conn
+	localAddr  *PacketConnAddr
+	remoteAddr *PacketConnAddr
+}
+
+// PacketConn returns the connection of the agent as a PacketConn. It should
+// be called once Dial or Accept returned, the addresses of the PacketConn
+// are the local and remote username fragments then. Closing it closes the
+// agent.
+func (a *Agent) PacketConn() (*PacketConn, error) {
+	c := &PacketConn{conn: &Conn{agent: a}}
+	if err := a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		c.localAddr = &PacketConnAddr{Ufrag: agent.localUfrag}
+		c.remoteAddr = &PacketConnAddr{Ufrag: agent.remoteUfrag}
+	}); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ReadFrom reads a packet of the peer, its address is always RemoteAddr.
+func (c *PacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, err := c.conn.Read(p)
+	if err != nil {
+		return n, nil, err
+	}
+	return n, c.remoteAddr, nil
+}
+
+// WriteTo sends p to the peer, addr is ignored.
+func (c *PacketConn) WriteTo(p []byte, _ net.Addr) (int, error) {
+	return c.conn.Write(p)
+}
+
+// Close closes the agent.
+func (c *PacketConn) Close() error {
+	return c.conn.Close()
+}
+
+// LocalAddr returns the address of the agent.
+func (c *PacketConn) LocalAddr() net.Addr {
+	return c.localAddr
+}
+
+// RemoteAddr returns the address of the peer, for a QUIC client to dial.
+func (c *PacketConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// SetDeadline sets the read deadline, writes do not block.
+func (c *PacketConn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline shared with the Conn of the agent.
+func (c *PacketConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline is a stub, writes do not block.
+func (c *PacketConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
@@ -0,0 +1,78 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacketConn(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	aConn, bConn := pipe(nil)
+	a, err := aConn.agent.PacketConn()
+	require.NoError(t, err)
+	b, err := bConn.agent.PacketConn()
+	require.NoError(t, err)
+
+	// The addresses are the credentials of the agents, not those of the
+	// selected pair
+	aUfrag, _, err := aConn.agent.GetLocalUserCredentials()
+	require.NoError(t, err)
+	assert.Equal(t, "ice", a.LocalAddr().Network())
+	assert.Equal(t, aUfrag, a.LocalAddr().String())
+	assert.Equal(t, a.LocalAddr(), b.RemoteAddr())
+	assert.Equal(t, b.LocalAddr(), a.RemoteAddr())
+
+	msg := []byte("datagram")
+	_, err = a.WriteTo(msg, a.RemoteAddr())
+	require.NoError(t, err)
+	buf := make([]byte, 64)
+	n, addr, err := b.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, msg, buf[:n])
+	assert.Equal(t, b.RemoteAddr(), addr)
+
+	require.NoError(t, b.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, _, err = b.ReadFrom(buf)
+	var netErr net.Error
+	require.ErrorAs(t, err, &netErr)
+	assert.True(t, netErr.Timeout())
+
+	assert.NoError(t, a.Close())
+	assert.NoError(t, b.Close())
+}
+
+// A QUIC stack takes the PacketConn of a connected agent in place of a UDP
+// socket, e.g. quic.Dial(ctx, conn, conn.RemoteAddr(), tlsConfig, nil) with
+// quic-go.
+func ExampleAgent_PacketConn() {
+	agent, err := NewAgent(&AgentConfig{NetworkTypes: []NetworkType{NetworkTypeUDP4}})
+	if err != nil {
+		panic(err)
+	}
+
+	// Exchange the candidates and credentials, then Dial or Accept
+
+	conn, err := agent.PacketConn()
+	if err != nil {
+		panic(err)
+	}
+	defer conn.Close() //nolint:errcheck
+
+	var _ net.PacketConn = conn
+	fmt.Println(conn.LocalAddr().Network())
+	// Output: ice
+}
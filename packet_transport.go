@@ -0,0 +1,79 @@
+package ice
+
+import (
+	"net"
+
+	"github.com/pion/transport/vnet"
+)
+
+// PacketTransport is the datagram network an agent runs over, in place of
+// the UDP sockets of the system: e.g. an in-memory pipe, a DTLS tunnel or a
+// userspace network stack, for programs embedded where there is no socket
+// API. The agent gathers its host candidates on the addresses of the
+// transport, and opens the sockets of its candidates, of its STUN queries
+// and of its TURN allocations over UDP with it.
+//
+// The agent does not use the network of the system over a PacketTransport,
+// except for what is configured explicitly: a TCPMux or UDPMux, TURN servers
+// over TCP, TLS or DTLS, and mDNS, which is best disabled. Active TCP
+// candidates are not gathered and InterfaceFilter does not apply, the
+// transport only returns the addresses it wants candidates gathered on.
+type PacketTransport interface {
+	// LocalAddrs returns the addresses host candidates are gathered on.
+	LocalAddrs() ([]net.IP, error)
+
+	// ListenPacket opens a socket bound to laddr for network, "udp4" or
+	// "udp6". The IP of laddr is unspecified when any address will do, its
+	// port 0 when any port will.
+	ListenPacket(network string, laddr *net.UDPAddr) (net.PacketConn, error)
+
+	// ResolveUDPAddr resolves the address of a STUN or TURN server.
+	ResolveUDPAddr(network, address string) (*net.UDPAddr, error)
+}
+
+// netTransport is the PacketTransport over the sockets of the system, or
+// over the virtual network of AgentConfig.Net.
+type netTransport struct {
+	net             *vnet.Net
+	interfaceFilter func(string) bool
+}
+
+func (t *netTransport) LocalAddrs() ([]net.IP, error) {
+	return localInterfaces(t.net, t.interfaceFilter, supportedNetworkTypes())
+}
+
+func (t *netTransport) ListenPacket(network string, laddr *net.UDPAddr) (net.PacketConn, error) {
+	return t.net.ListenUDP(network, laddr)
+}
+
+func (t *netTransport) ResolveUDPAddr(network, address string) (*net.UDPAddr, error) {
+	return t.net.ResolveUDPAddr(network, address)
+}
+
+// customTransport reports whether the agent runs over the PacketTransport
+// of AgentConfig.Transport rather than over a network.
+func (a *Agent) customTransport() bool {
+	_, ok := a.transport.(*netTransport)
+	return !ok
+}
+
+// localIPs returns the local addresses of networkTypes to gather host
+// candidates on.
+func (a *Agent) localIPs(networkTypes []NetworkType) ([]net.IP, error) {
+	if t, ok := a.transport.(*netTransport); ok {
+		return localInterfaces(t.net, a.getInterfaceFilter(), networkTypes)
+	}
+
+	addrs, err := a.transport.LocalAddrs()
+	if err != nil {
+		return nil, err
+	}
+	ipv4, ipv6 := networkFamilies(networkTypes)
+	ips := []net.IP{}
+	for _, ip := range addrs {
+		if isGatheredIP(ip, ipv4, ipv6) {
+			ips = append(ips, ip)
+		}
+	}
+	return ips, nil
+}
@@ -0,0 +1,142 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// memNetwork delivers datagrams between the memTransports of its hosts in
+// memory.
+type memNetwork struct {
+	mu       sync.Mutex
+	conns    map[string]*memConn
+	nextPort int
+}
+
+type memPacket struct {
+	payload []byte
+	from    net.Addr
+}
+
+type memConn struct {
+	network *memNetwork
+	addr    *net.UDPAddr
+	in      chan memPacket
+	done    chan struct{}
+	once    sync.Once
+}
+
+func (c *memConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	select {
+	case packet := <-c.in:
+		return copy(p, packet.payload), packet.from, nil
+	case <-c.done:
+		return 0, nil, io.EOF
+	}
+}
+
+func (c *memConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	c.network.mu.Lock()
+	dst := c.network.conns[addr.String()]
+	c.network.mu.Unlock()
+	if dst != nil {
+		select {
+		case dst.in <- memPacket{append([]byte(nil), p...), c.addr}:
+		default: // Dropped, like a full socket buffer
+		}
+	}
+	return len(p), nil
+}
+
+func (c *memConn) Close() error {
+	c.once.Do(func() {
+		c.network.mu.Lock()
+		delete(c.network.conns, c.addr.String())
+		c.network.mu.Unlock()
+		close(c.done)
+	})
+	return nil
+}
+
+func (c *memConn) LocalAddr() net.Addr                { return c.addr }
+func (c *memConn) SetDeadline(t time.Time) error      { return nil }
+func (c *memConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *memConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// memTransport is the PacketTransport of the host with ip on a memNetwork.
+type memTransport struct {
+	network *memNetwork
+	ip      net.IP
+}
+
+func (t *memTransport) LocalAddrs() ([]net.IP, error) {
+	return []net.IP{t.ip}, nil
+}
+
+func (t *memTransport) ListenPacket(network string, laddr *net.UDPAddr) (net.PacketConn, error) {
+	t.network.mu.Lock()
+	defer t.network.mu.Unlock()
+
+	addr := &net.UDPAddr{IP: t.ip, Port: laddr.Port}
+	if addr.Port == 0 {
+		t.network.nextPort++
+		addr.Port = 10000 + t.network.nextPort
+	}
+	if _, ok := t.network.conns[addr.String()]; ok {
+		return nil, ErrPort
+	}
+	c := &memConn{network: t.network, addr: addr, in: make(chan memPacket, 64), done: make(chan struct{})}
+	t.network.conns[addr.String()] = c
+	return c, nil
+}
+
+func (t *memTransport) ResolveUDPAddr(network, address string) (*net.UDPAddr, error) {
+	return net.ResolveUDPAddr(network, address)
+}
+
+func TestPacketTransport(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	network := &memNetwork{conns: map[string]*memConn{}}
+	newAgent := func(ip string) *Agent {
+		agent, err := NewAgent(&AgentConfig{
+			NetworkTypes:     []NetworkType{NetworkTypeUDP4},
+			MulticastDNSMode: MulticastDNSModeDisabled,
+			Transport:        &memTransport{network: network, ip: net.ParseIP(ip)},
+		})
+		assert.NoError(t, err)
+		return agent
+	}
+	aAgent, bAgent := newAgent("10.0.0.1"), newAgent("10.0.0.2")
+
+	aConn, bConn := connect(aAgent, bAgent)
+
+	pair, err := aAgent.GetSelectedCandidatePair()
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.1", pair.Local.Address())
+	assert.Equal(t, "10.0.0.2", pair.Remote.Address())
+
+	msg := []byte("over the packet transport")
+	_, err = aConn.Write(msg)
+	assert.NoError(t, err)
+	buf := make([]byte, len(msg))
+	_, err = bConn.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, msg, buf)
+
+	assert.NoError(t, aConn.Close())
+	assert.NoError(t, bConn.Close())
+}
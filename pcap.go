@@ -0,0 +1,199 @@
+package ice
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/logging"
+)
+
+// pcapng block types and constants, see
+// https://datatracker.ietf.org/doc/html/draft-ietf-opsawg-pcapng
+const (
+	pcapngBlockTypeSHB    = 0x0A0D0D0A
+	pcapngBlockTypeIDB    = 0x00000001
+	pcapngBlockTypeEPB    = 0x00000006
+	pcapngByteOrderMagic  = 0x1A2B3C4D
+	pcapngLinkTypeRaw     = 101 // LINKTYPE_RAW, packets begin with an IPv4 or IPv6 header
+	pcapngEPBHeaderLength = 28
+	pcapngBlockTrailerLen = 4
+
+	ipv4HeaderLength = 20
+	ipv6HeaderLength = 40
+	udpHeaderLength  = 8
+	ipProtocolUDP    = 17
+	ipDefaultTTL     = 64
+)
+
+// packetCapture writes every packet it is given to a pcapng stream. Since the
+// agent only sees payloads (after UDPMux demultiplexing, TCP de-framing or TURN
+// decapsulation), each packet is prefixed with a synthetic IP and UDP header
+// built from the addresses of the socket it traversed.
+type packetCapture struct {
+	mu            sync.Mutex
+	w             io.Writer
+	log           logging.LeveledLogger
+	headerWritten bool
+	failed        bool
+}
+
+func newPacketCapture(w io.Writer, log logging.LeveledLogger) *packetCapture {
+	return &packetCapture{w: w, log: log}
+}
+
+func (p *packetCapture) writePacket(src, dst net.Addr, payload []byte) {
+	srcIP, srcPort, _, srcOk := parseAddr(src)
+	dstIP, dstPort, _, dstOk := parseAddr(dst)
+	if !srcOk || !dstOk {
+		return
+	}
+
+	packet := buildSyntheticUDPPacket(srcIP, srcPort, dstIP, dstPort, payload)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.failed {
+		return
+	}
+
+	if !p.headerWritten {
+		if err := p.write(pcapngHeader()); err != nil {
+			return
+		}
+		p.headerWritten = true
+	}
+
+	_ = p.write(pcapngEnhancedPacketBlock(time.Now(), packet))
+}
+
+func (p *packetCapture) write(b []byte) error {
+	if _, err := p.w.Write(b); err != nil {
+		// A broken capture must not affect the agent, stop capturing instead
+		p.log.Warnf("Failed to write packet capture, disabling it: %v", err)
+		p.failed = true
+		return err
+	}
+	return nil
+}
+
+// pcapngHeader returns a Section Header Block followed by the single Interface
+// Description Block all packets are recorded on.
+func pcapngHeader() []byte {
+	shb := make([]byte, 28)
+	binary.LittleEndian.PutUint32(shb[0:], pcapngBlockTypeSHB)
+	binary.LittleEndian.PutUint32(shb[4:], uint32(len(shb)))
+	binary.LittleEndian.PutUint32(shb[8:], pcapngByteOrderMagic)
+	binary.LittleEndian.PutUint16(shb[12:], 1) // major version
+	binary.LittleEndian.PutUint16(shb[14:], 0) // minor version
+	binary.LittleEndian.PutUint64(shb[16:], 0xFFFFFFFFFFFFFFFF)
+	binary.LittleEndian.PutUint32(shb[24:], uint32(len(shb)))
+
+	idb := make([]byte, 20)
+	binary.LittleEndian.PutUint32(idb[0:], pcapngBlockTypeIDB)
+	binary.LittleEndian.PutUint32(idb[4:], uint32(len(idb)))
+	binary.LittleEndian.PutUint16(idb[8:], pcapngLinkTypeRaw)
+	binary.LittleEndian.PutUint32(idb[12:], 0) // no snap length
+	binary.LittleEndian.PutUint32(idb[16:], uint32(len(idb)))
+
+	return append(shb, idb...)
+}
+
+func pcapngEnhancedPacketBlock(ts time.Time, packet []byte) []byte {
+	padded := (len(packet) + 3) &^ 3
+	total := pcapngEPBHeaderLength + padded + pcapngBlockTrailerLen
+	micros := uint64(ts.UnixNano() / int64(time.Microsecond))
+
+	b := make([]byte, total)
+	binary.LittleEndian.PutUint32(b[0:], pcapngBlockTypeEPB)
+	binary.LittleEndian.PutUint32(b[4:], uint32(total))
+	binary.LittleEndian.PutUint32(b[8:], 0) // interface ID
+	binary.LittleEndian.PutUint32(b[12:], uint32(micros>>32))
+	binary.LittleEndian.PutUint32(b[16:], uint32(micros))
+	binary.LittleEndian.PutUint32(b[20:], uint32(len(packet)))
+	binary.LittleEndian.PutUint32(b[24:], uint32(len(packet)))
+	copy(b[pcapngEPBHeaderLength:], packet)
+	binary.LittleEndian.PutUint32(b[total-pcapngBlockTrailerLen:], uint32(total))
+
+	return b
+}
+
+// buildSyntheticUDPPacket wraps payload in an IPv4 (or IPv6, if either address
+// is not IPv4) and UDP header. The UDP checksum is left zero.
+func buildSyntheticUDPPacket(srcIP net.IP, srcPort int, dstIP net.IP, dstPort int, payload []byte) []byte {
+	udpLength := udpHeaderLength + len(payload)
+
+	var packet []byte
+	var udpOffset int
+	if src4, dst4 := srcIP.To4(), dstIP.To4(); src4 != nil && dst4 != nil {
+		packet = make([]byte, ipv4HeaderLength+udpLength)
+		packet[0] = 0x45 // version 4, 5 words header
+		binary.BigEndian.PutUint16(packet[2:], uint16(len(packet)))
+		packet[8] = ipDefaultTTL
+		packet[9] = ipProtocolUDP
+		copy(packet[12:16], src4)
+		copy(packet[16:20], dst4)
+		binary.BigEndian.PutUint16(packet[10:], ipv4Checksum(packet[:ipv4HeaderLength]))
+		udpOffset = ipv4HeaderLength
+	} else {
+		packet = make([]byte, ipv6HeaderLength+udpLength)
+		packet[0] = 0x60 // version 6
+		binary.BigEndian.PutUint16(packet[4:], uint16(udpLength))
+		packet[6] = ipProtocolUDP
+		packet[7] = ipDefaultTTL
+		copy(packet[8:24], srcIP.To16())
+		copy(packet[24:40], dstIP.To16())
+		udpOffset = ipv6HeaderLength
+	}
+
+	binary.BigEndian.PutUint16(packet[udpOffset:], uint16(srcPort))
+	binary.BigEndian.PutUint16(packet[udpOffset+2:], uint16(dstPort))
+	binary.BigEndian.PutUint16(packet[udpOffset+4:], uint16(udpLength))
+	copy(packet[udpOffset+udpHeaderLength:], payload)
+
+	return packet
+}
+
+func ipv4Checksum(header []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(header); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(header[i:]))
+	}
+	for sum > 0xFFFF {
+		sum = (sum >> 16) + (sum & 0xFFFF)
+	}
+	return ^uint16(sum)
+}
+
+// captureConn is a net.PacketConn that records all traffic passing through it.
+type captureConn struct {
+	net.PacketConn
+	capture *packetCapture
+}
+
+func (c *captureConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	if err == nil {
+		c.capture.writePacket(addr, c.LocalAddr(), p[:n])
+	}
+	return n, addr, err
+}
+
+func (c *captureConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	n, err := c.PacketConn.WriteTo(p, addr)
+	if err == nil {
+		c.capture.writePacket(c.LocalAddr(), addr, p)
+	}
+	return n, err
+}
+
+// captureConn wraps conn so its traffic is recorded, if packet capture is enabled.
+func (a *Agent) captureConn(conn net.PacketConn) net.PacketConn {
+	if a.packetCapture == nil || conn == nil {
+		return conn
+	}
+	return &captureConn{PacketConn: conn, capture: a.packetCapture}
+}
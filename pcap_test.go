@@ -0,0 +1,99 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/pion/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+type errWriter struct {
+	writes int
+}
+
+func (e *errWriter) Write(p []byte) (int, error) {
+	e.writes++
+	return 0, errors.New("write failed") //nolint:goerr113
+}
+
+func TestPacketCapture(t *testing.T) {
+	log := logging.NewDefaultLoggerFactory().NewLogger("ice")
+
+	t.Run("IPv4", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		capture := newPacketCapture(buf, log)
+
+		payload := []byte{0x01, 0x02, 0x03}
+		capture.writePacket(
+			&net.UDPAddr{IP: net.ParseIP("192.168.0.1"), Port: 5000},
+			&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 6000},
+			payload,
+		)
+
+		b := buf.Bytes()
+		assert.Equal(t, uint32(pcapngBlockTypeSHB), binary.LittleEndian.Uint32(b[0:]))
+		assert.Equal(t, uint32(pcapngByteOrderMagic), binary.LittleEndian.Uint32(b[8:]))
+		assert.Equal(t, uint32(pcapngBlockTypeIDB), binary.LittleEndian.Uint32(b[28:]))
+		assert.Equal(t, uint16(pcapngLinkTypeRaw), binary.LittleEndian.Uint16(b[36:]))
+
+		epb := b[48:]
+		assert.Equal(t, uint32(pcapngBlockTypeEPB), binary.LittleEndian.Uint32(epb[0:]))
+		assert.Equal(t, uint32(len(epb)), binary.LittleEndian.Uint32(epb[4:]))
+		assert.Equal(t, 0, len(epb)%4)
+
+		packetLen := binary.LittleEndian.Uint32(epb[20:])
+		assert.Equal(t, uint32(ipv4HeaderLength+udpHeaderLength+len(payload)), packetLen)
+
+		packet := epb[pcapngEPBHeaderLength : pcapngEPBHeaderLength+packetLen]
+		assert.Equal(t, byte(0x45), packet[0])
+		assert.Equal(t, byte(ipProtocolUDP), packet[9])
+		assert.Equal(t, uint16(0), ipv4Checksum(packet[:ipv4HeaderLength]))
+		assert.Equal(t, net.ParseIP("192.168.0.1").To4(), net.IP(packet[12:16]))
+		assert.Equal(t, net.ParseIP("10.0.0.1").To4(), net.IP(packet[16:20]))
+		assert.Equal(t, uint16(5000), binary.BigEndian.Uint16(packet[20:]))
+		assert.Equal(t, uint16(6000), binary.BigEndian.Uint16(packet[22:]))
+		assert.Equal(t, payload, packet[ipv4HeaderLength+udpHeaderLength:])
+
+		// Header is only written once
+		capture.writePacket(
+			&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 6000},
+			&net.UDPAddr{IP: net.ParseIP("192.168.0.1"), Port: 5000},
+			payload,
+		)
+		assert.Equal(t, uint32(pcapngBlockTypeEPB), binary.LittleEndian.Uint32(buf.Bytes()[len(b):]))
+	})
+
+	t.Run("IPv6", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		capture := newPacketCapture(buf, log)
+
+		capture.writePacket(
+			&net.TCPAddr{IP: net.ParseIP("fe80::1"), Port: 5000},
+			&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 6000},
+			[]byte{0x01},
+		)
+
+		packet := buf.Bytes()[48+pcapngEPBHeaderLength:]
+		assert.Equal(t, byte(0x60), packet[0])
+		assert.Equal(t, byte(ipProtocolUDP), packet[6])
+		assert.Equal(t, net.ParseIP("fe80::1"), net.IP(packet[8:24]))
+		assert.Equal(t, net.ParseIP("10.0.0.1").To16(), net.IP(packet[24:40]))
+	})
+
+	t.Run("WriteError", func(t *testing.T) {
+		w := &errWriter{}
+		capture := newPacketCapture(w, log)
+
+		src := &net.UDPAddr{IP: net.ParseIP("192.168.0.1"), Port: 5000}
+		capture.writePacket(src, src, []byte{0x01})
+		capture.writePacket(src, src, []byte{0x01})
+		assert.Equal(t, 1, w.writes)
+	})
+}
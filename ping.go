@@ -0,0 +1,105 @@
+package ice
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pion/stun"
+)
+
+// pendingPing is a binding request sent by PingCandidatePair.
+type pendingPing struct {
+	sent   time.Time
+	result chan pingResult
+	timer  Timer
+}
+
+type pingResult struct {
+	rtt time.Duration
+	err error
+}
+
+// PingCandidatePair sends a binding request on the pair of local and remote
+// candidates right away, outside of the schedule of the connectivity checks
+// and keepalives, and returns its round trip time. The pair must be in the
+// checklist of the agent. A success response also counts as a connectivity
+// check of the pair.
+func (a *Agent) PingCandidatePair(local, remote Candidate) (time.Duration, error) {
+	result := make(chan pingResult, 1)
+	var pingErr error
+	if err := a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		p := agent.findPair(local, remote)
+		if p == nil {
+			pingErr = fmt.Errorf("%w: %s <-> %s", ErrCandidatePairNotFound, local, remote)
+			return
+		}
+
+		msg, err := agent.buildPairBindingRequest(p, agent.isControlling)
+		if err != nil {
+			pingErr = err
+			return
+		}
+
+		id := msg.TransactionID
+		if agent.pendingPings == nil {
+			agent.pendingPings = map[[stun.TransactionIDSize]byte]*pendingPing{}
+		}
+		agent.pendingPings[id] = &pendingPing{
+			sent:   agent.clock.Now(),
+			result: result,
+			timer: agent.clock.AfterFunc(maxBindingRequestTimeout, func() {
+				_ = agent.run(agent.context(), func(ctx context.Context, agent *Agent) {
+					agent.completePing(id, pingResult{err: ErrPingTimeout})
+				})
+			}),
+		}
+		agent.sendBindingRequest(msg, p.Local, p.Remote)
+	}); err != nil {
+		return 0, err
+	}
+	if pingErr != nil {
+		return 0, pingErr
+	}
+
+	select {
+	case r := <-result:
+		return r.rtt, r.err
+	case <-a.done:
+		return 0, a.getErr()
+	}
+}
+
+// handlePingResponse completes the ping m answers, if it answers one.
+//
+// Note: the caller should hold the agent lock.
+func (a *Agent) handlePingResponse(m *stun.Message) {
+	ping, ok := a.pendingPings[m.TransactionID]
+	if !ok {
+		return
+	}
+
+	r := pingResult{rtt: a.clock.Now().Sub(ping.sent)}
+	if m.Type.Class == stun.ClassErrorResponse {
+		var errorCode stun.ErrorCodeAttribute
+		if err := errorCode.GetFrom(m); err != nil {
+			r.err = fmt.Errorf("%w: %v", ErrBindingErrorResponse, err)
+		} else {
+			r.err = fmt.Errorf("%w: %s", ErrBindingErrorResponse, errorCode)
+		}
+	}
+	a.completePing(m.TransactionID, r)
+}
+
+// completePing delivers the result of a ping, if it is still pending.
+//
+// Note: the caller should hold the agent lock.
+func (a *Agent) completePing(id [stun.TransactionIDSize]byte, r pingResult) {
+	ping, ok := a.pendingPings[id]
+	if !ok {
+		return
+	}
+	delete(a.pendingPings, id)
+	ping.timer.Stop()
+	ping.result <- r
+}
@@ -0,0 +1,162 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/stun"
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPingCandidatePair(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	ca, cb := pipe(&AgentConfig{NetworkTypes: []NetworkType{NetworkTypeUDP4}})
+	defer func() {
+		assert.NoError(t, ca.Close())
+		assert.NoError(t, cb.Close())
+	}()
+
+	for _, a := range []*Agent{ca.agent, cb.agent} {
+		pair, err := a.GetSelectedCandidatePair()
+		require.NoError(t, err)
+		require.NotNil(t, pair)
+
+		rtt, err := a.PingCandidatePair(pair.Local, pair.Remote)
+		require.NoError(t, err)
+		assert.Greater(t, int64(rtt), int64(0))
+
+		_, err = a.PingCandidatePair(pair.Remote, pair.Local)
+		assert.ErrorIs(t, err, ErrCandidatePairNotFound)
+	}
+}
+
+func TestPingCandidatePairTimeout(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	clock := NewManualClock(time.Now())
+	a, err := NewAgent(&AgentConfig{Clock: clock})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	// Nothing answers on the remote socket
+	localConn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, localConn.Close())
+	}()
+	remoteConn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, remoteConn.Close())
+	}()
+
+	local, err := NewCandidateHost(&CandidateHostConfig{
+		Network:   "udp",
+		Address:   "127.0.0.1",
+		Port:      localConn.LocalAddr().(*net.UDPAddr).Port, //nolint:forcetypeassert
+		Component: 1,
+	})
+	require.NoError(t, err)
+	local.conn = localConn
+	remote, err := NewCandidateHost(&CandidateHostConfig{
+		Network:   "udp",
+		Address:   "127.0.0.1",
+		Port:      remoteConn.LocalAddr().(*net.UDPAddr).Port, //nolint:forcetypeassert
+		Component: 1,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+		agent.localCandidates[NetworkTypeUDP4] = []Candidate{local}
+		agent.remoteCandidates[NetworkTypeUDP4] = []Candidate{remote}
+		agent.addPair(local, remote)
+	}))
+
+	pingErr := make(chan error, 1)
+	go func() {
+		_, err := a.PingCandidatePair(local, remote)
+		pingErr <- err
+	}()
+
+	// The ping is pending once its request is sent
+	buf := make([]byte, receiveMTU)
+	require.NoError(t, remoteConn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, _, err = remoteConn.ReadFrom(buf)
+	require.NoError(t, err)
+
+	clock.Advance(maxBindingRequestTimeout)
+	assert.ErrorIs(t, <-pingErr, ErrPingTimeout)
+}
+
+func TestPingCandidatePairErrorResponse(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 10)
+	defer lim.Stop()
+
+	a, err := NewAgent(&AgentConfig{})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	local := newInboundLocal(t, nil)
+	remote := newInboundRemote(t)
+
+	require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+		agent.selector = &controllingSelector{agent: agent, log: agent.log}
+		agent.localCandidates[NetworkTypeUDP4] = []Candidate{local}
+		agent.addRemoteCandidate(remote)
+		agent.addPair(local, remote)
+	}))
+
+	pingErr := make(chan error, 1)
+	go func() {
+		_, err := a.PingCandidatePair(local, remote)
+		pingErr <- err
+	}()
+
+	var id [stun.TransactionIDSize]byte
+	for id == ([stun.TransactionIDSize]byte{}) {
+		require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+			for pending := range agent.pendingPings {
+				id = pending
+			}
+		}))
+	}
+
+	respond := func(setters ...stun.Setter) {
+		m, err := stun.Build(append([]stun.Setter{stun.NewType(stun.MethodBinding, stun.ClassErrorResponse), stun.NewTransactionIDSetter(id), stun.CodeRoleConflict}, setters...)...)
+		require.NoError(t, err)
+		require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+			agent.handleInbound(m, local, remote.addr())
+		}))
+	}
+
+	// A forged error response does not complete the ping
+	respond(stun.NewShortTermIntegrity("forged"), stun.Fingerprint)
+	select {
+	case err := <-pingErr:
+		t.Fatalf("ping completed by a forged response: %v", err)
+	default:
+	}
+
+	respond(stun.NewShortTermIntegrity(a.remotePwd), stun.Fingerprint)
+	assert.ErrorIs(t, <-pingErr, ErrBindingErrorResponse)
+}
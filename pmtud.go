@@ -0,0 +1,237 @@
+package ice
+
+import (
+	"context"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun"
+)
+
+const (
+	// basePathMTU is the payload size assumed to reach any peer, and the
+	// path MTU until larger probes succeed
+	basePathMTU = 1200
+
+	// defaultMaxPathMTU is the largest UDP payload of an Ethernet frame
+	// over IPv4
+	defaultMaxPathMTU = 1472
+
+	// pathMTUProbeTimeout is how long a probe is waited for, a size is
+	// given up after pathMTUProbeAttempts lost probes
+	pathMTUProbeTimeout  = time.Second
+	pathMTUProbeAttempts = 3
+
+	// stunAttrPadding is the PADDING attribute of RFC 5780, filling probes
+	// to their size
+	stunAttrPadding stun.AttrType = 0x0026
+
+	// stunIntegrityFingerprintSize is the size of the MESSAGE-INTEGRITY and
+	// FINGERPRINT attributes that end a binding request
+	stunIntegrityFingerprintSize = 24 + 8
+)
+
+// pathMTUDiscovery is the search of the path MTU of the selected pair, in
+// the spirit of DPLPMTUD (RFC 8899): binding requests padded to the probed
+// size are sent on the pair, the size is known to pass once one is answered.
+// Sizes are multiples of 4, like STUN messages.
+type pathMTUDiscovery struct {
+	pair *CandidatePair
+
+	// low is the largest size known to pass, high the largest that may
+	low, high int
+
+	probeSize     int
+	attempts      int
+	transactionID [stun.TransactionIDSize]byte
+	timer         Timer
+
+	// restoreDontFragment sets the socket of the pair back to fragmenting
+	// packets, nil once done
+	restoreDontFragment func() error
+}
+
+// GetPathMTU returns the largest packet that can be written on the selected
+// pair, as discovered so far with AgentConfig.PathMTUDiscovery, or 0 if no
+// pair is selected. It starts at 1200 bytes.
+func (a *Agent) GetPathMTU() (int, error) {
+	var mtu int
+	err := a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		mtu = agent.pathMTU
+	})
+	return mtu, err
+}
+
+// OnPathMTUChange sets a handler that is fired when the path MTU of the
+// selected pair changes, see GetPathMTU.
+func (a *Agent) OnPathMTUChange(f func(int)) error {
+	a.onPathMTUChangeHdlr.Store(f)
+	return nil
+}
+
+func (a *Agent) onPathMTUChange(mtu int) {
+	if h, ok := a.onPathMTUChangeHdlr.Load().(func(int)); ok {
+		h(mtu)
+	}
+}
+
+// setPathMTU notifies the handler of OnPathMTUChange if mtu changed.
+//
+// Note: the caller should hold the agent lock.
+func (a *Agent) setPathMTU(mtu int) {
+	if a.pathMTU == mtu {
+		return
+	}
+	a.pathMTU = mtu
+	a.logEvent(logging.LogLevelDebug, "path MTU changed", "mtu", mtu)
+	a.pairHandlers.push(func() {
+		a.onPathMTUChange(mtu)
+	})
+}
+
+// startPathMTUDiscovery starts the discovery on the newly selected pair p,
+// and stops the discovery on the previous one.
+//
+// Note: the caller should hold the agent lock.
+func (a *Agent) startPathMTUDiscovery(p *CandidatePair) {
+	if d := a.pathMTUDiscovery; d != nil {
+		if d.timer != nil {
+			d.timer.Stop()
+		}
+		a.endDontFragment(d)
+	}
+	a.pathMTUDiscovery = nil
+
+	if p == nil {
+		a.setPathMTU(0)
+		return
+	}
+	a.setPathMTU(basePathMTU)
+	if !a.pathMTUDiscoveryEnabled {
+		return
+	}
+
+	// A probe fragmented on its way would pass at any size
+	restore, err := setDontFragment(candidateSocket(p.Local))
+	if err != nil {
+		a.log.Debugf("path MTU discovery not available on %s: %v", p, err)
+		return
+	}
+
+	a.pathMTUDiscovery = &pathMTUDiscovery{
+		pair:                p,
+		low:                 basePathMTU,
+		high:                a.maxPathMTU &^ 3,
+		restoreDontFragment: restore,
+	}
+	a.sendPathMTUProbe()
+}
+
+// endDontFragment sets the socket of the pair of d back to fragmenting the
+// packets sent, as the application's data is not to be dropped for being
+// larger than the path MTU.
+//
+// Note: the caller should hold the agent lock.
+func (a *Agent) endDontFragment(d *pathMTUDiscovery) {
+	if d.restoreDontFragment == nil {
+		return
+	}
+	if err := d.restoreDontFragment(); err != nil {
+		a.log.Debugf("Failed to restore fragmentation on %s: %v", d.pair, err)
+	}
+	d.restoreDontFragment = nil
+}
+
+// sendPathMTUProbe sends the next probe, halfway between the largest size
+// known to pass and the largest that may, until they meet.
+//
+// Note: the caller should hold the agent lock.
+func (a *Agent) sendPathMTUProbe() {
+	d := a.pathMTUDiscovery
+	if d == nil {
+		return
+	}
+	if d.low >= d.high {
+		a.endDontFragment(d)
+		return
+	}
+
+	size := d.low + ((d.high-d.low)/2)&^3
+	if size == d.low {
+		size = d.high
+	}
+	if size != d.probeSize {
+		d.probeSize = size
+		d.attempts = 0
+	}
+	d.attempts++
+
+	m, err := a.buildUnsignedBindingRequest(d.pair.Local, a.isControlling, false)
+	if err != nil {
+		a.log.Warnf("Failed to build path MTU probe: %v", err)
+		return
+	}
+	padding := size - len(m.Raw) - stunAttributeHeaderSize - stunIntegrityFingerprintSize
+	if padding < 0 {
+		padding = 0
+	}
+	m.Add(stunAttrPadding, make([]byte, padding))
+	if m, err = a.signBindingRequest(m); err != nil {
+		a.log.Warnf("Failed to build path MTU probe: %v", err)
+		return
+	}
+
+	d.transactionID = m.TransactionID
+	d.timer = a.clock.AfterFunc(pathMTUProbeTimeout, func() {
+		_ = a.run(a.context(), func(ctx context.Context, agent *Agent) {
+			agent.handlePathMTUProbeTimeout(d)
+		})
+	})
+	a.log.Tracef("path MTU probe of %d bytes on %s", size, d.pair)
+	a.sendSTUN(m, d.pair.Local, d.pair.Remote)
+}
+
+// handlePathMTUProbeTimeout gives up the probed size after
+// pathMTUProbeAttempts lost probes.
+//
+// Note: the caller should hold the agent lock.
+func (a *Agent) handlePathMTUProbeTimeout(d *pathMTUDiscovery) {
+	if a.pathMTUDiscovery != d {
+		return
+	}
+	if d.attempts >= pathMTUProbeAttempts {
+		d.high = d.probeSize - 4
+	}
+	a.sendPathMTUProbe()
+}
+
+// handlePathMTUProbeResponse handles the response m to a probe, and reports
+// whether m was one. A probe answered with a signed error, e.g. by a peer not
+// supporting PADDING, ends the discovery. The integrity of m is checked by
+// the caller.
+//
+// Note: the caller should hold the agent lock.
+func (a *Agent) handlePathMTUProbeResponse(m *stun.Message) bool {
+	d := a.pathMTUDiscovery
+	if d == nil || d.transactionID != m.TransactionID {
+		return false
+	}
+
+	if m.Type.Class == stun.ClassErrorResponse {
+		// Anyone could send an unsigned one, the probe times out instead
+		if !m.Contains(stun.AttrMessageIntegrity) {
+			a.log.Debugf("path MTU probe of %d bytes rejected without integrity, ignored", d.probeSize)
+			return true
+		}
+		d.timer.Stop()
+		a.log.Debugf("path MTU probe of %d bytes rejected, discovery stopped", d.probeSize)
+		d.high = d.low
+		return true
+	}
+	d.timer.Stop()
+
+	d.low = d.probeSize
+	a.setPathMTU(d.low)
+	a.sendPathMTUProbe()
+	return true
+}
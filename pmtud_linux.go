@@ -0,0 +1,64 @@
+package ice
+
+import (
+	"net"
+	"syscall"
+)
+
+// setDontFragment sets IP_PMTUDISC_PROBE (or IPV6_PMTUDISC_PROBE) on the
+// socket: packets are sent with DF set and are not fragmented to the path
+// MTU cached by the kernel, see ip(7). It applies to all the packets sent on
+// the socket until the returned function sets the previous values back.
+func setDontFragment(conn net.PacketConn) (func() error, error) {
+	sc, ok := rawPacketConn(conn).(syscall.Conn)
+	if !ok {
+		return nil, errDontFragmentUnsupported
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	isIPv6 := false
+	if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+		isIPv6 = addr.IP.To4() == nil
+	}
+
+	var previous, previousIPv6 int
+	var sockErr error
+	if err := rc.Control(func(fd uintptr) {
+		if previous, sockErr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER); sockErr != nil {
+			return
+		}
+		if isIPv6 {
+			if previousIPv6, sockErr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_MTU_DISCOVER); sockErr != nil {
+				return
+			}
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_MTU_DISCOVER, syscall.IPV6_PMTUDISC_PROBE)
+			// Dual-stack sockets send to IPv4 peers too
+			_ = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_PROBE)
+		} else {
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_PROBE)
+		}
+	}); err != nil {
+		return nil, err
+	}
+	if sockErr != nil {
+		return nil, sockErr
+	}
+
+	return func() error {
+		var sockErr error
+		if err := rc.Control(func(fd uintptr) {
+			if isIPv6 {
+				sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_MTU_DISCOVER, previousIPv6)
+				_ = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, previous)
+			} else {
+				sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, previous)
+			}
+		}); err != nil {
+			return err
+		}
+		return sockErr
+	}, nil
+}
@@ -0,0 +1,44 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetDontFragment(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, conn.Close())
+	}()
+
+	rc, err := conn.(syscall.Conn).SyscallConn() //nolint:forcetypeassert
+	require.NoError(t, err)
+	mtuDiscover := func() int {
+		var value int
+		require.NoError(t, rc.Control(func(fd uintptr) {
+			value, err = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER)
+		}))
+		require.NoError(t, err)
+		return value
+	}
+	previous := mtuDiscover()
+
+	restore, err := setDontFragment(conn)
+	require.NoError(t, err)
+	assert.Equal(t, syscall.IP_PMTUDISC_PROBE, mtuDiscover())
+
+	// The socket is set back once the discovery is done
+	require.NoError(t, restore())
+	assert.Equal(t, previous, mtuDiscover())
+
+	_, err = setDontFragment(&mockPacketConn{})
+	assert.ErrorIs(t, err, errDontFragmentUnsupported)
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package ice
+
+import "net"
+
+// The DF bit is only set on Linux
+
+func setDontFragment(net.PacketConn) (func() error, error) {
+	return nil, errDontFragmentUnsupported
+}
@@ -0,0 +1,146 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/pion/stun"
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathMTUDiscovery(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 20)
+	defer lim.Stop()
+
+	if runtime.GOOS != "linux" {
+		t.Skip("probes are only sent with DF set on Linux")
+	}
+
+	const pathMTU = 1300
+
+	clock := NewManualClock(time.Now())
+	a, err := NewAgent(&AgentConfig{
+		Clock:            clock,
+		PathMTUDiscovery: true,
+		NetworkTypes:     []NetworkType{NetworkTypeUDP4},
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	var mtus []int
+	mtuChanged := make(chan int, 16)
+	require.NoError(t, a.OnPathMTUChange(func(mtu int) {
+		mtuChanged <- mtu
+	}))
+
+	localConn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	remoteConn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, remoteConn.Close())
+	}()
+
+	local, err := NewCandidateHost(&CandidateHostConfig{
+		Network:   "udp",
+		Address:   "127.0.0.1",
+		Port:      localConn.LocalAddr().(*net.UDPAddr).Port, //nolint:forcetypeassert
+		Component: 1,
+	})
+	require.NoError(t, err)
+	require.NoError(t, a.addCandidate(context.Background(), local, localConn))
+	remoteAddr := remoteConn.LocalAddr().(*net.UDPAddr) //nolint:forcetypeassert
+	remote, err := NewCandidateHost(&CandidateHostConfig{
+		Network:   "udp",
+		Address:   "127.0.0.1",
+		Port:      remoteAddr.Port,
+		Component: 1,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+		agent.remoteUfrag = "remoteufrag"
+		agent.remotePwd = "remotepwdremotepwdremotepwd"
+		agent.startedFn()
+		agent.remoteCandidates[NetworkTypeUDP4] = []Candidate{remote}
+		agent.setSelectedPair(agent.addPair(local, remote))
+	}))
+
+	// The path drops packets larger than pathMTU, the others are answered
+	buf := make([]byte, 2048)
+	for {
+		require.NoError(t, remoteConn.SetReadDeadline(time.Now().Add(500*time.Millisecond)))
+		n, addr, err := remoteConn.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		req := &stun.Message{Raw: append([]byte{}, buf[:n]...)}
+		require.NoError(t, req.Decode())
+		require.True(t, req.Contains(stunAttrPadding))
+		assert.Zero(t, n%4)
+
+		if n > pathMTU {
+			// An unsigned error response does not end the discovery
+			res, err := stun.Build(
+				stun.NewTransactionIDSetter(req.TransactionID),
+				stun.NewType(stun.MethodBinding, stun.ClassErrorResponse),
+				stun.CodeBadRequest,
+				stun.Fingerprint,
+			)
+			require.NoError(t, err)
+			_, err = remoteConn.WriteTo(res.Raw, addr)
+			require.NoError(t, err)
+
+			clock.Advance(pathMTUProbeTimeout)
+			continue
+		}
+		res, err := stun.Build(
+			stun.NewTransactionIDSetter(req.TransactionID),
+			stun.BindingSuccess,
+			&stun.XORMappedAddress{IP: remoteAddr.IP, Port: remoteAddr.Port},
+			stun.NewShortTermIntegrity("remotepwdremotepwdremotepwd"),
+			stun.Fingerprint,
+		)
+		require.NoError(t, err)
+		_, err = remoteConn.WriteTo(res.Raw, addr)
+		require.NoError(t, err)
+	}
+
+	mtu, err := a.GetPathMTU()
+	require.NoError(t, err)
+	assert.Equal(t, pathMTU, mtu)
+
+	// The socket fragments again once the discovery is done
+	require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+		require.NotNil(t, agent.pathMTUDiscovery)
+		assert.Nil(t, agent.pathMTUDiscovery.restoreDontFragment)
+	}))
+
+	for len(mtuChanged) > 0 {
+		mtus = append(mtus, <-mtuChanged)
+	}
+	require.NotEmpty(t, mtus)
+	assert.Equal(t, basePathMTU, mtus[0])
+	assert.Equal(t, pathMTU, mtus[len(mtus)-1])
+	assert.IsIncreasing(t, mtus)
+
+	require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+		agent.setSelectedPair(nil)
+	}))
+	mtu, err = a.GetPathMTU()
+	require.NoError(t, err)
+	assert.Zero(t, mtu)
+}
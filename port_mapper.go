@@ -0,0 +1,30 @@
+package ice
+
+import (
+	"net"
+)
+
+// mapHostAddress returns the address advertised by the host candidate of
+// network bound to ip and port, according to PortMapper. ok is false if the
+// socket is not mapped.
+func (a *Agent) mapHostAddress(network string, ip net.IP, port int) (mappedIP net.IP, mappedPort int, ok bool) {
+	if a.portMapper == nil || a.mDNSMode == MulticastDNSModeQueryAndGather {
+		return nil, 0, false
+	}
+
+	var local net.Addr = &net.UDPAddr{IP: ip, Port: port}
+	if network == tcp {
+		local = &net.TCPAddr{IP: ip, Port: port}
+	}
+	mapped := a.portMapper(network, local)
+	if mapped == nil {
+		return nil, 0, false
+	}
+
+	mappedIP, mappedPort, _, ok = parseAddr(mapped)
+	if !ok || mappedPort == 0 || (mappedIP.To4() == nil) != (ip.To4() == nil) {
+		a.log.Warnf("Ignoring the mapping of %s %s to %s, not an address of the same family", network, local, mapped)
+		return nil, 0, false
+	}
+	return mappedIP, mappedPort, true
+}
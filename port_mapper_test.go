@@ -0,0 +1,74 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPortMapper(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	// Every socket is reachable on a port of the node, as with NodePort
+	var mu sync.Mutex
+	nodePorts := map[int]int{}
+	a, err := NewAgent(&AgentConfig{
+		NetworkTypes:   []NetworkType{NetworkTypeUDP4},
+		CandidateTypes: []CandidateType{CandidateTypeHost},
+		Synchronous:    true,
+		PortMapper: func(network string, local net.Addr) net.Addr {
+			assert.Equal(t, udp, network)
+			udpAddr, ok := local.(*net.UDPAddr)
+			require.True(t, ok)
+
+			mu.Lock()
+			defer mu.Unlock()
+			nodePorts[udpAddr.Port] = 30000 + len(nodePorts)
+			return &net.UDPAddr{IP: net.IPv4(203, 0, 113, 10), Port: nodePorts[udpAddr.Port]}
+		},
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	var candidates []Candidate
+	require.NoError(t, a.OnCandidate(func(c Candidate) {
+		if c != nil {
+			candidates = append(candidates, c)
+		}
+	}))
+	require.NoError(t, a.GatherCandidates())
+
+	require.NotEmpty(t, candidates)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, nodePorts, len(candidates))
+	for _, c := range candidates {
+		assert.Equal(t, "203.0.113.10", c.Address())
+		assert.GreaterOrEqual(t, c.Port(), 30000)
+	}
+}
+
+func TestPortMapperFamilyMismatch(t *testing.T) {
+	a, err := NewAgent(&AgentConfig{
+		PortMapper: func(string, net.Addr) net.Addr {
+			return &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 30000}
+		},
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	_, _, ok := a.mapHostAddress(udp, net.IPv4(192, 0, 2, 1), 5000)
+	assert.False(t, ok)
+}
@@ -0,0 +1,238 @@
+package ice
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/stun"
+	"github.com/pion/turn/v2"
+)
+
+// ServerTestResult is the outcome of testing a STUN or TURN server with
+// TestServers.
+type ServerTestResult struct {
+	URL URL
+
+	// RTT is the round trip time of a binding request to the server
+	RTT time.Duration
+
+	// MappedAddress is the address the server saw the binding request from
+	MappedAddress net.Addr
+
+	// RelayedAddress is the address allocated by a TURN server, nil for a
+	// STUN server
+	RelayedAddress net.Addr
+
+	// Err is why the server can not be used, nil if it can. It wraps
+	// ErrServerUnauthorized when a TURN server rejects the credentials with
+	// 401 Unauthorized or 441 Wrong Credentials.
+	Err error
+}
+
+// ServerTestReport is the outcome of TestServers, with a result per URL in
+// the order they were given.
+type ServerTestReport struct {
+	Results []ServerTestResult
+}
+
+// Failed returns the results of the servers that can not be used.
+func (r *ServerTestReport) Failed() []ServerTestResult {
+	var failed []ServerTestResult
+	for _, result := range r.Results {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+func (r *ServerTestReport) String() string {
+	lines := make([]string, 0, len(r.Results))
+	for _, result := range r.Results {
+		switch {
+		case result.Err != nil:
+			lines = append(lines, fmt.Sprintf("%s: %v", result.URL, result.Err))
+		case result.RelayedAddress != nil:
+			lines = append(lines, fmt.Sprintf("%s: rtt %v, mapped %s, relayed %s", result.URL, result.RTT, result.MappedAddress, result.RelayedAddress))
+		default:
+			lines = append(lines, fmt.Sprintf("%s: rtt %v, mapped %s", result.URL, result.RTT, result.MappedAddress))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// TestServers checks that the STUN and TURN servers of urls can be used,
+// before any agent is created: it measures the round trip time of a binding
+// request to each of them, and allocates a relay on the TURN servers with
+// the credentials of their URL. The servers are tested concurrently, until
+// ctx is done.
+func TestServers(ctx context.Context, urls []*URL) (*ServerTestReport, error) {
+	a, err := NewAgent(&AgentConfig{MulticastDNSMode: MulticastDNSModeDisabled})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := a.Close(); closeErr != nil {
+			a.log.Warnf("Failed to close agent: %v", closeErr)
+		}
+	}()
+
+	report := &ServerTestReport{Results: make([]ServerTestResult, len(urls))}
+	var wg sync.WaitGroup
+	for i := range urls {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			report.Results[i] = a.testServer(ctx, *urls[i])
+		}(i)
+	}
+	wg.Wait()
+	return report, nil
+}
+
+func (a *Agent) testServer(ctx context.Context, url URL) ServerTestResult {
+	result := ServerTestResult{URL: url}
+
+	hostPort := net.JoinHostPort(url.Host, strconv.Itoa(url.Port))
+	serverAddr, err := a.transport.ResolveUDPAddr(udp, hostPort)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	network := NetworkTypeUDP4.String()
+	if serverAddr.IP.To4() == nil {
+		network = NetworkTypeUDP6.String()
+	}
+
+	switch url.Scheme {
+	case SchemeTypeSTUN:
+		result.Err = a.testSTUNServer(ctx, &result, serverAddr, network)
+	case SchemeTypeTURN, SchemeTypeTURNS:
+		result.Err = a.testTURNServer(ctx, &result, network)
+	default:
+		result.Err = fmt.Errorf("%w: %s", ErrSchemeType, url.Scheme)
+	}
+	return result
+}
+
+func (a *Agent) testSTUNServer(ctx context.Context, result *ServerTestResult, serverAddr *net.UDPAddr, network string) error {
+	conn, err := a.transport.ListenPacket(network, &net.UDPAddr{IP: nil, Port: 0})
+	if err != nil {
+		return err
+	}
+	defer closeOnDone(ctx, conn)()
+
+	started := a.clock.Now()
+	xoraddr, err := getXORMappedAddr(conn, serverAddr, stunGatherTimeout)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	result.RTT = a.clock.Now().Sub(started)
+	result.MappedAddress = &net.UDPAddr{IP: xoraddr.IP, Port: xoraddr.Port}
+	return nil
+}
+
+func (a *Agent) testTURNServer(ctx context.Context, result *ServerTestResult, network string) error {
+	url := result.URL
+	if url.Username == "" {
+		return ErrUsernameEmpty
+	}
+	if url.Password == "" {
+		return ErrPasswordEmpty
+	}
+
+	conn, _, _, _, err := a.dialTURNServer(url, network) //nolint:dogsled
+	if err != nil {
+		return err
+	}
+	defer closeOnDone(ctx, conn)()
+
+	client, err := turn.NewClient(&turn.ClientConfig{
+		STUNServerAddr: net.JoinHostPort(url.Host, strconv.Itoa(url.Port)),
+		TURNServerAddr: net.JoinHostPort(url.Host, strconv.Itoa(url.Port)),
+		Conn:           conn,
+		Username:       url.Username,
+		Password:       url.Password,
+		LoggerFactory:  a.loggerFactory,
+		Net:            a.net,
+	})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if err = client.Listen(); err != nil {
+		return err
+	}
+
+	started := a.clock.Now()
+	mapped, err := client.SendBindingRequest()
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	result.RTT = a.clock.Now().Sub(started)
+	result.MappedAddress = mapped
+
+	relayConn, err := client.Allocate()
+	if err != nil {
+		if isTURNAuthError(err) {
+			return fmt.Errorf("%w: %v", ErrServerUnauthorized, err)
+		}
+		return contextError(ctx, err)
+	}
+	result.RelayedAddress = relayConn.LocalAddr()
+	if err = relayConn.Close(); err != nil {
+		a.log.Warnf("Failed to close relay %v", err)
+	}
+	return nil
+}
+
+// isTURNAuthError reports whether an Allocate of a turn.Client failed on
+// the credentials: the error response to the authenticated request is 401
+// Unauthorized or 441 Wrong Credentials.
+func isTURNAuthError(err error) bool {
+	code, ok := turnErrorCode(err)
+	return ok && (code == stun.CodeUnauthorized || code == stun.CodeWrongCredentials)
+}
+
+// turnErrorCode returns the code of the error response a request of a
+// turn.Client failed on, which it only reports in the text of the error, as
+// "(error <code>: <reason>)".
+func turnErrorCode(err error) (stun.ErrorCode, bool) {
+	msg := err.Error()
+	i := strings.LastIndex(msg, "(error ")
+	if i < 0 {
+		return 0, false
+	}
+	var code int
+	if _, scanErr := fmt.Sscanf(msg[i:], "(error %d:", &code); scanErr != nil {
+		return 0, false
+	}
+	return stun.ErrorCode(code), true
+}
+
+// closeOnDone closes conn when ctx is done, to abort a pending request. The
+// returned function closes it otherwise.
+func closeOnDone(ctx context.Context, conn net.PacketConn) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		_ = conn.Close()
+	}()
+	return func() { close(done) }
+}
+
+// contextError returns the error of ctx if it is done, it caused err.
+func contextError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("%w: %v", ctxErr, err)
+	}
+	return err
+}
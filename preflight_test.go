@@ -0,0 +1,144 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pion/stun"
+	"github.com/pion/transport/test"
+	"github.com/pion/turn/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTestServers(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	serverPort := randomPort(t)
+	serverListener, err := net.ListenPacket("udp4", "127.0.0.1:"+strconv.Itoa(serverPort))
+	require.NoError(t, err)
+
+	server, err := turn.NewServer(turn.ServerConfig{
+		Realm:       "pion.ly",
+		AuthHandler: optimisticAuthHandler,
+		PacketConnConfigs: []turn.PacketConnConfig{
+			{
+				PacketConn:            serverListener,
+				RelayAddressGenerator: &turn.RelayAddressGeneratorNone{Address: "127.0.0.1"},
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, server.Close())
+	}()
+
+	// Nothing answers on the port of the STUN server
+	deadPort := randomPort(t)
+
+	rejectingPort, closeRejecting := rejectingTURNServer(t)
+	defer closeRejecting()
+
+	urls := []*URL{
+		{Scheme: SchemeTypeSTUN, Proto: ProtoTypeUDP, Host: "127.0.0.1", Port: serverPort},
+		{Scheme: SchemeTypeTURN, Proto: ProtoTypeUDP, Host: "127.0.0.1", Port: serverPort, Username: "username", Password: "password"},
+		{Scheme: SchemeTypeTURN, Proto: ProtoTypeUDP, Host: "127.0.0.1", Port: serverPort, Username: "username", Password: "wrong"},
+		{Scheme: SchemeTypeTURN, Proto: ProtoTypeUDP, Host: "127.0.0.1", Port: serverPort, Username: "username"},
+		{Scheme: SchemeTypeSTUN, Proto: ProtoTypeUDP, Host: "127.0.0.1", Port: deadPort},
+		{Scheme: SchemeTypeTURN, Proto: ProtoTypeUDP, Host: "127.0.0.1", Port: rejectingPort, Username: "username", Password: "password"},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	serverReport, err := TestServers(ctx, urls)
+	require.NoError(t, err)
+	require.Len(t, serverReport.Results, len(urls))
+
+	stun := serverReport.Results[0]
+	assert.NoError(t, stun.Err)
+	assert.Greater(t, int64(stun.RTT), int64(0))
+	assert.NotNil(t, stun.MappedAddress)
+	assert.Nil(t, stun.RelayedAddress)
+
+	relay := serverReport.Results[1]
+	assert.NoError(t, relay.Err)
+	assert.Greater(t, int64(relay.RTT), int64(0))
+	assert.NotNil(t, relay.MappedAddress)
+	assert.NotNil(t, relay.RelayedAddress)
+
+	// The server answers 400 Bad Request, which does not tell the
+	// credentials apart from other failures
+	assert.Error(t, serverReport.Results[2].Err)
+	assert.NotErrorIs(t, serverReport.Results[2].Err, ErrServerUnauthorized)
+	assert.ErrorIs(t, serverReport.Results[3].Err, ErrPasswordEmpty)
+	assert.ErrorIs(t, serverReport.Results[4].Err, context.DeadlineExceeded)
+	assert.ErrorIs(t, serverReport.Results[5].Err, ErrServerUnauthorized)
+
+	failed := serverReport.Failed()
+	require.Len(t, failed, 4)
+	assert.Equal(t, *urls[2], failed[0].URL)
+}
+
+// rejectingTURNServer starts a TURN server answering binding requests but
+// every Allocate request with 401 Unauthorized. It returns its port and a
+// function closing it.
+func rejectingTURNServer(t *testing.T) (int, func()) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req := &stun.Message{Raw: append([]byte{}, buf[:n]...)}
+			if req.Decode() != nil {
+				continue
+			}
+
+			var res *stun.Message
+			udpAddr := addr.(*net.UDPAddr) //nolint:forcetypeassert
+			switch req.Type.Method {
+			case stun.MethodBinding:
+				res, err = stun.Build(
+					stun.NewTransactionIDSetter(req.TransactionID),
+					stun.BindingSuccess,
+					&stun.XORMappedAddress{IP: udpAddr.IP, Port: udpAddr.Port},
+				)
+			case stun.MethodAllocate:
+				res, err = stun.Build(
+					stun.NewTransactionIDSetter(req.TransactionID),
+					stun.NewType(stun.MethodAllocate, stun.ClassErrorResponse),
+					stun.CodeUnauthorized,
+					stun.NewNonce("nonce"),
+					stun.NewRealm("pion.ly"),
+				)
+			default:
+				continue
+			}
+			if err != nil {
+				return
+			}
+			_, _ = conn.WriteTo(res.Raw, addr)
+		}
+	}()
+
+	return conn.LocalAddr().(*net.UDPAddr).Port, func() { //nolint:forcetypeassert
+		assert.NoError(t, conn.Close())
+		<-done
+	}
+}
@@ -0,0 +1,76 @@
+package ice
+
+import (
+	"github.com/pion/logging"
+)
+
+// findPeerReflexive returns the peer reflexive remote candidate with the
+// transport address of c, if c is signaled after it was learned from a
+// binding request.
+// Note: the caller should hold the agent lock.
+func (a *Agent) findPeerReflexive(c Candidate) (int, Candidate) {
+	if c.Type() == CandidateTypePeerReflexive {
+		return -1, nil
+	}
+	for i, candidate := range a.remoteCandidates[c.NetworkType()] {
+		if candidate.Type() == CandidateTypePeerReflexive && addrEqual(candidate.addr(), c.addr()) {
+			return i, candidate
+		}
+	}
+	return -1, nil
+}
+
+// promotePeerReflexive replaces the peer reflexive remote candidate prflx by
+// c, which has the same transport address and was signaled later, as of
+// RFC 8445, section 7.3.1.3. The pairs of prflx are replaced by copies
+// pairing with c, so the checks are not started over, and take the priority
+// of c. The selected pair, if promoted, is notified again.
+// Note: the caller should hold the agent lock.
+func (a *Agent) promotePeerReflexive(prflx, c Candidate) {
+	a.log.Debugf("Promoting peer-reflexive candidate %s to %s", prflx, c)
+	a.logEvent(logging.LogLevelDebug, "peer-reflexive candidate promoted", "candidate", prflx.String(), "signaled", c.String())
+
+	if t := prflx.LastReceived(); !t.IsZero() {
+		c.seen(false, t)
+	}
+	if t := prflx.LastSent(); !t.IsZero() {
+		c.seen(true, t)
+	}
+
+	for i, p := range a.checklist {
+		if p.Remote != prflx {
+			continue
+		}
+
+		// The pairs are read without the agent lock, e.g. by Conn.Write
+		// through the selected pair, so they are not updated in place
+		promoted := *p
+		promoted.Remote = c
+		a.checklist[i] = &promoted
+		a.replacePair(p, &promoted)
+	}
+}
+
+// replacePair makes the agent refer to promoted wherever it referred to p.
+// Note: the caller should hold the agent lock.
+func (a *Agent) replacePair(p, promoted *CandidatePair) {
+	if d := a.pathMTUDiscovery; d != nil && d.pair == p {
+		d.pair = promoted
+	}
+
+	selector := a.selector
+	if s, ok := selector.(*liteSelector); ok {
+		selector = s.pairCandidateSelector
+	}
+	if s, ok := selector.(*controllingSelector); ok && s.nominatedPair == p {
+		s.nominatedPair = promoted
+	}
+
+	if a.getSelectedPair() == p {
+		a.selectedPair.Store(promoted)
+		a.updateSelectedPairInfo(promoted)
+		a.pairHandlers.push(func() {
+			a.onSelectedCandidatePairChange(promoted)
+		})
+	}
+}
@@ -0,0 +1,54 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromotePeerReflexive(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 2)
+	defer lim.Stop()
+
+	runAgentTest(t, &AgentConfig{}, func(ctx context.Context, a *Agent) {
+		local := newInboundLocal(t, nil)
+		a.localCandidates[local.NetworkType()] = []Candidate{local}
+
+		prflx, err := NewCandidatePeerReflexive(&CandidatePeerReflexiveConfig{
+			Network:   "udp",
+			Address:   "172.17.0.3",
+			Port:      999,
+			Component: 1,
+		})
+		require.NoError(t, err)
+		a.addRemoteCandidate(prflx)
+		require.Len(t, a.checklist, 1)
+
+		p := a.checklist[0]
+		p.state = CandidatePairStateSucceeded
+		a.setSelectedPair(p)
+
+		host := newInboundRemote(t)
+		a.addRemoteCandidate(host)
+
+		assert.Equal(t, []Candidate{host}, a.remoteCandidates[host.NetworkType()])
+		require.Len(t, a.checklist, 1)
+		promoted := a.checklist[0]
+		assert.NotSame(t, p, promoted)
+		assert.Equal(t, prflx, p.Remote)
+		assert.Equal(t, host, promoted.Remote)
+		assert.EqualValues(t, CandidatePairStateSucceeded, promoted.state)
+		assert.Equal(t, (&CandidatePair{Local: local, Remote: host, iceRoleControlling: promoted.iceRoleControlling}).priority(), promoted.priority())
+		assert.Same(t, promoted, a.getSelectedPair())
+	})
+}
@@ -13,9 +13,9 @@ const prioritySize = 4 // 32 bit
 
 // AddTo adds PRIORITY attribute to message.
 func (p PriorityAttr) AddTo(m *stun.Message) error {
-	v := make([]byte, prioritySize)
-	binary.BigEndian.PutUint32(v, uint32(p))
-	m.Add(stun.AttrPriority, v)
+	var v [prioritySize]byte
+	binary.BigEndian.PutUint32(v[:], uint32(p))
+	m.Add(stun.AttrPriority, v[:])
 	return nil
 }
 
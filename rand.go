@@ -1,6 +1,11 @@
 package ice
 
-import "github.com/pion/randutil"
+import (
+	mrand "math/rand"
+	"sync"
+
+	"github.com/pion/randutil"
+)
 
 const (
 	runesAlpha                 = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
@@ -32,6 +37,44 @@ func newCandidateIDGenerator() *candidateIDGenerator {
 	}
 }
 
+// seededMathRandomGenerator is a MathRandomGenerator with a fixed seed, it
+// produces the same sequence in every run.
+type seededMathRandomGenerator struct {
+	r  *mrand.Rand
+	mu sync.Mutex
+}
+
+func newSeededMathRandomGenerator(seed int64) *seededMathRandomGenerator {
+	return &seededMathRandomGenerator{r: mrand.New(mrand.NewSource(seed))} //nolint:gosec
+}
+
+func (g *seededMathRandomGenerator) Intn(n int) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.r.Intn(n)
+}
+
+func (g *seededMathRandomGenerator) Uint32() uint32 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.r.Uint32()
+}
+
+func (g *seededMathRandomGenerator) Uint64() uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.r.Uint64()
+}
+
+func (g *seededMathRandomGenerator) GenerateString(n int, runes string) string {
+	letters := []rune(runes)
+	b := make([]rune, n)
+	for i := range b {
+		b[i] = letters[g.Intn(len(letters))]
+	}
+	return string(b)
+}
+
 func (g *candidateIDGenerator) Generate() string {
 	// https://tools.ietf.org/html/rfc5245#section-15.1
 	// candidate-id = "candidate" ":" foundation
@@ -0,0 +1,271 @@
+package ice
+
+import (
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/transport/packetio"
+)
+
+// BufferOverflowPolicy decides what happens to a packet received while the
+// buffer it is written to is full. Left unset, each buffer keeps its
+// default policy, documented with its size setting.
+type BufferOverflowPolicy int
+
+const (
+	// BufferOverflowDropNewest discards the packet being written.
+	BufferOverflowDropNewest BufferOverflowPolicy = iota + 1
+
+	// BufferOverflowDropOldest discards the oldest buffered packets until the new one fits.
+	BufferOverflowDropOldest
+
+	// BufferOverflowBlock blocks the writer until the packet fits. While
+	// blocked, the socket the packet was received on is not read, so
+	// connectivity checks on it are delayed as well.
+	BufferOverflowBlock
+)
+
+func (p BufferOverflowPolicy) String() string {
+	switch p {
+	case BufferOverflowDropNewest:
+		return "drop-newest"
+	case BufferOverflowDropOldest:
+		return "drop-oldest"
+	case BufferOverflowBlock:
+		return "block"
+	default:
+		return ErrUnknownType.Error()
+	}
+}
+
+// BufferStats describes the occupancy of a receive buffer.
+type BufferStats struct {
+	// Packets and Bytes currently buffered
+	Packets int
+	Bytes   int
+
+	// Limit is the maximum number of bytes buffered, zero if unlimited
+	Limit int
+
+	// Dropped is the number of packets discarded because the buffer was full
+	Dropped uint64
+
+	// TooLarge is the number of packets discarded because they were larger
+	// than AgentConfig.MaxPacketSize
+	TooLarge uint64
+}
+
+// receiveBuffer queues packets between the goroutine reading a socket and
+// the reader of a Conn. Unlike packetio.Buffer, it lets the caller choose
+// what happens when the buffer is full and counts the packets dropped.
+type receiveBuffer struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	packets []*bufferHolder
+	size    int
+	closed  bool
+
+	limit  int
+	policy BufferOverflowPolicy
+
+	// dropped may be shared by several buffers, see newReceiveBuffer
+	dropped *uint64
+
+	tooLarge uint64
+
+	deadline      time.Time
+	deadlineTimer *time.Timer
+}
+
+// timeoutError is returned by Read once the read deadline is exceeded.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// newReceiveBuffer creates a buffer holding up to limit bytes, unlimited if
+// limit is zero. Packets dropped are counted in dropped, if not nil, so a
+// count can outlive the buffer.
+func newReceiveBuffer(limit int, policy BufferOverflowPolicy, dropped *uint64) *receiveBuffer {
+	if dropped == nil {
+		dropped = new(uint64)
+	}
+	b := &receiveBuffer{limit: limit, policy: policy, dropped: dropped}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// Write queues a copy of p. It returns packetio.ErrFull if p was dropped.
+func (b *receiveBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	if b.limit > 0 && b.size+len(p) > b.limit {
+		// Dropping the new packet is the default, and the only option
+		// for a packet larger than the whole buffer
+		if (b.policy != BufferOverflowDropOldest && b.policy != BufferOverflowBlock) || len(p) > b.limit {
+			atomic.AddUint64(b.dropped, 1)
+			return 0, packetio.ErrFull
+		}
+
+		for !b.closed && b.size+len(p) > b.limit {
+			if b.policy == BufferOverflowDropOldest {
+				putPacketBuffer(b.pop())
+				atomic.AddUint64(b.dropped, 1)
+				continue
+			}
+			b.cond.Wait()
+		}
+		if b.closed {
+			return 0, io.ErrClosedPipe
+		}
+	}
+
+	b.packets = append(b.packets, getPacketBuffer(p))
+	b.size += len(p)
+	b.cond.Broadcast()
+	return len(p), nil
+}
+
+// writeTooLarge counts a packet that was too large to be received, and
+// queues ErrPacketTooLarge in its place if report is set.
+func (b *receiveBuffer) writeTooLarge(report bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return io.ErrClosedPipe
+	}
+
+	b.tooLarge++
+	if report {
+		b.packets = append(b.packets, &bufferHolder{tooLarge: true})
+		b.cond.Broadcast()
+	}
+	return nil
+}
+
+// tooLargeWarnInterval is the minimum time between two warnings about
+// packets larger than AgentConfig.MaxPacketSize, a peer sending jumbo
+// frames would flood the log otherwise.
+const tooLargeWarnInterval = 10 * time.Second
+
+// dropTooLarge drops a packet from srcAddr larger than MaxPacketSize, see
+// AgentConfig.ReportPacketTooLarge.
+func (a *Agent) dropTooLarge(srcAddr net.Addr, now time.Time) {
+	if err := a.buffer.writeTooLarge(a.reportPacketTooLarge); err != nil {
+		return
+	}
+
+	last := atomic.LoadInt64(&a.tooLargeWarnedAt)
+	if last != 0 && now.Sub(time.Unix(0, last)) < tooLargeWarnInterval {
+		return
+	}
+	if atomic.CompareAndSwapInt64(&a.tooLargeWarnedAt, last, now.UnixNano()) {
+		a.log.Warnf("Discarded packet from %s larger than %d bytes, further ones are counted in BufferStats.TooLarge", srcAddr, a.maxPacketSize)
+	}
+}
+
+// Read copies the oldest packet into p, blocking until one is available.
+// If p is too short the rest of the packet is discarded and
+// io.ErrShortBuffer is returned. ErrPacketTooLarge is returned in place of
+// a packet that was too large. Read returns io.EOF once the buffer is
+// closed and empty.
+func (b *receiveBuffer) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for {
+		if !b.deadline.IsZero() && !time.Now().Before(b.deadline) {
+			return 0, timeoutError{}
+		}
+		if len(b.packets) > 0 {
+			break
+		}
+		if b.closed {
+			return 0, io.EOF
+		}
+		b.cond.Wait()
+	}
+
+	packet := b.pop()
+	defer putPacketBuffer(packet)
+	b.cond.Broadcast()
+
+	if packet.tooLarge {
+		return 0, ErrPacketTooLarge
+	}
+
+	n := copy(p, packet.buffer)
+	if n < len(packet.buffer) {
+		return n, io.ErrShortBuffer
+	}
+	return n, nil
+}
+
+// SetReadDeadline makes Read return a timeout error, as a net.Conn does,
+// once t is reached. A zero t disables the deadline.
+func (b *receiveBuffer) SetReadDeadline(t time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.deadline = t
+	if b.deadlineTimer != nil {
+		b.deadlineTimer.Stop()
+		b.deadlineTimer = nil
+	}
+	if !t.IsZero() {
+		b.deadlineTimer = time.AfterFunc(time.Until(t), func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			b.cond.Broadcast()
+		})
+	}
+	b.cond.Broadcast()
+	return nil
+}
+
+// Close unblocks readers and writers, packets already buffered can still be read.
+func (b *receiveBuffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	if b.deadlineTimer != nil {
+		b.deadlineTimer.Stop()
+		b.deadlineTimer = nil
+	}
+	b.cond.Broadcast()
+	return nil
+}
+
+func (b *receiveBuffer) stats() BufferStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return BufferStats{
+		Packets:  len(b.packets),
+		Bytes:    b.size,
+		Limit:    b.limit,
+		Dropped:  atomic.LoadUint64(b.dropped),
+		TooLarge: b.tooLarge,
+	}
+}
+
+// pop removes the oldest packet.
+// Note: the caller should hold b.mu.
+func (b *receiveBuffer) pop() *bufferHolder {
+	packet := b.packets[0]
+	b.packets[0] = nil
+	b.packets = b.packets[1:]
+	b.size -= len(packet.buffer)
+	return packet
+}
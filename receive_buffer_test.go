@@ -0,0 +1,184 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/packetio"
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReceiveBuffer(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	read := func(b *receiveBuffer) []byte {
+		p := make([]byte, 16)
+		n, err := b.Read(p)
+		assert.NoError(t, err)
+		return p[:n]
+	}
+
+	t.Run("DropNewest", func(t *testing.T) {
+		b := newReceiveBuffer(4, BufferOverflowDropNewest, nil)
+		_, err := b.Write([]byte{1, 2})
+		assert.NoError(t, err)
+		_, err = b.Write([]byte{3, 4})
+		assert.NoError(t, err)
+		_, err = b.Write([]byte{5})
+		assert.ErrorIs(t, err, packetio.ErrFull)
+
+		assert.Equal(t, BufferStats{Packets: 2, Bytes: 4, Limit: 4, Dropped: 1}, b.stats())
+		assert.Equal(t, []byte{1, 2}, read(b))
+		assert.Equal(t, []byte{3, 4}, read(b))
+	})
+
+	t.Run("DropOldest", func(t *testing.T) {
+		b := newReceiveBuffer(4, BufferOverflowDropOldest, nil)
+		for _, p := range [][]byte{{1, 2}, {3, 4}, {5}} {
+			_, err := b.Write(p)
+			assert.NoError(t, err)
+		}
+
+		// A packet larger than the buffer is dropped whatever the policy
+		_, err := b.Write([]byte{1, 2, 3, 4, 5})
+		assert.ErrorIs(t, err, packetio.ErrFull)
+
+		assert.Equal(t, BufferStats{Packets: 2, Bytes: 3, Limit: 4, Dropped: 2}, b.stats())
+		assert.Equal(t, []byte{3, 4}, read(b))
+		assert.Equal(t, []byte{5}, read(b))
+	})
+
+	t.Run("Block", func(t *testing.T) {
+		b := newReceiveBuffer(4, BufferOverflowBlock, nil)
+		_, err := b.Write([]byte{1, 2, 3})
+		assert.NoError(t, err)
+
+		written := make(chan struct{})
+		go func() {
+			_, err := b.Write([]byte{4, 5})
+			assert.NoError(t, err)
+			close(written)
+		}()
+
+		select {
+		case <-written:
+			t.Fatal("Write did not block on a full buffer")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		assert.Equal(t, []byte{1, 2, 3}, read(b))
+		<-written
+		assert.Equal(t, []byte{4, 5}, read(b))
+		assert.Equal(t, uint64(0), b.stats().Dropped)
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		b := newReceiveBuffer(0, BufferOverflowDropNewest, nil)
+		_, err := b.Write([]byte{1, 2, 3})
+		assert.NoError(t, err)
+
+		closed := make(chan struct{})
+		go func() {
+			// Buffered packets can still be read once closed
+			assert.Equal(t, []byte{1, 2, 3}, read(b))
+			_, err := b.Read(make([]byte, 16))
+			assert.ErrorIs(t, err, io.EOF)
+			close(closed)
+		}()
+
+		assert.NoError(t, b.Close())
+		<-closed
+
+		_, err = b.Write([]byte{1})
+		assert.ErrorIs(t, err, io.ErrClosedPipe)
+	})
+
+	t.Run("ShortBuffer", func(t *testing.T) {
+		b := newReceiveBuffer(0, BufferOverflowDropNewest, nil)
+		_, err := b.Write([]byte{1, 2, 3})
+		assert.NoError(t, err)
+
+		p := make([]byte, 2)
+		n, err := b.Read(p)
+		assert.ErrorIs(t, err, io.ErrShortBuffer)
+		assert.Equal(t, 2, n)
+		assert.Equal(t, BufferStats{}, b.stats())
+	})
+
+	t.Run("SharedCounter", func(t *testing.T) {
+		var dropped uint64
+		b1 := newReceiveBuffer(1, BufferOverflowDropNewest, &dropped)
+		b2 := newReceiveBuffer(1, BufferOverflowDropNewest, &dropped)
+		_, _ = b1.Write([]byte{1, 2})
+		_, _ = b2.Write([]byte{1, 2})
+		assert.Equal(t, uint64(2), dropped)
+	})
+
+	t.Run("TooLarge", func(t *testing.T) {
+		b := newReceiveBuffer(0, BufferOverflowDropNewest, nil)
+		_, err := b.Write([]byte{1})
+		assert.NoError(t, err)
+		assert.NoError(t, b.writeTooLarge(true))
+		assert.NoError(t, b.writeTooLarge(false))
+		_, err = b.Write([]byte{2})
+		assert.NoError(t, err)
+
+		assert.Equal(t, BufferStats{Packets: 3, Bytes: 2, TooLarge: 2}, b.stats())
+		assert.Equal(t, []byte{1}, read(b))
+		_, err = b.Read(make([]byte, 16))
+		assert.ErrorIs(t, err, ErrPacketTooLarge)
+		assert.Equal(t, []byte{2}, read(b))
+	})
+
+	t.Run("ReadDeadline", func(t *testing.T) {
+		b := newReceiveBuffer(0, BufferOverflowDropNewest, nil)
+		assert.NoError(t, b.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+
+		_, err := b.Read(make([]byte, 16))
+		var netErr net.Error
+		assert.ErrorAs(t, err, &netErr)
+		assert.True(t, netErr.Timeout())
+
+		// Clearing the deadline lets the buffered packets be read again
+		_, err = b.Write([]byte{1})
+		assert.NoError(t, err)
+		_, err = b.Read(make([]byte, 16))
+		assert.Error(t, err)
+		assert.NoError(t, b.SetReadDeadline(time.Time{}))
+		assert.Equal(t, []byte{1}, read(b))
+		assert.NoError(t, b.Close())
+	})
+}
+
+func TestDropTooLargeWarning(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	a, err := NewAgent(&AgentConfig{})
+	assert.NoError(t, err)
+
+	src := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1000}
+	now := time.Now()
+	warned := func() int64 { return atomic.LoadInt64(&a.tooLargeWarnedAt) }
+
+	a.dropTooLarge(src, now)
+	assert.Equal(t, now.UnixNano(), warned())
+
+	// Counted, not logged again within the interval
+	a.dropTooLarge(src, now.Add(tooLargeWarnInterval/2))
+	assert.Equal(t, now.UnixNano(), warned())
+
+	a.dropTooLarge(src, now.Add(tooLargeWarnInterval))
+	assert.Equal(t, now.Add(tooLargeWarnInterval).UnixNano(), warned())
+	assert.Equal(t, uint64(3), a.GetReceiveBufferStats().TooLarge)
+
+	assert.NoError(t, a.Close())
+}
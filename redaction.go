@@ -0,0 +1,208 @@
+package ice
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/pion/logging"
+)
+
+// AddressRedaction selects how IP addresses appear in the logs, lifecycle
+// events and stats export of an agent.
+type AddressRedaction int
+
+const (
+	// AddressRedactionNone leaves addresses as they are, the default.
+	AddressRedactionNone AddressRedaction = iota
+
+	// AddressRedactionTruncate keeps the network part of addresses, the first
+	// three bytes of IPv4 addresses and six bytes of IPv6 addresses, e.g.
+	// 192.0.2.x or 2001:db8:1::x.
+	AddressRedactionTruncate
+
+	// AddressRedactionHash replaces addresses with a keyed hash, so the same
+	// address can be followed through the logs without being revealed.
+	AddressRedactionHash
+)
+
+func (r AddressRedaction) String() string {
+	switch r {
+	case AddressRedactionNone:
+		return "none"
+	case AddressRedactionTruncate:
+		return "truncate"
+	case AddressRedactionHash:
+		return "hash"
+	default:
+		return ErrUnknownType.Error()
+	}
+}
+
+const redactionKeySize = 32
+
+// ipv6Literal and ipv4Literal match the strings that may be IP addresses,
+// they are checked with net.ParseIP before being redacted.
+var (
+	ipv6Literal = regexp.MustCompile(`[0-9A-Fa-f]*:[0-9A-Fa-f:.]*[0-9A-Fa-f]|::`) //nolint:gochecknoglobals
+	ipv4Literal = regexp.MustCompile(`\d{1,3}(\.\d{1,3}){3}`)                     //nolint:gochecknoglobals
+)
+
+// AddressRedactor produces privacy-safe representations of addresses and
+// candidates. An agent uses the one built from AddressRedaction and
+// AddressRedactionKey, applications may build the same to redact their own
+// logs consistently.
+type AddressRedactor struct {
+	Mode AddressRedaction
+
+	// Key of the hash. The IPv4 address space is small enough for unkeyed
+	// hashes to be reversed, so the key should be kept secret.
+	Key []byte
+}
+
+// newAddressRedactor returns the redactor of an agent, with a random key if none is configured.
+func newAddressRedactor(mode AddressRedaction, key []byte) (AddressRedactor, error) {
+	if mode == AddressRedactionHash && len(key) == 0 {
+		key = make([]byte, redactionKeySize)
+		if _, err := rand.Read(key); err != nil {
+			return AddressRedactor{}, err
+		}
+	}
+	return AddressRedactor{Mode: mode, Key: key}, nil
+}
+
+// Address returns the redacted form of an IP address or hostname. mDNS
+// hostnames are not redacted, they already hide the address.
+func (r AddressRedactor) Address(address string) string {
+	if r.Mode == AddressRedactionNone || address == "" || strings.HasSuffix(address, ".local") {
+		return address
+	}
+
+	ip := net.ParseIP(address)
+	if r.Mode == AddressRedactionTruncate && ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			return fmt.Sprintf("%d.%d.%d.x", ip4[0], ip4[1], ip4[2])
+		}
+		return strings.TrimSuffix(ip.Mask(net.CIDRMask(48, 128)).String(), ":") + ":x"
+	}
+
+	if ip != nil {
+		address = ip.String()
+	}
+	mac := hmac.New(sha256.New, r.Key)
+	mac.Write([]byte(address)) //nolint:errcheck
+	return "redacted-" + hex.EncodeToString(mac.Sum(nil)[:6])
+}
+
+// Candidate returns the String of c with its addresses redacted.
+func (r AddressRedactor) Candidate(c Candidate) string {
+	if r.Mode == AddressRedactionNone {
+		return c.String()
+	}
+
+	related := ""
+	if ra := c.RelatedAddress(); ra != nil {
+		related = fmt.Sprintf(" related %s:%d", r.Address(ra.Address), ra.Port)
+	}
+	return fmt.Sprintf("%s %s %s:%d%s", c.NetworkType(), c.Type(), r.Address(c.Address()), c.Port(), related)
+}
+
+// Text returns s with the IP addresses it contains redacted.
+func (r AddressRedactor) Text(s string) string {
+	if r.Mode == AddressRedactionNone {
+		return s
+	}
+
+	replace := func(match string) string {
+		if net.ParseIP(match) == nil {
+			return match
+		}
+		return r.Address(match)
+	}
+	// IPv6 first, IPv4-mapped addresses are redacted as a whole
+	s = ipv6Literal.ReplaceAllStringFunc(s, replace)
+	return ipv4Literal.ReplaceAllStringFunc(s, replace)
+}
+
+// redactingLoggerFactory creates loggers redacting addresses, so the TURN
+// clients of the agent are covered as well.
+type redactingLoggerFactory struct {
+	logging.LoggerFactory
+	redactor AddressRedactor
+}
+
+func (f *redactingLoggerFactory) NewLogger(scope string) logging.LeveledLogger {
+	return &redactingLogger{f.LoggerFactory.NewLogger(scope), f.redactor}
+}
+
+// redactingLogger redacts the addresses in the messages of a LeveledLogger.
+type redactingLogger struct {
+	logging.LeveledLogger
+	redactor AddressRedactor
+}
+
+func (l *redactingLogger) Trace(msg string) {
+	l.LeveledLogger.Trace(l.redactor.Text(msg))
+}
+
+func (l *redactingLogger) Tracef(format string, args ...interface{}) {
+	l.LeveledLogger.Trace(l.redactor.Text(fmt.Sprintf(format, args...)))
+}
+
+func (l *redactingLogger) Debug(msg string) {
+	l.LeveledLogger.Debug(l.redactor.Text(msg))
+}
+
+func (l *redactingLogger) Debugf(format string, args ...interface{}) {
+	l.LeveledLogger.Debug(l.redactor.Text(fmt.Sprintf(format, args...)))
+}
+
+func (l *redactingLogger) Info(msg string) {
+	l.LeveledLogger.Info(l.redactor.Text(msg))
+}
+
+func (l *redactingLogger) Infof(format string, args ...interface{}) {
+	l.LeveledLogger.Info(l.redactor.Text(fmt.Sprintf(format, args...)))
+}
+
+func (l *redactingLogger) Warn(msg string) {
+	l.LeveledLogger.Warn(l.redactor.Text(msg))
+}
+
+func (l *redactingLogger) Warnf(format string, args ...interface{}) {
+	l.LeveledLogger.Warn(l.redactor.Text(fmt.Sprintf(format, args...)))
+}
+
+func (l *redactingLogger) Error(msg string) {
+	l.LeveledLogger.Error(l.redactor.Text(msg))
+}
+
+func (l *redactingLogger) Errorf(format string, args ...interface{}) {
+	l.LeveledLogger.Error(l.redactor.Text(fmt.Sprintf(format, args...)))
+}
+
+// redactKeyvals redacts the string and Stringer values of structured log key/value pairs.
+func (r AddressRedactor) redactKeyvals(keyvals []interface{}) []interface{} {
+	if r.Mode == AddressRedactionNone {
+		return keyvals
+	}
+
+	redacted := make([]interface{}, len(keyvals))
+	for i, v := range keyvals {
+		switch value := v.(type) {
+		case string:
+			v = r.Text(value)
+		case fmt.Stringer:
+			v = r.Text(value.String())
+		case error:
+			v = r.Text(value.Error())
+		}
+		redacted[i] = v
+	}
+	return redacted
+}
@@ -0,0 +1,98 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddressRedactor(t *testing.T) {
+	truncate := AddressRedactor{Mode: AddressRedactionTruncate}
+	assert.Equal(t, "192.0.2.x", truncate.Address("192.0.2.33"))
+	assert.Equal(t, "2001:db8:1::x", truncate.Address("2001:db8:1:2::1"))
+	assert.Equal(t, "abcd.local", truncate.Address("abcd.local"))
+
+	hash := AddressRedactor{Mode: AddressRedactionHash, Key: []byte("key")}
+	redacted := hash.Address("192.0.2.33")
+	assert.True(t, strings.HasPrefix(redacted, "redacted-"))
+	assert.NotContains(t, redacted, "192.0.2")
+	assert.Equal(t, redacted, hash.Address("192.0.2.33"))
+	assert.NotEqual(t, redacted, hash.Address("192.0.2.34"))
+	assert.NotEqual(t, redacted, AddressRedactor{Mode: AddressRedactionHash, Key: []byte("other")}.Address("192.0.2.33"))
+	assert.NotEqual(t, "example.com", hash.Address("example.com"))
+
+	none := AddressRedactor{}
+	assert.Equal(t, "192.0.2.33", none.Address("192.0.2.33"))
+
+	assert.Equal(t,
+		"pair 192.0.2.x:5000 <-> 2001:db8:1::x, mapped 192.0.2.x? ufrag:192.0.2.x 12:30:45",
+		truncate.Text("pair 192.0.2.1:5000 <-> 2001:db8:1::5, mapped ::ffff:192.0.2.1? ufrag:192.0.2.1 12:30:45"),
+	)
+
+	c, err := NewCandidateServerReflexive(&CandidateServerReflexiveConfig{
+		Network:   "udp",
+		Address:   "203.0.113.7",
+		Port:      5000,
+		Component: 1,
+		RelAddr:   "192.168.0.7",
+		RelPort:   6000,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "udp4 srflx 203.0.113.x:5000 related 192.168.0.x:6000", truncate.Candidate(c))
+	assert.Equal(t, c.String(), none.Candidate(c))
+}
+
+func TestAgentAddressRedaction(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	var logs bytes.Buffer
+	loggerFactory := logging.NewDefaultLoggerFactory()
+	loggerFactory.Writer = &logs
+	loggerFactory.DefaultLogLevel = logging.LogLevelDebug
+
+	a, err := NewAgent(&AgentConfig{
+		LoggerFactory:    loggerFactory,
+		AddressRedaction: AddressRedactionTruncate,
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	remote, err := NewCandidateHost(&CandidateHostConfig{
+		Network:   "udp",
+		Address:   "192.0.2.33",
+		Port:      5000,
+		Component: 1,
+	})
+	require.NoError(t, err)
+	a.log.Warnf("candidate %s", remote)
+	assert.Contains(t, logs.String(), "udp4 host 192.0.2.x:5000")
+	assert.NotContains(t, logs.String(), "192.0.2.33")
+
+	require.NoError(t, a.SetRemoteCredentials("ufrag", "passwordpasswordpassword"))
+	require.NoError(t, a.AddRemoteCandidate(remote))
+	assert.Eventually(t, func() bool {
+		return len(a.GetRemoteCandidatesStats()) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// The API is not redacted, the export is
+	assert.Equal(t, "192.0.2.33", a.GetRemoteCandidatesStats()[0].IP)
+	raw, err := a.MarshalStatsJSON()
+	require.NoError(t, err)
+	var stats map[string]map[string]interface{}
+	require.NoError(t, json.Unmarshal(raw, &stats))
+	assert.Equal(t, "192.0.2.x", stats[statsCandidateIDPrefix+remote.ID()]["address"])
+	assert.NotContains(t, logs.String(), "192.0.2.33")
+}
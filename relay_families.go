@@ -0,0 +1,50 @@
+package ice
+
+import "net"
+
+// Relay candidates are paired with the remote candidates of the same IP
+// address family, as RFC 8445 requires. A TURN server translating between
+// the families, e.g. one allocating an IPv4 relayed address and relaying to
+// IPv6 peers, lets AgentConfig.RelayAcrossAddressFamilies pair them with
+// the remote candidates of the other family as well.
+
+// otherFamily returns the network type of the same transport over the
+// other IP address family.
+func (t NetworkType) otherFamily() NetworkType {
+	switch t {
+	case NetworkTypeUDP4:
+		return NetworkTypeUDP6
+	case NetworkTypeUDP6:
+		return NetworkTypeUDP4
+	case NetworkTypeTCP4:
+		return NetworkTypeTCP6
+	case NetworkTypeTCP6:
+		return NetworkTypeTCP4
+	default:
+		return t
+	}
+}
+
+// pairsAcrossFamilies reports whether the local candidate c is paired with
+// the remote candidates of both address families.
+func (a *Agent) pairsAcrossFamilies(c Candidate) bool {
+	return a.relayAcrossAddressFamilies && c.Type() == CandidateTypeRelay
+}
+
+// remoteNetworkType returns the network type of the remote candidates a
+// packet from addr received on local may come from.
+func (a *Agent) remoteNetworkType(local Candidate, addr net.Addr) NetworkType {
+	t := local.NetworkType()
+	if !a.pairsAcrossFamilies(local) {
+		return t
+	}
+
+	ip, _, _, ok := parseAddr(addr)
+	if !ok {
+		return t
+	}
+	if remote, err := determineNetworkType(t.NetworkShort(), ip); err == nil {
+		return remote
+	}
+	return t
+}
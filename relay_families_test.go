@@ -0,0 +1,165 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/pion/turn/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelayAcrossAddressFamilies(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	newRelay := func(address string) Candidate {
+		c, err := NewCandidateRelay(&CandidateRelayConfig{Network: "udp", Address: address, Port: 1000, Component: 1})
+		require.NoError(t, err)
+		return c
+	}
+
+	for _, across := range []bool{false, true} {
+		a, err := NewAgent(&AgentConfig{RelayAcrossAddressFamilies: across})
+		require.NoError(t, err)
+
+		relay4, relay6, host4 := newRelay("192.0.2.1"), newRelay("2001:db8::1"), newTestHost(t, "192.0.2.2")
+		remote4, remote6 := newTestHost(t, "198.51.100.1"), newTestHost(t, "2001:db8::2")
+
+		require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+			agent.localCandidates[NetworkTypeUDP4] = []Candidate{relay4, host4}
+			agent.localCandidates[NetworkTypeUDP6] = []Candidate{relay6}
+			agent.addRemoteCandidate(remote4)
+			agent.addRemoteCandidate(remote6)
+
+			// The relay candidates are paired with the other family too
+			assert.NotNil(t, agent.findPair(relay4, remote4))
+			assert.NotNil(t, agent.findPair(relay6, remote6))
+			assert.Equal(t, across, agent.findPair(relay4, remote6) != nil)
+			assert.Equal(t, across, agent.findPair(relay6, remote4) != nil)
+			assert.Nil(t, agent.findPair(host4, remote6))
+
+			// The packets of the IPv6 remote received on the IPv4 relay are
+			// from its remote candidate, not from a peer reflexive one
+			if across {
+				assert.Equal(t, remote6, agent.findRemoteCandidate(agent.remoteNetworkType(relay4, remote6.addr()), remote6.addr()))
+			} else {
+				assert.Nil(t, agent.findRemoteCandidate(agent.remoteNetworkType(relay4, remote6.addr()), remote6.addr()))
+			}
+			assert.Nil(t, agent.findRemoteCandidate(agent.remoteNetworkType(host4, remote6.addr()), remote6.addr()))
+		}))
+		assert.NoError(t, a.Close())
+	}
+}
+
+// dualStackRelayAddressGenerator allocates IPv4 relayed addresses on
+// dual-stack sockets, translating between the address families.
+type dualStackRelayAddressGenerator struct{}
+
+func (dualStackRelayAddressGenerator) Validate() error {
+	return nil
+}
+
+func (dualStackRelayAddressGenerator) AllocatePacketConn(string, int) (net.PacketConn, net.Addr, error) {
+	conn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: conn.LocalAddr().(*net.UDPAddr).Port}, nil //nolint:forcetypeassert
+}
+
+func (dualStackRelayAddressGenerator) AllocateConn(string, int) (net.Conn, net.Addr, error) {
+	return nil, nil, errNotImplemented
+}
+
+func TestRelayAcrossAddressFamiliesConnection(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	ipv6Conn, err := net.ListenPacket("udp6", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 is not available")
+	}
+
+	serverPort := randomPort(t)
+	serverListener, err := net.ListenPacket("udp", "127.0.0.1:"+strconv.Itoa(serverPort))
+	require.NoError(t, err)
+
+	server, err := turn.NewServer(turn.ServerConfig{
+		Realm:       "pion.ly",
+		AuthHandler: optimisticAuthHandler,
+		PacketConnConfigs: []turn.PacketConnConfig{
+			{
+				PacketConn:            serverListener,
+				RelayAddressGenerator: dualStackRelayAddressGenerator{},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	// An IPv4 relay candidate
+	relayed, err := NewAgent(&AgentConfig{
+		NetworkTypes: []NetworkType{NetworkTypeUDP4},
+		Urls: []*URL{
+			{
+				Scheme:   SchemeTypeTURN,
+				Host:     "127.0.0.1",
+				Username: "username",
+				Password: "password",
+				Port:     serverPort,
+				Proto:    ProtoTypeUDP,
+			},
+		},
+		CandidateTypes:             []CandidateType{CandidateTypeRelay},
+		RelayAcrossAddressFamilies: true,
+	})
+	require.NoError(t, err)
+
+	// An IPv6 host candidate
+	ipv6, err := NewAgent(&AgentConfig{
+		NetworkTypes:   []NetworkType{NetworkTypeUDP6},
+		CandidateTypes: []CandidateType{CandidateTypeHost},
+		InterfaceFilter: func(string) bool {
+			return false
+		},
+	})
+	require.NoError(t, err)
+	host, err := NewCandidateHost(&CandidateHostConfig{
+		Network:   "udp",
+		Address:   "::1",
+		Port:      ipv6Conn.LocalAddr().(*net.UDPAddr).Port, //nolint:forcetypeassert
+		Component: ComponentRTP,
+	})
+	require.NoError(t, err)
+	require.NoError(t, ipv6.AddLocalCandidate(host, ipv6Conn))
+
+	relayedConn, ipv6Conn2 := connect(relayed, ipv6)
+
+	pair := relayed.getSelectedPair()
+	require.NotNil(t, pair)
+	assert.Equal(t, CandidateTypeRelay, pair.Local.Type())
+	assert.Equal(t, NetworkTypeUDP4, pair.Local.NetworkType())
+	assert.Equal(t, NetworkTypeUDP6, pair.Remote.NetworkType())
+
+	data := []byte("through the relay")
+	_, err = relayedConn.Write(data)
+	require.NoError(t, err)
+	buf := make([]byte, 64)
+	n, err := ipv6Conn2.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, data, buf[:n])
+
+	assert.NoError(t, relayed.Close())
+	assert.NoError(t, ipv6.Close())
+	assert.NoError(t, server.Close())
+}
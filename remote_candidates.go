@@ -0,0 +1,106 @@
+package ice
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// RemoteCandidateAddress is an entry of the remote-candidates SDP attribute
+// (RFC 8839 section 5.2). The controlling agent lists, for each component,
+// the address of the remote candidate of the selected pair, so the controlled
+// agent can check both agree on the pairs in use after a renegotiation
+// without restart.
+type RemoteCandidateAddress struct {
+	Component uint16
+	Address   string
+	Port      int
+}
+
+// MarshalRemoteCandidates returns the value of the remote-candidates
+// attribute listing addresses, e.g. "1 192.0.2.3 45664 2 192.0.2.3 45665".
+func MarshalRemoteCandidates(addresses []RemoteCandidateAddress) string {
+	parts := make([]string, 0, len(addresses))
+	for _, a := range addresses {
+		parts = append(parts, fmt.Sprintf("%d %s %d", a.Component, a.Address, a.Port))
+	}
+	return strings.Join(parts, " ")
+}
+
+// UnmarshalRemoteCandidates parses the value of a remote-candidates
+// attribute, with or without the "a=remote-candidates:" prefix.
+func UnmarshalRemoteCandidates(raw string) ([]RemoteCandidateAddress, error) {
+	raw = strings.TrimPrefix(raw, "a=")
+	raw = strings.TrimPrefix(raw, "remote-candidates:")
+
+	split := strings.Fields(raw)
+	if len(split) == 0 || len(split)%3 != 0 {
+		return nil, fmt.Errorf("%w: %d fields", errParseRemoteCandidates, len(split))
+	}
+
+	addresses := make([]RemoteCandidateAddress, 0, len(split)/3)
+	for i := 0; i < len(split); i += 3 {
+		component, err := strconv.ParseUint(split[i], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errParseComponent, err)
+		}
+		port, err := strconv.ParseUint(split[i+2], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errParsePort, err)
+		}
+		addresses = append(addresses, RemoteCandidateAddress{
+			Component: uint16(component),
+			Address:   split[i+1],
+			Port:      int(port),
+		})
+	}
+	return addresses, nil
+}
+
+// GetRemoteCandidateAddresses returns the address of the remote candidate of
+// the selected pair, to be sent by the controlling agent in the
+// remote-candidates attribute.
+func (a *Agent) GetRemoteCandidateAddresses() ([]RemoteCandidateAddress, error) {
+	p := a.getSelectedPair()
+	if p == nil {
+		return nil, ErrNoSelectedCandidatePair
+	}
+
+	return []RemoteCandidateAddress{{
+		Component: p.Remote.Component(),
+		Address:   p.Remote.Address(),
+		Port:      p.Remote.Port(),
+	}}, nil
+}
+
+// VerifyRemoteCandidateAddresses checks the remote-candidates claimed by the
+// controlling agent against the local candidate of the selected pair. Entries
+// for other components are ignored, as an Agent handles a single component.
+// It returns ErrRemoteCandidatesMismatch if the claim does not match, the
+// agents then disagree on the pair in use and ICE should be restarted.
+func (a *Agent) VerifyRemoteCandidateAddresses(claimed []RemoteCandidateAddress) error {
+	p := a.getSelectedPair()
+	if p == nil {
+		return ErrNoSelectedCandidatePair
+	}
+	local := p.Local
+
+	for _, c := range claimed {
+		if c.Component != local.Component() {
+			continue
+		}
+		if c.Port != local.Port() || !remoteCandidateAddressEqual(c.Address, local.Address()) {
+			return fmt.Errorf("%w: %s %d is not %s", ErrRemoteCandidatesMismatch, c.Address, c.Port, local)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: no address for component %d", ErrRemoteCandidatesMismatch, local.Component())
+}
+
+func remoteCandidateAddressEqual(a, b string) bool {
+	if ipA, ipB := net.ParseIP(a), net.ParseIP(b); ipA != nil && ipB != nil {
+		return ipA.Equal(ipB)
+	}
+	return strings.EqualFold(a, b)
+}
@@ -0,0 +1,84 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteCandidatesAttribute(t *testing.T) {
+	addresses := []RemoteCandidateAddress{
+		{Component: 1, Address: "192.0.2.3", Port: 45664},
+		{Component: 2, Address: "2001:db8::1", Port: 45665},
+	}
+
+	raw := MarshalRemoteCandidates(addresses)
+	assert.Equal(t, "1 192.0.2.3 45664 2 2001:db8::1 45665", raw)
+
+	for _, attr := range []string{raw, "remote-candidates:" + raw, "a=remote-candidates:" + raw} {
+		parsed, err := UnmarshalRemoteCandidates(attr)
+		assert.NoError(t, err)
+		assert.Equal(t, addresses, parsed)
+	}
+
+	for _, invalid := range []string{"", "1 192.0.2.3", "x 192.0.2.3 1", "1 192.0.2.3 70000"} {
+		_, err := UnmarshalRemoteCandidates(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestRemoteCandidateAddresses(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	a, err := NewAgent(&AgentConfig{})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	_, err = a.GetRemoteCandidateAddresses()
+	assert.ErrorIs(t, err, ErrNoSelectedCandidatePair)
+	assert.ErrorIs(t, a.VerifyRemoteCandidateAddresses(nil), ErrNoSelectedCandidatePair)
+
+	local, err := NewCandidateHost(&CandidateHostConfig{
+		Network:   "udp",
+		Address:   "192.168.1.1",
+		Port:      19216,
+		Component: 1,
+	})
+	require.NoError(t, err)
+
+	remote, err := NewCandidateHost(&CandidateHostConfig{
+		Network:   "udp",
+		Address:   "192.168.1.2",
+		Port:      19217,
+		Component: 1,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+		agent.selectedPair.Store(newCandidatePair(local, remote, true))
+	}))
+
+	addresses, err := a.GetRemoteCandidateAddresses()
+	assert.NoError(t, err)
+	assert.Equal(t, []RemoteCandidateAddress{{Component: 1, Address: "192.168.1.2", Port: 19217}}, addresses)
+
+	assert.NoError(t, a.VerifyRemoteCandidateAddresses([]RemoteCandidateAddress{
+		{Component: 2, Address: "192.168.1.1", Port: 1},
+		{Component: 1, Address: "192.168.1.1", Port: 19216},
+	}))
+	assert.ErrorIs(t, a.VerifyRemoteCandidateAddresses([]RemoteCandidateAddress{
+		{Component: 1, Address: "192.168.1.1", Port: 19217},
+	}), ErrRemoteCandidatesMismatch)
+	assert.ErrorIs(t, a.VerifyRemoteCandidateAddresses([]RemoteCandidateAddress{
+		{Component: 2, Address: "192.168.1.1", Port: 19216},
+	}), ErrRemoteCandidatesMismatch)
+}
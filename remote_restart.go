@@ -0,0 +1,33 @@
+package ice
+
+import (
+	"github.com/pion/logging"
+)
+
+// isRemoteRestart reports whether ufrag and pwd start a new session with the
+// remote agent: they differ from the remote credentials already set.
+// Note: the caller should hold the agent lock.
+func (a *Agent) isRemoteRestart(ufrag, pwd string) bool {
+	return a.remoteUfrag != "" && (a.remoteUfrag != ufrag || a.remotePwd != pwd)
+}
+
+// restartRemote handles an ICE restart of the remote agent, which signaled
+// new credentials (RFC 8445, section 9). The remote candidates, the pairs
+// and the selected pair of the previous session are dropped and the checks
+// start over once the new remote candidates are added. The local candidates
+// and credentials are kept, the sockets stay open.
+// Note: the caller should hold the agent lock.
+func (a *Agent) restartRemote(ufrag, pwd string) {
+	a.log.Infof("Remote credentials changed, the remote agent restarted")
+	a.logEvent(logging.LogLevelInfo, "remote restart", "previousUfrag", a.remoteUfrag, "ufrag", ufrag)
+
+	a.remoteUfrag = ufrag
+	a.remotePwd = pwd
+	a.deleteRemoteCandidates()
+	// Candidates of the previous remote generations trickled late are stale
+	if a.remoteGenerationSeen {
+		a.minRemoteGeneration = a.maxRemoteGeneration + 1
+	}
+
+	a.resetChecks(ConnectionStateChangeReasonRemoteRestart)
+}
@@ -0,0 +1,80 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteRestart(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	// a is the controlled agent, b the controlling one
+	config := &AgentConfig{NetworkTypes: supportedNetworkTypes()}
+	a, err := NewAgent(config)
+	require.NoError(t, err)
+	b, err := NewAgent(config)
+	require.NoError(t, err)
+	connect(a, b)
+
+	remoteRestarted := func() bool {
+		for _, transition := range a.GetStateStats().ConnectionStateTransitions {
+			if transition.Reason == ConnectionStateChangeReasonRemoteRestart {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Accepting again with the same credentials is not a restart
+	aUfrag, aPwd, err := a.GetLocalUserCredentials()
+	require.NoError(t, err)
+	bUfrag, bPwd, err := b.GetLocalUserCredentials()
+	require.NoError(t, err)
+	_, err = a.Accept(context.Background(), bUfrag, bPwd)
+	assert.ErrorIs(t, err, ErrMultipleStart)
+	_, err = a.Dial(context.Background(), bUfrag+"x", bPwd)
+	assert.ErrorIs(t, err, ErrMultipleStart)
+	assert.False(t, remoteRestarted())
+
+	require.NoError(t, b.WarmRestart("", ""))
+	bUfrag, bPwd, err = b.GetLocalUserCredentials()
+	require.NoError(t, err)
+
+	accepted := make(chan error)
+	go func() {
+		_, acceptErr := a.Accept(context.Background(), bUfrag, bPwd)
+		accepted <- acceptErr
+	}()
+	assert.Eventually(t, remoteRestarted, 5*time.Second, 10*time.Millisecond)
+
+	assert.Empty(t, a.GetRemoteCandidatesStats())
+
+	require.NoError(t, b.SetRemoteCredentials(aUfrag, aPwd))
+	signal := func(from, to *Agent) {
+		candidates, err := from.GetLocalCandidates()
+		require.NoError(t, err)
+		for _, c := range candidates {
+			remote, err := UnmarshalCandidate(c.Marshal())
+			require.NoError(t, err)
+			require.NoError(t, to.AddRemoteCandidate(remote))
+		}
+	}
+	signal(a, b)
+	signal(b, a)
+
+	assert.NoError(t, <-accepted)
+	assert.NoError(t, a.Close())
+	assert.NoError(t, b.Close())
+}
@@ -0,0 +1,80 @@
+package ice
+
+import (
+	"context"
+	"net"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun"
+)
+
+// A response to a binding request leaves from the socket the request
+// arrived on, be it the socket of the candidate, the shared socket of a
+// UDPMux or TCPMux, or the TURN allocation, and goes to the source of the
+// request. Some NATs drop the session when the response comes from another
+// port. The socket and source of the request being handled are recorded so
+// that the responses written otherwise are reported, and dropped with
+// AgentConfig.StrictResponseRouting.
+
+// inboundRequest is the binding request being handled.
+type inboundRequest struct {
+	socket net.Addr
+	source net.Addr
+}
+
+// socketAddr returns the local address of the socket the packets of a
+// local candidate are read from and written to: the shared socket of a
+// UDPMux, the relayed address of a TURN allocation, or the socket of the
+// candidate.
+func socketAddr(c Candidate) net.Addr {
+	conn := candidateSocket(c)
+	if conn == nil {
+		return nil
+	}
+	if muxed, ok := conn.(*udpMuxedConn); ok && muxed.params.Mux != nil {
+		return muxed.params.Mux.LocalAddr()
+	}
+	return conn.LocalAddr()
+}
+
+// checkResponseRoute reports whether msg may be written from local to
+// remote. Only the responses written while a binding request is handled
+// are checked.
+// Note: the caller should hold the agent lock.
+func (a *Agent) checkResponseRoute(msg *stun.Message, local, remote Candidate) bool {
+	req := a.inboundRequest
+	if req == nil || (msg.Type.Class != stun.ClassSuccessResponse && msg.Type.Class != stun.ClassErrorResponse) {
+		return true
+	}
+
+	// A PacketConn given by the application may have no address
+	socket := socketAddr(local)
+	sameSocket := (socket == nil && req.socket == nil) || addrEqual(socket, req.socket)
+	if sameSocket && addrEqual(remote.addr(), req.source) {
+		return true
+	}
+
+	a.responseRouteViolations++
+	a.log.Warnf("Response to the binding request from %s to %s written from %s to %s", req.source, req.socket, socket, remote.addr())
+	a.logEvent(logging.LogLevelWarn, "asymmetric response", "socket", addrString(socket), "remote", remote.addr().String(), "dropped", a.strictResponseRouting)
+	return !a.strictResponseRouting
+}
+
+// addrString returns addr as a string, nil included.
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return "<nil>"
+	}
+	return addr.String()
+}
+
+// GetResponseRouteViolations returns how many responses to binding requests
+// were not written from the socket the request arrived on to the source of
+// the request, see AgentConfig.StrictResponseRouting.
+func (a *Agent) GetResponseRouteViolations() (uint64, error) {
+	var violations uint64
+	err := a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		violations = agent.responseRouteViolations
+	})
+	return violations, err
+}
@@ -0,0 +1,107 @@
+package ice
+
+import (
+	"sort"
+	"time"
+)
+
+func defaultRTTHistogramBuckets() []time.Duration {
+	return []time.Duration{
+		5 * time.Millisecond,
+		10 * time.Millisecond,
+		25 * time.Millisecond,
+		50 * time.Millisecond,
+		100 * time.Millisecond,
+		250 * time.Millisecond,
+		500 * time.Millisecond,
+		time.Second,
+	}
+}
+
+// RTTHistogram is a histogram of binding request round trip times.
+type RTTHistogram struct {
+	// Buckets are the upper bounds (inclusive) of each bucket, in increasing order.
+	Buckets []time.Duration
+
+	// Counts holds the number of samples per bucket. It has one more entry
+	// than Buckets, the last one counting the samples above the last bound.
+	Counts []uint64
+
+	// Count is the total number of samples and Sum their total duration.
+	Count uint64
+	Sum   time.Duration
+
+	// Min and Max are the smallest and largest samples, zero if Count is zero.
+	Min time.Duration
+	Max time.Duration
+}
+
+// Mean returns the average round trip time, or zero if there are no samples.
+func (h RTTHistogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// rttHistogram accumulates samples, it is only accessed from the agent loop.
+type rttHistogram struct {
+	buckets []time.Duration
+	counts  []uint64
+	count   uint64
+	sum     time.Duration
+	min     time.Duration
+	max     time.Duration
+	last    time.Duration
+}
+
+func newRTTHistogram(buckets []time.Duration) *rttHistogram {
+	return &rttHistogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)+1),
+	}
+}
+
+func (h *rttHistogram) observe(rtt time.Duration) {
+	i := sort.Search(len(h.buckets), func(i int) bool { return rtt <= h.buckets[i] })
+	h.counts[i]++
+
+	if h.count == 0 || rtt < h.min {
+		h.min = rtt
+	}
+	if rtt > h.max {
+		h.max = rtt
+	}
+	h.count++
+	h.sum += rtt
+	h.last = rtt
+}
+
+func (h *rttHistogram) snapshot() RTTHistogram {
+	if h == nil {
+		return RTTHistogram{}
+	}
+
+	return RTTHistogram{
+		Buckets: append([]time.Duration{}, h.buckets...),
+		Counts:  append([]uint64{}, h.counts...),
+		Count:   h.count,
+		Sum:     h.sum,
+		Min:     h.min,
+		Max:     h.max,
+	}
+}
+
+// recordRoundTripTime adds the round trip time of a binding request answered
+// on p to the histograms of the pair and the agent, and reports it to the
+// handler of OnSelectedPairRTT.
+// Note: the caller should hold the agent lock.
+func (a *Agent) recordRoundTripTime(p *CandidatePair, rtt time.Duration) {
+	if p.rttHistogram == nil {
+		p.rttHistogram = newRTTHistogram(a.rttHistogramBuckets)
+	}
+	p.rttHistogram.observe(rtt)
+	a.rttHistogram.observe(rtt)
+	p.consentRequested = time.Time{}
+	a.notifySelectedPairRTT(p, rtt)
+}
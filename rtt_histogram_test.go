@@ -0,0 +1,74 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRTTHistogram(t *testing.T) {
+	h := newRTTHistogram([]time.Duration{10 * time.Millisecond, 100 * time.Millisecond})
+	assert.Equal(t, RTTHistogram{Buckets: []time.Duration{10 * time.Millisecond, 100 * time.Millisecond}, Counts: []uint64{0, 0, 0}}, h.snapshot())
+
+	for _, rtt := range []time.Duration{time.Millisecond, 10 * time.Millisecond, 50 * time.Millisecond, time.Second} {
+		h.observe(rtt)
+	}
+
+	s := h.snapshot()
+	assert.Equal(t, []uint64{2, 1, 1}, s.Counts)
+	assert.Equal(t, uint64(4), s.Count)
+	assert.Equal(t, 1061*time.Millisecond, s.Sum)
+	assert.Equal(t, time.Millisecond, s.Min)
+	assert.Equal(t, time.Second, s.Max)
+	assert.Equal(t, 1061*time.Millisecond/4, s.Mean())
+
+	// Snapshots must not alias the live histogram
+	s.Counts[0] = 100
+	assert.Equal(t, uint64(2), h.snapshot().Counts[0])
+
+	var nilHistogram *rttHistogram
+	assert.Equal(t, RTTHistogram{}, nilHistogram.snapshot())
+	assert.Equal(t, time.Duration(0), RTTHistogram{}.Mean())
+}
+
+func TestRTTHistogramStats(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 10)
+	defer lim.Stop()
+
+	cfg := &AgentConfig{
+		NetworkTypes:        supportedNetworkTypes(),
+		RTTHistogramBuckets: []time.Duration{time.Second, time.Millisecond},
+	}
+
+	aAgent, err := NewAgent(cfg)
+	require.NoError(t, err)
+
+	bAgent, err := NewAgent(cfg)
+	require.NoError(t, err)
+
+	connect(aAgent, bAgent)
+
+	h := aAgent.GetRoundTripTimeHistogram()
+	assert.Equal(t, []time.Duration{time.Millisecond, time.Second}, h.Buckets)
+	assert.NotZero(t, h.Count)
+
+	var pairCount uint64
+	for _, s := range aAgent.GetCandidatePairsStats() {
+		pairCount += s.RoundTripTimeHistogram.Count
+		assert.Equal(t, s.RoundTripTimeHistogram.Count, s.ResponsesReceived)
+		assert.InDelta(t, s.RoundTripTimeHistogram.Sum.Seconds(), s.TotalRoundTripTime, 1e-9)
+	}
+	assert.Equal(t, h.Count, pairCount)
+
+	assert.NoError(t, aAgent.Close())
+	assert.NoError(t, bAgent.Close())
+}
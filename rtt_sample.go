@@ -0,0 +1,47 @@
+package ice
+
+import "time"
+
+// RTTSample is a round trip time measured on the selected pair by a
+// keepalive or consent check, for bandwidth estimators above the agent.
+type RTTSample struct {
+	// Timestamp is when the response carrying the sample was received.
+	Timestamp time.Time
+
+	// RTT is the round trip time of the binding request.
+	RTT time.Duration
+
+	// LocalCandidateID and RemoteCandidateID are the candidates of the
+	// selected pair.
+	LocalCandidateID  string
+	RemoteCandidateID string
+}
+
+// OnSelectedPairRTT sets a handler that is fired with every round trip time
+// measured on the selected pair. The handler must not block, the samples
+// of the pairs being checked are not reported.
+func (a *Agent) OnSelectedPairRTT(f func(RTTSample)) error {
+	a.onSelectedPairRTTHdlr.Store(f)
+	return nil
+}
+
+// notifySelectedPairRTT reports rtt measured on p, if it is the selected
+// pair.
+//
+// Note: the caller should hold the agent lock.
+func (a *Agent) notifySelectedPairRTT(p *CandidatePair, rtt time.Duration) {
+	h, ok := a.onSelectedPairRTTHdlr.Load().(func(RTTSample))
+	if !ok || h == nil || a.getSelectedPair() != p {
+		return
+	}
+
+	sample := RTTSample{
+		Timestamp:         a.clock.Now(),
+		RTT:               rtt,
+		LocalCandidateID:  p.Local.ID(),
+		RemoteCandidateID: p.Remote.ID(),
+	}
+	a.pairHandlers.push(func() {
+		h(sample)
+	})
+}
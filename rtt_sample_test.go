@@ -0,0 +1,44 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectedPairRTT(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	keepaliveInterval := 20 * time.Millisecond
+	aConn, bConn := pipe(&AgentConfig{
+		KeepaliveInterval: &keepaliveInterval,
+	})
+
+	samples := make(chan RTTSample, 16)
+	assert.NoError(t, aConn.agent.OnSelectedPairRTT(func(s RTTSample) {
+		select {
+		case samples <- s:
+		default:
+		}
+	}))
+
+	// The keepalives of the selected pair are sampled
+	s := <-samples
+	pair := aConn.agent.getSelectedPair()
+	assert.Equal(t, pair.Local.ID(), s.LocalCandidateID)
+	assert.Equal(t, pair.Remote.ID(), s.RemoteCandidateID)
+	assert.False(t, s.Timestamp.IsZero())
+	assert.Greater(t, s.RTT, time.Duration(0))
+
+	assert.NoError(t, aConn.Close())
+	assert.NoError(t, bConn.Close())
+}
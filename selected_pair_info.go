@@ -0,0 +1,134 @@
+package ice
+
+import (
+	"net"
+)
+
+// SelectedPairInfo describes the path of the selected candidate pair, so an
+// application can adapt to it, e.g. when it moves from the LAN to a relay.
+type SelectedPairInfo struct {
+	LocalCandidateType  CandidateType
+	RemoteCandidateType CandidateType
+
+	// NetworkType is the network type of the local candidate
+	NetworkType NetworkType
+
+	// Interface is the name of the local network interface the pair is sent
+	// from, empty when the socket of the local candidate is not bound to a
+	// single interface, e.g. for relay candidates
+	Interface string
+
+	// RelayProtocol is the protocol to the TURN server of a local relay
+	// candidate: udp, tcp or tls
+	RelayProtocol string
+}
+
+// Relayed reports whether the pair goes through a TURN server.
+func (i SelectedPairInfo) Relayed() bool {
+	return i.LocalCandidateType == CandidateTypeRelay || i.RemoteCandidateType == CandidateTypeRelay
+}
+
+// GetSelectedPairInfo returns the description of the path of the selected
+// candidate pair, nil if no pair is selected.
+func (a *Agent) GetSelectedPairInfo() (*SelectedPairInfo, error) {
+	p := a.getSelectedPair()
+	if p == nil {
+		return nil, nil //nolint:nilnil
+	}
+	info := a.selectedPairInfo(p)
+	return &info, nil
+}
+
+// OnSelectedPairInfoChange sets a handler that is fired when a pair is
+// selected whose SelectedPairInfo differs from the previously selected one.
+func (a *Agent) OnSelectedPairInfoChange(f func(SelectedPairInfo)) error {
+	a.onSelectedPairInfoChangeHdlr.Store(f)
+	return nil
+}
+
+func (a *Agent) onSelectedPairInfoChange(info SelectedPairInfo) {
+	if h, ok := a.onSelectedPairInfoChangeHdlr.Load().(func(SelectedPairInfo)); ok {
+		h(info)
+	}
+}
+
+// updateSelectedPairInfo notifies the handler of OnSelectedPairInfoChange
+// if the path of the newly selected pair p differs from the previous one.
+//
+// Note: the caller should hold the agent lock.
+func (a *Agent) updateSelectedPairInfo(p *CandidatePair) {
+	if p == nil {
+		a.lastSelectedPairInfo = nil
+		return
+	}
+
+	info := a.selectedPairInfo(p)
+	if a.lastSelectedPairInfo != nil && *a.lastSelectedPairInfo == info {
+		return
+	}
+	a.lastSelectedPairInfo = &info
+	a.pairHandlers.push(func() {
+		a.onSelectedPairInfoChange(info)
+	})
+}
+
+func (a *Agent) selectedPairInfo(p *CandidatePair) SelectedPairInfo {
+	info := SelectedPairInfo{
+		LocalCandidateType:  p.Local.Type(),
+		RemoteCandidateType: p.Remote.Type(),
+		NetworkType:         p.Local.NetworkType(),
+		Interface:           a.interfaceName(candidateLocalIP(p.Local)),
+	}
+	if relay, ok := p.Local.(*CandidateRelay); ok {
+		info.RelayProtocol = relay.RelayProtocol()
+	}
+	return info
+}
+
+// candidateLocalIP returns the local IP the socket of a local candidate is
+// bound to, nil if it is bound to all of them.
+func candidateLocalIP(c Candidate) net.IP {
+	if c.Type() == CandidateTypeRelay {
+		return nil
+	}
+	if conn := candidateSocket(c); conn != nil {
+		if ip, _, _, ok := parseAddr(conn.LocalAddr()); ok && !ip.IsUnspecified() {
+			return ip
+		}
+	}
+	if c.Type() == CandidateTypeHost {
+		return net.ParseIP(c.Address())
+	}
+	return nil
+}
+
+// interfaceName returns the name of the network interface with ip, empty if
+// there is none.
+func (a *Agent) interfaceName(ip net.IP) string {
+	if ip == nil || a.customTransport() {
+		return ""
+	}
+	ifaces, err := a.net.Interfaces()
+	if err != nil {
+		return ""
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			var ifaceIP net.IP
+			switch addr := addr.(type) {
+			case *net.IPNet:
+				ifaceIP = addr.IP
+			case *net.IPAddr:
+				ifaceIP = addr.IP
+			}
+			if ifaceIP.Equal(ip) {
+				return iface.Name
+			}
+		}
+	}
+	return ""
+}
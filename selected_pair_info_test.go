@@ -0,0 +1,104 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/transport/test"
+	"github.com/pion/transport/vnet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectedPairInfo(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	router, err := vnet.NewRouter(&vnet.RouterConfig{
+		CIDR:          "10.0.0.0/24",
+		LoggerFactory: logging.NewDefaultLoggerFactory(),
+	})
+	require.NoError(t, err)
+	nw := vnet.NewNet(&vnet.NetConfig{StaticIPs: []string{"10.0.0.2"}})
+	require.NoError(t, router.AddNet(nw))
+
+	a, err := NewAgent(&AgentConfig{Net: nw})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	infos := make(chan SelectedPairInfo, 3)
+	require.NoError(t, a.OnSelectedPairInfoChange(func(info SelectedPairInfo) {
+		infos <- info
+	}))
+
+	info, err := a.GetSelectedPairInfo()
+	require.NoError(t, err)
+	assert.Nil(t, info)
+
+	host, err := NewCandidateHost(&CandidateHostConfig{Network: "udp", Address: "10.0.0.2", Port: 5000, Component: 1})
+	require.NoError(t, err)
+	relay, err := NewCandidateRelay(&CandidateRelayConfig{
+		Network: "udp", Address: "1.2.3.4", Port: 3478, Component: 1,
+		RelAddr: "10.0.0.2", RelPort: 5001, RelayProtocol: "tcp",
+	})
+	require.NoError(t, err)
+	remote1, err := NewCandidateHost(&CandidateHostConfig{Network: "udp", Address: "10.0.0.3", Port: 5000, Component: 1})
+	require.NoError(t, err)
+	remote2, err := NewCandidateHost(&CandidateHostConfig{Network: "udp", Address: "10.0.0.4", Port: 5000, Component: 1})
+	require.NoError(t, err)
+
+	selectPair := func(local, remote Candidate) {
+		require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+			agent.setSelectedPair(newCandidatePair(local, remote, false))
+		}))
+	}
+	next := func() SelectedPairInfo {
+		select {
+		case info := <-infos:
+			return info
+		case <-time.After(time.Second):
+			t.Fatal("selected pair info change not notified")
+		}
+		return SelectedPairInfo{}
+	}
+
+	selectPair(host, remote1)
+	lan := SelectedPairInfo{
+		LocalCandidateType:  CandidateTypeHost,
+		RemoteCandidateType: CandidateTypeHost,
+		NetworkType:         NetworkTypeUDP4,
+		Interface:           "eth0",
+	}
+	assert.Equal(t, lan, next())
+	assert.False(t, lan.Relayed())
+
+	info, err = a.GetSelectedPairInfo()
+	require.NoError(t, err)
+	assert.Equal(t, &lan, info)
+
+	// The path of another pair on the same interface is unchanged
+	selectPair(host, remote2)
+
+	selectPair(relay, remote1)
+	relayed := next()
+	assert.Equal(t, SelectedPairInfo{
+		LocalCandidateType:  CandidateTypeRelay,
+		RemoteCandidateType: CandidateTypeHost,
+		NetworkType:         NetworkTypeUDP4,
+		RelayProtocol:       "tcp",
+	}, relayed)
+	assert.True(t, relayed.Relayed())
+
+	select {
+	case info := <-infos:
+		t.Fatalf("unexpected selected pair info change %v", info)
+	default:
+	}
+}
@@ -12,6 +12,7 @@ type pairCandidateSelector interface {
 	Start()
 	ContactCandidates()
 	PingCandidate(local, remote Candidate)
+	PingPair(p *CandidatePair)
 	HandleSuccessResponse(m *stun.Message, local, remote Candidate, remoteAddr net.Addr)
 	HandleBindingRequest(m *stun.Message, local, remote Candidate)
 }
@@ -24,26 +25,42 @@ type controllingSelector struct {
 }
 
 func (s *controllingSelector) Start() {
-	s.startTime = time.Now()
+	s.startTime = s.agent.clock.Now()
 	s.nominatedPair = nil
 }
 
 func (s *controllingSelector) isNominatable(c Candidate) bool {
 	switch {
 	case c.Type() == CandidateTypeHost:
-		return time.Since(s.startTime).Nanoseconds() > s.agent.hostAcceptanceMinWait.Nanoseconds()
+		return s.agent.clock.Now().Sub(s.startTime).Nanoseconds() > s.agent.hostAcceptanceMinWait.Nanoseconds()
 	case c.Type() == CandidateTypeServerReflexive:
-		return time.Since(s.startTime).Nanoseconds() > s.agent.srflxAcceptanceMinWait.Nanoseconds()
+		return s.agent.clock.Now().Sub(s.startTime).Nanoseconds() > s.agent.srflxAcceptanceMinWait.Nanoseconds()
 	case c.Type() == CandidateTypePeerReflexive:
-		return time.Since(s.startTime).Nanoseconds() > s.agent.prflxAcceptanceMinWait.Nanoseconds()
+		return s.agent.clock.Now().Sub(s.startTime).Nanoseconds() > s.agent.prflxAcceptanceMinWait.Nanoseconds()
 	case c.Type() == CandidateTypeRelay:
-		return time.Since(s.startTime).Nanoseconds() > s.agent.relayAcceptanceMinWait.Nanoseconds()
+		return s.agent.clock.Now().Sub(s.startTime).Nanoseconds() > s.agent.relayAcceptanceMinWait.Nanoseconds()
+	case c.Type() >= firstCustomCandidateType:
+		return s.agent.clock.Now().Sub(s.startTime).Nanoseconds() > s.agent.customAcceptanceMinWait(c.Type()).Nanoseconds()
 	}
 
 	s.log.Errorf("isNominatable invalid candidate type %s", c.Type().String())
 	return false
 }
 
+// customAcceptanceMinWait returns the acceptance wait of a registered
+// candidate type: the wait of the gathered type whose preference is the
+// highest at or below its own, relay being the lowest.
+func (a *Agent) customAcceptanceMinWait(t CandidateType) time.Duration {
+	switch pref := a.typePreference(t); {
+	case pref >= CandidateTypeHost.Preference():
+		return a.hostAcceptanceMinWait
+	case pref >= CandidateTypeServerReflexive.Preference():
+		return a.srflxAcceptanceMinWait
+	default:
+		return a.relayAcceptanceMinWait
+	}
+}
+
 func (s *controllingSelector) ContactCandidates() {
 	switch {
 	case s.agent.getSelectedPair() != nil:
@@ -71,20 +88,14 @@ func (s *controllingSelector) nominatePair(pair *CandidatePair) {
 	// order to nominate a candidate pair (Section 8.1.1).  The controlled
 	// agent MUST NOT include the USE-CANDIDATE attribute in a Binding
 	// request.
-	msg, err := stun.Build(stun.BindingRequest, stun.TransactionID,
-		stun.NewUsername(s.agent.remoteUfrag+":"+s.agent.localUfrag),
-		UseCandidate(),
-		AttrControlling(s.agent.tieBreaker),
-		PriorityAttr(pair.Local.Priority()),
-		stun.NewShortTermIntegrity(s.agent.remotePwd),
-		stun.Fingerprint,
-	)
+	msg, err := s.agent.buildBindingRequest(pair.Local, true, true)
 	if err != nil {
 		s.log.Error(err.Error())
 		return
 	}
 
-	s.log.Tracef("ping STUN (nominate candidate pair) from %s to %s", pair.Local.String(), pair.Remote.String())
+	s.log.Tracef("ping STUN (nominate candidate pair) from %s to %s", pair.Local, pair.Remote)
+	s.agent.startNominationSpan(pair)
 	s.agent.sendBindingRequest(msg, pair.Local, pair.Remote)
 }
 
@@ -112,23 +123,13 @@ func (s *controllingSelector) HandleBindingRequest(m *stun.Message, local, remot
 }
 
 func (s *controllingSelector) HandleSuccessResponse(m *stun.Message, local, remote Candidate, remoteAddr net.Addr) {
-	ok, pendingRequest := s.agent.handleInboundBindingSuccess(m.TransactionID)
+	pendingRequest, ok := s.agent.matchBindingResponse(m, local, remote, remoteAddr)
 	if !ok {
-		s.log.Warnf("discard message from (%s), unknown TransactionID 0x%x", remote, m.TransactionID)
-		return
-	}
-
-	transactionAddr := pendingRequest.destination
-
-	// Assert that NAT is not symmetric
-	// https://tools.ietf.org/html/rfc8445#section-7.2.5.2.1
-	if !addrEqual(transactionAddr, remoteAddr) {
-		s.log.Debugf("discard message: transaction source and destination does not match expected(%s), actual(%s)", transactionAddr, remote)
 		return
 	}
 
-	s.log.Tracef("inbound STUN (SuccessResponse) from %s to %s", remote.String(), local.String())
-	p := s.agent.findPair(local, remote)
+	s.log.Tracef("inbound STUN (SuccessResponse) from %s to %s", remote, local)
+	p := s.agent.findPair(pendingRequest.local, remote)
 
 	if p == nil {
 		// This shouldn't happen
@@ -136,6 +137,7 @@ func (s *controllingSelector) HandleSuccessResponse(m *stun.Message, local, remo
 		return
 	}
 
+	s.agent.recordRoundTripTime(p, s.agent.clock.Now().Sub(pendingRequest.timestamp))
 	p.state = CandidatePairStateSucceeded
 	s.log.Tracef("Found valid candidate pair: %s", p)
 	if pendingRequest.isUseCandidate && s.agent.getSelectedPair() == nil {
@@ -144,13 +146,7 @@ func (s *controllingSelector) HandleSuccessResponse(m *stun.Message, local, remo
 }
 
 func (s *controllingSelector) PingCandidate(local, remote Candidate) {
-	msg, err := stun.Build(stun.BindingRequest, stun.TransactionID,
-		stun.NewUsername(s.agent.remoteUfrag+":"+s.agent.localUfrag),
-		AttrControlling(s.agent.tieBreaker),
-		PriorityAttr(local.Priority()),
-		stun.NewShortTermIntegrity(s.agent.remotePwd),
-		stun.Fingerprint,
-	)
+	msg, err := s.agent.buildBindingRequest(local, true, false)
 	if err != nil {
 		s.log.Error(err.Error())
 		return
@@ -159,6 +155,16 @@ func (s *controllingSelector) PingCandidate(local, remote Candidate) {
 	s.agent.sendBindingRequest(msg, local, remote)
 }
 
+func (s *controllingSelector) PingPair(p *CandidatePair) {
+	msg, err := s.agent.buildPairBindingRequest(p, true)
+	if err != nil {
+		s.log.Error(err.Error())
+		return
+	}
+
+	s.agent.sendBindingRequest(msg, p.Local, p.Remote)
+}
+
 type controlledSelector struct {
 	agent *Agent
 	log   logging.LeveledLogger
@@ -179,13 +185,7 @@ func (s *controlledSelector) ContactCandidates() {
 }
 
 func (s *controlledSelector) PingCandidate(local, remote Candidate) {
-	msg, err := stun.Build(stun.BindingRequest, stun.TransactionID,
-		stun.NewUsername(s.agent.remoteUfrag+":"+s.agent.localUfrag),
-		AttrControlled(s.agent.tieBreaker),
-		PriorityAttr(local.Priority()),
-		stun.NewShortTermIntegrity(s.agent.remotePwd),
-		stun.Fingerprint,
-	)
+	msg, err := s.agent.buildBindingRequest(local, false, false)
 	if err != nil {
 		s.log.Error(err.Error())
 		return
@@ -194,6 +194,16 @@ func (s *controlledSelector) PingCandidate(local, remote Candidate) {
 	s.agent.sendBindingRequest(msg, local, remote)
 }
 
+func (s *controlledSelector) PingPair(p *CandidatePair) {
+	msg, err := s.agent.buildPairBindingRequest(p, false)
+	if err != nil {
+		s.log.Error(err.Error())
+		return
+	}
+
+	s.agent.sendBindingRequest(msg, p.Local, p.Remote)
+}
+
 func (s *controlledSelector) HandleSuccessResponse(m *stun.Message, local, remote Candidate, remoteAddr net.Addr) {
 	// nolint:godox
 	// TODO according to the standard we should specifically answer a failed nomination:
@@ -203,30 +213,21 @@ func (s *controlledSelector) HandleSuccessResponse(m *stun.Message, local, remot
 	// request with an appropriate error code response (e.g., 400)
 	// [RFC5389].
 
-	ok, pendingRequest := s.agent.handleInboundBindingSuccess(m.TransactionID)
+	pendingRequest, ok := s.agent.matchBindingResponse(m, local, remote, remoteAddr)
 	if !ok {
-		s.log.Warnf("discard message from (%s), unknown TransactionID 0x%x", remote, m.TransactionID)
-		return
-	}
-
-	transactionAddr := pendingRequest.destination
-
-	// Assert that NAT is not symmetric
-	// https://tools.ietf.org/html/rfc8445#section-7.2.5.2.1
-	if !addrEqual(transactionAddr, remoteAddr) {
-		s.log.Debugf("discard message: transaction source and destination does not match expected(%s), actual(%s)", transactionAddr, remote)
 		return
 	}
 
-	s.log.Tracef("inbound STUN (SuccessResponse) from %s to %s", remote.String(), local.String())
+	s.log.Tracef("inbound STUN (SuccessResponse) from %s to %s", remote, local)
 
-	p := s.agent.findPair(local, remote)
+	p := s.agent.findPair(pendingRequest.local, remote)
 	if p == nil {
 		// This shouldn't happen
 		s.log.Error("Success response from invalid candidate pair")
 		return
 	}
 
+	s.agent.recordRoundTripTime(p, s.agent.clock.Now().Sub(pendingRequest.timestamp))
 	p.state = CandidatePairStateSucceeded
 	s.log.Tracef("Found valid candidate pair: %s", p)
 	if p.nominateOnBindingSuccess {
@@ -252,7 +253,11 @@ func (s *controlledSelector) HandleBindingRequest(m *stun.Message, local, remote
 			// previously sent by this pair produced a successful response and
 			// generated a valid pair (Section 7.2.5.3.2).  The agent sets the
 			// nominated flag value of the valid pair to true.
-			if selectedPair := s.agent.getSelectedPair(); selectedPair == nil || selectedPair.priority() < p.priority() {
+			if selectedPair := s.agent.getSelectedPair(); s.agent.acceptsNomination(p, selectedPair) {
+				if !s.agent.acceptsNominationPolicy(p, selectedPair) {
+					s.refuseNomination(m, local, remote)
+					return
+				}
 				s.agent.setSelectedPair(p)
 			} else if selectedPair != p {
 				s.log.Tracef("ignore nominate new pair %s, already nominated pair %s", p, selectedPair)
@@ -266,6 +271,10 @@ func (s *controlledSelector) HandleBindingRequest(m *stun.Message, local, remote
 			// MUST remove the candidate pair from the valid list, set the
 			// candidate pair state to Failed, and set the checklist state to
 			// Failed.
+			if !s.agent.acceptsNominationPolicy(p, s.agent.getSelectedPair()) {
+				s.refuseNomination(m, local, remote)
+				return
+			}
 			p.nominateOnBindingSuccess = true
 		}
 	}
@@ -274,6 +283,13 @@ func (s *controlledSelector) HandleBindingRequest(m *stun.Message, local, remote
 	s.PingCandidate(local, remote)
 }
 
+// refuseNomination rejects the binding request m, the pair is still checked
+// so that it can be nominated again.
+func (s *controlledSelector) refuseNomination(m *stun.Message, local, remote Candidate) {
+	s.agent.refuseNomination(m, local, remote)
+	s.PingCandidate(local, remote)
+}
+
 type liteSelector struct {
 	pairCandidateSelector
 }
@@ -0,0 +1,82 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptanceMinWait(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	clock := NewManualClock(time.Now())
+	hostWait, srflxWait, prflxWait, relayWait := time.Duration(0), 100*time.Millisecond, 200*time.Millisecond, 5*time.Second
+	a, err := NewAgent(&AgentConfig{
+		Clock:                  clock,
+		HostAcceptanceMinWait:  &hostWait,
+		SrflxAcceptanceMinWait: &srflxWait,
+		PrflxAcceptanceMinWait: &prflxWait,
+		RelayAcceptanceMinWait: &relayWait,
+	})
+	require.NoError(t, err)
+
+	host, err := NewCandidateHost(&CandidateHostConfig{Network: "udp", Address: "192.0.2.1", Port: 1000, Component: 1})
+	require.NoError(t, err)
+	srflx, err := NewCandidateServerReflexive(&CandidateServerReflexiveConfig{Network: "udp", Address: "192.0.2.2", Port: 1000, Component: 1})
+	require.NoError(t, err)
+	prflx, err := NewCandidatePeerReflexive(&CandidatePeerReflexiveConfig{Network: "udp", Address: "192.0.2.3", Port: 1000, Component: 1})
+	require.NoError(t, err)
+	relay, err := NewCandidateRelay(&CandidateRelayConfig{Network: "udp", Address: "192.0.2.4", Port: 1000, Component: 1})
+	require.NoError(t, err)
+
+	s := &controllingSelector{agent: a, log: a.log}
+	s.Start()
+
+	nominatable := func() []bool {
+		return []bool{s.isNominatable(host), s.isNominatable(srflx), s.isNominatable(prflx), s.isNominatable(relay)}
+	}
+
+	clock.Advance(time.Millisecond)
+	assert.Equal(t, []bool{true, false, false, false}, nominatable())
+	clock.Advance(150 * time.Millisecond)
+	assert.Equal(t, []bool{true, true, false, false}, nominatable())
+	clock.Advance(time.Second)
+	assert.Equal(t, []bool{true, true, true, false}, nominatable())
+	clock.Advance(5 * time.Second)
+	assert.Equal(t, []bool{true, true, true, true}, nominatable())
+
+	assert.NoError(t, a.Close())
+}
+
+func TestAcceptanceMinWaitCustomType(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	srflxWait, relayWait := 100*time.Millisecond, 5*time.Second
+	a, err := NewAgent(&AgentConfig{
+		SrflxAcceptanceMinWait: &srflxWait,
+		RelayAcceptanceMinWait: &relayWait,
+		TypePreferences:        map[CandidateType]uint16{overlayCandidateType(t): 105},
+	})
+	require.NoError(t, err)
+
+	// Between srflx and prflx: waits as srflx
+	assert.Equal(t, srflxWait, a.customAcceptanceMinWait(overlayCandidateType(t)))
+	assert.NoError(t, a.Close())
+
+	// The registered preference of overlay is below srflx: waits as relay
+	a, err = NewAgent(&AgentConfig{
+		SrflxAcceptanceMinWait: &srflxWait,
+		RelayAcceptanceMinWait: &relayWait,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, relayWait, a.customAcceptanceMinWait(overlayCandidateType(t)))
+	assert.NoError(t, a.Close())
+}
@@ -0,0 +1,216 @@
+package ice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"syscall"
+)
+
+// socketBudget accounts for the sockets owned by the local candidates of an
+// agent, see AgentConfig.MaxSockets. It also remembers when the system ran
+// out of ports or file descriptors, so a gathering stops opening sockets
+// rather than failing on each of them.
+type socketBudget struct {
+	max int
+
+	mu sync.Mutex
+	// reserved counts the sockets opened for candidates not added yet, or
+	// abandoned by the current gathering
+	reserved int
+	// held counts the sockets left for the candidate types gathered next,
+	// see hold
+	held int
+	// candidates are the done channels of the local candidates owning a
+	// socket, closed ones are pruned when the budget is checked
+	candidates []<-chan struct{}
+	// exhausted is the error that made the system run out of sockets
+	exhausted error
+	// reported is set once a shortage was reported by the current gathering
+	reported bool
+}
+
+// reserve accounts for a socket about to be opened. It fails with
+// ErrSocketBudgetExhausted if the budget is spent, or with
+// ErrSocketsExhausted if the system already ran out of sockets.
+func (b *socketBudget) reserve() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.exhausted != nil {
+		return fmt.Errorf("%w: %v", ErrSocketsExhausted, b.exhausted)
+	}
+	if b.max <= 0 {
+		return nil
+	}
+
+	live := b.candidates[:0]
+	for _, done := range b.candidates {
+		select {
+		case <-done:
+		default:
+			live = append(live, done)
+		}
+	}
+	for i := len(live); i < len(b.candidates); i++ {
+		b.candidates[i] = nil
+	}
+	b.candidates = live
+
+	if b.reserved+len(b.candidates)+b.held >= b.max {
+		return ErrSocketBudgetExhausted
+	}
+	b.reserved++
+	return nil
+}
+
+// release gives back a reservation whose socket could not be opened.
+func (b *socketBudget) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.reserved > 0 {
+		b.reserved--
+	}
+}
+
+// add turns a reservation into the started candidate c, accounted for until
+// it is closed.
+func (b *socketBudget) add(c Candidate) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.max <= 0 {
+		return
+	}
+	if b.reserved > 0 {
+		b.reserved--
+	}
+	if started, ok := c.(interface{ Done() <-chan struct{} }); ok && started.Done() != nil {
+		b.candidates = append(b.candidates, started.Done())
+	}
+}
+
+// reset forgets the exhaustion of the previous gathering, when a new one
+// starts.
+func (b *socketBudget) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.exhausted = nil
+	b.reported = false
+}
+
+// hold keeps n sockets of the budget for the candidate types gathered
+// next, until hold is called again.
+func (b *socketBudget) hold(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.held = n
+}
+
+// clearReservations forgets the reservations abandoned by a gathering once
+// it is complete.
+func (b *socketBudget) clearReservations() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.reserved = 0
+	b.held = 0
+}
+
+// setExhausted records that the system ran out of sockets if err says so.
+func (b *socketBudget) setExhausted(err error) bool {
+	if !isSocketExhaustion(err) {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.exhausted == nil {
+		b.exhausted = err
+	}
+	return true
+}
+
+// report returns true the first time it is called by a gathering.
+func (b *socketBudget) report() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	reported := b.reported
+	b.reported = true
+	return !reported
+}
+
+// isSocketExhaustion reports whether err is a failure to open a socket for
+// lack of ports or file descriptors.
+func isSocketExhaustion(err error) bool {
+	return errors.Is(err, ErrPort) ||
+		errors.Is(err, syscall.EADDRINUSE) ||
+		errors.Is(err, syscall.EMFILE) ||
+		errors.Is(err, syscall.ENFILE)
+}
+
+// heldSockets returns how many sockets to keep for the candidate types
+// gathered after the first one of types: one for each that opens sockets of
+// its own, so the more preferred types, e.g. host candidates on many
+// interfaces, do not starve the relay candidates.
+func (a *Agent) heldSockets(types []CandidateType, urls []*URL) int {
+	held := 0
+	for _, t := range types[1:] {
+		switch t {
+		case CandidateTypeServerReflexive:
+			mapped := a.extIPMapper != nil && a.extIPMapper.candidateType == CandidateTypeServerReflexive
+			if a.udpMuxSrflx == nil && (len(urls) > 0 || mapped) {
+				held++
+			}
+		case CandidateTypeRelay:
+			for _, url := range urls {
+				if url.Scheme == SchemeTypeTURN || url.Scheme == SchemeTypeTURNS {
+					held++
+					break
+				}
+			}
+		case CandidateTypeHost, CandidateTypePeerReflexive, CandidateTypeUnspecified:
+		}
+	}
+	return held
+}
+
+// reserveSocket reserves a socket for a candidate of type candidateType. If
+// it can not, the shortage is recorded as a gathering error, once per
+// gathering, and false is returned.
+func (a *Agent) reserveSocket(ctx context.Context, candidateType CandidateType, network string) bool {
+	err := a.sockets.reserve()
+	if err == nil {
+		return true
+	}
+	a.reportSocketShortage(ctx, candidateType, network, err)
+	return false
+}
+
+// handleSocketError releases the reservation of a socket that could not be
+// opened. It returns true if the system ran out of sockets, in which case
+// the shortage is reported and no more sockets are opened until the next
+// gathering.
+func (a *Agent) handleSocketError(ctx context.Context, candidateType CandidateType, network string, err error) bool {
+	a.sockets.release()
+	if !a.sockets.setExhausted(err) {
+		return false
+	}
+	a.reportSocketShortage(ctx, candidateType, network, fmt.Errorf("%w: %v", ErrSocketsExhausted, err))
+	return true
+}
+
+func (a *Agent) reportSocketShortage(ctx context.Context, candidateType CandidateType, network string, err error) {
+	if !a.sockets.report() {
+		a.log.Debugf("Skipping %s candidate (%s): %v", candidateType, network, err)
+		return
+	}
+	a.log.Warnf("Skipping %s candidate (%s) and the following ones: %v", candidateType, network, err)
+	a.recordLocalError(ctx, candidateType, network, "", err)
+}
@@ -0,0 +1,82 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/pion/logging"
+	"github.com/pion/transport/test"
+	"github.com/pion/transport/vnet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxSockets(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	router, err := vnet.NewRouter(&vnet.RouterConfig{
+		CIDR:          "10.0.0.0/24",
+		LoggerFactory: logging.NewDefaultLoggerFactory(),
+	})
+	require.NoError(t, err)
+	nw := vnet.NewNet(&vnet.NetConfig{StaticIPs: []string{"10.0.0.2", "10.0.0.3"}})
+	require.NoError(t, router.AddNet(nw))
+
+	a, err := NewAgent(&AgentConfig{
+		NetworkTypes: []NetworkType{NetworkTypeUDP4},
+		// The budget goes to host candidates first, whatever the order, but
+		// a socket is kept for the server reflexive one
+		CandidateTypes:         []CandidateType{CandidateTypeServerReflexive, CandidateTypeHost},
+		NAT1To1IPs:             []string{"1.2.3.4"},
+		NAT1To1IPCandidateType: CandidateTypeServerReflexive,
+		Net:                    nw,
+		Synchronous:            true,
+		MaxSockets:             2,
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	var candidates []Candidate
+	require.NoError(t, a.OnCandidate(func(c Candidate) {
+		if c != nil {
+			candidates = append(candidates, c)
+		}
+	}))
+
+	err = a.GatherCandidates()
+	require.Len(t, candidates, 2)
+	assert.Equal(t, CandidateTypeHost, candidates[0].Type())
+	assert.Equal(t, CandidateTypeServerReflexive, candidates[1].Type())
+
+	// The shortage is reported once, not for every skipped candidate
+	var gatheringErr *GatheringError
+	require.True(t, errors.As(err, &gatheringErr))
+	require.Len(t, gatheringErr.Errors, 1)
+	assert.ErrorIs(t, err, ErrSocketBudgetExhausted)
+	assert.Equal(t, CandidateTypeHost, gatheringErr.Errors[0].CandidateType)
+
+	// Closing a candidate gives its socket back
+	assert.ErrorIs(t, a.sockets.reserve(), ErrSocketBudgetExhausted)
+	require.NoError(t, a.RemoveLocalCandidate(candidates[0]))
+	assert.NoError(t, a.sockets.reserve())
+}
+
+func TestIsSocketExhaustion(t *testing.T) {
+	for _, err := range []error{
+		ErrPort,
+		&os.SyscallError{Syscall: "socket", Err: syscall.EMFILE},
+		fmt.Errorf("listen udp4: %w", syscall.EADDRINUSE),
+	} {
+		assert.True(t, isSocketExhaustion(err), err)
+	}
+	assert.False(t, isSocketExhaustion(syscall.ECONNREFUSED))
+}
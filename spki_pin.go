@@ -0,0 +1,74 @@
+package ice
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// spkiPinPrefix is the optional prefix of pins, as in HTTP public key pinning
+const spkiPinPrefix = "sha256/"
+
+// SPKIPin returns the pin of cert for AgentConfig.TURNServerSPKIPins, the
+// base64 SHA-256 hash of its SubjectPublicKeyInfo, e.g. "sha256/47DEQpj8...".
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return spkiPinPrefix + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func (config *AgentConfig) initSPKIPins(a *Agent) error {
+	for _, pin := range config.TURNServerSPKIPins {
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, spkiPinPrefix))
+		if err != nil || len(raw) != sha256.Size {
+			return fmt.Errorf("%w: %q", ErrInvalidSPKIPin, pin)
+		}
+		a.spkiPins = append(a.spkiPins, raw)
+	}
+	return nil
+}
+
+// verifyTURNServerCertificate checks that the certificate presented by a TURN
+// server over TLS or DTLS has a pinned public key. The certificates of the
+// verified chains may be pinned, without verification (InsecureSkipVerify)
+// only the leaf is: the rest of rawCerts is whatever the server appended.
+func (a *Agent) verifyTURNServerCertificate(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	for _, chain := range verifiedChains {
+		for _, cert := range chain {
+			if a.isPinned(cert) {
+				return nil
+			}
+		}
+	}
+	if len(verifiedChains) == 0 && len(rawCerts) > 0 {
+		cert, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return err
+		}
+		if a.isPinned(cert) {
+			return nil
+		}
+	}
+	return ErrTURNServerCertificateNotPinned
+}
+
+func (a *Agent) isPinned(cert *x509.Certificate) bool {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	for _, pin := range a.spkiPins {
+		if subtle.ConstantTimeCompare(sum[:], pin) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// turnVerifyPeerCertificate returns the VerifyPeerCertificate of the TLS and
+// DTLS connections to TURN servers, nil without pins.
+func (a *Agent) turnVerifyPeerCertificate() func([][]byte, [][]*x509.Certificate) error {
+	if len(a.spkiPins) == 0 {
+		return nil
+	}
+	return a.verifyTURNServerCertificate
+}
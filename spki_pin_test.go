@@ -0,0 +1,54 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"github.com/pion/dtls/v2/pkg/crypto/selfsign"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTURNServerSPKIPins(t *testing.T) {
+	newCert := func() ([]byte, *x509.Certificate) {
+		tlsCert, err := selfsign.GenerateSelfSigned()
+		require.NoError(t, err)
+		cert, err := x509.ParseCertificate(tlsCert.Certificate[0])
+		require.NoError(t, err)
+		return tlsCert.Certificate[0], cert
+	}
+	rawCurrent, current := newCert()
+	rawNext, next := newCert()
+	rawOther, other := newCert()
+
+	_, err := NewAgent(&AgentConfig{TURNServerSPKIPins: []string{"sha256/invalid"}})
+	assert.ErrorIs(t, err, ErrInvalidSPKIPin)
+
+	a, err := NewAgent(&AgentConfig{})
+	require.NoError(t, err)
+	assert.Nil(t, a.turnVerifyPeerCertificate())
+	assert.NoError(t, a.Close())
+
+	// The pin of the next key is listed ahead of the rotation
+	a, err = NewAgent(&AgentConfig{TURNServerSPKIPins: []string{SPKIPin(current), SPKIPin(next)[len(spkiPinPrefix):]}})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	verify := a.turnVerifyPeerCertificate()
+	require.NotNil(t, verify)
+	assert.NoError(t, verify([][]byte{rawCurrent}, nil))
+	assert.NoError(t, verify([][]byte{rawNext}, nil))
+	assert.ErrorIs(t, verify([][]byte{rawOther}, nil), ErrTURNServerCertificateNotPinned)
+
+	// A pinned certificate appended to the chain of a foreign leaf is not trusted
+	assert.ErrorIs(t, verify([][]byte{rawOther, rawCurrent}, nil), ErrTURNServerCertificateNotPinned)
+
+	// The pinned key may be the one of an intermediate of a verified chain
+	assert.NoError(t, verify([][]byte{rawOther, rawCurrent}, [][]*x509.Certificate{{other, current}}))
+	assert.ErrorIs(t, verify([][]byte{rawOther, rawCurrent}, [][]*x509.Certificate{{other}}), ErrTURNServerCertificateNotPinned)
+}
@@ -0,0 +1,89 @@
+package ice
+
+import (
+	"context"
+	"time"
+)
+
+// maxStateTransitions bounds the transitions of each state kept for
+// GetStateStats, a connection flapping for days would grow them unbounded.
+const maxStateTransitions = 32
+
+// GatheringStateTransition is a change of the gathering state of an agent.
+type GatheringStateTransition struct {
+	Timestamp time.Time
+	State     GatheringState
+}
+
+// ConnectionStateTransition is a change of the connection state of an agent.
+type ConnectionStateTransition struct {
+	Timestamp time.Time
+	State     ConnectionState
+	Reason    ConnectionStateChangeReason
+}
+
+// StateStats contains the gathering and connection states of an agent, and
+// when they changed.
+type StateStats struct {
+	// Timestamp is the time the stats were taken
+	Timestamp time.Time
+
+	GatheringState  GatheringState
+	ConnectionState ConnectionState
+
+	// GatheringStateTransitions and ConnectionStateTransitions are the last
+	// transitions of each state, oldest first. The first ones are the New
+	// states of the agent when it was created.
+	GatheringStateTransitions  []GatheringStateTransition
+	ConnectionStateTransitions []ConnectionStateTransition
+}
+
+// GatheringState returns the gathering state of the agent, as seen by the
+// agent rather than as last passed to a handler.
+func (a *Agent) GatheringState() (GatheringState, error) {
+	var state GatheringState
+	err := a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		state = agent.gatheringState
+	})
+	return state, err
+}
+
+// GetStateStats returns the gathering and connection states of the agent
+// along with their last transitions.
+func (a *Agent) GetStateStats() StateStats {
+	var res StateStats
+	err := a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		res = StateStats{
+			Timestamp:                  agent.clock.Now(),
+			GatheringState:             agent.gatheringState,
+			ConnectionState:            agent.connectionState,
+			GatheringStateTransitions:  append([]GatheringStateTransition{}, agent.gatheringTransitions...),
+			ConnectionStateTransitions: append([]ConnectionStateTransition{}, agent.connectionTransitions...),
+		}
+	})
+	if err != nil {
+		a.log.Errorf("error getting state stats %v", err)
+	}
+	return res
+}
+
+// recordGatheringState records the transition of the gathering state to state.
+// Note: the caller should hold the agent lock.
+func (a *Agent) recordGatheringState(state GatheringState) {
+	if len(a.gatheringTransitions) == maxStateTransitions {
+		copy(a.gatheringTransitions, a.gatheringTransitions[1:])
+		a.gatheringTransitions = a.gatheringTransitions[:maxStateTransitions-1]
+	}
+	a.gatheringTransitions = append(a.gatheringTransitions, GatheringStateTransition{a.clock.Now(), state})
+}
+
+// recordConnectionState records the transition of the connection state to
+// state.
+// Note: the caller should hold the agent lock.
+func (a *Agent) recordConnectionState(state ConnectionState, reason ConnectionStateChangeReason) {
+	if len(a.connectionTransitions) == maxStateTransitions {
+		copy(a.connectionTransitions, a.connectionTransitions[1:])
+		a.connectionTransitions = a.connectionTransitions[:maxStateTransitions-1]
+	}
+	a.connectionTransitions = append(a.connectionTransitions, ConnectionStateTransition{a.clock.Now(), state, reason})
+}
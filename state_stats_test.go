@@ -0,0 +1,68 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateStats(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewManualClock(created)
+	a, err := NewAgent(&AgentConfig{Clock: clock})
+	require.NoError(t, err)
+
+	state, err := a.GatheringState()
+	require.NoError(t, err)
+	assert.Equal(t, GatheringStateNew, state)
+
+	clock.Advance(time.Second)
+	require.NoError(t, a.setGatheringState(GatheringStateGathering))
+	clock.Advance(time.Second)
+	require.NoError(t, a.setGatheringState(GatheringStateComplete))
+	require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+		agent.updateConnectionState(ConnectionStateChecking, ConnectionStateChangeReasonChecksStarted)
+	}))
+
+	state, err = a.GatheringState()
+	require.NoError(t, err)
+	assert.Equal(t, GatheringStateComplete, state)
+
+	stats := a.GetStateStats()
+	assert.Equal(t, created.Add(2*time.Second), stats.Timestamp)
+	assert.Equal(t, GatheringStateComplete, stats.GatheringState)
+	assert.EqualValues(t, ConnectionStateChecking, stats.ConnectionState)
+	assert.Equal(t, []GatheringStateTransition{
+		{created, GatheringStateNew},
+		{created.Add(time.Second), GatheringStateGathering},
+		{created.Add(2 * time.Second), GatheringStateComplete},
+	}, stats.GatheringStateTransitions)
+	assert.Equal(t, []ConnectionStateTransition{
+		{created, ConnectionStateNew, ConnectionStateChangeReasonUnknown},
+		{created.Add(2 * time.Second), ConnectionStateChecking, ConnectionStateChangeReasonChecksStarted},
+	}, stats.ConnectionStateTransitions)
+
+	// Only the last transitions are kept
+	require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+		for i := 0; i < maxStateTransitions; i++ {
+			agent.recordGatheringState(GatheringStateGathering)
+		}
+	}))
+	stats = a.GetStateStats()
+	assert.Len(t, stats.GatheringStateTransitions, maxStateTransitions)
+	assert.Equal(t, GatheringStateGathering, stats.GatheringStateTransitions[0].State)
+
+	assert.NoError(t, a.Close())
+	_, err = a.GatheringState()
+	assert.ErrorIs(t, err, ErrClosed)
+}
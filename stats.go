@@ -2,6 +2,8 @@ package ice
 
 import (
 	"time"
+
+	"github.com/pion/stun"
 )
 
 // CandidatePairStats contains ICE candidate pair statistics
@@ -117,12 +119,48 @@ type CandidatePairStats struct {
 	// request retransmissions sent.
 	RetransmissionsSent uint64
 
+	// DeferredChecks is the number of times a connectivity check of the pair
+	// was deferred because of AgentConfig.MaxChecksPerRemoteIP.
+	DeferredChecks uint64
+
+	// ErrorResponsesReceived is the number of error responses received to
+	// the connectivity checks sent on this candidate pair.
+	ErrorResponsesReceived uint64
+
+	// LastErrorCode and LastErrorReason are those of the last error response
+	// received on this candidate pair, at LastErrorTimestamp. They are zero
+	// if none was received. An error response tells that the remote agent
+	// rejected a check, e.g. with 401 (Unauthorized) when the credentials do
+	// not match or 487 (Role Conflict), whereas a lost check gets no
+	// response at all.
+	LastErrorCode      stun.ErrorCode
+	LastErrorReason    string
+	LastErrorTimestamp time.Time
+
+	// UnmatchedResponsesReceived is the number of responses received on
+	// this candidate pair to no connectivity check sent recently.
+	UnmatchedResponsesReceived uint64
+
+	// DuplicateResponsesReceived is the number of responses received on
+	// this candidate pair to a connectivity check already answered.
+	DuplicateResponsesReceived uint64
+
+	// MismatchedResponsesReceived is the number of responses received on
+	// this candidate pair to a connectivity check sent on another pair,
+	// from another local candidate or to another address. Responses are
+	// only accepted on the pair their check was sent on.
+	MismatchedResponsesReceived uint64
+
 	// ConsentRequestsSent represents the total number of consent requests sent.
 	ConsentRequestsSent uint64
 
 	// ConsentExpiredTimestamp represents the timestamp at which the latest valid
 	// STUN binding response expired.
 	ConsentExpiredTimestamp time.Time
+
+	// RoundTripTimeHistogram is the distribution of the round trip times of
+	// the binding requests answered on this candidate pair.
+	RoundTripTimeHistogram RTTHistogram
 }
 
 // CandidateStats contains ICE candidate statistics related to the ICETransport objects.
@@ -167,6 +205,12 @@ type CandidateStats struct {
 	// the TURN URL protocol is one of udp, tcp, or tls.
 	RelayProtocol string
 
+	// GatheringStartTimestamp is when gathering of this candidate started,
+	// and GatheringCompleteTimestamp when its STUN or TURN transaction
+	// completed. Only present for local candidates.
+	GatheringStartTimestamp    time.Time
+	GatheringCompleteTimestamp time.Time
+
 	// Deleted is true if the candidate has been deleted/freed. For host candidates,
 	// this means that any network resources (typically a socket) associated with the
 	// candidate have been released. For TURN candidates, this means the TURN allocation
@@ -0,0 +1,119 @@
+package ice
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Identifiers follow the scheme used by browsers, so reports can be merged
+// with getStats() output from the remote peer.
+const (
+	statsTransportID           = "RTCTransport_0_1"
+	statsCandidateIDPrefix     = "RTCIceCandidate_"
+	statsCandidatePairIDPrefix = "RTCIceCandidatePair_"
+)
+
+// rtcIceCandidatePairStats mirrors RTCIceCandidatePairStats
+// https://www.w3.org/TR/webrtc-stats/#candidatepair-dict*
+type rtcIceCandidatePairStats struct {
+	ID                   string  `json:"id"`
+	Timestamp            float64 `json:"timestamp"`
+	Type                 string  `json:"type"`
+	TransportID          string  `json:"transportId"`
+	LocalCandidateID     string  `json:"localCandidateId"`
+	RemoteCandidateID    string  `json:"remoteCandidateId"`
+	State                string  `json:"state"`
+	Nominated            bool    `json:"nominated"`
+	PacketsSent          uint32  `json:"packetsSent"`
+	PacketsReceived      uint32  `json:"packetsReceived"`
+	BytesSent            uint64  `json:"bytesSent"`
+	BytesReceived        uint64  `json:"bytesReceived"`
+	TotalRoundTripTime   float64 `json:"totalRoundTripTime"`
+	CurrentRoundTripTime float64 `json:"currentRoundTripTime"`
+	RequestsReceived     uint64  `json:"requestsReceived"`
+	RequestsSent         uint64  `json:"requestsSent"`
+	ResponsesReceived    uint64  `json:"responsesReceived"`
+	ResponsesSent        uint64  `json:"responsesSent"`
+	ConsentRequestsSent  uint64  `json:"consentRequestsSent"`
+}
+
+// rtcIceCandidateStats mirrors RTCIceCandidateStats
+// https://www.w3.org/TR/webrtc-stats/#icecandidate-dict*
+type rtcIceCandidateStats struct {
+	ID            string  `json:"id"`
+	Timestamp     float64 `json:"timestamp"`
+	Type          string  `json:"type"`
+	TransportID   string  `json:"transportId"`
+	Address       string  `json:"address"`
+	Port          int     `json:"port"`
+	Protocol      string  `json:"protocol"`
+	CandidateType string  `json:"candidateType"`
+	Priority      uint32  `json:"priority"`
+	URL           string  `json:"url,omitempty"`
+	RelayProtocol string  `json:"relayProtocol,omitempty"`
+}
+
+// MarshalStatsJSON returns the candidate and candidate pair stats of the agent
+// as a JSON object keyed by stats id, using the field names and id scheme of
+// the W3C WebRTC stats (as returned by getStats() in browsers). Addresses are
+// redacted according to AgentConfig.AddressRedaction.
+func (a *Agent) MarshalStatsJSON() ([]byte, error) {
+	if err := a.ok(); err != nil {
+		return nil, err
+	}
+
+	report := map[string]interface{}{}
+
+	for _, s := range a.GetCandidatePairsStats() {
+		id := statsCandidatePairIDPrefix + s.LocalCandidateID + "_" + s.RemoteCandidateID
+		report[id] = rtcIceCandidatePairStats{
+			ID:                   id,
+			Timestamp:            statsTimestamp(s.Timestamp),
+			Type:                 "candidate-pair",
+			TransportID:          statsTransportID,
+			LocalCandidateID:     statsCandidateIDPrefix + s.LocalCandidateID,
+			RemoteCandidateID:    statsCandidateIDPrefix + s.RemoteCandidateID,
+			State:                s.State.String(),
+			Nominated:            s.Nominated,
+			PacketsSent:          s.PacketsSent,
+			PacketsReceived:      s.PacketsReceived,
+			BytesSent:            s.BytesSent,
+			BytesReceived:        s.BytesReceived,
+			TotalRoundTripTime:   s.TotalRoundTripTime,
+			CurrentRoundTripTime: s.CurrentRoundTripTime,
+			RequestsReceived:     s.RequestsReceived,
+			RequestsSent:         s.RequestsSent,
+			ResponsesReceived:    s.ResponsesReceived,
+			ResponsesSent:        s.ResponsesSent,
+			ConsentRequestsSent:  s.ConsentRequestsSent,
+		}
+	}
+
+	addCandidates := func(stats []CandidateStats, statsType string) {
+		for _, s := range stats {
+			id := statsCandidateIDPrefix + s.ID
+			report[id] = rtcIceCandidateStats{
+				ID:            id,
+				Timestamp:     statsTimestamp(s.Timestamp),
+				Type:          statsType,
+				TransportID:   statsTransportID,
+				Address:       a.redactor.Address(s.IP),
+				Port:          s.Port,
+				Protocol:      s.NetworkType.NetworkShort(),
+				CandidateType: s.CandidateType.String(),
+				Priority:      s.Priority,
+				URL:           a.redactor.Text(s.URL),
+				RelayProtocol: s.RelayProtocol,
+			}
+		}
+	}
+	addCandidates(a.GetLocalCandidatesStats(), "local-candidate")
+	addCandidates(a.GetRemoteCandidatesStats(), "remote-candidate")
+
+	return json.Marshal(report)
+}
+
+// statsTimestamp converts t to a DOMHighResTimeStamp, milliseconds since the Unix epoch
+func statsTimestamp(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Millisecond)
+}
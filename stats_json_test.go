@@ -0,0 +1,77 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalStatsJSON(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	a, err := NewAgent(&AgentConfig{})
+	assert.NoError(t, err)
+
+	local, err := NewCandidateHost(&CandidateHostConfig{
+		Network:   "udp",
+		Address:   "192.168.1.1",
+		Port:      19216,
+		Component: 1,
+	})
+	assert.NoError(t, err)
+
+	remote, err := NewCandidateServerReflexive(&CandidateServerReflexiveConfig{
+		Network:   "udp",
+		Address:   "10.10.10.2",
+		Port:      19218,
+		Component: 1,
+		RelAddr:   "4.3.2.1",
+		RelPort:   43212,
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+		agent.localCandidates[local.NetworkType()] = []Candidate{local}
+		agent.addRemoteCandidate(remote)
+	}))
+
+	b, err := a.MarshalStatsJSON()
+	assert.NoError(t, err)
+
+	var stats map[string]map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &stats))
+	assert.Len(t, stats, 3)
+
+	localStats := stats["RTCIceCandidate_"+local.ID()]
+	assert.Equal(t, "local-candidate", localStats["type"])
+	assert.Equal(t, "RTCIceCandidate_"+local.ID(), localStats["id"])
+	assert.Equal(t, "192.168.1.1", localStats["address"])
+	assert.Equal(t, float64(19216), localStats["port"])
+	assert.Equal(t, "udp", localStats["protocol"])
+	assert.Equal(t, "host", localStats["candidateType"])
+	assert.Equal(t, statsTransportID, localStats["transportId"])
+
+	remoteStats := stats["RTCIceCandidate_"+remote.ID()]
+	assert.Equal(t, "remote-candidate", remoteStats["type"])
+	assert.Equal(t, "srflx", remoteStats["candidateType"])
+
+	pairStats := stats["RTCIceCandidatePair_"+local.ID()+"_"+remote.ID()]
+	assert.Equal(t, "candidate-pair", pairStats["type"])
+	assert.Equal(t, "RTCIceCandidate_"+local.ID(), pairStats["localCandidateId"])
+	assert.Equal(t, "RTCIceCandidate_"+remote.ID(), pairStats["remoteCandidateId"])
+	assert.Equal(t, "waiting", pairStats["state"])
+	assert.Equal(t, false, pairStats["nominated"])
+	assert.NotZero(t, pairStats["timestamp"])
+
+	assert.NoError(t, a.Close())
+
+	_, err = a.MarshalStatsJSON()
+	assert.ErrorIs(t, err, ErrClosed)
+}
@@ -0,0 +1,163 @@
+package ice
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stream is a logical media stream bundled on the agent, e.g. one of the
+// m-lines of an SDP BUNDLE group. The streams share the candidate pairs of
+// the agent, the Stream only accounts for the data of each one.
+type Stream struct {
+	bytesReceived   uint64
+	bytesSent       uint64
+	packetsReceived uint64
+	packetsSent     uint64
+
+	id    string
+	agent *Agent
+}
+
+// StreamStats contains the statistics of a Stream.
+type StreamStats struct {
+	// Timestamp is the timestamp associated with this object.
+	Timestamp time.Time
+
+	// ID is the ID of the stream, see Agent.AddStream.
+	ID string
+
+	// LocalCandidateID and RemoteCandidateID are the candidates of the
+	// selected pair carrying the stream, empty if there is none.
+	LocalCandidateID  string
+	RemoteCandidateID string
+
+	// PacketsSent and BytesSent count the data written by Stream.Write.
+	PacketsSent uint64
+	BytesSent   uint64
+
+	// PacketsReceived and BytesReceived count the data attributed to the
+	// stream by AgentConfig.StreamClassifier.
+	PacketsReceived uint64
+	BytesReceived   uint64
+}
+
+// streams is the set of the streams bundled on an agent.
+type streams struct {
+	mu      sync.RWMutex
+	byID    map[string]*Stream
+	ordered []*Stream
+}
+
+// AddStream bundles a stream of the given ID on the agent. It returns
+// ErrStreamExists if the agent already has a stream of that ID.
+func (a *Agent) AddStream(id string) (*Stream, error) {
+	if err := a.ok(); err != nil {
+		return nil, err
+	}
+
+	a.streams.mu.Lock()
+	defer a.streams.mu.Unlock()
+	if _, ok := a.streams.byID[id]; ok {
+		return nil, ErrStreamExists
+	}
+	if a.streams.byID == nil {
+		a.streams.byID = map[string]*Stream{}
+	}
+	s := &Stream{id: id, agent: a}
+	a.streams.byID[id] = s
+	a.streams.ordered = append(a.streams.ordered, s)
+	return s, nil
+}
+
+// RemoveStream removes the stream of the given ID from the agent, the data
+// classified to it is no longer accounted for.
+func (a *Agent) RemoveStream(id string) {
+	a.streams.mu.Lock()
+	defer a.streams.mu.Unlock()
+	if _, ok := a.streams.byID[id]; !ok {
+		return
+	}
+	delete(a.streams.byID, id)
+	for i, s := range a.streams.ordered {
+		if s.id == id {
+			a.streams.ordered = append(a.streams.ordered[:i], a.streams.ordered[i+1:]...)
+			break
+		}
+	}
+}
+
+// GetStreamStats returns the stats of the streams of the agent, in the
+// order they were added.
+func (a *Agent) GetStreamStats() []StreamStats {
+	a.streams.mu.RLock()
+	ordered := append([]*Stream(nil), a.streams.ordered...)
+	a.streams.mu.RUnlock()
+
+	res := make([]StreamStats, 0, len(ordered))
+	for _, s := range ordered {
+		res = append(res, s.Stats())
+	}
+	return res
+}
+
+// streamReceived attributes a data packet received by the agent to the
+// stream returned by the classifier, if any.
+func (a *Agent) streamReceived(p []byte) {
+	if a.streamClassifier == nil {
+		return
+	}
+	id := a.streamClassifier(p)
+	if id == "" {
+		return
+	}
+
+	a.streams.mu.RLock()
+	s := a.streams.byID[id]
+	a.streams.mu.RUnlock()
+	if s == nil {
+		return
+	}
+	atomic.AddUint64(&s.packetsReceived, 1)
+	atomic.AddUint64(&s.bytesReceived, uint64(len(p)))
+}
+
+// ID returns the ID of the stream.
+func (s *Stream) ID() string {
+	return s.id
+}
+
+// Write sends p on the pair of the agent that Conn.Write would use, and
+// accounts for it in the stats of the stream once sent. It is not counted
+// by Conn.BytesSent, which only counts the data written to the Conn.
+func (s *Stream) Write(p []byte) (int, error) {
+	pair, err := s.agent.writablePair(p)
+	if pair == nil {
+		return 0, err
+	}
+
+	n, err := pair.Write(p)
+	if err != nil {
+		return n, err
+	}
+	atomic.AddUint64(&s.packetsSent, 1)
+	atomic.AddUint64(&s.bytesSent, uint64(n))
+	return n, nil
+}
+
+// Stats returns the stats of the stream.
+func (s *Stream) Stats() StreamStats {
+	stats := StreamStats{
+		Timestamp:       s.agent.clock.Now(),
+		ID:              s.id,
+		PacketsSent:     atomic.LoadUint64(&s.packetsSent),
+		BytesSent:       atomic.LoadUint64(&s.bytesSent),
+		PacketsReceived: atomic.LoadUint64(&s.packetsReceived),
+		BytesReceived:   atomic.LoadUint64(&s.bytesReceived),
+	}
+	if pair := s.agent.getSelectedPair(); pair != nil {
+		stats.LocalCandidateID = pair.Local.ID()
+		stats.RemoteCandidateID = pair.Remote.ID()
+	}
+	return stats
+}
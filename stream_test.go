@@ -0,0 +1,80 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStream(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	// The first byte tells the stream apart, as a MID would
+	aConn, bConn := pipe(&AgentConfig{
+		StreamClassifier: func(p []byte) string {
+			return string(p[:1])
+		},
+	})
+
+	aAudio, err := aConn.agent.AddStream("a")
+	require.NoError(t, err)
+	aVideo, err := aConn.agent.AddStream("v")
+	require.NoError(t, err)
+	_, err = aConn.agent.AddStream("a")
+	assert.ErrorIs(t, err, ErrStreamExists)
+
+	_, err = bConn.agent.AddStream("a")
+	require.NoError(t, err)
+	_, err = bConn.agent.AddStream("v")
+	require.NoError(t, err)
+
+	_, err = aAudio.Write([]byte("audio"))
+	require.NoError(t, err)
+	_, err = aVideo.Write([]byte("video!"))
+	require.NoError(t, err)
+	_, err = aVideo.Write([]byte("video"))
+	require.NoError(t, err)
+
+	// Both streams are read from the same Conn
+	buf := make([]byte, 64)
+	for i := 0; i < 3; i++ {
+		_, err = bConn.Read(buf)
+		require.NoError(t, err)
+	}
+
+	sent := aConn.agent.GetStreamStats()
+	require.Len(t, sent, 2)
+	assert.Equal(t, "a", sent[0].ID)
+	assert.Equal(t, uint64(1), sent[0].PacketsSent)
+	assert.Equal(t, uint64(5), sent[0].BytesSent)
+	assert.Equal(t, "v", sent[1].ID)
+	assert.Equal(t, uint64(2), sent[1].PacketsSent)
+	assert.Equal(t, uint64(11), sent[1].BytesSent)
+
+	pair := aConn.agent.getSelectedPair()
+	assert.Equal(t, pair.Local.ID(), sent[0].LocalCandidateID)
+	assert.Equal(t, pair.Remote.ID(), sent[0].RemoteCandidateID)
+
+	received := bConn.agent.GetStreamStats()
+	require.Len(t, received, 2)
+	assert.Equal(t, uint64(1), received[0].PacketsReceived)
+	assert.Equal(t, uint64(5), received[0].BytesReceived)
+	assert.Equal(t, uint64(2), received[1].PacketsReceived)
+	assert.Equal(t, uint64(11), received[1].BytesReceived)
+
+	aConn.agent.RemoveStream("a")
+	assert.Len(t, aConn.agent.GetStreamStats(), 1)
+
+	assert.NoError(t, aConn.Close())
+	assert.NoError(t, bConn.Close())
+}
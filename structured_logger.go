@@ -0,0 +1,25 @@
+package ice
+
+import (
+	"github.com/pion/logging"
+)
+
+// StructuredLogger is implemented by loggers that accept key/value pairs
+// alongside a constant message, instead of a preformatted string. Keys are
+// always strings, values are whatever was observed by the agent (states,
+// candidates, addresses, errors).
+type StructuredLogger interface {
+	Log(level logging.LogLevel, msg string, keyvals ...interface{})
+}
+
+// logEvent emits a lifecycle event to the structured logger, if one was configured.
+// The local ufrag is attached to every event so logs of many agents can be told apart.
+// Addresses in the values are redacted according to AgentConfig.AddressRedaction.
+// Note: the caller should hold the agent lock.
+func (a *Agent) logEvent(level logging.LogLevel, msg string, keyvals ...interface{}) {
+	if a.structuredLogger == nil {
+		return
+	}
+
+	a.structuredLogger.Log(level, msg, append([]interface{}{"ufrag", a.localUfrag}, a.redactor.redactKeyvals(keyvals)...)...)
+}
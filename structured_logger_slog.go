@@ -0,0 +1,40 @@
+//go:build go1.21
+// +build go1.21
+
+package ice
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/pion/logging"
+)
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger adapts a *slog.Logger to the StructuredLogger interface.
+// Trace is mapped below slog.LevelDebug, errors and above to slog.LevelError.
+func NewSlogLogger(logger *slog.Logger) StructuredLogger {
+	return &slogLogger{logger: logger}
+}
+
+func (l *slogLogger) Log(level logging.LogLevel, msg string, keyvals ...interface{}) {
+	l.logger.Log(context.Background(), slogLevel(level), msg, keyvals...)
+}
+
+func slogLevel(level logging.LogLevel) slog.Level {
+	switch level {
+	case logging.LogLevelTrace:
+		return slog.LevelDebug - 4
+	case logging.LogLevelDebug:
+		return slog.LevelDebug
+	case logging.LogLevelInfo:
+		return slog.LevelInfo
+	case logging.LogLevelWarn:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
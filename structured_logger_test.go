@@ -0,0 +1,66 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordedEvent struct {
+	level   logging.LogLevel
+	msg     string
+	keyvals []interface{}
+}
+
+type recordingLogger struct {
+	mu     sync.Mutex
+	events []recordedEvent
+}
+
+func (r *recordingLogger) Log(level logging.LogLevel, msg string, keyvals ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, recordedEvent{level, msg, keyvals})
+}
+
+func (r *recordingLogger) find(msg string) []recordedEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var res []recordedEvent
+	for _, e := range r.events {
+		if e.msg == msg {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+func TestStructuredLogger(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 10)
+	defer lim.Stop()
+
+	logger := &recordingLogger{}
+	a, err := NewAgent(&AgentConfig{
+		LocalUfrag:       "structuredufrag",
+		LocalPwd:         "structuredpasswordstructuredpass",
+		StructuredLogger: logger,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, a.Close())
+
+	events := logger.find("connection state changed")
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, logging.LogLevelInfo, events[0].level)
+		assert.Equal(t, []interface{}{"ufrag", "structuredufrag", "state", "Closed", "reason", "closed"}, events[0].keyvals)
+	}
+}
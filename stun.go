@@ -1,7 +1,13 @@
 package ice
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec
 	"fmt"
+	"hash"
+	"net"
+	"sync"
 
 	"github.com/pion/stun"
 )
@@ -22,3 +28,212 @@ func assertInboundMessageIntegrity(m *stun.Message, key []byte) error {
 	messageIntegrityAttr := stun.MessageIntegrity(key)
 	return messageIntegrityAttr.Check(m)
 }
+
+// stunCredentials holds what connectivity checks derive from the ICE
+// credentials, so it is not rebuilt for every message.
+type stunCredentials struct {
+	localUfrag, localPwd, remoteUfrag, remotePwd string
+
+	// outboundUsername is sent in our binding requests, inboundUsername
+	// is expected in the remote's.
+	outboundUsername stun.Username
+	inboundUsername  string
+
+	localIntegrity  stun.MessageIntegrity
+	remoteIntegrity stun.MessageIntegrity
+
+	// remoteHMAC is keyed with remoteIntegrity, crypto/hmac keeps the
+	// keyed state so it is not derived again for every request.
+	remoteHMAC hash.Hash
+	remoteSum  [sha1.Size]byte
+}
+
+// stunCredentials returns the cached credentials, refreshed if the ufrags or
+// passwords changed since the last call.
+// Note: the caller should hold the agent lock.
+func (a *Agent) stunCredentials() *stunCredentials {
+	c := &a.stunCreds
+	if c.localIntegrity != nil &&
+		c.localUfrag == a.localUfrag && c.localPwd == a.localPwd &&
+		c.remoteUfrag == a.remoteUfrag && c.remotePwd == a.remotePwd {
+		return c
+	}
+
+	*c = stunCredentials{
+		localUfrag:       a.localUfrag,
+		localPwd:         a.localPwd,
+		remoteUfrag:      a.remoteUfrag,
+		remotePwd:        a.remotePwd,
+		outboundUsername: stun.NewUsername(a.remoteUfrag + ":" + a.localUfrag),
+		inboundUsername:  a.localUfrag + ":" + a.remoteUfrag,
+		localIntegrity:   stun.NewShortTermIntegrity(a.localPwd),
+		remoteIntegrity:  stun.NewShortTermIntegrity(a.remotePwd),
+	}
+	c.remoteHMAC = hmac.New(sha1.New, c.remoteIntegrity)
+	return c
+}
+
+// buildBindingRequest builds a connectivity check sent from local, nominating
+// the pair if useCandidate is set. The message is built in place of the
+// previous outbound message and is only valid until the next one is built.
+// Note: the caller should hold the agent lock.
+func (a *Agent) buildBindingRequest(local Candidate, controlling, useCandidate bool) (*stun.Message, error) {
+	m, err := a.buildUnsignedBindingRequest(local, controlling, useCandidate)
+	if err != nil {
+		return nil, err
+	}
+	return a.signBindingRequest(m)
+}
+
+// buildPairBindingRequest builds a connectivity check or keepalive for p from
+// the template cached on the pair, only the transaction ID, MESSAGE-INTEGRITY
+// and FINGERPRINT are computed for each request. The template is rebuilt if
+// anything it was built from changed.
+// Note: the caller should hold the agent lock.
+func (a *Agent) buildPairBindingRequest(p *CandidatePair, controlling bool) (*stun.Message, error) {
+	creds := a.stunCredentials()
+	priority := p.Local.Priority()
+
+	t := p.bindingRequestTemplate
+	if t == nil || t.controlling != controlling || t.tieBreaker != a.tieBreaker ||
+		t.priority != priority || !bytes.Equal(t.username, creds.outboundUsername) {
+		m, err := a.buildUnsignedBindingRequest(p.Local, controlling, false)
+		if err != nil {
+			return nil, err
+		}
+		p.bindingRequestTemplate = &bindingRequestTemplate{
+			raw:         append([]byte(nil), m.Raw...),
+			username:    creds.outboundUsername,
+			controlling: controlling,
+			tieBreaker:  a.tieBreaker,
+			priority:    priority,
+		}
+		return a.signBindingRequest(m)
+	}
+
+	m := a.outboundSTUN
+	m.Raw = append(m.Raw[:0], t.raw...)
+	if err := m.Decode(); err != nil {
+		return nil, err
+	}
+	if err := m.NewTransactionID(); err != nil {
+		return nil, err
+	}
+	return a.signBindingRequest(m)
+}
+
+// bindingRequestTemplate is a serialized binding request without its
+// MESSAGE-INTEGRITY and FINGERPRINT, along with what it was built from.
+type bindingRequestTemplate struct {
+	raw         []byte
+	username    stun.Username
+	controlling bool
+	tieBreaker  uint64
+	priority    uint32
+}
+
+// buildUnsignedBindingRequest builds everything of a binding request but its
+// MESSAGE-INTEGRITY and FINGERPRINT into the outbound message.
+// Note: the caller should hold the agent lock.
+func (a *Agent) buildUnsignedBindingRequest(local Candidate, controlling, useCandidate bool) (*stun.Message, error) {
+	creds := a.stunCredentials()
+	m := a.outboundSTUN
+
+	m.Reset()
+	m.Type = stun.BindingRequest
+	m.WriteHeader()
+	if err := m.NewTransactionID(); err != nil {
+		return nil, err
+	}
+
+	m.Add(stun.AttrUsername, creds.outboundUsername)
+	if useCandidate {
+		m.Add(stun.AttrUseCandidate, nil)
+	}
+	if controlling {
+		_ = AttrControlling(a.tieBreaker).AddTo(m)
+	} else {
+		_ = AttrControlled(a.tieBreaker).AddTo(m)
+	}
+	_ = PriorityAttr(local.Priority()).AddTo(m)
+	return m, nil
+}
+
+// signBindingRequest adds MESSAGE-INTEGRITY and FINGERPRINT to m.
+// Note: the caller should hold the agent lock.
+func (a *Agent) signBindingRequest(m *stun.Message) (*stun.Message, error) {
+	// Same as stun.MessageIntegrity.AddTo, the length covers the
+	// MESSAGE-INTEGRITY attribute while the HMAC is computed
+	length := m.Length
+	m.Length += sha1.Size + stunAttributeHeaderSize
+	m.WriteLength()
+
+	creds := a.stunCredentials()
+	creds.remoteHMAC.Reset()
+	_, _ = creds.remoteHMAC.Write(m.Raw)
+	m.Length = length
+	m.Add(stun.AttrMessageIntegrity, creds.remoteHMAC.Sum(creds.remoteSum[:0]))
+
+	if err := stun.Fingerprint.AddTo(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// buildBindingSuccess builds the response to the binding request req, in
+// place of the previous outbound message like buildBindingRequest.
+// Note: the caller should hold the agent lock.
+func (a *Agent) buildBindingSuccess(req *stun.Message, ip net.IP, port int) (*stun.Message, error) {
+	creds := a.stunCredentials()
+	m := a.outboundSTUN
+
+	m.Reset()
+	m.Type = stun.BindingSuccess
+	m.TransactionID = req.TransactionID
+	m.WriteHeader()
+
+	xorAddr := stun.XORMappedAddress{IP: ip, Port: port}
+	if err := xorAddr.AddTo(m); err != nil {
+		return nil, err
+	}
+	if err := creds.localIntegrity.AddTo(m); err != nil {
+		return nil, err
+	}
+	if err := stun.Fingerprint.AddTo(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// buildBindingError builds an error response to req with code and reason.
+func (a *Agent) buildBindingError(req *stun.Message, code stun.ErrorCode, reason string) (*stun.Message, error) {
+	creds := a.stunCredentials()
+	m := a.outboundSTUN
+
+	m.Reset()
+	m.Type = stun.BindingError
+	m.TransactionID = req.TransactionID
+	m.WriteHeader()
+
+	errorCode := stun.ErrorCodeAttribute{Code: code, Reason: []byte(reason)}
+	if err := errorCode.AddTo(m); err != nil {
+		return nil, err
+	}
+	if err := creds.localIntegrity.AddTo(m); err != nil {
+		return nil, err
+	}
+	if err := stun.Fingerprint.AddTo(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+const stunAttributeHeaderSize = 4
+
+// inboundSTUNPool recycles the messages inbound STUN packets are decoded
+// into. Messages are only used for the duration of agent.handleInbound.
+var inboundSTUNPool = &sync.Pool{ //nolint:gochecknoglobals
+	New: func() interface{} {
+		return &stun.Message{Raw: make([]byte, 0, receiveMTU)}
+	},
+}
@@ -0,0 +1,193 @@
+package ice
+
+import (
+	"context"
+	mrand "math/rand"
+	"net"
+	"time"
+
+	"github.com/pion/stun"
+)
+
+// maxReorderHold is how long a message held back by STUNFaults.ReorderRate
+// waits for the next message before being delivered anyway.
+const maxReorderHold = 200 * time.Millisecond
+
+// STUNFaults are the failures injected in the STUN traffic of an agent, for
+// chaos experiments in staging. They are set by AgentConfig.STUNFaults and
+// changed at runtime with Agent.SetSTUNFaults. Data packets are not affected,
+// and the STUN messages are traced before the faults are applied.
+type STUNFaults struct {
+	// Inbound and Outbound select the messages the faults apply to, all of
+	// them if neither is set
+	Inbound  bool
+	Outbound bool
+
+	// DropRate is the share of the messages dropped
+	DropRate float64
+
+	// MinDelay and MaxDelay bound the delay of the messages, uniformly
+	// distributed between them
+	MinDelay time.Duration
+	MaxDelay time.Duration
+
+	// ReorderRate is the share of the messages held back and delivered right
+	// after the next message of the same direction
+	ReorderRate float64
+
+	// Seed of the faults, for reproducible runs
+	Seed int64
+}
+
+// stunFaultInjector applies STUNFaults, it is only used by the agent loop.
+type stunFaultInjector struct {
+	faults STUNFaults
+	rand   *mrand.Rand
+
+	// held are the messages held back for reordering, by direction
+	held map[STUNMessageDirection]*heldSTUNMessage
+}
+
+type heldSTUNMessage struct {
+	deliver func()
+	timer   Timer
+}
+
+func newSTUNFaultInjector(faults *STUNFaults) *stunFaultInjector {
+	if faults == nil {
+		return nil
+	}
+	return &stunFaultInjector{
+		faults: *faults,
+		rand:   mrand.New(mrand.NewSource(faults.Seed)), //nolint:gosec
+		held:   map[STUNMessageDirection]*heldSTUNMessage{},
+	}
+}
+
+// appliesTo reports whether the messages going in direction are subject to
+// faults.
+func (f *stunFaultInjector) appliesTo(direction STUNMessageDirection) bool {
+	switch {
+	case f == nil:
+		return false
+	case !f.faults.Inbound && !f.faults.Outbound:
+		return true
+	case direction == STUNMessageDirectionInbound:
+		return f.faults.Inbound
+	default:
+		return f.faults.Outbound
+	}
+}
+
+// SetSTUNFaults replaces the faults injected in the STUN traffic of the
+// agent, nil stops injecting them. The messages held back for reordering
+// are delivered, the delayed ones are delivered on time.
+func (a *Agent) SetSTUNFaults(faults *STUNFaults) error {
+	return a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		agent.releaseHeldSTUNMessages()
+		agent.stunFaults = newSTUNFaultInjector(faults)
+	})
+}
+
+// releaseHeldSTUNMessages delivers the messages held back for reordering.
+// Note: the caller should hold the agent lock.
+func (a *Agent) releaseHeldSTUNMessages() {
+	if a.stunFaults == nil {
+		return
+	}
+	for direction, held := range a.stunFaults.held {
+		delete(a.stunFaults.held, direction)
+		held.timer.Stop()
+		held.deliver()
+	}
+}
+
+// injectOutboundSTUNFault sends msg according to the STUN faults.
+// Note: the caller should hold the agent lock.
+func (a *Agent) injectOutboundSTUNFault(msg *stun.Message, local, remote Candidate) {
+	raw := append([]byte(nil), msg.Raw...)
+	a.injectSTUNFault(STUNMessageDirectionOutbound, func() {
+		if _, err := local.writeTo(raw, remote); err != nil {
+			a.log.Tracef("failed to send STUN message: %s", err)
+		}
+	})
+}
+
+// injectInboundSTUNFault handles m according to the STUN faults.
+// Note: the caller should hold the agent lock.
+func (a *Agent) injectInboundSTUNFault(m *stun.Message, local Candidate, remote net.Addr) {
+	// m is recycled once handled
+	detached := &stun.Message{Raw: append([]byte(nil), m.Raw...)}
+	if err := detached.Decode(); err != nil {
+		return
+	}
+	a.injectSTUNFault(STUNMessageDirectionInbound, func() {
+		// The candidate may have been closed while the message was delayed
+		if started, ok := local.(interface{ Done() <-chan struct{} }); ok && started.Done() != nil {
+			select {
+			case <-started.Done():
+				return
+			default:
+			}
+		}
+		a.handleInbound(detached, local, remote)
+	})
+}
+
+// injectSTUNFault drops, delays or reorders the message delivered by
+// deliver, which is called with the agent lock held.
+// Note: the caller should hold the agent lock.
+func (a *Agent) injectSTUNFault(direction STUNMessageDirection, deliver func()) {
+	f := a.stunFaults
+	if f.rand.Float64() < f.faults.DropRate {
+		a.log.Tracef("STUN fault: dropped %s message", direction)
+		return
+	}
+
+	delay := f.faults.MinDelay
+	if spread := f.faults.MaxDelay - f.faults.MinDelay; spread > 0 {
+		delay += time.Duration(f.rand.Int63n(int64(spread) + 1))
+	}
+
+	if f.held[direction] == nil && f.rand.Float64() < f.faults.ReorderRate {
+		a.log.Tracef("STUN fault: holding back %s message", direction)
+		held := &heldSTUNMessage{deliver: deliver}
+		held.timer = a.clock.AfterFunc(delay+maxReorderHold, func() {
+			a.runSTUNFault(func() {
+				if f.held[direction] == held {
+					delete(f.held, direction)
+					held.deliver()
+				}
+			})
+		})
+		f.held[direction] = held
+		return
+	}
+
+	if held := f.held[direction]; held != nil {
+		delete(f.held, direction)
+		held.timer.Stop()
+		next := deliver
+		deliver = func() {
+			next()
+			held.deliver()
+		}
+	}
+
+	if delay <= 0 {
+		deliver()
+		return
+	}
+	a.clock.AfterFunc(delay, func() {
+		a.runSTUNFault(deliver)
+	})
+}
+
+// runSTUNFault delivers a delayed message in the agent loop.
+func (a *Agent) runSTUNFault(deliver func()) {
+	if err := a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		deliver()
+	}); err != nil {
+		a.log.Tracef("STUN fault: delayed message not delivered: %v", err)
+	}
+}
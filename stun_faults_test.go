@@ -0,0 +1,118 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/stun"
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSTUNFaults(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	// Returns an agent sending with send, and the transaction IDs of the
+	// messages written by it
+	newFaultyAgent := func(t *testing.T, clock Clock, faults *STUNFaults) (*Agent, func() [stun.TransactionIDSize]byte, func() [][stun.TransactionIDSize]byte) {
+		a, err := NewAgent(&AgentConfig{
+			Clock:       clock,
+			Synchronous: true,
+			STUNFaults:  faults,
+		})
+		require.NoError(t, err)
+
+		conn := &writtenPacketConn{}
+		local, remote := newInboundLocal(t, conn), newInboundRemote(t)
+
+		send := func() [stun.TransactionIDSize]byte {
+			msg, err := stun.Build(stun.NewType(stun.MethodBinding, stun.ClassIndication), stun.TransactionID, stun.Fingerprint)
+			require.NoError(t, err)
+			require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+				agent.sendSTUN(msg, local, remote)
+			}))
+			return msg.TransactionID
+		}
+		written := func() [][stun.TransactionIDSize]byte {
+			conn.mu.Lock()
+			defer conn.mu.Unlock()
+			ids := [][stun.TransactionIDSize]byte{}
+			for _, raw := range conn.written {
+				m := &stun.Message{Raw: raw}
+				require.NoError(t, m.Decode())
+				ids = append(ids, m.TransactionID)
+			}
+			return ids
+		}
+		return a, send, written
+	}
+
+	t.Run("Drop", func(t *testing.T) {
+		a, send, written := newFaultyAgent(t, nil, &STUNFaults{Outbound: true, DropRate: 1})
+		defer func() {
+			assert.NoError(t, a.Close())
+		}()
+
+		send()
+		assert.Empty(t, written())
+
+		// Inbound faults do not apply to outbound messages
+		require.NoError(t, a.SetSTUNFaults(&STUNFaults{Inbound: true, DropRate: 1}))
+		id := send()
+		assert.Equal(t, [][stun.TransactionIDSize]byte{id}, written())
+	})
+
+	t.Run("Delay", func(t *testing.T) {
+		clock := NewManualClock(time.Now())
+		a, send, written := newFaultyAgent(t, clock, &STUNFaults{MinDelay: time.Second, MaxDelay: 2 * time.Second})
+		defer func() {
+			assert.NoError(t, a.Close())
+		}()
+
+		id := send()
+		clock.Advance(time.Second - time.Millisecond)
+		assert.Empty(t, written())
+		clock.Advance(time.Second + time.Millisecond)
+		assert.Equal(t, [][stun.TransactionIDSize]byte{id}, written())
+	})
+
+	t.Run("Reorder", func(t *testing.T) {
+		clock := NewManualClock(time.Now())
+		a, send, written := newFaultyAgent(t, clock, &STUNFaults{ReorderRate: 1})
+		defer func() {
+			assert.NoError(t, a.Close())
+		}()
+
+		first := send()
+		second := send()
+		assert.Equal(t, [][stun.TransactionIDSize]byte{second, first}, written())
+
+		// Held back until the faults are removed
+		third := send()
+		assert.Len(t, written(), 2)
+		require.NoError(t, a.SetSTUNFaults(nil))
+		assert.Equal(t, [][stun.TransactionIDSize]byte{second, first, third}, written())
+
+		fourth := send()
+		assert.Equal(t, [][stun.TransactionIDSize]byte{second, first, third, fourth}, written())
+	})
+
+	t.Run("Reorder timeout", func(t *testing.T) {
+		clock := NewManualClock(time.Now())
+		a, send, written := newFaultyAgent(t, clock, &STUNFaults{ReorderRate: 1})
+		defer func() {
+			assert.NoError(t, a.Close())
+		}()
+
+		id := send()
+		assert.Empty(t, written())
+		clock.Advance(maxReorderHold)
+		assert.Equal(t, [][stun.TransactionIDSize]byte{id}, written())
+	})
+}
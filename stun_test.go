@@ -0,0 +1,201 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/pion/stun"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSTUNTestAgent(tb testing.TB) (*Agent, *CandidateHost, *CandidateHost) {
+	a, err := NewAgent(&AgentConfig{})
+	require.NoError(tb, err)
+	a.remoteUfrag, a.remotePwd = "remoteUfrag", "remotePwd"
+
+	local, err := NewCandidateHost(&CandidateHostConfig{
+		Network:   "udp",
+		Address:   "192.168.0.2",
+		Port:      777,
+		Component: 1,
+	})
+	require.NoError(tb, err)
+	local.conn = &mockPacketConn{}
+	local.currAgent = a
+
+	remote, err := NewCandidateHost(&CandidateHostConfig{
+		Network:   "udp",
+		Address:   "172.17.0.3",
+		Port:      999,
+		Component: 1,
+	})
+	require.NoError(tb, err)
+
+	return a, local, remote
+}
+
+func TestBuildBindingRequest(t *testing.T) {
+	a, local, _ := newSTUNTestAgent(t)
+	defer func() { assert.NoError(t, a.Close()) }()
+
+	for _, controlling := range []bool{false, true} {
+		for _, useCandidate := range []bool{false, true} {
+			built, err := a.buildBindingRequest(local, controlling, useCandidate)
+			require.NoError(t, err)
+
+			m := &stun.Message{Raw: append([]byte{}, built.Raw...)}
+			require.NoError(t, m.Decode())
+			assert.Equal(t, stun.BindingRequest, m.Type)
+			assert.Equal(t, built.TransactionID, m.TransactionID)
+			assert.NoError(t, assertInboundUsername(m, "remoteUfrag:"+a.localUfrag))
+			assert.NoError(t, assertInboundMessageIntegrity(m, []byte("remotePwd")))
+			assert.NoError(t, stun.Fingerprint.Check(m))
+			assert.Equal(t, useCandidate, m.Contains(stun.AttrUseCandidate))
+
+			var priority PriorityAttr
+			assert.NoError(t, priority.GetFrom(m))
+			assert.Equal(t, PriorityAttr(local.Priority()), priority)
+
+			if controlling {
+				var attr AttrControlling
+				assert.NoError(t, attr.GetFrom(m))
+				assert.Equal(t, AttrControlling(a.tieBreaker), attr)
+				assert.False(t, m.Contains(stun.AttrICEControlled))
+			} else {
+				var attr AttrControlled
+				assert.NoError(t, attr.GetFrom(m))
+				assert.Equal(t, AttrControlled(a.tieBreaker), attr)
+				assert.False(t, m.Contains(stun.AttrICEControlling))
+			}
+		}
+	}
+
+	// Credentials are refreshed when they change
+	a.remotePwd = "newRemotePwd"
+	built, err := a.buildBindingRequest(local, true, false)
+	require.NoError(t, err)
+	assert.NoError(t, assertInboundMessageIntegrity(built, []byte("newRemotePwd")))
+}
+
+func TestBuildBindingSuccess(t *testing.T) {
+	a, _, _ := newSTUNTestAgent(t)
+	defer func() { assert.NoError(t, a.Close()) }()
+
+	req, err := stun.Build(stun.BindingRequest, stun.TransactionID)
+	require.NoError(t, err)
+
+	built, err := a.buildBindingSuccess(req, net.IP{172, 17, 0, 3}, 999)
+	require.NoError(t, err)
+
+	m := &stun.Message{Raw: append([]byte{}, built.Raw...)}
+	require.NoError(t, m.Decode())
+	assert.Equal(t, stun.BindingSuccess, m.Type)
+	assert.Equal(t, req.TransactionID, m.TransactionID)
+	assert.NoError(t, assertInboundMessageIntegrity(m, []byte(a.localPwd)))
+	assert.NoError(t, stun.Fingerprint.Check(m))
+
+	var addr stun.XORMappedAddress
+	assert.NoError(t, addr.GetFrom(m))
+	assert.Equal(t, "172.17.0.3:999", addr.String())
+}
+
+func TestBuildPairBindingRequest(t *testing.T) {
+	a, local, remote := newSTUNTestAgent(t)
+	defer func() { assert.NoError(t, a.Close()) }()
+
+	p := newCandidatePair(local, remote, true)
+	decode := func() *stun.Message {
+		built, err := a.buildPairBindingRequest(p, true)
+		require.NoError(t, err)
+
+		m := &stun.Message{Raw: append([]byte{}, built.Raw...)}
+		require.NoError(t, m.Decode())
+		assert.NoError(t, assertInboundUsername(m, a.remoteUfrag+":"+a.localUfrag))
+		assert.NoError(t, assertInboundMessageIntegrity(m, []byte(a.remotePwd)))
+		assert.NoError(t, stun.Fingerprint.Check(m))
+		assert.False(t, m.Contains(stun.AttrUseCandidate))
+		return m
+	}
+
+	first := decode()
+	template := p.bindingRequestTemplate
+	require.NotNil(t, template)
+
+	// The template is reused with a new transaction ID
+	second := decode()
+	assert.Equal(t, template, p.bindingRequestTemplate)
+	assert.NotEqual(t, first.TransactionID, second.TransactionID)
+	// Attributes after the 20 bytes header are unchanged up to MESSAGE-INTEGRITY
+	assert.Equal(t, first.Raw[20:len(template.raw)], second.Raw[20:len(template.raw)])
+
+	// And rebuilt when the credentials or the role change
+	a.remoteUfrag, a.remotePwd = "newRemoteUfrag", "newRemotePwd"
+	decode()
+	assert.NotEqual(t, template, p.bindingRequestTemplate)
+
+	template = p.bindingRequestTemplate
+	_, err := a.buildPairBindingRequest(p, false)
+	require.NoError(t, err)
+	assert.NotEqual(t, template, p.bindingRequestTemplate)
+	assert.False(t, p.bindingRequestTemplate.controlling)
+}
+
+func BenchmarkBuildBindingRequest(b *testing.B) {
+	a, local, _ := newSTUNTestAgent(b)
+	defer func() { assert.NoError(b, a.Close()) }()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := a.buildBindingRequest(local, true, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBuildPairBindingRequest(b *testing.B) {
+	a, local, remote := newSTUNTestAgent(b)
+	defer func() { assert.NoError(b, a.Close()) }()
+
+	p := newCandidatePair(local, remote, true)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := a.buildPairBindingRequest(p, true); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkHandleInboundBindingRequest measures a connectivity check from
+// the socket read to the response being written.
+func BenchmarkHandleInboundBindingRequest(b *testing.B) {
+	a, local, remote := newSTUNTestAgent(b)
+	defer func() { assert.NoError(b, a.Close()) }()
+
+	require.NoError(b, a.run(context.Background(), func(ctx context.Context, a *Agent) {
+		a.selector = &controlledSelector{agent: a, log: a.log}
+		a.addRemoteCandidate(remote)
+	}))
+
+	req, err := stun.Build(stun.BindingRequest, stun.TransactionID,
+		stun.NewUsername(a.localUfrag+":"+a.remoteUfrag),
+		AttrControlling(1),
+		PriorityAttr(remote.Priority()),
+		stun.NewShortTermIntegrity(a.localPwd),
+		stun.Fingerprint,
+	)
+	require.NoError(b, err)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handleInboundCandidateMsg(context.Background(), local, req.Raw, remote.addr(), a.log)
+	}
+}
@@ -0,0 +1,62 @@
+package ice
+
+import (
+	"net"
+
+	"github.com/pion/stun"
+)
+
+// STUNMessageDirection tells whether a traced STUN message was sent or received.
+type STUNMessageDirection int
+
+const (
+	// STUNMessageDirectionInbound is a message received from a remote candidate.
+	STUNMessageDirectionInbound STUNMessageDirection = iota + 1
+
+	// STUNMessageDirectionOutbound is a message sent to a remote candidate.
+	STUNMessageDirectionOutbound
+)
+
+func (d STUNMessageDirection) String() string {
+	switch d {
+	case STUNMessageDirectionInbound:
+		return "inbound"
+	case STUNMessageDirectionOutbound:
+		return "outbound"
+	default:
+		return ErrUnknownType.Error()
+	}
+}
+
+// STUNMessageTrace describes a single STUN message handled by the agent.
+// Raw is owned by the agent and must not be modified or retained after the
+// handler returns; copy it if needed.
+type STUNMessageTrace struct {
+	Direction  STUNMessageDirection
+	Raw        []byte
+	Class      stun.MessageClass
+	Method     stun.Method
+	LocalAddr  net.Addr
+	RemoteAddr net.Addr
+}
+
+// OnSTUNMessage sets a handler that is fired for every STUN message sent or
+// received over the agent's candidates. The handler is invoked synchronously
+// on the packet path and must not block.
+func (a *Agent) OnSTUNMessage(f func(STUNMessageTrace)) error {
+	a.onSTUNMessageHdlr.Store(f)
+	return nil
+}
+
+func (a *Agent) traceSTUNMessage(direction STUNMessageDirection, m *stun.Message, local, remote net.Addr) {
+	if hdlr, ok := a.onSTUNMessageHdlr.Load().(func(STUNMessageTrace)); ok && hdlr != nil {
+		hdlr(STUNMessageTrace{
+			Direction:  direction,
+			Raw:        m.Raw,
+			Class:      m.Type.Class,
+			Method:     m.Type.Method,
+			LocalAddr:  local,
+			RemoteAddr: remote,
+		})
+	}
+}
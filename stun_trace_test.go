@@ -0,0 +1,65 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/stun"
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnSTUNMessage(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	cfg := &AgentConfig{
+		NetworkTypes: []NetworkType{NetworkTypeUDP4},
+	}
+
+	aAgent, err := NewAgent(cfg)
+	assert.NoError(t, err)
+	bAgent, err := NewAgent(cfg)
+	assert.NoError(t, err)
+
+	var mu sync.Mutex
+	seen := map[STUNMessageDirection]map[stun.MessageClass]int{
+		STUNMessageDirectionInbound:  {},
+		STUNMessageDirectionOutbound: {},
+	}
+	assert.NoError(t, aAgent.OnSTUNMessage(func(trace STUNMessageTrace) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, stun.MethodBinding, trace.Method)
+		assert.NotNil(t, trace.LocalAddr)
+		assert.NotNil(t, trace.RemoteAddr)
+		assert.True(t, stun.IsMessage(trace.Raw))
+		seen[trace.Direction][trace.Class]++
+	}))
+
+	aNotifier, aConnected := onConnected()
+	bNotifier, bConnected := onConnected()
+	assert.NoError(t, aAgent.OnConnectionStateChange(aNotifier))
+	assert.NoError(t, bAgent.OnConnectionStateChange(bNotifier))
+
+	aConn, bConn := connect(aAgent, bAgent)
+	<-aConnected
+	<-bConnected
+
+	assert.NoError(t, aConn.Close())
+	assert.NoError(t, bConn.Close())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.NotZero(t, seen[STUNMessageDirectionOutbound][stun.ClassRequest])
+	assert.NotZero(t, seen[STUNMessageDirectionOutbound][stun.ClassSuccessResponse])
+	assert.NotZero(t, seen[STUNMessageDirectionInbound][stun.ClassRequest])
+	assert.NotZero(t, seen[STUNMessageDirectionInbound][stun.ClassSuccessResponse])
+}
@@ -0,0 +1,270 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun"
+	"github.com/pion/transport/test"
+	"github.com/pion/turn/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// responseRecorder checks that the responses to the binding requests sent
+// by an agent come from the address the requests were sent to.
+type responseRecorder struct {
+	mu         sync.Mutex
+	sentTo     map[[stun.TransactionIDSize]byte]string
+	symmetric  int
+	asymmetric int
+}
+
+func recordResponses(t *testing.T, a *Agent) *responseRecorder {
+	r := &responseRecorder{sentTo: map[[stun.TransactionIDSize]byte]string{}}
+	require.NoError(t, a.OnSTUNMessage(func(m STUNMessageTrace) {
+		if m.Method != stun.MethodBinding || len(m.Raw) < 20 {
+			return
+		}
+		var id [stun.TransactionIDSize]byte
+		copy(id[:], m.Raw[8:20])
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		switch {
+		case m.Direction == STUNMessageDirectionOutbound && m.Class == stun.ClassRequest:
+			r.sentTo[id] = m.RemoteAddr.String()
+		case m.Direction == STUNMessageDirectionInbound && m.Class == stun.ClassSuccessResponse:
+			if to, ok := r.sentTo[id]; ok {
+				if to == m.RemoteAddr.String() {
+					r.symmetric++
+				} else {
+					r.asymmetric++
+				}
+			}
+		}
+	}))
+	return r
+}
+
+// symmetricCount returns how many responses came from the address the
+// request was sent to.
+func (r *responseRecorder) symmetricCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.symmetric
+}
+
+func (r *responseRecorder) assertSymmetric(t *testing.T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	assert.Greater(t, r.symmetric, 0)
+	assert.Zero(t, r.asymmetric)
+}
+
+func assertNoResponseRouteViolations(t *testing.T, agents ...*Agent) {
+	for _, a := range agents {
+		violations, err := a.GetResponseRouteViolations()
+		assert.NoError(t, err)
+		assert.Zero(t, violations)
+	}
+}
+
+// socketConn is a mockPacketConn bound to an address
+type socketConn struct {
+	mockPacketConn
+	addr net.Addr
+}
+
+func (c *socketConn) LocalAddr() net.Addr { return c.addr }
+
+func TestStrictResponseRouting(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	for _, strict := range []bool{false, true} {
+		a, err := NewAgent(&AgentConfig{StrictResponseRouting: strict})
+		require.NoError(t, err)
+
+		var responses int
+		require.NoError(t, a.OnSTUNMessage(func(m STUNMessageTrace) {
+			if m.Direction == STUNMessageDirectionOutbound && m.Class == stun.ClassSuccessResponse {
+				responses++
+			}
+		}))
+
+		newHost := func(address string, socket *net.UDPAddr) Candidate {
+			c := newTestHost(t, address)
+			c.conn = &socketConn{addr: socket}
+			return c
+		}
+		socket := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1000}
+		otherSocket := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 1000}
+
+		// sharing is a candidate sharing the socket of local, as through a UDPMux
+		local, sharing := newHost("192.0.2.1", socket), newHost("203.0.113.1", socket)
+		otherLocal := newHost("192.0.2.2", otherSocket)
+		remote, otherRemote := newHost("198.51.100.1", nil), newHost("198.51.100.2", nil)
+
+		require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+			m, err := stun.Build(stun.BindingRequest, stun.TransactionID)
+			require.NoError(t, err)
+
+			agent.inboundRequest = &inboundRequest{socket: socketAddr(local), source: remote.addr()}
+			// Written from the socket the request arrived on
+			agent.sendBindingSuccess(m, local, remote)
+			agent.sendBindingSuccess(m, sharing, remote)
+
+			// From another socket, or to another address
+			agent.sendBindingSuccess(m, otherLocal, remote)
+			agent.sendBindingSuccess(m, local, otherRemote)
+			agent.inboundRequest = nil
+		}))
+
+		violations, err := a.GetResponseRouteViolations()
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(2), violations)
+		if strict {
+			assert.Equal(t, 2, responses)
+		} else {
+			assert.Equal(t, 4, responses)
+		}
+		assert.NoError(t, a.Close())
+	}
+}
+
+func TestSymmetricResponses(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	aConn, bConn := pipe(&AgentConfig{StrictResponseRouting: true})
+	aResponses, bResponses := recordResponses(t, aConn.agent), recordResponses(t, bConn.agent)
+
+	// Keepalives check the responses once the recorders are set
+	keepaliveInterval := 20 * time.Millisecond
+	for _, a := range []*Agent{aConn.agent, bConn.agent} {
+		require.NoError(t, a.UpdateConfig(&AgentConfigUpdate{KeepaliveInterval: &keepaliveInterval}))
+	}
+	assert.Eventually(t, func() bool {
+		return aResponses.symmetricCount() > 0 && bResponses.symmetricCount() > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	aResponses.assertSymmetric(t)
+	bResponses.assertSymmetric(t)
+	assertNoResponseRouteViolations(t, aConn.agent, bConn.agent)
+
+	assert.NoError(t, aConn.Close())
+	assert.NoError(t, bConn.Close())
+}
+
+func TestSymmetricResponsesUDPMux(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	c, err := net.ListenUDP(udp, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	udpMux := NewUDPMuxDefault(UDPMuxParams{
+		Logger:  logging.NewDefaultLoggerFactory().NewLogger("ice"),
+		UDPConn: c,
+	})
+	defer func() {
+		_ = udpMux.Close()
+		_ = c.Close()
+	}()
+
+	muxed, err := NewAgent(&AgentConfig{
+		UDPMux:                udpMux,
+		CandidateTypes:        []CandidateType{CandidateTypeHost},
+		NetworkTypes:          []NetworkType{NetworkTypeUDP4},
+		StrictResponseRouting: true,
+	})
+	require.NoError(t, err)
+
+	a, err := NewAgent(&AgentConfig{
+		CandidateTypes:        []CandidateType{CandidateTypeHost},
+		NetworkTypes:          []NetworkType{NetworkTypeUDP4},
+		StrictResponseRouting: true,
+	})
+	require.NoError(t, err)
+
+	// The responses of the muxed agent come from the shared socket
+	responses := recordResponses(t, a)
+	connect(a, muxed)
+
+	responses.assertSymmetric(t)
+	assertNoResponseRouteViolations(t, a, muxed)
+
+	require.NoError(t, a.Close())
+	require.NoError(t, muxed.Close())
+}
+
+func TestSymmetricResponsesRelay(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	serverPort := randomPort(t)
+	serverListener, err := net.ListenPacket("udp", "127.0.0.1:"+strconv.Itoa(serverPort))
+	require.NoError(t, err)
+
+	server, err := turn.NewServer(turn.ServerConfig{
+		Realm:       "pion.ly",
+		AuthHandler: optimisticAuthHandler,
+		PacketConnConfigs: []turn.PacketConnConfig{
+			{
+				PacketConn:            serverListener,
+				RelayAddressGenerator: &turn.RelayAddressGeneratorNone{Address: "127.0.0.1"},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	cfg := &AgentConfig{
+		NetworkTypes: supportedNetworkTypes(),
+		Urls: []*URL{
+			{
+				Scheme:   SchemeTypeTURN,
+				Host:     "127.0.0.1",
+				Username: "username",
+				Password: "password",
+				Port:     serverPort,
+				Proto:    ProtoTypeUDP,
+			},
+		},
+		CandidateTypes:        []CandidateType{CandidateTypeRelay},
+		StrictResponseRouting: true,
+	}
+
+	aAgent, err := NewAgent(cfg)
+	require.NoError(t, err)
+	bAgent, err := NewAgent(cfg)
+	require.NoError(t, err)
+
+	// The responses come from the relayed address the requests were sent to
+	aResponses, bResponses := recordResponses(t, aAgent), recordResponses(t, bAgent)
+	connect(aAgent, bAgent)
+
+	aResponses.assertSymmetric(t)
+	bResponses.assertSymmetric(t)
+	assertNoResponseRouteViolations(t, aAgent, bAgent)
+
+	assert.NoError(t, aAgent.Close())
+	assert.NoError(t, bAgent.Close())
+	assert.NoError(t, server.Close())
+}
@@ -0,0 +1,55 @@
+package ice
+
+import "context"
+
+// In synchronous mode there is no task loop: a task runs on the goroutine
+// submitting it, serialized with the other tasks by muSync, and the handlers
+// it triggers run on the same goroutine once it is done. Timers of the Clock
+// and the sockets still submit tasks from their own goroutines, with a
+// ManualClock timers run on the goroutine calling Advance.
+
+// runSync runs t and the functions registered by afterRun, then the handlers
+// queued meanwhile.
+func (a *Agent) runSync(ctx context.Context, t func(context.Context, *Agent)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.muSync.Lock()
+	if err := a.ok(); err != nil {
+		a.muSync.Unlock()
+		return err
+	}
+	t(a.context(), a)
+	a.runAfterRunFns()
+	a.muSync.Unlock()
+
+	a.flushHandlers()
+	return nil
+}
+
+// closeSync closes the agent in place of the task loop. Gathering is stopped
+// first, without holding muSync, as it may be waiting for it.
+func (a *Agent) closeSync() {
+	a.muSync.Lock()
+	cancel, done := a.gatherCandidateCancel, a.gatherCandidateDone
+	a.muSync.Unlock()
+
+	cancel()
+	if done != nil {
+		<-done
+	}
+
+	a.muSync.Lock()
+	a.closeTasks()
+	a.muSync.Unlock()
+
+	a.flushHandlers()
+}
+
+func (a *Agent) flushHandlers() {
+	a.stateHandlers.flush()
+	a.candidateHandlers.flush()
+	a.pairHandlers.flush()
+	a.authFailureHandlers.flush()
+}
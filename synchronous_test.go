@@ -0,0 +1,100 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/transport/test"
+	"github.com/pion/transport/vnet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSynchronousAgent(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	router, err := vnet.NewRouter(&vnet.RouterConfig{
+		CIDR:          "10.0.0.0/24",
+		LoggerFactory: logging.NewDefaultLoggerFactory(),
+	})
+	require.NoError(t, err)
+	nw := vnet.NewNet(&vnet.NetConfig{StaticIP: "10.0.0.2"})
+	require.NoError(t, router.AddNet(nw))
+
+	checkInterval := 100 * time.Millisecond
+	disconnectedTimeout := 5 * time.Second
+	failedTimeout := 25 * time.Second
+	clock := NewManualClock(time.Now())
+
+	a, err := NewAgent(&AgentConfig{
+		NetworkTypes:        []NetworkType{NetworkTypeUDP4},
+		CandidateTypes:      []CandidateType{CandidateTypeHost},
+		Net:                 nw,
+		Clock:               clock,
+		CheckInterval:       &checkInterval,
+		DisconnectedTimeout: &disconnectedTimeout,
+		FailedTimeout:       &failedTimeout,
+		Synchronous:         true,
+	})
+	require.NoError(t, err)
+
+	// Handlers run on this goroutine before the calls triggering them return
+	var states []ConnectionState
+	require.NoError(t, a.OnConnectionStateChange(func(s ConnectionState) {
+		states = append(states, s)
+	}))
+	var candidates []Candidate
+	require.NoError(t, a.OnCandidate(func(c Candidate) {
+		candidates = append(candidates, c)
+	}))
+
+	require.NoError(t, a.GatherCandidates())
+	require.Len(t, candidates, 2)
+	assert.Equal(t, "10.0.0.2", candidates[0].Address())
+	assert.Nil(t, candidates[1])
+
+	require.NoError(t, a.startConnectivityChecks(context.Background(), true, "ufrag", "pwdpwdpwdpwdpwdpwdpwdpwd"))
+	assert.Equal(t, []ConnectionState{ConnectionStateChecking}, states)
+
+	remote, err := NewCandidateHost(&CandidateHostConfig{
+		Network:   "udp",
+		Address:   "10.0.0.3",
+		Port:      9,
+		Component: ComponentRTP,
+	})
+	require.NoError(t, err)
+	require.NoError(t, a.AddRemoteCandidate(remote))
+
+	pair := func() (state CandidatePairState, requests uint16) {
+		require.NoError(t, a.run(context.Background(), func(ctx context.Context, agent *Agent) {
+			require.Len(t, agent.checklist, 1)
+			state, requests = agent.checklist[0].state, agent.checklist[0].bindingRequestCount
+		}))
+		return
+	}
+	state, requests := pair()
+	assert.Equal(t, CandidatePairState(CandidatePairStateWaiting), state)
+	assert.Equal(t, uint16(0), requests)
+
+	// Each step of the clock runs one round of checks
+	clock.Advance(0)
+	state, requests = pair()
+	assert.Equal(t, CandidatePairState(CandidatePairStateInProgress), state)
+	assert.Equal(t, uint16(1), requests)
+
+	clock.Advance(checkInterval)
+	_, requests = pair()
+	assert.Equal(t, uint16(2), requests)
+
+	clock.Advance(disconnectedTimeout + failedTimeout)
+	assert.Equal(t, []ConnectionState{ConnectionStateChecking, ConnectionStateFailed}, states)
+
+	require.NoError(t, a.Close())
+	assert.Equal(t, []ConnectionState{ConnectionStateChecking, ConnectionStateFailed, ConnectionStateClosed}, states)
+}
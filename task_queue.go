@@ -0,0 +1,78 @@
+package ice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// errTaskDropped is returned by runAsync when the task queue is full
+var errTaskDropped = errors.New("task queue full, task dropped")
+
+// TaskQueueStats describes the operations waiting for the agent's task
+// loop, see AgentConfig.TaskQueueSize.
+type TaskQueueStats struct {
+	// Pending is the number of operations waiting
+	Pending int
+
+	// Dropped is the number of inbound STUN messages discarded because the
+	// queue was full
+	Dropped uint64
+}
+
+// runAsync queues t for the task loop without waiting for it to run, for
+// callers that need no result such as inbound STUN messages. When the queue
+// is full, t is dropped with BufferOverflowDropNewest and errTaskDropped is
+// returned, the caller waits for room otherwise.
+func (a *Agent) runAsync(ctx context.Context, t func(context.Context, *Agent)) error {
+	if err := a.ok(); err != nil {
+		return err
+	}
+	if a.synchronous {
+		return a.runSync(ctx, t)
+	}
+
+	if a.taskQueueOverflow == BufferOverflowDropNewest {
+		select {
+		case a.chanTask <- task{fn: t}:
+			return nil
+		default:
+		}
+
+		// Logged once, a busy agent would flood the logs
+		if atomic.AddUint64(a.droppedTasks, 1) == 1 {
+			a.log.Warnf("task queue full, dropping inbound STUN messages")
+		}
+		return errTaskDropped
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case a.chanTask <- task{fn: t}:
+		return nil
+	}
+}
+
+// initTaskQueue checks AgentConfig.TaskQueueOverflow.
+func (config *AgentConfig) initTaskQueue(a *Agent) error {
+	switch config.TaskQueueOverflow {
+	case 0, BufferOverflowBlock:
+		a.taskQueueOverflow = BufferOverflowBlock
+	case BufferOverflowDropNewest:
+		a.taskQueueOverflow = config.TaskQueueOverflow
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidTaskQueueOverflow, config.TaskQueueOverflow)
+	}
+	return nil
+}
+
+// GetTaskQueueStats returns the operations waiting for the agent's task
+// loop, and the inbound STUN messages dropped, see AgentConfig.TaskQueueSize.
+func (a *Agent) GetTaskQueueStats() TaskQueueStats {
+	return TaskQueueStats{
+		Pending: len(a.chanTask),
+		Dropped: atomic.LoadUint64(a.droppedTasks),
+	}
+}
@@ -0,0 +1,62 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaskQueue(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	_, err := NewAgent(&AgentConfig{TaskQueueOverflow: BufferOverflowDropOldest})
+	assert.ErrorIs(t, err, ErrInvalidTaskQueueOverflow)
+
+	a, err := NewAgent(&AgentConfig{
+		TaskQueueSize:     1,
+		TaskQueueOverflow: BufferOverflowDropNewest,
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	// The first task blocks the loop without blocking its caller, one
+	// waits and the next one is dropped
+	release := make(chan struct{})
+	ran := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		i := i
+		err := a.runAsync(context.Background(), func(context.Context, *Agent) {
+			if i == 0 {
+				<-release
+			}
+			ran <- i
+		})
+		if i == 2 {
+			assert.ErrorIs(t, err, errTaskDropped)
+		} else {
+			assert.NoError(t, err)
+		}
+		if i == 0 {
+			require.Eventually(t, func() bool {
+				return a.GetTaskQueueStats().Pending == 0
+			}, time.Second, time.Millisecond)
+		}
+	}
+	assert.Equal(t, TaskQueueStats{Pending: 1, Dropped: 1}, a.GetTaskQueueStats())
+
+	close(release)
+	assert.Equal(t, 0, <-ran)
+	assert.Equal(t, 1, <-ran)
+	require.NoError(t, a.run(context.Background(), func(context.Context, *Agent) {}))
+	assert.Empty(t, ran)
+}
@@ -2,10 +2,12 @@ package ice
 
 import (
 	"encoding/binary"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
-	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/pion/logging"
 	"github.com/pion/stun"
@@ -46,6 +48,10 @@ func (m *invalidTCPMux) RemoveConnByUfrag(ufrag string) {}
 // TCPMuxDefault muxes TCP net.Conns into net.PacketConns and groups them by
 // Ufrag. It is a default implementation of TCPMux interface.
 type TCPMuxDefault struct {
+	// dropped counts the packets dropped by the buffers of all connections,
+	// first in the struct to be 64-bit aligned for atomic operations
+	dropped uint64
+
 	params *TCPMuxParams
 	closed bool
 
@@ -58,10 +64,18 @@ type TCPMuxDefault struct {
 
 // TCPMuxParams are parameters for TCPMux.
 type TCPMuxParams struct {
-	Listener       net.Listener
-	Logger         logging.LeveledLogger
+	Listener net.Listener
+	Logger   logging.LeveledLogger
+
+	// ReadBufferSize is the number of packets buffered for each connection
+	// until its candidate reads them.
 	ReadBufferSize int
 
+	// ReadBufferOverflow decides what happens to packets received for a
+	// connection whose buffer is full. Defaults to BufferOverflowBlock, the
+	// TCP connection the packet arrived on is not read until it fits.
+	ReadBufferOverflow BufferOverflowPolicy
+
 	// max buffer size for write op. 0 means no write buffer, the write op will block until the whole packet is written
 	// if the write buffer is full, the subsequent write packet will be dropped until it has enough space.
 	// a default 4MB is recommended.
@@ -109,6 +123,12 @@ func (m *TCPMuxDefault) start() {
 	}
 }
 
+// DroppedPackets returns the number of packets dropped because the read
+// buffer of their connection was full, see TCPMuxParams.ReadBufferOverflow.
+func (m *TCPMuxDefault) DroppedPackets() uint64 {
+	return atomic.LoadUint64(&m.dropped)
+}
+
 // LocalAddr returns the listening address of this TCPMuxDefault.
 func (m *TCPMuxDefault) LocalAddr() net.Addr {
 	return m.params.Listener.Addr()
@@ -132,10 +152,12 @@ func (m *TCPMuxDefault) GetConnByUfrag(ufrag string, isIPv6 bool) (net.PacketCon
 
 func (m *TCPMuxDefault) createConn(ufrag string, localAddr net.Addr, isIPv6 bool) *tcpPacketConn {
 	conn := newTCPPacketConn(tcpPacketParams{
-		ReadBuffer:  m.params.ReadBufferSize,
-		WriteBuffer: m.params.WriteBufferSize,
-		LocalAddr:   localAddr,
-		Logger:      m.params.Logger,
+		ReadBuffer:         m.params.ReadBufferSize,
+		ReadBufferOverflow: m.params.ReadBufferOverflow,
+		Dropped:            &m.dropped,
+		WriteBuffer:        m.params.WriteBufferSize,
+		LocalAddr:          localAddr,
+		Logger:             m.params.Logger,
 	})
 
 	if isIPv6 {
@@ -193,14 +215,12 @@ func (m *TCPMuxDefault) handleConn(conn net.Conn) {
 		m.params.Logger.Debugf("msg attr: %s", attr.String())
 	}
 
-	attr, err := msg.Get(stun.AttrUsername)
+	ufrag, err := ufragFromSTUNMessage(msg)
 	if err != nil {
 		m.closeAndLogError(conn)
 		m.params.Logger.Warnf("No Username attribute in STUN message from %s to %s", conn.RemoteAddr(), conn.LocalAddr())
 		return
 	}
-
-	ufrag := strings.Split(string(attr), ":")[0]
 	m.params.Logger.Debugf("Ufrag: %s", ufrag)
 
 	m.mu.Lock()
@@ -276,7 +296,13 @@ func (m *TCPMuxDefault) getConn(ufrag string, isIPv6 bool) (val *tcpPacketConn,
 	return
 }
 
-const streamingPacketHeaderLen = 2
+const (
+	streamingPacketHeaderLen = 2
+
+	// maxStreamingPacketSize is the largest packet the 16-bit length of an
+	// RFC 4571 frame can carry
+	maxStreamingPacketSize = 0xFFFF
+)
 
 // readStreamingPacket reads 1 packet from stream
 // read packet  bytes https://tools.ietf.org/html/rfc4571#section-2
@@ -286,44 +312,91 @@ const streamingPacketHeaderLen = 2
 //    -----------------------------------------------------------------
 //    |             LENGTH            |  RTP or RTCP packet ...       |
 //    -----------------------------------------------------------------
-func readStreamingPacket(conn net.Conn, buf []byte) (int, error) {
-	header := make([]byte, streamingPacketHeaderLen)
-	var bytesRead, n int
-	var err error
+//
+// The header is read into buf, so no memory is allocated per packet. A
+// packet larger than buf is skipped and io.ErrShortBuffer returned along
+// with its length, the stream can be read on.
+func readStreamingPacket(conn io.Reader, buf []byte) (int, error) {
+	buf = buf[:cap(buf)]
+	if len(buf) < streamingPacketHeaderLen {
+		return 0, io.ErrShortBuffer
+	}
 
-	for bytesRead < streamingPacketHeaderLen {
-		if n, err = conn.Read(header[bytesRead:streamingPacketHeaderLen]); err != nil {
+	if _, err := io.ReadFull(conn, buf[:streamingPacketHeaderLen]); err != nil {
+		return 0, err
+	}
+	length := int(binary.BigEndian.Uint16(buf))
+
+	if length > len(buf) {
+		if _, err := io.CopyN(ioutil.Discard, conn, int64(length)); err != nil {
 			return 0, err
 		}
-		bytesRead += n
+		return length, io.ErrShortBuffer
 	}
 
-	length := int(binary.BigEndian.Uint16(header))
+	if _, err := io.ReadFull(conn, buf[:length]); err != nil {
+		return 0, err
+	}
+	return length, nil
+}
 
-	if length > cap(buf) {
-		return length, io.ErrShortBuffer
+// writeStreamingPacket writes 1 packet to stream, see readStreamingPacket.
+func writeStreamingPacket(conn io.Writer, buf []byte) (int, error) {
+	w := streamingPacketWriter{w: conn}
+	return w.writePacket(buf)
+}
+
+// streamingPacketWriter writes the packets of a stream, framed as in
+// readStreamingPacket. It reuses its frame buffer, and resumes a frame
+// partially written by a failed write (e.g. past a write deadline) before
+// writing the next one, so that the stream stays in sync.
+type streamingPacketWriter struct {
+	w io.Writer
+
+	mu      sync.Mutex
+	frame   []byte
+	pending []byte
+}
+
+func newStreamingPacketWriter(w io.Writer) *streamingPacketWriter {
+	return &streamingPacketWriter{w: w}
+}
+
+func (s *streamingPacketWriter) writePacket(buf []byte) (int, error) {
+	if len(buf) > maxStreamingPacketSize {
+		return 0, fmt.Errorf("%w: %d bytes", ErrStreamingPacketTooLarge, len(buf))
 	}
 
-	bytesRead = 0
-	for bytesRead < length {
-		if n, err = conn.Read(buf[bytesRead:length]); err != nil {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.pending) > 0 {
+		n, err := s.w.Write(s.pending)
+		s.pending = s.pending[n:]
+		if err != nil {
 			return 0, err
 		}
-		bytesRead += n
 	}
 
-	return bytesRead, nil
-}
-
-func writeStreamingPacket(conn net.Conn, buf []byte) (int, error) {
-	bufferCopy := make([]byte, streamingPacketHeaderLen+len(buf))
-	binary.BigEndian.PutUint16(bufferCopy, uint16(len(buf)))
-	copy(bufferCopy[2:], buf)
+	frameLen := streamingPacketHeaderLen + len(buf)
+	if cap(s.frame) < frameLen {
+		s.frame = make([]byte, frameLen)
+	}
+	frame := s.frame[:frameLen]
+	binary.BigEndian.PutUint16(frame, uint16(len(buf)))
+	copy(frame[streamingPacketHeaderLen:], buf)
 
-	n, err := conn.Write(bufferCopy)
+	n, err := s.w.Write(frame)
 	if err != nil {
-		return 0, err
+		// A frame not written at all is dropped, the rest of one partially
+		// written must follow
+		if n > 0 {
+			s.pending = frame[n:]
+		}
+		if n -= streamingPacketHeaderLen; n < 0 {
+			n = 0
+		}
+		return n, err
 	}
-
-	return n - streamingPacketHeaderLen, nil
+	return len(buf), nil
 }
@@ -1,6 +1,8 @@
 package ice
 
 import (
+	"bytes"
+	"errors"
 	"io"
 	"net"
 	"testing"
@@ -117,3 +119,96 @@ func TestTCPMux_NoDeadlockWhenClosingUnusedPacketConn(t *testing.T) {
 	assert.Nil(t, conn, "should receive nil because mux is closed")
 	assert.Equal(t, io.ErrClosedPipe, err, "should receive error because mux is closed")
 }
+
+var errShortWrite = errors.New("write deadline exceeded")
+
+// shortWriter writes at most limit bytes, failing like a write past its
+// deadline
+type shortWriter struct {
+	bytes.Buffer
+	limit int
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if len(p) <= w.limit {
+		w.limit -= len(p)
+		return w.Buffer.Write(p)
+	}
+	n, _ := w.Buffer.Write(p[:w.limit])
+	w.limit = 0
+	return n, errShortWrite
+}
+
+func TestStreamingPacketWriter(t *testing.T) {
+	t.Run("TooLarge", func(t *testing.T) {
+		w := newStreamingPacketWriter(&bytes.Buffer{})
+		_, err := w.writePacket(make([]byte, maxStreamingPacketSize+1))
+		assert.ErrorIs(t, err, ErrStreamingPacketTooLarge)
+
+		n, err := w.writePacket(make([]byte, maxStreamingPacketSize))
+		assert.NoError(t, err)
+		assert.Equal(t, maxStreamingPacketSize, n)
+	})
+
+	t.Run("PartialWrite", func(t *testing.T) {
+		out := &shortWriter{limit: 3}
+		w := newStreamingPacketWriter(out)
+
+		_, err := w.writePacket([]byte("first"))
+		assert.ErrorIs(t, err, errShortWrite)
+
+		// The rest of the first frame is written before the second one
+		out.limit = 100
+		n, err := w.writePacket([]byte("second"))
+		require.NoError(t, err)
+		assert.Equal(t, 6, n)
+
+		buf := make([]byte, receiveMTU)
+		for _, expected := range []string{"first", "second"} {
+			n, err = readStreamingPacket(&out.Buffer, buf)
+			require.NoError(t, err)
+			assert.Equal(t, expected, string(buf[:n]))
+		}
+	})
+}
+
+func TestReadStreamingPacketTooLarge(t *testing.T) {
+	stream := &bytes.Buffer{}
+	for _, size := range []int{16, 4, 32, 8} {
+		_, err := writeStreamingPacket(stream, make([]byte, size))
+		require.NoError(t, err)
+	}
+
+	// Packets larger than the buffer are skipped
+	buf := make([]byte, 10)
+	for _, size := range []int{16, 4, 32, 8} {
+		n, err := readStreamingPacket(stream, buf)
+		assert.Equal(t, size, n)
+		if size > len(buf) {
+			assert.ErrorIs(t, err, io.ErrShortBuffer)
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+	_, err := readStreamingPacket(stream, buf)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func BenchmarkStreamingPacket(b *testing.B) {
+	packet := make([]byte, 1200)
+	stream := &bytes.Buffer{}
+	stream.Grow(2 * (len(packet) + streamingPacketHeaderLen))
+	w := newStreamingPacketWriter(stream)
+	buf := make([]byte, receiveMTU)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(packet)))
+	for i := 0; i < b.N; i++ {
+		if _, err := w.writePacket(packet); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := readStreamingPacket(stream, buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
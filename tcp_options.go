@@ -0,0 +1,80 @@
+package ice
+
+import (
+	"net"
+	"time"
+)
+
+// TCPOptions are the socket options of the ICE-TCP connections of an agent,
+// set on the connections accepted by its TCPMux for its ufrag and on those
+// of its active candidates.
+type TCPOptions struct {
+	// NoDelay sets TCP_NODELAY, see TCPNoDelay. Left unchanged by default.
+	NoDelay TCPNoDelay
+
+	// KeepAlive enables TCP keepalives with this period, see
+	// net.TCPConn.SetKeepAlivePeriod. Keepalives are left unchanged if 0 and
+	// disabled if negative.
+	KeepAlive time.Duration
+
+	// UserTimeout sets TCP_USER_TIMEOUT, the time written data may remain
+	// unacknowledged before the connection is closed. Only supported on
+	// Linux, left unchanged if 0.
+	UserTimeout time.Duration
+}
+
+// TCPNoDelay is the TCP_NODELAY setting of TCPOptions. Go enables
+// TCP_NODELAY on all TCP connections, disabling Nagle's algorithm so that
+// small packets are written immediately.
+type TCPNoDelay int
+
+const (
+	// TCPNoDelayDefault leaves TCP_NODELAY unchanged
+	TCPNoDelayDefault TCPNoDelay = iota
+
+	// TCPNoDelayEnabled enables TCP_NODELAY
+	TCPNoDelayEnabled
+
+	// TCPNoDelayDisabled disables TCP_NODELAY, enabling Nagle's algorithm
+	TCPNoDelayDisabled
+)
+
+// tcpOptionsSetter is implemented by the connections of a TCPMux that
+// apply the TCPOptions of the agent they belong to.
+type tcpOptionsSetter interface {
+	setTCPOptions(options TCPOptions)
+}
+
+// apply sets the options on conn. Connections other than *net.TCPConn,
+// e.g. in tests, are left untouched.
+func (o TCPOptions) apply(conn net.Conn) error {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+
+	if o.NoDelay != TCPNoDelayDefault {
+		if err := tcpConn.SetNoDelay(o.NoDelay == TCPNoDelayEnabled); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case o.KeepAlive > 0:
+		if err := tcpConn.SetKeepAlive(true); err != nil {
+			return err
+		}
+		if err := tcpConn.SetKeepAlivePeriod(o.KeepAlive); err != nil {
+			return err
+		}
+	case o.KeepAlive < 0:
+		if err := tcpConn.SetKeepAlive(false); err != nil {
+			return err
+		}
+	}
+
+	if o.UserTimeout > 0 {
+		return setTCPUserTimeout(tcpConn, o.UserTimeout)
+	}
+	return nil
+}
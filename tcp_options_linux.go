@@ -0,0 +1,25 @@
+package ice
+
+import (
+	"net"
+	"syscall"
+	"time"
+)
+
+// tcpUserTimeout is TCP_USER_TIMEOUT, see tcp(7)
+const tcpUserTimeout = 0x12
+
+func setTCPUserTimeout(conn *net.TCPConn, timeout time.Duration) error {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var sockErr error
+	if err := rc.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpUserTimeout, int(timeout/time.Millisecond))
+	}); err != nil {
+		return err
+	}
+	return sockErr
+}
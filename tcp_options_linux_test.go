@@ -0,0 +1,77 @@
+package ice
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun"
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTCPOptions(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IP{127, 0, 0, 1}})
+	require.NoError(t, err)
+
+	tcpMux := NewTCPMuxDefault(TCPMuxParams{
+		Listener:       listener,
+		Logger:         logging.NewDefaultLoggerFactory().NewLogger("ice"),
+		ReadBufferSize: 20,
+	})
+	defer func() {
+		assert.NoError(t, tcpMux.Close())
+	}()
+
+	pktConn, err := tcpMux.GetConnByUfrag("myufrag", false)
+	require.NoError(t, err)
+	setter, ok := pktConn.(tcpOptionsSetter)
+	require.True(t, ok)
+	setter.setTCPOptions(TCPOptions{
+		NoDelay:     TCPNoDelayDisabled,
+		KeepAlive:   7 * time.Second,
+		UserTimeout: 5 * time.Second,
+	})
+
+	conn, err := net.DialTCP("tcp", nil, tcpMux.LocalAddr().(*net.TCPAddr)) //nolint:forcetypeassert
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, conn.Close())
+	}()
+
+	msg := stun.MustBuild(stun.BindingRequest, stun.NewUsername("myufrag:otherufrag"))
+	_, err = writeStreamingPacket(conn, msg.Raw)
+	require.NoError(t, err)
+
+	// The connection is added once its first packet is read
+	_, _, err = pktConn.ReadFrom(make([]byte, receiveMTU))
+	require.NoError(t, err)
+
+	tcpPacketConn := pktConn.(*tcpPacketConn) //nolint:forcetypeassert
+	tcpPacketConn.mu.Lock()
+	accepted, ok := tcpPacketConn.conns[conn.LocalAddr().String()].(*net.TCPConn)
+	tcpPacketConn.mu.Unlock()
+	require.True(t, ok)
+
+	sockopt := func(level, opt int) int {
+		rc, err := accepted.SyscallConn()
+		require.NoError(t, err)
+		var value int
+		var sockErr error
+		require.NoError(t, rc.Control(func(fd uintptr) {
+			value, sockErr = syscall.GetsockoptInt(int(fd), level, opt)
+		}))
+		require.NoError(t, sockErr)
+		return value
+	}
+	assert.Equal(t, 0, sockopt(syscall.IPPROTO_TCP, syscall.TCP_NODELAY))
+	assert.Equal(t, 1, sockopt(syscall.SOL_SOCKET, syscall.SO_KEEPALIVE))
+	assert.Equal(t, 7, sockopt(syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE))
+	assert.Equal(t, 5000, sockopt(syscall.IPPROTO_TCP, tcpUserTimeout))
+}
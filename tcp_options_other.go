@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package ice
+
+import (
+	"net"
+	"time"
+)
+
+// TCP_USER_TIMEOUT is only set on Linux
+
+func setTCPUserTimeout(*net.TCPConn, time.Duration) error {
+	return errTCPUserTimeoutUnsupported
+}
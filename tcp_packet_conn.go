@@ -45,7 +45,7 @@ func (bc *bufferedConn) Write(b []byte) (int, error) {
 }
 
 func (bc *bufferedConn) writeProcess() {
-	pktBuf := make([]byte, receiveMTU)
+	pktBuf := make([]byte, streamingPacketHeaderLen+maxStreamingPacketSize)
 	for atomic.LoadInt32(&bc.closed) == 0 {
 		n, err := bc.buffer.Read(pktBuf)
 		if errors.Is(err, io.EOF) {
@@ -73,11 +73,16 @@ func (bc *bufferedConn) Close() error {
 type tcpPacketConn struct {
 	params *tcpPacketParams
 
-	// conns is a map of net.Conns indexed by remote net.Addr.String()
-	conns map[string]net.Conn
+	// conns is a map of net.Conns indexed by remote net.Addr.String(),
+	// writers frames the packets written on them
+	conns   map[string]net.Conn
+	writers map[string]*streamingPacketWriter
 
 	recvChan chan streamingPacket
 
+	// tcpOptions are set on the connections, see setTCPOptions
+	tcpOptions *TCPOptions
+
 	mu         sync.Mutex
 	wg         sync.WaitGroup
 	closedChan chan struct{}
@@ -88,20 +93,26 @@ type streamingPacket struct {
 	Data  []byte
 	RAddr net.Addr
 	Err   error
+
+	// holder is the pooled buffer behind Data, released by ReadFrom
+	holder *bufferHolder
 }
 
 type tcpPacketParams struct {
-	ReadBuffer  int
-	LocalAddr   net.Addr
-	Logger      logging.LeveledLogger
-	WriteBuffer int
+	ReadBuffer         int
+	ReadBufferOverflow BufferOverflowPolicy
+	Dropped            *uint64
+	LocalAddr          net.Addr
+	Logger             logging.LeveledLogger
+	WriteBuffer        int
 }
 
 func newTCPPacketConn(params tcpPacketParams) *tcpPacketConn {
 	p := &tcpPacketConn{
 		params: &params,
 
-		conns: map[string]net.Conn{},
+		conns:   map[string]net.Conn{},
+		writers: map[string]*streamingPacketWriter{},
 
 		recvChan:   make(chan streamingPacket, params.ReadBuffer),
 		closedChan: make(chan struct{}),
@@ -126,15 +137,19 @@ func (t *tcpPacketConn) AddConn(conn net.Conn, firstPacketData []byte) error {
 		return fmt.Errorf("%w: %s", errConnectionAddrAlreadyExist, conn.RemoteAddr().String())
 	}
 
+	if t.tcpOptions != nil {
+		t.applyTCPOptions(conn, *t.tcpOptions)
+	}
 	if t.params.WriteBuffer > 0 {
 		conn = newBufferedConn(conn, t.params.WriteBuffer, t.params.Logger)
 	}
 	t.conns[conn.RemoteAddr().String()] = conn
+	t.writers[conn.RemoteAddr().String()] = newStreamingPacketWriter(conn)
 
 	t.wg.Add(1)
 	go func() {
 		if firstPacketData != nil {
-			t.recvChan <- streamingPacket{firstPacketData, conn.RemoteAddr(), nil}
+			t.recvChan <- streamingPacket{firstPacketData, conn.RemoteAddr(), nil, nil}
 		}
 		defer t.wg.Done()
 		t.startReading(conn)
@@ -143,24 +158,46 @@ func (t *tcpPacketConn) AddConn(conn net.Conn, firstPacketData []byte) error {
 	return nil
 }
 
-func (t *tcpPacketConn) startReading(conn net.Conn) {
-	buf := make([]byte, receiveMTU)
+// setTCPOptions sets options on the connections, and on those added later.
+func (t *tcpPacketConn) setTCPOptions(options TCPOptions) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 
+	t.tcpOptions = &options
+	for _, conn := range t.conns {
+		if bc, ok := conn.(*bufferedConn); ok {
+			conn = bc.Conn
+		}
+		t.applyTCPOptions(conn, options)
+	}
+}
+
+func (t *tcpPacketConn) applyTCPOptions(conn net.Conn, options TCPOptions) {
+	if err := options.apply(conn); err != nil {
+		t.params.Logger.Warnf("Failed to set TCP options on connection to %s: %s", conn.RemoteAddr(), err)
+	}
+}
+
+func (t *tcpPacketConn) startReading(conn net.Conn) {
 	for {
-		n, err := readStreamingPacket(conn, buf)
-		// t.params.Logger.Infof("readStreamingPacket read %d bytes", n)
+		// Packets are read straight into the pooled buffer handed to ReadFrom
+		holder := getPacketBuffer(nil)
+		n, err := readStreamingPacket(conn, holder.buffer)
+		if errors.Is(err, io.ErrShortBuffer) {
+			putPacketBuffer(holder)
+			t.params.Logger.Warnf("Discarded packet of %d bytes from %s, larger than the read buffer", n, conn.RemoteAddr())
+			continue
+		}
 		if err != nil {
-			t.params.Logger.Infof("%w: %s", errReadingStreamingPacket, err)
-			t.handleRecv(streamingPacket{nil, conn.RemoteAddr(), err})
+			putPacketBuffer(holder)
+			t.params.Logger.Infof("%v: %s", errReadingStreamingPacket, err)
+			t.handleRecv(streamingPacket{nil, conn.RemoteAddr(), err, nil})
 			t.removeConn(conn)
 			return
 		}
 
-		data := make([]byte, n)
-		copy(data, buf[:n])
-
-		// t.params.Logger.Infof("Writing read streaming packet to recvChan: %d bytes", len(data))
-		t.handleRecv(streamingPacket{data, conn.RemoteAddr(), nil})
+		holder.buffer = holder.buffer[:n]
+		t.handleRecv(streamingPacket{holder.buffer, conn.RemoteAddr(), nil, holder})
 	}
 }
 
@@ -174,9 +211,45 @@ func (t *tcpPacketConn) handleRecv(pkt streamingPacket) {
 
 	t.mu.Unlock()
 
-	select {
-	case recvChan <- pkt:
-	case <-t.closedChan:
+	switch t.params.ReadBufferOverflow {
+	case BufferOverflowDropNewest:
+		select {
+		case recvChan <- pkt:
+			return
+		case <-t.closedChan:
+		default:
+			t.countDropped()
+		}
+		putPacketBuffer(pkt.holder)
+	case BufferOverflowDropOldest:
+		for {
+			select {
+			case recvChan <- pkt:
+				return
+			case <-t.closedChan:
+				putPacketBuffer(pkt.holder)
+				return
+			default:
+			}
+
+			select {
+			case oldest := <-recvChan:
+				putPacketBuffer(oldest.holder)
+				t.countDropped()
+			default:
+			}
+		}
+	default:
+		select {
+		case recvChan <- pkt:
+		case <-t.closedChan:
+		}
+	}
+}
+
+func (t *tcpPacketConn) countDropped() {
+	if t.params.Dropped != nil {
+		atomic.AddUint64(t.params.Dropped, 1)
 	}
 }
 
@@ -201,6 +274,8 @@ func (t *tcpPacketConn) ReadFrom(b []byte) (n int, raddr net.Addr, err error) {
 		return 0, pkt.RAddr, pkt.Err
 	}
 
+	defer putPacketBuffer(pkt.holder)
+
 	if cap(b) < len(pkt.Data) {
 		return 0, pkt.RAddr, io.ErrShortBuffer
 	}
@@ -213,7 +288,7 @@ func (t *tcpPacketConn) ReadFrom(b []byte) (n int, raddr net.Addr, err error) {
 // WriteTo is for active and s-o candidates.
 func (t *tcpPacketConn) WriteTo(buf []byte, raddr net.Addr) (n int, err error) {
 	t.mu.Lock()
-	conn, ok := t.conns[raddr.String()]
+	writer, ok := t.writers[raddr.String()]
 	t.mu.Unlock()
 
 	if !ok {
@@ -229,7 +304,7 @@ func (t *tcpPacketConn) WriteTo(buf []byte, raddr net.Addr) (n int, err error) {
 		// t.conns[raddr.String()] = conn
 	}
 
-	n, err = writeStreamingPacket(conn, buf)
+	n, err = writer.writePacket(buf)
 	if err != nil {
 		t.params.Logger.Tracef("%w %s", errWriting, raddr)
 		return n, err
@@ -252,6 +327,7 @@ func (t *tcpPacketConn) removeConn(conn net.Conn) {
 	t.closeAndLogError(conn)
 
 	delete(t.conns, conn.RemoteAddr().String())
+	delete(t.writers, conn.RemoteAddr().String())
 }
 
 func (t *tcpPacketConn) Close() error {
@@ -266,6 +342,7 @@ func (t *tcpPacketConn) Close() error {
 	for _, conn := range t.conns {
 		t.closeAndLogError(conn)
 		delete(t.conns, conn.RemoteAddr().String())
+		delete(t.writers, conn.RemoteAddr().String())
 	}
 
 	t.mu.Unlock()
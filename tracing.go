@@ -0,0 +1,161 @@
+package ice
+
+import (
+	"context"
+	"errors"
+)
+
+// Span names, gathering spans are children of spanGather, spanNomination is a child of spanChecks
+const (
+	spanGather      = "ice.gather"
+	spanGatherHost  = "ice.gather.host"
+	spanGatherSrflx = "ice.gather.srflx"
+	spanGatherRelay = "ice.gather.relay"
+	spanChecks      = "ice.checks"
+	spanNomination  = "ice.nomination"
+)
+
+// Tracer starts the spans of gathering, connectivity checks and nomination,
+// see AgentConfig.Tracer. The iceotel module adapts an OpenTelemetry
+// TracerProvider to it.
+type Tracer interface {
+	// Start starts the span name as a child of the span in ctx, if any,
+	// and returns a context holding the new span.
+	Start(ctx context.Context, name string, attributes ...SpanAttribute) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	SetAttributes(attributes ...SpanAttribute)
+
+	// SetError records err and marks the span as failed
+	SetError(err error)
+
+	End()
+}
+
+// SpanAttribute is a key and value describing a Span.
+type SpanAttribute struct {
+	Key   string
+	Value string
+}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string, _ ...SpanAttribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...SpanAttribute) {}
+func (noopSpan) SetError(error)                 {}
+func (noopSpan) End()                           {}
+
+type spanContextKey struct{}
+
+// startSpan starts the span name, which spanFromContext finds in the
+// returned context.
+func (a *Agent) startSpan(ctx context.Context, name string, attributes ...SpanAttribute) (context.Context, Span) {
+	ctx, span := a.tracer.Start(ctx, name, attributes...)
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+// spanFromContext returns the span started by startSpan in ctx, a span
+// doing nothing if there is none.
+func spanFromContext(ctx context.Context) Span {
+	if span, ok := ctx.Value(spanContextKey{}).(Span); ok {
+		return span
+	}
+	return noopSpan{}
+}
+
+// startGatherSpan starts a span for the gathering done against url.
+func (a *Agent) startGatherSpan(ctx context.Context, name string, url URL, network string) (context.Context, Span) {
+	return a.startSpan(ctx, name,
+		SpanAttribute{"ice.url", url.String()},
+		SpanAttribute{"ice.network", network},
+	)
+}
+
+// traceConnectionState starts and ends the checks and nomination spans as
+// the connection state changes.
+// Note: the caller should hold the agent lock.
+func (a *Agent) traceConnectionState(newState ConnectionState, reason ConnectionStateChangeReason) {
+	switch newState {
+	case ConnectionStateChecking:
+		if a.checksSpan != nil {
+			return
+		}
+
+		role := "controlled"
+		if a.isControlling {
+			role = "controlling"
+		}
+		parent := a.tracingParent
+		if parent == nil {
+			parent = context.Background()
+		}
+		a.checksContext, a.checksSpan = a.startSpan(parent, spanChecks,
+			SpanAttribute{"ice.role", role},
+			SpanAttribute{"ice.ufrag", a.localUfrag},
+		)
+	case ConnectionStateConnected:
+		a.endNominationSpan("")
+		if a.checksSpan != nil {
+			if p := a.getSelectedPair(); p != nil {
+				a.checksSpan.SetAttributes(
+					SpanAttribute{"ice.local_candidate", p.Local.String()},
+					SpanAttribute{"ice.remote_candidate", p.Remote.String()},
+				)
+			}
+			a.endChecksSpan()
+		}
+	case ConnectionStateFailed, ConnectionStateClosed:
+		a.endNominationSpan(reason.String())
+		if a.checksSpan != nil {
+			a.checksSpan.SetError(errors.New(reason.String())) //nolint:goerr113
+			a.endChecksSpan()
+		}
+	default:
+	}
+}
+
+// endChecksSpan ends the checks span.
+// Note: the caller should hold the agent lock.
+func (a *Agent) endChecksSpan() {
+	a.checksSpan.End()
+	a.checksSpan = nil
+	a.checksContext = nil
+}
+
+// startNominationSpan is called when the controlling agent first nominates a pair.
+// Note: the caller should hold the agent lock.
+func (a *Agent) startNominationSpan(p *CandidatePair) {
+	if a.nominationSpan != nil {
+		return
+	}
+
+	parent := a.checksContext
+	if parent == nil {
+		parent = context.Background()
+	}
+	_, a.nominationSpan = a.startSpan(parent, spanNomination,
+		SpanAttribute{"ice.local_candidate", p.Local.String()},
+		SpanAttribute{"ice.remote_candidate", p.Remote.String()},
+	)
+}
+
+// endNominationSpan ends the nomination span, as failed if errDescription is set.
+// Note: the caller should hold the agent lock.
+func (a *Agent) endNominationSpan(errDescription string) {
+	if a.nominationSpan == nil {
+		return
+	}
+
+	if errDescription != "" {
+		a.nominationSpan.SetError(errors.New(errDescription)) //nolint:goerr113
+	}
+	a.nominationSpan.End()
+	a.nominationSpan = nil
+}
@@ -0,0 +1,132 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingTracer keeps every span started through it
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordingSpan
+}
+
+type recordingSpan struct {
+	mu     sync.Mutex
+	name   string
+	parent string
+	err    error
+	ended  bool
+}
+
+type recordingSpanKey struct{}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, _ ...SpanAttribute) (context.Context, Span) {
+	s := &recordingSpan{name: name}
+	if parent, ok := ctx.Value(recordingSpanKey{}).(*recordingSpan); ok {
+		s.parent = parent.name
+	}
+
+	t.mu.Lock()
+	t.spans = append(t.spans, s)
+	t.mu.Unlock()
+
+	return context.WithValue(ctx, recordingSpanKey{}, s), s
+}
+
+func (t *recordingTracer) find(name string) []*recordingSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var spans []*recordingSpan
+	for _, s := range t.spans {
+		if s.name == name {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+func (s *recordingSpan) SetAttributes(...SpanAttribute) {}
+
+func (s *recordingSpan) SetError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func (s *recordingSpan) End() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ended = true
+}
+
+func (s *recordingSpan) isEnded() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ended
+}
+
+func (s *recordingSpan) getError() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func TestTracing(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 10)
+	defer lim.Stop()
+
+	aTracer, bTracer := &recordingTracer{}, &recordingTracer{}
+
+	aAgent, err := NewAgent(&AgentConfig{
+		NetworkTypes: supportedNetworkTypes(),
+		Tracer:       aTracer,
+	})
+	assert.NoError(t, err)
+
+	bAgent, err := NewAgent(&AgentConfig{
+		NetworkTypes: supportedNetworkTypes(),
+		Tracer:       bTracer,
+	})
+	assert.NoError(t, err)
+
+	// aAgent accepts, bAgent dials
+	connect(aAgent, bAgent)
+
+	assert.NoError(t, aAgent.Close())
+	assert.NoError(t, bAgent.Close())
+
+	for _, p := range []*recordingTracer{aTracer, bTracer} {
+		gather := p.find(spanGather)
+		assert.Len(t, gather, 1)
+		assert.True(t, gather[0].isEnded())
+
+		host := p.find(spanGatherHost)
+		assert.Len(t, host, 1)
+		assert.Equal(t, spanGather, host[0].parent)
+		assert.True(t, host[0].isEnded())
+
+		checks := p.find(spanChecks)
+		assert.Len(t, checks, 1)
+		assert.True(t, checks[0].isEnded())
+		assert.NoError(t, checks[0].getError())
+	}
+
+	nomination := bTracer.find(spanNomination)
+	assert.Len(t, nomination, 1)
+	assert.Equal(t, spanChecks, nomination[0].parent)
+	assert.True(t, nomination[0].isEnded())
+	assert.Empty(t, aTracer.find(spanNomination))
+}
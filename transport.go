@@ -2,6 +2,7 @@ package ice
 
 import (
 	"context"
+	"errors"
 	"net"
 	"sync/atomic"
 	"time"
@@ -10,17 +11,45 @@ import (
 )
 
 // Dial connects to the remote agent, acting as the controlling ice agent.
-// Dial blocks until at least one ice candidate pair has successfully connected.
+// Dial blocks until at least one ice candidate pair has successfully connected,
+// the agent is closed or ctx is done. In the latter case the returned error
+// matches both ErrCanceledByCaller and ctx.Err() with errors.Is, and the
+// checks go on: calling Dial or Accept again with the same remote credentials
+// waits for them again. Calling it again with new remote credentials handles
+// an ICE restart of the remote agent, see SetRemoteCredentials, other calls
+// return ErrMultipleStart.
 func (a *Agent) Dial(ctx context.Context, remoteUfrag, remotePwd string) (*Conn, error) {
 	return a.connect(ctx, true, remoteUfrag, remotePwd)
 }
 
 // Accept connects to the remote agent, acting as the controlled ice agent.
-// Accept blocks until at least one ice candidate pair has successfully connected.
+// Accept blocks until at least one ice candidate pair has successfully connected,
+// the agent is closed or ctx is done. In the latter case the returned error
+// matches both ErrCanceledByCaller and ctx.Err() with errors.Is. Like Dial,
+// it can be called again once ctx is done, and it handles an ICE restart of
+// the remote agent when called again with new remote credentials.
 func (a *Agent) Accept(ctx context.Context, remoteUfrag, remotePwd string) (*Conn, error) {
 	return a.connect(ctx, false, remoteUfrag, remotePwd)
 }
 
+// canceledError is returned when the context of Dial or Accept is done
+// before a candidate pair is selected.
+type canceledError struct {
+	err error
+}
+
+func (e *canceledError) Error() string {
+	return ErrCanceledByCaller.Error() + ": " + e.err.Error()
+}
+
+func (e *canceledError) Is(target error) bool {
+	return target == ErrCanceledByCaller
+}
+
+func (e *canceledError) Unwrap() error {
+	return e.err
+}
+
 // Conn represents the ICE connection.
 // At the moment the lifetime of the Conn is equal to the Agent.
 type Conn struct {
@@ -44,17 +73,30 @@ func (a *Agent) connect(ctx context.Context, isControlling bool, remoteUfrag, re
 	if err != nil {
 		return nil, err
 	}
-	err = a.startConnectivityChecks(isControlling, remoteUfrag, remotePwd) //nolint:contextcheck
+	err = a.startConnectivityChecks(ctx, isControlling, remoteUfrag, remotePwd)
+	if errors.Is(err, ErrMultipleStart) {
+		if a.resumeConnect(remoteUfrag, remotePwd) {
+			return a.waitConnected(ctx)
+		}
+		return a.reconnect(ctx, isControlling, remoteUfrag, remotePwd, err)
+	}
 	if err != nil {
 		return nil, err
 	}
+	return a.waitConnected(ctx)
+}
 
-	// block until pair selected
+// waitConnected blocks until a pair is selected. When ctx is done first,
+// Dial or Accept may be called again, see resumeConnect.
+func (a *Agent) waitConnected(ctx context.Context) (*Conn, error) {
 	select {
 	case <-a.done:
 		return nil, a.getErr()
 	case <-ctx.Done():
-		return nil, ErrCanceledByCaller
+		a.muHaveStarted.Lock()
+		a.connectCanceled = true
+		a.muHaveStarted.Unlock()
+		return nil, &canceledError{ctx.Err()}
 	case <-a.onConnected:
 	}
 
@@ -63,6 +105,60 @@ func (a *Agent) connect(ctx context.Context, isControlling bool, remoteUfrag, re
 	}, nil
 }
 
+// resumeConnect reports whether Dial or Accept is called again, with the
+// same remote credentials, after the context of a previous call was done.
+// The checks went on meanwhile, the call only has to wait for them again.
+func (a *Agent) resumeConnect(remoteUfrag, remotePwd string) bool {
+	a.muHaveStarted.Lock()
+	defer a.muHaveStarted.Unlock()
+	if !a.connectCanceled {
+		return false
+	}
+
+	same := false
+	if err := a.run(a.context(), func(ctx context.Context, agent *Agent) {
+		same = agent.remoteUfrag == remoteUfrag && agent.remotePwd == remotePwd
+	}); err != nil {
+		return false
+	}
+	if same {
+		a.connectCanceled = false
+	}
+	return same
+}
+
+// reconnect handles Dial or Accept called again with new remote credentials,
+// for an ICE restart of the remote agent in the same role. It blocks until
+// the agent is connected again, otherwise it returns startErr.
+func (a *Agent) reconnect(ctx context.Context, isControlling bool, remoteUfrag, remotePwd string, startErr error) (*Conn, error) {
+	if err := a.checkRemoteCredentials(remoteUfrag, remotePwd); err != nil {
+		return nil, err
+	}
+
+	restarted := false
+	if err := a.run(ctx, func(ctx context.Context, agent *Agent) {
+		if agent.isControlling == isControlling && agent.isRemoteRestart(remoteUfrag, remotePwd) {
+			agent.restartRemote(remoteUfrag, remotePwd)
+			restarted = true
+		}
+	}); err != nil {
+		return nil, err
+	}
+	if !restarted {
+		return nil, startErr
+	}
+
+	if err := a.WaitForConnectionState(ctx, ConnectionStateConnected); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, &canceledError{ctxErr}
+		}
+		return nil, err
+	}
+	return &Conn{
+		agent: a,
+	}, nil
+}
+
 // Read implements the Conn Read method.
 func (c *Conn) Read(p []byte) (int, error) {
 	err := c.agent.ok()
@@ -77,30 +173,36 @@ func (c *Conn) Read(p []byte) (int, error) {
 
 // Write implements the Conn Write method.
 func (c *Conn) Write(p []byte) (int, error) {
-	err := c.agent.ok()
-	if err != nil {
+	pair, err := c.agent.writablePair(p)
+	if pair == nil {
 		return 0, err
 	}
 
+	atomic.AddUint64(&c.bytesSent, uint64(len(p)))
+	return pair.Write(p)
+}
+
+// writablePair returns the pair data p is written on, the selected pair or
+// else the best valid pair, nil if there is none or p can't be written.
+func (a *Agent) writablePair(p []byte) (*CandidatePair, error) {
+	err := a.ok()
+	if err != nil {
+		return nil, err
+	}
+
 	if stun.IsMessage(p) {
-		return 0, errICEWriteSTUNMessage
+		return nil, errICEWriteSTUNMessage
 	}
 
-	pair := c.agent.getSelectedPair()
+	pair := a.getSelectedPair()
 	if pair == nil {
-		if err = c.agent.run(c.agent.context(), func(ctx context.Context, a *Agent) {
-			pair = a.getBestValidCandidatePair()
+		if err = a.run(a.context(), func(ctx context.Context, agent *Agent) {
+			pair = agent.getBestValidCandidatePair()
 		}); err != nil {
-			return 0, err
-		}
-
-		if pair == nil {
-			return 0, err
+			return nil, err
 		}
 	}
-
-	atomic.AddUint64(&c.bytesSent, uint64(len(p)))
-	return pair.Write(p)
+	return pair, nil
 }
 
 // Close implements the Conn Close method. It is used to close
@@ -129,17 +231,19 @@ func (c *Conn) RemoteAddr() net.Addr {
 	return pair.Remote.addr()
 }
 
-// SetDeadline is a stub
+// SetDeadline sets the read deadline, writes do not block.
 func (c *Conn) SetDeadline(t time.Time) error {
-	return nil
+	return c.SetReadDeadline(t)
 }
 
-// SetReadDeadline is a stub
+// SetReadDeadline makes Read return an error whose Timeout method returns
+// true once t is reached. A zero t disables the deadline. The deadline is
+// shared by the Conn and PacketConn of the agent.
 func (c *Conn) SetReadDeadline(t time.Time) error {
-	return nil
+	return c.agent.buffer.SetReadDeadline(t)
 }
 
-// SetWriteDeadline is a stub
+// SetWriteDeadline is a stub, writes do not block.
 func (c *Conn) SetWriteDeadline(t time.Time) error {
 	return nil
 }
@@ -5,12 +5,15 @@ package ice
 
 import (
 	"context"
+	"errors"
 	"net"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestStressDuplex(t *testing.T) {
@@ -361,3 +364,126 @@ func TestConnStats(t *testing.T) {
 		panic(err)
 	}
 }
+
+func TestConnectContextCanceled(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	for _, connect := range []func(a *Agent, ctx context.Context) (*Conn, error){
+		func(a *Agent, ctx context.Context) (*Conn, error) { return a.Dial(ctx, "ufrag", "pwd") },
+		func(a *Agent, ctx context.Context) (*Conn, error) { return a.Accept(ctx, "ufrag", "pwd") },
+	} {
+		a, err := NewAgent(&AgentConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, err = connect(a, ctx)
+		cancel()
+		if !errors.Is(err, ErrCanceledByCaller) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// It can be called again, after the context is done
+		ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, err = connect(a, ctx)
+		cancel()
+		if !errors.Is(err, ErrCanceledByCaller) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := a.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMaxPacketSize(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 20)
+	defer lim.Stop()
+
+	read := func(c *Conn) (int, error) {
+		return c.Read(make([]byte, 16384))
+	}
+
+	// A jumbo frame is larger than the default maximum, it is only counted
+	ca, cb := pipe(nil)
+	_, err := ca.Write(make([]byte, 9000))
+	require.NoError(t, err)
+	_, err = ca.Write(make([]byte, 1000))
+	require.NoError(t, err)
+	n, err := read(cb)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, n)
+	assert.Equal(t, uint64(1), cb.agent.GetReceiveBufferStats().TooLarge)
+	assert.NoError(t, ca.Close())
+	assert.NoError(t, cb.Close())
+
+	// Read returns ErrPacketTooLarge in its place if reported
+	ca, cb = pipe(&AgentConfig{ReportPacketTooLarge: true})
+	_, err = ca.Write(make([]byte, 9000))
+	require.NoError(t, err)
+	_, err = read(cb)
+	assert.ErrorIs(t, err, ErrPacketTooLarge)
+	assert.Equal(t, uint64(1), cb.agent.GetReceiveBufferStats().TooLarge)
+
+	_, err = ca.Write(make([]byte, 1000))
+	require.NoError(t, err)
+	n, err = read(cb)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, n)
+	assert.NoError(t, ca.Close())
+	assert.NoError(t, cb.Close())
+
+	ca, cb = pipe(&AgentConfig{MaxPacketSize: 9000})
+	_, err = ca.Write(make([]byte, 9000))
+	require.NoError(t, err)
+	n, err = read(cb)
+	require.NoError(t, err)
+	assert.Equal(t, 9000, n)
+	assert.NoError(t, ca.Close())
+	assert.NoError(t, cb.Close())
+}
+
+func TestConnectAfterCancel(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 10)
+	defer lim.Stop()
+
+	aAgent, err := NewAgent(&AgentConfig{NetworkTypes: supportedNetworkTypes()})
+	assert.NoError(t, err)
+	bAgent, err := NewAgent(&AgentConfig{NetworkTypes: supportedNetworkTypes()})
+	assert.NoError(t, err)
+
+	gatherAndExchangeCandidates(aAgent, bAgent)
+
+	aUfrag, aPwd, err := aAgent.GetLocalUserCredentials()
+	assert.NoError(t, err)
+	bUfrag, bPwd, err := bAgent.GetLocalUserCredentials()
+	assert.NoError(t, err)
+
+	// bAgent gives up before aAgent accepts
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = bAgent.Dial(ctx, aUfrag, aPwd)
+	assert.ErrorIs(t, err, ErrCanceledByCaller)
+
+	accepted := make(chan error)
+	go func() {
+		_, acceptErr := aAgent.Accept(context.Background(), bUfrag, bPwd)
+		accepted <- acceptErr
+	}()
+
+	_, err = bAgent.Dial(context.Background(), aUfrag, aPwd)
+	assert.NoError(t, err)
+	assert.NoError(t, <-accepted)
+
+	assert.NoError(t, aAgent.Close())
+	assert.NoError(t, bAgent.Close())
+}
@@ -0,0 +1,93 @@
+package ice
+
+import (
+	"net"
+	"time"
+
+	"github.com/pion/stun"
+)
+
+// maxPendingTriggeredChecks bounds the triggered checks waiting for their
+// remote candidate, binding requests from unknown addresses may be spoofed.
+const maxPendingTriggeredChecks = 16
+
+// pendingTriggeredCheck is a triggered check (RFC 8445, section 7.3.1.4)
+// for a binding request from an address that is not a remote candidate yet
+// and could not be learned as a peer reflexive one. It is sent as soon as
+// the remote candidate is signaled, rather than once the peer retransmits
+// its request.
+type pendingTriggeredCheck struct {
+	local        Candidate
+	remote       net.Addr
+	useCandidate bool
+	received     time.Time
+}
+
+// queueTriggeredCheck remembers the binding request m received by local
+// from remote, which is not a remote candidate yet.
+// Note: the caller should hold the agent lock.
+func (a *Agent) queueTriggeredCheck(m *stun.Message, local Candidate, remote net.Addr) {
+	now := a.clock.Now()
+	pending := a.pendingTriggeredChecks[:0]
+	for _, check := range a.pendingTriggeredChecks {
+		if now.Sub(check.received) < maxBindingRequestTimeout && !(check.local == local && addrEqual(check.remote, remote)) {
+			pending = append(pending, check)
+		}
+	}
+	for i := len(pending); i < len(a.pendingTriggeredChecks); i++ {
+		a.pendingTriggeredChecks[i] = pendingTriggeredCheck{}
+	}
+	if len(pending) >= maxPendingTriggeredChecks {
+		copy(pending, pending[1:])
+		pending = pending[:len(pending)-1]
+	}
+
+	a.pendingTriggeredChecks = append(pending, pendingTriggeredCheck{
+		local:        local,
+		remote:       remote,
+		useCandidate: m.Contains(stun.AttrUseCandidate),
+		received:     now,
+	})
+	a.log.Debugf("Queuing triggered check from %s to %s until the remote candidate is known", local, remote)
+}
+
+// sendPendingTriggeredChecks sends the triggered checks queued for the
+// remote candidate c, which was just added. The nomination of a binding
+// request with USE-CANDIDATE is applied once the check succeeds, as if the
+// pair had been formed when the request was received.
+// Note: the caller should hold the agent lock.
+func (a *Agent) sendPendingTriggeredChecks(c Candidate) {
+	if len(a.pendingTriggeredChecks) == 0 || a.selector == nil {
+		return
+	}
+
+	now := a.clock.Now()
+	pending := a.pendingTriggeredChecks[:0]
+	var ready []pendingTriggeredCheck
+	for _, check := range a.pendingTriggeredChecks {
+		switch {
+		case now.Sub(check.received) >= maxBindingRequestTimeout:
+		case check.local.NetworkType() == c.NetworkType() && addrEqual(check.remote, c.addr()):
+			ready = append(ready, check)
+		default:
+			pending = append(pending, check)
+		}
+	}
+	for i := len(pending); i < len(a.pendingTriggeredChecks); i++ {
+		a.pendingTriggeredChecks[i] = pendingTriggeredCheck{}
+	}
+	a.pendingTriggeredChecks = pending
+
+	for _, check := range ready {
+		p := a.findPair(check.local, c)
+		if p == nil {
+			p = a.addPair(check.local, c)
+		}
+		if check.useCandidate && !a.isControlling && p.state != CandidatePairStateSucceeded {
+			p.nominateOnBindingSuccess = true
+		}
+
+		a.log.Debugf("Sending triggered check queued by a binding request: %s", p)
+		a.selector.PingCandidate(check.local, c)
+	}
+}
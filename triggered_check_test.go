@@ -0,0 +1,55 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/stun"
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPendingTriggeredCheck(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 2)
+	defer lim.Stop()
+
+	runAgentTest(t, &AgentConfig{DisablePeerReflexiveCandidates: true}, func(ctx context.Context, a *Agent) {
+		a.selector = &controlledSelector{agent: a, log: a.log}
+		a.remoteUfrag = "remoteUfrag"
+		a.remotePwd = "remotePwdremotePwdremotePwd"
+
+		local := newInboundLocal(t, nil)
+		a.localCandidates[local.NetworkType()] = []Candidate{local}
+
+		// The request of the peer overtakes the signaling of its candidate
+		msg, err := stun.Build(stun.BindingRequest, stun.TransactionID,
+			stun.NewUsername(a.localUfrag+":"+a.remoteUfrag),
+			UseCandidate(),
+			AttrControlling(a.tieBreaker+1),
+			PriorityAttr(local.Priority()),
+			stun.NewShortTermIntegrity(a.localPwd),
+			stun.Fingerprint,
+		)
+		require.NoError(t, err)
+		a.handleInbound(msg, local, inboundRemoteAddr())
+		assert.Empty(t, a.checklist)
+		assert.Empty(t, a.pendingBindingRequests)
+
+		remote := newInboundRemote(t)
+		a.addRemoteCandidate(remote)
+
+		p := a.findPair(local, remote)
+		require.NotNil(t, p)
+		assert.True(t, p.nominateOnBindingSuccess)
+		assert.Len(t, a.pendingBindingRequests, 1)
+		assert.Empty(t, a.pendingTriggeredChecks)
+	})
+}
@@ -0,0 +1,84 @@
+package ice
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"time"
+)
+
+const (
+	turnFrameHeaderLen  = 4
+	stunHeaderLen       = 20
+	minChannelNumber    = 0x4000
+	maxChannelNumber    = 0x7FFF
+	channelDataPadding  = 4
+	stunMessageTypeMask = 0xC0
+)
+
+// turnStreamConn wraps the TCP or TLS conn to a TURN server and emulates
+// net.PacketConn, one STUN message or ChannelData message per ReadFrom
+// (RFC 6062, section 4.1). It replaces turn.STUNConn, which copies every
+// read into a growing buffer: frames are read straight into the caller's
+// buffer, so the TURN client's read loop does not allocate per packet.
+type turnStreamConn struct {
+	nextConn net.Conn
+}
+
+// ReadFrom reads one frame into p. If p is too small the frame is discarded
+// and io.ErrShortBuffer is returned, as by readStreamingPacket.
+func (c *turnStreamConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, err := readTURNFrame(c.nextConn, p)
+	if err != nil {
+		return n, nil, err
+	}
+	return n, c.nextConn.RemoteAddr(), nil
+}
+
+func (c *turnStreamConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	return c.nextConn.Write(p)
+}
+
+func (c *turnStreamConn) Close() error                       { return c.nextConn.Close() }
+func (c *turnStreamConn) LocalAddr() net.Addr                { return c.nextConn.LocalAddr() }
+func (c *turnStreamConn) SetDeadline(t time.Time) error      { return c.nextConn.SetDeadline(t) }
+func (c *turnStreamConn) SetReadDeadline(t time.Time) error  { return c.nextConn.SetReadDeadline(t) }
+func (c *turnStreamConn) SetWriteDeadline(t time.Time) error { return c.nextConn.SetWriteDeadline(t) }
+
+// readTURNFrame reads a STUN or ChannelData message from conn into buf. Both
+// carry their length in the first 4 bytes, ChannelData is padded to a
+// multiple of 4 over streams.
+func readTURNFrame(conn io.Reader, buf []byte) (int, error) {
+	if len(buf) < turnFrameHeaderLen {
+		return 0, io.ErrShortBuffer
+	}
+	if _, err := io.ReadFull(conn, buf[:turnFrameHeaderLen]); err != nil {
+		return 0, err
+	}
+
+	length := int(binary.BigEndian.Uint16(buf[2:]))
+	switch number := binary.BigEndian.Uint16(buf); {
+	case buf[0]&stunMessageTypeMask == 0:
+		length += stunHeaderLen
+	case number >= minChannelNumber && number <= maxChannelNumber:
+		if r := length % channelDataPadding; r != 0 {
+			length += channelDataPadding - r
+		}
+		length += turnFrameHeaderLen
+	default:
+		return 0, errInvalidTURNFrame
+	}
+
+	if length > len(buf) {
+		if _, err := io.CopyN(ioutil.Discard, conn, int64(length-turnFrameHeaderLen)); err != nil {
+			return 0, err
+		}
+		return length, io.ErrShortBuffer
+	}
+
+	if _, err := io.ReadFull(conn, buf[turnFrameHeaderLen:length]); err != nil {
+		return 0, err
+	}
+	return length, nil
+}
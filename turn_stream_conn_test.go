@@ -0,0 +1,84 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"testing/iotest"
+
+	"github.com/pion/stun"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// streamConn reads from a stream of bytes.
+type streamConn struct {
+	net.Conn
+	r    io.Reader
+	addr net.Addr
+}
+
+func (c *streamConn) Read(p []byte) (int, error) { return c.r.Read(p) }
+func (c *streamConn) RemoteAddr() net.Addr       { return c.addr }
+
+func TestTURNStreamConn(t *testing.T) {
+	msg, err := stun.Build(stun.BindingRequest, stun.TransactionID, stun.Fingerprint)
+	require.NoError(t, err)
+	// ChannelData on channel 0x4000 with 5 bytes of data, padded to 8
+	channelData := []byte{0x40, 0x00, 0x00, 0x05, 1, 2, 3, 4, 5, 0, 0, 0}
+
+	stream := append(append([]byte{}, msg.Raw...), channelData...)
+
+	t.Run("Frames", func(t *testing.T) {
+		c := &turnStreamConn{&streamConn{addr: inboundRemoteAddr(), r: iotest.OneByteReader(bytes.NewReader(stream))}}
+		buf := make([]byte, receiveMTU)
+
+		n, addr, err := c.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, msg.Raw, buf[:n])
+		assert.Equal(t, inboundRemoteAddr(), addr)
+
+		n, _, err = c.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, channelData, buf[:n])
+
+		_, _, err = c.ReadFrom(buf)
+		assert.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("ShortBuffer", func(t *testing.T) {
+		c := &turnStreamConn{&streamConn{addr: inboundRemoteAddr(), r: bytes.NewReader(stream)}}
+
+		_, _, err := c.ReadFrom(make([]byte, 8))
+		assert.ErrorIs(t, err, io.ErrShortBuffer)
+
+		// The frame is discarded, the next one is read whole
+		buf := make([]byte, receiveMTU)
+		n, _, err := c.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, channelData, buf[:n])
+	})
+
+	t.Run("InvalidFrame", func(t *testing.T) {
+		c := &turnStreamConn{&streamConn{addr: inboundRemoteAddr(), r: bytes.NewReader([]byte{0x80, 0, 0, 0})}}
+		_, _, err := c.ReadFrom(make([]byte, receiveMTU))
+		assert.ErrorIs(t, err, errInvalidTURNFrame)
+	})
+
+	t.Run("NoAllocations", func(t *testing.T) {
+		r := bytes.NewReader(stream)
+		c := &turnStreamConn{&streamConn{addr: inboundRemoteAddr(), r: r}}
+		buf := make([]byte, receiveMTU)
+
+		allocs := testing.AllocsPerRun(100, func() {
+			r.Reset(stream)
+			_, _, _ = c.ReadFrom(buf)
+			_, _, _ = c.ReadFrom(buf)
+		})
+		assert.Zero(t, allocs)
+	})
+}
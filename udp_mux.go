@@ -7,6 +7,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/pion/logging"
 	"github.com/pion/stun"
@@ -21,6 +22,10 @@ type UDPMux interface {
 
 // UDPMuxDefault is an implementation of the interface
 type UDPMuxDefault struct {
+	// dropped counts the packets dropped by the buffers of all connections,
+	// first in the struct to be 64-bit aligned for atomic operations
+	dropped uint64
+
 	params UDPMuxParams
 
 	closedChan chan struct{}
@@ -44,6 +49,21 @@ const maxAddrSize = 512
 type UDPMuxParams struct {
 	Logger  logging.LeveledLogger
 	UDPConn net.PacketConn
+
+	// ReadBufferSize is the number of bytes buffered for each connection
+	// until its candidate reads them, addresses included. Defaults to 0,
+	// unlimited.
+	ReadBufferSize int
+
+	// ReadBufferOverflow decides what happens to packets received for a
+	// connection whose buffer is full. Defaults to BufferOverflowDropNewest.
+	// BufferOverflowBlock stops the reads from UDPConn, for all connections,
+	// until the packet fits.
+	ReadBufferOverflow BufferOverflowPolicy
+
+	// IOBackend selects how UDPConn is read, several packets at a time
+	// with IOBackendIOUring. The default reads one packet at a time.
+	IOBackend IOBackend
 }
 
 // NewUDPMuxDefault creates an implementation of UDPMux
@@ -58,12 +78,8 @@ func NewUDPMuxDefault(params UDPMuxParams) *UDPMuxDefault {
 		connsIPv4:  make(map[string]*udpMuxedConn),
 		connsIPv6:  make(map[string]*udpMuxedConn),
 		closedChan: make(chan struct{}, 1),
-		pool: &sync.Pool{
-			New: func() interface{} {
-				// big enough buffer to fit both packet and address
-				return newBufferHolder(receiveMTU + maxAddrSize)
-			},
-		},
+		// big enough buffers to fit both packet and address
+		pool: packetBufferPool,
 	}
 
 	go m.connWorker()
@@ -71,6 +87,12 @@ func NewUDPMuxDefault(params UDPMuxParams) *UDPMuxDefault {
 	return m
 }
 
+// DroppedPackets returns the number of packets dropped because the read
+// buffer of their connection was full, see UDPMuxParams.ReadBufferSize.
+func (m *UDPMuxDefault) DroppedPackets() uint64 {
+	return atomic.LoadUint64(&m.dropped)
+}
+
 // LocalAddr returns the listening address of this UDPMuxDefault
 func (m *UDPMuxDefault) LocalAddr() net.Addr {
 	return m.params.UDPConn.LocalAddr()
@@ -208,6 +230,18 @@ func (m *UDPMuxDefault) connWorker() {
 		_ = m.Close()
 	}()
 
+	if m.params.IOBackend == IOBackendIOUring {
+		batch, err := newIOUringBatchConn(m.params.UDPConn)
+		if err == nil {
+			m.batchWorker(batch)
+			if closer, ok := batch.(io.Closer); ok {
+				_ = closer.Close()
+			}
+			return
+		}
+		logger.Warnf("Failed to set up io_uring, reading one packet at a time: %v", err)
+	}
+
 	buf := make([]byte, receiveMTU)
 	for {
 		n, addr, err := m.params.UDPConn.ReadFrom(buf)
@@ -223,51 +257,87 @@ func (m *UDPMuxDefault) connWorker() {
 			return
 		}
 
-		udpAddr, ok := addr.(*net.UDPAddr)
-		if !ok {
-			logger.Errorf("underlying PacketConn did not return a UDPAddr")
+		if !m.handlePacket(buf[:n], addr) {
 			return
 		}
+	}
+}
 
-		// If we have already seen this address dispatch to the appropriate destination
-		m.addressMapMu.Lock()
-		destinationConn := m.addressMap[addr.String()]
-		m.addressMapMu.Unlock()
-
-		// If we haven't seen this address before but is a STUN packet lookup by ufrag
-		if destinationConn == nil && stun.IsMessage(buf[:n]) {
-			msg := &stun.Message{
-				Raw: append([]byte{}, buf[:n]...),
-			}
+// batchWorker is connWorker for batched reads.
+func (m *UDPMuxDefault) batchWorker(batch packetBatchConn) {
+	packets := make([]batchPacket, udpBatchSize)
+	for i := range packets {
+		packets[i].buf = make([]byte, batch.ReadBufferSize())
+	}
 
-			if err = msg.Decode(); err != nil {
-				m.params.Logger.Warnf("Failed to handle decode ICE from %s: %v", addr.String(), err)
+	for {
+		n, err := batch.ReadBatch(packets)
+		if m.IsClosed() {
+			return
+		} else if err != nil {
+			if os.IsTimeout(err) {
 				continue
+			} else if !errors.Is(err, io.EOF) {
+				m.params.Logger.Errorf("could not read udp packet: %v", err)
 			}
 
-			attr, stunAttrErr := msg.Get(stun.AttrUsername)
-			if stunAttrErr != nil {
-				m.params.Logger.Warnf("No Username attribute in STUN message from %s", addr.String())
-				continue
+			return
+		}
+
+		for _, p := range packets[:n] {
+			if !m.handlePacket(p.buf[:p.n], p.addr) {
+				return
 			}
+		}
+	}
+}
 
-			ufrag := strings.Split(string(attr), ":")[0]
-			isIPv6 := udpAddr.IP.To4() == nil
+// handlePacket dispatches the packet buf received from addr to its
+// connection. It returns false if the mux should stop reading.
+func (m *UDPMuxDefault) handlePacket(buf []byte, addr net.Addr) bool {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		m.params.Logger.Errorf("underlying PacketConn did not return a UDPAddr")
+		return false
+	}
 
-			m.mu.Lock()
-			destinationConn, _ = m.getConn(ufrag, isIPv6)
-			m.mu.Unlock()
+	// If we have already seen this address dispatch to the appropriate destination
+	m.addressMapMu.Lock()
+	destinationConn := m.addressMap[addr.String()]
+	m.addressMapMu.Unlock()
+
+	// If we haven't seen this address before but is a STUN packet lookup by ufrag
+	if destinationConn == nil && stun.IsMessage(buf) {
+		msg := &stun.Message{
+			Raw: append([]byte{}, buf...),
 		}
 
-		if destinationConn == nil {
-			m.params.Logger.Tracef("dropping packet from %s, addr: %s", udpAddr.String(), addr.String())
-			continue
+		if err := msg.Decode(); err != nil {
+			m.params.Logger.Warnf("Failed to handle decode ICE from %s: %v", addr.String(), err)
+			return true
 		}
 
-		if err = destinationConn.writePacket(buf[:n], udpAddr); err != nil {
-			m.params.Logger.Errorf("could not write packet: %v", err)
+		ufrag, stunAttrErr := ufragFromSTUNMessage(msg)
+		if stunAttrErr != nil {
+			m.params.Logger.Warnf("No Username attribute in STUN message from %s", addr.String())
+			return true
 		}
+		isIPv6 := udpAddr.IP.To4() == nil
+
+		m.mu.Lock()
+		destinationConn, _ = m.getConn(ufrag, isIPv6)
+		m.mu.Unlock()
+	}
+
+	if destinationConn == nil {
+		m.params.Logger.Tracef("dropping packet from %s, addr: %s", udpAddr.String(), addr.String())
+		return true
+	}
+
+	if err := destinationConn.writePacket(buf, udpAddr); err != nil {
+		m.params.Logger.Errorf("could not write packet: %v", err)
 	}
+	return true
 }
 
 func (m *UDPMuxDefault) getConn(ufrag string, isIPv6 bool) (val *udpMuxedConn, ok bool) {
@@ -279,12 +349,12 @@ func (m *UDPMuxDefault) getConn(ufrag string, isIPv6 bool) (val *udpMuxedConn, o
 	return
 }
 
-type bufferHolder struct {
-	buffer []byte
-}
-
-func newBufferHolder(size int) *bufferHolder {
-	return &bufferHolder{
-		buffer: make([]byte, size),
+// ufragFromSTUNMessage returns the local ufrag of the USERNAME of msg, the
+// part before the colon, which the muxes demultiplex connections by.
+func ufragFromSTUNMessage(msg *stun.Message) (string, error) {
+	attr, err := msg.Get(stun.AttrUsername)
+	if err != nil {
+		return "", err
 	}
+	return strings.Split(string(attr), ":")[0], nil
 }
@@ -8,7 +8,6 @@ import (
 	"time"
 
 	"github.com/pion/logging"
-	"github.com/pion/transport/packetio"
 )
 
 type udpMuxedConnParams struct {
@@ -26,16 +25,21 @@ type udpMuxedConn struct {
 	addresses []string
 
 	// channel holding incoming packets
-	buffer     *packetio.Buffer
+	buffer     *receiveBuffer
 	closedChan chan struct{}
 	closeOnce  sync.Once
 	mu         sync.Mutex
 }
 
 func newUDPMuxedConn(params *udpMuxedConnParams) *udpMuxedConn {
+	overflow := params.Mux.params.ReadBufferOverflow
+	if overflow == 0 {
+		overflow = BufferOverflowDropNewest
+	}
+
 	p := &udpMuxedConn{
 		params:     params,
-		buffer:     packetio.NewBuffer(),
+		buffer:     newReceiveBuffer(params.Mux.params.ReadBufferSize, overflow, &params.Mux.dropped),
 		closedChan: make(chan struct{}),
 	}
 
@@ -235,9 +239,7 @@ func decodeUDPAddr(buf []byte) (*net.UDPAddr, error) {
 	offset += ipLen
 	addr.Port = int(binary.LittleEndian.Uint16(buf[offset : offset+2]))
 	offset += 2
-	zone := make([]byte, len(buf[offset:]))
-	copy(zone, buf[offset:])
-	addr.Zone = string(zone)
+	addr.Zone = string(buf[offset:])
 
 	return &addr, nil
 }
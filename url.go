@@ -1,10 +1,10 @@
 package ice
 
 import (
-	"errors"
 	"net"
 	"net/url"
 	"strconv"
+	"strings"
 )
 
 // SchemeType indicates the type of server used in the ice.URL structure.
@@ -122,27 +122,8 @@ func ParseURL(raw string) (*URL, error) { //nolint:gocognit
 	}
 
 	var rawPort string
-	if u.Host, rawPort, err = net.SplitHostPort(rawParts.Opaque); err != nil {
-		var e *net.AddrError
-		if errors.As(err, &e) {
-			if e.Err == "missing port in address" {
-				nextRawURL := u.Scheme.String() + ":" + rawParts.Opaque
-				switch {
-				case u.Scheme == SchemeTypeSTUN || u.Scheme == SchemeTypeTURN:
-					nextRawURL += ":3478"
-					if rawParts.RawQuery != "" {
-						nextRawURL += "?" + rawParts.RawQuery
-					}
-					return ParseURL(nextRawURL)
-				case u.Scheme == SchemeTypeSTUNS || u.Scheme == SchemeTypeTURNS:
-					nextRawURL += ":5349"
-					if rawParts.RawQuery != "" {
-						nextRawURL += "?" + rawParts.RawQuery
-					}
-					return ParseURL(nextRawURL)
-				}
-			}
-		}
+	var hasPort bool
+	if u.Host, rawPort, hasPort, err = splitHostPort(rawParts.Opaque); err != nil {
 		return nil, err
 	}
 
@@ -150,8 +131,15 @@ func ParseURL(raw string) (*URL, error) { //nolint:gocognit
 		return nil, ErrHost
 	}
 
-	if u.Port, err = strconv.Atoi(rawPort); err != nil {
-		return nil, ErrPort
+	switch {
+	case !hasPort && u.IsSecure():
+		u.Port = 5349
+	case !hasPort:
+		u.Port = 3478
+	default:
+		if u.Port, err = strconv.Atoi(rawPort); err != nil || u.Port < 0 || u.Port > 65535 {
+			return nil, ErrPort
+		}
 	}
 
 	switch u.Scheme {
@@ -192,6 +180,78 @@ func ParseURL(raw string) (*URL, error) { //nolint:gocognit
 	return &u, nil
 }
 
+// splitHostPort splits the host and the port, if any, of a STUN or TURN URI.
+// An IPv6 address is enclosed in brackets, with an optional zone ID escaped
+// as "%25" (RFC 6874) or not. The host is returned without brackets and with
+// the zone ID unescaped, as the net package expects.
+func splitHostPort(hostport string) (host, port string, hasPort bool, err error) {
+	if strings.HasPrefix(hostport, "[") {
+		end := strings.IndexByte(hostport, ']')
+		if end < 0 {
+			return "", "", false, ErrInvalidIPv6
+		}
+		if host, err = parseIPv6Literal(hostport[1:end]); err != nil {
+			return "", "", false, err
+		}
+
+		rest := hostport[end+1:]
+		switch {
+		case rest == "":
+			return host, "", false, nil
+		case rest[0] != ':':
+			return "", "", false, ErrHost
+		case strings.Contains(rest[1:], ":"):
+			return "", "", false, errTooManyColonsAddr
+		}
+		return host, rest[1:], true, nil
+	}
+
+	if strings.ContainsAny(hostport, "[]") {
+		return "", "", false, ErrHost
+	}
+
+	switch strings.Count(hostport, ":") {
+	case 0:
+		return hostport, "", false, nil
+	case 1:
+		i := strings.IndexByte(hostport, ':')
+		return hostport[:i], hostport[i+1:], true, nil
+	}
+
+	// With or without a port, an IPv6 address is ambiguous unless bracketed
+	i := strings.LastIndexByte(hostport, ':')
+	if isIPv6Literal(hostport) || isIPv6Literal(hostport[:i]) {
+		return "", "", false, ErrUnbracketedIPv6
+	}
+	return "", "", false, errTooManyColonsAddr
+}
+
+// parseIPv6Literal validates the IPv6 address enclosed in brackets, and
+// returns it with its zone ID, if any, unescaped.
+func parseIPv6Literal(literal string) (string, error) {
+	addr, zone := literal, ""
+	if i := strings.IndexByte(literal, '%'); i >= 0 {
+		addr, zone = literal[:i], literal[i+1:]
+		zone = strings.TrimPrefix(zone, "25")
+		if zone == "" || strings.ContainsAny(zone, "%[]:") {
+			return "", ErrInvalidIPv6
+		}
+	}
+	if !isIPv6Literal(addr) {
+		return "", ErrInvalidIPv6
+	}
+
+	if zone != "" {
+		return addr + "%" + zone, nil
+	}
+	return addr, nil
+}
+
+// isIPv6Literal reports whether s is an IPv6 address without zone ID.
+func isIPv6Literal(s string) bool {
+	return strings.Contains(s, ":") && net.ParseIP(s) != nil
+}
+
 func parseProto(raw string) (ProtoType, error) {
 	qArgs, err := url.ParseQuery(raw)
 	if err != nil || len(qArgs) > 1 {
@@ -213,8 +273,15 @@ func parseProto(raw string) (ProtoType, error) {
 	return proto, nil
 }
 
+// String returns the URI of u, which ParseURL parses back to u but for the
+// credentials, which are not part of the URI. An IPv6 address is enclosed
+// in brackets, its zone ID is escaped as "%25" (RFC 6874).
 func (u URL) String() string {
-	rawURL := u.Scheme.String() + ":" + net.JoinHostPort(u.Host, strconv.Itoa(u.Port))
+	host := u.Host
+	if i := strings.IndexByte(host, '%'); i >= 0 {
+		host = host[:i] + "%25" + host[i+1:]
+	}
+	rawURL := u.Scheme.String() + ":" + net.JoinHostPort(host, strconv.Itoa(u.Port))
 	if u.Scheme == SchemeTypeTURN || u.Scheme == SchemeTypeTURNS {
 		rawURL += "?transport=" + u.Proto.String()
 	}
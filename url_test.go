@@ -25,6 +25,11 @@ func TestParseURL(t *testing.T) {
 			{"stun:google.de:1234", "stun:google.de:1234", SchemeTypeSTUN, false, "google.de", 1234, ProtoTypeUDP},
 			{"stuns:google.de", "stuns:google.de:5349", SchemeTypeSTUNS, true, "google.de", 5349, ProtoTypeTCP},
 			{"stun:[::1]:123", "stun:[::1]:123", SchemeTypeSTUN, false, "::1", 123, ProtoTypeUDP},
+			{"stun:[::1]", "stun:[::1]:3478", SchemeTypeSTUN, false, "::1", 3478, ProtoTypeUDP},
+			{"stun:[fe80::1%25eth0]:123", "stun:[fe80::1%25eth0]:123", SchemeTypeSTUN, false, "fe80::1%eth0", 123, ProtoTypeUDP},
+			{"stun:[fe80::1%eth0]", "stun:[fe80::1%25eth0]:3478", SchemeTypeSTUN, false, "fe80::1%eth0", 3478, ProtoTypeUDP},
+			{"stun:[::ffff:192.0.2.1]:123", "stun:[::ffff:192.0.2.1]:123", SchemeTypeSTUN, false, "::ffff:192.0.2.1", 123, ProtoTypeUDP},
+			{"turns:[2001:db8::1]?transport=tcp", "turns:[2001:db8::1]:5349?transport=tcp", SchemeTypeTURNS, true, "2001:db8::1", 5349, ProtoTypeTCP},
 			{"turn:google.de", "turn:google.de:3478?transport=udp", SchemeTypeTURN, false, "google.de", 3478, ProtoTypeUDP},
 			{"turns:google.de", "turns:google.de:5349?transport=tcp", SchemeTypeTURNS, true, "google.de", 5349, ProtoTypeTCP},
 			{"turn:google.de?transport=udp", "turn:google.de:3478?transport=udp", SchemeTypeTURN, false, "google.de", 3478, ProtoTypeUDP},
@@ -44,6 +49,10 @@ func TestParseURL(t *testing.T) {
 			assert.Equal(t, testCase.expectedHost, url.Host, "testCase: %d %v", i, testCase)
 			assert.Equal(t, testCase.expectedPort, url.Port, "testCase: %d %v", i, testCase)
 			assert.Equal(t, testCase.expectedProto, url.Proto, "testCase: %d %v", i, testCase)
+
+			roundTrip, err := ParseURL(url.String())
+			assert.NoError(t, err, "testCase: %d %v", i, testCase)
+			assert.Equal(t, url, roundTrip, "testCase: %d %v", i, testCase)
 		}
 	})
 	t.Run("Failure", func(t *testing.T) {
@@ -55,6 +64,19 @@ func TestParseURL(t *testing.T) {
 			{":::", errMissingProtocolScheme},
 			{"stun:[::1]:123:", errTooManyColonsAddr},
 			{"stun:[::1]:123a", ErrPort},
+			{"stun:[::1]:", ErrPort},
+			{"stun:google.de:65536", ErrPort},
+			{"stun:::1", ErrUnbracketedIPv6},
+			{"stun:2001:db8::1:3478", ErrUnbracketedIPv6},
+			{"turn:2001:db8::1?transport=udp", ErrUnbracketedIPv6},
+			{"stun:[google.de]:3478", ErrInvalidIPv6},
+			{"stun:[192.0.2.1]:3478", ErrInvalidIPv6},
+			{"stun:[::1:3478", ErrInvalidIPv6},
+			{"stun:[fe80::1%]:3478", ErrInvalidIPv6},
+			{"stun:[fe80::1%25]:3478", ErrInvalidIPv6},
+			{"stun:[::1]x:3478", ErrHost},
+			{"stun:google.de]:3478", ErrHost},
+			{"stun:a:b:c", errTooManyColonsAddr},
 			{"google.de", ErrSchemeType},
 			{"stun:", ErrHost},
 			{"stun:google.de:abc", ErrPort},
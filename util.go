@@ -1,8 +1,10 @@
 package ice
 
 import (
+	"bytes"
 	"fmt"
 	"net"
+	"sort"
 	"sync/atomic"
 	"time"
 
@@ -132,6 +134,22 @@ func stunRequest(read func([]byte) (int, error), write func([]byte) (int, error)
 	return res, nil
 }
 
+// sortIPs sorts ips by their bytes, IPv4 addresses first.
+func sortIPs(ips []net.IP) {
+	sort.Slice(ips, func(i, j int) bool {
+		a, b := ips[i].To4(), ips[j].To4()
+		switch {
+		case a != nil && b == nil:
+			return true
+		case a == nil && b != nil:
+			return false
+		case a == nil:
+			a, b = ips[i].To16(), ips[j].To16()
+		}
+		return bytes.Compare(a, b) < 0
+	})
+}
+
 func localInterfaces(vnet *vnet.Net, interfaceFilter func(string) bool, networkTypes []NetworkType) ([]net.IP, error) { //nolint:gocognit
 	ips := []net.IP{}
 	ifaces, err := vnet.Interfaces()
@@ -139,16 +157,7 @@ func localInterfaces(vnet *vnet.Net, interfaceFilter func(string) bool, networkT
 		return ips, err
 	}
 
-	var IPv4Requested, IPv6Requested bool
-	for _, typ := range networkTypes {
-		if typ.IsIPv4() {
-			IPv4Requested = true
-		}
-
-		if typ.IsIPv6() {
-			IPv6Requested = true
-		}
-	}
+	IPv4Requested, IPv6Requested := networkFamilies(networkTypes)
 
 	for _, iface := range ifaces {
 		if iface.Flags&net.FlagUp == 0 {
@@ -175,17 +184,7 @@ func localInterfaces(vnet *vnet.Net, interfaceFilter func(string) bool, networkT
 			case *net.IPAddr:
 				ip = addr.IP
 			}
-			if ip == nil || ip.IsLoopback() {
-				continue
-			}
-
-			if ipv4 := ip.To4(); ipv4 == nil {
-				if !IPv6Requested {
-					continue
-				} else if !isSupportedIPv6(ip) {
-					continue
-				}
-			} else if !IPv4Requested {
+			if !isGatheredIP(ip, IPv4Requested, IPv6Requested) {
 				continue
 			}
 
@@ -195,9 +194,35 @@ func localInterfaces(vnet *vnet.Net, interfaceFilter func(string) bool, networkT
 	return ips, nil
 }
 
-func listenUDPInPortRange(vnet *vnet.Net, log logging.LeveledLogger, portMax, portMin int, network string, laddr *net.UDPAddr) (vnet.UDPPacketConn, error) {
+// networkFamilies reports whether networkTypes include IPv4 and IPv6 ones.
+func networkFamilies(networkTypes []NetworkType) (ipv4, ipv6 bool) {
+	for _, typ := range networkTypes {
+		if typ.IsIPv4() {
+			ipv4 = true
+		}
+
+		if typ.IsIPv6() {
+			ipv6 = true
+		}
+	}
+	return ipv4, ipv6
+}
+
+// isGatheredIP reports whether host candidates are gathered on the local
+// address ip, given the families requested.
+func isGatheredIP(ip net.IP, ipv4Requested, ipv6Requested bool) bool {
+	if ip == nil || ip.IsLoopback() {
+		return false
+	}
+	if ip.To4() == nil {
+		return ipv6Requested && isSupportedIPv6(ip)
+	}
+	return ipv4Requested
+}
+
+func listenUDPInPortRange(transport PacketTransport, log logging.LeveledLogger, portMax, portMin int, network string, laddr *net.UDPAddr) (net.PacketConn, error) {
 	if (laddr.Port != 0) || ((portMin == 0) && (portMax == 0)) {
-		return vnet.ListenUDP(network, laddr)
+		return transport.ListenPacket(network, laddr)
 	}
 	var i, j int
 	i = portMin
@@ -216,7 +241,7 @@ func listenUDPInPortRange(vnet *vnet.Net, log logging.LeveledLogger, portMax, po
 	portCurrent := portStart
 	for {
 		laddr = &net.UDPAddr{IP: laddr.IP, Port: portCurrent}
-		c, e := vnet.ListenUDP(network, laddr)
+		c, e := transport.ListenPacket(network, laddr)
 		if e == nil {
 			return c, e //nolint:nilerr
 		}
@@ -0,0 +1,61 @@
+package ice
+
+import "context"
+
+// WaitForConnectionState blocks until the connection state of the agent is
+// state, ctx is done or the agent is closed. It returns at once if the agent
+// is already in state.
+func (a *Agent) WaitForConnectionState(ctx context.Context, state ConnectionState) error {
+	err := a.waitForState(ctx, func(agent *Agent) bool {
+		return agent.connectionState == state
+	})
+	if err != nil && state == ConnectionStateClosed && a.ok() != nil {
+		// The agent is closed once its task loop is done
+		select {
+		case <-a.taskLoopDone:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+// WaitForGatheringComplete blocks until gathering is complete, ctx is done or
+// the agent is closed. It returns at once if gathering is already complete.
+func (a *Agent) WaitForGatheringComplete(ctx context.Context) error {
+	return a.waitForState(ctx, func(agent *Agent) bool {
+		return agent.gatheringState == GatheringStateComplete
+	})
+}
+
+// waitForState waits until reached, evaluated on the task loop, holds.
+func (a *Agent) waitForState(ctx context.Context, reached func(*Agent) bool) error {
+	for {
+		var done bool
+		var changed <-chan struct{}
+		if err := a.run(ctx, func(ctx context.Context, agent *Agent) {
+			done = reached(agent)
+			changed = agent.stateChanged
+		}); err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-a.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// notifyStateChanged wakes up the goroutines waiting for a state.
+// Note: the caller should hold the agent lock.
+func (a *Agent) notifyStateChanged() {
+	close(a.stateChanged)
+	a.stateChanged = make(chan struct{})
+}
@@ -0,0 +1,69 @@
+//go:build !js
+// +build !js
+
+package ice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitForState(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	t.Run("Gathering", func(t *testing.T) {
+		a, err := NewAgent(&AgentConfig{
+			NetworkTypes:   []NetworkType{NetworkTypeUDP4},
+			CandidateTypes: []CandidateType{CandidateTypeHost},
+		})
+		require.NoError(t, err)
+		require.NoError(t, a.OnCandidate(func(Candidate) {}))
+
+		shortCtx, shortCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer shortCancel()
+		assert.ErrorIs(t, a.WaitForGatheringComplete(shortCtx), context.DeadlineExceeded)
+
+		require.NoError(t, a.GatherCandidates())
+		require.NoError(t, a.WaitForGatheringComplete(ctx))
+		require.NoError(t, a.WaitForGatheringComplete(ctx))
+
+		closed := make(chan error)
+		go func() {
+			closed <- a.WaitForConnectionState(ctx, ConnectionStateClosed)
+		}()
+		require.NoError(t, a.Close())
+		assert.NoError(t, <-closed)
+		assert.ErrorIs(t, a.WaitForGatheringComplete(ctx), ErrClosed)
+	})
+
+	t.Run("Connection", func(t *testing.T) {
+		aAgent, err := NewAgent(&AgentConfig{NetworkTypes: supportedNetworkTypes()})
+		require.NoError(t, err)
+		bAgent, err := NewAgent(&AgentConfig{NetworkTypes: supportedNetworkTypes()})
+		require.NoError(t, err)
+
+		connected := make(chan error)
+		go func() {
+			connected <- aAgent.WaitForConnectionState(ctx, ConnectionStateConnected)
+		}()
+
+		aConn, bConn := connect(aAgent, bAgent)
+		assert.NoError(t, <-connected)
+		assert.NoError(t, bAgent.WaitForConnectionState(ctx, ConnectionStateConnected))
+
+		assert.NoError(t, aConn.Close())
+		assert.NoError(t, bConn.Close())
+	})
+}